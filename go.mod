@@ -2,4 +2,21 @@ module wol-server
 
 go 1.24.4
 
-require github.com/gorilla/mux v1.8.1
+require (
+	github.com/BurntSushi/toml v1.6.0
+	github.com/alicebob/miniredis/v2 v2.39.0
+	github.com/fsnotify/fsnotify v1.10.1
+	github.com/google/gopacket v1.1.19
+	github.com/gorilla/mux v1.8.1
+	github.com/redis/go-redis/v9 v9.22.0
+	go.etcd.io/bbolt v1.4.3
+	golang.org/x/crypto v0.43.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/cespare/xxhash/v2 v2.3.0 // indirect
+	github.com/yuin/gopher-lua v1.1.1 // indirect
+	go.uber.org/atomic v1.11.0 // indirect
+	golang.org/x/sys v0.37.0 // indirect
+)
@@ -2,17 +2,43 @@
 package main
 
 import (
+	"bufio"
 	"flag"
 	"fmt"
+	"maps"
+	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
+	wol_auth "wol-server/wol/auth"
+	wol_backup "wol-server/wol/backup"
+	wol_config "wol-server/wol/config"
 	wol_device "wol-server/wol/device"
+	wol_dhcp "wol-server/wol/dhcp"
+	wol_events "wol-server/wol/events"
+	wol_federation "wol-server/wol/federation"
+	wol_ha "wol-server/wol/ha"
+	wol_i18n "wol-server/wol/i18n"
 	wol_log "wol-server/wol/log"
+	wol_mdns "wol-server/wol/mdns"
+	wol_monitor "wol-server/wol/monitor"
 	wol_network "wol-server/wol/network"
 	wol_packet "wol-server/wol/packet"
+	wol_plugin "wol-server/wol/plugin"
+	wol_power "wol-server/wol/power"
+	wol_proxy "wol-server/wol/proxy"
+	wol_relay "wol-server/wol/relay"
+	wol_schedule "wol-server/wol/schedule"
 	wol_server "wol-server/wol/server"
+	_ "wol-server/wol/statsd"
+	wol_status "wol-server/wol/status"
+	wol_webhook "wol-server/wol/webhook"
 )
 
 func main() {
@@ -23,23 +49,133 @@ func main() {
 		logLevel      = flag.String("level", "info", "Log level: debug, info, warn, error")
 		verbose       = flag.Bool("verbose", false, "Enable verbose output (same as -level debug)")
 		quiet         = flag.Bool("quiet", false, "Quiet mode - only errors (same as -level error)")
-		configPath    = flag.String("config", "", "Device configuration file path (default: system config directory)")
+		accessLog     = flag.String("access-log-format", wol_server.AccessLogText, "Access log format: text, or json for one JSON object per request (server mode)")
+		configPath    = flag.String("config", "", "Device configuration file path, JSON, YAML (.yaml) or TOML (.toml) (default: system config directory)")
+		serverConfig  = flag.String("server-config", "", "Server settings file written by 'init' (default: server.json next to the device file)")
 		serverMode    = flag.Bool("server", false, "Run in server mode")
 		serverPort    = flag.Int("server-port", 8080, "Server port (default: 8080)")
 		serverHost    = flag.String("server-host", "0.0.0.0", "Server host (default: 0.0.0.0)")
 		enableCORS    = flag.Bool("cors", true, "Enable CORS headers (default: true)")
+		corsOrigins   = flag.String("cors-origins", "*", "Comma-separated origins allowed to call the API from a browser, or * for any")
+		corsMethods   = flag.String("cors-methods", strings.Join(wol_server.DefaultCORSConfig().AllowedMethods, ","), "Comma-separated methods allowed in CORS requests")
+		corsHeaders   = flag.String("cors-headers", strings.Join(wol_server.DefaultCORSConfig().AllowedHeaders, ","), "Comma-separated request headers allowed in CORS requests")
+		corsCreds     = flag.Bool("cors-credentials", false, "Let allowed origins send cookies and HTTP auth (requires -cors-origins without *)")
+		rateLimit     = flag.Float64("rate-limit", 0, "Average API requests per second allowed from each client IP, 0 for no limit (server mode)")
+		rateBurst     = flag.Int("rate-burst", 20, "Requests a client IP may make at once before -rate-limit applies")
+		wakeRate      = flag.Float64("wake-rate-limit", 1, "Average wake requests per second allowed from each client IP, 0 for no limit (server mode)")
+		wakeBurst     = flag.Int("wake-rate-burst", 10, "Wake requests a client IP may make at once before -wake-rate-limit applies")
+		shutdownWait  = flag.Duration("shutdown-timeout", wol_server.DefaultShutdownTimeout, "How long to let requests in flight finish on SIGINT/SIGTERM (server mode)")
+		metrics       = flag.Bool("metrics", false, "Serve Prometheus metrics at /metrics, behind API authentication when it is enabled (server mode)")
+		webhooks      = flag.String("webhook", "", "Comma-separated URLs to POST wake and device status events to (server mode)")
+		webhookSecret = flag.String("webhook-secret", "", "Sign -webhook deliveries with HMAC-SHA256 using this secret (or set WOL_WEBHOOK_SECRET)")
+		swaggerUI     = flag.Bool("swagger-ui", false, "Serve a Swagger UI page for the API at /api/docs (server mode)")
+		maxBody       = flag.Int64("max-body-bytes", wol_server.DefaultMaxBodyBytes, "Largest JSON request body the API accepts, in bytes (server mode)")
 		verify        = flag.Bool("verify", false, "Enable packet verification")
 		verifyCapture = flag.Bool("verify-capture", false, "Enable packet capture verification")
 		verifyPing    = flag.Bool("verify-ping", false, "Enable ping verification after wake")
+		verifyARP     = flag.Bool("verify-arp", false, "Verify the device answers ARP after wake (device needs an IP)")
+		verifyICMP    = flag.Bool("verify-icmp", false, "Verify the device answers ICMP ping after wake (needs root)")
+		verifyAgent   = flag.String("verify-agent", "", "URL polled after wake until it answers 2xx, e.g. an agent health check")
+		packetRepeat  = flag.Int("packet-repeat", wol_packet.DefaultRepeatCount, "How many times the MAC is repeated in the magic packet")
+		broadcast     = flag.String("broadcast", wol_network.BroadcastLimited, "Broadcast to 255.255.255.255 (limited), the subnet's address (directed) or every interface's subnet (all)")
+		unicast       = flag.Bool("unicast", false, "Also send the packet to the device's IP address, for hosts on other subnets")
+		ipv6          = flag.Bool("6", false, "Send over IPv6 to the all-nodes group ff02::1 instead of an IPv4 broadcast")
+		ipv6Address   = flag.String("6-address", "", "IPv6 address to send to with -6 instead of ff02::1, e.g. ff02::1%eth1 or a host address")
+		retries       = flag.Int("retries", 0, "Resend a wake packet this many times if sending fails")
+		retryInterval = flag.Duration("retry-interval", wol_network.DefaultRetryInterval, "Wait before the first retry; doubles after each one")
+		copies        = flag.Int("copies", 1, "Send each wake packet this many times as one attempt")
+		copyInterval  = flag.Duration("copy-interval", wol_network.DefaultCopyInterval, "Wait between the copies sent with -copies")
+		allPorts      = flag.Bool("all-ports", false, "Send to both port 9 and port 7, since NIC firmware listens on either")
+		extraPorts    = flag.String("extra-ports", "", "Comma-separated UDP ports to send to in addition to -port")
+		waitOnline    = flag.Duration("wait", 0, "After waking, wait up to this long for the device to come online, e.g. 90s")
+		iface         = flag.String("iface", "", "Network interface to send wake packets from (default: the one the route picks)")
+		sourceIP      = flag.String("source-ip", "", "Local address wake packets are sent from, for policy-routed hosts (default: the one the route picks)")
+		sourcePort    = flag.Int("source-port", 0, "UDP source port of wake packets, for firewall rules keyed on it (default: any)")
+		wakeAddress   = flag.String("wake-address", "", "Send wake packets to this host[:port], e.g. a router's public address, instead of broadcasting")
+		rawEthernet   = flag.Bool("raw", false, "Send the magic packet as a raw Ethernet frame (EtherType 0x0842) instead of UDP (Linux, needs root)")
+		vlan          = flag.Int("vlan", 0, "Tag -raw frames for this 802.1Q VLAN, for hosts on a trunk port (default: untagged)")
+		secureOn      = flag.String("secureon", "", "SecureOn password appended to the packet, e.g. 00:11:22:33:44:55 (overrides the device's)")
+		packetPadding = flag.Int("packet-padding", 0, "Zero bytes appended to the magic packet, for NICs that want longer packets")
+		verifyTimeout = flag.Duration("verify-timeout", 30*time.Second, "How long each post-wake check keeps trying")
 		netInfo       = flag.Bool("net-info", false, "Show network information and exit")
+		dhcpLeases    = flag.String("dhcp-leases", "", "DHCP lease file to watch for device IP changes (server mode)")
+		dhcpFormat    = flag.String("dhcp-format", "dnsmasq", "DHCP lease file format: dnsmasq, isc, kea")
+		dhcpAPI       = flag.String("dhcp-api", "", "Router API URL returning DHCP leases as JSON (server mode)")
+		dhcpAPIToken  = flag.String("dhcp-api-token", "", "Bearer token for the router lease API")
+		dhcpInterval  = flag.Duration("dhcp-interval", wol_dhcp.DefaultPollInterval, "How often to poll DHCP leases")
+		reloadEvery   = flag.Duration("reload-interval", wol_device.DefaultReloadInterval, "How often to check the device file for outside edits where it cannot be watched, 0 to not reload it (server mode)")
+		flushDelay    = flag.Duration("flush-delay", wol_device.DefaultFlushDelay, "Write wake times and statuses out in batches this long after the first change, 0 to write each at once (server mode)")
+		statusCache   = flag.Duration("status-cache-ttl", wol_server.DefaultStatusCacheTTL, "How long GET /api/status reuses a device's last probe (server mode)")
+		statusEvery   = flag.Duration("status-interval", wol_status.DefaultInterval, "How often to check which devices are online, 0 to disable (server mode)")
+		apiKey        = flag.String("api-key", "", "Require this key as a bearer token or X-API-Key header on the API (or set WOL_API_KEY)")
+		tlsCert       = flag.String("tls-cert", "", "Serve the API over HTTPS with this PEM certificate (server mode)")
+		tlsKey        = flag.String("tls-key", "", "PEM private key for -tls-cert")
+		tlsClientCA   = flag.String("tls-client-ca", "", "Require API clients to present a certificate signed by a CA in this PEM file")
+		tlsRedirect   = flag.Int("tls-redirect-port", 0, "Also listen for plain HTTP on this port and redirect it to HTTPS, 0 to disable")
+		sessionTTL    = flag.Duration("session-ttl", wol_auth.DefaultSessionTTL, "How long a session token from POST /api/login stays valid (server mode)")
+		sessionKey    = flag.String("session-key", "", "Key signing session tokens, shared by servers that accept each other's sessions (or set WOL_SESSION_KEY; default: random per run)")
+		oidcIssuer    = flag.String("oidc-issuer", "", "OIDC issuer URL for API authentication")
+		oidcClientID  = flag.String("oidc-client-id", "", "OIDC client ID (expected token audience)")
+		oidcGroups    = flag.String("oidc-groups-claim", "groups", "OIDC token claim containing group names")
+		ldapURL       = flag.String("ldap-url", "", "LDAP server URL for API authentication (ldaps://, or ldap:// with -ldap-starttls)")
+		ldapStartTLS  = flag.Bool("ldap-starttls", false, "Upgrade ldap:// connections to TLS with StartTLS before sending passwords")
+		ldapBindDN    = flag.String("ldap-bind-dn", "", "LDAP service account DN used to look up users")
+		ldapBindPass  = flag.String("ldap-bind-password", "", "LDAP service account password")
+		ldapBaseDN    = flag.String("ldap-base-dn", "", "LDAP base DN for user searches")
+		ldapUserAttr  = flag.String("ldap-user-attr", "uid", "LDAP attribute matched against the login name (sAMAccountName for AD)")
+		ldapGroupAttr = flag.String("ldap-group-attr", "memberOf", "LDAP attribute listing the user's groups")
+		authRoles     = flag.String("auth-roles", "", "Map identity provider groups to roles, e.g. wol-admins=admin,family=operator")
+		authDefault   = flag.String("auth-default-role", "", "Role for authenticated users in no mapped group (default: deny)")
+		haLeaseFile   = flag.String("ha-lease-file", "", "Shared leadership lease file on a filesystem with flock; enables high-availability mode (node clocks must be in sync)")
+		haRedis       = flag.String("ha-redis", "", "Redis URL holding the leadership lease, the only database lease backend (there is no SQLite one); enables high-availability mode")
+		haNodeID      = flag.String("ha-node-id", "", "Unique node ID for high-availability mode (default: hostname)")
+		haPeers       = flag.String("ha-peers", "", "Comma-separated peer server URLs for health checks")
+		haSecret      = flag.String("ha-secret", "", "Secret shared by HA nodes, letting peers read local status without API credentials (or set WOL_HA_SECRET)")
+		haLeaseTTL    = flag.Duration("ha-lease-ttl", wol_ha.DefaultLeaseTTL, "Leadership lease duration")
+		pluginDir     = flag.String("plugin-dir", "", "Directory of external plugin executables to load")
+		statsdAddr    = flag.String("statsd", "", "StatsD/DogStatsD address (host:port) for wake metrics")
+		statsdPrefix  = flag.String("statsd-prefix", "wol", "Prefix for StatsD metric names")
+		statsdTags    = flag.String("statsd-tags", "", "Comma-separated DogStatsD tags added to every metric, e.g. env:home")
+		dogstatsd     = flag.Bool("dogstatsd", false, "Emit DogStatsD tags (Datadog/Telegraf)")
+		proxyMappings = flag.String("proxy", "", "Wake-on-demand TCP proxies, e.g. 2222=nas:22,8096=nas:8096 (server mode)")
+		proxyWait     = flag.Duration("proxy-wait", wol_proxy.DefaultWaitTimeout, "How long a proxied connection waits for the device to boot")
+		powerWait     = flag.Duration("power-wait", wol_power.DefaultWaitWindow, "How long a magic packet gets before power-on fallback")
+		mdns          = flag.Bool("mdns", true, "Advertise the server on the LAN via mDNS/DNS-SD (server mode)")
+		mdnsName      = flag.String("mdns-name", "", "mDNS service instance name (default: wol-server on <hostname>)")
+		monitor       = flag.Bool("monitor", false, "Log every magic packet seen on the network and expose them in the API (server mode)")
+		monitorPorts  = flag.String("monitor-ports", "7,9", "Comma-separated UDP ports the monitor listens on")
+		monitorRaw    = flag.Bool("monitor-raw", false, "Capture frames on a raw socket instead of binding ports (Linux, needs root)")
+		monitorIface  = flag.String("monitor-interface", "", "Interface for raw capture (default: all)")
+		monitorRecord = flag.String("monitor-record", "", "File every magic packet seen is appended to as JSON lines (listen and -monitor)")
+		relay         = flag.Bool("relay", false, "Re-broadcast magic packets received on -relay-port out of -iface (server mode)")
+		relayPort     = flag.Int("relay-port", wol_relay.DefaultListenPort, "UDP port the relay receives magic packets on")
+		relayFrom     = flag.String("relay-from", "", "Only relay packets arriving on this interface (default: any, e.g. a router port-forward)")
+		lang          = flag.String("lang", "", "Language for output and help text, e.g. de or es (default: from LANG)")
+		langDir       = flag.String("lang-dir", "", "Directory of additional <lang>.json message catalogs")
+		strictMAC     = flag.Bool("strict-mac", false, "Reject broadcast and multicast MAC addresses, which are always typos")
+		demo          = flag.Bool("demo", false, "Use a throwaway device file seeded with sample devices (unless -config is given)")
+		macStyle      = flag.String("mac-style", "colon", "How MAC addresses are stored and shown: colon, hyphen, dotted, bare")
+		storeBackend  = flag.String("store", wol_device.BackendFile, "Device store backend: file, bolt or redis")
+		storeURL      = flag.String("store-url", "", "Server of the redis store backend, e.g. redis://host:6379/0")
+		storeKeyFile  = flag.String("store-key-file", "", "Encrypt the device file with the key or passphrase in this file (or set WOL_STORE_PASSPHRASE)")
+		backupDir     = flag.String("backup-dir", "", "Directory backups are written to (default: backups next to the device file)")
+		backupKeep    = flag.Int("backup-keep", wol_backup.DefaultKeep, "How many backups to keep, oldest removed first; 0 keeps all")
 	)
 
 	flag.Parse()
 
+	if *langDir != "" {
+		if err := wol_i18n.LoadDir(*langDir); err != nil {
+			fmt.Printf("Error loading message catalogs: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	wol_i18n.SetLanguage(wol_i18n.DetectLanguage(*lang))
+
 	if *netInfo {
 		logger, err := setupLogging(*logFile, *logLevel, *verbose, *quiet)
 		if err != nil {
-			fmt.Printf("Error setting up logging: %v\n", err)
+			wol_i18n.Printf("Error setting up logging: %v\n", err)
 			os.Exit(1)
 		}
 		defer logger.Close()
@@ -56,7 +192,7 @@ func main() {
 
 	logger, err := setupLogging(*logFile, *logLevel, *verbose, *quiet)
 	if err != nil {
-		fmt.Printf("Error setting up logging: %v\n", err)
+		wol_i18n.Printf("Error setting up logging: %v\n", err)
 		os.Exit(1)
 	}
 	defer logger.Close()
@@ -68,368 +204,3042 @@ func main() {
 		deviceConfig.ConfigPath = *configPath
 	}
 
-	deviceStore, err := wol_device.NewDeviceStore(deviceConfig)
-	if err != nil {
-		fmt.Printf("Error setting up device store: %v\n", err)
-		logger.Error("Failed to initialize device store: %v", err)
+	settingsPath := wol_config.DefaultConfigPath(deviceConfig.ConfigPath)
+	if *serverConfig != "" {
+		settingsPath = *serverConfig
+	}
+
+	settings, err := wol_config.Load(settingsPath)
+	if err != nil {
+		wol_i18n.Printf("Error loading server settings: %v\n", err)
+		logger.Error("Failed to load server settings: %v", err)
+		os.Exit(1)
+	}
+	applySettings(settings)
+
+	if *demo && *configPath == "" {
+		deviceConfig.ConfigPath = filepath.Join(os.TempDir(), "wol-server-demo", "devices.json")
+	}
+	deviceConfig.StrictMAC = *strictMAC
+	deviceConfig.Backend = *storeBackend
+	deviceConfig.URL = *storeURL
+	if *serverMode {
+		deviceConfig.FlushDelay = *flushDelay
+	}
+	switch passphrase := os.Getenv("WOL_STORE_PASSPHRASE"); {
+	case *storeKeyFile != "":
+		deviceConfig.Key, err = wol_device.LoadStoreKey(*storeKeyFile)
+	case passphrase != "":
+		deviceConfig.Key, err = wol_device.NewPassphraseKey(passphrase)
+	}
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *broadcast, err = wol_network.ParseBroadcastMode(*broadcast); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *accessLog, err = wol_server.ParseAccessLogFormat(*accessLog); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *sourceIP != "" && net.ParseIP(*sourceIP) == nil {
+		wol_i18n.Printf("Error: invalid -source-ip: %s\n", *sourceIP)
+		os.Exit(1)
+	}
+	if *sourcePort < 0 || *sourcePort > 65535 {
+		wol_i18n.Printf("Error: invalid -source-port: %d\n", *sourcePort)
+		os.Exit(1)
+	}
+	if err := wol_network.ValidateVLAN(*vlan); err != nil {
+		wol_i18n.Printf("Error: invalid -vlan: %v\n", err)
+		os.Exit(1)
+	}
+	if *copies < 1 {
+		wol_i18n.Printf("Error: invalid -copies: %d\n", *copies)
+		os.Exit(1)
+	}
+	packetConfig := wol_packet.PacketOptions{RepeatCount: *packetRepeat, Padding: *packetPadding}
+	if err := packetConfig.Validate(); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if *wakeAddress != "" {
+		if _, _, err := wol_network.ParseWakeAddress(*wakeAddress); err != nil {
+			wol_i18n.Printf("Error: invalid -wake-address: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	retry := wol_network.RetryConfig{Count: *retries, Interval: *retryInterval, Backoff: wol_network.DefaultRetryBackoff}
+
+	sendPorts, err := parsePorts(*extraPorts)
+	if err != nil {
+		wol_i18n.Printf("Error: invalid -extra-ports: %v\n", err)
+		os.Exit(1)
+	}
+	if *allPorts {
+		sendPorts = append(sendPorts, wol_network.DefaultWoLPort, wol_network.AlternativeWoLPort)
+	}
+
+	relayConfig := wol_relay.Config{
+		ListenPort:      *relayPort,
+		ListenInterface: *relayFrom,
+		Send: wol_network.SendOptions{
+			Port:        *port,
+			Interface:   *iface,
+			Broadcast:   *broadcast,
+			IPv6:        *ipv6 || *ipv6Address != "",
+			IPv6Address: *ipv6Address,
+			Retry:       retry,
+			ExtraPorts:  sendPorts,
+			SourceIP:    *sourceIP,
+			SourcePort:  *sourcePort,
+		},
+	}
+	deviceConfig.MACStyle, err = wol_packet.ParseMACStyle(*macStyle)
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	deviceStore, err := wol_device.NewDeviceStore(deviceConfig)
+	if err != nil {
+		wol_i18n.Printf("Error setting up device store: %v\n", err)
+		logger.Error("Failed to initialize device store: %v", err)
+		os.Exit(1)
+	}
+
+	if *demo {
+		seedDemoDevices(deviceStore, deviceConfig.ConfigPath, logger)
+	}
+
+	siteStore, err := wol_federation.NewSiteStore(wol_federation.DefaultSitesPath(deviceConfig.ConfigPath))
+	if err != nil {
+		wol_i18n.Printf("Error setting up site store: %v\n", err)
+		logger.Error("Failed to initialize site store: %v", err)
+		os.Exit(1)
+	}
+
+	templateStore, err := wol_device.NewTemplateStore(wol_device.DefaultTemplatesPath(deviceConfig.ConfigPath))
+	if err != nil {
+		wol_i18n.Printf("Error setting up template store: %v\n", err)
+		logger.Error("Failed to initialize template store: %v", err)
+		os.Exit(1)
+	}
+
+	groupStore, err := openGroupStore(deviceConfig)
+	if err != nil {
+		wol_i18n.Printf("Error setting up group store: %v\n", err)
+		logger.Error("Failed to initialize group store: %v", err)
+		os.Exit(1)
+	}
+
+	scheduleStore, err := openScheduleStore(deviceConfig)
+	if err != nil {
+		wol_i18n.Printf("Error setting up schedule store: %v\n", err)
+		logger.Error("Failed to initialize schedule store: %v", err)
+		os.Exit(1)
+	}
+
+	backupConfig := wol_backup.Config{
+		Dir:  *backupDir,
+		Keep: *backupKeep,
+		Files: map[string]string{
+			"sites.json":     wol_federation.DefaultSitesPath(deviceConfig.ConfigPath),
+			"templates.json": wol_device.DefaultTemplatesPath(deviceConfig.ConfigPath),
+			"groups.json":    wol_device.DefaultGroupsPath(deviceConfig.ConfigPath),
+			"schedules.json": wol_schedule.DefaultSchedulesPath(deviceConfig.ConfigPath),
+			"server.json":    settingsPath,
+		},
+		Key: deviceConfig.Key,
+	}
+	if backupConfig.Dir == "" {
+		backupConfig.Dir = filepath.Join(filepath.Dir(deviceConfig.ConfigPath), "backups")
+	}
+	if *monitorRecord != "" {
+		backupConfig.Files["packets.jsonl"] = *monitorRecord
+	}
+
+	plugins := wol_plugin.NewManager(logger)
+	defer plugins.Close()
+
+	if *pluginDir != "" {
+		if err := plugins.LoadDir(*pluginDir); err != nil {
+			wol_i18n.Printf("Error loading plugins: %v\n", err)
+			logger.Error("Failed to load plugins: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	if *statsdAddr != "" {
+		err := plugins.Enable("notifier", "statsd", wol_plugin.Options{
+			"address":   *statsdAddr,
+			"prefix":    *statsdPrefix,
+			"tags":      *statsdTags,
+			"dogstatsd": strconv.FormatBool(*dogstatsd),
+		})
+		if err != nil {
+			wol_i18n.Printf("Error setting up StatsD metrics: %v\n", err)
+			logger.Error("Failed to initialize StatsD metrics: %v", err)
+			os.Exit(1)
+		}
+		logger.Info("Emitting StatsD metrics to %s", *statsdAddr)
+	}
+
+	powerWaker := wol_power.NewWaker(wol_power.Config{WaitWindow: *powerWait}, logger)
+
+	monitorConfig, err := parseMonitorConfig(*monitorPorts, *monitorRaw, *monitorIface, *monitorRecord)
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if *serverMode {
+		var dhcpConfig *wol_dhcp.WatcherConfig
+		var proxyConfig *wol_proxy.Config
+		if *proxyMappings != "" {
+			mappings, err := wol_proxy.ParseMappings(*proxyMappings)
+			if err != nil {
+				wol_i18n.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+			proxyConfig = &wol_proxy.Config{Mappings: mappings, WaitTimeout: *proxyWait}
+		}
+
+		var packetMonitor *wol_monitor.Monitor
+		if *monitor {
+			packetMonitor = wol_monitor.NewMonitor(monitorConfig, deviceStore, logger)
+			if err := packetMonitor.Start(); err != nil {
+				wol_i18n.Printf("Error starting packet monitor: %v\n", err)
+				logger.Error("Failed to start packet monitor: %v", err)
+				os.Exit(1)
+			}
+			defer packetMonitor.Stop()
+		}
+
+		if *relay {
+			packetRelay := wol_relay.NewRelay(relayConfig, logger)
+			if err := packetRelay.Start(); err != nil {
+				wol_i18n.Printf("Error starting relay: %v\n", err)
+				logger.Error("Failed to start relay: %v", err)
+				os.Exit(1)
+			}
+			defer packetRelay.Stop()
+		}
+
+		var haCoordinator *wol_ha.Coordinator
+		if *dhcpLeases != "" || *dhcpAPI != "" {
+			format, err := wol_dhcp.ParseFormat(*dhcpFormat)
+			if err != nil {
+				wol_i18n.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+
+			dhcpConfig = &wol_dhcp.WatcherConfig{
+				LeaseFile:    *dhcpLeases,
+				Format:       format,
+				APIURL:       *dhcpAPI,
+				APIToken:     *dhcpAPIToken,
+				PollInterval: *dhcpInterval,
+			}
+		}
+
+		// The environment keeps the key out of the process list
+		key := *apiKey
+		if key == "" {
+			key = os.Getenv("WOL_API_KEY")
+		}
+		authenticator, err := setupAuth(authOptions{
+			oidcIssuer:    *oidcIssuer,
+			oidcClientID:  *oidcClientID,
+			oidcGroups:    *oidcGroups,
+			ldapURL:       *ldapURL,
+			ldapStartTLS:  *ldapStartTLS,
+			ldapBindDN:    *ldapBindDN,
+			ldapBindPass:  *ldapBindPass,
+			ldapBaseDN:    *ldapBaseDN,
+			ldapUserAttr:  *ldapUserAttr,
+			ldapGroupAttr: *ldapGroupAttr,
+			roles:         *authRoles,
+			defaultRole:   *authDefault,
+			apiKey:        key,
+			users:         settings.Users,
+			clientCerts:   *tlsClientCA != "",
+		})
+		if err != nil {
+			wol_i18n.Printf("Error setting up authentication: %v\n", err)
+			logger.Error("Failed to initialize authentication: %v", err)
+			os.Exit(1)
+		}
+		for _, provider := range plugins.AuthProviders() {
+			authenticator.AddProvider(provider)
+		}
+		if strings.HasPrefix(strings.ToLower(*ldapURL), "ldap://") && !*ldapStartTLS {
+			wol_i18n.Println("⚠ WARNING: -ldap-url is ldap:// without -ldap-starttls; user and service passwords go to the LDAP server in clear text")
+			logger.Warn("LDAP: %s is unencrypted; use ldaps:// or -ldap-starttls", *ldapURL)
+		}
+
+		var sessions *wol_auth.SessionProvider
+		if authenticator.Enabled() {
+			signingKey := *sessionKey
+			if signingKey == "" {
+				signingKey = os.Getenv("WOL_SESSION_KEY")
+			}
+			if signingKey != "" {
+				sessions, err = wol_auth.NewSessionProviderWithKey(signingKey, *sessionTTL)
+			} else {
+				sessions, err = wol_auth.NewSessionProvider(*sessionTTL)
+			}
+			if err != nil {
+				wol_i18n.Printf("Error setting up authentication: %v\n", err)
+				logger.Error("Failed to initialize sessions: %v", err)
+				os.Exit(1)
+			}
+			// First, so OIDC does not take session tokens for its own JWTs
+			authenticator.PrependProvider(sessions)
+		}
+
+		if *haLeaseFile != "" && *haRedis != "" {
+			wol_i18n.Println("Error: use either -ha-lease-file or -ha-redis, not both")
+			os.Exit(1)
+		}
+		if *haLeaseFile != "" || *haRedis != "" {
+			peers := splitList(*haPeers)
+			secret := *haSecret
+			if secret == "" {
+				secret = os.Getenv("WOL_HA_SECRET")
+			}
+
+			var lease wol_ha.LeaseBackend = &wol_ha.FileLease{Path: *haLeaseFile}
+			if *haRedis != "" {
+				client, err := wol_device.OpenRedis(*haRedis)
+				if err != nil {
+					wol_i18n.Printf("Error setting up high-availability mode: %v\n", err)
+					logger.Error("Failed to connect to the HA Redis: %v", err)
+					os.Exit(1)
+				}
+				defer client.Close()
+				lease = &wol_ha.RedisLease{Client: client}
+			}
+
+			coordinator, err := wol_ha.NewCoordinator(wol_ha.Config{
+				NodeID:   *haNodeID,
+				Backend:  lease,
+				LeaseTTL: *haLeaseTTL,
+				Peers:    peers,
+				Secret:   secret,
+				Sync: func() {
+					// Pick up the leader's changes; a standby writes nothing
+					// of its own to the shared store
+					_, err := deviceStore.ReloadIfChanged()
+					if err != nil && !os.IsNotExist(err) {
+						logger.Warn("HA: Failed to sync shared device store: %v", err)
+					}
+					if err := groupStore.Reload(); err != nil {
+						logger.Warn("HA: Failed to reload shared groups: %v", err)
+					}
+					if err := scheduleStore.Reload(); err != nil {
+						logger.Warn("HA: Failed to reload shared schedules: %v", err)
+					}
+				},
+			}, logger)
+			if err != nil {
+				wol_i18n.Printf("Error setting up high-availability mode: %v\n", err)
+				logger.Error("Failed to initialize HA coordinator: %v", err)
+				os.Exit(1)
+			}
+
+			deviceStore.SetLeader(coordinator.IsLeader)
+			coordinator.Start()
+			defer func() {
+				// Write out the last batched updates while still leader
+				if err := deviceStore.Flush(); err != nil {
+					logger.Warn("HA: %v", err)
+				}
+				coordinator.Stop()
+			}()
+			logger.Info("High-availability mode enabled as node %s", coordinator.NodeID())
+			haCoordinator = coordinator
+		}
+
+		serverConfig := wol_server.ServerConfig{
+			Port:         *serverPort,
+			Host:         *serverHost,
+			DeviceStore:  deviceStore,
+			Logger:       logger,
+			EnableCORS:   *enableCORS,
+			Auth:         authenticator,
+			Sessions:     sessions,
+			HA:           haCoordinator,
+			Plugins:      plugins,
+			Sites:        siteStore,
+			Groups:       groupStore,
+			Schedules:    scheduleStore,
+			Power:        powerWaker,
+			Monitor:      packetMonitor,
+			Backup:       &backupConfig,
+			StrictMAC:    *strictMAC,
+			Interface:    *iface,
+			Broadcast:    *broadcast,
+			Unicast:      *unicast,
+			IPv6:         *ipv6 || *ipv6Address != "",
+			IPv6Address:  *ipv6Address,
+			Raw:          *rawEthernet,
+			VLAN:         *vlan,
+			Packet:       packetConfig,
+			Retry:        retry,
+			ExtraPorts:   sendPorts,
+			SourceIP:     *sourceIP,
+			SourcePort:   *sourcePort,
+			Copies:       *copies,
+			CopyInterval: *copyInterval,
+			RateLimit: wol_server.RateLimitConfig{
+				API:  wol_server.RateLimit{Rate: *rateLimit, Burst: *rateBurst},
+				Wake: wol_server.RateLimit{Rate: *wakeRate, Burst: *wakeBurst},
+			},
+			MaxBodyBytes:    *maxBody,
+			ShutdownTimeout: *shutdownWait,
+			Metrics:         *metrics,
+			SwaggerUI:       *swaggerUI,
+			Events:          wol_events.NewBus(),
+			StatusCacheTTL:  *statusCache,
+			AccessLogFormat: *accessLog,
+		}
+
+		if *enableCORS {
+			serverConfig.CORS = wol_server.CORSConfig{
+				AllowedOrigins:   splitList(*corsOrigins),
+				AllowedMethods:   splitList(*corsMethods),
+				AllowedHeaders:   splitList(*corsHeaders),
+				AllowCredentials: *corsCreds,
+			}
+			if err := serverConfig.CORS.Validate(); err != nil {
+				wol_i18n.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		if *tlsCert != "" || *tlsKey != "" {
+			if *tlsCert == "" || *tlsKey == "" {
+				wol_i18n.Println("Error: -tls-cert and -tls-key must be given together")
+				os.Exit(1)
+			}
+			serverConfig.TLS = &wol_server.TLSConfig{
+				CertFile:     *tlsCert,
+				KeyFile:      *tlsKey,
+				ClientCAFile: *tlsClientCA,
+				RedirectPort: *tlsRedirect,
+			}
+		} else if *tlsRedirect != 0 || *tlsClientCA != "" {
+			wol_i18n.Println("Error: -tls-redirect-port and -tls-client-ca require -tls-cert and -tls-key")
+			os.Exit(1)
+		}
+
+		var mdnsConfig *wol_mdns.Config
+		if *mdns {
+			mdnsConfig = &wol_mdns.Config{
+				Instance: *mdnsName,
+				Port:     *serverPort,
+				TXT:      wol_server.DiscoveryTXT(serverConfig),
+			}
+		}
+
+		defer deviceStore.Close()
+
+		if *reloadEvery > 0 {
+			fileWatcher := wol_device.NewFileWatcher(deviceStore, deviceConfig.ConfigPath, *reloadEvery, logger)
+			fileWatcher.Start()
+			defer fileWatcher.Stop()
+		}
+
+		secret := *webhookSecret
+		if secret == "" {
+			secret = os.Getenv("WOL_WEBHOOK_SECRET")
+		}
+		if dispatcher, err := setupWebhooks(settings.Webhooks, splitList(*webhooks), secret, logger); err != nil {
+			wol_i18n.Printf("Error setting up webhooks: %v\n", err)
+			logger.Error("Failed to initialize webhooks: %v", err)
+			os.Exit(1)
+		} else if dispatcher != nil {
+			dispatcher.Start(serverConfig.Events)
+			defer dispatcher.Stop()
+		}
+
+		var statusConfig *wol_status.Config
+		if *statusEvery > 0 {
+			statusConfig = &wol_status.Config{Interval: *statusEvery, Events: serverConfig.Events}
+		}
+
+		runServer(serverConfig, dhcpConfig, proxyConfig, mdnsConfig, statusConfig)
+		return
+	}
+
+	args := flag.Args()
+	if len(args) < 1 {
+		wol_i18n.Println("Error: Command or MAC address is required")
+		fmt.Println()
+		showUsage()
+		os.Exit(1)
+	}
+
+	command := args[0]
+
+	if command == "init" {
+		runInitWizard(deviceStore, settings, logger)
+		return
+	}
+	switch command {
+	case "add-user", "remove-user", "list-users", "set-password", "set-role":
+		handleUsers(args, settings, logger)
+		return
+	}
+
+	packetOpts := packetConfig
+	if *secureOn != "" {
+		if packetOpts.Password, err = wol_packet.ParsePassword(*secureOn); err != nil {
+			wol_i18n.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	wakeOpts := wakeOptions{
+		given:         given,
+		port:          *port,
+		verify:        *verify,
+		verifyCapture: *verifyCapture,
+		verifyPing:    *verifyPing,
+		verifyARP:     *verifyARP,
+		verifyICMP:    *verifyICMP,
+		verifyAgent:   *verifyAgent,
+		verifyTimeout: *verifyTimeout,
+		packet:        packetOpts,
+		dumpPacket:    *verbose || strings.EqualFold(*logLevel, "debug"),
+		strictMAC:     *strictMAC,
+		raw:           *rawEthernet,
+		vlan:          *vlan,
+		iface:         *iface,
+		broadcast:     *broadcast,
+		unicast:       *unicast,
+		ipv6:          *ipv6 || *ipv6Address != "",
+		ipv6Address:   *ipv6Address,
+		retry:         retry,
+		extraPorts:    sendPorts,
+		sourceIP:      *sourceIP,
+		sourcePort:    *sourcePort,
+		wakeAddress:   *wakeAddress,
+		copies:        *copies,
+		copyInterval:  *copyInterval,
+		wait:          *waitOnline,
+		plugins:       plugins,
+		sites:         siteStore,
+		power:         powerWaker,
+	}
+
+	switch command {
+	case "add-device", "add":
+		handleAddDevice(args, deviceStore, templateStore, logger)
+	case "list-devices", "list", "ls":
+		handleListDevices(args, deviceStore, groupStore, logger)
+	case "remove-device", "remove", "rm":
+		handleRemoveDevice(args, deviceStore, groupStore, scheduleStore, logger)
+	case "archive-device", "archive":
+		handleArchiveDevice(args, deviceStore, logger)
+	case "unarchive-device", "unarchive":
+		handleUnarchiveDevice(args, deviceStore, logger)
+	case "show-device", "show":
+		handleShowDevice(args, deviceStore, logger)
+	case "clone-device", "clone":
+		handleCloneDevice(args, deviceStore, logger)
+	case "save-template":
+		handleSaveTemplate(args, deviceStore, templateStore, logger)
+	case "list-templates":
+		handleListTemplates(templateStore)
+	case "remove-template":
+		handleRemoveTemplate(args, templateStore, logger)
+	case "rename-device", "rename":
+		handleRenameDevice(args, deviceStore, groupStore, scheduleStore, logger)
+	case "import":
+		handleImportDevices(args, deviceStore, logger)
+	case "export":
+		handleExportDevices(args, deviceStore, logger)
+	case "import-arp":
+		handleImportARP(args, deviceStore, logger)
+	case "gen-store-key":
+		handleGenStoreKey(args, logger)
+	case "backup":
+		handleBackup(backupConfig, deviceStore, logger)
+	case "restore":
+		handleRestore(args, backupConfig, deviceStore, logger)
+	case "add-site":
+		handleAddSite(args, siteStore, logger)
+	case "list-sites":
+		handleListSites(siteStore)
+	case "remove-site":
+		handleRemoveSite(args, siteStore, logger)
+	case "set-site":
+		handleSetSite(args, deviceStore, siteStore, logger)
+	case "set-remote":
+		handleSetRemote(args, deviceStore, logger)
+	case "set-secureon":
+		handleSetSecureOn(args, deviceStore, logger)
+	case "set-broadcast":
+		handleSetBroadcast(args, deviceStore, logger)
+	case "set-broadcast-address":
+		handleSetBroadcastAddress(args, deviceStore, logger)
+	case "set-interface":
+		handleSetInterface(args, deviceStore, logger)
+	case "set-wake-address":
+		handleSetWakeAddress(args, deviceStore, logger)
+	case "set-vlan":
+		handleSetVLAN(args, deviceStore, logger)
+	case "set-meta":
+		handleSetMeta(args, deviceStore, logger)
+	case "set-tags":
+		handleSetTags(args, deviceStore, logger)
+	case "set-policy":
+		handleSetPolicy(args, deviceStore, logger)
+	case "set-power":
+		handleSetPower(args, deviceStore, logger)
+	case "power-status":
+		handlePowerStatus(args, deviceStore, powerWaker, logger)
+	case "wake":
+		if len(args) < 2 {
+			wol_i18n.Println("Error: Device name or MAC address required for wake command")
+			os.Exit(1)
+		}
+		handleWake(args[1], wakeOpts, deviceStore, logger)
+	case "verify-network", "net-info":
+		handleNetworkInfo(logger)
+	case "doctor":
+		handleDoctor(*iface, *port, logger)
+	case "discover":
+		handleDiscoverDevices(*iface, deviceStore, logger)
+	case "find-servers":
+		handleFindServers(logger)
+	case "lookup-mac":
+		if len(args) < 2 {
+			wol_i18n.Println("Usage: wol-server lookup-mac <ip-address>")
+			os.Exit(1)
+		}
+		handleLookupMAC(args[1], logger)
+	case "relay":
+		handleRelay(relayConfig, logger)
+	case "listen":
+		handleListen(monitorConfig, deviceStore, logger)
+	case "bench":
+		handleBench(args, *port, logger)
+	case "test-broadcast":
+		if len(args) < 2 {
+			wol_i18n.Println("Usage: wol-server test-broadcast <MAC-address>")
+			os.Exit(1)
+		}
+		handleTestBroadcast(args[1], *port, wakeOpts.packet, logger)
+	default:
+		// Assume it's a device name or MAC address for wake-up; device
+		// names may not be any of the commands above (wol_device.ReservedNames)
+		handleWake(command, wakeOpts, deviceStore, logger)
+	}
+}
+
+func handleNetworkInfo(logger *wol_log.Logger) {
+	wol_i18n.Println("Network Information")
+	wol_i18n.Println("==================")
+
+	netInfo, err := wol_network.VerifyNetworkConnectivity()
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		logger.Error("Network verification failed: %v", err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("Interface:    %s\n", netInfo.InterfaceName)
+	wol_i18n.Printf("Local IP:     %s\n", netInfo.LocalIP)
+	wol_i18n.Printf("Broadcast IP: %s\n", netInfo.BroadcastIP)
+	wol_i18n.Printf("MAC Address:  %s\n", netInfo.MACAddress)
+	wol_i18n.Printf("MTU:          %d\n", netInfo.MTU)
+	if netInfo.Gateway != "" {
+		wol_i18n.Printf("Gateway:      %s\n", netInfo.Gateway)
+	} else {
+		wol_i18n.Println("Gateway:      none (no default route through this interface)")
+	}
+	if len(netInfo.DNSServers) > 0 {
+		wol_i18n.Printf("DNS Servers:  %s\n", strings.Join(netInfo.DNSServers, ", "))
+	} else {
+		wol_i18n.Println("DNS Servers:  none configured")
+	}
+	fmt.Println()
+
+	wol_i18n.Println("Broadcast Interfaces")
+	if len(netInfo.BroadcastInterfaces) == 0 {
+		wol_i18n.Println("  none; wake packets can only be sent unicast")
+	}
+	for _, target := range netInfo.BroadcastInterfaces {
+		fmt.Printf("  %-12s %s\n", target.Interface, target.Address)
+	}
+	fmt.Println()
+
+	if interfaces, err := wol_network.ListInterfaces(); err != nil {
+		wol_i18n.Printf("⚠ Could not list interfaces: %v\n", err)
+	} else {
+		printInterfaces(interfaces)
+		fmt.Println()
+	}
+
+	wol_i18n.Println("✓ Network connectivity verified")
+	wol_i18n.Println("✓ UDP broadcast capability confirmed")
+
+	logger.Info("Network information displayed successfully")
+}
+
+// handleDoctor runs the network diagnostics and exits non-zero if any
+// check failed.
+func handleDoctor(iface string, port int, logger *wol_log.Logger) {
+	wol_i18n.Println("Network Diagnostics")
+	wol_i18n.Println("===================")
+
+	report := wol_network.RunDiagnosticsWith(wol_network.DiagnosticOptions{Interface: iface, Port: port})
+	for _, check := range report.Checks {
+		mark := "✓"
+		switch check.Status {
+		case wol_network.DiagnosticWarn:
+			mark = "⚠"
+		case wol_network.DiagnosticFail:
+			mark = "✗"
+		}
+		fmt.Printf("%s %-20s %s\n", mark, check.Name, check.Details)
+		if check.Hint != "" {
+			fmt.Printf("  %-20s %s\n", "", check.Hint)
+		}
+	}
+	fmt.Println()
+
+	if !report.Healthy {
+		wol_i18n.Println("✗ Wake packets may not be delivered; see the hints above")
+		logger.Error("Network diagnostics found problems")
+		os.Exit(1)
+	}
+	wol_i18n.Println("✓ This host can send wake packets")
+	logger.Info("Network diagnostics passed")
+}
+
+func printInterfaces(interfaces []wol_network.InterfaceInfo) {
+	wol_i18n.Println("Interfaces")
+	wol_i18n.Printf("%-12s %-17s %-5s %-28s %s\n", "Name", "MAC", "MTU", "Address", "Broadcast")
+	fmt.Println(strings.Repeat("-", 80))
+
+	for _, iface := range interfaces {
+		mac := iface.MAC
+		if mac == "" {
+			mac = "-"
+		}
+		if len(iface.Addresses) == 0 {
+			fmt.Printf("%-12s %-17s %-5d %-28s %s\n", iface.Name, mac, iface.MTU, "-", "-")
+			continue
+		}
+		for i, addr := range iface.Addresses {
+			broadcast := addr.Broadcast
+			if broadcast == "" {
+				broadcast = "-"
+			}
+			cidr := addr.IP + addr.Subnet[strings.LastIndex(addr.Subnet, "/"):]
+			if i == 0 {
+				fmt.Printf("%-12s %-17s %-5d %-28s %s\n", iface.Name, mac, iface.MTU, cidr, broadcast)
+			} else {
+				fmt.Printf("%-12s %-17s %-5s %-28s %s\n", "", "", "", cidr, broadcast)
+			}
+		}
+	}
+}
+
+func handleDiscoverDevices(iface string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	wol_i18n.Println("Scanning local subnets for devices, this takes a few seconds...")
+
+	candidates, err := wol_network.DiscoverDevicesWith(wol_network.DiscoverOptions{Interface: iface})
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		logger.Error("Device discovery failed: %v", err)
+		os.Exit(1)
+	}
+
+	if len(candidates) == 0 {
+		wol_i18n.Println("No devices found.")
+		return
+	}
+
+	wol_i18n.Printf("Found %d device(s):\n", len(candidates))
+	wol_i18n.Printf("%-15s %-17s %-24s %s\n", "IP", "MAC", "Hostname", "Device")
+	fmt.Println(strings.Repeat("=", 80))
+
+	var add []string
+	now := time.Now()
+	for _, candidate := range candidates {
+		name := "-"
+		if device, err := store.FindByMAC(candidate.MACAddress); err == nil {
+			name = device.Name
+			if err := store.MarkSeen(name, now); err != nil {
+				logger.Warn("Failed to update last seen time for %s: %v", name, err)
+			}
+		} else if candidate.Name != "" && !store.DeviceExists(candidate.Name) {
+			add = append(add, fmt.Sprintf("  wol-server add-device %s %s \"\" %s", candidate.Name, candidate.MACAddress, candidate.IPAddress))
+		}
+
+		hostname := candidate.Hostname
+		if hostname == "" {
+			hostname = "-"
+		}
+		fmt.Printf("%-15s %-17s %-24s %s\n", candidate.IPAddress, candidate.MACAddress, hostname, name)
+	}
+
+	fmt.Println()
+	if len(add) > 0 {
+		wol_i18n.Println("Add the new ones with:")
+		fmt.Println(strings.Join(add, "\n"))
+	} else {
+		wol_i18n.Println("Add one with: wol-server add-device <name> <mac> \"\" <ip>")
+	}
+	logger.Info("Device discovery found %d host(s)", len(candidates))
+}
+
+func handleFindServers(logger *wol_log.Logger) {
+	wol_i18n.Println("Searching for wol-server instances on the local network...")
+
+	services, err := wol_mdns.Browse(3 * time.Second)
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		logger.Error("mDNS discovery failed: %v", err)
+		os.Exit(1)
+	}
+
+	if len(services) == 0 {
+		wol_i18n.Println("No servers found.")
+		return
+	}
+
+	wol_i18n.Printf("Found %d server(s):\n", len(services))
+	fmt.Println(strings.Repeat("=", 80))
+
+	for _, service := range services {
+		wol_i18n.Printf("Name:        %s\n", service.Instance)
+		wol_i18n.Printf("URL:         %s\n", service.URL())
+		if version := service.TXT["version"]; version != "" {
+			wol_i18n.Printf("Version:     %s\n", version)
+		}
+		if features := service.TXT["features"]; features != "" {
+			wol_i18n.Printf("Features:    %s\n", features)
+		}
+		wol_i18n.Printf("Auth:        %s\n", service.TXT["auth"])
+		fmt.Println(strings.Repeat("-", 80))
+	}
+
+	logger.Info("mDNS discovery found %d server(s)", len(services))
+}
+
+func handleLookupMAC(ip string, logger *wol_log.Logger) {
+	mac, err := wol_network.ResolveMAC(ip, 2*time.Second)
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		logger.Error("MAC lookup for %s failed: %v", ip, err)
+		os.Exit(1)
+	}
+
+	fmt.Println(mac)
+}
+
+func parseMonitorConfig(ports string, raw bool, iface, record string) (wol_monitor.Config, error) {
+	config := wol_monitor.Config{Raw: raw, Interface: iface, RecordFile: record}
+
+	var err error
+	if config.Ports, err = parsePorts(ports); err != nil {
+		return config, fmt.Errorf("invalid monitor port: %w", err)
+	}
+
+	return config, nil
+}
+
+// parsePorts parses a comma-separated list of UDP ports.
+func parsePorts(list string) ([]int, error) {
+	var ports []int
+	for _, field := range strings.Split(list, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+
+		port, err := strconv.Atoi(field)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("%s is not a port number", field)
+		}
+		ports = append(ports, port)
+	}
+	return ports, nil
+}
+
+func handleListen(config wol_monitor.Config, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	monitor := wol_monitor.NewMonitor(config, store, logger)
+	if err := monitor.Start(); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		logger.Error("Failed to start packet monitor: %v", err)
+		os.Exit(1)
+	}
+	defer monitor.Stop()
+
+	packets, cancel := monitor.Subscribe()
+	defer cancel()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
+	wol_i18n.Println("Listening for magic packets, press Ctrl+C to stop...")
+	for {
+		select {
+		case packet := <-packets:
+			fmt.Printf("%s  %s\n", packet.Time.Format("2006-01-02 15:04:05"), packet)
+		case <-interrupt:
+			fmt.Println()
+			return
+		}
+	}
+}
+
+// handleRelay forwards magic packets between networks until interrupted.
+func handleRelay(config wol_relay.Config, logger *wol_log.Logger) {
+	relay := wol_relay.NewRelay(config, logger)
+	if err := relay.Start(); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		logger.Error("Failed to start relay: %v", err)
+		os.Exit(1)
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+
+	wol_i18n.Printf("Relaying magic packets from UDP port %d, press Ctrl+C to stop...\n", config.ListenPort)
+	<-interrupt
+	relay.Stop()
+
+	stats := relay.Stats()
+	fmt.Println()
+	wol_i18n.Printf("Relayed %d packet(s), dropped %d, failed %d\n", stats.Relayed, stats.Dropped, stats.Failed)
+}
+
+func handleBench(args []string, port int, logger *wol_log.Logger) {
+	modes := []string{wol_network.BenchBuild, wol_network.BenchUnicast, wol_network.BenchReuse, wol_network.BenchPool}
+	if len(args) > 1 && args[1] != "all" {
+		modes = []string{args[1]}
+	}
+
+	count := 10000
+	if len(args) > 2 {
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 1 {
+			wol_i18n.Printf("Error: invalid packet count '%s'\n", args[2])
+			os.Exit(1)
+		}
+		count = n
+	}
+
+	target := ""
+	if len(args) > 3 {
+		target = args[3]
+	}
+
+	wol_i18n.Printf("Benchmarking %d packets per mode (destination MAC %s)\n", count, wol_network.BenchMAC)
+	fmt.Println(strings.Repeat("=", 80))
+
+	for _, mode := range modes {
+		result, err := wol_network.Bench(wol_network.BenchConfig{Mode: mode, Count: count, Target: target, Port: port})
+		if err != nil {
+			wol_i18n.Printf("Error: %v\n", err)
+			logger.Error("Benchmark %s failed: %v", mode, err)
+			os.Exit(1)
+		}
+
+		fmt.Println(result)
+		logger.Debug("Benchmark: %s", result)
+	}
+}
+
+func handleTestBroadcast(mac string, port int, packet wol_packet.PacketOptions, logger *wol_log.Logger) {
+	wol_i18n.Printf("Testing broadcast to %s on port %d...\n", mac, port)
+	printPacketDump(mac, packet)
+
+	config := wol_network.VerificationConfig{
+		SendOptions:    wol_network.SendOptions{Port: port, Packet: packet},
+		EnableCapture:  true,
+		CaptureTimeout: 5 * time.Second,
+		EnablePing:     false,
+	}
+
+	result, err := wol_network.SendWakeOnLANWithVerification(mac, config)
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Println("\nVerification Results:")
+	wol_i18n.Println("====================")
+	wol_i18n.Printf("Packet Sent:      %v\n", result.PacketSent)
+	wol_i18n.Printf("Broadcast Sent:   %v\n", result.BroadcastSent)
+	wol_i18n.Printf("Packet Captured:  %v\n", result.PacketCaptured)
+	wol_i18n.Printf("Capture Details:  %s\n", result.CaptureDetails)
+	wol_i18n.Printf("Send Timing:      %s\n", result.Timing)
+
+	if result.NetworkInfo.LocalIP != "" {
+		wol_i18n.Printf("Local IP:         %s\n", result.NetworkInfo.LocalIP)
+		wol_i18n.Printf("Broadcast IP:     %s\n", result.NetworkInfo.BroadcastIP)
+		wol_i18n.Printf("Interface:        %s\n", result.NetworkInfo.InterfaceName)
+	}
+
+	if result.PacketSent && result.PacketCaptured {
+		wol_i18n.Println("\n✓ Wake-on-LAN packet successfully sent and verified on network")
+	} else if result.PacketSent {
+		wol_i18n.Println("\n⚠ Wake-on-LAN packet sent but not verified on network")
+		wol_i18n.Println("  This could be normal depending on network configuration")
+	} else {
+		wol_i18n.Println("\n✗ Failed to send Wake-on-LAN packet")
+	}
+}
+
+func printPorts(ports []wol_network.PortResult) {
+	for _, port := range ports {
+		if port.Sent && port.Copies > 1 {
+			fmt.Printf("✓ port %-5d sent %d copies\n", port.Port, port.Copies)
+		} else if port.Sent {
+			fmt.Printf("✓ port %-5d sent\n", port.Port)
+		} else {
+			fmt.Printf("✗ port %-5d %v\n", port.Port, port.Error)
+		}
+	}
+}
+
+func printChecks(checks []wol_network.VerifierResult) {
+	for _, check := range checks {
+		mark := "✗"
+		switch {
+		case check.Success:
+			mark = "✓"
+		case check.Skipped:
+			mark = "-"
+		}
+		fmt.Printf("%s %-8s %s (%v)\n", mark, check.Name, check.Details, check.Duration.Round(time.Millisecond))
+	}
+}
+
+// printPacketDump shows the magic packet that will be sent for mac.
+func printPacketDump(mac string, opts wol_packet.PacketOptions) {
+	packet, err := wol_packet.BuildMagicPacketOpts(mac, opts)
+	if err != nil {
+		return
+	}
+	fmt.Println(wol_packet.DumpPacket(packet))
+}
+
+// sendWake sends the magic packet over UDP, or as a raw Ethernet frame
+// with -raw.
+func sendWake(mac string, port int, opts wakeOptions) error {
+	sendOpts := opts.sendOptions(port)
+	sendOpts.UnicastIP = opts.unicastIP
+	return wol_network.SendWakeOnLANWith(mac, sendOpts)
+}
+
+// sendOptions are the UDP send settings of the wake options; the unicast
+// address is left to the caller.
+func (opts wakeOptions) sendOptions(port int) wol_network.SendOptions {
+	return wol_network.SendOptions{
+		Port:             port,
+		Packet:           opts.packet,
+		Interface:        opts.iface,
+		Broadcast:        opts.broadcast,
+		IPv6:             opts.ipv6,
+		IPv6Address:      opts.ipv6Address,
+		Retry:            opts.retry,
+		ExtraPorts:       opts.extraPorts,
+		SourceIP:         opts.sourceIP,
+		SourcePort:       opts.sourcePort,
+		WakeAddress:      opts.wakeAddress,
+		Copies:           opts.copies,
+		CopyInterval:     opts.copyInterval,
+		BroadcastAddress: opts.broadcastAddress,
+		Raw:              opts.raw,
+		VLAN:             opts.vlan,
+	}
+}
+
+type wakeOptions struct {
+	// given holds the flags set on the command line, which override a
+	// device's wake policy
+	given         map[string]bool
+	port          int
+	verify        bool
+	verifyCapture bool
+	verifyPing    bool
+	verifyARP     bool
+	verifyICMP    bool
+	verifyAgent   string
+	verifyTimeout time.Duration
+	packet        wol_packet.PacketOptions
+	dumpPacket    bool
+	strictMAC     bool
+	raw           bool
+	vlan          int
+	iface         string
+	broadcast     string
+	unicast       bool
+	unicastIP     string
+	ipv6          bool
+	ipv6Address   string
+	retry         wol_network.RetryConfig
+	extraPorts    []int
+	sourceIP      string
+	sourcePort    int
+	wakeAddress   string
+	// broadcastAddress comes from the device being woken
+	broadcastAddress string
+	copies           int
+	copyInterval     time.Duration
+	wait             time.Duration
+	plugins          *wol_plugin.Manager
+	sites            *wol_federation.SiteStore
+	power            *wol_power.Waker
+}
+
+// applyPolicy uses the device's wake policy for each setting whose flag was
+// not given.
+func (opts *wakeOptions) applyPolicy(policy *wol_device.WakePolicy) {
+	if policy == nil {
+		return
+	}
+	if policy.Retries > 0 && !opts.given["retries"] {
+		opts.retry.Count = policy.Retries
+	}
+	if len(policy.ExtraPorts) > 0 && !opts.given["extra-ports"] && !opts.given["all-ports"] {
+		opts.extraPorts = policy.ExtraPorts
+	}
+	if policy.Copies > 0 && !opts.given["copies"] {
+		opts.copies = policy.Copies
+	}
+	if policy.VerifyPing != nil && !opts.given["verify-ping"] {
+		opts.verifyPing = *policy.VerifyPing
+	}
+	if policy.WaitTimeout > 0 && !opts.given["wait"] {
+		opts.wait = time.Duration(policy.WaitTimeout)
+	}
+}
+
+func handleRemoteWake(device *wol_device.Device, site *wol_federation.Site, port int, store *wol_device.DeviceStore, opts wakeOptions, logger *wol_log.Logger) {
+	wol_i18n.Printf("Forwarding wake for %s (%s) to site '%s' (%s)...\n", device.Name, device.MACAddress, site.Name, site.URL)
+	logger.Info("Forwarding wake for %s to site %s", device.Name, site.Name)
+
+	result, err := wol_federation.NewClient(15*time.Second).ForwardWake(site, device.MACAddress, port)
+	notifyWake(opts.plugins, device.Name, device.MACAddress, err)
+	if err != nil {
+		wol_i18n.Printf("Error: Remote wake failed: %v\n", err)
+		logger.Error("Remote wake of %s via site %s failed: %v", device.Name, site.Name, err)
+		os.Exit(1)
+	}
+
+	if err := store.UpdateLastWoken(device.Name); err != nil {
+		logger.Warn("Failed to update last woken time for %s: %v", device.Name, err)
+	}
+
+	wol_i18n.Printf("✓ Site '%s' woke %s (%s, took %s)\n", site.Name, device.Name, result.Message, result.Duration)
+}
+
+func handlePowerWake(device *wol_device.Device, port int, store *wol_device.DeviceStore, opts wakeOptions, logger *wol_log.Logger) {
+	send := func() error {
+		wol_i18n.Printf("Sending Wake-on-LAN packet to %s (%s) on port %d...\n", device.Name, device.MACAddress, port)
+		if device.Transport != "" {
+			return opts.plugins.WakeDevice(device, port)
+		}
+		if opts.dumpPacket {
+			printPacketDump(device.MACAddress, opts.packet)
+		}
+		return sendWake(device.MACAddress, port, opts)
+	}
+
+	if device.Power.Mode != wol_power.ModeOnly {
+		wol_i18n.Printf("Waiting for %s to power on; falling back to %s if it does not...\n", device.Name, device.Power.Provider)
+	}
+
+	sentAt := time.Now()
+	result, err := opts.power.Wake(device, send)
+	if err != nil {
+		notifyWake(opts.plugins, device.Name, device.MACAddress, err)
+		wol_i18n.Printf("Error: Failed to power on %s: %v\n", device.Name, err)
+		logger.Error("Failed to power on %s: %v", device.Name, err)
+		os.Exit(1)
+	}
+	notifyWake(opts.plugins, device.Name, device.MACAddress, nil, "method", result.Method, "boot_duration_ms", time.Since(sentAt).Milliseconds())
+
+	if err := store.UpdateLastWoken(device.Name); err != nil {
+		logger.Warn("Failed to update last woken time for %s: %v", device.Name, err)
+	}
+
+	if result.Method != wol_power.MethodWoL {
+		wol_i18n.Printf("✓ %s powered on through %s\n", device.Name, device.Power.Provider)
+	} else {
+		wol_i18n.Printf("✓ %s powered on from Wake-on-LAN\n", device.Name)
+	}
+}
+
+func handleWake(target string, opts wakeOptions, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	var macAddress string
+	var deviceName string
+	var deviceIP string
+	var transport *wol_device.Device
+
+	port := opts.port
+
+	// A MAC or IP address of a configured device wakes it as if by name,
+	// so its settings apply and its wake time is recorded
+	if !store.DeviceExists(target) {
+		if device, err := store.FindByMAC(target); err == nil && !device.Archived {
+			target = device.Name
+		} else if device, err := store.FindByIP(target); err == nil && !device.Archived {
+			target = device.Name
+		}
+	}
+
+	// Check if target is a device name
+	if store.DeviceExists(target) {
+		device, err := store.GetDevice(target)
+		if err != nil {
+			wol_i18n.Printf("Error: Failed to get device %s: %v\n", target, err)
+			os.Exit(1)
+		}
+		if device.Archived {
+			wol_i18n.Printf("Error: Device '%s' is archived; restore it with 'wol-server unarchive %s'\n", target, target)
+			os.Exit(1)
+		}
+
+		macAddress = device.MACAddress
+		deviceName = device.Name
+		deviceIP = device.IPAddress
+
+		// Use device's configured port if not overridden
+		if port == wol_network.DefaultWoLPort && device.Port != wol_network.DefaultWoLPort {
+			port = device.Port
+		}
+
+		if device.Transport != "" {
+			transport = device
+		}
+		if device.Broadcast != "" {
+			opts.broadcast = device.Broadcast
+		}
+		opts.broadcastAddress = device.BroadcastAddress
+		if opts.iface == "" {
+			opts.iface = device.Interface
+		}
+		if opts.wakeAddress == "" {
+			opts.wakeAddress = device.WakeAddress
+		}
+		if opts.vlan == 0 {
+			opts.vlan = device.VLAN
+		}
+		if opts.unicast {
+			opts.unicastIP = device.IPAddress
+		}
+		opts.applyPolicy(device.Policy)
+		if opts.packet.Password == nil {
+			if opts.packet.Password, err = device.SecureOnPassword(); err != nil {
+				wol_i18n.Printf("Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
+		site, remote, err := opts.sites.SiteForDevice(device)
+		if err != nil {
+			wol_i18n.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		if remote {
+			handleRemoteWake(device, site, port, store, opts, logger)
+			return
+		}
+
+		if device.Power != nil {
+			handlePowerWake(device, port, store, opts, logger)
+			return
+		}
+
+		logger.Info("Waking device by name: %s (MAC: %s)", deviceName, macAddress)
+	} else {
+		// Assume it's a MAC address
+		validate := wol_packet.ValidateMAC
+		if opts.strictMAC {
+			validate = wol_packet.ValidateMACStrict
+		}
+		if err := validate(target); err != nil {
+			wol_i18n.Printf("Error: '%s' is not a valid device name or MAC address\n", target)
+			wol_i18n.Printf("MAC validation error: %v\n", err)
+			wol_i18n.Println("Use 'wol-server list-devices' to see available devices.")
+			logger.Error("Invalid target %s: %v", target, err)
+			os.Exit(1)
+		}
+
+		macAddress = target
+		deviceName = "Unknown Device"
+		logger.Info("Waking device by MAC: %s", macAddress)
+	}
+
+	verify := opts.verify || opts.verifyCapture || opts.verifyPing || opts.verifyARP || opts.verifyICMP || opts.verifyAgent != ""
+
+	if opts.wait > 0 && deviceIP == "" {
+		wol_i18n.Println("Error: -wait needs the device's IP address; add the device with an IP to wait for it")
+		os.Exit(1)
+	}
+
+	// Send the Wake-on-LAN packet with or without verification
+	wol_i18n.Printf("Sending Wake-on-LAN packet to %s (%s) on port %d...\n", deviceName, macAddress, port)
+	if opts.dumpPacket && transport == nil {
+		printPacketDump(macAddress, opts.packet)
+	}
+
+	if transport != nil {
+		wol_i18n.Printf("Using wake transport '%s'\n", transport.Transport)
+		err := opts.plugins.WakeDevice(transport, port)
+		notifyWake(opts.plugins, deviceName, macAddress, err)
+		if err != nil {
+			wol_i18n.Printf("Error: Failed to wake via transport '%s': %v\n", transport.Transport, err)
+			os.Exit(1)
+		}
+	} else if verify {
+		config := wol_network.VerificationConfig{
+			SendOptions:      opts.sendOptions(port),
+			EnableCapture:    opts.verifyCapture,
+			CaptureTimeout:   3 * time.Second,
+			EnablePing:       opts.verifyPing,
+			EnableARP:        opts.verifyARP,
+			EnableICMP:       opts.verifyICMP,
+			AgentURL:         opts.verifyAgent,
+			CheckTimeout:     opts.verifyTimeout,
+			TargetIP:         deviceIP,
+			CaptureInterface: opts.iface,
+			Unicast:          opts.unicast,
+		}
+
+		sentAt := time.Now()
+		result, err := wol_network.SendWakeOnLANWithVerification(macAddress, config)
+		if err == nil && result.TargetReachable {
+			notifyWake(opts.plugins, deviceName, macAddress, nil, "boot_duration_ms", time.Since(sentAt).Milliseconds())
+		} else {
+			notifyWake(opts.plugins, deviceName, macAddress, err)
+		}
+		if err != nil {
+			wol_i18n.Printf("Error: Failed to send Wake-on-LAN packet: %v\n", err)
+			os.Exit(1)
+		}
+
+		if len(result.Ports) > 1 || opts.copies > 1 {
+			printPorts(result.Ports)
+		}
+		printChecks(result.Checks)
+
+	} else {
+		err := sendWake(macAddress, port, opts)
+		notifyWake(opts.plugins, deviceName, macAddress, err)
+		if err != nil {
+			wol_i18n.Printf("Error: Failed to send Wake-on-LAN packet: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// Update last woken time if it's a known device
+	if store.DeviceExists(target) {
+		err := store.UpdateLastWoken(target)
+		if err != nil {
+			logger.Warn("Failed to update last woken time for %s: %v", target, err)
+		}
+	}
+
+	wol_i18n.Printf("✓ Wake-on-LAN packet sent successfully to %s\n", deviceName)
+	logger.Info("Wake-on-LAN completed successfully for %s", deviceName)
+
+	if opts.wait > 0 {
+		waitForDevice(deviceName, macAddress, deviceIP, port, opts.wait, logger)
+		if store.DeviceExists(target) {
+			if err := store.UpdateStatus(target, true, time.Now()); err != nil {
+				logger.Warn("Failed to update status for %s: %v", target, err)
+			}
+		}
+	}
+}
+
+// waitForDevice polls a woken device until it responds, printing progress,
+// and exits non-zero if it does not come online within timeout.
+func waitForDevice(name, mac, ip string, port int, timeout time.Duration, logger *wol_log.Logger) {
+	wol_i18n.Printf("Waiting up to %v for %s (%s) to come online...\n", timeout, name, ip)
+
+	result, err := wol_network.WaitForOnline(mac, ip, timeout, wol_network.WaitOptions{
+		Send: wol_network.SendOptions{Port: port},
+		Progress: func(p wol_network.WaitProgress) {
+			if !p.Online {
+				wol_i18n.Printf("  %3ds  %s\n", int(p.Elapsed.Seconds()), p.Details)
+			}
+		},
+	})
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !result.Online {
+		wol_i18n.Printf("✗ %s did not come online within %v\n", name, timeout)
+		logger.Warn("%s did not come online within %v", name, timeout)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ %s is online after %v (%s)\n", name, result.Elapsed.Round(time.Second), result.Details)
+	logger.Info("%s came online after %v (%s check)", name, result.Elapsed, result.Check)
+}
+
+// notifyWake reports a wake attempt to plugins and metric emitters.
+// details is an optional list of key/value pairs.
+func notifyWake(plugins *wol_plugin.Manager, deviceName, mac string, err error, details ...interface{}) {
+	event := wol_plugin.Event{
+		Type:    wol_plugin.EventWake,
+		Device:  deviceName,
+		MAC:     mac,
+		Success: err == nil,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	if len(details) > 0 {
+		event.Details = make(map[string]interface{})
+		for i := 0; i+1 < len(details); i += 2 {
+			event.Details[fmt.Sprint(details[i])] = details[i+1]
+		}
+	}
+
+	plugins.Notify(event)
+}
+
+func runServer(config wol_server.ServerConfig, dhcpConfig *wol_dhcp.WatcherConfig, proxyConfig *wol_proxy.Config, mdnsConfig *wol_mdns.Config, statusConfig *wol_status.Config) {
+	logger := config.Logger
+	deviceStore := config.DeviceStore
+
+	wol_network.SetLogger(logger)
+
+	server := wol_server.NewWoLServer(config)
+
+	if proxyConfig != nil {
+		wake := func(device *wol_device.Device) error {
+			return server.WakeDevices([]string{device.Name})
+		}
+
+		proxy := wol_proxy.NewProxy(*proxyConfig, deviceStore, wake, logger)
+		if err := proxy.Start(); err != nil {
+			wol_i18n.Printf("Error starting wake-on-demand proxy: %v\n", err)
+			logger.Error("Failed to start wake-on-demand proxy: %v", err)
+			os.Exit(1)
+		}
+		defer proxy.Stop()
+	}
+
+	if dhcpConfig != nil {
+		watcher, err := wol_dhcp.NewWatcher(*dhcpConfig, deviceStore, logger)
+		if err != nil {
+			wol_i18n.Printf("Error setting up DHCP lease watcher: %v\n", err)
+			logger.Error("Failed to initialize DHCP lease watcher: %v", err)
+			os.Exit(1)
+		}
+
+		watcher.Start()
+		defer watcher.Stop()
+		logger.Info("DHCP lease watcher started (interval %v)", dhcpConfig.PollInterval)
+	}
+
+	if statusConfig != nil {
+		checker := wol_status.NewChecker(*statusConfig, deviceStore, logger)
+		checker.Start()
+		defer checker.Stop()
+		logger.Info("Device status checks started (interval %v)", statusConfig.Interval)
+	}
+
+	if config.Schedules != nil {
+		wake := func(schedule *wol_schedule.Schedule) error {
+			return wakeScheduled(schedule, config, server)
+		}
+		var leader func() bool
+		if config.HA != nil {
+			leader = config.HA.IsLeader
+		}
+
+		scheduler := wol_schedule.NewScheduler(config.Schedules, wake, leader, logger)
+		scheduler.Start()
+		defer scheduler.Stop()
+		logger.Info("Wake scheduler started with %d schedule(s)", len(config.Schedules.ListSchedules()))
+	}
+
+	if mdnsConfig != nil {
+		// Discovery is a convenience; the server runs fine without it
+		responder, err := wol_mdns.NewResponder(*mdnsConfig, logger)
+		if err == nil {
+			err = responder.Start()
+		}
+		if err != nil {
+			logger.Warn("mDNS advertisement disabled: %v", err)
+		} else {
+			defer responder.Stop()
+		}
+	}
+
+	logger.Info("WoL Server starting in HTTP server mode on %s:%d", config.Host, config.Port)
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.Start()
+	}()
+
+	select {
+	case err := <-errs:
+		if err != nil && err != http.ErrServerClosed {
+			logger.Error("Server failed: %v", err)
+			os.Exit(1)
+		}
+	case sig := <-interrupt:
+		// Stop writes out the device store changes requests left pending;
+		// the deferred stops here and in main then run in turn
+		logger.Info("Received %v, shutting down (waiting up to %v for requests in flight)", sig, config.ShutdownTimeout)
+		if err := server.Stop(); err != nil {
+			logger.Warn("Shutdown: %v", err)
+		}
+		<-errs
+	}
+}
+
+// wakeScheduled wakes the device or every member of the group a schedule
+// names, the same way the API does.
+func wakeScheduled(schedule *wol_schedule.Schedule, config wol_server.ServerConfig, server *wol_server.WoLServer) error {
+	names := []string{schedule.Device}
+	if schedule.Group != "" {
+		if config.Groups == nil {
+			return fmt.Errorf("device groups are not enabled")
+		}
+		group, err := config.Groups.GetGroup(schedule.Group)
+		if err != nil {
+			return err
+		}
+		names = group.Members
+	}
+	if len(names) == 0 {
+		return fmt.Errorf("group '%s' has no members", schedule.Group)
+	}
+	return server.WakeDevices(names)
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// setupWebhooks combines the webhooks in the settings file with those
+// given by -webhook. It returns nil when there are none.
+func setupWebhooks(configured []*wol_config.Webhook, urls []string, secret string, logger *wol_log.Logger) (*wol_webhook.Dispatcher, error) {
+	var hooks []wol_webhook.Config
+	for _, hook := range configured {
+		hooks = append(hooks, wol_webhook.Config{URL: hook.URL, Secret: hook.Secret, Events: hook.Events})
+	}
+	for _, hookURL := range urls {
+		hooks = append(hooks, wol_webhook.Config{URL: hookURL, Secret: secret})
+	}
+	if len(hooks) == 0 {
+		return nil, nil
+	}
+
+	dispatcher, err := wol_webhook.NewDispatcher(hooks, logger)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Posting wake and device status events to %d webhook(s)", len(hooks))
+	return dispatcher, nil
+}
+
+type authOptions struct {
+	oidcIssuer    string
+	oidcClientID  string
+	oidcGroups    string
+	ldapURL       string
+	ldapStartTLS  bool
+	ldapBindDN    string
+	ldapBindPass  string
+	ldapBaseDN    string
+	ldapUserAttr  string
+	ldapGroupAttr string
+	roles         string
+	defaultRole   string
+	apiKey        string
+	users         map[string]*wol_config.User
+	clientCerts   bool
+}
+
+func setupAuth(opts authOptions) (*wol_auth.Authenticator, error) {
+	authenticator := wol_auth.NewAuthenticator()
+
+	if opts.apiKey != "" {
+		provider, err := wol_auth.NewAPIKeyProvider(opts.apiKey)
+		if err != nil {
+			return nil, err
+		}
+		authenticator.AddProvider(provider)
+	}
+
+	// Before LDAP, which would reject the local users it does not know
+	if len(opts.users) > 0 {
+		users := make(map[string]wol_auth.User, len(opts.users))
+		for username, user := range opts.users {
+			role, err := wol_auth.ParseRole(user.Role)
+			if err != nil {
+				return nil, fmt.Errorf("user %s: %w", username, err)
+			}
+			users[username] = wol_auth.User{PasswordHash: user.PasswordHash, Role: role}
+		}
+		provider, err := wol_auth.NewBasicProvider(users)
+		if err != nil {
+			return nil, err
+		}
+		authenticator.AddProvider(provider)
+	}
+
+	if opts.oidcIssuer == "" && opts.ldapURL == "" && !opts.clientCerts {
+		return authenticator, nil
+	}
+
+	mapping, err := wol_auth.ParseRoleMapping(opts.roles, opts.defaultRole)
+	if err != nil {
+		return nil, err
+	}
+
+	if opts.oidcIssuer != "" {
+		provider, err := wol_auth.NewOIDCProvider(wol_auth.OIDCConfig{
+			IssuerURL:   opts.oidcIssuer,
+			ClientID:    opts.oidcClientID,
+			GroupsClaim: opts.oidcGroups,
+			Mapping:     mapping,
+		})
+		if err != nil {
+			return nil, err
+		}
+		authenticator.AddProvider(provider)
+	}
+
+	if opts.ldapURL != "" {
+		provider, err := wol_auth.NewLDAPProvider(wol_auth.LDAPConfig{
+			URL:            opts.ldapURL,
+			BindDN:         opts.ldapBindDN,
+			BindPassword:   opts.ldapBindPass,
+			BaseDN:         opts.ldapBaseDN,
+			UserAttribute:  opts.ldapUserAttr,
+			GroupAttribute: opts.ldapGroupAttr,
+			Mapping:        mapping,
+			StartTLS:       opts.ldapStartTLS,
+		})
+		if err != nil {
+			return nil, err
+		}
+		authenticator.AddProvider(provider)
+	}
+
+	// Last, so credentials sent as well pick the role. The TLS handshake
+	// has already refused clients without a certificate, so without
+	// -auth-roles or -auth-default-role every holder is an admin.
+	if opts.clientCerts {
+		certMapping := mapping
+		if certMapping.DefaultRole == "" && len(certMapping.Groups) == 0 {
+			certMapping.DefaultRole = wol_auth.RoleAdmin
+		}
+		authenticator.AddProvider(wol_auth.NewClientCertProvider(certMapping))
+	}
+
+	return authenticator, nil
+}
+
+// handleUsers manages the local user accounts in the settings file.
+// Passwords are read from stdin.
+func handleUsers(args []string, settings *wol_config.Config, logger *wol_log.Logger) {
+	userFlags := flag.NewFlagSet(args[0], flag.ExitOnError)
+	roleName := userFlags.String("role", string(wol_auth.RoleViewer), "Role for the new user: viewer, operator or admin")
+	userFlags.Parse(args[1:])
+	args = append([]string{args[0]}, userFlags.Args()...)
+
+	if args[0] == "list-users" {
+		if len(settings.Users) == 0 {
+			wol_i18n.Println("No users configured")
+			return
+		}
+		for _, username := range slices.Sorted(maps.Keys(settings.Users)) {
+			wol_i18n.Printf("  %-20s %s\n", username, settings.Users[username].Role)
+		}
+		return
+	}
+
+	usage := map[string]string{
+		"add-user":     "add-user [-role viewer|operator|admin] <username>",
+		"remove-user":  "remove-user <username>",
+		"set-password": "set-password <username>",
+		"set-role":     "set-role <username> <viewer|operator|admin>",
+	}
+	if len(args) < 2 || (args[0] == "set-role" && len(args) < 3) {
+		wol_i18n.Printf("Usage: wol-server %s\n", usage[args[0]])
+		os.Exit(1)
+	}
+	username := args[1]
+
+	user, exists := settings.Users[username]
+	switch {
+	case args[0] == "add-user" && exists:
+		wol_i18n.Printf("Error: user '%s' already exists\n", username)
+		os.Exit(1)
+	case args[0] != "add-user" && !exists:
+		wol_i18n.Printf("Error: user '%s' not found\n", username)
+		os.Exit(1)
+	}
+
+	var message string
+	switch args[0] {
+	case "add-user", "set-password":
+		if err := wol_auth.ValidateUsername(username); err != nil {
+			wol_i18n.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		role, err := wol_auth.ParseRole(*roleName)
+		if err != nil {
+			wol_i18n.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		in := bufio.NewReader(os.Stdin)
+		password := prompt(in, "Password", "")
+		if password == "" || prompt(in, "Repeat password", "") != password {
+			wol_i18n.Println("Error: passwords are empty or do not match")
+			os.Exit(1)
+		}
+		hash, err := wol_auth.HashPassword(password)
+		if err != nil {
+			wol_i18n.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if args[0] == "add-user" {
+			if settings.Users == nil {
+				settings.Users = make(map[string]*wol_config.User)
+			}
+			settings.Users[username] = &wol_config.User{PasswordHash: hash, Role: string(role)}
+			message = fmt.Sprintf("User '%s' added as %s", username, role)
+		} else {
+			user.PasswordHash = hash
+			message = fmt.Sprintf("Password changed for user '%s'", username)
+		}
+	case "set-role":
+		role, err := wol_auth.ParseRole(args[2])
+		if err != nil {
+			wol_i18n.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		user.Role = string(role)
+		message = fmt.Sprintf("User '%s' is now %s", username, role)
+	case "remove-user":
+		delete(settings.Users, username)
+		message = fmt.Sprintf("User '%s' removed", username)
+	}
+
+	if err := settings.Save(); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ %s; restart the server to apply\n", message)
+	logger.Info("%s in %s", message, settings.Path())
+}
+
+func handleAddDevice(args []string, store *wol_device.DeviceStore, templates *wol_device.TemplateStore, logger *wol_log.Logger) {
+	addFlags := flag.NewFlagSet("add-device", flag.ExitOnError)
+	templateName := addFlags.String("template", "", "Take the port, tags and wake policy from this template")
+	addFlags.Parse(args[1:])
+	args = append([]string{args[0]}, addFlags.Args()...)
+
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server add-device [-template name] <name> <mac-address> [description] [ip-address|hostname] [port]")
+		wol_i18n.Println("Example: wol-server add-device desktop AA:BB:CC:DD:EE:FF \"My desktop computer\" 192.168.1.100 9")
+		os.Exit(1)
+	}
+
+	name := args[1]
+	macAddress := args[2]
+	description := ""
+	ipAddress := ""
+	port := 0
+
+	if len(args) > 3 {
+		description = args[3]
+	}
+
+	if len(args) > 4 {
+		ipAddress = args[4]
+	}
+
+	if len(args) > 5 {
+		fmt.Sscanf(args[5], "%d", &port)
+	}
+
+	logger.Info("Adding device: name=%s, mac=%s", name, macAddress)
+
+	var err error
+	if *templateName != "" {
+		var template *wol_device.Template
+		template, err = templates.GetTemplate(*templateName)
+		if err == nil {
+			spec := template.Apply(wol_device.DeviceSpec{Name: name, MACAddress: macAddress, Description: description, IPAddress: ipAddress, Port: port})
+			var result *wol_device.BulkResult
+			if result, err = store.AddDevices([]wol_device.DeviceSpec{spec}, wol_device.AllOrNothing); err != nil && result != nil && len(result.Failed) > 0 {
+				err = fmt.Errorf("%s", result.Failed[0].Error)
+			}
+		}
+	} else {
+		err = store.AddDevice(name, macAddress, description, ipAddress, port)
+	}
+	if err != nil {
+		wol_i18n.Printf("Error: Failed to add device: %v\n", err)
+		logger.Error("Failed to add device %s: %v", name, err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ Device '%s' added successfully\n", name)
+	logger.Info("Device %s added successfully", name)
+}
+
+// openGroupStore opens the groups next to the device file, or on the Redis
+// server of a redis device store.
+func openGroupStore(config wol_device.DeviceConfig) (*wol_device.GroupStore, error) {
+	if config.Backend != wol_device.BackendRedis {
+		return wol_device.NewGroupStore(wol_device.DefaultGroupsPath(config.ConfigPath))
+	}
+	shared, err := wol_device.OpenRedisFile(config.URL, wol_device.RedisGroupsKey)
+	if err != nil {
+		return nil, err
+	}
+	return wol_device.NewSharedGroupStore(shared)
+}
+
+// openScheduleStore is openGroupStore for the schedules.
+func openScheduleStore(config wol_device.DeviceConfig) (*wol_schedule.Store, error) {
+	if config.Backend != wol_device.BackendRedis {
+		return wol_schedule.NewStore(wol_schedule.DefaultSchedulesPath(config.ConfigPath))
+	}
+	shared, err := wol_device.OpenRedisFile(config.URL, wol_device.RedisSchedulesKey)
+	if err != nil {
+		return nil, err
+	}
+	return wol_schedule.NewSharedStore(shared)
+}
+
+func handleListDevices(args []string, store *wol_device.DeviceStore, groups *wol_device.GroupStore, logger *wol_log.Logger) {
+	listFlags := flag.NewFlagSet("list", flag.ExitOnError)
+	tag := listFlags.String("tag", "", "Only list devices with these comma-separated tags")
+	query := listFlags.String("filter", "", "Only list devices matching a search such as \"nas tag:office status:online mac:AA:BB group:lab\"")
+	sortBy := listFlags.String("sort", wol_device.SortByName, "Sort by name, added, last-woken or last-seen")
+	descending := listFlags.Bool("desc", false, "Sort in descending order")
+	offset := listFlags.Int("offset", 0, "Skip this many devices")
+	limit := listFlags.Int("limit", 0, "List at most this many devices (0 for all)")
+	archived := listFlags.Bool("archived", false, "List archived devices instead")
+	listFlags.Parse(args[1:])
+
+	filter, err := wol_device.ParseFilter(*query)
+	if err != nil {
+		wol_i18n.Printf("Error: invalid -filter: %v\n", err)
+		os.Exit(1)
+	}
+	if err := filter.ResolveGroup(groups); err != nil {
+		wol_i18n.Printf("Error: invalid -filter: %v\n", err)
+		os.Exit(1)
+	}
+	tags := wol_device.NormalizeTags(strings.Split(*tag, ","))
+	filter.Tags = wol_device.NormalizeTags(append(filter.Tags, tags...))
+	if *archived {
+		filter.Archive = wol_device.OnlyArchived
+	}
+	devices, total, err := store.ListDevicesWith(wol_device.ListOptions{
+		Filter:     filter,
+		SortBy:     *sortBy,
+		Descending: *descending,
+		Offset:     *offset,
+		Limit:      *limit,
+	})
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if len(devices) == 0 && total > 0 {
+		wol_i18n.Printf("No devices past offset %d (%d matched).\n", *offset, total)
+		return
+	}
+	if len(devices) == 0 && *query != "" {
+		wol_i18n.Printf("No devices match %q.\n", *query)
+		return
+	}
+	if len(devices) == 0 && len(tags) > 0 {
+		wol_i18n.Printf("No devices tagged %s.\n", strings.Join(tags, ", "))
+		return
+	}
+	if len(devices) == 0 && *archived {
+		wol_i18n.Println("No archived devices.")
+		return
+	}
+	if len(devices) == 0 {
+		wol_i18n.Println("No devices configured.")
+		wol_i18n.Println("Use 'wol-server add-device <name> <mac>' to add a device.")
+		return
+	}
+
+	if len(devices) < total {
+		wol_i18n.Printf("Configured Devices (%d-%d of %d):\n", *offset+1, *offset+len(devices), total)
+	} else {
+		wol_i18n.Printf("Configured Devices (%d):\n", len(devices))
+	}
+	fmt.Println(strings.Repeat("=", 80))
+
+	for _, device := range devices {
+		wol_i18n.Printf("Name:        %s\n", device.Name)
+		wol_i18n.Printf("MAC:         %s\n", device.MACAddress)
+
+		if device.Description != "" {
+			wol_i18n.Printf("Description: %s\n", device.Description)
+		}
+
+		if device.IPAddress != "" {
+			wol_i18n.Printf("IP Address:  %s\n", device.IPAddress)
+		}
+
+		if len(device.Tags) > 0 {
+			wol_i18n.Printf("Tags:        %s\n", strings.Join(device.Tags, ", "))
+		}
+
+		if len(device.Metadata) > 0 {
+			wol_i18n.Printf("Metadata:    %s\n", formatMetadata(device.Metadata))
+		}
+
+		if device.Site != "" {
+			wol_i18n.Printf("Site:        %s\n", device.Site)
+		}
+
+		if device.Remote != "" {
+			wol_i18n.Printf("Remote:      %s\n", device.Remote)
+		}
+
+		wol_i18n.Printf("Port:        %d\n", device.Port)
+		wol_i18n.Printf("Status:      %s\n", device.Status)
+		wol_i18n.Printf("Added:       %s\n", device.AddedAt.Format("2006-01-02 15:04:05"))
+
+		if !device.LastWoken.IsZero() {
+			wol_i18n.Printf("Last Woken:  %s\n", device.LastWoken.Format("2006-01-02 15:04:05"))
+		}
+
+		if !device.LastSeen.IsZero() {
+			wol_i18n.Printf("Last Seen:   %s\n", device.LastSeen.Format("2006-01-02 15:04:05"))
+		}
+
+		fmt.Println(strings.Repeat("-", 80))
+	}
+
+	logger.Debug("Listed %d devices", len(devices))
+}
+
+func handleRemoveDevice(args []string, store *wol_device.DeviceStore, groups *wol_device.GroupStore, schedules *wol_schedule.Store, logger *wol_log.Logger) {
+	if len(args) < 2 {
+		wol_i18n.Println("Usage: wol-server remove-device <name>")
+		wol_i18n.Println("Example: wol-server remove-device desktop")
+		os.Exit(1)
+	}
+
+	name := args[1]
+
+	if !store.DeviceExists(name) {
+		wol_i18n.Printf("Error: Device '%s' not found\n", name)
+		wol_i18n.Println("Use 'wol-server list-devices' to see available devices.")
+		os.Exit(1)
+	}
+
+	logger.Info("Removing device: %s", name)
+
+	err := store.RemoveDevice(name)
+	if err != nil {
+		wol_i18n.Printf("Error: Failed to remove device: %v\n", err)
+		logger.Error("Failed to remove device %s: %v", name, err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ Device '%s' removed successfully\n", name)
+	logger.Info("Device %s removed successfully", name)
+
+	if err := groups.RenameMember(name, ""); err != nil {
+		wol_i18n.Printf("⚠ Could not remove '%s' from groups: %v\n", name, err)
+		logger.Warn("Failed to remove %s from groups: %v", name, err)
+	}
+	removed, err := schedules.RemoveDevice(name)
+	if err != nil {
+		wol_i18n.Printf("⚠ Could not remove the schedules of '%s': %v\n", name, err)
+		logger.Warn("Failed to remove the schedules of %s: %v", name, err)
+	}
+	for _, schedule := range removed {
+		wol_i18n.Printf("✓ Schedule '%s' removed with it\n", schedule)
+	}
+}
+
+func handleArchiveDevice(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 2 {
+		wol_i18n.Println("Usage: wol-server archive-device <name>")
+		wol_i18n.Println("Example: wol-server archive-device garden-pi")
+		os.Exit(1)
+	}
+
+	if err := store.SetArchived(args[1], true); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ Device '%s' archived; restore it with 'wol-server unarchive %s'\n", args[1], args[1])
+	logger.Info("Device %s archived", args[1])
+}
+
+func handleUnarchiveDevice(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 2 {
+		wol_i18n.Println("Usage: wol-server unarchive <name>")
+		wol_i18n.Println("Example: wol-server unarchive garden-pi")
+		os.Exit(1)
+	}
+
+	if err := store.SetArchived(args[1], false); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ Device '%s' restored\n", args[1])
+	logger.Info("Device %s unarchived", args[1])
+}
+
+func handleShowDevice(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 2 {
+		wol_i18n.Println("Usage: wol-server show-device <name>")
+		wol_i18n.Println("Example: wol-server show-device desktop")
+		os.Exit(1)
+	}
+
+	name := args[1]
+
+	device, err := store.GetDevice(name)
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		wol_i18n.Println("Use 'wol-server list-devices' to see available devices.")
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("Device Details: %s\n", device.Name)
+	fmt.Println(strings.Repeat("=", 40))
+	wol_i18n.Printf("Name:        %s\n", device.Name)
+	wol_i18n.Printf("MAC Address: %s\n", device.MACAddress)
+
+	if device.Archived {
+		wol_i18n.Println("Archived:    yes")
+	}
+
+	if device.Description != "" {
+		wol_i18n.Printf("Description: %s\n", device.Description)
+	}
+
+	if device.IPAddress != "" {
+		wol_i18n.Printf("IP Address:  %s\n", device.IPAddress)
+	}
+
+	if len(device.Tags) > 0 {
+		wol_i18n.Printf("Tags:        %s\n", strings.Join(device.Tags, ", "))
+	}
+
+	if len(device.Metadata) > 0 {
+		wol_i18n.Printf("Metadata:    %s\n", formatMetadata(device.Metadata))
+	}
+
+	if device.Site != "" {
+		wol_i18n.Printf("Site:        %s\n", device.Site)
+	}
+
+	if device.Remote != "" {
+		wol_i18n.Printf("Remote:      %s\n", device.Remote)
+	}
+
+	if device.Power != nil {
+		wol_i18n.Printf("Power:       %s at %s (%s)\n", device.Power.Provider, device.Power.Address, device.Power.Mode)
+	}
+
+	if device.Broadcast != "" {
+		wol_i18n.Printf("Broadcast:   %s\n", device.Broadcast)
+	}
+
+	if device.BroadcastAddress != "" {
+		wol_i18n.Printf("Broadcast to: %s\n", device.BroadcastAddress)
+	}
+
+	if device.Interface != "" {
+		wol_i18n.Printf("Interface:   %s\n", device.Interface)
+	}
+
+	if device.WakeAddress != "" {
+		wol_i18n.Printf("Wake to:     %s\n", device.WakeAddress)
+	}
+
+	if device.VLAN != 0 {
+		wol_i18n.Printf("VLAN:        %d\n", device.VLAN)
+	}
+
+	if device.SecureOn != "" {
+		wol_i18n.Printf("SecureOn:    %s\n", wol_server.SecretMask)
+	}
+
+	if device.Policy != nil {
+		wol_i18n.Printf("Policy:      %s\n", formatPolicy(device.Policy))
+	}
+
+	wol_i18n.Printf("Port:        %d\n", device.Port)
+	wol_i18n.Printf("Added:       %s\n", device.AddedAt.Format("2006-01-02 15:04:05"))
+
+	if !device.LastWoken.IsZero() {
+		wol_i18n.Printf("Last Woken:  %s\n", device.LastWoken.Format("2006-01-02 15:04:05"))
+		wol_i18n.Printf("Time Since:  %s\n", time.Since(device.LastWoken).Round(time.Second))
+	} else {
+		wol_i18n.Println("Last Woken:  Never")
+	}
+
+	wol_i18n.Printf("Status:      %s\n", device.Status)
+	if !device.LastSeen.IsZero() {
+		wol_i18n.Printf("Last Seen:   %s\n", device.LastSeen.Format("2006-01-02 15:04:05"))
+	} else {
+		wol_i18n.Println("Last Seen:   Never")
+	}
+
+	logger.Debug("Showed device details for %s", name)
+}
+
+func handleRenameDevice(args []string, store *wol_device.DeviceStore, groups *wol_device.GroupStore, schedules *wol_schedule.Store, logger *wol_log.Logger) {
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server rename-device <name> <new-name>")
+		os.Exit(1)
+	}
+
+	if err := store.RenameDevice(args[1], args[2]); err != nil {
+		wol_i18n.Printf("Error: Failed to rename device: %v\n", err)
+		logger.Error("Failed to rename device %s: %v", args[1], err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ Device '%s' renamed to '%s'\n", args[1], args[2])
+	logger.Info("Device %s renamed to %s", args[1], args[2])
+
+	if err := groups.RenameMember(args[1], args[2]); err != nil {
+		wol_i18n.Printf("⚠ Could not rename '%s' in groups: %v\n", args[1], err)
+		logger.Warn("Failed to rename %s in groups: %v", args[1], err)
+	}
+	if err := schedules.RenameDevice(args[1], args[2]); err != nil {
+		wol_i18n.Printf("⚠ Could not rename '%s' in schedules: %v\n", args[1], err)
+		logger.Warn("Failed to rename %s in schedules: %v", args[1], err)
+	}
+}
+
+func handleImportDevices(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 2 {
+		wol_i18n.Println("Usage: wol-server import <file.csv|->")
+		wol_i18n.Printf("Columns: %s (name and mac_address required, in any order)\n", strings.Join(wol_device.CSVColumns, ","))
+		os.Exit(1)
+	}
+
+	input := os.Stdin
+	if args[1] != "-" {
+		file, err := os.Open(args[1])
+		if err != nil {
+			wol_i18n.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		input = file
+	}
+
+	result, err := store.ImportCSV(input)
+	if err != nil {
+		wol_i18n.Printf("Error: Failed to import devices: %v\n", err)
+		logger.Error("Failed to import devices from %s: %v", args[1], err)
+		os.Exit(1)
+	}
+
+	for _, skip := range result.Skipped {
+		wol_i18n.Printf("Skipped line %d (%s): %s\n", skip.Line, skip.Name, skip.Reason)
+	}
+	wol_i18n.Printf("✓ Imported %d devices, skipped %d\n", len(result.Added), len(result.Skipped))
+	logger.Info("Imported %d devices from %s", len(result.Added), args[1])
+}
+
+// handleImportARP offers every host in the neighbor table that is not yet a
+// device, named after its reverse DNS name or its IP address.
+func handleImportARP(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	importFlags := flag.NewFlagSet("import-arp", flag.ExitOnError)
+	yes := importFlags.Bool("yes", false, "Add every new host without asking")
+	iface := importFlags.String("iface", "", "Only import hosts seen on this interface")
+	importFlags.Parse(args[1:])
+
+	neighbors, err := wol_network.ReadNeighbors()
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	found := wol_network.NewNeighbors(neighbors, *iface, func(mac string) bool {
+		_, err := store.FindByMAC(mac)
+		return err == nil
+	})
+
+	if len(found) == 0 {
+		wol_i18n.Println("No new devices in the ARP table.")
+		return
+	}
+
+	in := bufio.NewReader(os.Stdin)
+	if !*yes {
+		wol_i18n.Printf("Found %d new device(s). Press Enter to add one under the suggested name, type another name, or - to skip.\n", len(found))
+	}
+
+	var specs []wol_device.DeviceSpec
+	taken := make(map[string]bool)
+	for _, neighbor := range found {
+		name := wol_network.NeighborDeviceName(neighbor, net.LookupAddr, func(name string) bool {
+			return store.DeviceExists(name) || taken[name]
+		})
+		if !*yes {
+			name = prompt(in, fmt.Sprintf("  %-15s %s", neighbor.IPAddress, neighbor.MACAddress), name)
+			if name == "-" {
+				continue
+			}
+		}
+		taken[name] = true
+
+		specs = append(specs, wol_device.DeviceSpec{
+			Name:       name,
+			MACAddress: neighbor.MACAddress,
+			IPAddress:  neighbor.IPAddress,
+			Port:       wol_network.DefaultWoLPort,
+		})
+	}
+
+	result, err := store.AddDevices(specs, wol_device.BestEffort)
+	if result == nil {
+		wol_i18n.Printf("Error: Failed to add devices: %v\n", err)
+		os.Exit(1)
+	}
+	for _, failed := range result.Failed {
+		wol_i18n.Printf("  ✗ %s: %s\n", failed.Name, failed.Error)
+	}
+	for _, name := range result.Added {
+		wol_i18n.Printf("  ✓ Added %s\n", name)
+		logger.Info("Added device %s from the ARP table", name)
+	}
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ Imported %d of %d devices\n", len(result.Added), len(found))
+}
+
+func handleGenStoreKey(args []string, logger *wol_log.Logger) {
+	if len(args) < 2 {
+		wol_i18n.Println("Usage: wol-server gen-store-key <file>")
+		wol_i18n.Println("Example: wol-server gen-store-key /etc/wol-server/store.key")
+		os.Exit(1)
+	}
+
+	if err := wol_device.GenerateStoreKey(args[1]); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ Store key written to %s\n", args[1])
+	wol_i18n.Printf("Encrypt the device file with: wol-server -store-key-file %s list-devices\n", args[1])
+	logger.Info("Generated store key %s", args[1])
+}
+
+func handleBackup(config wol_backup.Config, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	path, manifest, err := wol_backup.Create(config, store)
+	if err != nil && path == "" {
+		wol_i18n.Printf("Error: %v\n", err)
+		logger.Error("Backup failed: %v", err)
+		os.Exit(1)
+	}
+	if err != nil {
+		logger.Warn("Backup written, but old backups were not removed: %v", err)
+	}
+
+	wol_i18n.Printf("✓ Backed up %d devices to %s\n", manifest.Devices, path)
+	if len(manifest.Files) > 0 {
+		wol_i18n.Printf("  Also included: %s\n", strings.Join(manifest.Files, ", "))
+	}
+	logger.Info("Backed up %d devices to %s", manifest.Devices, path)
+}
+
+func handleRestore(args []string, config wol_backup.Config, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	restoreFlags := flag.NewFlagSet("restore", flag.ExitOnError)
+	yes := restoreFlags.Bool("yes", false, "Replace the current devices without asking")
+	restoreFlags.Parse(args[1:])
+
+	path := restoreFlags.Arg(0)
+	if path == "" {
+		wol_i18n.Println("Usage: wol-server restore [-yes] <backup.tar.gz>")
+		if backups, _ := wol_backup.List(config.Dir); len(backups) > 0 {
+			wol_i18n.Printf("Latest backup: %s\n", backups[len(backups)-1])
+		}
+		os.Exit(1)
+	}
+
+	manifest, err := wol_backup.Inspect(path)
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("Backup from %s with %d devices\n", manifest.CreatedAt.Local().Format("2006-01-02 15:04:05"), manifest.Devices)
+	if manifest.Encrypted && config.Key == nil {
+		wol_i18n.Println("Error: the backup is encrypted; give its store key with -store-key-file or WOL_STORE_PASSPHRASE")
+		os.Exit(1)
+	}
+	if count := store.GetDeviceCount(); count > 0 && !*yes {
+		question := wol_i18n.T("This replaces the %d configured devices. Continue?", count)
+		if !confirm(bufio.NewReader(os.Stdin), question, false) {
+			wol_i18n.Println("Restore cancelled.")
+			return
+		}
+	}
+
+	if _, err := wol_backup.Restore(path, config, store); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		logger.Error("Restore from %s failed: %v", path, err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ Restored %d devices from %s\n", manifest.Devices, path)
+	if len(manifest.Files) > 0 {
+		wol_i18n.Printf("  Also restored: %s\n", strings.Join(manifest.Files, ", "))
+	}
+	logger.Info("Restored %d devices from %s", manifest.Devices, path)
+}
+
+func handleExportDevices(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	exportFlags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := exportFlags.String("format", "csv", "Output format: csv, or homeassistant for Home Assistant wake_on_lan switches")
+	exportFlags.Parse(args[1:])
+
+	export := store.ExportCSV
+	switch *format {
+	case "csv":
+	case "homeassistant", "ha":
+		export = store.ExportHomeAssistant
+	default:
+		wol_i18n.Printf("Error: unknown export format '%s' (valid: csv, homeassistant)\n", *format)
+		os.Exit(1)
+	}
+
+	path := exportFlags.Arg(0)
+	output := os.Stdout
+	if path != "" && path != "-" {
+		file, err := os.Create(path)
+		if err != nil {
+			wol_i18n.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer file.Close()
+		output = file
+	}
+
+	if err := export(output); err != nil {
+		wol_i18n.Printf("Error: Failed to export devices: %v\n", err)
+		os.Exit(1)
+	}
+
+	if output != os.Stdout {
+		wol_i18n.Printf("✓ Exported %d devices to %s\n", len(store.ListDevices()), path)
+	}
+	logger.Debug("Exported devices as %s", *format)
+}
+
+func handleAddSite(args []string, sites *wol_federation.SiteStore, logger *wol_log.Logger) {
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server add-site <name> <url> [api-key] [subnets]")
+		wol_i18n.Println("Example: wol-server add-site office https://wol.office.example:8080 s3cret 10.1.0.0/16,10.2.0.0/16")
+		os.Exit(1)
+	}
+
+	apiKey := ""
+	if len(args) > 3 {
+		apiKey = args[3]
+	}
+
+	var subnets []string
+	if len(args) > 4 {
+		subnets = strings.Split(args[4], ",")
+	}
+
+	if err := sites.AddSite(args[1], args[2], apiKey, subnets); err != nil {
+		wol_i18n.Printf("Error: Failed to add site: %v\n", err)
+		logger.Error("Failed to add site %s: %v", args[1], err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ Site '%s' added successfully\n", args[1])
+	logger.Info("Site %s added successfully", args[1])
+}
+
+func handleCloneDevice(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 4 {
+		wol_i18n.Println("Usage: wol-server clone-device <source> <new-name> <new-mac> [ip-address|hostname]")
+		wol_i18n.Println("Example: wol-server clone-device rack-01 rack-02 AA:BB:CC:DD:EE:02 10.0.0.12")
+		os.Exit(1)
+	}
+
+	ipAddress := ""
+	if len(args) > 4 {
+		ipAddress = args[4]
+	}
+
+	if err := store.CloneDevice(args[1], args[2], args[3], ipAddress); err != nil {
+		wol_i18n.Printf("Error: Failed to clone device: %v\n", err)
+		logger.Error("Failed to clone device %s as %s: %v", args[1], args[2], err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ Device '%s' added as a copy of '%s'\n", args[2], args[1])
+	logger.Info("Device %s cloned from %s", args[2], args[1])
+}
+
+func handleSaveTemplate(args []string, store *wol_device.DeviceStore, templates *wol_device.TemplateStore, logger *wol_log.Logger) {
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server save-template <template> <device>")
+		wol_i18n.Println("Saves the device's port, tags and wake policy for 'add-device -template <template>'.")
+		os.Exit(1)
+	}
+
+	device, err := store.GetDevice(args[2])
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := templates.SaveTemplate(wol_device.TemplateFromDevice(args[1], device)); err != nil {
+		wol_i18n.Printf("Error: Failed to save template: %v\n", err)
+		logger.Error("Failed to save template %s: %v", args[1], err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ Template '%s' saved from device '%s'\n", args[1], args[2])
+	logger.Info("Template %s saved from device %s", args[1], args[2])
+}
+
+func handleListTemplates(templates *wol_device.TemplateStore) {
+	list := templates.ListTemplates()
+	if len(list) == 0 {
+		wol_i18n.Println("No templates configured.")
+		wol_i18n.Println("Use 'wol-server save-template <name> <device>' to make one from a device.")
+		return
+	}
+
+	wol_i18n.Printf("Templates (%d):\n", len(list))
+	fmt.Println(strings.Repeat("=", 80))
+
+	for _, template := range list {
+		wol_i18n.Printf("Name:        %s\n", template.Name)
+		if template.Port != 0 {
+			wol_i18n.Printf("Port:        %d\n", template.Port)
+		}
+		if len(template.Tags) > 0 {
+			wol_i18n.Printf("Tags:        %s\n", strings.Join(template.Tags, ", "))
+		}
+		if template.Policy != nil {
+			wol_i18n.Printf("Policy:      %s\n", formatPolicy(template.Policy))
+		}
+		fmt.Println(strings.Repeat("-", 80))
+	}
+}
+
+func handleRemoveTemplate(args []string, templates *wol_device.TemplateStore, logger *wol_log.Logger) {
+	if len(args) < 2 {
+		wol_i18n.Println("Usage: wol-server remove-template <name>")
+		os.Exit(1)
+	}
+
+	if err := templates.RemoveTemplate(args[1]); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ Template '%s' removed\n", args[1])
+	logger.Info("Template %s removed", args[1])
+}
+
+func handleListSites(sites *wol_federation.SiteStore) {
+	list := sites.ListSites()
+	if len(list) == 0 {
+		wol_i18n.Println("No sites configured.")
+		wol_i18n.Println("Use 'wol-server add-site <name> <url>' to add a remote wol-server.")
+		return
+	}
+
+	wol_i18n.Printf("Configured Sites (%d):\n", len(list))
+	fmt.Println(strings.Repeat("=", 80))
+
+	for _, site := range list {
+		wol_i18n.Printf("Name:        %s\n", site.Name)
+		wol_i18n.Printf("URL:         %s\n", site.URL)
+		if len(site.Subnets) > 0 {
+			wol_i18n.Printf("Subnets:     %s\n", strings.Join(site.Subnets, ", "))
+		}
+		if site.APIKey != "" {
+			wol_i18n.Println("API Key:     ********")
+		}
+		fmt.Println(strings.Repeat("-", 80))
+	}
+}
+
+func handleRemoveSite(args []string, sites *wol_federation.SiteStore, logger *wol_log.Logger) {
+	if len(args) < 2 {
+		wol_i18n.Println("Usage: wol-server remove-site <name>")
+		os.Exit(1)
+	}
+
+	if err := sites.RemoveSite(args[1]); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ Site '%s' removed successfully\n", args[1])
+	logger.Info("Site %s removed successfully", args[1])
+}
+
+func handleSetSite(args []string, store *wol_device.DeviceStore, sites *wol_federation.SiteStore, logger *wol_log.Logger) {
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server set-site <device> <site>")
+		wol_i18n.Println("       wol-server set-site <device> local")
 		os.Exit(1)
 	}
 
-	if *serverMode {
-		runServer(deviceStore, logger, *serverHost, *serverPort, *enableCORS)
-		return
+	site := args[2]
+	if site == "local" {
+		site = ""
+	} else if _, err := sites.GetSite(site); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	args := flag.Args()
-	if len(args) < 1 {
-		fmt.Println("Error: Command or MAC address is required")
-		fmt.Println()
-		showUsage()
+	if err := store.SetDeviceSite(args[1], site); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	command := args[0]
-
-	switch command {
-	case "add-device", "add":
-		handleAddDevice(args, deviceStore, logger)
-	case "list-devices", "list", "ls":
-		handleListDevices(deviceStore, logger)
-	case "remove-device", "remove", "rm":
-		handleRemoveDevice(args, deviceStore, logger)
-	case "show-device", "show":
-		handleShowDevice(args, deviceStore, logger)
-	case "wake":
-		if len(args) < 2 {
-			fmt.Println("Error: Device name or MAC address required for wake command")
-			os.Exit(1)
-		}
-		handleWake(args[1], *port, deviceStore, logger, *verify, *verifyCapture, *verifyPing)
-	case "verify-network", "net-info":
-		handleNetworkInfo(logger)
-	case "test-broadcast":
-		if len(args) < 2 {
-			fmt.Println("Usage: wol-server test-broadcast <MAC-address>")
-			os.Exit(1)
-		}
-		handleTestBroadcast(args[1], *port, logger)
-	default:
-		// Assume it's a device name or MAC address for wake-up
-		handleWake(command, *port, deviceStore, logger, *verify, *verifyCapture, *verifyPing)
+	if site == "" {
+		wol_i18n.Printf("✓ Device '%s' will be woken locally\n", args[1])
+	} else {
+		wol_i18n.Printf("✓ Device '%s' is now homed to site '%s'\n", args[1], site)
 	}
+	logger.Info("Device %s site set to %q", args[1], site)
 }
 
-func handleNetworkInfo(logger *wol_log.Logger) {
-	fmt.Println("Network Information")
-	fmt.Println("==================")
-
-	netInfo, err := wol_network.VerifyNetworkConnectivity()
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		logger.Error("Network verification failed: %v", err)
+func handleSetRemote(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server set-remote <device> <url> [api-key]")
+		wol_i18n.Println("       wol-server set-remote <device> none")
 		os.Exit(1)
 	}
 
-	fmt.Printf("Interface:    %s\n", netInfo.InterfaceName)
-	fmt.Printf("Local IP:     %s\n", netInfo.LocalIP)
-	fmt.Printf("Broadcast IP: %s\n", netInfo.BroadcastIP)
-	fmt.Printf("MAC Address:  %s\n", netInfo.MACAddress)
-	fmt.Println()
-	fmt.Println("✓ Network connectivity verified")
-	fmt.Println("✓ UDP broadcast capability confirmed")
-
-	logger.Info("Network information displayed successfully")
-}
+	remote := args[2]
+	if remote == "none" {
+		remote = ""
+	}
+	apiKey := ""
+	if len(args) > 3 {
+		apiKey = args[3]
+	}
 
-func handleTestBroadcast(mac string, port int, logger *wol_log.Logger) {
-	fmt.Printf("Testing broadcast to %s on port %d...\n", mac, port)
+	if err := store.SetDeviceRemote(args[1], remote, apiKey); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	config := wol_network.VerificationConfig{
-		EnableCapture:  true,
-		CaptureTimeout: 5 * time.Second,
-		EnablePing:     false,
+	if remote == "" {
+		wol_i18n.Printf("✓ Device '%s' will be woken locally\n", args[1])
+	} else {
+		wol_i18n.Printf("✓ Device '%s' will be woken by the wol-server at %s\n", args[1], remote)
 	}
+	logger.Info("Device %s remote set to %q", args[1], remote)
+}
 
-	result, err := wol_network.SendWakeOnLANWithVerification(mac, port, config)
-	if err != nil {
-		fmt.Printf("Error: %v\n", err)
+func handleSetSecureOn(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server set-secureon <device> <password|none>")
+		wol_i18n.Println("The password is 6 bytes like a MAC address or 4 bytes like an IPv4 address.")
 		os.Exit(1)
 	}
 
-	fmt.Println("\nVerification Results:")
-	fmt.Println("====================")
-	fmt.Printf("Packet Sent:      %v\n", result.PacketSent)
-	fmt.Printf("Broadcast Sent:   %v\n", result.BroadcastSent)
-	fmt.Printf("Packet Captured:  %v\n", result.PacketCaptured)
-	fmt.Printf("Capture Details:  %s\n", result.CaptureDetails)
+	password := args[2]
+	if password == "none" {
+		password = ""
+	}
 
-	if result.NetworkInfo.LocalIP != "" {
-		fmt.Printf("Local IP:         %s\n", result.NetworkInfo.LocalIP)
-		fmt.Printf("Broadcast IP:     %s\n", result.NetworkInfo.BroadcastIP)
-		fmt.Printf("Interface:        %s\n", result.NetworkInfo.InterfaceName)
+	if err := store.SetDeviceSecureOn(args[1], password); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	if result.PacketSent && result.PacketCaptured {
-		fmt.Println("\n✓ Wake-on-LAN packet successfully sent and verified on network")
-	} else if result.PacketSent {
-		fmt.Println("\n⚠ Wake-on-LAN packet sent but not verified on network")
-		fmt.Println("  This could be normal depending on network configuration")
+	if password == "" {
+		wol_i18n.Printf("✓ SecureOn password removed from device '%s'\n", args[1])
 	} else {
-		fmt.Println("\n✗ Failed to send Wake-on-LAN packet")
+		wol_i18n.Printf("✓ SecureOn password set for device '%s'\n", args[1])
 	}
+	logger.Info("Device %s SecureOn password updated", args[1])
 }
 
-func handleWake(target string, port int, store *wol_device.DeviceStore, logger *wol_log.Logger, verify, verifyCapture, verifyPing bool) {
-	var macAddress string
-	var deviceName string
+func handleSetBroadcast(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server set-broadcast <device> <limited|directed|all|default>")
+		os.Exit(1)
+	}
 
-	// Check if target is a device name
-	if store.DeviceExists(target) {
-		device, err := store.GetDevice(target)
-		if err != nil {
-			fmt.Printf("Error: Failed to get device %s: %v\n", target, err)
+	mode := ""
+	if args[2] != "default" {
+		var err error
+		if mode, err = wol_network.ParseBroadcastMode(args[2]); err != nil {
+			wol_i18n.Printf("Error: %v\n", err)
 			os.Exit(1)
 		}
+	}
 
-		macAddress = device.MACAddress
-		deviceName = device.Name
-
-		// Use device's configured port if not overridden
-		if port == wol_network.DefaultWoLPort && device.Port != wol_network.DefaultWoLPort {
-			port = device.Port
-		}
+	if err := store.SetDeviceBroadcast(args[1], mode); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
-		logger.Info("Waking device by name: %s (MAC: %s)", deviceName, macAddress)
+	if mode == "" {
+		wol_i18n.Printf("✓ Device '%s' uses the global broadcast setting\n", args[1])
 	} else {
-		// Assume it's a MAC address
-		if err := wol_packet.ValidateMAC(target); err != nil {
-			fmt.Printf("Error: '%s' is not a valid device name or MAC address\n", target)
-			fmt.Printf("MAC validation error: %v\n", err)
-			fmt.Println("Use 'wol-server list-devices' to see available devices.")
-			logger.Error("Invalid target %s: %v", target, err)
-			os.Exit(1)
-		}
-
-		macAddress = target
-		deviceName = "Unknown Device"
-		logger.Info("Waking device by MAC: %s", macAddress)
+		wol_i18n.Printf("✓ Device '%s' now uses %s broadcast\n", args[1], mode)
 	}
+	logger.Info("Device %s broadcast set to %q", args[1], mode)
+}
 
-	// Send the Wake-on-LAN packet with or without verification
-	fmt.Printf("Sending Wake-on-LAN packet to %s (%s) on port %d...\n", deviceName, macAddress, port)
-
-	if verify || verifyCapture || verifyPing {
-		config := wol_network.VerificationConfig{
-			EnableCapture:  verifyCapture,
-			CaptureTimeout: 3 * time.Second,
-			EnablePing:     verifyPing,
-			PingTimeout:    2 * time.Second,
-		}
+func handleSetBroadcastAddress(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server set-broadcast-address <device> <ip|none>")
+		wol_i18n.Println("Example: wol-server set-broadcast-address camera 192.168.20.255")
+		os.Exit(1)
+	}
 
-		result, err := wol_network.SendWakeOnLANWithVerification(macAddress, port, config)
-		if err != nil {
-			fmt.Printf("Error: Failed to send Wake-on-LAN packet: %v\n", err)
+	address := ""
+	if args[2] != "none" {
+		var err error
+		if address, err = wol_network.ParseBroadcastAddress(args[2]); err != nil {
+			wol_i18n.Printf("Error: %v\n", err)
 			os.Exit(1)
 		}
+	}
 
-		// Show verification results
-		if verifyCapture {
-			if result.PacketCaptured {
-				fmt.Println("✓ Packet verified on network")
-			} else {
-				fmt.Println("⚠ Packet not detected on network")
-			}
-		}
-
-		if verifyPing && result.TargetReachable {
-			fmt.Println("✓ Target appears reachable")
-		}
+	if err := store.SetDeviceBroadcastAddress(args[1], address); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
+	if address == "" {
+		wol_i18n.Printf("✓ Device '%s' uses the broadcast address of its broadcast mode\n", args[1])
 	} else {
-		err := wol_network.SendWakeOnLAN(macAddress, port)
-		if err != nil {
-			fmt.Printf("Error: Failed to send Wake-on-LAN packet: %v\n", err)
-			os.Exit(1)
-		}
+		wol_i18n.Printf("✓ Device '%s' will be woken by broadcasting to %s\n", args[1], address)
 	}
+	logger.Info("Device %s broadcast address set to %q", args[1], address)
+}
 
-	// Update last woken time if it's a known device
-	if store.DeviceExists(target) {
-		err := store.UpdateLastWoken(target)
-		if err != nil {
-			logger.Warn("Failed to update last woken time for %s: %v", target, err)
-		}
+func handleSetInterface(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server set-interface <device> <interface|none>")
+		wol_i18n.Println("Example: wol-server set-interface camera eth0.20")
+		os.Exit(1)
 	}
 
-	fmt.Printf("✓ Wake-on-LAN packet sent successfully to %s\n", deviceName)
-	logger.Info("Wake-on-LAN completed successfully for %s", deviceName)
-}
+	iface := args[2]
+	if iface == "none" {
+		iface = ""
+	} else if _, err := net.InterfaceByName(iface); err != nil {
+		wol_i18n.Printf("Error: unknown interface %s: %v\n", iface, err)
+		os.Exit(1)
+	}
 
-func runServer(deviceStore *wol_device.DeviceStore, logger *wol_log.Logger, host string, port int, cors bool) {
-	wol_network.SetLogger(logger)
+	if err := store.SetDeviceInterface(args[1], iface); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	config := wol_server.ServerConfig{
-		Port:        port,
-		Host:        host,
-		DeviceStore: deviceStore,
-		Logger:      logger,
-		EnableCORS:  cors,
+	if iface == "" {
+		wol_i18n.Printf("✓ Device '%s' is woken from the default interface\n", args[1])
+	} else {
+		wol_i18n.Printf("✓ Device '%s' will be woken from %s\n", args[1], iface)
 	}
+	logger.Info("Device %s interface set to %q", args[1], iface)
+}
 
-	server := wol_server.NewWoLServer(config)
+func handleSetWakeAddress(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server set-wake-address <device> <host[:port]|none>")
+		wol_i18n.Println("Example: wol-server set-wake-address nas home.example.com:9")
+		os.Exit(1)
+	}
 
-	logger.Info("WoL Server starting in HTTP server mode on %s:%d", host, port)
+	address := args[2]
+	if address == "none" {
+		address = ""
+	} else if _, _, err := wol_network.ParseWakeAddress(address); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	err := server.Start()
-	if err != nil && err != http.ErrServerClosed {
-		logger.Error("Server failed: %v", err)
+	if err := store.SetDeviceWakeAddress(args[1], address); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
+
+	if address == "" {
+		wol_i18n.Printf("✓ Device '%s' is woken by broadcast again\n", args[1])
+	} else {
+		wol_i18n.Printf("✓ Device '%s' will be woken by sending to %s\n", args[1], address)
+	}
+	logger.Info("Device %s wake address set to %q", args[1], address)
 }
 
-func handleAddDevice(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+func handleSetVLAN(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
 	if len(args) < 3 {
-		fmt.Println("Usage: wol-server add-device <name> <mac-address> [description] [ip-address] [port]")
-		fmt.Println("Example: wol-server add-device desktop AA:BB:CC:DD:EE:FF \"My desktop computer\" 192.168.1.100 9")
+		wol_i18n.Println("Usage: wol-server set-vlan <device> <vlan-id|none>")
+		wol_i18n.Println("The tag is added to raw Ethernet frames, sent with -raw.")
 		os.Exit(1)
 	}
 
-	name := args[1]
-	macAddress := args[2]
-	description := ""
-	ipAddress := ""
-	port := 0
+	vlan := 0
+	if args[2] != "none" {
+		var err error
+		if vlan, err = strconv.Atoi(args[2]); err != nil || vlan == 0 {
+			wol_i18n.Printf("Error: invalid VLAN ID: %s\n", args[2])
+			os.Exit(1)
+		}
+	}
 
-	if len(args) > 3 {
-		description = args[3]
+	if err := store.SetDeviceVLAN(args[1], vlan); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	if len(args) > 4 {
-		ipAddress = args[4]
+	if vlan == 0 {
+		wol_i18n.Printf("✓ Raw frames for device '%s' are sent untagged\n", args[1])
+	} else {
+		wol_i18n.Printf("✓ Raw frames for device '%s' are tagged for VLAN %d\n", args[1], vlan)
 	}
+	logger.Info("Device %s VLAN set to %d", args[1], vlan)
+}
 
-	if len(args) > 5 {
-		fmt.Sscanf(args[5], "%d", &port)
+func handleSetTags(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server set-tags <device> <tag[,tag...]|none>")
+		wol_i18n.Println("Example: wol-server set-tags desktop office,windows")
+		os.Exit(1)
 	}
 
-	logger.Info("Adding device: name=%s, mac=%s", name, macAddress)
+	var tags []string
+	if args[2] != "none" {
+		tags = strings.Split(args[2], ",")
+	}
 
-	err := store.AddDevice(name, macAddress, description, ipAddress, port)
-	if err != nil {
-		fmt.Printf("Error: Failed to add device: %v\n", err)
-		logger.Error("Failed to add device %s: %v", name, err)
+	if err := store.SetDeviceTags(args[1], tags); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("✓ Device '%s' added successfully\n", name)
-	logger.Info("Device %s added successfully", name)
+	tags = wol_device.NormalizeTags(tags)
+	if len(tags) == 0 {
+		wol_i18n.Printf("✓ Removed all tags from device '%s'\n", args[1])
+	} else {
+		wol_i18n.Printf("✓ Device '%s' tagged %s\n", args[1], strings.Join(tags, ", "))
+	}
+	logger.Info("Device %s tags set to %v", args[1], tags)
 }
 
-func handleListDevices(store *wol_device.DeviceStore, logger *wol_log.Logger) {
-	devices := store.ListDevices()
+func handleSetMeta(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server set-meta <device> <key=value>... (an empty value removes the key)")
+		wol_i18n.Println("Example: wol-server set-meta desktop location=rack4 owner=alice asset=")
+		os.Exit(1)
+	}
 
-	if len(devices) == 0 {
-		fmt.Println("No devices configured.")
-		fmt.Println("Use 'wol-server add-device <name> <mac>' to add a device.")
-		return
+	changes := make(map[string]string)
+	for _, arg := range args[2:] {
+		key, value, ok := strings.Cut(arg, "=")
+		if !ok {
+			wol_i18n.Printf("Error: expected key=value, got %q\n", arg)
+			os.Exit(1)
+		}
+		changes[key] = value
 	}
 
-	fmt.Printf("Configured Devices (%d):\n", len(devices))
-	fmt.Println(strings.Repeat("=", 80))
+	if err := store.SetDeviceMetadata(args[1], changes); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	for _, device := range devices {
-		fmt.Printf("Name:        %s\n", device.Name)
-		fmt.Printf("MAC:         %s\n", device.MACAddress)
+	device, err := store.GetDevice(args[1])
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(device.Metadata) == 0 {
+		wol_i18n.Printf("✓ Device '%s' has no metadata\n", args[1])
+	} else {
+		wol_i18n.Printf("✓ Device '%s' metadata: %s\n", args[1], formatMetadata(device.Metadata))
+	}
+	logger.Info("Device %s metadata set to %v", args[1], device.Metadata)
+}
 
-		if device.Description != "" {
-			fmt.Printf("Description: %s\n", device.Description)
-		}
+// formatMetadata lists metadata as key=value pairs, sorted by key.
+func formatMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for _, key := range slices.Sorted(maps.Keys(metadata)) {
+		pairs = append(pairs, key+"="+metadata[key])
+	}
+	return strings.Join(pairs, ", ")
+}
 
-		if device.IPAddress != "" {
-			fmt.Printf("IP Address:  %s\n", device.IPAddress)
-		}
+func handleSetPolicy(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) < 3 {
+		wol_i18n.Println("Usage: wol-server set-policy <device> [retries=N] [ports=7,9] [copies=N] [verify-ping=on|off] [wait=90s]")
+		wol_i18n.Println("       wol-server set-policy <device> none")
+		wol_i18n.Println("Flags given on the command line override the device's policy.")
+		os.Exit(1)
+	}
 
-		fmt.Printf("Port:        %d\n", device.Port)
-		fmt.Printf("Added:       %s\n", device.AddedAt.Format("2006-01-02 15:04:05"))
+	policy := &wol_device.WakePolicy{}
+	if args[2] != "none" {
+		for _, option := range args[2:] {
+			key, value, ok := strings.Cut(option, "=")
+			if !ok {
+				wol_i18n.Printf("Error: invalid option '%s', expected key=value\n", option)
+				os.Exit(1)
+			}
 
-		if !device.LastWoken.IsZero() {
-			fmt.Printf("Last Woken:  %s\n", device.LastWoken.Format("2006-01-02 15:04:05"))
+			var err error
+			switch key {
+			case "retries":
+				policy.Retries, err = strconv.Atoi(value)
+			case "ports", "extra-ports":
+				policy.ExtraPorts, err = parsePorts(value)
+			case "copies":
+				policy.Copies, err = strconv.Atoi(value)
+			case "verify-ping":
+				on := value == "on" || value == "true"
+				if !on && value != "off" && value != "false" {
+					err = fmt.Errorf("expected on or off")
+				}
+				policy.VerifyPing = &on
+			case "wait":
+				var wait time.Duration
+				wait, err = time.ParseDuration(value)
+				policy.WaitTimeout = wol_device.Duration(wait)
+			default:
+				wol_i18n.Printf("Error: unknown option '%s'\n", key)
+				os.Exit(1)
+			}
+			if err != nil {
+				wol_i18n.Printf("Error: invalid %s: %s\n", key, value)
+				os.Exit(1)
+			}
 		}
+	}
 
-		fmt.Println(strings.Repeat("-", 80))
+	if err := store.SetDeviceWakePolicy(args[1], policy); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
 	}
 
-	logger.Debug("Listed %d devices", len(devices))
+	if policy.IsZero() {
+		wol_i18n.Printf("✓ Device '%s' uses the global wake settings\n", args[1])
+	} else {
+		wol_i18n.Printf("✓ Device '%s' wake policy: %s\n", args[1], formatPolicy(policy))
+	}
+	logger.Info("Device %s wake policy set to %q", args[1], formatPolicy(policy))
 }
 
-func handleRemoveDevice(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
-	if len(args) < 2 {
-		fmt.Println("Usage: wol-server remove-device <name>")
-		fmt.Println("Example: wol-server remove-device desktop")
-		os.Exit(1)
+// formatPolicy describes a wake policy in set-policy's key=value form.
+func formatPolicy(policy *wol_device.WakePolicy) string {
+	var parts []string
+	if policy.Retries > 0 {
+		parts = append(parts, fmt.Sprintf("retries=%d", policy.Retries))
 	}
+	if len(policy.ExtraPorts) > 0 {
+		ports := make([]string, len(policy.ExtraPorts))
+		for i, port := range policy.ExtraPorts {
+			ports[i] = strconv.Itoa(port)
+		}
+		parts = append(parts, "ports="+strings.Join(ports, ","))
+	}
+	if policy.Copies > 0 {
+		parts = append(parts, fmt.Sprintf("copies=%d", policy.Copies))
+	}
+	if policy.VerifyPing != nil {
+		parts = append(parts, fmt.Sprintf("verify-ping=%t", *policy.VerifyPing))
+	}
+	if policy.WaitTimeout > 0 {
+		parts = append(parts, fmt.Sprintf("wait=%s", time.Duration(policy.WaitTimeout)))
+	}
+	return strings.Join(parts, " ")
+}
 
-	name := args[1]
+func handleSetPower(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+	if len(args) == 3 && args[2] == "none" {
+		if err := store.SetDevicePower(args[1], nil); err != nil {
+			wol_i18n.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		wol_i18n.Printf("✓ Power control removed from '%s'\n", args[1])
+		logger.Info("Power control removed from %s", args[1])
+		return
+	}
 
-	if !store.DeviceExists(name) {
-		fmt.Printf("Error: Device '%s' not found\n", name)
-		fmt.Println("Use 'wol-server list-devices' to see available devices.")
+	if len(args) < 4 {
+		wol_i18n.Println("Usage: wol-server set-power <device> <provider> <address> [user=...] [password=...] [vm=...] [mode=fallback|only]")
+		wol_i18n.Println("       wol-server set-power <device> none")
+		wol_i18n.Println("Providers: redfish, ipmi (BMCs), proxmox, libvirt (virtual machines)")
+		wol_i18n.Println("Examples:")
+		wol_i18n.Println("  wol-server set-power nas redfish https://10.0.0.50 user=root password=calvin")
+		wol_i18n.Println("  wol-server set-power win11 proxmox https://pve:8006 user='root@pam!wol' password=<token-secret> vm=101")
+		wol_i18n.Println("  wol-server set-power devbox libvirt qemu:///system vm=devbox")
 		os.Exit(1)
 	}
 
-	logger.Info("Removing device: %s", name)
+	power := &wol_device.PowerConfig{
+		Provider: args[2],
+		Address:  args[3],
+		// Self-signed BMC and hypervisor certificates are the norm on home labs
+		Insecure: true,
+	}
+	for _, option := range args[4:] {
+		key, value, ok := strings.Cut(option, "=")
+		if !ok {
+			wol_i18n.Printf("Error: invalid option '%s', expected key=value\n", option)
+			os.Exit(1)
+		}
 
-	err := store.RemoveDevice(name)
-	if err != nil {
-		fmt.Printf("Error: Failed to remove device: %v\n", err)
-		logger.Error("Failed to remove device %s: %v", name, err)
+		switch key {
+		case "user", "username":
+			power.Username = value
+		case "password":
+			power.Password = value
+		case "vm", "system":
+			power.SystemID = value
+		case "mode":
+			power.Mode = value
+		default:
+			wol_i18n.Printf("Error: unknown option '%s'\n", key)
+			os.Exit(1)
+		}
+	}
+
+	if err := wol_power.ValidateConfig(power); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("✓ Device '%s' removed successfully\n", name)
-	logger.Info("Device %s removed successfully", name)
+	if err := store.SetDevicePower(args[1], power); err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		logger.Error("Failed to set power control for %s: %v", args[1], err)
+		os.Exit(1)
+	}
+
+	wol_i18n.Printf("✓ '%s' now uses %s power control at %s (%s)\n", args[1], power.Provider, power.Address, power.Mode)
+	logger.Info("Device %s power control set to %s at %s (%s)", args[1], power.Provider, power.Address, power.Mode)
 }
 
-func handleShowDevice(args []string, store *wol_device.DeviceStore, logger *wol_log.Logger) {
+func handlePowerStatus(args []string, store *wol_device.DeviceStore, power *wol_power.Waker, logger *wol_log.Logger) {
 	if len(args) < 2 {
-		fmt.Println("Usage: wol-server show-device <name>")
-		fmt.Println("Example: wol-server show-device desktop")
+		wol_i18n.Println("Usage: wol-server power-status <device>")
 		os.Exit(1)
 	}
 
-	name := args[1]
+	device, err := store.GetDevice(args[1])
+	if err != nil {
+		wol_i18n.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
 
-	device, err := store.GetDevice(name)
+	on, err := power.IsPoweredOn(device)
 	if err != nil {
-		fmt.Printf("Error: %v\n", err)
-		fmt.Println("Use 'wol-server list-devices' to see available devices.")
+		wol_i18n.Printf("Error: Failed to read power state: %v\n", err)
+		logger.Error("Failed to read power state of %s: %v", device.Name, err)
 		os.Exit(1)
 	}
 
-	fmt.Printf("Device Details: %s\n", device.Name)
-	fmt.Println(strings.Repeat("=", 40))
-	fmt.Printf("Name:        %s\n", device.Name)
-	fmt.Printf("MAC Address: %s\n", device.MACAddress)
+	state := "off"
+	if on {
+		state = "on"
+	}
+	wol_i18n.Printf("%s is powered %s (%s)\n", device.Name, state, device.Power.Provider)
+}
 
-	if device.Description != "" {
-		fmt.Printf("Description: %s\n", device.Description)
+// seedDemoDevices adds sample devices with random locally administered
+// MACs and documentation-range IPs, so nothing real is ever woken.
+func seedDemoDevices(store *wol_device.DeviceStore, path string, logger *wol_log.Logger) {
+	samples := []struct{ name, description, ip string }{
+		{"demo-desktop", "Sample desktop", "192.0.2.10"},
+		{"demo-nas", "Sample NAS", "192.0.2.20"},
+		{"demo-media", "Sample media server", "192.0.2.30"},
 	}
 
-	if device.IPAddress != "" {
-		fmt.Printf("IP Address:  %s\n", device.IPAddress)
+	for _, sample := range samples {
+		if store.DeviceExists(sample.name) {
+			continue
+		}
+		if err := store.AddDevice(sample.name, wol_packet.GenerateTestMAC(), sample.description, sample.ip, wol_network.DefaultWoLPort); err != nil {
+			logger.Warn("Demo: Failed to add %s: %v", sample.name, err)
+		}
 	}
 
-	fmt.Printf("Port:        %d\n", device.Port)
-	fmt.Printf("Added:       %s\n", device.AddedAt.Format("2006-01-02 15:04:05"))
+	wol_i18n.Printf("Demo mode: %d device(s) in %s\n", store.GetDeviceCount(), path)
+}
 
-	if !device.LastWoken.IsZero() {
-		fmt.Printf("Last Woken:  %s\n", device.LastWoken.Format("2006-01-02 15:04:05"))
-		fmt.Printf("Time Since:  %s\n", time.Since(device.LastWoken).Round(time.Second))
-	} else {
-		fmt.Println("Last Woken:  Never")
+// applySettings fills in every flag the user did not pass on the command
+// line from the settings file.
+func applySettings(settings *wol_config.Config) {
+	given := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) {
+		given[f.Name] = true
+	})
+
+	for name, value := range settings.FlagValues() {
+		if !given[name] {
+			flag.Set(name, value)
+		}
 	}
-
-	logger.Debug("Showed device details for %s", name)
 }
 
 func setupLogging(logFile, logLevel string, verbose, quiet bool) (*wol_log.Logger, error) {
@@ -470,102 +3280,445 @@ func setupLogging(logFile, logLevel string, verbose, quiet bool) (*wol_log.Logge
 }
 
 func showHelp() {
-	fmt.Println("Wake-on-LAN Server with Device Management")
-	fmt.Println("========================================")
+	wol_i18n.Println("Wake-on-LAN Server with Device Management")
+	wol_i18n.Println("========================================")
 	fmt.Println()
-	fmt.Println("Send Wake-on-LAN magic packets to wake up sleeping computers on your network.")
-	fmt.Println("Manage devices with friendly names for easy access.")
+	wol_i18n.Println("Send Wake-on-LAN magic packets to wake up sleeping computers on your network.")
+	wol_i18n.Println("Manage devices with friendly names for easy access.")
 	fmt.Println()
 	showUsage()
 	fmt.Println()
-	fmt.Println("Device Management Commands:")
-	fmt.Println("  add-device <name> <mac> [desc] [ip] [port]")
-	fmt.Println("        Add a new device to the configuration")
-	fmt.Println("  list-devices")
-	fmt.Println("        List all configured devices")
-	fmt.Println("  remove-device <name>")
-	fmt.Println("        Remove a device from the configuration")
-	fmt.Println("  show-device <name>")
-	fmt.Println("        Show detailed information about a device")
+	wol_i18n.Println("Setup:")
+	wol_i18n.Println("  init")
+	wol_i18n.Println("        Interactive first-run setup: pick an interface, find and register devices,")
+	wol_i18n.Println("        generate an API key and write the server settings file")
+	fmt.Println()
+	wol_i18n.Println("Device Management Commands:")
+	wol_i18n.Println("  add-device [-template name] <name> <mac> [desc] [ip] [port]")
+	wol_i18n.Println("        Add a new device to the configuration; ip may be a host name such as")
+	wol_i18n.Println("        nas.lan or nas.local, looked up on every wake. -template takes the")
+	wol_i18n.Println("        port, tags and wake policy from a saved template")
+	wol_i18n.Println("  clone-device <source> <new-name> <new-mac> [ip]")
+	wol_i18n.Println("        Add a device with the same settings as an existing one")
+	wol_i18n.Println("  save-template <template> <device>")
+	wol_i18n.Println("        Save the device's port, tags and wake policy as a named template")
+	wol_i18n.Println("  list-templates")
+	wol_i18n.Println("        List saved templates")
+	wol_i18n.Println("  remove-template <name>")
+	wol_i18n.Println("        Remove a saved template")
+	wol_i18n.Println("  list-devices [-tag tag[,tag...]] [-filter query] [-sort name|added|last-woken|last-seen]")
+	wol_i18n.Println("               [-desc] [-offset n] [-limit n] [-archived]")
+	wol_i18n.Println("        List all configured devices, or only those with all of the given tags")
+	wol_i18n.Println("        or matching a search: text in the name or description, tag:<tag>,")
+	wol_i18n.Println("        mac:<prefix>, status:<online|offline|unknown> and group:<name>")
+	wol_i18n.Println("        -offset and -limit page through long lists; -archived lists archived devices")
+	wol_i18n.Println("  remove-device <name>")
+	wol_i18n.Println("        Remove a device from the configuration")
+	wol_i18n.Println("  archive-device <name>")
+	wol_i18n.Println("        Hide a device from listings and wake by name, keeping its record")
+	wol_i18n.Println("  unarchive <name>")
+	wol_i18n.Println("        Restore an archived device")
+	wol_i18n.Println("  show-device <name>")
+	wol_i18n.Println("        Show detailed information about a device")
+	wol_i18n.Println("  rename-device <name> <new-name>")
+	wol_i18n.Println("        Rename a device, keeping its settings and timestamps")
+	wol_i18n.Println("  import <file.csv|->")
+	wol_i18n.Println("        Add devices from a CSV file with a header row naming its columns:")
+	wol_i18n.Println("        name, mac_address (required), description, ip_address, port, tags")
+	wol_i18n.Println("        (separated by ;).")
+	wol_i18n.Println("        Rows whose name or MAC is already used are skipped; an invalid")
+	wol_i18n.Println("        row imports nothing")
+	wol_i18n.Println("  export [-format csv|homeassistant] [file|-]")
+	wol_i18n.Println("        Write all devices as CSV with the columns above (default: stdout), or")
+	wol_i18n.Println("        as Home Assistant wake_on_lan switches for configuration.yaml")
+	wol_i18n.Println("  import-arp [-yes] [-iface name]")
+	wol_i18n.Println("        Add the hosts in the system ARP table as devices, asking for each")
+	wol_i18n.Println("        one's name unless -yes is given")
+	wol_i18n.Println("  gen-store-key <file>")
+	wol_i18n.Println("        Write a random key for -store-key-file; keep a copy, the device file")
+	wol_i18n.Println("        cannot be read without it")
+	wol_i18n.Println("  backup")
+	wol_i18n.Println("        Write a timestamped archive of the devices, sites, settings and")
+	wol_i18n.Println("        packet history to -backup-dir, keeping the last -backup-keep")
+	wol_i18n.Println("  restore [-yes] <backup.tar.gz>")
+	wol_i18n.Println("        Replace the devices, sites and settings with those in a backup")
+	wol_i18n.Println("  set-secureon <name> <password|none>")
+	wol_i18n.Println("        Set the SecureOn password the device's NIC expects, e.g. 00:11:22:33:44:55")
+	wol_i18n.Println("  set-broadcast <name> <limited|directed|all|default>")
+	wol_i18n.Println("        Broadcast the device's packet to 255.255.255.255 or its subnet's address")
+	wol_i18n.Println("  set-broadcast-address <name> <ip|none>")
+	wol_i18n.Println("        Broadcast the device's packet to this address, e.g. the directed")
+	wol_i18n.Println("        broadcast of its VLAN's subnet, instead of the global one")
+	wol_i18n.Println("  set-interface <name> <interface|none>")
+	wol_i18n.Println("        Send the device's packet from this interface unless -iface is given")
+	wol_i18n.Println("  set-wake-address <name> <host[:port]|none>")
+	wol_i18n.Println("        Send the device's packet to this address instead of broadcasting it, e.g.")
+	wol_i18n.Println("        a router's public IP or DynDNS name with a UDP port forwarded to the LAN")
+	wol_i18n.Println("  set-vlan <name> <vlan-id|none>")
+	wol_i18n.Println("        Tag the device's raw Ethernet frames (-raw) for an 802.1Q VLAN")
+	wol_i18n.Println("  set-meta <name> <key=value>...")
+	wol_i18n.Println("        Set free-form details such as location=rack4 or owner=alice;")
+	wol_i18n.Println("        an empty value removes the key")
+	wol_i18n.Println("  set-tags <name> <tag[,tag...]|none>")
+	wol_i18n.Println("        Replace the device's free-form tags, used to filter list-devices")
+	fmt.Println()
+	wol_i18n.Println("Federation Commands:")
+	wol_i18n.Println("  add-site <name> <url> [api-key] [subnets]")
+	wol_i18n.Println("        Register a remote wol-server; devices in its subnets are woken through it")
+	wol_i18n.Println("  list-sites")
+	wol_i18n.Println("        List registered sites")
+	wol_i18n.Println("  remove-site <name>")
+	wol_i18n.Println("        Remove a registered site")
+	wol_i18n.Println("  set-site <device> <site|local>")
+	wol_i18n.Println("        Home a device to a site, or back to the local network")
+	wol_i18n.Println("  set-remote <device> <url|none> [api-key]")
+	wol_i18n.Println("        Wake a device through the /api/wake of another wol-server")
+	fmt.Println()
+	wol_i18n.Println("Power Control Commands:")
+	wol_i18n.Println("  set-policy <device> [retries=N] [ports=7,9] [copies=N] [verify-ping=on|off] [wait=90s]")
+	wol_i18n.Println("        Give the device its own wake settings; flags given on the command line")
+	wol_i18n.Println("        override them. 'set-policy <device> none' removes the policy")
+	wol_i18n.Println("  set-power <device> <provider> <address> [user=] [password=] [vm=] [mode=]")
+	wol_i18n.Println("        Power the device on through its BMC (redfish, ipmi) or hypervisor (proxmox,")
+	wol_i18n.Println("        libvirt). BMCs act as a fallback if a magic packet does not wake the host;")
+	wol_i18n.Println("        VMs are started directly. IPMI needs ipmitool, libvirt needs virsh.")
+	wol_i18n.Println("  set-power <device> none")
+	wol_i18n.Println("        Remove power control")
+	wol_i18n.Println("  power-status <device>")
+	wol_i18n.Println("        Ask the device's power provider whether it is running")
+	wol_i18n.Println("  -power-wait duration")
+	wol_i18n.Println("        How long to wait for a magic packet before power fallback (default: 1m30s)")
+	fmt.Println()
+	wol_i18n.Println("Wake Commands:")
+	wol_i18n.Println("  wake <name-or-mac>")
+	wol_i18n.Println("        Wake a device by name or MAC address; the MAC or IP address of a")
+	wol_i18n.Println("        configured device wakes it with its settings")
+	wol_i18n.Println("  <name-or-mac>")
+	wol_i18n.Println("        Wake a device (shorthand)")
+	fmt.Println()
+	wol_i18n.Println("Verification Options:")
+	wol_i18n.Println("  -verify")
+	wol_i18n.Println("        Enable basic packet verification")
+	wol_i18n.Println("  -verify-capture")
+	wol_i18n.Println("        Enable packet capture verification: listens on the wake port for the")
+	wol_i18n.Println("        broadcast, or captures on -iface through libpcap in builds with -tags pcap")
+	wol_i18n.Println("  -verify-ping")
+	wol_i18n.Println("        Check the device accepts TCP connections after wake")
+	wol_i18n.Println("  -verify-arp, -verify-icmp")
+	wol_i18n.Println("        Check the device answers ARP or ICMP ping after wake (ICMP needs root)")
+	wol_i18n.Println("  -verify-agent string")
+	wol_i18n.Println("        Poll a URL on the device until it answers 2xx")
+	wol_i18n.Println("  -verify-timeout duration")
+	wol_i18n.Println("        How long each check keeps trying; checks run concurrently (default: 30s)")
+	fmt.Println()
+	wol_i18n.Println("Network Commands:")
+	wol_i18n.Println("  doctor")
+	wol_i18n.Println("        Check that wake packets can leave this host: broadcast support and")
+	wol_i18n.Println("        permission, firewall rules and the wake port (-iface, -port)")
+	wol_i18n.Println("  verify-network")
+	wol_i18n.Println("        Show the default interface, gateway, DNS servers and broadcast-capable")
+	wol_i18n.Println("        interfaces, and test connectivity")
+	wol_i18n.Println("  test-broadcast <mac>")
+	wol_i18n.Println("        Test broadcast capability with packet verification")
+	wol_i18n.Println("  discover")
+	wol_i18n.Println("        Scan the local subnets (or -iface) and list the hosts found, with their MACs")
+	wol_i18n.Println("        and names from reverse DNS, mDNS or NetBIOS")
+	wol_i18n.Println("  find-servers")
+	wol_i18n.Println("        Find wol-server instances advertised on the LAN via mDNS")
+	wol_i18n.Println("  lookup-mac <ip-address>")
+	wol_i18n.Println("        Print the MAC address of a host on the local network from the neighbor table")
+	wol_i18n.Println("  bench [build|unicast|broadcast|reuse|pool|all] [count] [target]")
+	wol_i18n.Println("        Measure packets per second and allocations of the build+send pipeline;")
+	wol_i18n.Println("        without a target, packets go to a sink on the loopback interface")
+	wol_i18n.Println("  relay")
+	wol_i18n.Println("        Run only the relay: re-broadcast magic packets received on -relay-port out of")
+	wol_i18n.Println("        -iface until interrupted")
+	wol_i18n.Println("  listen")
+	wol_i18n.Println("        Print every magic packet seen on the network: sender, target and device")
+	wol_i18n.Println("  -monitor-ports string")
+	wol_i18n.Println("        UDP ports to listen on (default: 7,9)")
+	wol_i18n.Println("  -monitor-raw, -monitor-interface string")
+	wol_i18n.Println("        Capture on a raw socket instead, also seeing EtherType 0x0842 (Linux, root)")
+	wol_i18n.Println("  -monitor-record string")
+	wol_i18n.Println("        Append every packet seen to this file as JSON lines, for auditing; also")
+	wol_i18n.Println("        restores the history at /api/monitor/packets after a restart")
+	fmt.Println()
+	wol_i18n.Println("Server Mode:")
+	wol_i18n.Println("  -server")
+	wol_i18n.Println("        Run in HTTP server mode")
+	wol_i18n.Println("        /healthz and /readyz answer liveness and readiness probes without")
+	wol_i18n.Println("        authentication; /readyz fails with 503 when the device store cannot be")
+	wol_i18n.Println("        read or the wake interface is unusable")
+	wol_i18n.Println("  -server-port int")
+	wol_i18n.Println("        Server port (default: 8080)")
+	wol_i18n.Println("  -server-host string")
+	wol_i18n.Println("        Server host (default: 0.0.0.0)")
+	wol_i18n.Println("  -cors")
+	wol_i18n.Println("        Enable CORS headers (default: true)")
+	wol_i18n.Println("  -cors-origins string")
+	wol_i18n.Println("        Comma-separated origins, e.g. https://home.example.com, allowed to call")
+	wol_i18n.Println("        the API from a browser (default: *, any origin)")
+	wol_i18n.Println("  -cors-methods string, -cors-headers string")
+	wol_i18n.Println("        Methods and request headers allowed in CORS requests")
+	wol_i18n.Println("  -cors-credentials")
+	wol_i18n.Println("        Let the listed origins send cookies and HTTP auth; not allowed with *")
+	wol_i18n.Println("  -rate-limit float, -rate-burst int")
+	wol_i18n.Println("        Requests per second each client IP may make to the API on average, and")
+	wol_i18n.Println("        in a burst; beyond that requests get 429 (default: no limit, burst 20)")
+	wol_i18n.Println("  -wake-rate-limit float, -wake-rate-burst int")
+	wol_i18n.Println("        The same for POST /api/wake requests (default: 1 per second, burst 10)")
+	wol_i18n.Println("  -max-body-bytes int")
+	wol_i18n.Println("        Largest JSON request body the API accepts; larger ones get 413 (default: 1 MiB)")
+	wol_i18n.Println("  -metrics")
+	wol_i18n.Println("        Serve Prometheus metrics at /metrics: wake attempts and verifications by")
+	wol_i18n.Println("        result, request counts and durations, device counts. With authentication")
+	wol_i18n.Println("        enabled, scrapes need API credentials such as the -api-key (default: false)")
+	wol_i18n.Println("  -swagger-ui")
+	wol_i18n.Println("        Serve a Swagger UI page at /api/docs for the OpenAPI document the server")
+	wol_i18n.Println("        always serves at /api/openapi.json. The page loads Swagger UI from a CDN")
+	wol_i18n.Println("  -webhook string, -webhook-secret string")
+	wol_i18n.Println("        POST wake.success, wake.failure, device.online and device.offline events")
+	wol_i18n.Println("        as JSON to these comma-separated URLs. With a secret, each delivery has an")
+	wol_i18n.Println("        X-WoL-Signature-256: sha256=<HMAC of the body> header; WOL_WEBHOOK_SECRET")
+	wol_i18n.Println("        also sets it. Webhooks in server.json may pick their events and secret")
+	wol_i18n.Println("  -shutdown-timeout duration")
+	wol_i18n.Println("        On SIGINT or SIGTERM, stop accepting requests and wait this long for those")
+	wol_i18n.Println("        in flight before saving pending device changes and exiting (default: 10s)")
+	wol_i18n.Println("  -dhcp-leases string")
+	wol_i18n.Println("        Watch a DHCP lease file and keep device IPs up to date")
+	wol_i18n.Println("  -dhcp-format string")
+	wol_i18n.Println("        Lease file format: dnsmasq, isc, kea (default: dnsmasq)")
+	wol_i18n.Println("  -dhcp-api string")
+	wol_i18n.Println("        Poll a router API for DHCP leases instead of a file")
+	wol_i18n.Println("  -dhcp-interval duration")
+	wol_i18n.Println("        DHCP lease poll interval (default: 30s)")
+	wol_i18n.Println("  -store-key-file string")
+	wol_i18n.Println("        Encrypt the device file with AES-256-GCM using the key (or passphrase)")
+	wol_i18n.Println("        in this file; WOL_STORE_PASSPHRASE gives a passphrase instead")
+	wol_i18n.Println("  -backup-dir string")
+	wol_i18n.Println("        Directory backups are written to (default: backups next to the device file).")
+	wol_i18n.Println("        With a store key, backups are encrypted with it and need it to be restored")
+	wol_i18n.Println("  -backup-keep int")
+	wol_i18n.Println("        How many backups to keep; 0 keeps all (default: 10)")
+	wol_i18n.Println("  -reload-interval duration")
+	wol_i18n.Println("        The device file is watched for outside edits and reloaded; where it cannot")
+	wol_i18n.Println("        be watched it is checked this often instead. 0 does not reload it (default: 2s)")
+	wol_i18n.Println("  -flush-delay duration")
+	wol_i18n.Println("        Write wake times and statuses out in batches this long after the first")
+	wol_i18n.Println("        change, 0 to write each at once (default: 2s)")
+	wol_i18n.Println("  -status-interval duration")
+	wol_i18n.Println("        How often to check which devices are online, 0 to disable (default: 1m)")
+	wol_i18n.Println("  -status-cache-ttl duration")
+	wol_i18n.Println("        How long GET /api/status reuses a device's last probe; ?refresh=true")
+	wol_i18n.Println("        probes again and requires operator. /api/devices/{name}/status always")
+	wol_i18n.Println("        probes (default: 30s)")
+	wol_i18n.Println("  -mdns")
+	wol_i18n.Println("        Advertise _wol-server._tcp via mDNS/DNS-SD (default: true)")
+	wol_i18n.Println("  -mdns-name string")
+	wol_i18n.Println("        mDNS service instance name (default: wol-server on <hostname>)")
+	wol_i18n.Println("  -monitor")
+	wol_i18n.Println("        Record magic packets from any sender at /api/monitor/packets and")
+	wol_i18n.Println("        stream them over a WebSocket at /api/monitor/stream")
+	wol_i18n.Println("  -relay, -relay-port int, -relay-from string")
+	wol_i18n.Println("        Re-broadcast magic packets received on -relay-port (default: 9), from any")
+	wol_i18n.Println("        interface or only -relay-from, out of -iface with -broadcast and -port;")
+	wol_i18n.Println("        bridges broadcast domains, e.g. for a router port-forward")
+	fmt.Println()
+	wol_i18n.Println("HTTPS (server mode):")
+	wol_i18n.Println("  -tls-cert string, -tls-key string")
+	wol_i18n.Println("        Serve the API over HTTPS (TLS 1.2 or later) with this PEM certificate")
+	wol_i18n.Println("        and key; both can also be set in the settings file")
+	wol_i18n.Println("  -tls-client-ca string")
+	wol_i18n.Println("        Require every client to present a certificate signed by a CA in this PEM")
+	wol_i18n.Println("        file. The certificate's CN is the username and its OUs are groups for")
+	wol_i18n.Println("        -auth-roles; without -auth-roles or -auth-default-role, holders are admins")
+	wol_i18n.Println("  -tls-redirect-port int")
+	wol_i18n.Println("        Redirect plain HTTP on this port to HTTPS, e.g. 80 with -server-port 443")
+	fmt.Println()
+	wol_i18n.Println("Authentication (server mode):")
+	wol_i18n.Println("  -api-key string")
+	wol_i18n.Println("        Require this key, at least 16 characters, as an Authorization: Bearer or")
+	wol_i18n.Println("        X-API-Key header on every /api route but /api/health; WOL_API_KEY or")
+	wol_i18n.Println("        the init wizard's key set it too")
+	wol_i18n.Println("  add-user [-role viewer|operator|admin] <username>, list-users, remove-user <username>")
+	wol_i18n.Println("  set-password <username>, set-role <username> <role>")
+	wol_i18n.Println("        Manage local users, who sign in with HTTP Basic auth; passwords are read")
+	wol_i18n.Println("        from stdin and stored as bcrypt hashes in the settings file.")
+	wol_i18n.Println("        Viewers can list devices, operators can also wake them and scan the")
+	wol_i18n.Println("        network, and only admins can change the device store (default role: viewer)")
+	wol_i18n.Println("  -session-ttl duration")
+	wol_i18n.Println("        Lifetime of the bearer tokens POST /api/login trades credentials for;")
+	wol_i18n.Println("        restarting the server ends all sessions (default 12h)")
+	wol_i18n.Println("  -session-key string")
+	wol_i18n.Println("        Sign session tokens with this key (at least 32 characters) instead of a")
+	wol_i18n.Println("        random one, so sessions survive restarts and every HA node accepts them;")
+	wol_i18n.Println("        WOL_SESSION_KEY or \"session_key\" in server.json also set it")
+	wol_i18n.Println("  -oidc-issuer string, -oidc-client-id string")
+	wol_i18n.Println("        Accept OIDC bearer tokens from this issuer (Authelia, Keycloak, ...)")
+	wol_i18n.Println("  -ldap-url string, -ldap-base-dn string")
+	wol_i18n.Println("        Accept HTTP Basic credentials verified against LDAP/AD")
+	wol_i18n.Println("  -ldap-starttls")
+	wol_i18n.Println("        Upgrade an ldap:// URL to TLS; without it, passwords are sent in clear text")
+	wol_i18n.Println("  -auth-roles string")
+	wol_i18n.Println("        Map groups to roles: group=admin|operator|viewer, comma separated")
+	wol_i18n.Println("  -auth-default-role string")
+	wol_i18n.Println("        Role for users in no mapped group (default: deny)")
 	fmt.Println()
-	fmt.Println("Wake Commands:")
-	fmt.Println("  wake <name-or-mac>")
-	fmt.Println("        Wake a device by name or MAC address")
-	fmt.Println("  <name-or-mac>")
-	fmt.Println("        Wake a device (shorthand)")
+	wol_i18n.Println("High Availability (server mode):")
+	wol_i18n.Println("  -ha-lease-file string")
+	wol_i18n.Println("        Shared lease file; the lease holder is leader, others stay standby")
+	wol_i18n.Println("        and answer API changes other than wakes with 503 until they take over.")
+	wol_i18n.Println("        The filesystem must support flock (local disk, NFSv4) and the nodes'")
+	wol_i18n.Println("        clocks must be in sync, e.g. through NTP, as they compare lease expiry")
+	wol_i18n.Println("  -ha-redis string")
+	wol_i18n.Println("        Keep the lease in Redis instead, e.g. redis://host:6379/0; with -store redis")
+	wol_i18n.Println("        and -store-url on the same server, nodes on different hosts and subnets")
+	wol_i18n.Println("        share their devices, groups and schedules without a shared filesystem.")
+	wol_i18n.Println("        Redis is the only database lease backend; SQLite is not supported")
+	wol_i18n.Println("  -ha-node-id string")
+	wol_i18n.Println("        Unique node ID (default: hostname)")
+	wol_i18n.Println("  -ha-peers string")
+	wol_i18n.Println("        Comma-separated peer URLs reported by /api/ha/status")
+	wol_i18n.Println("  -ha-secret string")
+	wol_i18n.Println("        Secret every node shares; peers send it to read each other's local status,")
+	wol_i18n.Println("        which otherwise needs no credentials (or set WOL_HA_SECRET)")
+	wol_i18n.Println("  With -ha-lease-file, point every node's -config at the same shared devices.json.")
 	fmt.Println()
-	fmt.Println("Verification Options:")
-	fmt.Println("  -verify")
-	fmt.Println("        Enable basic packet verification")
-	fmt.Println("  -verify-capture")
-	fmt.Println("        Enable packet capture verification")
-	fmt.Println("  -verify-ping")
-	fmt.Println("        Enable ping verification after wake")
+	wol_i18n.Println("Wake-on-Demand Proxy (server mode):")
+	wol_i18n.Println("  -proxy string")
+	wol_i18n.Println("        Forward TCP ports to devices, waking them on first connection")
+	wol_i18n.Println("        e.g. -proxy 2222=nas:22,8096=nas:8096 (device needs an IP address)")
+	wol_i18n.Println("  -proxy-wait duration")
+	wol_i18n.Println("        How long to wait for a woken device to accept connections (default: 2m)")
 	fmt.Println()
-	fmt.Println("Network Commands:")
-	fmt.Println("  verify-network")
-	fmt.Println("        Show network information and test connectivity")
-	fmt.Println("  test-broadcast <mac>")
-	fmt.Println("        Test broadcast capability with packet verification")
+	wol_i18n.Println("Plugins:")
+	wol_i18n.Println("  -plugin-dir string")
+	wol_i18n.Println("        Load external plugin executables (JSON over stdio) from this directory")
+	wol_i18n.Println("        Devices with a \"transport\" set in devices.json wake through that plugin")
 	fmt.Println()
-	fmt.Println("Server Mode:")
-	fmt.Println("  -server")
-	fmt.Println("        Run in HTTP server mode")
-	fmt.Println("  -server-port int")
-	fmt.Println("        Server port (default: 8080)")
-	fmt.Println("  -server-host string")
-	fmt.Println("        Server host (default: 0.0.0.0)")
-	fmt.Println("  -cors")
-	fmt.Println("        Enable CORS headers (default: true)")
+	wol_i18n.Println("Metrics:")
+	wol_i18n.Println("  -statsd string")
+	wol_i18n.Println("        Send wake counts, failures and boot durations to StatsD at host:port")
+	wol_i18n.Println("  -statsd-prefix string")
+	wol_i18n.Println("        Metric name prefix (default: wol)")
+	wol_i18n.Println("  -dogstatsd")
+	wol_i18n.Println("        Add DogStatsD tags (device name and -statsd-tags)")
 	fmt.Println()
-	fmt.Println("Options:")
-	fmt.Println("  -port int")
-	fmt.Printf("        UDP port to send Wake-on-LAN packet (default: %d)\n", wol_network.DefaultWoLPort)
-	fmt.Println("  -config string")
-	fmt.Println("        Device configuration file path")
-	fmt.Println("  -log string")
-	fmt.Println("        Log file path (default: console only)")
-	fmt.Println("  -level string")
-	fmt.Println("        Log level: debug, info, warn, error (default: info)")
-	fmt.Println("  -verbose")
-	fmt.Println("        Enable verbose output (same as -level debug)")
-	fmt.Println("  -quiet")
-	fmt.Println("        Quiet mode - only errors (same as -level error)")
-	fmt.Println("  -help")
-	fmt.Println("        Show this help message")
+	wol_i18n.Println("Options:")
+	wol_i18n.Println("  -port int")
+	wol_i18n.Printf("        UDP port to send Wake-on-LAN packet (default: %d)\n", wol_network.DefaultWoLPort)
+	wol_i18n.Println("  -packet-repeat int, -packet-padding int")
+	wol_i18n.Println("        Repeat the MAC more than 16 times or pad the magic packet with zero bytes;")
+	wol_i18n.Println("        some older NICs only wake on such packets")
+	wol_i18n.Println("  -iface string")
+	wol_i18n.Println("        Send wake packets from this network interface, e.g. eth1, instead of the")
+	wol_i18n.Println("        one the default route picks; also the default for API wakes")
+	wol_i18n.Println("  -source-ip string, -source-port int")
+	wol_i18n.Println("        Send wake packets from this local address and/or UDP port, for hosts with")
+	wol_i18n.Println("        policy routing or firewall rules that match on the source")
+	wol_i18n.Println("  -wake-address string")
+	wol_i18n.Println("        Send wake packets to this host[:port] instead of broadcasting them, to wake")
+	wol_i18n.Println("        a machine behind NAT through a port forward; devices may set their own")
+	wol_i18n.Println("  -broadcast string")
+	wol_i18n.Println("        limited sends to 255.255.255.255, directed to the subnet's broadcast address,")
+	wol_i18n.Println("        e.g. 192.168.1.255, which routers forward more often; all sends the directed")
+	wol_i18n.Println("        broadcast out of every up interface, for hosts on several VLANs (default: limited)")
+	wol_i18n.Println("  -secureon string")
+	wol_i18n.Println("        SecureOn password for NICs that require one, 6 bytes like a MAC address or")
+	wol_i18n.Println("        4 bytes like an IPv4 address; overrides the device's stored password")
+	wol_i18n.Println("  -unicast")
+	wol_i18n.Println("        Also send the packet straight to the device's IP address, which reaches")
+	wol_i18n.Println("        hosts behind a router that drops broadcasts")
+	wol_i18n.Println("  -6, -6-address string")
+	wol_i18n.Println("        Send over IPv6 to the all-nodes group ff02::1 on -iface, or to the given")
+	wol_i18n.Println("        address, e.g. ff02::1%eth1; for IPv6-only networks")
+	wol_i18n.Println("  -retries int, -retry-interval duration")
+	wol_i18n.Println("        Resend the packet if sending fails, waiting -retry-interval (default 500ms)")
+	wol_i18n.Println("        before the first retry and twice as long before each further one")
+	wol_i18n.Println("  -copies int, -copy-interval duration")
+	wol_i18n.Println("        Send each packet several times, -copy-interval (default 500ms) apart, as one")
+	wol_i18n.Println("        attempt, for NICs that miss a single packet; retries resend all copies")
+	wol_i18n.Println("  -all-ports, -extra-ports string")
+	wol_i18n.Println("        Send to both port 9 and 7, and/or to a comma-separated list of extra ports,")
+	wol_i18n.Println("        in one wake; -verify reports the result for each port")
+	wol_i18n.Println("  -wait duration")
+	wol_i18n.Println("        After waking, poll the device (ping, ARP, TCP) until it answers or the")
+	wol_i18n.Println("        duration passes, e.g. -wait 90s; exits non-zero if it stays offline")
+	wol_i18n.Println("  -raw")
+	wol_i18n.Println("        Send a raw Ethernet frame (EtherType 0x0842) instead of UDP, for firmware")
+	wol_i18n.Println("        that ignores the UDP variant (Linux, needs root)")
+	wol_i18n.Println("  -vlan int")
+	wol_i18n.Println("        Tag -raw frames for an 802.1Q VLAN (1-4094), for hosts reached through a")
+	wol_i18n.Println("        trunk port; devices may set their own with set-vlan")
+	wol_i18n.Println("  -config string")
+	wol_i18n.Println("        Device configuration file path; a .yaml, .yml or .toml name stores it in that format")
+	wol_i18n.Println("  -server-config string")
+	wol_i18n.Println("        Server settings file (default: server.json next to the device file)")
+	wol_i18n.Println("  -log string")
+	wol_i18n.Println("        Log file path (default: console only)")
+	wol_i18n.Println("  -level string")
+	wol_i18n.Println("        Log level: debug, info, warn, error (default: info)")
+	wol_i18n.Println("  -access-log-format string")
+	wol_i18n.Println("        How the server logs each request: text (default), or json for one JSON")
+	wol_i18n.Println("        object per line with method, path, status, duration_ms, bytes,")
+	wol_i18n.Println("        client_ip, request_id and user, for Loki or ELK")
+	wol_i18n.Println("  -verbose")
+	wol_i18n.Println("        Enable verbose output (same as -level debug)")
+	wol_i18n.Println("  -quiet")
+	wol_i18n.Println("        Quiet mode - only errors (same as -level error)")
+	wol_i18n.Println("  -demo")
+	wol_i18n.Println("        Seed a throwaway device file with sample devices, for trying things out")
+	wol_i18n.Println("  -strict-mac")
+	wol_i18n.Println("        Reject broadcast and multicast MAC addresses, which are always typos")
+	wol_i18n.Println("  -mac-style string")
+	wol_i18n.Println("        How MAC addresses are stored and shown: colon, hyphen, dotted, bare (default: colon)")
+	wol_i18n.Println("  -store string")
+	wol_i18n.Println("        Device store backend (default: file, the -config file)")
+	wol_i18n.Println("        bolt keeps devices in a bbolt database next to the -config file, with a")
+	wol_i18n.Println("        .db extension, importing the -config file the first time it is opened.")
+	wol_i18n.Println("        Only one wol-server can use the database at a time.")
+	wol_i18n.Println("        redis keeps devices, groups and schedules on the Redis server given by")
+	wol_i18n.Println("        -store-url, e.g. redis://:password@host:6379/0, where several wol-servers")
+	wol_i18n.Println("        can share them; the -config file is imported the first time.")
+	wol_i18n.Println("  -lang string")
+	wol_i18n.Println("        Output language, e.g. de or es (default: from LC_ALL, LC_MESSAGES or LANG)")
+	wol_i18n.Println("  -lang-dir string")
+	wol_i18n.Println("        Directory of <lang>.json message catalogs that add or override translations")
+	wol_i18n.Println("  -help")
+	wol_i18n.Println("        Show this help message")
 	fmt.Println()
-	fmt.Println("Examples:")
-	fmt.Println("  # Device management")
-	fmt.Println("  wol-server.exe add-device desktop AA:BB:CC:DD:EE:FF \"My desktop computer\"")
-	fmt.Println("  wol-server.exe list-devices")
-	fmt.Println("  wol-server.exe show-device desktop")
-	fmt.Println("  wol-server.exe remove-device desktop")
+	wol_i18n.Println("Examples:")
+	wol_i18n.Println("  # Device management")
+	wol_i18n.Println("  wol-server.exe add-device desktop AA:BB:CC:DD:EE:FF \"My desktop computer\"")
+	wol_i18n.Println("  wol-server.exe list-devices")
+	wol_i18n.Println("  wol-server.exe show-device desktop")
+	wol_i18n.Println("  wol-server.exe remove-device desktop")
 	fmt.Println()
-	fmt.Println("  # Wake devices")
-	fmt.Println("  wol-server.exe wake desktop")
-	fmt.Println("  wol-server.exe desktop")
-	fmt.Println("  wol-server.exe AA:BB:CC:DD:EE:FF")
-	fmt.Println("  wol-server.exe -port 7 laptop")
+	wol_i18n.Println("  # Wake devices")
+	wol_i18n.Println("  wol-server.exe wake desktop")
+	wol_i18n.Println("  wol-server.exe desktop")
+	wol_i18n.Println("  wol-server.exe AA:BB:CC:DD:EE:FF")
+	wol_i18n.Println("  wol-server.exe -port 7 laptop")
 	fmt.Println()
-	fmt.Println("  # Network verification")
-	fmt.Println("  wol-server.exe verify-network")
-	fmt.Println("  wol-server.exe test-broadcast AA:BB:CC:DD:EE:FF")
-	fmt.Println("  wol-server.exe -verify-capture desktop")
+	wol_i18n.Println("  # Network verification")
+	wol_i18n.Println("  wol-server.exe verify-network")
+	wol_i18n.Println("  wol-server.exe test-broadcast AA:BB:CC:DD:EE:FF")
+	wol_i18n.Println("  wol-server.exe -verify-capture desktop")
 	fmt.Println()
-	fmt.Println("  # Server mode")
-	fmt.Println("  wol-server.exe -server")
-	fmt.Println("  wol-server.exe -server -server-port 8080 -log server.log")
+	wol_i18n.Println("  # Server mode")
+	wol_i18n.Println("  wol-server.exe -server")
+	wol_i18n.Println("  wol-server.exe -server -server-port 8080 -log server.log")
 	fmt.Println()
-	fmt.Println("Supported MAC address formats:")
-	fmt.Println("  - Colon separated: AA:BB:CC:DD:EE:FF")
-	fmt.Println("  - Hyphen separated: AA-BB-CC-DD-EE-FF")
-	fmt.Println("  - No separators: AABBCCDDEEFF")
-	fmt.Println("  - Case insensitive")
+	wol_i18n.Println("Supported MAC address formats:")
+	wol_i18n.Println("  - Colon separated: AA:BB:CC:DD:EE:FF")
+	wol_i18n.Println("  - Hyphen separated: AA-BB-CC-DD-EE-FF")
+	wol_i18n.Println("  - No separators: AABBCCDDEEFF")
+	wol_i18n.Println("  - Case insensitive")
 }
 
 func showUsage() {
-	fmt.Println("Usage:")
-	fmt.Println("  wol-server.exe [options] <command> [arguments]")
-	fmt.Println("  wol-server.exe [options] <device-name-or-mac>")
-	fmt.Println("  wol-server.exe -server [server-options]")
+	wol_i18n.Println("Usage:")
+	wol_i18n.Println("  wol-server.exe [options] <command> [arguments]")
+	wol_i18n.Println("  wol-server.exe [options] <device-name-or-mac>")
+	wol_i18n.Println("  wol-server.exe -server [server-options]")
 }
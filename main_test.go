@@ -0,0 +1,55 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"slices"
+	"strconv"
+	"testing"
+	wol_device "wol-server/wol/device"
+)
+
+// TestCommandsReserved checks every command main dispatches on is a
+// reserved device name, since any other first argument is woken as one.
+func TestCommandsReserved(t *testing.T) {
+	file, err := parser.ParseFile(token.NewFileSet(), "main.go", nil, 0)
+	if err != nil {
+		t.Fatalf("parsing main.go: %v", err)
+	}
+
+	var commands []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		var values []ast.Expr
+		switch n := n.(type) {
+		case *ast.SwitchStmt:
+			if tag, ok := n.Tag.(*ast.Ident); !ok || tag.Name != "command" {
+				return true
+			}
+			for _, stmt := range n.Body.List {
+				values = append(values, stmt.(*ast.CaseClause).List...)
+			}
+		case *ast.BinaryExpr:
+			if x, ok := n.X.(*ast.Ident); !ok || x.Name != "command" || n.Op != token.EQL {
+				return true
+			}
+			values = append(values, n.Y)
+		}
+		for _, value := range values {
+			if lit, ok := value.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+				command, _ := strconv.Unquote(lit.Value)
+				commands = append(commands, command)
+			}
+		}
+		return true
+	})
+
+	if len(commands) == 0 {
+		t.Fatal("found no commands in main.go")
+	}
+	for _, command := range commands {
+		if !slices.Contains(wol_device.ReservedNames, command) {
+			t.Errorf("command %q is not in wol_device.ReservedNames", command)
+		}
+	}
+}
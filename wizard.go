@@ -0,0 +1,249 @@
+// wizard.go
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	wol_config "wol-server/wol/config"
+	wol_device "wol-server/wol/device"
+	wol_i18n "wol-server/wol/i18n"
+	wol_log "wol-server/wol/log"
+	wol_network "wol-server/wol/network"
+)
+
+type wizardInterface struct {
+	name   string
+	mac    string
+	subnet *net.IPNet
+	ip     net.IP
+}
+
+// runInitWizard walks through first-run setup and writes the settings file.
+func runInitWizard(store *wol_device.DeviceStore, settings *wol_config.Config, logger *wol_log.Logger) {
+	in := bufio.NewReader(os.Stdin)
+
+	wol_i18n.Println("wol-server setup")
+	wol_i18n.Println("================")
+	wol_i18n.Println("Press Enter to accept the [default] answer.")
+	fmt.Println()
+
+	if settings.Exists() && !confirm(in, wol_i18n.T("Settings already exist at %s. Overwrite?", settings.Path()), false) {
+		wol_i18n.Println("Setup cancelled.")
+		return
+	}
+
+	// 1. Network interface
+	interfaces := detectInterfaces()
+	var selected *wizardInterface
+
+	if len(interfaces) == 0 {
+		wol_i18n.Println("⚠ No active IPv4 network interfaces found; the server will listen on all addresses.")
+		settings.ServerHost = "0.0.0.0"
+	} else {
+		wol_i18n.Println("Network interfaces:")
+		for i, iface := range interfaces {
+			wol_i18n.Printf("  %d) %-10s %-18s %s\n", i+1, iface.name, iface.subnet, iface.mac)
+		}
+		wol_i18n.Println("  0) all interfaces (0.0.0.0)")
+
+		choice := prompt(in, "Which interface should the API server listen on?", "1")
+		n, err := strconv.Atoi(choice)
+		switch {
+		case err == nil && n >= 1 && n <= len(interfaces):
+			selected = &interfaces[n-1]
+			settings.ServerHost = selected.ip.String()
+		default:
+			selected = &interfaces[0]
+			settings.ServerHost = "0.0.0.0"
+		}
+	}
+	fmt.Println()
+
+	// 2. Ports
+	settings.ServerPort = promptInt(in, "API server port", 8080)
+	settings.WoLPort = promptInt(in, "Wake-on-LAN UDP port", wol_network.DefaultWoLPort)
+	fmt.Println()
+
+	// 3. Devices
+	if selected != nil && confirm(in, wol_i18n.T("Scan %s for devices?", selected.subnet), true) {
+		wizardScan(in, store, selected, logger)
+	}
+
+	for confirm(in, "Add a device manually?", store.GetDeviceCount() == 0) {
+		name := prompt(in, "  Device name (blank to finish)", "")
+		if name == "" {
+			break
+		}
+		mac := prompt(in, "  MAC address", "")
+		ip := prompt(in, "  IP address (optional)", "")
+
+		if err := store.AddDevice(name, mac, "", ip, settings.WoLPort); err != nil {
+			wol_i18n.Printf("  ✗ %v\n", err)
+			continue
+		}
+		wol_i18n.Printf("  ✓ Added %s\n", name)
+		logger.Info("Init: Added device %s (%s)", name, mac)
+	}
+	fmt.Println()
+
+	// 4. API key
+	if confirm(in, "Generate an API key to protect the HTTP API?", true) {
+		key, err := wol_config.GenerateAPIKey()
+		if err != nil {
+			wol_i18n.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		settings.APIKey = key
+
+		fmt.Println()
+		wol_i18n.Println("API key (send as 'X-API-Key' or 'Authorization: Bearer' header):")
+		wol_i18n.Printf("  %s\n", key)
+		wol_i18n.Println("It is stored in the settings file; keep that file private.")
+	}
+	fmt.Println()
+
+	if err := settings.Save(); err != nil {
+		wol_i18n.Printf("Error: Failed to write settings: %v\n", err)
+		logger.Error("Init: Failed to write settings: %v", err)
+		os.Exit(1)
+	}
+	logger.Info("Init: Wrote settings to %s", settings.Path())
+
+	wol_i18n.Printf("✓ Settings written to %s\n", settings.Path())
+	wol_i18n.Printf("✓ %d device(s) configured\n", store.GetDeviceCount())
+	fmt.Println()
+	wol_i18n.Println("Start the server with:")
+	wol_i18n.Println("  wol-server -server")
+}
+
+func wizardScan(in *bufio.Reader, store *wol_device.DeviceStore, iface *wizardInterface, logger *wol_log.Logger) {
+	wol_i18n.Printf("Scanning %s, this takes a few seconds...\n", iface.subnet)
+
+	if err := wol_network.SweepSubnet(iface.subnet, 3*time.Second); err != nil {
+		wol_i18n.Printf("⚠ Scan failed: %v\n", err)
+		return
+	}
+
+	neighbors, err := wol_network.ReadNeighbors()
+	if err != nil {
+		wol_i18n.Printf("⚠ Could not read the neighbor table: %v\n", err)
+		return
+	}
+
+	var found []wol_network.Neighbor
+	for _, neighbor := range neighbors {
+		if _, err := store.FindByMAC(neighbor.MACAddress); err == nil {
+			continue
+		}
+		ip := net.ParseIP(neighbor.IPAddress)
+		if ip != nil && iface.subnet.Contains(ip) {
+			found = append(found, neighbor)
+		}
+	}
+
+	if len(found) == 0 {
+		wol_i18n.Println("No new devices found.")
+		return
+	}
+
+	wol_i18n.Printf("Found %d device(s). Enter a name to add one, or leave blank to skip.\n", len(found))
+	for _, neighbor := range found {
+		name := prompt(in, fmt.Sprintf("  %-15s %s", neighbor.IPAddress, neighbor.MACAddress), "")
+		if name == "" {
+			continue
+		}
+
+		if err := store.AddDevice(name, neighbor.MACAddress, "", neighbor.IPAddress, wol_network.DefaultWoLPort); err != nil {
+			wol_i18n.Printf("  ✗ %v\n", err)
+			continue
+		}
+		wol_i18n.Printf("  ✓ Added %s\n", name)
+		logger.Info("Init: Added device %s (%s)", name, neighbor.MACAddress)
+	}
+	fmt.Println()
+}
+
+func detectInterfaces() []wizardInterface {
+	interfaces, err := wol_network.ListInterfaces()
+	if err != nil {
+		return nil
+	}
+
+	var result []wizardInterface
+	for _, iface := range interfaces {
+		if iface.Loopback {
+			continue
+		}
+
+		for _, addr := range iface.Addresses {
+			ip := net.ParseIP(addr.IP)
+			_, subnet, err := net.ParseCIDR(addr.Subnet)
+			if ip.To4() == nil || err != nil {
+				continue
+			}
+
+			result = append(result, wizardInterface{
+				name:   iface.Name,
+				mac:    iface.MAC,
+				subnet: subnet,
+				ip:     ip,
+			})
+		}
+	}
+	return result
+}
+
+func prompt(in *bufio.Reader, question, def string) string {
+	question = wol_i18n.T(question)
+	if def != "" {
+		wol_i18n.Printf("%s [%s]: ", question, def)
+	} else {
+		wol_i18n.Printf("%s: ", question)
+	}
+
+	line, err := in.ReadString('\n')
+	if err != nil && line == "" {
+		// stdin closed; fall back to defaults rather than looping forever
+		fmt.Println()
+		return def
+	}
+
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return def
+	}
+	return line
+}
+
+func promptInt(in *bufio.Reader, question string, def int) int {
+	for {
+		answer := prompt(in, question, strconv.Itoa(def))
+		n, err := strconv.Atoi(answer)
+		if err == nil && n > 0 && n <= 65535 {
+			return n
+		}
+		wol_i18n.Println("  Please enter a port number between 1 and 65535.")
+	}
+}
+
+func confirm(in *bufio.Reader, question string, def bool) bool {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+
+	answer := strings.ToLower(prompt(in, fmt.Sprintf("%s (%s)", wol_i18n.T(question), hint), ""))
+	switch answer {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	default:
+		return def
+	}
+}
@@ -0,0 +1,161 @@
+package wol_auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+type Role string
+
+const (
+	RoleViewer   Role = "viewer"
+	RoleOperator Role = "operator"
+	RoleAdmin    Role = "admin"
+)
+
+var roleRank = map[Role]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
+// ErrNoCredentials is returned by a Provider when the request carries no
+// credentials it understands, so the next provider in the chain can try.
+var ErrNoCredentials = errors.New("no credentials provided")
+
+func ParseRole(role string) (Role, error) {
+	r := Role(strings.ToLower(strings.TrimSpace(role)))
+	if _, ok := roleRank[r]; !ok {
+		return "", fmt.Errorf("invalid role: %s (valid: viewer, operator, admin)", role)
+	}
+	return r, nil
+}
+
+// Allows reports whether r grants at least the permissions of required.
+func (r Role) Allows(required Role) bool {
+	return roleRank[r] >= roleRank[required]
+}
+
+type Identity struct {
+	Username string   `json:"username"`
+	Groups   []string `json:"groups,omitempty"`
+	Role     Role     `json:"role"`
+	Provider string   `json:"provider"`
+}
+
+type Provider interface {
+	Name() string
+	Authenticate(r *http.Request) (*Identity, error)
+}
+
+// RoleMapping maps identity-provider group names to roles. Users that match
+// no group receive DefaultRole; an empty DefaultRole denies access.
+type RoleMapping struct {
+	Groups      map[string]Role
+	DefaultRole Role
+}
+
+// ParseRoleMapping parses a comma-separated "group=role" list, e.g.
+// "wol-admins=admin,family=operator".
+func ParseRoleMapping(spec string, defaultRole string) (RoleMapping, error) {
+	mapping := RoleMapping{Groups: make(map[string]Role)}
+
+	if defaultRole != "" {
+		role, err := ParseRole(defaultRole)
+		if err != nil {
+			return mapping, err
+		}
+		mapping.DefaultRole = role
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		group, roleName, ok := strings.Cut(entry, "=")
+		if !ok {
+			return mapping, fmt.Errorf("invalid role mapping %q: expected group=role", entry)
+		}
+
+		role, err := ParseRole(roleName)
+		if err != nil {
+			return mapping, err
+		}
+		mapping.Groups[strings.TrimSpace(group)] = role
+	}
+
+	return mapping, nil
+}
+
+// Resolve returns the highest role granted by any of the given groups.
+func (m RoleMapping) Resolve(groups []string) (Role, bool) {
+	best := m.DefaultRole
+	for _, group := range groups {
+		if role, ok := m.Groups[group]; ok && roleRank[role] > roleRank[best] {
+			best = role
+		}
+	}
+	return best, best != ""
+}
+
+// Authenticator tries each configured provider in order and returns the
+// first identity that authenticates.
+type Authenticator struct {
+	providers []Provider
+}
+
+func NewAuthenticator(providers ...Provider) *Authenticator {
+	return &Authenticator{providers: providers}
+}
+
+func (a *Authenticator) AddProvider(provider Provider) {
+	a.providers = append(a.providers, provider)
+}
+
+// PrependProvider adds a provider that is tried before all the others.
+func (a *Authenticator) PrependProvider(provider Provider) {
+	a.providers = append([]Provider{provider}, a.providers...)
+}
+
+func (a *Authenticator) Enabled() bool {
+	return a != nil && len(a.providers) > 0
+}
+
+func (a *Authenticator) Authenticate(r *http.Request) (*Identity, error) {
+	for _, provider := range a.providers {
+		identity, err := provider.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", provider.Name(), err)
+		}
+		return identity, nil
+	}
+
+	return nil, ErrNoCredentials
+}
+
+type contextKey struct{}
+
+func WithIdentity(ctx context.Context, identity *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+func IdentityFromContext(ctx context.Context) (*Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(*Identity)
+	return identity, ok
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	if len(header) < 7 || !strings.EqualFold(header[:7], "Bearer ") {
+		return "", false
+	}
+	return strings.TrimSpace(header[7:]), true
+}
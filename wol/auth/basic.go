@@ -0,0 +1,148 @@
+package wol_auth
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// passwordCost is the bcrypt cost of new hashes
+	passwordCost  = 12
+	basicCacheTTL = time.Minute
+)
+
+// HashPassword hashes a password for BasicProvider with bcrypt. Passwords
+// longer than bcrypt's 72 bytes are rejected.
+func HashPassword(password string) (string, error) {
+	if password == "" {
+		return "", fmt.Errorf("password cannot be empty")
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// parsePasswordHash checks hash is a bcrypt one, the only kind accepted.
+func parsePasswordHash(hash string) ([]byte, error) {
+	if !strings.HasPrefix(hash, "$2") {
+		return nil, fmt.Errorf("unsupported password hash, expected a bcrypt hash")
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return nil, fmt.Errorf("invalid bcrypt password hash: %w", err)
+	}
+	return []byte(hash), nil
+}
+
+// User is a local account for BasicProvider.
+type User struct {
+	// PasswordHash is made by HashPassword
+	PasswordHash string
+	Role         Role
+}
+
+type basicUser struct {
+	hash []byte
+	role Role
+}
+
+// BasicProvider accepts HTTP Basic credentials checked against hashed
+// passwords. Each user has the role they were given. Usernames it does not
+// know are left to the next provider, such as LDAP.
+type BasicProvider struct {
+	users map[string]basicUser
+
+	// Hashing takes a noticeable fraction of a second by design, and
+	// browsers send the credentials with every request, so successful
+	// logins are remembered for a short while
+	mu    sync.Mutex
+	cache map[[32]byte]time.Time
+}
+
+// NewBasicProvider takes the users by username.
+func NewBasicProvider(users map[string]User) (*BasicProvider, error) {
+	provider := &BasicProvider{
+		users: make(map[string]basicUser),
+		cache: make(map[[32]byte]time.Time),
+	}
+	for username, user := range users {
+		if err := ValidateUsername(username); err != nil {
+			return nil, err
+		}
+		if _, ok := roleRank[user.Role]; !ok {
+			return nil, fmt.Errorf("user %s: invalid role %q", username, user.Role)
+		}
+		parsed, err := parsePasswordHash(user.PasswordHash)
+		if err != nil {
+			return nil, fmt.Errorf("user %s: %w", username, err)
+		}
+		provider.users[username] = basicUser{hash: parsed, role: user.Role}
+	}
+	return provider, nil
+}
+
+// ValidateUsername rejects names that cannot be sent with HTTP Basic auth.
+func ValidateUsername(username string) error {
+	if username == "" || strings.TrimSpace(username) != username || strings.Contains(username, ":") {
+		return fmt.Errorf("invalid username %q: must be non-empty without surrounding spaces or ':'", username)
+	}
+	return nil
+}
+
+func (p *BasicProvider) Name() string {
+	return "basic"
+}
+
+func (p *BasicProvider) Authenticate(r *http.Request) (*Identity, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	user, known := p.users[username]
+	if !known {
+		return nil, ErrNoCredentials
+	}
+	identity := &Identity{Username: username, Role: user.role, Provider: p.Name()}
+
+	cacheKey := sha256.Sum256([]byte(username + "\x00" + password))
+	p.mu.Lock()
+	expires, cached := p.cache[cacheKey]
+	if cached && !time.Now().Before(expires) {
+		delete(p.cache, cacheKey)
+		cached = false
+	}
+	p.mu.Unlock()
+	if cached {
+		return identity, nil
+	}
+
+	if bcrypt.CompareHashAndPassword(user.hash, []byte(password)) != nil {
+		return nil, fmt.Errorf("invalid username or password")
+	}
+
+	p.mu.Lock()
+	p.sweep()
+	p.cache[cacheKey] = time.Now().Add(basicCacheTTL)
+	p.mu.Unlock()
+
+	return identity, nil
+}
+
+// sweep drops the expired logins, such as those of a password since
+// changed, which are never looked up again. The caller holds p.mu.
+func (p *BasicProvider) sweep() {
+	now := time.Now()
+	for key, expires := range p.cache {
+		if !now.Before(expires) {
+			delete(p.cache, key)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package wol_auth
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// ClientCertProvider identifies requests by the TLS client certificate the
+// server has already verified against its client CA. The certificate's
+// common name is the username and its organizational units are the groups
+// the mapping resolves to a role.
+type ClientCertProvider struct {
+	mapping RoleMapping
+}
+
+func NewClientCertProvider(mapping RoleMapping) *ClientCertProvider {
+	return &ClientCertProvider{mapping: mapping}
+}
+
+func (p *ClientCertProvider) Name() string {
+	return "client-cert"
+}
+
+func (p *ClientCertProvider) Authenticate(r *http.Request) (*Identity, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	cert := r.TLS.VerifiedChains[0][0]
+	username := cert.Subject.CommonName
+	if username == "" {
+		username = cert.SerialNumber.String()
+	}
+	groups := cert.Subject.OrganizationalUnit
+
+	role, ok := p.mapping.Resolve(groups)
+	if !ok {
+		return nil, fmt.Errorf("certificate %s is not in any authorized group", username)
+	}
+
+	return &Identity{
+		Username: username,
+		Groups:   groups,
+		Role:     role,
+		Provider: p.Name(),
+	}, nil
+}
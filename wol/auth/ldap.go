@@ -0,0 +1,565 @@
+package wol_auth
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+type LDAPConfig struct {
+	URL            string
+	BindDN         string
+	BindPassword   string
+	BaseDN         string
+	UserAttribute  string
+	GroupAttribute string
+	Mapping        RoleMapping
+	Timeout        time.Duration
+	CacheTTL       time.Duration
+	TLSConfig      *tls.Config
+	// StartTLS upgrades an ldap:// connection to TLS before any
+	// credentials are sent
+	StartTLS bool
+}
+
+// LDAPProvider authenticates HTTP Basic credentials against an LDAP or
+// Active Directory server. The user entry is located with the service
+// account, then the user's own DN and password are verified with a bind.
+type LDAPProvider struct {
+	config LDAPConfig
+
+	mu    sync.Mutex
+	cache map[[32]byte]ldapCacheEntry
+}
+
+type ldapCacheEntry struct {
+	identity *Identity
+	expires  time.Time
+}
+
+func NewLDAPProvider(config LDAPConfig) (*LDAPProvider, error) {
+	if config.URL == "" {
+		return nil, fmt.Errorf("LDAP URL is required")
+	}
+	if config.BaseDN == "" {
+		return nil, fmt.Errorf("LDAP base DN is required")
+	}
+	if _, err := url.Parse(config.URL); err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %w", err)
+	}
+	if config.UserAttribute == "" {
+		config.UserAttribute = "uid"
+	}
+	if config.GroupAttribute == "" {
+		config.GroupAttribute = "memberOf"
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.CacheTTL == 0 {
+		config.CacheTTL = time.Minute
+	}
+
+	return &LDAPProvider{
+		config: config,
+		cache:  make(map[[32]byte]ldapCacheEntry),
+	}, nil
+}
+
+func (p *LDAPProvider) Name() string {
+	return "ldap"
+}
+
+func (p *LDAPProvider) Authenticate(r *http.Request) (*Identity, error) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return nil, ErrNoCredentials
+	}
+	// An empty password would be an unauthenticated bind, which most
+	// servers report as success
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("username and password are required")
+	}
+
+	cacheKey := sha256.Sum256([]byte(username + "\x00" + password))
+	p.mu.Lock()
+	entry, cached := p.cache[cacheKey]
+	if cached && !time.Now().Before(entry.expires) {
+		delete(p.cache, cacheKey)
+		cached = false
+	}
+	p.mu.Unlock()
+	if cached {
+		return entry.identity, nil
+	}
+
+	identity, err := p.authenticate(username, password)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	p.sweep()
+	p.cache[cacheKey] = ldapCacheEntry{identity: identity, expires: time.Now().Add(p.config.CacheTTL)}
+	p.mu.Unlock()
+
+	return identity, nil
+}
+
+// sweep drops the expired logins, such as those of a password since
+// changed in the directory, which are never looked up again. The caller
+// holds p.mu.
+func (p *LDAPProvider) sweep() {
+	now := time.Now()
+	for key, entry := range p.cache {
+		if !now.Before(entry.expires) {
+			delete(p.cache, key)
+		}
+	}
+}
+
+func (p *LDAPProvider) authenticate(username, password string) (*Identity, error) {
+	conn, err := p.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.close()
+
+	if err := conn.bind(p.config.BindDN, p.config.BindPassword); err != nil {
+		return nil, fmt.Errorf("service bind failed: %w", err)
+	}
+
+	entries, err := conn.search(p.config.BaseDN, p.config.UserAttribute, username, []string{p.config.GroupAttribute})
+	if err != nil {
+		return nil, fmt.Errorf("user search failed: %w", err)
+	}
+	if len(entries) != 1 {
+		return nil, fmt.Errorf("invalid username or password")
+	}
+
+	if err := conn.bind(entries[0].dn, password); err != nil {
+		return nil, fmt.Errorf("invalid username or password")
+	}
+
+	var groups []string
+	for _, groupDN := range entries[0].attributes[strings.ToLower(p.config.GroupAttribute)] {
+		groups = append(groups, groupDN)
+		if cn := firstRDNValue(groupDN); cn != "" && cn != groupDN {
+			groups = append(groups, cn)
+		}
+	}
+
+	role, ok := p.config.Mapping.Resolve(groups)
+	if !ok {
+		return nil, fmt.Errorf("user %s is not in any authorized group", username)
+	}
+
+	return &Identity{
+		Username: username,
+		Groups:   groups,
+		Role:     role,
+		Provider: p.Name(),
+	}, nil
+}
+
+func (p *LDAPProvider) dial() (*ldapConn, error) {
+	u, err := url.Parse(p.config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid LDAP URL: %w", err)
+	}
+
+	host := u.Host
+	dialer := &net.Dialer{Timeout: p.config.Timeout}
+
+	var conn net.Conn
+	switch u.Scheme {
+	case "ldaps":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, p.tlsConfig(u))
+	case "ldap":
+		if u.Port() == "" {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+		conn, err = dialer.Dial("tcp", host)
+	default:
+		return nil, fmt.Errorf("unsupported LDAP scheme: %s", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to LDAP server: %w", err)
+	}
+
+	conn.SetDeadline(time.Now().Add(p.config.Timeout))
+
+	c := &ldapConn{conn: conn, reader: bufio.NewReader(conn)}
+	if u.Scheme == "ldap" && p.config.StartTLS {
+		if err := c.startTLS(p.tlsConfig(u)); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("LDAP StartTLS failed: %w", err)
+		}
+	}
+	return c, nil
+}
+
+// tlsConfig returns the TLS configuration for the server at u, checking
+// its certificate against u's host name unless the configuration names
+// another.
+func (p *LDAPProvider) tlsConfig(u *url.URL) *tls.Config {
+	if p.config.TLSConfig == nil {
+		return &tls.Config{ServerName: u.Hostname()}
+	}
+	config := p.config.TLSConfig.Clone()
+	if config.ServerName == "" {
+		config.ServerName = u.Hostname()
+	}
+	return config
+}
+
+func firstRDNValue(dn string) string {
+	rdn, _, _ := strings.Cut(dn, ",")
+	_, value, ok := strings.Cut(rdn, "=")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
+
+// ldapConn is a minimal LDAPv3 client implementing just simple bind and
+// equality search, which is all the provider needs.
+type ldapConn struct {
+	conn      net.Conn
+	reader    *bufio.Reader
+	messageID int
+}
+
+type ldapEntry struct {
+	dn         string
+	attributes map[string][]string
+}
+
+const (
+	ldapTagBindRequest    = 0x60
+	ldapTagBindResponse   = 0x61
+	ldapTagUnbindRequest  = 0x42
+	ldapTagSearchRequest  = 0x63
+	ldapTagSearchEntry    = 0x64
+	ldapTagSearchDone     = 0x65
+	ldapTagSearchRef      = 0x73
+	ldapTagExtendedReq    = 0x77
+	ldapTagExtendedResp   = 0x78
+	ldapTagExtendedName   = 0x80
+	ldapTagSimpleAuth     = 0x80
+	ldapTagEqualityFilter = 0xA3
+
+	berTagInteger     = 0x02
+	berTagOctetString = 0x04
+	berTagEnumerated  = 0x0A
+	berTagBoolean     = 0x01
+	berTagSequence    = 0x30
+
+	// ldapStartTLSOID names the StartTLS extended operation (RFC 4511)
+	ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+	// maxBERLength caps the length of one BER element, which comes from
+	// the server, so a bad or hostile one cannot make us allocate
+	// gigabytes. Real responses are a few kilobytes.
+	maxBERLength = 4 << 20
+)
+
+func (c *ldapConn) close() {
+	c.send(berTLV(ldapTagUnbindRequest, nil))
+	c.conn.Close()
+}
+
+func (c *ldapConn) bind(dn, password string) error {
+	op := berTLV(ldapTagBindRequest, concat(
+		berInt(berTagInteger, 3),
+		berTLV(berTagOctetString, []byte(dn)),
+		berTLV(ldapTagSimpleAuth, []byte(password)),
+	))
+
+	if err := c.send(op); err != nil {
+		return err
+	}
+
+	tag, content, err := c.receive()
+	if err != nil {
+		return err
+	}
+	if tag != ldapTagBindResponse {
+		return fmt.Errorf("unexpected LDAP response tag 0x%02x", tag)
+	}
+
+	return ldapResultError(content)
+}
+
+// startTLS asks the server to switch to TLS and does the handshake, after
+// which everything sent on c is encrypted.
+func (c *ldapConn) startTLS(config *tls.Config) error {
+	op := berTLV(ldapTagExtendedReq, berTLV(ldapTagExtendedName, []byte(ldapStartTLSOID)))
+	if err := c.send(op); err != nil {
+		return err
+	}
+
+	tag, content, err := c.receive()
+	if err != nil {
+		return err
+	}
+	if tag != ldapTagExtendedResp {
+		return fmt.Errorf("unexpected LDAP response tag 0x%02x", tag)
+	}
+	if err := ldapResultError(content); err != nil {
+		return err
+	}
+
+	conn := tls.Client(c.conn, config)
+	if err := conn.Handshake(); err != nil {
+		return err
+	}
+	c.conn = conn
+	c.reader = bufio.NewReader(conn)
+	return nil
+}
+
+func (c *ldapConn) search(baseDN, attribute, value string, attributes []string) ([]ldapEntry, error) {
+	var attrList []byte
+	for _, attr := range attributes {
+		attrList = append(attrList, berTLV(berTagOctetString, []byte(attr))...)
+	}
+
+	op := berTLV(ldapTagSearchRequest, concat(
+		berTLV(berTagOctetString, []byte(baseDN)),
+		berInt(berTagEnumerated, 2), // wholeSubtree
+		berInt(berTagEnumerated, 0), // neverDerefAliases
+		berInt(berTagInteger, 2),    // sizeLimit
+		berInt(berTagInteger, 10),   // timeLimit (seconds)
+		berTLV(berTagBoolean, []byte{0x00}),
+		berTLV(ldapTagEqualityFilter, concat(
+			berTLV(berTagOctetString, []byte(attribute)),
+			berTLV(berTagOctetString, []byte(value)),
+		)),
+		berTLV(berTagSequence, attrList),
+	))
+
+	if err := c.send(op); err != nil {
+		return nil, err
+	}
+
+	var entries []ldapEntry
+	for {
+		tag, content, err := c.receive()
+		if err != nil {
+			return nil, err
+		}
+
+		switch tag {
+		case ldapTagSearchEntry:
+			entry, err := parseSearchEntry(content)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case ldapTagSearchRef:
+			continue
+		case ldapTagSearchDone:
+			if err := ldapResultError(content); err != nil {
+				// sizeLimitExceeded means the filter is ambiguous
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, fmt.Errorf("unexpected LDAP response tag 0x%02x", tag)
+		}
+	}
+}
+
+func (c *ldapConn) send(op []byte) error {
+	c.messageID++
+	message := berTLV(berTagSequence, concat(berInt(berTagInteger, c.messageID), op))
+	_, err := c.conn.Write(message)
+	return err
+}
+
+// receive reads one LDAPMessage and returns its protocolOp tag and content.
+func (c *ldapConn) receive() (byte, []byte, error) {
+	tag, content, err := readTLV(c.reader)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read LDAP response: %w", err)
+	}
+	if tag != berTagSequence {
+		return 0, nil, fmt.Errorf("malformed LDAP message")
+	}
+
+	elements, err := parseElements(content)
+	if err != nil || len(elements) < 2 {
+		return 0, nil, fmt.Errorf("malformed LDAP message")
+	}
+
+	return elements[1].tag, elements[1].content, nil
+}
+
+func parseSearchEntry(content []byte) (ldapEntry, error) {
+	entry := ldapEntry{attributes: make(map[string][]string)}
+
+	elements, err := parseElements(content)
+	if err != nil || len(elements) < 2 {
+		return entry, fmt.Errorf("malformed LDAP search entry")
+	}
+	entry.dn = string(elements[0].content)
+
+	attrs, err := parseElements(elements[1].content)
+	if err != nil {
+		return entry, fmt.Errorf("malformed LDAP attribute list")
+	}
+
+	for _, attr := range attrs {
+		parts, err := parseElements(attr.content)
+		if err != nil || len(parts) < 2 {
+			continue
+		}
+
+		values, err := parseElements(parts[1].content)
+		if err != nil {
+			continue
+		}
+
+		name := strings.ToLower(string(parts[0].content))
+		for _, value := range values {
+			entry.attributes[name] = append(entry.attributes[name], string(value.content))
+		}
+	}
+
+	return entry, nil
+}
+
+func ldapResultError(content []byte) error {
+	elements, err := parseElements(content)
+	if err != nil || len(elements) < 3 {
+		return fmt.Errorf("malformed LDAP result")
+	}
+
+	code := 0
+	for _, b := range elements[0].content {
+		code = code<<8 | int(b)
+	}
+	if code == 0 {
+		return nil
+	}
+
+	message := string(elements[2].content)
+	if message == "" {
+		message = "no diagnostic message"
+	}
+	return fmt.Errorf("LDAP result code %d: %s", code, message)
+}
+
+type berElement struct {
+	tag     byte
+	content []byte
+}
+
+func berTLV(tag byte, content []byte) []byte {
+	length := len(content)
+	out := []byte{tag}
+
+	switch {
+	case length < 0x80:
+		out = append(out, byte(length))
+	case length <= 0xFF:
+		out = append(out, 0x81, byte(length))
+	case length <= 0xFFFF:
+		out = append(out, 0x82, byte(length>>8), byte(length))
+	default:
+		out = append(out, 0x84, byte(length>>24), byte(length>>16), byte(length>>8), byte(length))
+	}
+
+	return append(out, content...)
+}
+
+func berInt(tag byte, value int) []byte {
+	var content []byte
+	for {
+		content = append([]byte{byte(value)}, content...)
+		value >>= 8
+		if value == 0 && content[0]&0x80 == 0 {
+			break
+		}
+	}
+	return berTLV(tag, content)
+}
+
+func concat(parts ...[]byte) []byte {
+	var out []byte
+	for _, part := range parts {
+		out = append(out, part...)
+	}
+	return out
+}
+
+type berReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+func readTLV(r berReader) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length := int(first)
+	if first&0x80 != 0 {
+		count := int(first & 0x7F)
+		if count == 0 || count > 4 {
+			return 0, nil, fmt.Errorf("unsupported BER length encoding")
+		}
+		length = 0
+		for i := 0; i < count; i++ {
+			b, err := r.ReadByte()
+			if err != nil {
+				return 0, nil, err
+			}
+			length = length<<8 | int(b)
+		}
+	}
+	if length > maxBERLength {
+		return 0, nil, fmt.Errorf("BER element of %d bytes is over the %d byte limit", length, maxBERLength)
+	}
+
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return 0, nil, err
+	}
+
+	return tag, content, nil
+}
+
+func parseElements(data []byte) ([]berElement, error) {
+	var elements []berElement
+	reader := bytes.NewReader(data)
+
+	for reader.Len() > 0 {
+		tag, content, err := readTLV(reader)
+		if err != nil {
+			return nil, err
+		}
+		elements = append(elements, berElement{tag: tag, content: content})
+	}
+
+	return elements, nil
+}
@@ -0,0 +1,372 @@
+package wol_auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type OIDCConfig struct {
+	IssuerURL     string
+	ClientID      string
+	UsernameClaim string
+	GroupsClaim   string
+	Mapping       RoleMapping
+	HTTPClient    *http.Client
+}
+
+// OIDCProvider authenticates requests carrying an ID or access token issued
+// by an OpenID Connect provider as "Authorization: Bearer <jwt>". Tokens are
+// verified against the issuer's published JWKS.
+type OIDCProvider struct {
+	config  OIDCConfig
+	client  *http.Client
+	jwksURI string
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer  string `json:"issuer"`
+	JWKSURI string `json:"jwks_uri"`
+}
+
+type jsonWebKey struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+const jwksMinRefresh = time.Minute
+
+func NewOIDCProvider(config OIDCConfig) (*OIDCProvider, error) {
+	if config.IssuerURL == "" {
+		return nil, fmt.Errorf("OIDC issuer URL is required")
+	}
+	if config.ClientID == "" {
+		return nil, fmt.Errorf("OIDC client ID is required")
+	}
+	if config.UsernameClaim == "" {
+		config.UsernameClaim = "preferred_username"
+	}
+	if config.GroupsClaim == "" {
+		config.GroupsClaim = "groups"
+	}
+
+	client := config.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	provider := &OIDCProvider{
+		config: config,
+		client: client,
+		keys:   make(map[string]crypto.PublicKey),
+	}
+
+	discoveryURL := strings.TrimSuffix(config.IssuerURL, "/") + "/.well-known/openid-configuration"
+	var discovery oidcDiscovery
+	if err := provider.getJSON(discoveryURL, &discovery); err != nil {
+		return nil, fmt.Errorf("failed to fetch OIDC discovery document: %w", err)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("OIDC discovery document has no jwks_uri")
+	}
+	if discovery.Issuer != "" && discovery.Issuer != config.IssuerURL {
+		return nil, fmt.Errorf("OIDC issuer mismatch: configured %s, discovered %s", config.IssuerURL, discovery.Issuer)
+	}
+	provider.jwksURI = discovery.JWKSURI
+
+	if err := provider.refreshKeys(); err != nil {
+		return nil, err
+	}
+
+	return provider, nil
+}
+
+func (p *OIDCProvider) Name() string {
+	return "oidc"
+}
+
+func (p *OIDCProvider) Authenticate(r *http.Request) (*Identity, error) {
+	token, ok := bearerToken(r)
+	if !ok || strings.Count(token, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+
+	claims, err := p.verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	username, _ := claims[p.config.UsernameClaim].(string)
+	if username == "" {
+		username, _ = claims["sub"].(string)
+	}
+
+	groups := claimStrings(claims[p.config.GroupsClaim])
+
+	role, ok := p.config.Mapping.Resolve(groups)
+	if !ok {
+		return nil, fmt.Errorf("user %s is not in any authorized group", username)
+	}
+
+	return &Identity{
+		Username: username,
+		Groups:   groups,
+		Role:     role,
+		Provider: p.Name(),
+	}, nil
+}
+
+func (p *OIDCProvider) verify(token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+
+	key, err := p.key(header.Kid)
+	if err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature encoding: %w", err)
+	}
+
+	if err := verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+
+	if iss, _ := claims["iss"].(string); iss != p.config.IssuerURL {
+		return nil, fmt.Errorf("token issuer %q does not match %q", iss, p.config.IssuerURL)
+	}
+
+	if !containsString(claimStrings(claims["aud"]), p.config.ClientID) {
+		return nil, fmt.Errorf("token audience does not include %s", p.config.ClientID)
+	}
+
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); !ok || now.After(time.Unix(int64(exp), 0)) {
+		return nil, fmt.Errorf("token has expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Before(time.Unix(int64(nbf), 0)) {
+		return nil, fmt.Errorf("token is not valid yet")
+	}
+
+	return claims, nil
+}
+
+func (p *OIDCProvider) key(kid string) (crypto.PublicKey, error) {
+	p.mu.RLock()
+	key, ok := p.keys[kid]
+	fetchedAt := p.fetchedAt
+	p.mu.RUnlock()
+
+	if ok {
+		return key, nil
+	}
+
+	// Unknown key ID usually means the IdP rotated its keys
+	if time.Since(fetchedAt) > jwksMinRefresh {
+		if err := p.refreshKeys(); err != nil {
+			return nil, err
+		}
+
+		p.mu.RLock()
+		key, ok = p.keys[kid]
+		p.mu.RUnlock()
+		if ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *OIDCProvider) refreshKeys() error {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(p.jwksURI, &jwks); err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := jwk.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	if len(keys) == 0 {
+		return fmt.Errorf("JWKS contains no usable signing keys")
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.fetchedAt = time.Now()
+	p.mu.Unlock()
+
+	return nil
+}
+
+func (p *OIDCProvider) getJSON(url string, v interface{}) error {
+	resp, err := p.client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d", url, resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
+
+func verifySignature(alg string, key crypto.PublicKey, signed, signature []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported token algorithm %q", alg)
+	}
+
+	h := hash.New()
+	h.Write(signed)
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(pub, hash, digest, signature); err != nil {
+			return fmt.Errorf("invalid token signature")
+		}
+		return nil
+	case *ecdsa.PublicKey:
+		if alg != "ES256" || len(signature) != 64 {
+			break
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return fmt.Errorf("invalid token signature")
+		}
+		return nil
+	}
+
+	return fmt.Errorf("token algorithm %s does not match signing key", alg)
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func claimStrings(claim interface{}) []string {
+	switch v := claim.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	default:
+		return nil
+	}
+}
+
+func containsString(values []string, target string) bool {
+	for _, v := range values {
+		if v == target {
+			return true
+		}
+	}
+	return false
+}
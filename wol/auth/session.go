@@ -0,0 +1,141 @@
+package wol_auth
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// sessionKeyID marks the tokens a SessionProvider issues, so it can tell
+// them from OIDC tokens, which are also JWTs sent as bearer tokens.
+const sessionKeyID = "wol-session"
+
+const DefaultSessionTTL = 12 * time.Hour
+
+// SessionProvider issues bearer tokens to users who have signed in another
+// way, so that browsers and scripts need not send a password with every
+// request. Tokens are HS256 JWTs carrying the user's role. By default they
+// are signed with a random key held only in memory, so restarting the
+// server signs everyone out, which is also how changes to users and roles
+// take effect. Servers given the same key with NewSessionProviderWithKey
+// accept each other's tokens, so sessions survive restarts and a
+// high-availability failover.
+type SessionProvider struct {
+	key []byte
+	ttl time.Duration
+}
+
+type sessionClaims struct {
+	Subject   string   `json:"sub"`
+	Role      Role     `json:"role"`
+	Groups    []string `json:"groups,omitempty"`
+	IssuedAt  int64    `json:"iat"`
+	ExpiresAt int64    `json:"exp"`
+}
+
+// MinSessionKeyLength is the shortest key NewSessionProviderWithKey takes.
+const MinSessionKeyLength = 32
+
+func NewSessionProvider(ttl time.Duration) (*SessionProvider, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("session lifetime must be positive")
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("failed to generate session key: %w", err)
+	}
+	return &SessionProvider{key: key, ttl: ttl}, nil
+}
+
+// NewSessionProviderWithKey signs tokens with key, which every server that
+// should accept them must share.
+func NewSessionProviderWithKey(key string, ttl time.Duration) (*SessionProvider, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("session lifetime must be positive")
+	}
+	if len(key) < MinSessionKeyLength {
+		return nil, fmt.Errorf("session key must be at least %d characters", MinSessionKeyLength)
+	}
+	return &SessionProvider{key: []byte(key), ttl: ttl}, nil
+}
+
+func (p *SessionProvider) Name() string {
+	return "session"
+}
+
+// Issue returns a token for identity and when it expires.
+func (p *SessionProvider) Issue(identity *Identity) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(p.ttl)
+
+	header, err := json.Marshal(map[string]string{"alg": "HS256", "typ": "JWT", "kid": sessionKeyID})
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	claims, err := json.Marshal(sessionClaims{
+		Subject:   identity.Username,
+		Role:      identity.Role,
+		Groups:    identity.Groups,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: expires.Unix(),
+	})
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("failed to marshal session claims: %w", err)
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(p.sign(signed)), expires, nil
+}
+
+func (p *SessionProvider) sign(signed string) []byte {
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write([]byte(signed))
+	return mac.Sum(nil)
+}
+
+func (p *SessionProvider) Authenticate(r *http.Request) (*Identity, error) {
+	token, ok := bearerToken(r)
+	if !ok || strings.Count(token, ".") != 2 {
+		return nil, ErrNoCredentials
+	}
+	parts := strings.Split(token, ".")
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Kid != sessionKeyID {
+		return nil, ErrNoCredentials
+	}
+	if header.Alg != "HS256" {
+		return nil, fmt.Errorf("unexpected session token algorithm %s", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, p.sign(parts[0]+"."+parts[1])) {
+		// Most likely issued before the server restarted
+		return nil, fmt.Errorf("invalid or expired session, sign in again")
+	}
+
+	var claims sessionClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid session claims: %w", err)
+	}
+	if time.Now().After(time.Unix(claims.ExpiresAt, 0)) {
+		return nil, fmt.Errorf("invalid or expired session, sign in again")
+	}
+
+	return &Identity{
+		Username: claims.Subject,
+		Groups:   claims.Groups,
+		Role:     claims.Role,
+		Provider: p.Name(),
+	}, nil
+}
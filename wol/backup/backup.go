@@ -0,0 +1,305 @@
+package wol_backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+	wol_device "wol-server/wol/device"
+)
+
+const (
+	DefaultKeep = 10
+
+	filePrefix   = "wol-backup-"
+	fileSuffix   = ".tar.gz"
+	timeLayout   = "20060102-150405.000"
+	manifestName = "manifest.json"
+	devicesName  = "devices.json"
+	formatV1     = 1
+)
+
+type Config struct {
+	// Dir is where Create writes archives
+	Dir string
+	// Keep is how many archives Create leaves in Dir, oldest removed
+	// first; 0 keeps them all
+	Keep int
+	// Files are other state files to include, such as the sites and
+	// settings files, by their name in the archive. Files that do not
+	// exist are left out.
+	Files map[string]string
+	// Key, if set, encrypts the devices and state files in archives Create
+	// writes, as it does the device file, and is needed to restore them
+	Key *wol_device.StoreKey
+}
+
+// Manifest describes an archive's contents.
+type Manifest struct {
+	Format    int       `json:"format"`
+	CreatedAt time.Time `json:"created_at"`
+	Devices   int       `json:"devices"`
+	Files     []string  `json:"files,omitempty"`
+	// Encrypted archives have every entry but the manifest sealed with
+	// the store key
+	Encrypted bool `json:"encrypted,omitempty"`
+}
+
+// Create writes a timestamped archive of the devices in store and the
+// state files in config to config.Dir, prunes old archives and returns the
+// new archive's path.
+func Create(config Config, store *wol_device.DeviceStore) (string, *Manifest, error) {
+	if err := os.MkdirAll(config.Dir, 0700); err != nil {
+		return "", nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// Archive names carry milliseconds; retry the rare one that is taken
+	var file *os.File
+	var createdAt time.Time
+	var err error
+	for attempt := 0; attempt < 5; attempt++ {
+		createdAt = time.Now()
+		path := filepath.Join(config.Dir, filePrefix+createdAt.UTC().Format(timeLayout)+fileSuffix)
+		file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if !errors.Is(err, os.ErrExist) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	manifest, err := write(file, createdAt, config, store)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(file.Name())
+		return "", nil, fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	if err := prune(config.Dir, config.Keep); err != nil {
+		return file.Name(), manifest, err
+	}
+	return file.Name(), manifest, nil
+}
+
+func write(w io.Writer, createdAt time.Time, config Config, store *wol_device.DeviceStore) (*Manifest, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	devices := store.Search(wol_device.Filter{Archive: wol_device.WithArchived})
+	devicesJSON, err := json.MarshalIndent(devices, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{Format: formatV1, CreatedAt: createdAt.UTC(), Devices: len(devices), Encrypted: config.Key != nil}
+	contents := map[string][]byte{devicesName: devicesJSON}
+
+	for _, name := range slices.Sorted(maps.Keys(config.Files)) {
+		data, err := os.ReadFile(config.Files[name])
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		manifest.Files = append(manifest.Files, name)
+		contents[name] = data
+	}
+
+	if config.Key != nil {
+		for name, data := range contents {
+			if contents[name], err = config.Key.Seal(data); err != nil {
+				return nil, fmt.Errorf("failed to encrypt %s: %w", name, err)
+			}
+		}
+	}
+
+	manifestJSON, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	entries := append([]string{manifestName, devicesName}, manifest.Files...)
+	contents[manifestName] = manifestJSON
+	for _, name := range entries {
+		header := &tar.Header{Name: name, Mode: 0600, Size: int64(len(contents[name])), ModTime: createdAt}
+		if err := tw.WriteHeader(header); err != nil {
+			return nil, err
+		}
+		if _, err := tw.Write(contents[name]); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, gz.Close()
+}
+
+// Restore replaces the devices in store with those in the archive at path
+// and writes the archive's state files back to their paths in
+// config.Files. Files the archive has but config does not name are
+// skipped.
+func Restore(path string, config Config, store *wol_device.DeviceStore) (*Manifest, error) {
+	manifest, devices, files, err := read(path, config.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.ReplaceDevices(devices); err != nil {
+		return nil, fmt.Errorf("failed to restore devices: %w", err)
+	}
+
+	for _, name := range manifest.Files {
+		target, ok := config.Files[name]
+		if !ok {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+		if err := os.WriteFile(target, files[name], 0600); err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", name, err)
+		}
+	}
+
+	return manifest, nil
+}
+
+// Inspect reads an archive's manifest, which is readable without the key
+// of an encrypted archive.
+func Inspect(path string) (*Manifest, error) {
+	manifest, _, err := readArchive(path)
+	return manifest, err
+}
+
+// read returns an archive's manifest, devices and the contents of its
+// entries, decrypted with key if the archive is encrypted.
+func read(path string, key *wol_device.StoreKey) (*Manifest, []*wol_device.Device, map[string][]byte, error) {
+	manifest, contents, err := readArchive(path)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if manifest.Encrypted {
+		if key == nil {
+			return nil, nil, nil, fmt.Errorf("backup is encrypted and no store key was given")
+		}
+		for _, name := range append([]string{devicesName}, manifest.Files...) {
+			data, ok := contents[name]
+			if !ok {
+				continue
+			}
+			if contents[name], err = key.Open(data); err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to decrypt %s in backup: %w", name, err)
+			}
+		}
+	}
+
+	var devices []*wol_device.Device
+	if err := json.Unmarshal(contents[devicesName], &devices); err != nil {
+		return nil, nil, nil, fmt.Errorf("backup has no valid device list: %w", err)
+	}
+	return manifest, devices, contents, nil
+}
+
+// readArchive returns an archive's manifest and the raw contents of its
+// entries, after checking that it has every entry the manifest lists.
+func readArchive(path string) (*Manifest, map[string][]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	tr := tar.NewReader(gz)
+
+	contents := make(map[string][]byte)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read backup: %w", err)
+		}
+		contents[header.Name] = data
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(contents[manifestName], &manifest); err != nil {
+		return nil, nil, fmt.Errorf("backup has no valid manifest: %w", err)
+	}
+	if manifest.Format != formatV1 {
+		return nil, nil, fmt.Errorf("unsupported backup format %d", manifest.Format)
+	}
+
+	for _, name := range manifest.Files {
+		if _, ok := contents[name]; !ok {
+			return nil, nil, fmt.Errorf("backup is missing %s", name)
+		}
+	}
+
+	return &manifest, contents, nil
+}
+
+// List returns the paths of the archives in dir, oldest first.
+func List(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var paths []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && strings.HasPrefix(name, filePrefix) && strings.HasSuffix(name, fileSuffix) {
+			paths = append(paths, filepath.Join(dir, name))
+		}
+	}
+	// The timestamp in the name sorts chronologically
+	slices.Sort(paths)
+	return paths, nil
+}
+
+func prune(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	paths, err := List(dir)
+	if err != nil {
+		return err
+	}
+	for len(paths) > keep {
+		if err := os.Remove(paths[0]); err != nil {
+			return fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		paths = paths[1:]
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package wol_backup
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	wol_device "wol-server/wol/device"
+)
+
+func newStore(t *testing.T, dir string) *wol_device.DeviceStore {
+	store, err := wol_device.NewDeviceStore(wol_device.DeviceConfig{ConfigPath: filepath.Join(dir, "devices.json")})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	return store
+}
+
+func TestCreateAndRestore(t *testing.T) {
+	oldHost := t.TempDir()
+	store := newStore(t, oldHost)
+	if err := store.AddDevice("desktop", "AA:BB:CC:DD:EE:01", "My PC", "192.168.1.10", 7); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+	if err := store.SetDeviceTags("desktop", []string{"office"}); err != nil {
+		t.Fatalf("Failed to tag device: %v", err)
+	}
+	sitesPath := filepath.Join(oldHost, "sites.json")
+	if err := os.WriteFile(sitesPath, []byte(`{"sites":{}}`), 0600); err != nil {
+		t.Fatalf("Failed to write sites file: %v", err)
+	}
+
+	config := Config{
+		Dir: filepath.Join(oldHost, "backups"),
+		Files: map[string]string{
+			"sites.json":  sitesPath,
+			"server.json": filepath.Join(oldHost, "server.json"),
+		},
+	}
+	path, manifest, err := Create(config, store)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if manifest.Devices != 1 || len(manifest.Files) != 1 || manifest.Files[0] != "sites.json" {
+		t.Errorf("Create() manifest = %+v, want 1 device and sites.json", manifest)
+	}
+
+	newHost := t.TempDir()
+	restored := newStore(t, newHost)
+	if err := restored.AddDevice("stale", "AA:BB:CC:DD:EE:02", "", "", 9); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+	config.Files = map[string]string{"sites.json": filepath.Join(newHost, "sites.json")}
+
+	if _, err := Restore(path, config, restored); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	if restored.DeviceExists("stale") {
+		t.Error("Restore() kept a device that is not in the backup")
+	}
+	device, err := restored.GetDevice("desktop")
+	if err != nil {
+		t.Fatalf("GetDevice() error = %v", err)
+	}
+	if device.Port != 7 || device.Description != "My PC" || len(device.Tags) != 1 {
+		t.Errorf("Restored device = %+v, want the backed up fields", device)
+	}
+	if data, err := os.ReadFile(filepath.Join(newHost, "sites.json")); err != nil || string(data) != `{"sites":{}}` {
+		t.Errorf("Restored sites file = %q, %v", data, err)
+	}
+}
+
+func TestCreate_Retention(t *testing.T) {
+	dir := t.TempDir()
+	store := newStore(t, dir)
+	config := Config{Dir: filepath.Join(dir, "backups"), Keep: 2}
+
+	var paths []string
+	for i := 0; i < 4; i++ {
+		path, _, err := Create(config, store)
+		if err != nil {
+			t.Fatalf("Create() error = %v", err)
+		}
+		paths = append(paths, path)
+	}
+
+	kept, err := List(config.Dir)
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(kept) != 2 || kept[0] != paths[2] || kept[1] != paths[3] {
+		t.Errorf("List() = %v, want the two newest of %v", kept, paths)
+	}
+}
+
+func TestRestore_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	store := newStore(t, dir)
+	if err := store.AddDevice("desktop", "AA:BB:CC:DD:EE:01", "", "", 9); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+
+	notArchive := filepath.Join(dir, "devices.json")
+	if _, err := Restore(notArchive, Config{}, store); err == nil {
+		t.Error("Restore() of a non-archive should fail")
+	}
+	if !store.DeviceExists("desktop") {
+		t.Error("Failed Restore() should leave the store unchanged")
+	}
+}
+
+func TestCreateAndRestore_Encrypted(t *testing.T) {
+	dir := t.TempDir()
+	key, err := wol_device.NewStoreKey(bytes.Repeat([]byte{7}, 32))
+	if err != nil {
+		t.Fatalf("NewStoreKey() error = %v", err)
+	}
+	store := newStore(t, dir)
+	if err := store.AddDevice("desktop", "AA:BB:CC:DD:EE:01", "", "", 9); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+	if err := store.SetDeviceSecureOn("desktop", "11:22:33:44:55:66"); err != nil {
+		t.Fatalf("Failed to set SecureOn password: %v", err)
+	}
+	sitesPath := filepath.Join(dir, "sites.json")
+	if err := os.WriteFile(sitesPath, []byte(`{"sites":{"remote":{"api_key":"secret"}}}`), 0600); err != nil {
+		t.Fatalf("Failed to write sites file: %v", err)
+	}
+
+	config := Config{Dir: filepath.Join(dir, "backups"), Files: map[string]string{"sites.json": sitesPath}, Key: key}
+	path, manifest, err := Create(config, store)
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if !manifest.Encrypted {
+		t.Error("Create() with a key wrote an unencrypted manifest")
+	}
+
+	// The archive is compressed, so look inside it for the secrets
+	_, contents, err := readArchive(path)
+	if err != nil {
+		t.Fatalf("readArchive() error = %v", err)
+	}
+	for name, data := range contents {
+		if bytes.Contains(data, []byte("11:22:33:44:55:66")) || bytes.Contains(data, []byte("secret")) {
+			t.Errorf("%s is stored in plain text", name)
+		}
+	}
+
+	if _, err := Inspect(path); err != nil {
+		t.Errorf("Inspect() without the key error = %v", err)
+	}
+	config.Key = nil
+	if _, err := Restore(path, config, store); err == nil {
+		t.Error("Restore() of an encrypted backup without the key should fail")
+	}
+
+	restoredDir := t.TempDir()
+	restored := newStore(t, restoredDir)
+	config.Key = key
+	config.Files = map[string]string{"sites.json": filepath.Join(restoredDir, "sites.json")}
+	if _, err := Restore(path, config, restored); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+	if device, err := restored.GetDevice("desktop"); err != nil || device.SecureOn == "" {
+		t.Errorf("Restored device = %+v, %v, want its SecureOn password", device, err)
+	}
+	if data, _ := os.ReadFile(config.Files["sites.json"]); !bytes.Contains(data, []byte("secret")) {
+		t.Errorf("Restored sites file = %q, want it decrypted", data)
+	}
+}
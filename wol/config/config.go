@@ -0,0 +1,144 @@
+package wol_config
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// Config holds settings that would otherwise have to be passed as flags
+// on every run. It is written by `wol-server init`; flags given on the
+// command line take precedence over it.
+type Config struct {
+	ServerHost string `json:"server_host,omitempty"`
+	ServerPort int    `json:"server_port,omitempty"`
+	WoLPort    int    `json:"wol_port,omitempty"`
+	APIKey     string `json:"api_key,omitempty"`
+	// SessionKey signs session tokens; servers sharing it accept each
+	// other's sessions
+	SessionKey string `json:"session_key,omitempty"`
+	MACStyle   string `json:"mac_style,omitempty"`
+	TLSCert    string `json:"tls_cert,omitempty"`
+	TLSKey     string `json:"tls_key,omitempty"`
+	// TLSClientCA requires client certificates signed by these CAs
+	TLSClientCA string `json:"tls_client_ca,omitempty"`
+	// Users are the local accounts for HTTP Basic auth, by username
+	Users map[string]*User `json:"users,omitempty"`
+	// Webhooks are POSTed wake and device status events
+	Webhooks []*Webhook `json:"webhooks,omitempty"`
+
+	path string
+}
+
+type User struct {
+	PasswordHash string `json:"password_hash"`
+	// Role is viewer, operator or admin
+	Role string `json:"role"`
+}
+
+type Webhook struct {
+	URL string `json:"url"`
+	// Secret signs deliveries with HMAC-SHA256
+	Secret string `json:"secret,omitempty"`
+	// Events limits the webhook to wake.success, wake.failure,
+	// device.online or device.offline; empty means all of them
+	Events []string `json:"events,omitempty"`
+}
+
+func DefaultConfigPath(deviceConfigPath string) string {
+	return filepath.Join(filepath.Dir(deviceConfigPath), "server.json")
+}
+
+// Load reads the config file at path. A missing file yields an empty
+// config rather than an error.
+func Load(path string) (*Config, error) {
+	config := &Config{path: path}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	return config, nil
+}
+
+func (c *Config) Path() string {
+	return c.path
+}
+
+func (c *Config) Exists() bool {
+	_, err := os.Stat(c.path)
+	return err == nil
+}
+
+func (c *Config) Save() error {
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(c, "", "	")
+	if err != nil {
+		return fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	// The API key is a credential, so keep the file private
+	if err := os.WriteFile(c.path, data, 0600); err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	return nil
+}
+
+// FlagValues returns the configured settings keyed by the name of the
+// command-line flag each one stands in for.
+func (c *Config) FlagValues() map[string]string {
+	values := make(map[string]string)
+	if c.ServerHost != "" {
+		values["server-host"] = c.ServerHost
+	}
+	if c.ServerPort != 0 {
+		values["server-port"] = strconv.Itoa(c.ServerPort)
+	}
+	if c.WoLPort != 0 {
+		values["port"] = strconv.Itoa(c.WoLPort)
+	}
+	if c.MACStyle != "" {
+		values["mac-style"] = c.MACStyle
+	}
+	if c.APIKey != "" {
+		values["api-key"] = c.APIKey
+	}
+	if c.SessionKey != "" {
+		values["session-key"] = c.SessionKey
+	}
+	if c.TLSCert != "" {
+		values["tls-cert"] = c.TLSCert
+	}
+	if c.TLSKey != "" {
+		values["tls-key"] = c.TLSKey
+	}
+	if c.TLSClientCA != "" {
+		values["tls-client-ca"] = c.TLSClientCA
+	}
+	return values
+}
+
+// GenerateAPIKey returns a random 256-bit key, hex encoded.
+func GenerateAPIKey() (string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate API key: %w", err)
+	}
+	return hex.EncodeToString(key), nil
+}
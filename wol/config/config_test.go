@@ -0,0 +1,95 @@
+package wol_config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name     string
+		content  string
+		wantErr  bool
+		wantPort int
+	}{
+		{"missing file", "", false, 0},
+		{"valid", `{"server_port": 9090, "api_key": "abc"}`, false, 9090},
+		{"invalid JSON", `{"server_port":`, true, 0},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.name, "server.json")
+			if tt.content != "" {
+				os.MkdirAll(filepath.Dir(path), 0755)
+				os.WriteFile(path, []byte(tt.content), 0600)
+			}
+
+			config, err := Load(path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("case %d: Load() error = %v, wantErr %v", i, err, tt.wantErr)
+			}
+			if !tt.wantErr && config.ServerPort != tt.wantPort {
+				t.Errorf("ServerPort = %d, want %d", config.ServerPort, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestConfig_SaveAndFlagValues(t *testing.T) {
+	path := DefaultConfigPath(filepath.Join(t.TempDir(), "devices.json"))
+
+	config, _ := Load(path)
+	if config.Exists() {
+		t.Fatal("Exists() = true before Save")
+	}
+
+	config.ServerHost = "192.168.1.5"
+	config.ServerPort = 8081
+	config.APIKey = "secret"
+	config.SessionKey = "shared"
+	config.TLSCert = "/etc/wol/cert.pem"
+	if err := config.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("config file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("config file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	reloaded, err := Load(path)
+	if err != nil || reloaded.APIKey != "secret" {
+		t.Fatalf("reloaded config = %+v, %v", reloaded, err)
+	}
+
+	values := reloaded.FlagValues()
+	if values["server-host"] != "192.168.1.5" || values["server-port"] != "8081" || values["api-key"] != "secret" || values["tls-cert"] != "/etc/wol/cert.pem" ||
+		values["session-key"] != "shared" {
+		t.Errorf("FlagValues() = %v", values)
+	}
+	if _, ok := values["port"]; ok {
+		t.Error("FlagValues() includes unset WoL port")
+	}
+}
+
+func TestGenerateAPIKey(t *testing.T) {
+	a, err := GenerateAPIKey()
+	if err != nil {
+		t.Fatalf("GenerateAPIKey() error = %v", err)
+	}
+	b, _ := GenerateAPIKey()
+
+	if len(a) != 64 {
+		t.Errorf("key length = %d, want 64", len(a))
+	}
+	if a == b {
+		t.Error("GenerateAPIKey() returned the same key twice")
+	}
+}
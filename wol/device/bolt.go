@@ -0,0 +1,206 @@
+package wol_device
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BackendBolt is the name of the BoltStore backend.
+const BackendBolt = "bolt"
+
+var devicesBucket = []byte("devices")
+
+// DefaultBoltPath is where the bolt backend keeps the devices for the
+// device file at deviceConfigPath: next to it, with a .db extension.
+func DefaultBoltPath(deviceConfigPath string) string {
+	return strings.TrimSuffix(deviceConfigPath, filepath.Ext(deviceConfigPath)) + ".db"
+}
+
+// BoltStore keeps devices in a bbolt database, one JSON record per device,
+// so a change only writes that device rather than the whole file. Only one
+// process can have the database open at a time.
+type BoltStore struct {
+	db *bolt.DB
+	// key encrypts each record; nil keeps them in plain text
+	key *StoreKey
+}
+
+func init() {
+	RegisterBackend(BackendBolt, func(config DeviceConfig) (Store, error) {
+		store, err := OpenBoltStore(DefaultBoltPath(config.ConfigPath), config.Key)
+		if err != nil {
+			return nil, err
+		}
+		// The first time, import the device file the database replaces
+		if _, err := MigrateEncryptedJSON(store, config.ConfigPath, config.Key); err != nil {
+			store.Close()
+			return nil, err
+		}
+		return store, nil
+	})
+}
+
+// OpenBoltStore opens or creates the database at path, encrypting the
+// devices with key unless it is nil.
+func OpenBoltStore(path string, key *StoreKey) (*BoltStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open device database %s (is another wol-server using it?): %w", path, err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(devicesBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to initialize device database: %w", err)
+	}
+	return &BoltStore{db: db, key: key}, nil
+}
+
+// encodeRecord marshals a device for a store that keeps one record per
+// device, sealing it with key unless it is nil.
+func encodeRecord(device *Device, key *StoreKey) ([]byte, error) {
+	data, err := json.Marshal(device)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal device '%s': %w", device.Name, err)
+	}
+	if key != nil {
+		if data, err = key.seal(data); err != nil {
+			return nil, fmt.Errorf("failed to encrypt device '%s': %w", device.Name, err)
+		}
+	}
+	return data, nil
+}
+
+// decodeRecord reads a record written by encodeRecord.
+func decodeRecord(data []byte, key *StoreKey) (*Device, error) {
+	if isEncrypted(data) {
+		if key == nil {
+			return nil, fmt.Errorf("device store is encrypted and no key was given")
+		}
+		var err error
+		if data, err = key.open(data); err != nil {
+			return nil, err
+		}
+	}
+
+	var device Device
+	if err := json.Unmarshal(data, &device); err != nil {
+		return nil, fmt.Errorf("failed to parse device record: %w", err)
+	}
+	return &device, nil
+}
+
+// put writes device, which must already exist or must not, as exists says.
+func (s *BoltStore) put(device *Device, exists bool) error {
+	data, err := encodeRecord(device, s.key)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(devicesBucket)
+		switch found := bucket.Get([]byte(device.Name)) != nil; {
+		case exists && !found:
+			return fmt.Errorf("device '%s' not found", device.Name)
+		case !exists && found:
+			return fmt.Errorf("device '%s' already exists", device.Name)
+		}
+		return bucket.Put([]byte(device.Name), data)
+	})
+}
+
+func (s *BoltStore) Add(device *Device) error {
+	return s.put(device, false)
+}
+
+func (s *BoltStore) Get(name string) (*Device, error) {
+	var device *Device
+	err := s.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(devicesBucket).Get([]byte(name))
+		if data == nil {
+			return fmt.Errorf("device '%s' not found", name)
+		}
+		var err error
+		device, err = decodeRecord(data, s.key)
+		return err
+	})
+	return device, err
+}
+
+// List returns the devices in key order, which is by name.
+func (s *BoltStore) List() ([]*Device, error) {
+	devices := []*Device{}
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(devicesBucket).ForEach(func(_, data []byte) error {
+			device, err := decodeRecord(data, s.key)
+			if err != nil {
+				return err
+			}
+			devices = append(devices, device)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+func (s *BoltStore) Remove(name string) error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(devicesBucket)
+		if bucket.Get([]byte(name)) == nil {
+			return fmt.Errorf("device '%s' not found", name)
+		}
+		return bucket.Delete([]byte(name))
+	})
+}
+
+func (s *BoltStore) Update(device *Device) error {
+	return s.put(device, true)
+}
+
+// Replace swaps every device for devices in one transaction.
+func (s *BoltStore) Replace(devices []*Device) error {
+	records := make([][]byte, len(devices))
+	for i, device := range devices {
+		data, err := encodeRecord(device, s.key)
+		if err != nil {
+			return err
+		}
+		records[i] = data
+	}
+
+	return s.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(devicesBucket); err != nil {
+			return err
+		}
+		bucket, err := tx.CreateBucket(devicesBucket)
+		if err != nil {
+			return err
+		}
+		for i, device := range devices {
+			if err := bucket.Put([]byte(device.Name), records[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Save does nothing: every change is committed as it is made.
+func (s *BoltStore) Save() error {
+	return nil
+}
+
+func (s *BoltStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,130 @@
+package wol_device
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+func TestBoltStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.db")
+	store, err := OpenBoltStore(path, nil)
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error = %v", err)
+	}
+
+	if err := store.Add(&Device{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := store.Add(&Device{Name: "desktop", MACAddress: "AA:BB:CC:DD:EE:02"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := store.Add(&Device{Name: "nas"}); err == nil {
+		t.Error("Add() accepted a duplicate name")
+	}
+	if err := store.Update(&Device{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01", Description: "Storage"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := store.Update(&Device{Name: "printer"}); err == nil {
+		t.Error("Update() accepted an unknown device")
+	}
+	if err := store.Remove("printer"); err == nil {
+		t.Error("Remove() accepted an unknown device")
+	}
+	store.Close()
+
+	reopened, err := OpenBoltStore(path, nil)
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error = %v", err)
+	}
+	defer reopened.Close()
+
+	devices, err := reopened.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(devices) != 2 || devices[0].Name != "desktop" || devices[1].Name != "nas" {
+		t.Fatalf("List() = %v, want desktop and nas", devices)
+	}
+	if nas, _ := reopened.Get("nas"); nas == nil || nas.Description != "Storage" {
+		t.Errorf("Get() = %+v, want the updated device", nas)
+	}
+
+	if err := reopened.Remove("nas"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := reopened.Get("nas"); err == nil {
+		t.Error("Get() found a removed device")
+	}
+
+	if err := reopened.Replace([]*Device{{Name: "printer", MACAddress: "AA:BB:CC:DD:EE:03"}}); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	if devices, _ := reopened.List(); len(devices) != 1 || devices[0].Name != "printer" {
+		t.Errorf("List() after Replace() = %v, want only printer", devices)
+	}
+}
+
+func TestBoltStore_Encrypted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.db")
+	key, err := NewPassphraseKey("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("NewPassphraseKey() error = %v", err)
+	}
+
+	store, err := OpenBoltStore(path, key)
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error = %v", err)
+	}
+	if err := store.Add(&Device{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01", SecureOn: "hunter2"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	store.db.View(func(tx *bolt.Tx) error {
+		if data := tx.Bucket(devicesBucket).Get([]byte("nas")); bytes.Contains(data, []byte("hunter2")) {
+			t.Error("device record is stored in plain text")
+		}
+		return nil
+	})
+	store.Close()
+
+	unkeyed, err := OpenBoltStore(path, nil)
+	if err != nil {
+		t.Fatalf("OpenBoltStore() error = %v", err)
+	}
+	defer unkeyed.Close()
+	if _, err := unkeyed.Get("nas"); err == nil {
+		t.Error("Get() read an encrypted device without the key")
+	}
+}
+
+func TestBoltBackend_MigratesDeviceFile(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "devices.json")
+	source, err := OpenFileStore(configPath)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error = %v", err)
+	}
+	source.Add(&Device{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01"})
+
+	store, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath, Backend: BackendBolt})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	if !store.DeviceExists("nas") {
+		t.Error("device file was not imported")
+	}
+	if err := store.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	if _, err := os.Stat(DefaultBoltPath(configPath)); err != nil {
+		t.Errorf("database was not created: %v", err)
+	}
+	if _, err := os.Stat(configPath + ".migrated"); err != nil {
+		t.Errorf("device file was not renamed: %v", err)
+	}
+}
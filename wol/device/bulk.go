@@ -0,0 +1,200 @@
+package wol_device
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// DeviceSpec describes one device for AddDevices.
+type DeviceSpec struct {
+	Name        string      `json:"name"`
+	MACAddress  string      `json:"mac"`
+	Description string      `json:"description,omitempty"`
+	IPAddress   string      `json:"ip_address,omitempty"`
+	Port        int         `json:"port,omitempty"`
+	Tags        []string    `json:"tags,omitempty"`
+	Policy      *WakePolicy `json:"policy,omitempty"`
+}
+
+type BulkMode string
+
+const (
+	// AllOrNothing adds no device unless every one can be added
+	AllOrNothing BulkMode = "all-or-nothing"
+	// BestEffort adds every device that can be added and reports the rest
+	BestEffort BulkMode = "best-effort"
+	// SkipExisting fails on an invalid device but skips, rather than fails
+	// on, one whose name or MAC address is already in use
+	SkipExisting BulkMode = "skip-existing"
+)
+
+func ParseBulkMode(mode string) (BulkMode, error) {
+	switch BulkMode(strings.ToLower(mode)) {
+	case "", AllOrNothing:
+		return AllOrNothing, nil
+	case BestEffort:
+		return BestEffort, nil
+	case SkipExisting:
+		return SkipExisting, nil
+	default:
+		return "", fmt.Errorf("unknown bulk mode: %s (valid: all-or-nothing, best-effort, skip-existing)", mode)
+	}
+}
+
+// BulkResult lists the devices AddDevices added and the entries it did not.
+type BulkResult struct {
+	Added  []string    `json:"added"`
+	Failed []BulkError `json:"failed,omitempty"`
+}
+
+// BulkError reports why the entry at Index was not added. Conflict is set
+// when its name or MAC address is already in use, by an existing device or
+// an earlier entry.
+type BulkError struct {
+	Index    int    `json:"index"`
+	Name     string `json:"name"`
+	Error    string `json:"error"`
+	Conflict bool   `json:"conflict,omitempty"`
+}
+
+// AddDevices validates and adds specs under one lock. Every entry is
+// checked before any device is added, so in AllOrNothing mode a failed
+// entry leaves the store unchanged; the error then says how many failed
+// and the result says which and why.
+func (ds *DeviceStore) AddDevices(specs []DeviceSpec, mode BulkMode) (*BulkResult, error) {
+	result := &BulkResult{Added: []string{}}
+
+	devices := make([]*Device, len(specs))
+	for i, spec := range specs {
+		device, err := ds.newDevice(spec.Name, spec.MACAddress, spec.Description, spec.IPAddress, spec.Port)
+		if err == nil && (spec.Port < 0 || spec.Port > 65535) {
+			err = fmt.Errorf("invalid port %d", spec.Port)
+		}
+		if err == nil && !spec.Policy.IsZero() {
+			err = spec.Policy.Validate()
+		}
+		if err != nil {
+			result.Failed = append(result.Failed, BulkError{Index: i, Name: spec.Name, Error: err.Error()})
+			continue
+		}
+		device.Tags = NormalizeTags(spec.Tags)
+		if !spec.Policy.IsZero() {
+			device.Policy = spec.Policy.clone()
+		}
+		devices[i] = device
+	}
+	if len(result.Failed) > 0 && mode != BestEffort {
+		return result, fmt.Errorf("%d of %d devices are invalid", len(result.Failed), len(specs))
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	existing, err := ds.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var add []*Device
+	var conflicts []BulkError
+	for i, device := range devices {
+		if device == nil {
+			continue
+		}
+		if err := conflict(existing, device); err != nil {
+			conflicts = append(conflicts, BulkError{Index: i, Name: device.Name, Error: err.Error(), Conflict: true})
+			continue
+		}
+		existing = append(existing, device)
+		add = append(add, device)
+	}
+	result.Failed = append(result.Failed, conflicts...)
+	sort.Slice(result.Failed, func(i, j int) bool {
+		return result.Failed[i].Index < result.Failed[j].Index
+	})
+	if len(conflicts) > 0 && mode == AllOrNothing {
+		return result, fmt.Errorf("%d of %d devices conflict with existing ones", len(conflicts), len(specs))
+	}
+
+	for _, device := range add {
+		if err := ds.store.Add(device); err != nil {
+			if mode == AllOrNothing {
+				// Take back what was added so the store is as it was
+				for _, name := range result.Added {
+					ds.store.Remove(name)
+				}
+				result.Added = []string{}
+			}
+			return result, fmt.Errorf("failed to add device %s: %w", device.Name, err)
+		}
+		result.Added = append(result.Added, device.Name)
+	}
+
+	return result, nil
+}
+
+// ReplaceDevices replaces every device in the store with devices, keeping
+// all of their fields. The devices are validated first, so an invalid list
+// leaves the store unchanged. A store that can replace its devices at once
+// does; otherwise a failure part way puts the old devices back.
+func (ds *DeviceStore) ReplaceDevices(devices []*Device) error {
+	replacement := make([]*Device, 0, len(devices))
+	for _, device := range devices {
+		name, err := validateName(device.Name)
+		if err != nil {
+			return err
+		}
+		checked, err := ds.newDevice(name, device.MACAddress, "", "", 0)
+		if err != nil {
+			return fmt.Errorf("device %s: %w", name, err)
+		}
+		if err := conflict(replacement, checked); err != nil {
+			return err
+		}
+
+		device = device.clone()
+		device.Name = checked.Name
+		device.MACAddress = checked.MACAddress
+		replacement = append(replacement, device)
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if replacer, ok := ds.store.(interface{ Replace(devices []*Device) error }); ok {
+		return replacer.Replace(replacement)
+	}
+
+	existing, err := ds.store.List()
+	if err != nil {
+		return err
+	}
+	if err := ds.swapDevices(replacement); err != nil {
+		if restoreErr := ds.swapDevices(existing); restoreErr != nil {
+			return fmt.Errorf("%w; restoring the old devices also failed: %v", err, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// swapDevices removes every device in the store, then adds devices one at
+// a time.
+func (ds *DeviceStore) swapDevices(devices []*Device) error {
+	current, err := ds.store.List()
+	if err != nil {
+		return err
+	}
+	for _, device := range current {
+		if err := ds.store.Remove(device.Name); err != nil {
+			return err
+		}
+	}
+	for _, device := range devices {
+		if err := ds.store.Add(device); err != nil {
+			return fmt.Errorf("failed to add device %s: %w", device.Name, err)
+		}
+	}
+	return nil
+}
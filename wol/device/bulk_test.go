@@ -0,0 +1,195 @@
+package wol_device
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestDeviceStore_AddDevices(t *testing.T) {
+	specs := []DeviceSpec{
+		{Name: "desktop", MACAddress: "AA:BB:CC:DD:EE:01", Tags: []string{"Office"}},
+		{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:02"},
+		{Name: "broken", MACAddress: "not-a-mac"},
+		{Name: "laptop", MACAddress: "00:11:22:33:44:55"},
+		{Name: "desktop", MACAddress: "AA:BB:CC:DD:EE:03"},
+	}
+
+	tests := []struct {
+		name       string
+		mode       BulkMode
+		specs      []DeviceSpec
+		wantErr    bool
+		wantAdded  []string
+		wantFailed []int
+	}{
+		{
+			name:      "all valid",
+			mode:      AllOrNothing,
+			specs:     specs[:2],
+			wantAdded: []string{"desktop", "nas"},
+		},
+		{
+			name:       "all or nothing with invalid entry",
+			mode:       AllOrNothing,
+			specs:      specs,
+			wantErr:    true,
+			wantAdded:  []string{},
+			wantFailed: []int{2},
+		},
+		{
+			name:       "all or nothing with conflicts",
+			mode:       AllOrNothing,
+			specs:      []DeviceSpec{specs[0], specs[3], specs[4]},
+			wantErr:    true,
+			wantAdded:  []string{},
+			wantFailed: []int{1, 2},
+		},
+		{
+			name:       "best effort",
+			mode:       BestEffort,
+			specs:      specs,
+			wantAdded:  []string{"desktop", "nas"},
+			wantFailed: []int{2, 3, 4},
+		},
+		{
+			name:       "skip existing",
+			mode:       SkipExisting,
+			specs:      []DeviceSpec{specs[0], specs[3], specs[4]},
+			wantAdded:  []string{"desktop"},
+			wantFailed: []int{1, 2},
+		},
+		{
+			name:       "skip existing with invalid entry",
+			mode:       SkipExisting,
+			specs:      specs,
+			wantErr:    true,
+			wantAdded:  []string{},
+			wantFailed: []int{2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := createTestStore(t)
+			if err := store.AddDevice("existing", "00:11:22:33:44:55", "", "", 9); err != nil {
+				t.Fatalf("Failed to add test device: %v", err)
+			}
+
+			result, err := store.AddDevices(tt.specs, tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("AddDevices() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(result.Added, tt.wantAdded) {
+				t.Errorf("AddDevices() added = %v, want %v", result.Added, tt.wantAdded)
+			}
+
+			var failed []int
+			for _, f := range result.Failed {
+				failed = append(failed, f.Index)
+			}
+			if !slices.Equal(failed, tt.wantFailed) {
+				t.Errorf("AddDevices() failed = %v, want %v", result.Failed, tt.wantFailed)
+			}
+
+			if want := 1 + len(tt.wantAdded); store.GetDeviceCount() != want {
+				t.Errorf("GetDeviceCount() = %d, want %d", store.GetDeviceCount(), want)
+			}
+		})
+	}
+}
+
+func TestDeviceStore_AddDevicesTags(t *testing.T) {
+	store := createTestStore(t)
+
+	if _, err := store.AddDevices([]DeviceSpec{{Name: "desktop", MACAddress: "AA:BB:CC:DD:EE:01", Tags: []string{"office", " Lab"}}}, AllOrNothing); err != nil {
+		t.Fatalf("AddDevices() error = %v", err)
+	}
+
+	device, _ := store.GetDevice("desktop")
+	if !slices.Equal(device.Tags, []string{"Lab", "office"}) {
+		t.Errorf("Device.Tags = %v, want [Lab office]", device.Tags)
+	}
+}
+
+func TestParseBulkMode(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    BulkMode
+		wantErr bool
+	}{
+		{"", AllOrNothing, false},
+		{"best-effort", BestEffort, false},
+		{"Skip-Existing", SkipExisting, false},
+		{"some", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBulkMode(tt.input)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseBulkMode(%q) = %q, %v; want %q, wantErr %v", tt.input, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestDeviceStore_ReplaceDevices(t *testing.T) {
+	store := createTestStore(t)
+	if err := store.AddDevice("old", "AA:BB:CC:DD:EE:01", "", "", 9); err != nil {
+		t.Fatalf("Failed to add test device: %v", err)
+	}
+
+	duplicate := []*Device{
+		{Name: "a", MACAddress: "AA:BB:CC:DD:EE:02"},
+		{Name: "b", MACAddress: "aa-bb-cc-dd-ee-02"},
+	}
+	if err := store.ReplaceDevices(duplicate); err == nil {
+		t.Error("ReplaceDevices() with a duplicate MAC should fail")
+	}
+	if !store.DeviceExists("old") {
+		t.Error("Failed ReplaceDevices() should leave the store unchanged")
+	}
+
+	replacement := []*Device{{Name: "new", MACAddress: "aa-bb-cc-dd-ee-03", Port: 7, Tags: []string{"lab"}}}
+	if err := store.ReplaceDevices(replacement); err != nil {
+		t.Fatalf("ReplaceDevices() error = %v", err)
+	}
+	if store.DeviceExists("old") || store.GetDeviceCount() != 1 {
+		t.Errorf("ReplaceDevices() left %d devices, want only new", store.GetDeviceCount())
+	}
+	device, _ := store.GetDevice("new")
+	if device.MACAddress != "AA:BB:CC:DD:EE:03" || device.Port != 7 || len(device.Tags) != 1 {
+		t.Errorf("Replaced device = %+v", device)
+	}
+}
+
+// addFailingStore is a Store that cannot add the device named fail.
+type addFailingStore struct {
+	memoryStore
+	fail string
+}
+
+func (a *addFailingStore) Add(device *Device) error {
+	if device.Name == a.fail {
+		return fmt.Errorf("connection reset")
+	}
+	return a.memoryStore.Add(device)
+}
+
+func TestDeviceStore_ReplaceDevicesRestores(t *testing.T) {
+	backend := &addFailingStore{memoryStore: memoryStore{devices: make(map[string]*Device)}, fail: "broken"}
+	store := NewDeviceStoreWith(backend, DeviceConfig{})
+	if err := store.AddDevice("old", "AA:BB:CC:DD:EE:01", "", "", 9); err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+
+	err := store.ReplaceDevices([]*Device{
+		{Name: "new", MACAddress: "AA:BB:CC:DD:EE:02"},
+		{Name: "broken", MACAddress: "AA:BB:CC:DD:EE:03"},
+	})
+	if err == nil {
+		t.Fatal("ReplaceDevices() should fail when the store fails")
+	}
+	if !store.DeviceExists("old") || store.DeviceExists("new") {
+		t.Errorf("failed ReplaceDevices() left %v, want only old", store.ListDevices())
+	}
+}
@@ -0,0 +1,135 @@
+package wol_device
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// CSVColumns are the columns ExportCSV writes and ImportCSV reads; tags are
+// separated by semicolons. The first row of an import must name its
+// columns; they may come in any order, name and mac_address are required
+// and unknown columns are ignored.
+var CSVColumns = []string{"name", "mac_address", "description", "ip_address", "port", "tags"}
+
+// ImportResult lists the devices an import added and the ones it skipped
+// because their name or MAC address was already in use.
+type ImportResult struct {
+	Added   []string
+	Skipped []ImportSkip
+}
+
+type ImportSkip struct {
+	Line   int
+	Name   string
+	Reason string
+}
+
+// ImportCSV adds the devices in r. Every row is validated before any device
+// is added, so an invalid row imports nothing. A row whose name or MAC
+// address matches an existing device, or an earlier row, is skipped rather
+// than overwriting it.
+func (ds *DeviceStore) ImportCSV(r io.Reader) (*ImportResult, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return &ImportResult{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %w", err)
+	}
+
+	columns := make(map[string]int)
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+	for _, required := range []string{"name", "mac_address"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %s column", required)
+		}
+	}
+
+	var specs []DeviceSpec
+	var lines []int
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		port := 0
+		if value := field("port"); value != "" {
+			if port, err = strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+				return nil, fmt.Errorf("line %d: invalid port %q", line, value)
+			}
+		}
+
+		specs = append(specs, DeviceSpec{
+			Name:        field("name"),
+			MACAddress:  field("mac_address"),
+			Description: field("description"),
+			IPAddress:   field("ip_address"),
+			Port:        port,
+			Tags:        strings.Split(field("tags"), ";"),
+		})
+		lines = append(lines, line)
+	}
+
+	added, err := ds.AddDevices(specs, SkipExisting)
+	if added == nil {
+		return nil, err
+	}
+	if err != nil && len(added.Failed) > 0 && !added.Failed[0].Conflict {
+		return nil, fmt.Errorf("line %d: %s", lines[added.Failed[0].Index], added.Failed[0].Error)
+	}
+
+	result := &ImportResult{Added: added.Added}
+	for _, failed := range added.Failed {
+		result.Skipped = append(result.Skipped, ImportSkip{Line: lines[failed.Index], Name: failed.Name, Reason: failed.Error})
+	}
+	return result, err
+}
+
+// ExportCSV writes every device to w as CSVColumns, with a header row.
+func (ds *DeviceStore) ExportCSV(w io.Writer) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(CSVColumns); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+
+	for _, device := range ds.ListDevices() {
+		record := []string{
+			device.Name,
+			device.MACAddress,
+			device.Description,
+			device.IPAddress,
+			strconv.Itoa(device.Port),
+			strings.Join(device.Tags, ";"),
+		}
+		if err := writer.Write(record); err != nil {
+			return fmt.Errorf("failed to write CSV: %w", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write CSV: %w", err)
+	}
+	return nil
+}
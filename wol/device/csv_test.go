@@ -0,0 +1,132 @@
+package wol_device
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDeviceStore_ImportCSV(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		wantErr     bool
+		wantAdded   []string
+		wantSkipped []string
+	}{
+		{
+			name:      "all columns",
+			input:     "name,mac_address,description,ip_address,port\ndesktop,aa-bb-cc-dd-ee-01,My PC,192.168.1.10,7\n",
+			wantAdded: []string{"desktop"},
+		},
+		{
+			name:      "reordered and extra columns",
+			input:     "Owner,MAC_Address,Name\nalice,AA:BB:CC:DD:EE:02,laptop\n",
+			wantAdded: []string{"laptop"},
+		},
+		{
+			name:        "duplicates skipped",
+			input:       "name,mac_address\nnas,AA:BB:CC:DD:EE:03\nother,00:11:22:33:44:55\nnew,AA:BB:CC:DD:EE:04\nnew,AA:BB:CC:DD:EE:05\n",
+			wantAdded:   []string{"new"},
+			wantSkipped: []string{"nas", "other", "new"},
+		},
+		{name: "empty", input: ""},
+		{name: "missing mac column", input: "name,ip_address\npc,10.0.0.1\n", wantErr: true},
+		{name: "invalid MAC", input: "name,mac_address\npc,not-a-mac\n", wantErr: true},
+		{name: "invalid port", input: "name,mac_address,port\npc,AA:BB:CC:DD:EE:06,http\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := createTestStore(t)
+			store.AddDevice("nas", "00:11:22:33:44:55", "", "", 9)
+
+			result, err := store.ImportCSV(strings.NewReader(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ImportCSV() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if count := store.GetDeviceCount(); count != 1 {
+					t.Errorf("failed import left %d devices, want 1", count)
+				}
+				return
+			}
+
+			if strings.Join(result.Added, ",") != strings.Join(tt.wantAdded, ",") {
+				t.Errorf("Added = %v, want %v", result.Added, tt.wantAdded)
+			}
+			var skipped []string
+			for _, skip := range result.Skipped {
+				skipped = append(skipped, skip.Name)
+			}
+			if strings.Join(skipped, ",") != strings.Join(tt.wantSkipped, ",") {
+				t.Errorf("Skipped = %v, want %v", skipped, tt.wantSkipped)
+			}
+		})
+	}
+}
+
+func TestDeviceStore_CSVRoundTrip(t *testing.T) {
+	store := createTestStore(t)
+	store.AddDevice("desktop", "AA:BB:CC:DD:EE:01", "Living room, by the TV", "192.168.1.10", 7)
+	store.AddDevice("nas", "AA:BB:CC:DD:EE:02", "", "", 0)
+
+	var buf bytes.Buffer
+	if err := store.ExportCSV(&buf); err != nil {
+		t.Fatalf("ExportCSV() error = %v", err)
+	}
+
+	imported := createTestStore(t)
+	result, err := imported.ImportCSV(&buf)
+	if err != nil {
+		t.Fatalf("ImportCSV() error = %v", err)
+	}
+	if len(result.Added) != 2 {
+		t.Fatalf("Added = %v, want 2 devices", result.Added)
+	}
+
+	device, _ := imported.GetDevice("desktop")
+	if device.Description != "Living room, by the TV" || device.IPAddress != "192.168.1.10" || device.Port != 7 {
+		t.Errorf("imported device = %+v", device)
+	}
+}
+
+func TestDeviceStore_ExportHomeAssistant(t *testing.T) {
+	store := createTestStore(t)
+	if err := store.AddDevice("desktop", "aa-bb-cc-dd-ee-01", "Gaming PC", "192.168.1.10", 9); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+	if err := store.AddDevice("nas", "AA:BB:CC:DD:EE:02", "", "", 7); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+	if err := store.SetDeviceBroadcastAddress("nas", "10.0.5.255"); err != nil {
+		t.Fatalf("Failed to set broadcast address: %v", err)
+	}
+	if err := store.AddDevice("old", "AA:BB:CC:DD:EE:03", "", "", 9); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+	if err := store.SetArchived("old", true); err != nil {
+		t.Fatalf("Failed to archive device: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := store.ExportHomeAssistant(&buf); err != nil {
+		t.Fatalf("ExportHomeAssistant() error = %v", err)
+	}
+
+	want := `# Generated by wol-server; paste into configuration.yaml
+switch:
+  - platform: wake_on_lan
+    name: "desktop"
+    mac: "AA:BB:CC:DD:EE:01"
+    host: "192.168.1.10"
+  - platform: wake_on_lan
+    name: "nas"
+    mac: "AA:BB:CC:DD:EE:02"
+    broadcast_address: "10.0.5.255"
+    broadcast_port: 7
+`
+	if buf.String() != want {
+		t.Errorf("ExportHomeAssistant() =\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -1,33 +1,123 @@
 package wol_device
 
 import (
-	"encoding/json"
 	"fmt"
+	"maps"
+	"net"
+	"net/url"
 	"os"
 	"path/filepath"
-	"sort"
+	"slices"
 	"strings"
+	"sync"
 	"time"
 	wol_packet "wol-server/wol/packet"
 )
 
 type Device struct {
-	Name        string    `json:"name"`
-	MACAddress  string    `json:"mac_address"`
-	Description string    `json:"description,omitempty"`
-	IPAddress   string    `json:"ip_address,omitempty"`
-	Port        int       `json:"port,omitempty"`
-	LastWoken   time.Time `json:"last_woken,omitempty"`
-	AddedAt     time.Time `json:"added_at"`
+	Name        string `json:"name"`
+	MACAddress  string `json:"mac_address"`
+	Description string `json:"description,omitempty"`
+	// Tags are free-form labels for finding and organizing devices
+	Tags []string `json:"tags,omitempty"`
+	// Metadata holds free-form details such as location, owner or asset tag
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	IPAddress string            `json:"ip_address,omitempty"`
+	Port      int               `json:"port,omitempty"`
+	Transport string            `json:"transport,omitempty"`
+	Site      string            `json:"site,omitempty"`
+	// Remote is the URL of another wol-server that wakes the device on its
+	// own LAN, with RemoteKey its API key
+	Remote    string       `json:"remote,omitempty"`
+	RemoteKey string       `json:"remote_key,omitempty"`
+	Power     *PowerConfig `json:"power,omitempty"`
+	Broadcast string       `json:"broadcast,omitempty"`
+	// BroadcastAddress and Interface replace the global broadcast address
+	// and sending interface for this device, for devices on other VLANs
+	BroadcastAddress string `json:"broadcast_address,omitempty"`
+	Interface        string `json:"interface,omitempty"`
+	// WakeAddress is a host[:port] the packet is sent to instead of being
+	// broadcast, for waking a device behind NAT from outside
+	WakeAddress string `json:"wake_address,omitempty"`
+	// VLAN tags raw Ethernet wake frames for this 802.1Q VLAN
+	VLAN      int         `json:"vlan,omitempty"`
+	SecureOn  string      `json:"secureon,omitempty"`
+	Policy    *WakePolicy `json:"policy,omitempty"`
+	LastWoken time.Time   `json:"last_woken,omitempty"`
+	// Status is whether the device answered its last reachability check,
+	// and LastSeen when it last did
+	Status   string    `json:"status,omitempty"`
+	LastSeen time.Time `json:"last_seen,omitempty"`
+	// Archived devices keep their record but are left out of listings and
+	// cannot be woken by name
+	Archived bool      `json:"archived,omitempty"`
+	AddedAt  time.Time `json:"added_at"`
 }
 
+const (
+	StatusOnline  = "online"
+	StatusOffline = "offline"
+	StatusUnknown = "unknown"
+)
+
+// PowerConfig gives a device out-of-band power control through its BMC or,
+// for a virtual machine, its hypervisor. In "fallback" mode the provider
+// powers the host on only if the magic packet did not; in "only" mode the
+// magic packet is skipped.
+type PowerConfig struct {
+	Provider string `json:"provider"`
+	Address  string `json:"address"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	SystemID string `json:"system_id,omitempty"`
+	Insecure bool   `json:"insecure,omitempty"`
+	Mode     string `json:"mode,omitempty"`
+}
+
+// DeviceStore validates devices and keeps them in a Store. It is safe for
+// concurrent use. The devices it returns are copies, so changing one does
+// not change the store.
 type DeviceStore struct {
-	Devices    map[string]*Device `json:"devices"`
-	configPath string
+	mu        sync.RWMutex
+	store     Store
+	macStyle  wol_packet.MACStyle
+	strictMAC bool
+	// seenSaved is when each device's LastSeen was last written out
+	seenSaved map[string]time.Time
+	// flushDelay, flushTimer and dirty batch the writes of volatile
+	// fields; see DeviceConfig.FlushDelay
+	flushDelay time.Duration
+	flushTimer *time.Timer
+	dirty      bool
+	// leader, if set, is asked before wake times, statuses and leases are
+	// written; see SetLeader
+	leader func() bool
 }
 
+// seenSaveInterval is how often a device that keeps being seen has its
+// LastSeen written out; in between it is only updated in memory, so
+// frequent checks don't rewrite the store every time.
+const seenSaveInterval = 5 * time.Minute
+
 type DeviceConfig struct {
 	ConfigPath string
+	// Backend names the Store devices are kept in (default BackendFile,
+	// the file at ConfigPath)
+	Backend string
+	// MACStyle is how device MAC addresses are stored and returned
+	MACStyle wol_packet.MACStyle
+	// StrictMAC rejects broadcast and multicast MAC addresses
+	StrictMAC bool
+	// URL is the server of backends that keep devices on one, such as
+	// redis://host:6379/0 for BackendRedis
+	URL string
+	// Key encrypts the device file; nil keeps it in plain text
+	Key *StoreKey
+	// FlushDelay batches the writes of wake times, statuses and last-seen
+	// times to a FileStore: they are kept in memory and written out
+	// together this long after the first one, or on Flush. 0 writes each
+	// one right away.
+	FlushDelay time.Duration
 }
 
 func DefaultDeviceConfig() DeviceConfig {
@@ -37,150 +127,1004 @@ func DefaultDeviceConfig() DeviceConfig {
 }
 
 func NewDeviceStore(config DeviceConfig) (*DeviceStore, error) {
-	store := &DeviceStore{
-		Devices:    make(map[string]*Device),
-		configPath: config.ConfigPath,
-	}
-
-	err := store.Load()
-	if err != nil && !os.IsNotExist(err) {
+	store, err := openBackend(config)
+	if err != nil {
 		return nil, fmt.Errorf("failed to load device store: %w", err)
 	}
+	return NewDeviceStoreWith(store, config), nil
+}
 
-	return store, nil
+// NewDeviceStoreWith uses an already opened store; config.ConfigPath and
+// config.Backend are ignored.
+func NewDeviceStoreWith(store Store, config DeviceConfig) *DeviceStore {
+	return &DeviceStore{
+		store:      store,
+		macStyle:   config.MACStyle,
+		strictMAC:  config.StrictMAC,
+		seenSaved:  make(map[string]time.Time),
+		flushDelay: config.FlushDelay,
+	}
 }
 
 func (ds *DeviceStore) AddDevice(name, macAddress, description, ipAddress string, port int) error {
-	name = strings.TrimSpace(name)
-	if name == "" {
-		return fmt.Errorf("device name cannot be empty")
-	}
+	return ds.CreateDevice(&Device{Name: name, MACAddress: macAddress, Description: description, IPAddress: ipAddress, Port: port})
+}
 
-	reservedNames := []string{"add-device", "list-devices", "remove-device", "show-device", "wake", "help"}
-	for _, reserved := range reservedNames {
-		if strings.ToLower(name) == reserved {
-			return fmt.Errorf("device name '%s' is reserved", name)
+// CreateDevice validates the settable fields of device and adds it in one
+// write, so an invalid field adds nothing. Its addresses are normalized as
+// the SetDevice* methods would; the broadcast mode and power configuration
+// are the caller's to check, as for SetDeviceBroadcast and SetDevicePower.
+// Its bookkeeping fields, from LastWoken to Archived, start afresh.
+func (ds *DeviceStore) CreateDevice(device *Device) error {
+	created, err := ds.newDevice(device.Name, device.MACAddress, device.Description, device.IPAddress, device.Port)
+	if err != nil {
+		return err
+	}
+	if device.Port < 0 || device.Port > 65535 {
+		return fmt.Errorf("invalid port %d", device.Port)
+	}
+	if device.VLAN < 0 || device.VLAN > 4094 {
+		return fmt.Errorf("invalid VLAN ID %d (expected 1-4094)", device.VLAN)
+	}
+	if device.SecureOn != "" {
+		if _, err := wol_packet.ParsePassword(device.SecureOn); err != nil {
+			return err
+		}
+	}
+	if created.Remote, err = NormalizeRemoteURL(device.Remote); err != nil {
+		return err
+	}
+	if created.Remote != "" {
+		created.RemoteKey = device.RemoteKey
+	}
+	if err := ValidateMetadata(device.Metadata); err != nil {
+		return err
+	}
+	mergeMetadata(created, device.Metadata)
+	if !device.Policy.IsZero() {
+		if err := device.Policy.Validate(); err != nil {
+			return err
 		}
+		created.Policy = device.Policy.clone()
+	}
+	if device.Power != nil {
+		power := *device.Power
+		created.Power = &power
 	}
+	created.Tags = NormalizeTags(device.Tags)
+	created.Site = strings.TrimSpace(device.Site)
+	created.WakeAddress = strings.TrimSpace(device.WakeAddress)
+	created.BroadcastAddress = strings.TrimSpace(device.BroadcastAddress)
+	created.Interface = strings.TrimSpace(device.Interface)
+	created.VLAN = device.VLAN
+	created.Broadcast = device.Broadcast
+	created.SecureOn = strings.TrimSpace(device.SecureOn)
+	created.Transport = strings.TrimSpace(device.Transport)
 
-	if err := wol_packet.ValidateMAC(macAddress); err != nil {
-		return fmt.Errorf("invalid MAC address: %w", err)
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	devices, err := ds.store.List()
+	if err != nil {
+		return err
+	}
+	if err := conflict(devices, created); err != nil {
+		return err
 	}
 
-	cleanMAC := wol_packet.CleanMAC(macAddress)
-	formattedMAC := fmt.Sprintf("%s:%s:%s:%s:%s:%s",
-		cleanMAC[0:2], cleanMAC[2:4], cleanMAC[4:6],
-		cleanMAC[6:8], cleanMAC[8:10], cleanMAC[10:12],
-	)
+	return ds.store.Add(created)
+}
 
-	if _, exists := ds.Devices[name]; exists {
-		return fmt.Errorf("device '%s' already exists", name)
+// newDevice validates a device's fields and returns it with its MAC address
+// in the store's style.
+func (ds *DeviceStore) newDevice(name, macAddress, description, ipAddress string, port int) (*Device, error) {
+	name, err := validateName(name)
+	if err != nil {
+		return nil, err
 	}
 
-	for existingName, device := range ds.Devices {
-		if wol_packet.CleanMAC(device.MACAddress) == cleanMAC {
-			return fmt.Errorf("MAC address %s is already used by device '%s'", formattedMAC, existingName)
-		}
+	validate := wol_packet.ValidateMAC
+	if ds.strictMAC {
+		validate = wol_packet.ValidateMACStrict
+	}
+	if err := validate(macAddress); err != nil {
+		return nil, fmt.Errorf("invalid MAC address: %w", err)
+	}
+
+	formattedMAC, err := wol_packet.FormatMAC(macAddress, ds.macStyle)
+	if err != nil {
+		return nil, fmt.Errorf("invalid MAC address: %w", err)
+	}
+
+	ipAddress = strings.TrimSpace(ipAddress)
+	if err := ValidateHost(ipAddress); err != nil {
+		return nil, err
 	}
 
 	if port == 0 {
 		port = 9
 	}
 
-	device := &Device{
+	return &Device{
 		Name:        name,
 		MACAddress:  formattedMAC,
 		Description: strings.TrimSpace(description),
-		IPAddress:   strings.TrimSpace(ipAddress),
+		IPAddress:   ipAddress,
 		Port:        port,
 		AddedAt:     time.Now(),
+	}, nil
+}
+
+// ReservedNames are the CLI's commands and their aliases. The CLI wakes
+// any other first argument as a device name, so a device named after a
+// command could never be woken from it. Keep it in step with main's
+// command switch.
+var ReservedNames = []string{
+	"init", "help",
+	"add-user", "remove-user", "list-users", "set-password", "set-role",
+	"add-device", "add", "list-devices", "list", "ls", "remove-device", "remove", "rm",
+	"archive-device", "archive", "unarchive-device", "unarchive", "show-device", "show",
+	"clone-device", "clone", "rename-device", "rename",
+	"save-template", "list-templates", "remove-template",
+	"import", "export", "import-arp", "gen-store-key", "backup", "restore",
+	"add-site", "list-sites", "remove-site", "set-site", "set-remote",
+	"set-secureon", "set-broadcast", "set-broadcast-address", "set-interface", "set-wake-address",
+	"set-vlan", "set-meta", "set-tags", "set-policy", "set-power", "power-status",
+	"wake", "verify-network", "net-info", "doctor", "discover", "find-servers", "lookup-mac",
+	"relay", "listen", "bench", "test-broadcast",
+}
+
+func validateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("device name cannot be empty")
 	}
 
-	ds.Devices[name] = device
+	if slices.Contains(ReservedNames, strings.ToLower(name)) {
+		return "", fmt.Errorf("device name '%s' is reserved", name)
+	}
+	return name, nil
+}
+
+// ValidateHost checks a device address: an IPv4 or IPv6 literal, optionally
+// with an IPv6 zone such as fe80::1%eth0, or an RFC 1123 host name such as
+// nas.local. An empty address is valid, since it is optional.
+func ValidateHost(host string) error {
+	if host == "" {
+		return nil
+	}
+
+	literal, zone, hasZone := strings.Cut(host, "%")
+	if ip := net.ParseIP(literal); ip != nil {
+		if hasZone && (ip.To4() != nil || zone == "") {
+			return fmt.Errorf("invalid IP address %q: only IPv6 addresses take a zone", host)
+		}
+		return nil
+	}
+	if hasZone || strings.Contains(host, ":") {
+		return fmt.Errorf("invalid IP address %q", host)
+	}
 
-	return ds.Save()
+	name := strings.TrimSuffix(host, ".")
+	if len(name) > 253 {
+		return fmt.Errorf("invalid host name %q: longer than 253 characters", host)
+	}
+	labels := strings.Split(name, ".")
+	for _, label := range labels {
+		switch {
+		case label == "":
+			return fmt.Errorf("invalid host name %q: empty label", host)
+		case len(label) > 63:
+			return fmt.Errorf("invalid host name %q: label %q is longer than 63 characters", host, label)
+		case label[0] == '-' || label[len(label)-1] == '-':
+			return fmt.Errorf("invalid host name %q: label %q starts or ends with a hyphen", host, label)
+		}
+		for _, c := range label {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+				return fmt.Errorf("invalid host name %q: %q is not allowed", host, c)
+			}
+		}
+	}
+	// A name of digits and dots is a mistyped IPv4 address, not a host
+	if last := labels[len(labels)-1]; strings.Trim(last, "0123456789") == "" {
+		return fmt.Errorf("invalid IP address %q", host)
+	}
+	return nil
+}
 
+// conflict reports whether device's name or MAC address is already used by
+// one of devices.
+func conflict(devices []*Device, device *Device) error {
+	cleanMAC := wol_packet.CleanMAC(device.MACAddress)
+	for _, existing := range devices {
+		if existing.Name == device.Name {
+			return fmt.Errorf("device '%s' already exists", device.Name)
+		}
+		if wol_packet.CleanMAC(existing.MACAddress) == cleanMAC {
+			return fmt.Errorf("MAC address %s is already used by device '%s'", device.MACAddress, existing.Name)
+		}
+	}
+	return nil
 }
 
 func (ds *DeviceStore) RemoveDevice(name string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.store.Remove(name)
+}
+
+// DeviceUpdate holds the fields UpdateDevice changes; nil fields are left
+// as they are.
+type DeviceUpdate struct {
+	MACAddress  *string
+	Description *string
+	IPAddress   *string
+	Port        *int
+	Site        *string
+	// Tags replaces the device's tags; an empty list removes them
+	Tags *[]string
+	// Metadata sets these keys, leaving the others; an empty value removes
+	// a key
+	Metadata map[string]string
+	// Remote replaces the remote URL, empty waking the device locally; a
+	// nil RemoteKey keeps the current key
+	Remote    *string
+	RemoteKey *string
+	// WakeAddress, BroadcastAddress and Interface replace the device's;
+	// empty uses the defaults again
+	WakeAddress      *string
+	BroadcastAddress *string
+	Interface        *string
+	// Power replaces the power control configuration; an empty provider
+	// removes it and an empty password keeps the current one
+	Power *PowerConfig
+	// Policy replaces the wake policy; an empty one removes it
+	Policy *WakePolicy
+}
+
+// UpdateDevice changes a device's fields in place in one write, keeping
+// everything else about it. Every field is validated first, so an invalid
+// one changes nothing.
+func (ds *DeviceStore) UpdateDevice(name string, fields DeviceUpdate) error {
+	var formattedMAC string
+	if fields.MACAddress != nil {
+		validate := wol_packet.ValidateMAC
+		if ds.strictMAC {
+			validate = wol_packet.ValidateMACStrict
+		}
+		if err := validate(*fields.MACAddress); err != nil {
+			return fmt.Errorf("invalid MAC address: %w", err)
+		}
+		var err error
+		if formattedMAC, err = wol_packet.FormatMAC(*fields.MACAddress, ds.macStyle); err != nil {
+			return fmt.Errorf("invalid MAC address: %w", err)
+		}
+	}
+	if fields.IPAddress != nil {
+		if err := ValidateHost(strings.TrimSpace(*fields.IPAddress)); err != nil {
+			return err
+		}
+	}
+	if fields.Port != nil && (*fields.Port < 1 || *fields.Port > 65535) {
+		return fmt.Errorf("invalid port %d", *fields.Port)
+	}
+	var remoteURL string
+	if fields.Remote != nil {
+		var err error
+		if remoteURL, err = NormalizeRemoteURL(*fields.Remote); err != nil {
+			return err
+		}
+	}
+	if err := ValidateMetadata(fields.Metadata); err != nil {
+		return err
+	}
+	policy := fields.Policy
+	if policy.IsZero() {
+		policy = nil
+	} else if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	device, err := ds.store.Get(name)
+	if err != nil {
+		return err
+	}
+	ds.format(device)
+
+	if fields.MACAddress != nil {
+		devices, err := ds.store.List()
+		if err != nil {
+			return err
+		}
+		others := slices.DeleteFunc(devices, func(d *Device) bool { return d.Name == name })
+		if err := conflict(others, &Device{MACAddress: formattedMAC}); err != nil {
+			return err
+		}
+		device.MACAddress = formattedMAC
+	}
+	if fields.Description != nil {
+		device.Description = strings.TrimSpace(*fields.Description)
+	}
+	if fields.IPAddress != nil {
+		device.IPAddress = strings.TrimSpace(*fields.IPAddress)
+	}
+	if fields.Port != nil {
+		device.Port = *fields.Port
+	}
+	if fields.Site != nil {
+		device.Site = strings.TrimSpace(*fields.Site)
+	}
+	if fields.Tags != nil {
+		device.Tags = NormalizeTags(*fields.Tags)
+	}
+	mergeMetadata(device, fields.Metadata)
+	if fields.Remote != nil {
+		device.Remote = remoteURL
+	}
+	if fields.RemoteKey != nil {
+		device.RemoteKey = *fields.RemoteKey
+	}
+	if device.Remote == "" {
+		device.RemoteKey = ""
+	}
+	if fields.WakeAddress != nil {
+		device.WakeAddress = strings.TrimSpace(*fields.WakeAddress)
+	}
+	if fields.BroadcastAddress != nil {
+		device.BroadcastAddress = strings.TrimSpace(*fields.BroadcastAddress)
+	}
+	if fields.Interface != nil {
+		device.Interface = strings.TrimSpace(*fields.Interface)
+	}
+	if fields.Power != nil {
+		if fields.Power.Provider == "" {
+			device.Power = nil
+		} else {
+			power := *fields.Power
+			if power.Password == "" && device.Power != nil {
+				power.Password = device.Power.Password
+			}
+			device.Power = &power
+		}
+	}
+	if fields.Policy != nil {
+		device.Policy = policy.clone()
+	}
 
-	if _, exists := ds.Devices[name]; !exists {
-		return fmt.Errorf("device '%s' not found", name)
+	return ds.store.Update(device)
+}
+
+// RenameDevice gives a device a new name, keeping everything else about it,
+// including when it was added and last woken.
+func (ds *DeviceStore) RenameDevice(oldName, newName string) error {
+	newName, err := validateName(newName)
+	if err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	device, err := ds.store.Get(oldName)
+	if err != nil {
+		return err
+	}
+	if newName == oldName {
+		return nil
+	}
+	if _, err := ds.store.Get(newName); err == nil {
+		return fmt.Errorf("device '%s' already exists", newName)
 	}
 
-	delete(ds.Devices, name)
-	return ds.Save()
+	device.Name = newName
+	if err := ds.store.Add(device); err != nil {
+		return err
+	}
+	if err := ds.store.Remove(oldName); err != nil {
+		ds.store.Remove(newName)
+		return err
+	}
+	return nil
 }
 
 func (ds *DeviceStore) GetDevice(name string) (*Device, error) {
-	device, exists := ds.Devices[name]
-	if !exists {
-		return nil, fmt.Errorf("device '%s' not found", name)
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	device, err := ds.store.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	return ds.format(device), nil
+}
+
+// FindByMAC returns the device with the given MAC address, in any notation.
+func (ds *DeviceStore) FindByMAC(macAddress string) (*Device, error) {
+	if err := wol_packet.ValidateMAC(macAddress); err != nil {
+		return nil, fmt.Errorf("invalid MAC address: %w", err)
 	}
+	cleanMAC := wol_packet.CleanMAC(macAddress)
 
-	return device, nil
+	for _, device := range ds.Search(Filter{Archive: WithArchived}) {
+		if wol_packet.CleanMAC(device.MACAddress) == cleanMAC {
+			return device, nil
+		}
+	}
+	return nil, fmt.Errorf("no device with MAC address %s", macAddress)
 }
 
-func (ds *DeviceStore) ListDevices() []*Device {
-	devices := make([]*Device, 0, len(ds.Devices))
-	for _, device := range ds.Devices {
-		devices = append(devices, device)
+// FindByIP returns the device whose configured address is ip. Devices
+// configured with a host name only match that name.
+func (ds *DeviceStore) FindByIP(ip string) (*Device, error) {
+	ip = strings.TrimSpace(ip)
+	if ip == "" {
+		return nil, fmt.Errorf("IP address cannot be empty")
 	}
+	parsed := net.ParseIP(ip)
 
-	sort.Slice(devices, func(i, j int) bool {
-		return devices[i].Name < devices[j].Name
-	})
+	for _, device := range ds.Search(Filter{Archive: WithArchived}) {
+		if parsed != nil && parsed.Equal(net.ParseIP(device.IPAddress)) {
+			return device, nil
+		}
+		if strings.EqualFold(device.IPAddress, ip) {
+			return device, nil
+		}
+	}
+	return nil, fmt.Errorf("no device with address %s", ip)
+}
 
-	return devices
+// ListDevices returns the devices carrying all of tags, or every device if
+// none are given, sorted by name, leaving out archived devices. It returns
+// none if the store cannot be read.
+func (ds *DeviceStore) ListDevices(tags ...string) []*Device {
+	return ds.Search(Filter{Tags: tags})
 }
 
-func (ds *DeviceStore) UpdateLastWoken(name string) error {
-	device, exists := ds.Devices[name]
-	if !exists {
-		return fmt.Errorf("device '%s' not found", name)
+// format rewrites the device's MAC address in the store's style, so a
+// file written with another style reads back consistently.
+func (ds *DeviceStore) format(device *Device) *Device {
+	if formatted, err := wol_packet.FormatMAC(device.MACAddress, ds.macStyle); err == nil {
+		device.MACAddress = formatted
+	}
+	if device.Status == "" {
+		device.Status = StatusUnknown
+	}
+	return device
+}
+
+// SetLeader has the store write wake times, statuses, last-seen times and
+// DHCP leases only while leader reports true. On a high-availability
+// standby they only go to a FileStore's memory, so the node never writes
+// over the shared store the leader owns.
+func (ds *DeviceStore) SetLeader(leader func() bool) {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	ds.leader = leader
+}
+
+// standby reports whether another node owns the store's writes. The
+// caller must hold ds.mu.
+func (ds *DeviceStore) standby() bool {
+	return ds.leader != nil && !ds.leader()
+}
+
+// modify applies change to the named device and stores the result.
+func (ds *DeviceStore) modify(name string, change func(device *Device) error) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	device, err := ds.store.Get(name)
+	if err != nil {
+		return err
+	}
+	if err := change(ds.format(device)); err != nil {
+		return err
 	}
+	return ds.store.Update(device)
+}
 
+func (ds *DeviceStore) UpdateLastWoken(name string) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	device, err := ds.store.Get(name)
+	if err != nil {
+		return err
+	}
 	device.LastWoken = time.Now()
-	return ds.Save()
+	return ds.updateVolatile(device)
 }
 
-func (ds *DeviceStore) DeviceExists(name string) bool {
-	_, exists := ds.Devices[name]
-	return exists
+// UpdateLease records that the device with the given MAC address currently
+// holds ipAddress. It returns the matching device (nil if no configured
+// device uses that MAC) and whether its IP address changed. The store is only
+// saved when the IP address changed.
+func (ds *DeviceStore) UpdateLease(macAddress, ipAddress string, seenAt time.Time) (*Device, bool, error) {
+	cleanMAC := wol_packet.CleanMAC(macAddress)
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	devices, err := ds.store.List()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, device := range devices {
+		if wol_packet.CleanMAC(device.MACAddress) != cleanMAC {
+			continue
+		}
+
+		if device.IPAddress == ipAddress {
+			if ds.seen(device, seenAt) {
+				return ds.format(device), false, ds.updateVolatile(device)
+			}
+			ds.touch(device)
+			return ds.format(device), false, nil
+		}
+
+		ds.seen(device, seenAt)
+		device.IPAddress = ipAddress
+		if ds.standby() {
+			ds.touch(device)
+			return ds.format(device), true, nil
+		}
+		return ds.format(device), true, ds.store.Update(device)
+	}
+
+	return nil, false, nil
 }
 
-func (ds *DeviceStore) GetDeviceCount() int {
-	return len(ds.Devices)
+// UpdateStatus records the outcome of a reachability check of the named
+// device; an online device is also marked seen at the given time. The store
+// is only saved when the status changed or LastSeen is due to be saved.
+func (ds *DeviceStore) UpdateStatus(name string, online bool, checkedAt time.Time) error {
+	status := StatusOffline
+	if online {
+		status = StatusOnline
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	device, err := ds.store.Get(name)
+	if err != nil {
+		return err
+	}
+	save := online && ds.seen(device, checkedAt)
+	if device.Status == status && !save {
+		ds.touch(device)
+		return nil
+	}
+	device.Status = status
+	return ds.updateVolatile(device)
 }
 
-func (ds *DeviceStore) Load() error {
-	data, err := os.ReadFile(ds.configPath)
+// MarkSeen records that the named device answered at seenAt, for checks
+// that find a device reachable outside of the status checker.
+func (ds *DeviceStore) MarkSeen(name string, seenAt time.Time) error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	device, err := ds.store.Get(name)
 	if err != nil {
 		return err
 	}
+	if ds.seen(device, seenAt) {
+		return ds.updateVolatile(device)
+	}
+	ds.touch(device)
+	return nil
+}
 
-	return json.Unmarshal(data, ds)
+// seen moves the device's LastSeen forward to seenAt and reports whether
+// it is due to be saved. The caller must hold ds.mu.
+func (ds *DeviceStore) seen(device *Device, seenAt time.Time) bool {
+	if !seenAt.After(device.LastSeen) {
+		return false
+	}
+	device.LastSeen = seenAt
+	if seenAt.Sub(ds.seenSaved[device.Name]) < seenSaveInterval {
+		return false
+	}
+	ds.seenSaved[device.Name] = seenAt
+	return true
 }
 
-func (ds *DeviceStore) Save() error {
-	configDir := filepath.Dir(ds.configPath)
-	if err := os.MkdirAll(configDir, 0755); err != nil {
-		return fmt.Errorf("failed to create config directory: %w", err)
+// updateVolatile stores a change to the device's wake time, status or
+// last-seen time, batched with others when a flush delay is set. On a
+// standby it is only kept in memory. The caller must hold ds.mu.
+func (ds *DeviceStore) updateVolatile(device *Device) error {
+	if ds.standby() {
+		ds.touch(device)
+		return nil
+	}
+	if _, ok := ds.store.(*FileStore); !ok || ds.flushDelay <= 0 {
+		return ds.store.Update(device)
+	}
+
+	ds.touch(device)
+	ds.dirty = true
+	if ds.flushTimer == nil {
+		// A failed flush leaves the store dirty, so the next change
+		// tries again
+		ds.flushTimer = time.AfterFunc(ds.flushDelay, func() { ds.Flush() })
+	}
+	return nil
+}
+
+// Flush writes out changes that are waiting for the flush delay. A node
+// that has lost leadership drops them instead, as the new leader owns the
+// store.
+func (ds *DeviceStore) Flush() error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	if ds.flushTimer != nil {
+		ds.flushTimer.Stop()
+		ds.flushTimer = nil
+	}
+	if ds.standby() {
+		ds.dirty = false
+	}
+	if !ds.dirty {
+		return nil
 	}
+	if err := ds.store.Save(); err != nil {
+		return fmt.Errorf("failed to flush device store: %w", err)
+	}
+	ds.dirty = false
+	return nil
+}
+
+// discardPending drops changes waiting for the flush delay, which a
+// reload has replaced. The caller must hold ds.mu.
+func (ds *DeviceStore) discardPending() {
+	if ds.flushTimer != nil {
+		ds.flushTimer.Stop()
+		ds.flushTimer = nil
+	}
+	ds.dirty = false
+}
+
+// touch updates device in a FileStore's memory without writing the file;
+// other stores only get it with the next change.
+func (ds *DeviceStore) touch(device *Device) {
+	if store, ok := ds.store.(*FileStore); ok {
+		store.Devices[device.Name] = device.clone()
+	}
+}
+
+// SetDeviceSite homes a device to a remote federation site; an empty site
+// wakes it locally again.
+func (ds *DeviceStore) SetDeviceSite(name, site string) error {
+	return ds.modify(name, func(device *Device) error {
+		device.Site = strings.TrimSpace(site)
+		return nil
+	})
+}
 
-	data, err := json.MarshalIndent(ds, "", "	")
+// SetDeviceRemote has the wol-server at remoteURL wake the device; an empty
+// URL wakes it locally again.
+func (ds *DeviceStore) SetDeviceRemote(name, remoteURL, apiKey string) error {
+	remoteURL, err := NormalizeRemoteURL(remoteURL)
 	if err != nil {
-		return fmt.Errorf("failed to marshal devices: %w", err)
+		return err
+	}
+	if remoteURL == "" {
+		apiKey = ""
+	}
+
+	return ds.modify(name, func(device *Device) error {
+		device.Remote = remoteURL
+		device.RemoteKey = apiKey
+		return nil
+	})
+}
+
+// NormalizeRemoteURL checks a remote wol-server URL and trims its trailing
+// slash.
+func NormalizeRemoteURL(remoteURL string) (string, error) {
+	remoteURL = strings.TrimSpace(remoteURL)
+	if remoteURL == "" {
+		return "", nil
+	}
+
+	u, err := url.Parse(remoteURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid remote URL: %s (expected http(s)://host[:port])", remoteURL)
+	}
+	return strings.TrimSuffix(u.String(), "/"), nil
+}
+
+// SetDeviceBroadcast sets how the device's wake packet is broadcast,
+// "limited", "directed" or "all"; empty uses the global setting.
+func (ds *DeviceStore) SetDeviceBroadcast(name, mode string) error {
+	return ds.modify(name, func(device *Device) error {
+		device.Broadcast = mode
+		return nil
+	})
+}
+
+// SetDeviceBroadcastAddress sends the device's wake packet to this
+// broadcast address; empty uses the one its broadcast mode picks.
+func (ds *DeviceStore) SetDeviceBroadcastAddress(name, address string) error {
+	return ds.modify(name, func(device *Device) error {
+		device.BroadcastAddress = strings.TrimSpace(address)
+		return nil
+	})
+}
+
+// SetDeviceInterface sends the device's wake packet from this network
+// interface; empty uses the global one.
+func (ds *DeviceStore) SetDeviceInterface(name, iface string) error {
+	return ds.modify(name, func(device *Device) error {
+		device.Interface = strings.TrimSpace(iface)
+		return nil
+	})
+}
+
+// SetDeviceWakeAddress sends the device's wake packet to address, a
+// host[:port], instead of broadcasting it; empty broadcasts it again.
+func (ds *DeviceStore) SetDeviceWakeAddress(name, address string) error {
+	return ds.modify(name, func(device *Device) error {
+		device.WakeAddress = strings.TrimSpace(address)
+		return nil
+	})
+}
+
+// SetDeviceVLAN sets the VLAN raw wake frames for the device are tagged
+// with; 0 sends them untagged.
+func (ds *DeviceStore) SetDeviceVLAN(name string, vlan int) error {
+	if vlan < 0 || vlan > 4094 {
+		return fmt.Errorf("invalid VLAN ID %d (expected 1-4094)", vlan)
 	}
 
-	err = os.WriteFile(ds.configPath, data, 0644)
+	return ds.modify(name, func(device *Device) error {
+		device.VLAN = vlan
+		return nil
+	})
+}
+
+// SetArchived archives the device, or restores an archived one.
+func (ds *DeviceStore) SetArchived(name string, archived bool) error {
+	return ds.modify(name, func(device *Device) error {
+		switch {
+		case archived && device.Archived:
+			return fmt.Errorf("device %s is already archived", name)
+		case !archived && !device.Archived:
+			return fmt.Errorf("device %s is not archived", name)
+		}
+		device.Archived = archived
+		return nil
+	})
+}
+
+// SetDeviceTags replaces the device's tags; none removes them all.
+func (ds *DeviceStore) SetDeviceTags(name string, tags []string) error {
+	return ds.modify(name, func(device *Device) error {
+		device.Tags = NormalizeTags(tags)
+		return nil
+	})
+}
+
+// SetDeviceMetadata sets the given metadata keys on the device; a key with
+// an empty value is removed.
+func (ds *DeviceStore) SetDeviceMetadata(name string, changes map[string]string) error {
+	if err := ValidateMetadata(changes); err != nil {
+		return err
+	}
+
+	return ds.modify(name, func(device *Device) error {
+		mergeMetadata(device, changes)
+		return nil
+	})
+}
+
+// mergeMetadata sets the given metadata keys on device, removing those
+// with an empty value.
+func mergeMetadata(device *Device, changes map[string]string) {
+	for key, value := range changes {
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if value == "" {
+			delete(device.Metadata, key)
+			continue
+		}
+		if device.Metadata == nil {
+			device.Metadata = make(map[string]string)
+		}
+		device.Metadata[key] = value
+	}
+	if len(device.Metadata) == 0 {
+		device.Metadata = nil
+	}
+}
+
+// ValidateMetadata checks metadata keys: they must not be empty, contain
+// '=' or white space, or be longer than 64 characters.
+func ValidateMetadata(metadata map[string]string) error {
+	for key := range metadata {
+		key = strings.TrimSpace(key)
+		switch {
+		case key == "":
+			return fmt.Errorf("metadata key cannot be empty")
+		case len(key) > 64:
+			return fmt.Errorf("metadata key %q is longer than 64 characters", key)
+		case strings.ContainsAny(key, "= \t\r\n"):
+			return fmt.Errorf("metadata key %q cannot contain '=' or white space", key)
+		}
+	}
+	return nil
+}
+
+// NormalizeTags trims tags and drops empty and repeated ones, ignoring
+// case, and sorts what is left.
+func NormalizeTags(tags []string) []string {
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || slices.ContainsFunc(normalized, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			continue
+		}
+		normalized = append(normalized, tag)
+	}
+
+	slices.SortFunc(normalized, func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+	return normalized
+}
+
+// HasTags reports whether the device carries every one of tags, ignoring
+// case.
+func (d *Device) HasTags(tags ...string) bool {
+	for _, tag := range tags {
+		if !slices.ContainsFunc(d.Tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// SecureOnPassword returns the device's SecureOn password as packet bytes,
+// or nil if it has none.
+func (d *Device) SecureOnPassword() ([]byte, error) {
+	if d.SecureOn == "" {
+		return nil, nil
+	}
+	password, err := wol_packet.ParsePassword(d.SecureOn)
 	if err != nil {
-		return fmt.Errorf("failed to write config file: %w", err)
+		return nil, fmt.Errorf("invalid SecureOn password for %s: %w", d.Name, err)
+	}
+	return password, nil
+}
+
+// SetDeviceSecureOn sets the password appended to the device's magic
+// packet; empty removes it.
+func (ds *DeviceStore) SetDeviceSecureOn(name, password string) error {
+	if password != "" {
+		if _, err := wol_packet.ParsePassword(password); err != nil {
+			return err
+		}
 	}
 
+	return ds.modify(name, func(device *Device) error {
+		device.SecureOn = strings.TrimSpace(password)
+		return nil
+	})
+}
+
+// SetDevicePower configures out-of-band power control for a device; nil removes it.
+func (ds *DeviceStore) SetDevicePower(name string, power *PowerConfig) error {
+	return ds.modify(name, func(device *Device) error {
+		device.Power = power
+		return nil
+	})
+}
+
+func (ds *DeviceStore) DeviceExists(name string) bool {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	_, err := ds.store.Get(name)
+	return err == nil
+}
+
+func (ds *DeviceStore) GetDeviceCount() int {
+	return len(ds.Search(Filter{Archive: WithArchived}))
+}
+
+// Check reads the store and returns how many devices it holds, archived
+// ones included, or why it cannot be read.
+func (ds *DeviceStore) Check() (int, error) {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	devices, err := ds.store.List()
+	if err != nil {
+		return 0, fmt.Errorf("failed to read device store: %w", err)
+	}
+	return len(devices), nil
+}
+
+// Reload picks up changes another process made to the store, for stores
+// that cache devices, such as FileStore.
+func (ds *DeviceStore) Reload() error {
+	reloader, ok := ds.store.(interface{ Reload() error })
+	if !ok {
+		return nil
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+	if err := reloader.Reload(); err != nil {
+		return err
+	}
+	ds.discardPending()
 	return nil
 }
 
+// ReloadIfChanged reloads the store if its backend can tell that another
+// process changed it, and reports whether it did.
+func (ds *DeviceStore) ReloadIfChanged() (bool, error) {
+	watched, ok := ds.store.(interface {
+		Changed() (bool, error)
+		Reload() error
+	})
+	if !ok {
+		return false, nil
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	changed, err := watched.Changed()
+	if err != nil || !changed {
+		return false, err
+	}
+	if err := watched.Reload(); err != nil {
+		return true, err
+	}
+	ds.discardPending()
+	return true, nil
+}
+
+func (ds *DeviceStore) Save() error {
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	return ds.store.Save()
+}
+
+// Close flushes pending changes and closes the store, for stores that hold
+// resources such as BoltStore's database file.
+func (ds *DeviceStore) Close() error {
+	err := ds.Flush()
+	if closer, ok := ds.store.(interface{ Close() error }); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// clone returns a copy of d that shares nothing with it.
+func (d *Device) clone() *Device {
+	c := *d
+	c.Tags = slices.Clone(d.Tags)
+	c.Metadata = maps.Clone(d.Metadata)
+	if d.Power != nil {
+		power := *d.Power
+		c.Power = &power
+	}
+	c.Policy = d.Policy.clone()
+	return &c
+}
+
 func getDefaultConfigPath() string {
 	configDir, err := os.UserConfigDir()
 	if err != nil {
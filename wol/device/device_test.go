@@ -2,10 +2,14 @@ package wol_device
 
 import (
 	"fmt"
+	"maps"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
+	wol_packet "wol-server/wol/packet"
 )
 
 func TestDefaultDeviceConfig(t *testing.T) {
@@ -38,16 +42,16 @@ func TestNewDeviceStore(t *testing.T) {
 		t.Fatal("NewDeviceStore() returned nil store")
 	}
 
-	if store.Devices == nil {
-		t.Error("DeviceStore.Devices should be initialized")
+	if count := store.GetDeviceCount(); count != 0 {
+		t.Errorf("New device store should be empty, got %d devices", count)
 	}
 
-	if len(store.Devices) != 0 {
-		t.Errorf("New device store should be empty, got %d devices", len(store.Devices))
+	fileStore, ok := store.store.(*FileStore)
+	if !ok {
+		t.Fatalf("DeviceStore.store = %T, want *FileStore", store.store)
 	}
-
-	if store.configPath != configPath {
-		t.Errorf("DeviceStore.configPath = %s, want %s", store.configPath, configPath)
+	if fileStore.path != configPath {
+		t.Errorf("FileStore.path = %s, want %s", fileStore.path, configPath)
 	}
 }
 
@@ -172,8 +176,8 @@ func TestDeviceStore_AddDevice(t *testing.T) {
 				}
 
 				// Verify device was added correctly
-				device, exists := store.Devices[tt.deviceName]
-				if !exists {
+				device, err := store.GetDevice(tt.deviceName)
+				if err != nil {
 					t.Errorf("Device %s was not added to store", tt.deviceName)
 					return
 				}
@@ -246,7 +250,7 @@ func TestDeviceStore_RemoveDevice(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			initialCount := len(store.Devices)
+			initialCount := store.GetDeviceCount()
 
 			err := store.RemoveDevice(tt.deviceName)
 
@@ -260,8 +264,8 @@ func TestDeviceStore_RemoveDevice(t *testing.T) {
 				}
 
 				// Verify count didn't change
-				if len(store.Devices) != initialCount {
-					t.Errorf("Device count changed after failed removal: was %d, now %d", initialCount, len(store.Devices))
+				if count := store.GetDeviceCount(); count != initialCount {
+					t.Errorf("Device count changed after failed removal: was %d, now %d", initialCount, count)
 				}
 			} else {
 				if err != nil {
@@ -270,13 +274,13 @@ func TestDeviceStore_RemoveDevice(t *testing.T) {
 				}
 
 				// Verify device was removed
-				if _, exists := store.Devices[tt.deviceName]; exists {
+				if store.DeviceExists(tt.deviceName) {
 					t.Errorf("Device %s still exists after removal", tt.deviceName)
 				}
 
 				// Verify count decreased
-				if len(store.Devices) != initialCount-1 {
-					t.Errorf("Device count should be %d after removal, got %d", initialCount-1, len(store.Devices))
+				if count := store.GetDeviceCount(); count != initialCount-1 {
+					t.Errorf("Device count should be %d after removal, got %d", initialCount-1, count)
 				}
 			}
 		})
@@ -642,3 +646,756 @@ func isValidMACFormat(mac string) bool {
 
 	return true
 }
+
+func TestDeviceStore_UpdateLease(t *testing.T) {
+	store := createTestStore(t)
+
+	err := store.AddDevice("desktop", "AA:BB:CC:DD:EE:FF", "", "192.168.1.10", 9)
+	if err != nil {
+		t.Fatalf("Failed to add test device: %v", err)
+	}
+
+	seenAt := time.Now()
+
+	device, changed, err := store.UpdateLease("aa-bb-cc-dd-ee-ff", "192.168.1.20", seenAt)
+	if err != nil {
+		t.Fatalf("UpdateLease() unexpected error = %v", err)
+	}
+	if device == nil || device.Name != "desktop" {
+		t.Fatalf("UpdateLease() device = %v, want desktop", device)
+	}
+	if !changed {
+		t.Error("UpdateLease() changed = false, want true for new IP")
+	}
+	if device.IPAddress != "192.168.1.20" {
+		t.Errorf("Device.IPAddress = %s, want 192.168.1.20", device.IPAddress)
+	}
+	if !device.LastSeen.Equal(seenAt) {
+		t.Errorf("Device.LastSeen = %v, want %v", device.LastSeen, seenAt)
+	}
+
+	_, changed, _ = store.UpdateLease("AA:BB:CC:DD:EE:FF", "192.168.1.20", seenAt)
+	if changed {
+		t.Error("UpdateLease() changed = true, want false for same IP")
+	}
+
+	device, changed, err = store.UpdateLease("11:22:33:44:55:66", "192.168.1.30", seenAt)
+	if err != nil || device != nil || changed {
+		t.Errorf("UpdateLease() for unknown MAC = (%v, %v, %v), want (nil, false, nil)", device, changed, err)
+	}
+}
+
+func TestDeviceStore_UpdateStatus(t *testing.T) {
+	store := createTestStore(t)
+
+	if err := store.AddDevice("desktop", "AA:BB:CC:DD:EE:FF", "", "192.168.1.10", 9); err != nil {
+		t.Fatalf("Failed to add test device: %v", err)
+	}
+
+	device, _ := store.GetDevice("desktop")
+	if device.Status != StatusUnknown {
+		t.Errorf("Device.Status = %q before any check, want %q", device.Status, StatusUnknown)
+	}
+
+	seenAt := time.Now()
+	if err := store.UpdateStatus("desktop", true, seenAt); err != nil {
+		t.Fatalf("UpdateStatus() unexpected error = %v", err)
+	}
+	device, _ = store.GetDevice("desktop")
+	if device.Status != StatusOnline || !device.LastSeen.Equal(seenAt) {
+		t.Errorf("Device = %s seen %v, want %s seen %v", device.Status, device.LastSeen, StatusOnline, seenAt)
+	}
+
+	if err := store.UpdateStatus("desktop", false, seenAt.Add(time.Minute)); err != nil {
+		t.Fatalf("UpdateStatus() unexpected error = %v", err)
+	}
+	device, _ = store.GetDevice("desktop")
+	if device.Status != StatusOffline || !device.LastSeen.Equal(seenAt) {
+		t.Errorf("Device = %s seen %v, want %s seen %v", device.Status, device.LastSeen, StatusOffline, seenAt)
+	}
+
+	if err := store.UpdateStatus("missing", true, seenAt); err == nil {
+		t.Error("UpdateStatus() for unknown device should fail")
+	}
+}
+
+func TestDeviceStore_MarkSeen(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "devices.json")
+	store, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	if err := store.AddDevice("desktop", "AA:BB:CC:DD:EE:FF", "", "192.168.1.10", 9); err != nil {
+		t.Fatalf("Failed to add test device: %v", err)
+	}
+
+	saved := func() time.Time {
+		reopened, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath})
+		if err != nil {
+			t.Fatalf("NewDeviceStore() error = %v", err)
+		}
+		device, _ := reopened.GetDevice("desktop")
+		return device.LastSeen
+	}
+
+	seenAt := time.Now()
+	if err := store.MarkSeen("desktop", seenAt); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+	if !saved().Equal(seenAt) {
+		t.Errorf("Saved LastSeen = %v, want %v after the first sighting", saved(), seenAt)
+	}
+
+	// Sightings shortly after are kept in memory only
+	if err := store.MarkSeen("desktop", seenAt.Add(time.Minute)); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+	if device, _ := store.GetDevice("desktop"); !device.LastSeen.Equal(seenAt.Add(time.Minute)) {
+		t.Errorf("LastSeen = %v, want %v", device.LastSeen, seenAt.Add(time.Minute))
+	}
+	if !saved().Equal(seenAt) {
+		t.Errorf("Saved LastSeen = %v, want %v within the save interval", saved(), seenAt)
+	}
+
+	later := seenAt.Add(seenSaveInterval)
+	if err := store.UpdateStatus("desktop", true, later); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+	if !saved().Equal(later) {
+		t.Errorf("Saved LastSeen = %v, want %v once the save interval passed", saved(), later)
+	}
+
+	// An older sighting never moves LastSeen back
+	if err := store.MarkSeen("desktop", seenAt); err != nil {
+		t.Fatalf("MarkSeen() error = %v", err)
+	}
+	if device, _ := store.GetDevice("desktop"); !device.LastSeen.Equal(later) {
+		t.Errorf("LastSeen = %v, want %v", device.LastSeen, later)
+	}
+
+	if err := store.MarkSeen("missing", seenAt); err == nil {
+		t.Error("MarkSeen() for unknown device should fail")
+	}
+}
+
+func TestDeviceStore_MACStyle(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "devices.json")
+
+	colon, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	if err := colon.AddDevice("desktop", "aabb.ccdd.eeff", "", "", 9); err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+	if device, _ := colon.GetDevice("desktop"); device.MACAddress != "AA:BB:CC:DD:EE:FF" {
+		t.Errorf("MACAddress = %s, want AA:BB:CC:DD:EE:FF", device.MACAddress)
+	}
+
+	hyphen, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath, MACStyle: wol_packet.MACStyleHyphen})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	if device, _ := hyphen.GetDevice("desktop"); device.MACAddress != "AA-BB-CC-DD-EE-FF" {
+		t.Errorf("loaded MACAddress = %s, want AA-BB-CC-DD-EE-FF", device.MACAddress)
+	}
+
+	if err := hyphen.AddDevice("laptop", "AA:BB:CC:DD:EE:FF", "", "", 9); err == nil {
+		t.Error("AddDevice() accepted a MAC already stored in another style")
+	}
+	if err := hyphen.AddDevice("laptop", "11:22:33:44:55:66", "", "", 9); err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+	if device, _ := hyphen.GetDevice("laptop"); device.MACAddress != "11-22-33-44-55-66" {
+		t.Errorf("MACAddress = %s, want 11-22-33-44-55-66", device.MACAddress)
+	}
+}
+
+func TestDeviceStore_StrictMAC(t *testing.T) {
+	store, err := NewDeviceStore(DeviceConfig{ConfigPath: filepath.Join(t.TempDir(), "devices.json"), StrictMAC: true})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+
+	if err := store.AddDevice("multicast", "01:00:5E:00:00:FB", "", "", 9); err == nil {
+		t.Error("AddDevice() accepted a multicast MAC in strict mode")
+	}
+	if err := store.AddDevice("desktop", wol_packet.GenerateTestMAC(), "", "", 9); err != nil {
+		t.Errorf("AddDevice() error = %v", err)
+	}
+}
+
+func TestDeviceStore_SetDeviceSecureOn(t *testing.T) {
+	store := createTestStore(t)
+	if err := store.AddDevice("nas", "AA:BB:CC:DD:EE:FF", "", "", 9); err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+
+	if err := store.SetDeviceSecureOn("nas", "12:34"); err == nil {
+		t.Error("SetDeviceSecureOn() accepted an invalid password")
+	}
+	if err := store.SetDeviceSecureOn("missing", "00:11:22:33:44:55"); err == nil {
+		t.Error("SetDeviceSecureOn() accepted an unknown device")
+	}
+
+	if err := store.SetDeviceSecureOn("nas", "00:11:22:33:44:55"); err != nil {
+		t.Fatalf("SetDeviceSecureOn() error = %v", err)
+	}
+	device, _ := store.GetDevice("nas")
+	password, err := device.SecureOnPassword()
+	if err != nil || len(password) != 6 || password[5] != 0x55 {
+		t.Errorf("SecureOnPassword() = %v, %v", password, err)
+	}
+
+	if err := store.SetDeviceSecureOn("nas", ""); err != nil {
+		t.Fatalf("SetDeviceSecureOn() error = %v", err)
+	}
+	device, _ = store.GetDevice("nas")
+	if password, _ := device.SecureOnPassword(); password != nil {
+		t.Errorf("SecureOnPassword() = %v after removal, want nil", password)
+	}
+}
+
+func TestDeviceStore_SetDeviceRemote(t *testing.T) {
+	store := createTestStore(t)
+	if err := store.AddDevice("nas", "AA:BB:CC:DD:EE:FF", "", "", 9); err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+
+	if err := store.SetDeviceRemote("nas", "ftp://peer.example", ""); err == nil {
+		t.Error("SetDeviceRemote() accepted an invalid URL")
+	}
+	if err := store.SetDeviceRemote("missing", "http://peer.example", ""); err == nil {
+		t.Error("SetDeviceRemote() accepted an unknown device")
+	}
+
+	if err := store.SetDeviceRemote("nas", "https://peer.example:8080/", "key"); err != nil {
+		t.Fatalf("SetDeviceRemote() error = %v", err)
+	}
+	device, _ := store.GetDevice("nas")
+	if device.Remote != "https://peer.example:8080" || device.RemoteKey != "key" {
+		t.Errorf("Remote = %q, RemoteKey = %q", device.Remote, device.RemoteKey)
+	}
+
+	if err := store.SetDeviceRemote("nas", "", "key"); err != nil {
+		t.Fatalf("SetDeviceRemote() error = %v", err)
+	}
+	device, _ = store.GetDevice("nas")
+	if device.Remote != "" || device.RemoteKey != "" {
+		t.Errorf("Remote = %q, RemoteKey = %q after removal, want empty", device.Remote, device.RemoteKey)
+	}
+}
+
+func TestDeviceStore_SetDeviceVLAN(t *testing.T) {
+	store := createTestStore(t)
+	if err := store.AddDevice("nas", "AA:BB:CC:DD:EE:FF", "", "", 9); err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+
+	tests := []struct {
+		vlan    int
+		wantErr bool
+	}{
+		{42, false},
+		{0, false},
+		{4095, true},
+		{-1, true},
+	}
+
+	for _, tt := range tests {
+		err := store.SetDeviceVLAN("nas", tt.vlan)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("SetDeviceVLAN(%d) error = %v, wantErr %v", tt.vlan, err, tt.wantErr)
+			continue
+		}
+		if device, _ := store.GetDevice("nas"); !tt.wantErr && device.VLAN != tt.vlan {
+			t.Errorf("VLAN = %d, want %d", device.VLAN, tt.vlan)
+		}
+	}
+}
+
+func TestDeviceStore_Concurrent(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "devices.json")
+	store, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			name := fmt.Sprintf("device-%d", i)
+			if err := store.AddDevice(name, fmt.Sprintf("AA:BB:CC:DD:EE:%02X", i), "", "", 9); err != nil {
+				t.Errorf("AddDevice(%s) error = %v", name, err)
+				return
+			}
+			store.UpdateLastWoken(name)
+			store.ListDevices()
+			store.GetDevice(name)
+		}(i)
+	}
+	wg.Wait()
+
+	reloaded, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	if count := reloaded.GetDeviceCount(); count != 20 {
+		t.Errorf("saved file has %d devices, want 20", count)
+	}
+}
+
+func TestDeviceStore_GetDeviceReturnsCopy(t *testing.T) {
+	store := createTestStore(t)
+	if err := store.AddDevice("nas", "AA:BB:CC:DD:EE:FF", "", "", 9); err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+	if err := store.SetDevicePower("nas", &PowerConfig{Provider: "redfish", Address: "https://bmc"}); err != nil {
+		t.Fatalf("SetDevicePower() error = %v", err)
+	}
+
+	device, _ := store.GetDevice("nas")
+	device.Description = "changed"
+	device.Power.Address = "https://other"
+
+	stored, _ := store.GetDevice("nas")
+	if stored.Description != "" || stored.Power.Address != "https://bmc" {
+		t.Errorf("store changed through a returned device: %+v", stored)
+	}
+}
+
+func TestDeviceStore_Tags(t *testing.T) {
+	store := createTestStore(t)
+	store.AddDevice("nas", "AA:BB:CC:DD:EE:01", "", "", 9)
+	store.AddDevice("desktop", "AA:BB:CC:DD:EE:02", "", "", 9)
+	store.AddDevice("printer", "AA:BB:CC:DD:EE:03", "", "", 9)
+
+	if err := store.SetDeviceTags("nas", []string{" storage ", "Office", "office", ""}); err != nil {
+		t.Fatalf("SetDeviceTags() error = %v", err)
+	}
+	store.SetDeviceTags("desktop", []string{"office"})
+	if err := store.SetDeviceTags("missing", []string{"x"}); err == nil {
+		t.Error("SetDeviceTags() on a missing device should fail")
+	}
+
+	device, _ := store.GetDevice("nas")
+	if strings.Join(device.Tags, ",") != "Office,storage" {
+		t.Errorf("Tags = %v, want [Office storage]", device.Tags)
+	}
+
+	tests := []struct {
+		tags []string
+		want []string
+	}{
+		{nil, []string{"desktop", "nas", "printer"}},
+		{[]string{"OFFICE"}, []string{"desktop", "nas"}},
+		{[]string{"office", "storage"}, []string{"nas"}},
+		{[]string{"home"}, nil},
+	}
+
+	for _, tt := range tests {
+		var names []string
+		for _, device := range store.ListDevices(tt.tags...) {
+			names = append(names, device.Name)
+		}
+		if strings.Join(names, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("ListDevices(%v) = %v, want %v", tt.tags, names, tt.want)
+		}
+	}
+}
+
+func TestDeviceStore_RenameDevice(t *testing.T) {
+	store := createTestStore(t)
+	store.AddDevice("nas", "AA:BB:CC:DD:EE:01", "Storage", "", 9)
+	store.AddDevice("desktop", "AA:BB:CC:DD:EE:02", "", "", 9)
+	store.UpdateLastWoken("nas")
+	before, _ := store.GetDevice("nas")
+
+	tests := []struct {
+		name    string
+		oldName string
+		newName string
+		wantErr bool
+	}{
+		{"missing device", "missing", "other", true},
+		{"name taken", "nas", "desktop", true},
+		{"empty name", "nas", " ", true},
+		{"reserved name", "nas", "wake", true},
+		{"reserved command alias", "nas", "Backup", true},
+		{"renamed", "nas", "storage", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.RenameDevice(tt.oldName, tt.newName); (err != nil) != tt.wantErr {
+				t.Errorf("RenameDevice() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	if store.DeviceExists("nas") {
+		t.Error("old name still exists after rename")
+	}
+	after, err := store.GetDevice("storage")
+	if err != nil {
+		t.Fatalf("GetDevice() error = %v", err)
+	}
+	if !after.AddedAt.Equal(before.AddedAt) || !after.LastWoken.Equal(before.LastWoken) || after.Description != "Storage" {
+		t.Errorf("renamed device = %+v, want the fields of %+v", after, before)
+	}
+}
+
+func TestDeviceStore_UpdateDevice(t *testing.T) {
+	store := createTestStore(t)
+	store.AddDevice("nas", "AA:BB:CC:DD:EE:01", "Storage", "192.168.1.5", 9)
+	store.AddDevice("desktop", "AA:BB:CC:DD:EE:02", "", "", 9)
+	store.UpdateLastWoken("nas")
+	store.SetDeviceVLAN("nas", 20)
+	before, _ := store.GetDevice("nas")
+
+	str := func(s string) *string { return &s }
+	port := func(p int) *int { return &p }
+
+	tests := []struct {
+		name    string
+		device  string
+		fields  DeviceUpdate
+		wantErr bool
+	}{
+		{"missing device", "missing", DeviceUpdate{Description: str("x")}, true},
+		{"invalid MAC", "nas", DeviceUpdate{MACAddress: str("nope")}, true},
+		{"MAC in use", "nas", DeviceUpdate{MACAddress: str("aa-bb-cc-dd-ee-02")}, true},
+		{"invalid port", "nas", DeviceUpdate{Port: port(70000)}, true},
+		{"own MAC", "nas", DeviceUpdate{MACAddress: str("AA:BB:CC:DD:EE:01")}, false},
+		{"patched", "nas", DeviceUpdate{MACAddress: str("aa-bb-cc-dd-ee-03"), IPAddress: str("nas.lan"), Port: port(7)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := store.UpdateDevice(tt.device, tt.fields); (err != nil) != tt.wantErr {
+				t.Errorf("UpdateDevice() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	after, _ := store.GetDevice("nas")
+	if after.MACAddress != "AA:BB:CC:DD:EE:03" || after.IPAddress != "nas.lan" || after.Port != 7 {
+		t.Errorf("updated device = %+v", after)
+	}
+	if after.Description != "Storage" || after.VLAN != 20 {
+		t.Errorf("UpdateDevice() changed fields it was not given: %+v", after)
+	}
+	if !after.AddedAt.Equal(before.AddedAt) || !after.LastWoken.Equal(before.LastWoken) {
+		t.Error("UpdateDevice() reset the device's timestamps")
+	}
+}
+
+func TestDeviceStore_FindByMACAndIP(t *testing.T) {
+	store := createTestStore(t)
+	store.AddDevice("nas", "AA:BB:CC:DD:EE:01", "", "192.168.1.5", 9)
+	store.AddDevice("desktop", "AA:BB:CC:DD:EE:02", "", "Desktop.lan", 9)
+	store.AddDevice("v6", "AA:BB:CC:DD:EE:03", "", "2001:db8::1", 9)
+
+	macTests := []struct {
+		mac     string
+		want    string
+		wantErr bool
+	}{
+		{"AA:BB:CC:DD:EE:01", "nas", false},
+		{"aa-bb-cc-dd-ee-02", "desktop", false},
+		{"aabb.ccdd.ee03", "v6", false},
+		{"AA:BB:CC:DD:EE:09", "", true},
+		{"nas", "", true},
+	}
+	for _, tt := range macTests {
+		device, err := store.FindByMAC(tt.mac)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("FindByMAC(%s) error = %v, wantErr %v", tt.mac, err, tt.wantErr)
+			continue
+		}
+		if err == nil && device.Name != tt.want {
+			t.Errorf("FindByMAC(%s) = %s, want %s", tt.mac, device.Name, tt.want)
+		}
+	}
+
+	ipTests := []struct {
+		ip      string
+		want    string
+		wantErr bool
+	}{
+		{"192.168.1.5", "nas", false},
+		{"2001:db8:0::1", "v6", false},
+		{"desktop.LAN", "desktop", false},
+		{"192.168.1.6", "", true},
+		{"", "", true},
+	}
+	for _, tt := range ipTests {
+		device, err := store.FindByIP(tt.ip)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("FindByIP(%s) error = %v, wantErr %v", tt.ip, err, tt.wantErr)
+			continue
+		}
+		if err == nil && device.Name != tt.want {
+			t.Errorf("FindByIP(%s) = %s, want %s", tt.ip, device.Name, tt.want)
+		}
+	}
+}
+
+func TestDeviceStore_SetDeviceBroadcastAddressAndInterface(t *testing.T) {
+	store := createTestStore(t)
+	store.AddDevice("camera", "AA:BB:CC:DD:EE:01", "", "", 9)
+
+	if err := store.SetDeviceBroadcastAddress("camera", " 192.168.20.255 "); err != nil {
+		t.Fatalf("SetDeviceBroadcastAddress() error = %v", err)
+	}
+	if err := store.SetDeviceInterface("camera", "eth0.20"); err != nil {
+		t.Fatalf("SetDeviceInterface() error = %v", err)
+	}
+	if err := store.SetDeviceInterface("missing", "eth0"); err == nil {
+		t.Error("SetDeviceInterface() on a missing device should fail")
+	}
+
+	device, _ := store.GetDevice("camera")
+	if device.BroadcastAddress != "192.168.20.255" || device.Interface != "eth0.20" {
+		t.Errorf("device = %+v, want broadcast address 192.168.20.255 on eth0.20", device)
+	}
+
+	store.SetDeviceBroadcastAddress("camera", "")
+	if device, _ := store.GetDevice("camera"); device.BroadcastAddress != "" {
+		t.Errorf("BroadcastAddress = %q after clearing", device.BroadcastAddress)
+	}
+}
+
+func TestValidateHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		wantErr bool
+	}{
+		{"", false},
+		{"192.168.1.10", false},
+		{"2001:db8::1", false},
+		{"fe80::1%eth0", false},
+		{"nas", false},
+		{"nas.local", false},
+		{"media-server.home.example.com.", false},
+		{"192.168.1.300", true},
+		{"192.168.1", true},
+		{"192.168.1.10%eth0", true},
+		{"2001:db8::zz", true},
+		{"my_pc", true},
+		{"-nas", true},
+		{"nas-.local", true},
+		{"nas..local", true},
+		{"http://nas", true},
+		{strings.Repeat("a", 64) + ".local", true},
+	}
+
+	for _, tt := range tests {
+		err := ValidateHost(tt.host)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ValidateHost(%q) error = %v, wantErr %v", tt.host, err, tt.wantErr)
+		}
+	}
+}
+
+func TestDeviceStore_RejectsInvalidIP(t *testing.T) {
+	store := createTestStore(t)
+
+	if err := store.AddDevice("desktop", "AA:BB:CC:DD:EE:01", "", "192.168.1.300", 9); err == nil {
+		t.Error("AddDevice() accepted an invalid IP address")
+	}
+	if err := store.AddDevice("desktop", "AA:BB:CC:DD:EE:01", "", " nas.local ", 9); err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+
+	bad := "not a host"
+	if err := store.UpdateDevice("desktop", DeviceUpdate{IPAddress: &bad}); err == nil {
+		t.Error("UpdateDevice() accepted an invalid IP address")
+	}
+	device, _ := store.GetDevice("desktop")
+	if device.IPAddress != "nas.local" {
+		t.Errorf("Device.IPAddress = %q, want nas.local", device.IPAddress)
+	}
+}
+
+func TestDeviceStore_SetDeviceMetadata(t *testing.T) {
+	store := createTestStore(t)
+	if err := store.AddDevice("desktop", "AA:BB:CC:DD:EE:01", "", "", 9); err != nil {
+		t.Fatalf("Failed to add test device: %v", err)
+	}
+
+	if err := store.SetDeviceMetadata("desktop", map[string]string{"location": "rack4", " owner ": " alice "}); err != nil {
+		t.Fatalf("SetDeviceMetadata() error = %v", err)
+	}
+	if err := store.SetDeviceMetadata("desktop", map[string]string{"location": "", "asset": "A-1001"}); err != nil {
+		t.Fatalf("SetDeviceMetadata() error = %v", err)
+	}
+
+	device, _ := store.GetDevice("desktop")
+	want := map[string]string{"owner": "alice", "asset": "A-1001"}
+	if !maps.Equal(device.Metadata, want) {
+		t.Errorf("Device.Metadata = %v, want %v", device.Metadata, want)
+	}
+
+	device.Metadata["owner"] = "mallory"
+	if stored, _ := store.GetDevice("desktop"); stored.Metadata["owner"] != "alice" {
+		t.Error("Changing a returned device's metadata changed the store")
+	}
+
+	for _, key := range []string{"", "a=b", "two words", strings.Repeat("k", 65)} {
+		if err := store.SetDeviceMetadata("desktop", map[string]string{key: "x"}); err == nil {
+			t.Errorf("SetDeviceMetadata() accepted key %q", key)
+		}
+	}
+}
+
+func TestDeviceStore_CreateAndUpdateInOneWrite(t *testing.T) {
+	mem := &memoryStore{devices: make(map[string]*Device)}
+	store := NewDeviceStoreWith(mem, DeviceConfig{})
+
+	invalid := []*Device{
+		{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01", Remote: "ftp://relay"},
+		{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01", Metadata: map[string]string{"a=b": "x"}},
+		{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01", Policy: &WakePolicy{Retries: -1}},
+		{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01", VLAN: 5000},
+		{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01", SecureOn: "not-a-password"},
+	}
+	for _, device := range invalid {
+		if err := store.CreateDevice(device); err == nil {
+			t.Errorf("CreateDevice(%+v) error = nil, want an error", device)
+		}
+	}
+	if mem.writes != 0 {
+		t.Fatalf("rejected devices reached the backend %d times", mem.writes)
+	}
+
+	err := store.CreateDevice(&Device{
+		Name:        "nas",
+		MACAddress:  "aa-bb-cc-dd-ee-01",
+		Site:        " lab ",
+		Tags:        []string{"storage", "Storage"},
+		Metadata:    map[string]string{"rack": "4", "empty": ""},
+		Remote:      "http://relay:8080/",
+		RemoteKey:   "secret",
+		WakeAddress: " nas.example.com:9 ",
+		Power:       &PowerConfig{Provider: "ipmi", Address: "10.0.0.5", Password: "pw"},
+		Policy:      &WakePolicy{Retries: 2},
+		VLAN:        20,
+		Broadcast:   "directed",
+		SecureOn:    "01:02:03:04:05:06",
+		Transport:   "mqtt",
+		Archived:    true,
+	})
+	if err != nil {
+		t.Fatalf("CreateDevice() error = %v", err)
+	}
+	if mem.writes != 1 {
+		t.Errorf("CreateDevice() wrote %d times, want 1", mem.writes)
+	}
+	device, _ := store.GetDevice("nas")
+	if device.MACAddress != "AA:BB:CC:DD:EE:01" || device.Site != "lab" || device.Remote != "http://relay:8080" ||
+		device.WakeAddress != "nas.example.com:9" || len(device.Tags) != 1 || len(device.Metadata) != 1 ||
+		device.Power == nil || device.Policy == nil || device.Port != 9 {
+		t.Errorf("created device = %+v", device)
+	}
+	if device.VLAN != 20 || device.Broadcast != "directed" || device.SecureOn != "01:02:03:04:05:06" ||
+		device.Transport != "mqtt" || device.Archived {
+		t.Errorf("created device = %+v, want its VLAN, broadcast mode, SecureOn and transport, unarchived", device)
+	}
+
+	str := func(s string) *string { return &s }
+	if err := store.UpdateDevice("nas", DeviceUpdate{Site: str("edge"), Remote: str("ftp://relay")}); err == nil {
+		t.Error("UpdateDevice() accepted an invalid remote URL")
+	}
+	if stored, _ := store.GetDevice("nas"); stored.Site != "lab" {
+		t.Error("a rejected UpdateDevice() changed the device")
+	}
+
+	mem.writes = 0
+	err = store.UpdateDevice("nas", DeviceUpdate{
+		Description: str("Storage"),
+		Site:        str(""),
+		Tags:        &[]string{},
+		Metadata:    map[string]string{"rack": "", "owner": "ops"},
+		Remote:      str(""),
+		Interface:   str("eth1"),
+		Power:       &PowerConfig{Provider: "ipmi", Address: "10.0.0.6"},
+		Policy:      &WakePolicy{},
+	})
+	if err != nil {
+		t.Fatalf("UpdateDevice() error = %v", err)
+	}
+	if mem.writes != 1 {
+		t.Errorf("UpdateDevice() wrote %d times, want 1", mem.writes)
+	}
+	device, _ = store.GetDevice("nas")
+	if device.Description != "Storage" || device.Site != "" || device.Tags != nil || device.Metadata["owner"] != "ops" ||
+		len(device.Metadata) != 1 || device.Remote != "" || device.RemoteKey != "" || device.Interface != "eth1" || device.Policy != nil {
+		t.Errorf("updated device = %+v", device)
+	}
+	if device.Power == nil || device.Power.Address != "10.0.0.6" || device.Power.Password != "pw" {
+		t.Errorf("Power = %+v, want the new address with the old password", device.Power)
+	}
+
+	if err := store.UpdateDevice("nas", DeviceUpdate{Power: &PowerConfig{}}); err != nil {
+		t.Fatalf("UpdateDevice() error = %v", err)
+	}
+	if device, _ := store.GetDevice("nas"); device.Power != nil {
+		t.Error("an empty power provider did not remove power control")
+	}
+}
+
+func TestDeviceStore_StandbyNeverSaves(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "devices.json")
+	leader, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	if err := leader.AddDevice("nas", "AA:BB:CC:DD:EE:01", "", "192.168.1.5", 9); err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+	leader.SetLeader(func() bool { return true })
+
+	for _, flushDelay := range []time.Duration{0, 10 * time.Millisecond} {
+		standby, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath, FlushDelay: flushDelay})
+		if err != nil {
+			t.Fatalf("NewDeviceStore() error = %v", err)
+		}
+		standby.SetLeader(func() bool { return false })
+		before, _ := os.ReadFile(configPath)
+
+		if err := standby.UpdateLastWoken("nas"); err != nil {
+			t.Fatalf("UpdateLastWoken() error = %v", err)
+		}
+		if err := standby.UpdateStatus("nas", true, time.Now()); err != nil {
+			t.Fatalf("UpdateStatus() error = %v", err)
+		}
+		if _, changed, err := standby.UpdateLease("aa:bb:cc:dd:ee:01", "192.168.1.99", time.Now()); err != nil || !changed {
+			t.Fatalf("UpdateLease() = %v, %v, want a changed lease", changed, err)
+		}
+		time.Sleep(3 * flushDelay)
+		if err := standby.Close(); err != nil {
+			t.Fatalf("Close() error = %v", err)
+		}
+
+		if after, _ := os.ReadFile(configPath); string(after) != string(before) {
+			t.Errorf("standby with flush delay %s wrote the shared file", flushDelay)
+		}
+		if device, _ := standby.GetDevice("nas"); device.IPAddress != "192.168.1.99" || device.LastWoken.IsZero() {
+			t.Errorf("standby did not keep its updates in memory: %+v", device)
+		}
+	}
+
+	if err := leader.UpdateLastWoken("nas"); err != nil {
+		t.Fatalf("UpdateLastWoken() error = %v", err)
+	}
+	other, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	if device, _ := other.GetDevice("nas"); device.LastWoken.IsZero() {
+		t.Error("the leader's wake time did not reach the shared file")
+	}
+}
@@ -0,0 +1,205 @@
+package wol_device
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+const (
+	encryptionAlgorithm = "aes-256-gcm"
+	kdfPBKDF2           = "pbkdf2-sha256"
+	// pbkdf2Iterations follows the OWASP recommendation for PBKDF2-SHA256
+	pbkdf2Iterations = 600000
+	keySize          = 32
+	saltSize         = 16
+)
+
+// StoreKey encrypts a device file with AES-256-GCM, for stores that hold
+// SecureOn passwords and BMC or remote credentials. It is either a random
+// 256-bit key or derived from a passphrase with PBKDF2. It is safe for
+// concurrent use.
+type StoreKey struct {
+	key        []byte
+	passphrase string
+	// salt is the one key was derived with; a passphrase key is derived
+	// again only when a file uses another salt
+	salt []byte
+	// mu guards key and salt, which sealing and opening can change
+	mu sync.Mutex
+}
+
+// encryptedFile is how an encrypted device file is stored.
+type encryptedFile struct {
+	Encrypted  string `json:"encrypted"`
+	KDF        string `json:"kdf,omitempty"`
+	Iterations int    `json:"iterations,omitempty"`
+	Salt       []byte `json:"salt,omitempty"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+func NewStoreKey(key []byte) (*StoreKey, error) {
+	if len(key) != keySize {
+		return nil, fmt.Errorf("store key must be %d bytes, got %d", keySize, len(key))
+	}
+	return &StoreKey{key: bytes.Clone(key)}, nil
+}
+
+func NewPassphraseKey(passphrase string) (*StoreKey, error) {
+	if passphrase == "" {
+		return nil, fmt.Errorf("store passphrase cannot be empty")
+	}
+	return &StoreKey{passphrase: passphrase}, nil
+}
+
+// LoadStoreKey reads a key file: 64 hex digits, as GenerateStoreKey
+// writes, are used as the key itself and anything else as a passphrase.
+func LoadStoreKey(path string) (*StoreKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read store key file: %w", err)
+	}
+
+	content := strings.TrimSpace(string(data))
+	if key, err := hex.DecodeString(content); err == nil && len(key) == keySize {
+		return NewStoreKey(key)
+	}
+	return NewPassphraseKey(content)
+}
+
+// GenerateStoreKey writes a new random key to path, readable only by its
+// owner. An existing file is not overwritten.
+func GenerateStoreKey(path string) error {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return fmt.Errorf("failed to generate store key: %w", err)
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to create store key file: %w", err)
+	}
+	_, err = fmt.Fprintln(file, hex.EncodeToString(key))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write store key file: %w", err)
+	}
+	return nil
+}
+
+// isEncrypted reports whether data is an encrypted device file.
+func isEncrypted(data []byte) bool {
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) {
+		return false
+	}
+	var envelope struct {
+		Encrypted string `json:"encrypted"`
+	}
+	return json.Unmarshal(data, &envelope) == nil && envelope.Encrypted != ""
+}
+
+// Seal encrypts data the way the device file is encrypted, for other
+// copies of the devices such as backups.
+func (k *StoreKey) Seal(plaintext []byte) ([]byte, error) {
+	return k.seal(plaintext)
+}
+
+// Open decrypts data sealed with Seal or an encrypted device file.
+func (k *StoreKey) Open(data []byte) ([]byte, error) {
+	return k.open(data)
+}
+
+func (k *StoreKey) seal(plaintext []byte) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	file := encryptedFile{Encrypted: encryptionAlgorithm}
+	if k.passphrase != "" {
+		if k.salt == nil {
+			salt := make([]byte, saltSize)
+			if _, err := rand.Read(salt); err != nil {
+				return nil, err
+			}
+			k.derive(salt)
+		}
+		file.KDF = kdfPBKDF2
+		file.Iterations = pbkdf2Iterations
+		file.Salt = k.salt
+	}
+
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	file.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(file.Nonce); err != nil {
+		return nil, err
+	}
+	file.Data = aead.Seal(nil, file.Nonce, plaintext, []byte(file.Encrypted))
+
+	return json.MarshalIndent(file, "", "	")
+}
+
+func (k *StoreKey) open(data []byte) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	var file encryptedFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid encrypted device file: %w", err)
+	}
+	if file.Encrypted != encryptionAlgorithm {
+		return nil, fmt.Errorf("unsupported device file encryption %q", file.Encrypted)
+	}
+
+	switch {
+	case file.KDF == "" && k.passphrase != "":
+		return nil, fmt.Errorf("device file is encrypted with a key file, not a passphrase")
+	case file.KDF != "" && k.passphrase == "":
+		return nil, fmt.Errorf("device file is encrypted with a passphrase, not a key file")
+	case file.KDF != "" && (file.KDF != kdfPBKDF2 || file.Iterations != pbkdf2Iterations):
+		return nil, fmt.Errorf("unsupported key derivation %s with %d iterations", file.KDF, file.Iterations)
+	case file.KDF != "" && !bytes.Equal(file.Salt, k.salt):
+		k.derive(file.Salt)
+	}
+
+	aead, err := k.aead()
+	if err != nil {
+		return nil, err
+	}
+	if len(file.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted device file: bad nonce")
+	}
+	plaintext, err := aead.Open(nil, file.Nonce, file.Data, []byte(file.Encrypted))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt device file: wrong key or passphrase, or the file was altered")
+	}
+	return plaintext, nil
+}
+
+func (k *StoreKey) derive(salt []byte) {
+	// Only fails for a key length SHA-256 cannot produce
+	key, _ := pbkdf2.Key(sha256.New, k.passphrase, salt, pbkdf2Iterations, keySize)
+	k.key = key
+	k.salt = bytes.Clone(salt)
+}
+
+func (k *StoreKey) aead() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(k.key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,119 @@
+package wol_device
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEncryptedFileStore(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "store.key")
+	if err := GenerateStoreKey(keyPath); err != nil {
+		t.Fatalf("GenerateStoreKey() error = %v", err)
+	}
+	if err := GenerateStoreKey(keyPath); err == nil {
+		t.Error("GenerateStoreKey() overwrote an existing key file")
+	}
+	fileKey, err := LoadStoreKey(keyPath)
+	if err != nil {
+		t.Fatalf("LoadStoreKey() error = %v", err)
+	}
+	passphraseKey, err := NewPassphraseKey("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("NewPassphraseKey() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		file string
+		key  *StoreKey
+	}{
+		{"key file", "devices.json", fileKey},
+		{"passphrase", "devices.json", passphraseKey},
+		{"key file with YAML", "devices.yaml", fileKey},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			store, err := NewDeviceStore(DeviceConfig{ConfigPath: path, Key: tt.key})
+			if err != nil {
+				t.Fatalf("NewDeviceStore() error = %v", err)
+			}
+			if err := store.AddDevice("desktop", "AA:BB:CC:DD:EE:01", "", "", 9); err != nil {
+				t.Fatalf("AddDevice() error = %v", err)
+			}
+			if err := store.SetDeviceSecureOn("desktop", "00:11:22:33:44:55"); err != nil {
+				t.Fatalf("SetDeviceSecureOn() error = %v", err)
+			}
+
+			data, _ := os.ReadFile(path)
+			if bytes.Contains(data, []byte("desktop")) || bytes.Contains(data, []byte("00:11:22:33:44:55")) {
+				t.Errorf("Encrypted file contains plain text: %s", data)
+			}
+
+			reopened, err := NewDeviceStore(DeviceConfig{ConfigPath: path, Key: tt.key})
+			if err != nil {
+				t.Fatalf("NewDeviceStore() reopening error = %v", err)
+			}
+			device, err := reopened.GetDevice("desktop")
+			if err != nil || device.SecureOn != "00:11:22:33:44:55" {
+				t.Errorf("Reopened device = %+v, %v", device, err)
+			}
+
+			if _, err := NewDeviceStore(DeviceConfig{ConfigPath: path}); err == nil || !strings.Contains(err.Error(), "encrypted") {
+				t.Errorf("NewDeviceStore() without a key error = %v, want an encrypted file error", err)
+			}
+			wrongKey, _ := NewPassphraseKey("wrong")
+			if tt.key == fileKey {
+				wrongKey, _ = NewStoreKey(make([]byte, keySize))
+			}
+			if _, err := NewDeviceStore(DeviceConfig{ConfigPath: path, Key: wrongKey}); err == nil {
+				t.Error("NewDeviceStore() with the wrong key should fail")
+			}
+		})
+	}
+}
+
+func TestEncryptedFileStore_EncryptsPlainFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	plain, err := NewDeviceStore(DeviceConfig{ConfigPath: path})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	if err := plain.AddDevice("desktop", "AA:BB:CC:DD:EE:01", "", "", 9); err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+
+	key, _ := NewStoreKey(bytes.Repeat([]byte{7}, keySize))
+	store, err := NewDeviceStore(DeviceConfig{ConfigPath: path, Key: key})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	if !store.DeviceExists("desktop") {
+		t.Error("Plain text devices were not loaded")
+	}
+
+	data, _ := os.ReadFile(path)
+	if !isEncrypted(data) {
+		t.Error("Plain text file was not encrypted when opened with a key")
+	}
+}
+
+func TestLoadStoreKey_Passphrase(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "passphrase")
+	if err := os.WriteFile(path, []byte("my passphrase\n"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+
+	key, err := LoadStoreKey(path)
+	if err != nil {
+		t.Fatalf("LoadStoreKey() error = %v", err)
+	}
+	if key.passphrase != "my passphrase" {
+		t.Errorf("LoadStoreKey() passphrase = %q, want %q", key.passphrase, "my passphrase")
+	}
+}
@@ -0,0 +1,139 @@
+package wol_device
+
+import (
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// fileFormat encodes a FileStore. YAML and TOML go through the same JSON
+// tags: the value is converted to a tree of maps, lists and scalars and
+// written out, and read back the other way.
+type fileFormat struct {
+	marshal   func(v any) ([]byte, error)
+	unmarshal func(data []byte, v any) error
+}
+
+var (
+	jsonFormat = fileFormat{
+		marshal: func(v any) ([]byte, error) {
+			return json.MarshalIndent(v, "", "	")
+		},
+		unmarshal: json.Unmarshal,
+	}
+	yamlFormat = fileFormat{
+		marshal:   viaTree(encodeYAML),
+		unmarshal: fromTree(decodeYAML),
+	}
+	tomlFormat = fileFormat{
+		marshal:   viaTree(encodeTOML),
+		unmarshal: fromTree(decodeTOML),
+	}
+)
+
+func formatForPath(path string) fileFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return yamlFormat
+	case ".toml":
+		return tomlFormat
+	default:
+		return jsonFormat
+	}
+}
+
+func viaTree(encode func(v any) ([]byte, error)) func(v any) ([]byte, error) {
+	return func(v any) ([]byte, error) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		var tree map[string]any
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&tree); err != nil {
+			return nil, err
+		}
+		return encode(numbers(tree))
+	}
+}
+
+func fromTree(decode func(data []byte) (map[string]any, error)) func(data []byte, v any) error {
+	return func(data []byte, v any) error {
+		tree, err := decode(data)
+		if err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(tree)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(encoded, v)
+	}
+}
+
+// numbers replaces the json.Numbers in a tree with integers, or floats
+// for those that are not, so YAML and TOML write them as numbers rather
+// than strings.
+func numbers(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			v[key] = numbers(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = numbers(value)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		n, _ := v.Float64()
+		return n
+	}
+	return v
+}
+
+func encodeYAML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeYAML(data []byte) (map[string]any, error) {
+	var tree map[string]any
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
+
+func encodeTOML(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	encoder := toml.NewEncoder(&buf)
+	encoder.Indent = ""
+	if err := encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeTOML(data []byte) (map[string]any, error) {
+	var tree map[string]any
+	if err := toml.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+	return tree, nil
+}
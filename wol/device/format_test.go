@@ -0,0 +1,176 @@
+package wol_device
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileStore_Formats(t *testing.T) {
+	added := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	want := &Device{
+		Name:        "living room #2",
+		MACAddress:  "AA:BB:CC:DD:EE:FF",
+		Description: `Quoted "PC": with colon`,
+		Port:        9,
+		VLAN:        20,
+		Power:       &PowerConfig{Provider: "ipmi", Address: "10.0.0.5", Insecure: true},
+		AddedAt:     added,
+	}
+
+	for _, ext := range []string{".json", ".yaml", ".yml", ".toml"} {
+		t.Run(ext, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "devices"+ext)
+			store, err := OpenFileStore(path)
+			if err != nil {
+				t.Fatalf("OpenFileStore() error = %v", err)
+			}
+			if err := store.Add(want); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+			if err := store.Add(&Device{Name: "nas", MACAddress: "00:11:22:33:44:55"}); err != nil {
+				t.Fatalf("Add() error = %v", err)
+			}
+
+			reopened, err := OpenFileStore(path)
+			if err != nil {
+				data, _ := os.ReadFile(path)
+				t.Fatalf("OpenFileStore() error = %v\n%s", err, data)
+			}
+			got, err := reopened.Get(want.Name)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			if got.Description != want.Description || got.Port != 9 || got.VLAN != 20 || !got.AddedAt.Equal(added) {
+				t.Errorf("Get() = %+v, want %+v", got, want)
+			}
+			if got.Power == nil || *got.Power != *want.Power {
+				t.Errorf("Power = %+v, want %+v", got.Power, want.Power)
+			}
+			if devices, _ := reopened.List(); len(devices) != 2 {
+				t.Errorf("List() = %d devices, want 2", len(devices))
+			}
+		})
+	}
+}
+
+func TestDecodeYAML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+		check   func(t *testing.T, tree map[string]any)
+	}{
+		{
+			name: "hand written",
+			input: `---
+# my devices
+devices:
+  nas:
+    name: nas
+    mac_address: AA:BB:CC:DD:EE:FF   # on the shelf
+    port: 9
+    tags: [storage, "always on"]
+  'pc':
+    name: 'it''s mine'
+`,
+			check: func(t *testing.T, tree map[string]any) {
+				devices := tree["devices"].(map[string]any)
+				nas := devices["nas"].(map[string]any)
+				if nas["mac_address"] != "AA:BB:CC:DD:EE:FF" {
+					t.Errorf("mac_address = %v", nas["mac_address"])
+				}
+				if tags := nas["tags"].([]any); len(tags) != 2 || tags[1] != "always on" {
+					t.Errorf("tags = %v", tags)
+				}
+				if pc := devices["pc"].(map[string]any); pc["name"] != "it's mine" {
+					t.Errorf("name = %v", pc["name"])
+				}
+			},
+		},
+		{
+			name:  "block list",
+			input: "items:\n  - a\n  - name: b\n    port: 7\n",
+			check: func(t *testing.T, tree map[string]any) {
+				items := tree["items"].([]any)
+				if len(items) != 2 || items[0] != "a" || items[1].(map[string]any)["name"] != "b" {
+					t.Errorf("items = %v", items)
+				}
+			},
+		},
+		{name: "bad indentation", input: "devices:\n  a: 1\n    b: 2\n", wantErr: true},
+		{name: "not a mapping", input: "just text\n", wantErr: true},
+		{name: "unterminated string", input: "a: \"open\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := decodeYAML([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeYAML() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, tree)
+			}
+		})
+	}
+}
+
+func TestDecodeTOML(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+		check   func(t *testing.T, tree map[string]any)
+	}{
+		{
+			name: "hand written",
+			input: `# my devices
+[devices.nas]
+name = "nas"
+mac_address = 'AA:BB:CC:DD:EE:FF' # on the shelf
+port = 9
+added_at = 2024-03-01T12:00:00Z
+tags = [
+  "storage",
+  "always on", # trailing comma
+]
+
+[devices."living room".power]
+provider = "ipmi"
+insecure = true
+`,
+			check: func(t *testing.T, tree map[string]any) {
+				devices := tree["devices"].(map[string]any)
+				nas := devices["nas"].(map[string]any)
+				if nas["mac_address"] != "AA:BB:CC:DD:EE:FF" || nas["added_at"] != time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC) {
+					t.Errorf("nas = %v", nas)
+				}
+				if tags := nas["tags"].([]any); len(tags) != 2 || tags[1] != "always on" {
+					t.Errorf("tags = %v", tags)
+				}
+				power := devices["living room"].(map[string]any)["power"].(map[string]any)
+				if power["insecure"] != true {
+					t.Errorf("power = %v", power)
+				}
+			},
+		},
+		{name: "missing value", input: "a =\n", wantErr: true},
+		{name: "no equals", input: "a\n", wantErr: true},
+		{name: "unterminated array", input: "tags = [\n  \"a\",\n", wantErr: true},
+		{name: "key reused as table", input: "a = 1\n[a.b]\n", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tree, err := decodeTOML([]byte(tt.input))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("decodeTOML() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.check != nil {
+				tt.check(t, tree)
+			}
+		})
+	}
+}
@@ -0,0 +1,255 @@
+package wol_device
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Group is a named set of devices that are woken together, such as every
+// machine in a lab or rack. Members are device names.
+type Group struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Members     []string `json:"members"`
+}
+
+func (g *Group) clone() *Group {
+	clone := *g
+	clone.Members = slices.Clone(g.Members)
+	return &clone
+}
+
+// SharedFile keeps the contents of a store's file somewhere other than the
+// local disk, such as a RedisFile several servers use. ReadFile returns an
+// os.ErrNotExist error while there is nothing there yet.
+type SharedFile interface {
+	ReadFile() ([]byte, error)
+	WriteFile(data []byte) error
+}
+
+// GroupStore keeps groups in their own file next to the devices. It is
+// safe for concurrent use and returns copies of its groups.
+type GroupStore struct {
+	mu         sync.Mutex
+	Groups     map[string]*Group `json:"groups"`
+	configPath string
+	// shared, if set, is where the groups are kept instead of configPath
+	shared SharedFile
+}
+
+func DefaultGroupsPath(deviceConfigPath string) string {
+	return filepath.Join(filepath.Dir(deviceConfigPath), "groups.json")
+}
+
+func NewGroupStore(configPath string) (*GroupStore, error) {
+	return openGroupStore(&GroupStore{configPath: configPath})
+}
+
+// NewSharedGroupStore keeps the groups in shared, such as a key on a server
+// several wol-servers use, rather than in a local file.
+func NewSharedGroupStore(shared SharedFile) (*GroupStore, error) {
+	return openGroupStore(&GroupStore{shared: shared})
+}
+
+func openGroupStore(store *GroupStore) (*GroupStore, error) {
+	store.Groups = make(map[string]*Group)
+
+	err := store.load()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load group store: %w", err)
+	}
+
+	return store, nil
+}
+
+// CreateGroup adds a group; its members are not checked against the
+// device store.
+func (gs *GroupStore) CreateGroup(group *Group) error {
+	name := strings.TrimSpace(group.Name)
+	if name == "" {
+		return fmt.Errorf("group name cannot be empty")
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if _, exists := gs.Groups[name]; exists {
+		return fmt.Errorf("group '%s' already exists", name)
+	}
+
+	created := group.clone()
+	created.Name = name
+	created.Members = normalizeMembers(group.Members)
+	gs.Groups[name] = created
+	return gs.save()
+}
+
+func (gs *GroupStore) RemoveGroup(name string) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	if _, exists := gs.Groups[name]; !exists {
+		return fmt.Errorf("group '%s' not found", name)
+	}
+
+	delete(gs.Groups, name)
+	return gs.save()
+}
+
+func (gs *GroupStore) GetGroup(name string) (*Group, error) {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	group, exists := gs.Groups[name]
+	if !exists {
+		return nil, fmt.Errorf("group '%s' not found", name)
+	}
+
+	return group.clone(), nil
+}
+
+func (gs *GroupStore) ListGroups() []*Group {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	groups := make([]*Group, 0, len(gs.Groups))
+	for _, group := range gs.Groups {
+		groups = append(groups, group.clone())
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Name < groups[j].Name
+	})
+
+	return groups
+}
+
+// AddMembers adds devices to a group, ignoring those already in it.
+func (gs *GroupStore) AddMembers(name string, devices ...string) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	group, exists := gs.Groups[name]
+	if !exists {
+		return fmt.Errorf("group '%s' not found", name)
+	}
+
+	group.Members = normalizeMembers(append(group.Members, devices...))
+	return gs.save()
+}
+
+func (gs *GroupStore) RemoveMember(name, device string) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	group, exists := gs.Groups[name]
+	if !exists {
+		return fmt.Errorf("group '%s' not found", name)
+	}
+	i := slices.Index(group.Members, device)
+	if i < 0 {
+		return fmt.Errorf("device '%s' is not in group '%s'", device, name)
+	}
+
+	group.Members = slices.Delete(group.Members, i, i+1)
+	return gs.save()
+}
+
+// RenameMember follows a device rename in every group; an empty newName
+// removes the device from them.
+func (gs *GroupStore) RenameMember(oldName, newName string) error {
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+
+	changed := false
+	for _, group := range gs.Groups {
+		i := slices.Index(group.Members, oldName)
+		if i < 0 {
+			continue
+		}
+		if newName == "" {
+			group.Members = slices.Delete(group.Members, i, i+1)
+		} else {
+			group.Members[i] = newName
+			group.Members = normalizeMembers(group.Members)
+		}
+		changed = true
+	}
+
+	if !changed {
+		return nil
+	}
+	return gs.save()
+}
+
+// normalizeMembers trims, sorts and de-duplicates device names.
+func normalizeMembers(members []string) []string {
+	normalized := make([]string, 0, len(members))
+	for _, member := range members {
+		if member = strings.TrimSpace(member); member != "" {
+			normalized = append(normalized, member)
+		}
+	}
+	sort.Strings(normalized)
+	return slices.Compact(normalized)
+}
+
+// Reload replaces the groups in memory with the contents of the file,
+// picking up changes written by another node.
+func (gs *GroupStore) Reload() error {
+	fresh := &GroupStore{configPath: gs.configPath, shared: gs.shared}
+	if err := fresh.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to reload group store: %w", err)
+	}
+	if fresh.Groups == nil {
+		fresh.Groups = make(map[string]*Group)
+	}
+
+	gs.mu.Lock()
+	defer gs.mu.Unlock()
+	gs.Groups = fresh.Groups
+	return nil
+}
+
+func (gs *GroupStore) load() error {
+	var data []byte
+	var err error
+	if gs.shared != nil {
+		data, err = gs.shared.ReadFile()
+	} else {
+		data, err = os.ReadFile(gs.configPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, gs)
+}
+
+func (gs *GroupStore) save() error {
+	data, err := json.MarshalIndent(gs, "", "	")
+	if err != nil {
+		return fmt.Errorf("failed to marshal groups: %w", err)
+	}
+	if gs.shared != nil {
+		return gs.shared.WriteFile(data)
+	}
+
+	configDir := filepath.Dir(gs.configPath)
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	if err := os.WriteFile(gs.configPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write groups file: %w", err)
+	}
+
+	return nil
+}
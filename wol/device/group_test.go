@@ -0,0 +1,102 @@
+package wol_device
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestGroupStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "groups.json")
+	store, err := NewGroupStore(path)
+	if err != nil {
+		t.Fatalf("NewGroupStore() error = %v", err)
+	}
+
+	if err := store.CreateGroup(&Group{Name: " "}); err == nil {
+		t.Error("CreateGroup() with an empty name should fail")
+	}
+	if err := store.CreateGroup(&Group{Name: "lab", Members: []string{"pc2", " pc1", "pc2"}}); err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+	if err := store.CreateGroup(&Group{Name: "lab"}); err == nil {
+		t.Error("CreateGroup() of an existing group should fail")
+	}
+
+	if err := store.AddMembers("lab", "pc3", "pc1"); err != nil {
+		t.Fatalf("AddMembers() error = %v", err)
+	}
+	if err := store.AddMembers("rack", "pc1"); err == nil {
+		t.Error("AddMembers() to a missing group should fail")
+	}
+
+	reopened, err := NewGroupStore(path)
+	if err != nil {
+		t.Fatalf("NewGroupStore() error = %v", err)
+	}
+	group, err := reopened.GetGroup("lab")
+	if err != nil {
+		t.Fatalf("GetGroup() error = %v", err)
+	}
+	if want := []string{"pc1", "pc2", "pc3"}; !slices.Equal(group.Members, want) {
+		t.Errorf("Members = %v, want %v", group.Members, want)
+	}
+
+	// Changing the returned copy does not change the store
+	group.Members[0] = "changed"
+	if again, _ := reopened.GetGroup("lab"); again.Members[0] != "pc1" {
+		t.Error("GetGroup() returned the stored group instead of a copy")
+	}
+
+	if err := reopened.RemoveMember("lab", "pc2"); err != nil {
+		t.Fatalf("RemoveMember() error = %v", err)
+	}
+	if err := reopened.RemoveMember("lab", "pc2"); err == nil {
+		t.Error("RemoveMember() of a device not in the group should fail")
+	}
+
+	if err := reopened.RemoveGroup("lab"); err != nil {
+		t.Fatalf("RemoveGroup() error = %v", err)
+	}
+	if len(reopened.ListGroups()) != 0 {
+		t.Error("RemoveGroup() left the group")
+	}
+
+	// The first store still has the group until it reloads
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(store.ListGroups()) != 0 {
+		t.Error("Reload() kept a group removed by another store")
+	}
+}
+
+func TestGroupStore_RenameMember(t *testing.T) {
+	store, err := NewGroupStore(filepath.Join(t.TempDir(), "groups.json"))
+	if err != nil {
+		t.Fatalf("NewGroupStore() error = %v", err)
+	}
+	store.CreateGroup(&Group{Name: "lab", Members: []string{"a", "b"}})
+	store.CreateGroup(&Group{Name: "office", Members: []string{"b", "c"}})
+
+	tests := []struct {
+		oldName, newName string
+		want             map[string][]string
+	}{
+		{"b", "z", map[string][]string{"lab": {"a", "z"}, "office": {"c", "z"}}},
+		{"z", "", map[string][]string{"lab": {"a"}, "office": {"c"}}},
+		{"missing", "x", map[string][]string{"lab": {"a"}, "office": {"c"}}},
+	}
+
+	for _, tt := range tests {
+		if err := store.RenameMember(tt.oldName, tt.newName); err != nil {
+			t.Fatalf("RenameMember(%q, %q) error = %v", tt.oldName, tt.newName, err)
+		}
+		for name, want := range tt.want {
+			group, _ := store.GetGroup(name)
+			if !slices.Equal(group.Members, want) {
+				t.Errorf("after RenameMember(%q, %q) %s = %v, want %v", tt.oldName, tt.newName, name, group.Members, want)
+			}
+		}
+	}
+}
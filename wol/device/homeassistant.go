@@ -0,0 +1,55 @@
+package wol_device
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportHomeAssistant writes the devices, leaving out archived ones, as a
+// Home Assistant configuration.yaml switch section using the wake_on_lan
+// platform. Home Assistant pings a device's IP address, when it has one,
+// to show whether the switch is on.
+func (ds *DeviceStore) ExportHomeAssistant(w io.Writer) error {
+	buf := bufio.NewWriter(w)
+	devices := ds.ListDevices()
+
+	fmt.Fprintln(buf, "# Generated by wol-server; paste into configuration.yaml")
+	if len(devices) == 0 {
+		fmt.Fprintln(buf, "switch: []")
+	} else {
+		fmt.Fprintln(buf, "switch:")
+	}
+	for _, device := range devices {
+		fmt.Fprintln(buf, "  - platform: wake_on_lan")
+		fmt.Fprintf(buf, "    name: %s\n", quote(device.Name))
+		fmt.Fprintf(buf, "    mac: %s\n", quote(device.MACAddress))
+		if device.IPAddress != "" {
+			fmt.Fprintf(buf, "    host: %s\n", quote(device.IPAddress))
+		}
+		if device.BroadcastAddress != "" {
+			fmt.Fprintf(buf, "    broadcast_address: %s\n", quote(device.BroadcastAddress))
+		}
+		if device.Port != 0 && device.Port != 9 {
+			fmt.Fprintf(buf, "    broadcast_port: %d\n", device.Port)
+		}
+	}
+
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write Home Assistant configuration: %w", err)
+	}
+	return nil
+}
+
+// quote writes s as a JSON string, which is also a valid YAML
+// double-quoted string.
+func quote(s string) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(s)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
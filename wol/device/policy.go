@@ -0,0 +1,96 @@
+package wol_device
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// WakePolicy holds a device's own wake settings, for hardware that needs
+// more retries, other ports or a longer boot than the rest. Zero fields use
+// the global settings; command line flags and request parameters override
+// the policy.
+type WakePolicy struct {
+	Retries    int   `json:"retries,omitempty"`
+	ExtraPorts []int `json:"extra_ports,omitempty"`
+	Copies     int   `json:"copies,omitempty"`
+	// VerifyPing turns the TCP reachability check on or off; nil leaves it
+	// to the -verify-ping flag
+	VerifyPing *bool `json:"verify_ping,omitempty"`
+	// WaitTimeout waits this long for the device to come online after
+	// waking it
+	WaitTimeout Duration `json:"wait_timeout,omitempty"`
+}
+
+// Duration is a time.Duration kept as a string such as "90s", so device
+// files stay readable.
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("invalid duration %s (expected a string such as \"90s\")", data)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return fmt.Errorf("invalid duration %q: %w", s, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (p *WakePolicy) Validate() error {
+	if p.Retries < 0 {
+		return fmt.Errorf("invalid retries %d", p.Retries)
+	}
+	if p.Copies < 0 {
+		return fmt.Errorf("invalid copies %d", p.Copies)
+	}
+	for _, port := range p.ExtraPorts {
+		if port < 1 || port > 65535 {
+			return fmt.Errorf("invalid port %d", port)
+		}
+	}
+	if p.WaitTimeout < 0 {
+		return fmt.Errorf("invalid wait timeout %s", time.Duration(p.WaitTimeout))
+	}
+	return nil
+}
+
+func (p *WakePolicy) clone() *WakePolicy {
+	if p == nil {
+		return nil
+	}
+	c := *p
+	c.ExtraPorts = slices.Clone(p.ExtraPorts)
+	if p.VerifyPing != nil {
+		verifyPing := *p.VerifyPing
+		c.VerifyPing = &verifyPing
+	}
+	return &c
+}
+
+// IsZero reports whether the policy sets nothing.
+func (p *WakePolicy) IsZero() bool {
+	return p == nil || (p.Retries == 0 && len(p.ExtraPorts) == 0 && p.Copies == 0 && p.VerifyPing == nil && p.WaitTimeout == 0)
+}
+
+// SetDeviceWakePolicy sets the device's wake policy; nil or an empty policy
+// removes it.
+func (ds *DeviceStore) SetDeviceWakePolicy(name string, policy *WakePolicy) error {
+	if policy.IsZero() {
+		policy = nil
+	} else if err := policy.Validate(); err != nil {
+		return err
+	}
+
+	return ds.modify(name, func(device *Device) error {
+		device.Policy = policy
+		return nil
+	})
+}
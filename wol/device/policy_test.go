@@ -0,0 +1,86 @@
+package wol_device
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWakePolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  WakePolicy
+		wantErr bool
+	}{
+		{"valid", WakePolicy{Retries: 3, ExtraPorts: []int{7}, Copies: 2, WaitTimeout: Duration(time.Minute)}, false},
+		{"negative retries", WakePolicy{Retries: -1}, true},
+		{"negative copies", WakePolicy{Copies: -1}, true},
+		{"bad port", WakePolicy{ExtraPorts: []int{70000}}, true},
+		{"negative wait", WakePolicy{WaitTimeout: Duration(-time.Second)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.policy.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDuration_JSON(t *testing.T) {
+	data, err := json.Marshal(Duration(90 * time.Second))
+	if err != nil || string(data) != `"1m30s"` {
+		t.Errorf("Marshal() = %s, %v, want \"1m30s\"", data, err)
+	}
+
+	var d Duration
+	if err := json.Unmarshal([]byte(`"2m"`), &d); err != nil || time.Duration(d) != 2*time.Minute {
+		t.Errorf("Unmarshal(\"2m\") = %v, %v", time.Duration(d), err)
+	}
+	for _, invalid := range []string{`90`, `"soon"`} {
+		if err := json.Unmarshal([]byte(invalid), &d); err == nil {
+			t.Errorf("Unmarshal(%s) expected error", invalid)
+		}
+	}
+}
+
+func TestDeviceStore_SetDeviceWakePolicy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.yaml")
+	store, err := NewDeviceStore(DeviceConfig{ConfigPath: path})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	store.AddDevice("nas", "AA:BB:CC:DD:EE:01", "", "", 9)
+
+	on := true
+	policy := &WakePolicy{Retries: 5, ExtraPorts: []int{7}, VerifyPing: &on, WaitTimeout: Duration(2 * time.Minute)}
+	if err := store.SetDeviceWakePolicy("nas", policy); err != nil {
+		t.Fatalf("SetDeviceWakePolicy() error = %v", err)
+	}
+	if err := store.SetDeviceWakePolicy("nas", &WakePolicy{Copies: -2}); err == nil {
+		t.Error("SetDeviceWakePolicy() expected error for an invalid policy")
+	}
+
+	// Changing the caller's policy must not change the stored one
+	policy.ExtraPorts[0] = 9
+	*policy.VerifyPing = false
+
+	reopened, err := NewDeviceStore(DeviceConfig{ConfigPath: path})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	device, _ := reopened.GetDevice("nas")
+	if device.Policy == nil || device.Policy.Retries != 5 || device.Policy.ExtraPorts[0] != 7 ||
+		!*device.Policy.VerifyPing || time.Duration(device.Policy.WaitTimeout) != 2*time.Minute {
+		t.Errorf("Policy = %+v", device.Policy)
+	}
+
+	if err := store.SetDeviceWakePolicy("nas", &WakePolicy{}); err != nil {
+		t.Fatalf("SetDeviceWakePolicy() error = %v", err)
+	}
+	if device, _ := store.GetDevice("nas"); device.Policy != nil {
+		t.Errorf("Policy = %+v after setting an empty one, want nil", device.Policy)
+	}
+}
@@ -0,0 +1,253 @@
+package wol_device
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// BackendRedis is the name of the RedisStore backend.
+const BackendRedis = "redis"
+
+const (
+	redisDevicesKey = "wol:devices"
+	// RedisGroupsKey and RedisSchedulesKey hold the groups and schedules
+	// files of servers that keep their devices in Redis
+	RedisGroupsKey    = "wol:groups"
+	RedisSchedulesKey = "wol:schedules"
+
+	redisTimeout = 5 * time.Second
+)
+
+// redisUpdate replaces a device only if it exists, in one round trip.
+var redisUpdate = redis.NewScript(`
+if redis.call("HEXISTS", KEYS[1], ARGV[1]) == 0 then
+	return 0
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+return 1
+`)
+
+// RedisStore keeps devices in a Redis hash, one JSON record per device, so
+// every server pointed at the same Redis, such as the nodes of a
+// high-availability pair on different subnets, sees the same devices.
+type RedisStore struct {
+	client *redis.Client
+	// key encrypts each record; nil keeps them in plain text
+	key *StoreKey
+}
+
+func init() {
+	RegisterBackend(BackendRedis, func(config DeviceConfig) (Store, error) {
+		if config.URL == "" {
+			return nil, fmt.Errorf("the %s backend needs the server's URL", BackendRedis)
+		}
+		store, err := OpenRedisStore(config.URL, config.Key)
+		if err != nil {
+			return nil, err
+		}
+		// The first time, import the device file Redis replaces
+		if _, err := MigrateEncryptedJSON(store, config.ConfigPath, config.Key); err != nil {
+			store.Close()
+			return nil, err
+		}
+		return store, nil
+	})
+}
+
+// OpenRedis connects to the Redis server at url, such as
+// redis://:password@host:6379/0.
+func OpenRedis(url string) (*redis.Client, error) {
+	opts, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Redis URL: %w", err)
+	}
+
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("failed to connect to Redis at %s: %w", opts.Addr, err)
+	}
+	return client, nil
+}
+
+// OpenRedisStore connects to the Redis server at url, encrypting the
+// devices with key unless it is nil.
+func OpenRedisStore(url string, key *StoreKey) (*RedisStore, error) {
+	client, err := OpenRedis(url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisStore{client: client, key: key}, nil
+}
+
+func (s *RedisStore) Add(device *Device) error {
+	data, err := encodeRecord(device, s.key)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	added, err := s.client.HSetNX(ctx, redisDevicesKey, device.Name, data).Result()
+	if err != nil {
+		return fmt.Errorf("failed to add device '%s': %w", device.Name, err)
+	}
+	if !added {
+		return fmt.Errorf("device '%s' already exists", device.Name)
+	}
+	return nil
+}
+
+func (s *RedisStore) Get(name string) (*Device, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	data, err := s.client.HGet(ctx, redisDevicesKey, name).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("device '%s' not found", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read device '%s': %w", name, err)
+	}
+	return decodeRecord(data, s.key)
+}
+
+func (s *RedisStore) List() ([]*Device, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	records, err := s.client.HGetAll(ctx, redisDevicesKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list devices: %w", err)
+	}
+
+	devices := make([]*Device, 0, len(records))
+	for _, data := range records {
+		device, err := decodeRecord([]byte(data), s.key)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, device)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Name < devices[j].Name
+	})
+	return devices, nil
+}
+
+func (s *RedisStore) Remove(name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	removed, err := s.client.HDel(ctx, redisDevicesKey, name).Result()
+	if err != nil {
+		return fmt.Errorf("failed to remove device '%s': %w", name, err)
+	}
+	if removed == 0 {
+		return fmt.Errorf("device '%s' not found", name)
+	}
+	return nil
+}
+
+func (s *RedisStore) Update(device *Device) error {
+	data, err := encodeRecord(device, s.key)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	updated, err := redisUpdate.Run(ctx, s.client, []string{redisDevicesKey}, device.Name, data).Int()
+	if err != nil {
+		return fmt.Errorf("failed to update device '%s': %w", device.Name, err)
+	}
+	if updated == 0 {
+		return fmt.Errorf("device '%s' not found", device.Name)
+	}
+	return nil
+}
+
+// Replace swaps every device for devices in one MULTI transaction.
+func (s *RedisStore) Replace(devices []*Device) error {
+	records := make(map[string]any, len(devices))
+	for _, device := range devices {
+		data, err := encodeRecord(device, s.key)
+		if err != nil {
+			return err
+		}
+		records[device.Name] = data
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, redisDevicesKey)
+		if len(records) > 0 {
+			pipe.HSet(ctx, redisDevicesKey, records)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to replace devices: %w", err)
+	}
+	return nil
+}
+
+// Save does nothing: every change is written as it is made.
+func (s *RedisStore) Save() error {
+	return nil
+}
+
+func (s *RedisStore) Close() error {
+	return s.client.Close()
+}
+
+// RedisFile keeps the contents of a file, such as the groups or schedules
+// of servers sharing a RedisStore, in one Redis key.
+type RedisFile struct {
+	client *redis.Client
+	key    string
+}
+
+// OpenRedisFile connects to the Redis server at url for the file kept in
+// key.
+func OpenRedisFile(url, key string) (*RedisFile, error) {
+	client, err := OpenRedis(url)
+	if err != nil {
+		return nil, err
+	}
+	return &RedisFile{client: client, key: key}, nil
+}
+
+// ReadFile returns the contents, or an os.ErrNotExist error if the key is
+// not set.
+func (f *RedisFile) ReadFile() ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	data, err := f.client.Get(ctx, f.key).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("redis key %s: %w", f.key, os.ErrNotExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read redis key %s: %w", f.key, err)
+	}
+	return data, nil
+}
+
+func (f *RedisFile) WriteFile(data []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+	if err := f.client.Set(ctx, f.key, data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to write redis key %s: %w", f.key, err)
+	}
+	return nil
+}
+
+func (f *RedisFile) Close() error {
+	return f.client.Close()
+}
@@ -0,0 +1,156 @@
+package wol_device
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestRedisStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	url := "redis://" + server.Addr()
+
+	store, err := OpenRedisStore(url, nil)
+	if err != nil {
+		t.Fatalf("OpenRedisStore() error = %v", err)
+	}
+	defer store.Close()
+
+	if err := store.Add(&Device{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := store.Add(&Device{Name: "desktop", MACAddress: "AA:BB:CC:DD:EE:02"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := store.Add(&Device{Name: "nas"}); err == nil {
+		t.Error("Add() accepted a duplicate name")
+	}
+	if err := store.Update(&Device{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01", Description: "Storage"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := store.Update(&Device{Name: "printer"}); err == nil {
+		t.Error("Update() accepted an unknown device")
+	}
+	if err := store.Remove("printer"); err == nil {
+		t.Error("Remove() accepted an unknown device")
+	}
+
+	// A second server sees the same devices
+	other, err := OpenRedisStore(url, nil)
+	if err != nil {
+		t.Fatalf("OpenRedisStore() error = %v", err)
+	}
+	defer other.Close()
+
+	devices, err := other.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(devices) != 2 || devices[0].Name != "desktop" || devices[1].Name != "nas" {
+		t.Fatalf("List() = %v, want desktop and nas", devices)
+	}
+	if nas, _ := other.Get("nas"); nas == nil || nas.Description != "Storage" {
+		t.Errorf("Get() = %+v, want the updated device", nas)
+	}
+
+	if err := other.Remove("nas"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := store.Get("nas"); err == nil {
+		t.Error("Get() found a device removed by the other server")
+	}
+
+	if err := store.Replace([]*Device{{Name: "printer", MACAddress: "AA:BB:CC:DD:EE:03"}}); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	if devices, _ := other.List(); len(devices) != 1 || devices[0].Name != "printer" {
+		t.Errorf("List() after Replace() = %v, want only printer", devices)
+	}
+	if err := store.Replace(nil); err != nil {
+		t.Fatalf("Replace() error = %v", err)
+	}
+	if devices, _ := other.List(); len(devices) != 0 {
+		t.Errorf("List() after Replace(nil) = %v, want none", devices)
+	}
+}
+
+func TestRedisStore_Encrypted(t *testing.T) {
+	server := miniredis.RunT(t)
+	key, err := NewPassphraseKey("correct horse battery staple")
+	if err != nil {
+		t.Fatalf("NewPassphraseKey() error = %v", err)
+	}
+
+	store, err := OpenRedisStore("redis://"+server.Addr(), key)
+	if err != nil {
+		t.Fatalf("OpenRedisStore() error = %v", err)
+	}
+	defer store.Close()
+	if err := store.Add(&Device{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01", SecureOn: "hunter2"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if data := server.HGet(redisDevicesKey, "nas"); bytes.Contains([]byte(data), []byte("hunter2")) {
+		t.Error("device record is stored in plain text")
+	}
+	if device, err := store.Get("nas"); err != nil || device.SecureOn != "hunter2" {
+		t.Errorf("Get() = %+v, %v, want the decrypted device", device, err)
+	}
+}
+
+func TestRedisBackend(t *testing.T) {
+	server := miniredis.RunT(t)
+	configPath := filepath.Join(t.TempDir(), "devices.json")
+	source, err := OpenFileStore(configPath)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error = %v", err)
+	}
+	source.Add(&Device{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01"})
+
+	if _, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath, Backend: BackendRedis}); err == nil {
+		t.Error("NewDeviceStore() opened the redis backend without a URL")
+	}
+
+	store, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath, Backend: BackendRedis, URL: "redis://" + server.Addr()})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	defer store.Close()
+	if !store.DeviceExists("nas") {
+		t.Error("device file was not imported")
+	}
+	if _, err := os.Stat(configPath + ".migrated"); err != nil {
+		t.Errorf("device file was not renamed: %v", err)
+	}
+}
+
+func TestRedisFile_SharedGroupStore(t *testing.T) {
+	server := miniredis.RunT(t)
+	open := func() *GroupStore {
+		t.Helper()
+		shared, err := OpenRedisFile("redis://"+server.Addr(), RedisGroupsKey)
+		if err != nil {
+			t.Fatalf("OpenRedisFile() error = %v", err)
+		}
+		t.Cleanup(func() { shared.Close() })
+		groups, err := NewSharedGroupStore(shared)
+		if err != nil {
+			t.Fatalf("NewSharedGroupStore() error = %v", err)
+		}
+		return groups
+	}
+
+	leader, standby := open(), open()
+	if err := leader.CreateGroup(&Group{Name: "lab", Members: []string{"nas"}}); err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+	if err := standby.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if group, err := standby.GetGroup("lab"); err != nil || len(group.Members) != 1 {
+		t.Errorf("GetGroup() = %+v, %v, want the group the other server created", group, err)
+	}
+}
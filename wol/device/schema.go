@@ -0,0 +1,68 @@
+package wol_device
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// SchemaVersion is the version of the device file layout this build
+// writes. Bump it, and add a migration, whenever a change to the file would
+// make an older build misread it.
+const SchemaVersion = 1
+
+// migrations[v] upgrades a decoded device file from version v to v+1. They
+// work on the generic tree so they can rename, move or convert fields that
+// the current structs no longer have.
+var migrations = []func(tree map[string]any) error{
+	// 0 is every file written before the schema was versioned; its layout
+	// is the same as version 1
+	func(tree map[string]any) error { return nil },
+}
+
+// decodeFileStore parses a device file of any supported version into fresh.
+// Files from a newer build, and fields this build does not know, are
+// refused rather than dropped on the next save.
+func decodeFileStore(format fileFormat, data []byte, fresh *FileStore) error {
+	var tree map[string]any
+	if err := format.unmarshal(data, &tree); err != nil {
+		return err
+	}
+	if tree == nil {
+		tree = make(map[string]any)
+	}
+
+	version := 0
+	if raw, ok := tree["schema_version"]; ok {
+		number, ok := raw.(float64)
+		if !ok || number != float64(int(number)) || number < 0 {
+			return fmt.Errorf("invalid schema_version %v", raw)
+		}
+		version = int(number)
+	}
+	if version > SchemaVersion {
+		return fmt.Errorf("device file has schema version %d, newer than the %d this version supports; upgrade wol-server", version, SchemaVersion)
+	}
+
+	for ; version < SchemaVersion; version++ {
+		if err := migrations[version](tree); err != nil {
+			return fmt.Errorf("failed to migrate device file from schema version %d: %w", version, err)
+		}
+	}
+	tree["schema_version"] = SchemaVersion
+
+	encoded, err := json.Marshal(tree)
+	if err != nil {
+		return err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(fresh); err != nil {
+		if strings.HasPrefix(err.Error(), "json: unknown field") {
+			return fmt.Errorf("%w; refusing to load it, it would be lost on the next save", err)
+		}
+		return err
+	}
+	return nil
+}
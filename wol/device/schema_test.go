@@ -0,0 +1,106 @@
+package wol_device
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenFileStore_SchemaVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		wantErr string
+	}{
+		{
+			name:    "unversioned file",
+			file:    "devices.json",
+			content: `{"devices":{"pc":{"name":"pc","mac_address":"AA:BB:CC:DD:EE:01","added_at":"2024-01-01T00:00:00Z"}}}`,
+		},
+		{
+			name:    "current version",
+			file:    "devices.json",
+			content: `{"schema_version":1,"devices":{"pc":{"name":"pc","mac_address":"AA:BB:CC:DD:EE:01","added_at":"2024-01-01T00:00:00Z"}}}`,
+		},
+		{
+			name:    "current version in YAML",
+			file:    "devices.yaml",
+			content: "schema_version: 1\ndevices:\n  pc:\n    name: pc\n    mac_address: AA:BB:CC:DD:EE:01\n    added_at: 2024-01-01T00:00:00Z\n",
+		},
+		{
+			name:    "newer version",
+			file:    "devices.json",
+			content: `{"schema_version":2,"devices":{}}`,
+			wantErr: "newer",
+		},
+		{
+			name:    "invalid version",
+			file:    "devices.json",
+			content: `{"schema_version":"one","devices":{}}`,
+			wantErr: "invalid schema_version",
+		},
+		{
+			name:    "unknown top-level field",
+			file:    "devices.json",
+			content: `{"schema_version":1,"groups":{},"devices":{}}`,
+			wantErr: `unknown field "groups"`,
+		},
+		{
+			name:    "unknown device field",
+			file:    "devices.json",
+			content: `{"devices":{"pc":{"name":"pc","mac_address":"AA:BB:CC:DD:EE:01","password":"x"}}}`,
+			wantErr: `unknown field "password"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write file: %v", err)
+			}
+
+			store, err := OpenFileStore(path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("OpenFileStore() error = %v, want one containing %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("OpenFileStore() error = %v", err)
+			}
+			if _, err := store.Get("pc"); err != nil {
+				t.Errorf("Get() error = %v", err)
+			}
+		})
+	}
+}
+
+func TestFileStore_SaveWritesSchemaVersion(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	if err := os.WriteFile(path, []byte(`{"devices":{}}`), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error = %v", err)
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(string(data), `"schema_version": 1`) {
+		t.Errorf("Saved file = %s, want schema_version 1", data)
+	}
+}
+
+func TestMigrations_CoverEveryVersion(t *testing.T) {
+	if len(migrations) != SchemaVersion {
+		t.Errorf("%d migrations for schema version %d; every version below the current one needs one", len(migrations), SchemaVersion)
+	}
+}
@@ -0,0 +1,233 @@
+package wol_device
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	wol_packet "wol-server/wol/packet"
+)
+
+// Filter selects devices for Search. A device must match every field that
+// is set.
+type Filter struct {
+	// Text are substrings that must each appear in the device's name or
+	// description, ignoring case
+	Text []string
+	// MACPrefix matches the start of the MAC address, in any notation
+	MACPrefix string
+	Tags      []string
+	// Status is StatusOnline, StatusOffline or StatusUnknown
+	Status  string
+	Archive ArchiveScope
+	// Names, unless nil, are the only devices that can match, such as the
+	// members of a group
+	Names []string
+	// Group names a group whose members are the only devices that can
+	// match; ResolveGroup turns it into Names
+	Group string
+}
+
+// ArchiveScope is whether a Filter selects archived devices.
+type ArchiveScope int
+
+const (
+	HideArchived ArchiveScope = iota
+	OnlyArchived
+	WithArchived
+)
+
+// ParseFilter reads a search query of space-separated terms: tag:<tag>,
+// mac:<prefix>, status:<online|offline|unknown> and group:<name> select by
+// those fields and any other term is text to look for, as in "nas
+// tag:office status:online". A group term is left for ResolveGroup.
+func ParseFilter(query string) (Filter, error) {
+	var filter Filter
+	for _, term := range strings.Fields(query) {
+		key, value, ok := strings.Cut(term, ":")
+		if !ok || value == "" {
+			filter.Text = append(filter.Text, term)
+			continue
+		}
+
+		switch strings.ToLower(key) {
+		case "tag":
+			filter.Tags = append(filter.Tags, strings.Split(value, ",")...)
+		case "mac":
+			filter.MACPrefix = value
+		case "status":
+			status, err := ParseStatus(value)
+			if err != nil {
+				return Filter{}, err
+			}
+			filter.Status = status
+		case "group":
+			filter.Group = value
+		default:
+			// Not a known field: a MAC address or IPv6 literal typed as
+			// text, for example
+			filter.Text = append(filter.Text, term)
+		}
+	}
+	filter.Tags = NormalizeTags(filter.Tags)
+	return filter, nil
+}
+
+// ResolveGroup limits the filter to the members of its Group, if it names
+// one; groups is nil when groups are not enabled.
+func (f *Filter) ResolveGroup(groups *GroupStore) error {
+	if f.Group == "" {
+		return nil
+	}
+	if groups == nil {
+		return fmt.Errorf("device groups are not enabled")
+	}
+	group, err := groups.GetGroup(f.Group)
+	if err != nil {
+		return err
+	}
+	f.Names = slices.Clone(group.Members)
+	if f.Names == nil {
+		f.Names = []string{}
+	}
+	return nil
+}
+
+// ParseStatus checks that status is one a Filter can select by.
+func ParseStatus(status string) (string, error) {
+	status = strings.ToLower(status)
+	if status != StatusOnline && status != StatusOffline && status != StatusUnknown {
+		return "", fmt.Errorf("invalid status %q (valid: online, offline, unknown)", status)
+	}
+	return status, nil
+}
+
+// Matches reports whether device passes every part of the filter.
+func (f Filter) Matches(device *Device) bool {
+	for _, text := range f.Text {
+		text = strings.ToLower(text)
+		if !strings.Contains(strings.ToLower(device.Name), text) && !strings.Contains(strings.ToLower(device.Description), text) {
+			return false
+		}
+	}
+
+	if f.Names != nil && !slices.Contains(f.Names, device.Name) {
+		return false
+	}
+
+	if f.MACPrefix != "" && !strings.HasPrefix(wol_packet.CleanMAC(device.MACAddress), wol_packet.CleanMAC(f.MACPrefix)) {
+		return false
+	}
+
+	if f.Status != "" {
+		status := device.Status
+		if status == "" {
+			status = StatusUnknown
+		}
+		if status != f.Status {
+			return false
+		}
+	}
+
+	switch {
+	case f.Archive == HideArchived && device.Archived:
+		return false
+	case f.Archive == OnlyArchived && !device.Archived:
+		return false
+	}
+
+	return device.HasTags(f.Tags...)
+}
+
+// Search returns the devices matching filter, sorted by name.
+func (ds *DeviceStore) Search(filter Filter) []*Device {
+	ds.mu.RLock()
+	defer ds.mu.RUnlock()
+
+	devices, err := ds.store.List()
+	if err != nil {
+		return nil
+	}
+
+	matched := devices[:0]
+	for _, device := range devices {
+		if device = ds.format(device); filter.Matches(device) {
+			matched = append(matched, device)
+		}
+	}
+	return matched
+}
+
+const (
+	SortByName      = "name"
+	SortByAdded     = "added"
+	SortByLastWoken = "last-woken"
+	SortByLastSeen  = "last-seen"
+)
+
+// ListOptions selects, orders and pages devices for ListDevicesWith.
+type ListOptions struct {
+	Filter Filter
+	// SortBy is SortByName (the default), SortByAdded, SortByLastWoken or
+	// SortByLastSeen;
+	// ties are broken by name, so pages do not shift between requests
+	SortBy     string
+	Descending bool
+	// Offset skips that many devices and Limit returns at most that many;
+	// 0 returns them all
+	Offset int
+	Limit  int
+}
+
+func ParseSortBy(sortBy string) (string, error) {
+	switch strings.ToLower(sortBy) {
+	case "", SortByName:
+		return SortByName, nil
+	case SortByAdded, "added-at":
+		return SortByAdded, nil
+	case SortByLastWoken, "last_woken", "woken":
+		return SortByLastWoken, nil
+	case SortByLastSeen, "last_seen", "seen":
+		return SortByLastSeen, nil
+	default:
+		return "", fmt.Errorf("invalid sort %q (valid: name, added, last-woken, last-seen)", sortBy)
+	}
+}
+
+// ListDevicesWith returns one page of the devices matching opts.Filter in
+// the requested order, and how many devices matched in total.
+func (ds *DeviceStore) ListDevicesWith(opts ListOptions) ([]*Device, int, error) {
+	sortBy, err := ParseSortBy(opts.SortBy)
+	if err != nil {
+		return nil, 0, err
+	}
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return nil, 0, fmt.Errorf("offset and limit cannot be negative")
+	}
+
+	devices := ds.Search(opts.Filter)
+	slices.SortStableFunc(devices, func(a, b *Device) int {
+		order := 0
+		switch sortBy {
+		case SortByAdded:
+			order = a.AddedAt.Compare(b.AddedAt)
+		case SortByLastWoken:
+			order = a.LastWoken.Compare(b.LastWoken)
+		case SortByLastSeen:
+			order = a.LastSeen.Compare(b.LastSeen)
+		}
+		if order == 0 {
+			order = strings.Compare(a.Name, b.Name)
+		}
+		if opts.Descending {
+			return -order
+		}
+		return order
+	})
+
+	total := len(devices)
+	devices = devices[min(opts.Offset, total):]
+	if opts.Limit > 0 && opts.Limit < len(devices) {
+		devices = devices[:opts.Limit]
+	}
+	return devices, total, nil
+}
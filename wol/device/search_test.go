@@ -0,0 +1,242 @@
+package wol_device
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDeviceStore_Search(t *testing.T) {
+	store := createTestStore(t)
+	devices := []struct {
+		name, mac, description string
+		tags                   []string
+	}{
+		{"desktop", "AA:BB:CC:00:00:01", "Gaming PC", []string{"office"}},
+		{"nas", "AA:BB:CC:00:00:02", "Storage in the basement", []string{"office", "storage"}},
+		{"laptop", "11:22:33:00:00:03", "", nil},
+	}
+	for _, d := range devices {
+		if err := store.AddDevice(d.name, d.mac, d.description, "", 9); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+		if err := store.SetDeviceTags(d.name, d.tags); err != nil {
+			t.Fatalf("Failed to tag device: %v", err)
+		}
+	}
+	if err := store.UpdateStatus("nas", true, time.Now()); err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+	if err := store.UpdateStatus("desktop", false, time.Now()); err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"desktop", "laptop", "nas"}},
+		{"top", []string{"desktop", "laptop"}},
+		{"BASEMENT", []string{"nas"}},
+		{"top gaming", []string{"desktop"}},
+		{"mac:aa-bb-cc", []string{"desktop", "nas"}},
+		{"mac:112233", []string{"laptop"}},
+		{"tag:office", []string{"desktop", "nas"}},
+		{"tag:office,storage", []string{"nas"}},
+		{"status:online", []string{"nas"}},
+		{"status:unknown", []string{"laptop"}},
+		{"tag:office status:offline", []string{"desktop"}},
+		{"printer", nil},
+	}
+
+	for _, tt := range tests {
+		filter, err := ParseFilter(tt.query)
+		if err != nil {
+			t.Fatalf("ParseFilter(%q) error = %v", tt.query, err)
+		}
+
+		var got []string
+		for _, device := range store.Search(filter) {
+			got = append(got, device.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Search(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	names := []struct {
+		names []string
+		want  []string
+	}{
+		{nil, []string{"desktop", "laptop", "nas"}},
+		{[]string{}, nil},
+		{[]string{"nas", "laptop", "printer"}, []string{"laptop", "nas"}},
+	}
+	for _, tt := range names {
+		var got []string
+		for _, device := range store.Search(Filter{Names: tt.names}) {
+			got = append(got, device.Name)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("Search(Names: %v) = %v, want %v", tt.names, got, tt.want)
+		}
+	}
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, err := ParseFilter("nas  Tag:Office mac:AA:BB status:Online fe80::1")
+	if err != nil {
+		t.Fatalf("ParseFilter() error = %v", err)
+	}
+	if !slices.Equal(filter.Text, []string{"nas", "fe80::1"}) {
+		t.Errorf("Filter.Text = %v", filter.Text)
+	}
+	if filter.MACPrefix != "AA:BB" || filter.Status != StatusOnline || !slices.Equal(filter.Tags, []string{"Office"}) {
+		t.Errorf("ParseFilter() = %+v", filter)
+	}
+
+	if _, err := ParseFilter("status:sleeping"); err == nil {
+		t.Error("ParseFilter() accepted an invalid status")
+	}
+}
+
+func TestFilter_ResolveGroup(t *testing.T) {
+	groups, err := NewGroupStore(filepath.Join(t.TempDir(), "groups.json"))
+	if err != nil {
+		t.Fatalf("NewGroupStore() error = %v", err)
+	}
+	if err := groups.CreateGroup(&Group{Name: "lab", Members: []string{"alpha", "bravo"}}); err != nil {
+		t.Fatalf("CreateGroup() error = %v", err)
+	}
+
+	filter, err := ParseFilter("group:lab tag:office")
+	if err != nil {
+		t.Fatalf("ParseFilter() error = %v", err)
+	}
+	if filter.Group != "lab" || len(filter.Text) != 0 {
+		t.Fatalf("ParseFilter() = %+v, want group lab", filter)
+	}
+	if err := filter.ResolveGroup(groups); err != nil {
+		t.Fatalf("ResolveGroup() error = %v", err)
+	}
+	if !filter.Matches(&Device{Name: "alpha", Tags: []string{"office"}}) || filter.Matches(&Device{Name: "charlie", Tags: []string{"office"}}) {
+		t.Errorf("resolved filter Names = %v, want the members of lab", filter.Names)
+	}
+
+	unknown, _ := ParseFilter("group:attic")
+	if err := unknown.ResolveGroup(groups); err == nil {
+		t.Error("ResolveGroup() accepted an unknown group")
+	}
+	if err := unknown.ResolveGroup(nil); err == nil {
+		t.Error("ResolveGroup() without a group store should fail")
+	}
+	if plain, _ := ParseFilter("nas"); plain.ResolveGroup(nil) != nil {
+		t.Error("ResolveGroup() without a group term should do nothing")
+	}
+}
+
+func TestDeviceStore_ListDevicesWith(t *testing.T) {
+	store := createTestStore(t)
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := store.ReplaceDevices([]*Device{
+		{Name: "charlie", MACAddress: "AA:BB:CC:00:00:01", AddedAt: base, LastWoken: base.Add(time.Hour), LastSeen: base.Add(3 * time.Hour)},
+		{Name: "alpha", MACAddress: "AA:BB:CC:00:00:02", AddedAt: base.Add(time.Minute), LastSeen: base, Tags: []string{"office"}},
+		{Name: "bravo", MACAddress: "AA:BB:CC:00:00:03", AddedAt: base.Add(2 * time.Minute), LastWoken: base.Add(2 * time.Hour), Tags: []string{"office"}},
+		{Name: "delta", MACAddress: "AA:BB:CC:00:00:04", AddedAt: base.Add(time.Minute)},
+	}); err != nil {
+		t.Fatalf("Failed to add devices: %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		opts      ListOptions
+		want      []string
+		wantTotal int
+		wantErr   bool
+	}{
+		{"default", ListOptions{}, []string{"alpha", "bravo", "charlie", "delta"}, 4, false},
+		{"by name descending", ListOptions{Descending: true}, []string{"delta", "charlie", "bravo", "alpha"}, 4, false},
+		{"by added with name tiebreak", ListOptions{SortBy: SortByAdded}, []string{"charlie", "alpha", "delta", "bravo"}, 4, false},
+		{"by last woken descending", ListOptions{SortBy: SortByLastWoken, Descending: true}, []string{"bravo", "charlie", "delta", "alpha"}, 4, false},
+		{"by last seen", ListOptions{SortBy: "seen"}, []string{"bravo", "delta", "alpha", "charlie"}, 4, false},
+		{"page", ListOptions{Offset: 1, Limit: 2}, []string{"bravo", "charlie"}, 4, false},
+		{"last page", ListOptions{Offset: 3, Limit: 2}, []string{"delta"}, 4, false},
+		{"past the end", ListOptions{Offset: 10}, []string{}, 4, false},
+		{"filtered", ListOptions{Filter: Filter{Tags: []string{"office"}}, Limit: 1}, []string{"alpha"}, 2, false},
+		{"unknown sort", ListOptions{SortBy: "size"}, nil, 0, true},
+		{"negative limit", ListOptions{Limit: -1}, nil, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			devices, total, err := store.ListDevicesWith(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ListDevicesWith() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			names := []string{}
+			for _, device := range devices {
+				names = append(names, device.Name)
+			}
+			if !slices.Equal(names, tt.want) || total != tt.wantTotal {
+				t.Errorf("ListDevicesWith() = %v, %d; want %v, %d", names, total, tt.want, tt.wantTotal)
+			}
+		})
+	}
+}
+
+func TestDeviceStore_Archive(t *testing.T) {
+	store := createTestStore(t)
+	for i, name := range []string{"desktop", "garden-pi"} {
+		if err := store.AddDevice(name, fmt.Sprintf("AA:BB:CC:00:00:0%d", i+1), "", "", 9); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+	}
+	if err := store.UpdateLastWoken("garden-pi"); err != nil {
+		t.Fatalf("Failed to update last woken: %v", err)
+	}
+
+	if err := store.SetArchived("garden-pi", true); err != nil {
+		t.Fatalf("SetArchived() error = %v", err)
+	}
+	if err := store.SetArchived("garden-pi", true); err == nil {
+		t.Error("SetArchived() on an archived device should fail")
+	}
+
+	names := func(devices []*Device) []string {
+		var names []string
+		for _, device := range devices {
+			names = append(names, device.Name)
+		}
+		return names
+	}
+	if got := names(store.ListDevices()); !slices.Equal(got, []string{"desktop"}) {
+		t.Errorf("ListDevices() = %v, want [desktop]", got)
+	}
+	if got := names(store.Search(Filter{Archive: OnlyArchived})); !slices.Equal(got, []string{"garden-pi"}) {
+		t.Errorf("Search(OnlyArchived) = %v, want [garden-pi]", got)
+	}
+	if got := names(store.Search(Filter{Archive: WithArchived})); len(got) != 2 {
+		t.Errorf("Search(WithArchived) = %v, want both devices", got)
+	}
+
+	device, err := store.FindByMAC("AA:BB:CC:00:00:02")
+	if err != nil || !device.Archived || device.LastWoken.IsZero() {
+		t.Errorf("FindByMAC() = %+v, %v; want the archived device with its history", device, err)
+	}
+
+	if err := store.SetArchived("garden-pi", false); err != nil {
+		t.Fatalf("SetArchived(false) error = %v", err)
+	}
+	if store.GetDeviceCount() != 2 || len(store.ListDevices()) != 2 {
+		t.Error("Unarchived device should be listed again")
+	}
+	if err := store.SetArchived("garden-pi", false); err == nil {
+		t.Error("SetArchived(false) on a device that is not archived should fail")
+	}
+}
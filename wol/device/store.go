@@ -0,0 +1,301 @@
+package wol_device
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Store is where devices are kept. DeviceStore validates devices and
+// serializes access on top of it, so a Store needs neither; FileStore,
+// the devices.json file, is the default.
+type Store interface {
+	// Add stores a new device, failing if its name is taken
+	Add(device *Device) error
+	// Get returns a copy of the named device
+	Get(name string) (*Device, error)
+	// List returns copies of every device, sorted by name
+	List() ([]*Device, error)
+	Remove(name string) error
+	// Update replaces the stored device with the same name
+	Update(device *Device) error
+	// Save flushes the devices to persistent storage
+	Save() error
+}
+
+// BackendFile is the name of the FileStore backend.
+const BackendFile = "file"
+
+// Backend opens a Store for a DeviceConfig.
+type Backend func(config DeviceConfig) (Store, error)
+
+var (
+	backendsMu sync.Mutex
+	backends   = map[string]Backend{
+		BackendFile: func(config DeviceConfig) (Store, error) {
+			return OpenEncryptedFileStore(config.ConfigPath, config.Key)
+		},
+	}
+)
+
+// RegisterBackend makes a Store available as DeviceConfig.Backend name.
+func RegisterBackend(name string, backend Backend) {
+	backendsMu.Lock()
+	defer backendsMu.Unlock()
+	backends[name] = backend
+}
+
+func openBackend(config DeviceConfig) (Store, error) {
+	name := config.Backend
+	if name == "" {
+		name = BackendFile
+	}
+
+	backendsMu.Lock()
+	backend, ok := backends[name]
+	backendsMu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown device store backend '%s'", name)
+	}
+	return backend(config)
+}
+
+// FileStore keeps devices in memory and writes them all to a file on every
+// change. The file is JSON, or YAML or TOML if its name ends in .yaml, .yml
+// or .toml.
+type FileStore struct {
+	SchemaVersion int                `json:"schema_version"`
+	Devices       map[string]*Device `json:"devices"`
+	path          string
+	format        fileFormat
+	// digest is the hash of the file as last read or written, so the
+	// store's own saves are not mistaken for outside edits
+	digest [sha256.Size]byte
+	// key encrypts the file; nil keeps it in plain text
+	key       *StoreKey
+	encrypted bool
+}
+
+// OpenFileStore loads the devices in path; a missing file is an empty
+// store.
+func OpenFileStore(path string) (*FileStore, error) {
+	return OpenEncryptedFileStore(path, nil)
+}
+
+// OpenEncryptedFileStore is OpenFileStore for a file encrypted with key. A
+// plain text file is read as is and encrypted right away.
+func OpenEncryptedFileStore(path string, key *StoreKey) (*FileStore, error) {
+	store := &FileStore{Devices: make(map[string]*Device), path: path, format: formatForPath(path), key: key}
+	err := store.Reload()
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if key != nil && !store.encrypted {
+		if err := store.Save(); err != nil {
+			return nil, err
+		}
+	}
+	return store, nil
+}
+
+func (s *FileStore) Add(device *Device) error {
+	if _, exists := s.Devices[device.Name]; exists {
+		return fmt.Errorf("device '%s' already exists", device.Name)
+	}
+	s.Devices[device.Name] = device.clone()
+	return s.Save()
+}
+
+func (s *FileStore) Get(name string) (*Device, error) {
+	device, exists := s.Devices[name]
+	if !exists {
+		return nil, fmt.Errorf("device '%s' not found", name)
+	}
+	return device.clone(), nil
+}
+
+func (s *FileStore) List() ([]*Device, error) {
+	devices := make([]*Device, 0, len(s.Devices))
+	for _, device := range s.Devices {
+		devices = append(devices, device.clone())
+	}
+
+	sort.Slice(devices, func(i, j int) bool {
+		return devices[i].Name < devices[j].Name
+	})
+	return devices, nil
+}
+
+func (s *FileStore) Remove(name string) error {
+	if _, exists := s.Devices[name]; !exists {
+		return fmt.Errorf("device '%s' not found", name)
+	}
+	delete(s.Devices, name)
+	return s.Save()
+}
+
+func (s *FileStore) Update(device *Device) error {
+	if _, exists := s.Devices[device.Name]; !exists {
+		return fmt.Errorf("device '%s' not found", device.Name)
+	}
+	s.Devices[device.Name] = device.clone()
+	return s.Save()
+}
+
+// Replace swaps every device for devices with a single save, putting the
+// old ones back if it fails.
+func (s *FileStore) Replace(devices []*Device) error {
+	old := s.Devices
+	s.Devices = make(map[string]*Device, len(devices))
+	for _, device := range devices {
+		s.Devices[device.Name] = device.clone()
+	}
+	if err := s.Save(); err != nil {
+		s.Devices = old
+		return err
+	}
+	return nil
+}
+
+// Reload replaces the devices in memory with the contents of the file,
+// picking up changes written by another process.
+func (s *FileStore) Reload() error {
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	plaintext := data
+	encrypted := isEncrypted(data)
+	if encrypted {
+		if s.key == nil {
+			return fmt.Errorf("device file %s is encrypted and no key was given", s.path)
+		}
+		if plaintext, err = s.key.open(data); err != nil {
+			return err
+		}
+	}
+
+	fresh := &FileStore{Devices: make(map[string]*Device)}
+	if err := decodeFileStore(s.format, plaintext, fresh); err != nil {
+		return fmt.Errorf("failed to parse config file: %w", err)
+	}
+	s.Devices = fresh.Devices
+	s.digest = sha256.Sum256(data)
+	s.encrypted = encrypted
+	return nil
+}
+
+// Changed reports whether the file differs from what the store last read
+// or wrote. A missing file has not changed.
+func (s *FileStore) Changed() (bool, error) {
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return sha256.Sum256(data) != s.digest, nil
+}
+
+// Save writes the file under a temporary name and renames it into place,
+// so a crash or a concurrent reader never sees it half written.
+func (s *FileStore) Save() error {
+	configDir := filepath.Dir(s.path)
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	s.SchemaVersion = SchemaVersion
+	data, err := s.format.marshal(s)
+	if err != nil {
+		return fmt.Errorf("failed to marshal devices: %w", err)
+	}
+	if s.key != nil {
+		if data, err = s.key.seal(data); err != nil {
+			return fmt.Errorf("failed to encrypt devices: %w", err)
+		}
+	}
+
+	// The file holds passwords, so a new one is private to its owner and an
+	// existing one keeps the mode it was given
+	mode := os.FileMode(0600)
+	if info, err := os.Stat(s.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+
+	tmp, err := os.CreateTemp(configDir, filepath.Base(s.path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), mode)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write config file: %w", err)
+	}
+
+	s.digest = sha256.Sum256(data)
+	s.encrypted = s.key != nil
+	return nil
+}
+
+// MigrateJSON copies the devices in the file at path into store if
+// store is empty, for a backend's first run, and renames the file to
+// path+".migrated" so it is not imported again. It returns how many devices
+// were copied; a missing file copies none.
+func MigrateJSON(store Store, path string) (int, error) {
+	return MigrateEncryptedJSON(store, path, nil)
+}
+
+// MigrateEncryptedJSON is MigrateJSON for a file that may be encrypted
+// with key.
+func MigrateEncryptedJSON(store Store, path string, key *StoreKey) (int, error) {
+	existing, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+	if len(existing) > 0 {
+		return 0, nil
+	}
+
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return 0, nil
+	}
+	source, err := OpenEncryptedFileStore(path, key)
+	if err != nil {
+		return 0, fmt.Errorf("failed to migrate devices: %w", err)
+	}
+
+	devices, _ := source.List()
+	for _, device := range devices {
+		if err := store.Add(device); err != nil {
+			return 0, fmt.Errorf("failed to migrate device '%s': %w", device.Name, err)
+		}
+	}
+	if err := store.Save(); err != nil {
+		return 0, fmt.Errorf("failed to migrate devices: %w", err)
+	}
+
+	if err := os.Rename(path, path+".migrated"); err != nil {
+		return len(devices), fmt.Errorf("failed to rename migrated config file: %w", err)
+	}
+	return len(devices), nil
+}
@@ -0,0 +1,239 @@
+package wol_device
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// memoryStore is a minimal Store used to check DeviceStore only goes
+// through the interface.
+type memoryStore struct {
+	devices map[string]*Device
+	saves   int
+	// writes counts the calls that changed a device
+	writes int
+}
+
+func (m *memoryStore) Add(device *Device) error {
+	if _, exists := m.devices[device.Name]; exists {
+		return fmt.Errorf("device '%s' already exists", device.Name)
+	}
+	m.devices[device.Name] = device.clone()
+	m.writes++
+	return nil
+}
+
+func (m *memoryStore) Get(name string) (*Device, error) {
+	device, exists := m.devices[name]
+	if !exists {
+		return nil, fmt.Errorf("device '%s' not found", name)
+	}
+	return device.clone(), nil
+}
+
+func (m *memoryStore) List() ([]*Device, error) {
+	var devices []*Device
+	for _, device := range m.devices {
+		devices = append(devices, device.clone())
+	}
+	return devices, nil
+}
+
+func (m *memoryStore) Remove(name string) error {
+	delete(m.devices, name)
+	return nil
+}
+
+func (m *memoryStore) Update(device *Device) error {
+	m.devices[device.Name] = device.clone()
+	m.writes++
+	return nil
+}
+
+func (m *memoryStore) Save() error {
+	m.saves++
+	return nil
+}
+
+// unreadableStore is a Store whose backend has gone away.
+type unreadableStore struct {
+	memoryStore
+}
+
+func (u *unreadableStore) List() ([]*Device, error) {
+	return nil, fmt.Errorf("connection refused")
+}
+
+func TestDeviceStore_Check(t *testing.T) {
+	store := NewDeviceStoreWith(&memoryStore{devices: make(map[string]*Device)}, DeviceConfig{})
+	store.AddDevice("nas", "AA:BB:CC:DD:EE:FF", "", "", 9)
+	store.SetArchived("nas", true)
+	if count, err := store.Check(); err != nil || count != 1 {
+		t.Errorf("Check() = %d, %v, want 1 device", count, err)
+	}
+
+	broken := NewDeviceStoreWith(&unreadableStore{}, DeviceConfig{})
+	if _, err := broken.Check(); err == nil {
+		t.Error("Check() of an unreadable store should fail")
+	}
+}
+
+func TestFileStore_RoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error = %v", err)
+	}
+	if err := store.Add(&Device{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:FF", Port: 9}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := store.Add(&Device{Name: "nas"}); err == nil {
+		t.Error("Add() of a duplicate name should fail")
+	}
+	if err := store.Update(&Device{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:FF", Port: 7}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := store.Update(&Device{Name: "missing"}); err == nil {
+		t.Error("Update() of a missing device should fail")
+	}
+
+	reopened, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error = %v", err)
+	}
+	device, err := reopened.Get("nas")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if device.Port != 7 {
+		t.Errorf("Port = %d, want 7", device.Port)
+	}
+
+	if err := reopened.Remove("nas"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if devices, _ := reopened.List(); len(devices) != 0 {
+		t.Errorf("List() = %d devices after Remove, want 0", len(devices))
+	}
+}
+
+func TestFileStore_SaveKeepsMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error = %v", err)
+	}
+	if err := store.Add(&Device{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:FF"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("new file mode = %v, want 0600", mode)
+	}
+
+	if err := os.Chmod(path, 0640); err != nil {
+		t.Fatalf("Chmod() error = %v", err)
+	}
+	if err := store.Remove("nas"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if info, err = os.Stat(path); err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0640 {
+		t.Errorf("mode after save = %v, want the 0640 it was given", mode)
+	}
+}
+
+func TestOpenBackend(t *testing.T) {
+	mem := &memoryStore{devices: make(map[string]*Device)}
+	RegisterBackend("memory-test", func(DeviceConfig) (Store, error) {
+		return mem, nil
+	})
+
+	tests := []struct {
+		name    string
+		backend string
+		wantErr bool
+	}{
+		{"default", "", false},
+		{"json", BackendFile, false},
+		{"registered", "memory-test", false},
+		{"unknown", "sqlite", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := DeviceConfig{
+				ConfigPath: filepath.Join(t.TempDir(), "devices.json"),
+				Backend:    tt.backend,
+			}
+			_, err := NewDeviceStore(config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewDeviceStore() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDeviceStore_CustomBackend(t *testing.T) {
+	mem := &memoryStore{devices: make(map[string]*Device)}
+	store := NewDeviceStoreWith(mem, DeviceConfig{})
+
+	if err := store.AddDevice("nas", "aa-bb-cc-dd-ee-ff", "", "", 0); err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+	if err := store.UpdateLastWoken("nas"); err != nil {
+		t.Fatalf("UpdateLastWoken() error = %v", err)
+	}
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	if mem.devices["nas"].LastWoken.IsZero() {
+		t.Error("UpdateLastWoken() did not reach the backend")
+	}
+	if mem.devices["nas"].MACAddress != "AA:BB:CC:DD:EE:FF" {
+		t.Errorf("MACAddress = %s, want AA:BB:CC:DD:EE:FF", mem.devices["nas"].MACAddress)
+	}
+	if mem.saves != 1 {
+		t.Errorf("Save() reached the backend %d times, want 1", mem.saves)
+	}
+	if store.Reload() != nil {
+		t.Error("Reload() on a store without Reload should be a no-op")
+	}
+}
+
+func TestMigrateJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	source, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatalf("OpenFileStore() error = %v", err)
+	}
+	source.Add(&Device{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:01"})
+	source.Add(&Device{Name: "pc", MACAddress: "AA:BB:CC:DD:EE:02"})
+
+	mem := &memoryStore{devices: make(map[string]*Device)}
+	n, err := MigrateJSON(mem, path)
+	if err != nil {
+		t.Fatalf("MigrateJSON() error = %v", err)
+	}
+	if n != 2 || len(mem.devices) != 2 {
+		t.Errorf("MigrateJSON() = %d, store has %d devices, want 2", n, len(mem.devices))
+	}
+	if _, err := os.Stat(path + ".migrated"); err != nil {
+		t.Errorf("config file was not renamed: %v", err)
+	}
+
+	// Nothing left to migrate the second time
+	if n, err := MigrateJSON(mem, path); n != 0 || err != nil {
+		t.Errorf("second MigrateJSON() = %d, %v, want 0, nil", n, err)
+	}
+}
@@ -0,0 +1,191 @@
+package wol_device
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Template holds the settings shared by a set of identical machines, so
+// each one only needs a name and MAC address when it is added.
+type Template struct {
+	Name   string      `json:"name"`
+	Port   int         `json:"port,omitempty"`
+	Tags   []string    `json:"tags,omitempty"`
+	Policy *WakePolicy `json:"policy,omitempty"`
+}
+
+// TemplateFromDevice makes a template of the device's port, tags and wake
+// policy.
+func TemplateFromDevice(name string, device *Device) *Template {
+	return &Template{
+		Name:   name,
+		Port:   device.Port,
+		Tags:   slices.Clone(device.Tags),
+		Policy: device.Policy.clone(),
+	}
+}
+
+// Apply fills in the fields spec leaves empty from the template; tags are
+// added to the spec's own.
+func (t *Template) Apply(spec DeviceSpec) DeviceSpec {
+	if spec.Port == 0 {
+		spec.Port = t.Port
+	}
+	spec.Tags = NormalizeTags(append(slices.Clone(t.Tags), spec.Tags...))
+	if spec.Policy == nil {
+		spec.Policy = t.Policy.clone()
+	}
+	return spec
+}
+
+type TemplateStore struct {
+	Templates  map[string]*Template `json:"templates"`
+	configPath string
+}
+
+func DefaultTemplatesPath(deviceConfigPath string) string {
+	return filepath.Join(filepath.Dir(deviceConfigPath), "templates.json")
+}
+
+func NewTemplateStore(configPath string) (*TemplateStore, error) {
+	store := &TemplateStore{
+		Templates:  make(map[string]*Template),
+		configPath: configPath,
+	}
+
+	err := store.Load()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to load template store: %w", err)
+	}
+
+	return store, nil
+}
+
+// SaveTemplate adds the template, replacing one with the same name.
+func (ts *TemplateStore) SaveTemplate(template *Template) error {
+	name := strings.TrimSpace(template.Name)
+	if name == "" {
+		return fmt.Errorf("template name cannot be empty")
+	}
+	if template.Port < 0 || template.Port > 65535 {
+		return fmt.Errorf("invalid port %d", template.Port)
+	}
+	if !template.Policy.IsZero() {
+		if err := template.Policy.Validate(); err != nil {
+			return err
+		}
+	}
+
+	saved := *template
+	saved.Name = name
+	saved.Tags = NormalizeTags(template.Tags)
+	saved.Policy = nil
+	if !template.Policy.IsZero() {
+		saved.Policy = template.Policy.clone()
+	}
+	ts.Templates[name] = &saved
+	return ts.Save()
+}
+
+func (ts *TemplateStore) RemoveTemplate(name string) error {
+	if _, exists := ts.Templates[name]; !exists {
+		return fmt.Errorf("template '%s' not found", name)
+	}
+
+	delete(ts.Templates, name)
+	return ts.Save()
+}
+
+func (ts *TemplateStore) GetTemplate(name string) (*Template, error) {
+	template, exists := ts.Templates[name]
+	if !exists {
+		return nil, fmt.Errorf("template '%s' not found", name)
+	}
+
+	return template, nil
+}
+
+func (ts *TemplateStore) ListTemplates() []*Template {
+	templates := make([]*Template, 0, len(ts.Templates))
+	for _, template := range ts.Templates {
+		templates = append(templates, template)
+	}
+
+	sort.Slice(templates, func(i, j int) bool {
+		return templates[i].Name < templates[j].Name
+	})
+
+	return templates
+}
+
+func (ts *TemplateStore) Load() error {
+	data, err := os.ReadFile(ts.configPath)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, ts)
+}
+
+func (ts *TemplateStore) Save() error {
+	configDir := filepath.Dir(ts.configPath)
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(ts, "", "	")
+	if err != nil {
+		return fmt.Errorf("failed to marshal templates: %w", err)
+	}
+
+	if err := os.WriteFile(ts.configPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write templates file: %w", err)
+	}
+
+	return nil
+}
+
+// CloneDevice adds a device named name with the given MAC address and IP
+// address (which may be empty) and every other setting copied from
+// source. Settings that belong to one machine, its wake address and power
+// control, and its wake and reachability history are not copied.
+func (ds *DeviceStore) CloneDevice(source, name, macAddress, ipAddress string) error {
+	device, err := ds.newDevice(name, macAddress, "", ipAddress, 0)
+	if err != nil {
+		return err
+	}
+
+	ds.mu.Lock()
+	defer ds.mu.Unlock()
+
+	original, err := ds.store.Get(source)
+	if err != nil {
+		return err
+	}
+	devices, err := ds.store.List()
+	if err != nil {
+		return err
+	}
+	if err := conflict(devices, device); err != nil {
+		return err
+	}
+
+	clone := original.clone()
+	clone.Name = device.Name
+	clone.MACAddress = device.MACAddress
+	clone.IPAddress = device.IPAddress
+	clone.AddedAt = device.AddedAt
+	clone.WakeAddress = ""
+	clone.Power = nil
+	clone.LastWoken = time.Time{}
+	clone.LastSeen = time.Time{}
+	clone.Status = ""
+	clone.Archived = false
+	return ds.store.Add(clone)
+}
@@ -0,0 +1,132 @@
+package wol_device
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestTemplateStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "templates.json")
+	store, err := NewTemplateStore(path)
+	if err != nil {
+		t.Fatalf("NewTemplateStore() error = %v", err)
+	}
+
+	if err := store.SaveTemplate(&Template{Name: " "}); err == nil {
+		t.Error("SaveTemplate() with an empty name should fail")
+	}
+	if err := store.SaveTemplate(&Template{Name: "rack", Policy: &WakePolicy{Retries: -1}}); err == nil {
+		t.Error("SaveTemplate() with an invalid policy should fail")
+	}
+
+	template := &Template{Name: "rack", Port: 7, Tags: []string{"rack", " Lab"}, Policy: &WakePolicy{Retries: 3}}
+	if err := store.SaveTemplate(template); err != nil {
+		t.Fatalf("SaveTemplate() error = %v", err)
+	}
+
+	reopened, err := NewTemplateStore(path)
+	if err != nil {
+		t.Fatalf("NewTemplateStore() error = %v", err)
+	}
+	saved, err := reopened.GetTemplate("rack")
+	if err != nil {
+		t.Fatalf("GetTemplate() error = %v", err)
+	}
+	if saved.Port != 7 || !slices.Equal(saved.Tags, []string{"Lab", "rack"}) || saved.Policy == nil || saved.Policy.Retries != 3 {
+		t.Errorf("Saved template = %+v", saved)
+	}
+
+	if err := reopened.RemoveTemplate("rack"); err != nil {
+		t.Fatalf("RemoveTemplate() error = %v", err)
+	}
+	if len(reopened.ListTemplates()) != 0 {
+		t.Error("RemoveTemplate() left the template")
+	}
+	if err := reopened.RemoveTemplate("rack"); err == nil {
+		t.Error("RemoveTemplate() of a missing template should fail")
+	}
+}
+
+func TestTemplate_Apply(t *testing.T) {
+	template := &Template{Name: "rack", Port: 7, Tags: []string{"rack"}, Policy: &WakePolicy{Retries: 3}}
+
+	tests := []struct {
+		name       string
+		spec       DeviceSpec
+		wantPort   int
+		wantTags   []string
+		wantPolicy int
+	}{
+		{"empty spec", DeviceSpec{Name: "r1"}, 7, []string{"rack"}, 3},
+		{"spec overrides", DeviceSpec{Name: "r2", Port: 9, Tags: []string{"gpu"}, Policy: &WakePolicy{Retries: 5}}, 9, []string{"gpu", "rack"}, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := template.Apply(tt.spec)
+			if spec.Port != tt.wantPort || !slices.Equal(spec.Tags, tt.wantTags) || spec.Policy.Retries != tt.wantPolicy {
+				t.Errorf("Apply() = port %d, tags %v, retries %d; want %d, %v, %d", spec.Port, spec.Tags, spec.Policy.Retries, tt.wantPort, tt.wantTags, tt.wantPolicy)
+			}
+		})
+	}
+
+	spec := template.Apply(DeviceSpec{Name: "r3"})
+	spec.Policy.Retries = 10
+	if template.Policy.Retries != 3 {
+		t.Error("Apply() shares the template's policy with the spec")
+	}
+}
+
+func TestDeviceStore_CloneDevice(t *testing.T) {
+	store := createTestStore(t)
+	if err := store.AddDevice("rack-01", "AA:BB:CC:DD:EE:01", "Compute node", "10.0.0.11", 7); err != nil {
+		t.Fatalf("Failed to add test device: %v", err)
+	}
+	if err := store.SetDeviceTags("rack-01", []string{"rack"}); err != nil {
+		t.Fatalf("Failed to tag device: %v", err)
+	}
+	if err := store.SetDeviceWakePolicy("rack-01", &WakePolicy{Retries: 3}); err != nil {
+		t.Fatalf("Failed to set policy: %v", err)
+	}
+	if err := store.SetDeviceWakeAddress("rack-01", "gateway.example:9"); err != nil {
+		t.Fatalf("Failed to set wake address: %v", err)
+	}
+	if err := store.UpdateStatus("rack-01", true, time.Now()); err != nil {
+		t.Fatalf("Failed to update status: %v", err)
+	}
+
+	if err := store.CloneDevice("rack-01", "rack-02", "aa-bb-cc-dd-ee-02", "10.0.0.12"); err != nil {
+		t.Fatalf("CloneDevice() error = %v", err)
+	}
+
+	clone, err := store.GetDevice("rack-02")
+	if err != nil {
+		t.Fatalf("GetDevice() error = %v", err)
+	}
+	if clone.MACAddress != "AA:BB:CC:DD:EE:02" || clone.IPAddress != "10.0.0.12" || clone.Description != "Compute node" || clone.Port != 7 {
+		t.Errorf("Clone = %+v", clone)
+	}
+	if !slices.Equal(clone.Tags, []string{"rack"}) || clone.Policy == nil || clone.Policy.Retries != 3 {
+		t.Errorf("Clone tags %v, policy %+v; want the source's", clone.Tags, clone.Policy)
+	}
+	if clone.WakeAddress != "" || !clone.LastSeen.IsZero() || clone.Status != StatusUnknown {
+		t.Errorf("Clone copied per-machine state: wake address %q, last seen %v, status %s", clone.WakeAddress, clone.LastSeen, clone.Status)
+	}
+
+	// The clone's policy must not be shared with the source's
+	if err := store.SetDeviceWakePolicy("rack-02", &WakePolicy{Retries: 5}); err != nil {
+		t.Fatalf("Failed to set policy: %v", err)
+	}
+	if source, _ := store.GetDevice("rack-01"); source.Policy.Retries != 3 {
+		t.Errorf("Source policy retries = %d, want 3", source.Policy.Retries)
+	}
+
+	if err := store.CloneDevice("rack-01", "rack-03", "AA:BB:CC:DD:EE:02", ""); err == nil {
+		t.Error("CloneDevice() with a MAC in use should fail")
+	}
+	if err := store.CloneDevice("missing", "rack-03", "AA:BB:CC:DD:EE:03", ""); err == nil {
+		t.Error("CloneDevice() of a missing device should fail")
+	}
+}
@@ -0,0 +1,132 @@
+package wol_device
+
+import (
+	"path/filepath"
+	"sync"
+	"time"
+	wol_log "wol-server/wol/log"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const DefaultReloadInterval = 2 * time.Second
+
+// DefaultFlushDelay is the DeviceConfig.FlushDelay the server uses unless
+// told otherwise.
+const DefaultFlushDelay = 2 * time.Second
+
+// FileWatcher reloads a DeviceStore whenever its file is edited by hand or
+// pushed by config management, so a running server picks the change up.
+// The file's directory is watched, so files replaced by a rename are seen
+// too, and the file is polled instead where that is not possible. The
+// store's own saves do not count as changes.
+type FileWatcher struct {
+	store  *DeviceStore
+	path   string
+	logger *wol_log.Logger
+	// interval is how often the file is polled when it cannot be watched
+	interval time.Duration
+	// failure is the last reload error, logged once rather than on every
+	// poll until the file is fixed
+	failure string
+	stop    chan struct{}
+	wg      sync.WaitGroup
+}
+
+func NewFileWatcher(store *DeviceStore, path string, interval time.Duration, logger *wol_log.Logger) *FileWatcher {
+	if interval <= 0 {
+		interval = DefaultReloadInterval
+	}
+
+	return &FileWatcher{
+		store:    store,
+		path:     path,
+		logger:   logger,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}
+}
+
+func (w *FileWatcher) Start() {
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		if err = watcher.Add(filepath.Dir(w.path)); err != nil {
+			watcher.Close()
+		}
+	}
+	if err != nil {
+		w.logger.Warn("Config: Cannot watch %s, checking it every %v instead: %v", w.path, w.interval, err)
+		w.poll()
+		return
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		defer watcher.Close()
+
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				// Saves and renames of other files in the directory are
+				// not interesting
+				if filepath.Base(event.Name) == filepath.Base(w.path) && event.Has(fsnotify.Write|fsnotify.Create) {
+					w.Check()
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				w.logger.Warn("Config: Watching %s failed: %v", w.path, err)
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (w *FileWatcher) poll() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				w.Check()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (w *FileWatcher) Stop() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+// Check reloads the store if its file changed and reports whether it did.
+// A file that fails to parse is logged and the devices in memory are kept,
+// so a half-finished edit does not empty the store.
+func (w *FileWatcher) Check() bool {
+	reloaded, err := w.store.ReloadIfChanged()
+	if err != nil {
+		if err.Error() != w.failure {
+			w.logger.Warn("Config: Failed to reload device file, keeping the current devices: %v", err)
+		}
+		w.failure = err.Error()
+		return false
+	}
+	w.failure = ""
+	if reloaded {
+		w.logger.Info("Config: Device file changed on disk, reloaded %d devices", w.store.GetDeviceCount())
+	}
+	return reloaded
+}
@@ -0,0 +1,161 @@
+package wol_device
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	wol_log "wol-server/wol/log"
+)
+
+func TestFileWatcher_Check(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "devices.json")
+	store, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+	watcher := NewFileWatcher(store, configPath, 0, logger)
+
+	// The store's own saves are not outside edits
+	if err := store.AddDevice("desktop", "AA:BB:CC:DD:EE:01", "", "", 9); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+	if watcher.Check() {
+		t.Error("Check() reloaded after the store's own save")
+	}
+
+	// Another process adds a device
+	other, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if err := other.AddDevice("nas", "AA:BB:CC:DD:EE:02", "", "", 9); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+	if !watcher.Check() {
+		t.Error("Check() did not reload after an outside edit")
+	}
+	if !store.DeviceExists("nas") {
+		t.Error("Reloaded store is missing the device added on disk")
+	}
+	if watcher.Check() {
+		t.Error("Check() reloaded an unchanged file")
+	}
+
+	// A broken edit keeps the devices in memory
+	if err := os.WriteFile(configPath, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	if watcher.Check() {
+		t.Error("Check() reported a reload of an unparsable file")
+	}
+	if store.GetDeviceCount() != 2 {
+		t.Errorf("GetDeviceCount() = %d after a broken edit, want 2", store.GetDeviceCount())
+	}
+}
+
+func TestFileWatcher_Start(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "devices.json")
+	store, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+	watcher := NewFileWatcher(store, configPath, time.Hour, logger)
+	watcher.Start()
+	defer watcher.Stop()
+
+	// The edit is picked up long before the hour's poll would
+	other, err := NewDeviceStore(DeviceConfig{ConfigPath: configPath})
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	if err := other.AddDevice("nas", "AA:BB:CC:DD:EE:02", "", "", 9); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !store.DeviceExists("nas") {
+		if time.Now().After(deadline) {
+			t.Fatal("Device file edit was not picked up")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDeviceStore_FlushDelay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	store, err := NewDeviceStore(DeviceConfig{ConfigPath: path, FlushDelay: time.Hour})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	for i, name := range []string{"a", "b", "c"} {
+		if err := store.AddDevice(name, fmt.Sprintf("AA:BB:CC:DD:EE:0%d", i+1), "", "", 9); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+	}
+
+	saved := func(name string) *Device {
+		reopened, err := OpenFileStore(path)
+		if err != nil {
+			t.Fatalf("OpenFileStore() error = %v", err)
+		}
+		device, err := reopened.Get(name)
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		return device
+	}
+
+	for _, name := range []string{"a", "b", "c"} {
+		if err := store.UpdateLastWoken(name); err != nil {
+			t.Fatalf("UpdateLastWoken() error = %v", err)
+		}
+	}
+	if device, _ := store.GetDevice("b"); device.LastWoken.IsZero() {
+		t.Error("UpdateLastWoken() not visible before the flush")
+	}
+	if !saved("b").LastWoken.IsZero() {
+		t.Error("UpdateLastWoken() wrote the file before the flush delay")
+	}
+
+	if err := store.Flush(); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if saved(name).LastWoken.IsZero() {
+			t.Errorf("Device %s LastWoken not written by Flush()", name)
+		}
+	}
+}
+
+func TestDeviceStore_FlushDelayTimer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "devices.json")
+	store, err := NewDeviceStore(DeviceConfig{ConfigPath: path, FlushDelay: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	if err := store.AddDevice("a", "AA:BB:CC:DD:EE:01", "", "", 9); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+	if err := store.UpdateStatus("a", true, time.Now()); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		reopened, err := OpenFileStore(path)
+		if err != nil {
+			t.Fatalf("OpenFileStore() error = %v", err)
+		}
+		if device, _ := reopened.Get("a"); device.Status == StatusOnline {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Status was not written after the flush delay")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
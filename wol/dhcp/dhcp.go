@@ -0,0 +1,416 @@
+package wol_dhcp
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_log "wol-server/wol/log"
+	wol_packet "wol-server/wol/packet"
+)
+
+type LeaseFormat string
+
+const (
+	FormatDnsmasq LeaseFormat = "dnsmasq"
+	FormatISC     LeaseFormat = "isc"
+	FormatKea     LeaseFormat = "kea"
+
+	DefaultPollInterval = 30 * time.Second
+)
+
+type Lease struct {
+	MACAddress string    `json:"mac"`
+	IPAddress  string    `json:"ip"`
+	Hostname   string    `json:"hostname,omitempty"`
+	Expires    time.Time `json:"expires,omitempty"`
+}
+
+// LeaseSource provides the current set of DHCP leases.
+type LeaseSource interface {
+	Leases() ([]Lease, error)
+}
+
+type WatcherConfig struct {
+	LeaseFile    string
+	Format       LeaseFormat
+	APIURL       string
+	APIToken     string
+	PollInterval time.Duration
+}
+
+type Watcher struct {
+	source   LeaseSource
+	store    *wol_device.DeviceStore
+	logger   *wol_log.Logger
+	interval time.Duration
+	stop     chan struct{}
+	wg       sync.WaitGroup
+}
+
+func ParseFormat(format string) (LeaseFormat, error) {
+	switch LeaseFormat(strings.ToLower(format)) {
+	case FormatDnsmasq:
+		return FormatDnsmasq, nil
+	case FormatISC, "dhcpd":
+		return FormatISC, nil
+	case FormatKea:
+		return FormatKea, nil
+	default:
+		return "", fmt.Errorf("unknown lease file format: %s (valid: dnsmasq, isc, kea)", format)
+	}
+}
+
+func NewWatcher(config WatcherConfig, store *wol_device.DeviceStore, logger *wol_log.Logger) (*Watcher, error) {
+	var source LeaseSource
+
+	switch {
+	case config.APIURL != "":
+		source = &APISource{URL: config.APIURL, Token: config.APIToken}
+	case config.LeaseFile != "":
+		format := config.Format
+		if format == "" {
+			format = FormatDnsmasq
+		}
+		if _, err := ParseFormat(string(format)); err != nil {
+			return nil, err
+		}
+		source = &FileSource{Path: config.LeaseFile, Format: format}
+	default:
+		return nil, fmt.Errorf("either a lease file or a router API URL is required")
+	}
+
+	interval := config.PollInterval
+	if interval <= 0 {
+		interval = DefaultPollInterval
+	}
+
+	return &Watcher{
+		source:   source,
+		store:    store,
+		logger:   logger,
+		interval: interval,
+		stop:     make(chan struct{}),
+	}, nil
+}
+
+func (w *Watcher) Start() {
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		w.Sync()
+		for {
+			select {
+			case <-ticker.C:
+				w.Sync()
+			case <-w.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (w *Watcher) Stop() {
+	close(w.stop)
+	w.wg.Wait()
+}
+
+// Sync reads the lease source once and applies every active lease to the
+// device store. It returns the number of devices whose IP address changed.
+func (w *Watcher) Sync() int {
+	leases, err := w.source.Leases()
+	if err != nil {
+		w.logger.Warn("DHCP: Failed to read leases: %v", err)
+		return 0
+	}
+	if leases == nil {
+		return 0
+	}
+
+	now := time.Now()
+	updated := 0
+
+	for _, lease := range leases {
+		if !lease.Expires.IsZero() && lease.Expires.Before(now) {
+			continue
+		}
+
+		device, changed, err := w.store.UpdateLease(lease.MACAddress, lease.IPAddress, now)
+		if err != nil {
+			w.logger.Error("DHCP: Failed to update lease for %s: %v", lease.MACAddress, err)
+			continue
+		}
+		if !changed {
+			continue
+		}
+
+		updated++
+		w.logger.Info("DHCP: Device %s (%s) now has IP %s", device.Name, device.MACAddress, lease.IPAddress)
+	}
+
+	w.logger.Debug("DHCP: Processed %d leases, %d devices updated", len(leases), updated)
+	return updated
+}
+
+// FileSource reads leases from a DHCP server's lease database on disk. The
+// file is only re-parsed when its modification time changes; an unchanged
+// file yields nil leases.
+type FileSource struct {
+	Path    string
+	Format  LeaseFormat
+	modTime time.Time
+}
+
+func (fs *FileSource) Leases() ([]Lease, error) {
+	info, err := os.Stat(fs.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat lease file: %w", err)
+	}
+	if info.ModTime().Equal(fs.modTime) {
+		return nil, nil
+	}
+
+	file, err := os.Open(fs.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lease file: %w", err)
+	}
+	defer file.Close()
+
+	var leases []Lease
+	switch fs.Format {
+	case FormatISC:
+		leases, err = ParseISCLeases(file)
+	case FormatKea:
+		leases, err = ParseKeaLeases(file)
+	default:
+		leases, err = ParseDnsmasqLeases(file)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fs.modTime = info.ModTime()
+	if leases == nil {
+		leases = []Lease{}
+	}
+	return leases, nil
+}
+
+// APISource queries a router endpoint returning a JSON array of leases in
+// the form [{"mac": "...", "ip": "...", "hostname": "..."}].
+type APISource struct {
+	URL    string
+	Token  string
+	Client *http.Client
+}
+
+func (as *APISource) Leases() ([]Lease, error) {
+	client := as.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	req, err := http.NewRequest("GET", as.URL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create lease request: %w", err)
+	}
+	if as.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+as.Token)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query router API: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("router API returned status %d", resp.StatusCode)
+	}
+
+	var leases []Lease
+	if err := json.NewDecoder(resp.Body).Decode(&leases); err != nil {
+		return nil, fmt.Errorf("failed to decode router API response: %w", err)
+	}
+
+	return validLeases(leases), nil
+}
+
+// ParseDnsmasqLeases parses a dnsmasq.leases file, where each line is
+// "<expiry> <mac> <ip> <hostname> <client-id>".
+func ParseDnsmasqLeases(r io.Reader) ([]Lease, error) {
+	var leases []Lease
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || strings.HasPrefix(fields[0], "duid") {
+			continue
+		}
+
+		lease := Lease{
+			MACAddress: fields[1],
+			IPAddress:  fields[2],
+		}
+
+		if expiry, err := strconv.ParseInt(fields[0], 10, 64); err == nil && expiry > 0 {
+			lease.Expires = time.Unix(expiry, 0)
+		}
+
+		if len(fields) > 3 && fields[3] != "*" {
+			lease.Hostname = fields[3]
+		}
+
+		leases = append(leases, lease)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dnsmasq leases: %w", err)
+	}
+
+	return validLeases(leases), nil
+}
+
+// ParseISCLeases parses an ISC dhcpd.leases file. Later entries for the
+// same address supersede earlier ones, matching dhcpd's append-only format.
+func ParseISCLeases(r io.Reader) ([]Lease, error) {
+	byIP := make(map[string]Lease)
+	var order []string
+
+	var current *Lease
+	active := false
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(strings.TrimSuffix(line, ";"))
+		if len(fields) == 0 {
+			// A bare ";"
+			continue
+		}
+
+		switch {
+		case fields[0] == "lease" && len(fields) >= 2:
+			current = &Lease{IPAddress: fields[1]}
+			active = true
+		case current == nil:
+			continue
+		case line == "}":
+			if active && current.MACAddress != "" {
+				if _, seen := byIP[current.IPAddress]; !seen {
+					order = append(order, current.IPAddress)
+				}
+				byIP[current.IPAddress] = *current
+			} else {
+				delete(byIP, current.IPAddress)
+			}
+			current = nil
+		case fields[0] == "hardware" && len(fields) >= 3:
+			current.MACAddress = fields[2]
+		case fields[0] == "client-hostname" && len(fields) >= 2:
+			current.Hostname = strings.Trim(fields[1], "\"")
+		case fields[0] == "binding" && len(fields) >= 3 && fields[1] == "state":
+			active = fields[2] == "active"
+		case fields[0] == "ends" && len(fields) >= 4:
+			if expires, err := time.Parse("2006/01/02 15:04:05", fields[2]+" "+fields[3]); err == nil {
+				current.Expires = expires
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ISC leases: %w", err)
+	}
+
+	var leases []Lease
+	for _, ip := range order {
+		if lease, ok := byIP[ip]; ok {
+			leases = append(leases, lease)
+		}
+	}
+
+	return validLeases(leases), nil
+}
+
+// ParseKeaLeases parses a Kea memfile lease CSV (kea-leases4.csv).
+func ParseKeaLeases(r io.Reader) ([]Lease, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read Kea leases: %w", err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+
+	addressCol, hasAddress := columns["address"]
+	hwaddrCol, hasHwaddr := columns["hwaddr"]
+	if !hasAddress || !hasHwaddr {
+		return nil, fmt.Errorf("Kea lease file is missing address or hwaddr columns")
+	}
+
+	var leases []Lease
+	for _, record := range records[1:] {
+		if len(record) <= addressCol || len(record) <= hwaddrCol {
+			continue
+		}
+
+		lease := Lease{
+			IPAddress:  record[addressCol],
+			MACAddress: record[hwaddrCol],
+		}
+
+		if col, ok := columns["hostname"]; ok && col < len(record) {
+			lease.Hostname = record[col]
+		}
+
+		if col, ok := columns["expire"]; ok && col < len(record) {
+			if expiry, err := strconv.ParseInt(record[col], 10, 64); err == nil && expiry > 0 {
+				lease.Expires = time.Unix(expiry, 0)
+			}
+		}
+
+		// Kea keeps released/declined leases with a non-zero state
+		if col, ok := columns["state"]; ok && col < len(record) && record[col] != "0" {
+			continue
+		}
+
+		leases = append(leases, lease)
+	}
+
+	return validLeases(leases), nil
+}
+
+func validLeases(leases []Lease) []Lease {
+	valid := make([]Lease, 0, len(leases))
+	for _, lease := range leases {
+		if lease.IPAddress == "" || wol_packet.ValidateMAC(lease.MACAddress) != nil {
+			continue
+		}
+		valid = append(valid, lease)
+	}
+	return valid
+}
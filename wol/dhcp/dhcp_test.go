@@ -0,0 +1,207 @@
+package wol_dhcp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_log "wol-server/wol/log"
+)
+
+func TestParseDnsmasqLeases(t *testing.T) {
+	input := `1893456000 aa:bb:cc:dd:ee:ff 192.168.1.50 desktop 01:aa:bb:cc:dd:ee:ff
+1893456000 11:22:33:44:55:66 192.168.1.51 * *
+duid 00:01:00:01:2a:3b:4c:5d:00:11:22:33:44:55
+0 not-a-mac 192.168.1.52 broken *
+`
+
+	leases, err := ParseDnsmasqLeases(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseDnsmasqLeases() error = %v", err)
+	}
+
+	if len(leases) != 2 {
+		t.Fatalf("ParseDnsmasqLeases() returned %d leases, want 2", len(leases))
+	}
+
+	if leases[0].IPAddress != "192.168.1.50" || leases[0].Hostname != "desktop" {
+		t.Errorf("first lease = %+v, want 192.168.1.50/desktop", leases[0])
+	}
+
+	if leases[1].Hostname != "" {
+		t.Errorf("second lease hostname = %q, want empty", leases[1].Hostname)
+	}
+
+	if leases[0].Expires.Unix() != 1893456000 {
+		t.Errorf("first lease expiry = %v, want unix 1893456000", leases[0].Expires)
+	}
+}
+
+func TestParseISCLeases(t *testing.T) {
+	input := `# The format of this file is documented in the dhcpd.leases(5) manual page.
+lease 192.168.1.60 {
+  starts 4 2030/01/01 00:00:00;
+  ends 4 2030/01/02 00:00:00;
+  binding state active;
+  hardware ethernet aa:bb:cc:dd:ee:ff;
+  client-hostname "desktop";
+}
+lease 192.168.1.61 {
+  binding state free;
+  hardware ethernet 11:22:33:44:55:66;
+}
+lease 192.168.1.60 {
+  ends 4 2030/01/03 00:00:00;
+  binding state active;
+  hardware ethernet aa:bb:cc:dd:ee:ff;
+  client-hostname "desktop-renamed";
+}
+`
+
+	leases, err := ParseISCLeases(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseISCLeases() error = %v", err)
+	}
+
+	if len(leases) != 1 {
+		t.Fatalf("ParseISCLeases() returned %d leases, want 1", len(leases))
+	}
+
+	if leases[0].Hostname != "desktop-renamed" {
+		t.Errorf("lease hostname = %q, want later entry to win", leases[0].Hostname)
+	}
+
+	if leases[0].Expires.Day() != 3 {
+		t.Errorf("lease expiry = %v, want 2030/01/03", leases[0].Expires)
+	}
+}
+
+func TestParseISCLeases_EmptyStatement(t *testing.T) {
+	input := `;
+lease 192.168.1.60 {
+  ;
+  binding state active;
+  hardware ethernet aa:bb:cc:dd:ee:ff;
+}
+`
+
+	leases, err := ParseISCLeases(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseISCLeases() error = %v", err)
+	}
+	if len(leases) != 1 || leases[0].IPAddress != "192.168.1.60" {
+		t.Errorf("ParseISCLeases() = %+v, want the one lease", leases)
+	}
+}
+
+func TestParseKeaLeases(t *testing.T) {
+	input := `address,hwaddr,client_id,valid_lifetime,expire,subnet_id,fqdn_fwd,fqdn_rev,hostname,state,user_context
+192.168.1.70,aa:bb:cc:dd:ee:ff,,3600,1893456000,1,0,0,desktop,0,
+192.168.1.71,11:22:33:44:55:66,,3600,1893456000,1,0,0,laptop,1,
+`
+
+	leases, err := ParseKeaLeases(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("ParseKeaLeases() error = %v", err)
+	}
+
+	if len(leases) != 1 {
+		t.Fatalf("ParseKeaLeases() returned %d leases, want 1 (declined lease skipped)", len(leases))
+	}
+
+	if leases[0].IPAddress != "192.168.1.70" || leases[0].Hostname != "desktop" {
+		t.Errorf("lease = %+v, want 192.168.1.70/desktop", leases[0])
+	}
+}
+
+func TestParseKeaLeases_MissingColumns(t *testing.T) {
+	_, err := ParseKeaLeases(strings.NewReader("foo,bar\n1,2\n"))
+	if err == nil {
+		t.Error("ParseKeaLeases() expected error for missing columns, got nil")
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    LeaseFormat
+		wantErr bool
+	}{
+		{"dnsmasq", FormatDnsmasq, false},
+		{"ISC", FormatISC, false},
+		{"dhcpd", FormatISC, false},
+		{"kea", FormatKea, false},
+		{"unknown", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseFormat(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFormat() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatcher_Sync(t *testing.T) {
+	tempDir := t.TempDir()
+	leaseFile := filepath.Join(tempDir, "dnsmasq.leases")
+
+	store, err := wol_device.NewDeviceStore(wol_device.DeviceConfig{ConfigPath: filepath.Join(tempDir, "devices.json")})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if err := store.AddDevice("desktop", "AA:BB:CC:DD:EE:FF", "", "192.168.1.10", 9); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+
+	expiry := time.Now().Add(time.Hour).Unix()
+	content := []byte(strings.Join([]string{
+		formatLease(expiry, "aa:bb:cc:dd:ee:ff", "192.168.1.20"),
+		formatLease(expiry, "11:22:33:44:55:66", "192.168.1.21"),
+	}, "\n"))
+	if err := os.WriteFile(leaseFile, content, 0644); err != nil {
+		t.Fatalf("Failed to write lease file: %v", err)
+	}
+
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+	watcher, err := NewWatcher(WatcherConfig{LeaseFile: leaseFile, Format: FormatDnsmasq}, store, logger)
+	if err != nil {
+		t.Fatalf("NewWatcher() error = %v", err)
+	}
+
+	if updated := watcher.Sync(); updated != 1 {
+		t.Errorf("Sync() updated %d devices, want 1", updated)
+	}
+
+	device, _ := store.GetDevice("desktop")
+	if device.IPAddress != "192.168.1.20" {
+		t.Errorf("Device IP = %s, want 192.168.1.20", device.IPAddress)
+	}
+	if device.LastSeen.IsZero() {
+		t.Error("Device LastSeen should be set after sync")
+	}
+
+	// Unchanged file should not be re-processed
+	if updated := watcher.Sync(); updated != 0 {
+		t.Errorf("Second Sync() updated %d devices, want 0", updated)
+	}
+}
+
+func TestNewWatcher_RequiresSource(t *testing.T) {
+	_, err := NewWatcher(WatcherConfig{}, nil, nil)
+	if err == nil {
+		t.Error("NewWatcher() expected error without lease file or API URL")
+	}
+}
+
+func formatLease(expiry int64, mac, ip string) string {
+	return fmt.Sprintf("%d %s %s * *", expiry, mac, ip)
+}
@@ -0,0 +1,77 @@
+package wol_events
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// TypeWake is a wake attempt, successful or not
+	TypeWake = "wake"
+	// TypeStatus is a device going online or offline
+	TypeStatus = "status"
+	// TypeDiscovery is the result of a network scan
+	TypeDiscovery = "discovery"
+)
+
+type Event struct {
+	Type    string `json:"type"`
+	Device  string `json:"device,omitempty"`
+	MAC     string `json:"mac,omitempty"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+	// Status is online or offline for status events
+	Status    string      `json:"status,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// Bus fans events out to its subscribers. A nil *Bus drops everything
+// published to it.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Publish sends event to every subscriber. Slow subscribers miss events
+// rather than block the publisher.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel receiving every event published from now on
+// and a function that ends the subscription.
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, 64)
+
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	return ch, func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[ch]; ok {
+			delete(b.subscribers, ch)
+			close(ch)
+		}
+	}
+}
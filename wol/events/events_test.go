@@ -0,0 +1,55 @@
+package wol_events
+
+import (
+	"testing"
+)
+
+func TestBus(t *testing.T) {
+	bus := NewBus()
+	first, cancelFirst := bus.Subscribe()
+	second, cancelSecond := bus.Subscribe()
+	defer cancelSecond()
+
+	bus.Publish(Event{Type: TypeWake, Device: "nas", Success: true})
+
+	for i, ch := range []<-chan Event{first, second} {
+		event := <-ch
+		if event.Type != TypeWake || event.Device != "nas" {
+			t.Errorf("subscriber %d got %+v", i, event)
+		}
+		if event.Timestamp.IsZero() {
+			t.Errorf("subscriber %d got an event without a timestamp", i)
+		}
+	}
+
+	cancelFirst()
+	if _, ok := <-first; ok {
+		t.Error("channel still open after cancel")
+	}
+	// Cancelling twice is harmless
+	cancelFirst()
+
+	bus.Publish(Event{Type: TypeStatus, Device: "nas", Status: "online"})
+	if event := <-second; event.Type != TypeStatus {
+		t.Errorf("got %+v after the other subscriber left", event)
+	}
+}
+
+func TestBus_SlowSubscriber(t *testing.T) {
+	bus := NewBus()
+	events, cancel := bus.Subscribe()
+	defer cancel()
+
+	// Publishing must not block when nobody reads
+	for i := 0; i < 1000; i++ {
+		bus.Publish(Event{Type: TypeWake})
+	}
+	if len(events) != cap(events) {
+		t.Errorf("buffered %d events, want %d", len(events), cap(events))
+	}
+}
+
+func TestBus_Nil(t *testing.T) {
+	var bus *Bus
+	bus.Publish(Event{Type: TypeWake})
+}
@@ -0,0 +1,319 @@
+package wol_federation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	wol_device "wol-server/wol/device"
+)
+
+// Site is a remote wol-server instance that wakes devices on its own LAN.
+type Site struct {
+	Name    string    `json:"name"`
+	URL     string    `json:"url"`
+	APIKey  string    `json:"api_key,omitempty"`
+	Subnets []string  `json:"subnets,omitempty"`
+	AddedAt time.Time `json:"added_at"`
+}
+
+// SiteStore keeps federation sites in their own file next to the devices.
+// It is safe for concurrent use and returns copies of its sites.
+type SiteStore struct {
+	mu         sync.RWMutex
+	Sites      map[string]*Site `json:"sites"`
+	configPath string
+}
+
+func (s *Site) clone() *Site {
+	clone := *s
+	clone.Subnets = slices.Clone(s.Subnets)
+	return &clone
+}
+
+func DefaultSitesPath(deviceConfigPath string) string {
+	return filepath.Join(filepath.Dir(deviceConfigPath), "sites.json")
+}
+
+func NewSiteStore(configPath string) (*SiteStore, error) {
+	store := &SiteStore{
+		Sites:      make(map[string]*Site),
+		configPath: configPath,
+	}
+
+	err := store.Load()
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to load site store: %w", err)
+	}
+
+	return store, nil
+}
+
+func (ss *SiteStore) AddSite(name, siteURL, apiKey string, subnets []string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return fmt.Errorf("site name cannot be empty")
+	}
+
+	u, err := url.Parse(strings.TrimSpace(siteURL))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid site URL: %s (expected http(s)://host[:port])", siteURL)
+	}
+
+	var cleanSubnets []string
+	for _, subnet := range subnets {
+		subnet = strings.TrimSpace(subnet)
+		if subnet == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(subnet); err != nil {
+			return fmt.Errorf("invalid subnet %s: %w", subnet, err)
+		}
+		cleanSubnets = append(cleanSubnets, subnet)
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, exists := ss.Sites[name]; exists {
+		return fmt.Errorf("site '%s' already exists", name)
+	}
+
+	ss.Sites[name] = &Site{
+		Name:    name,
+		URL:     strings.TrimSuffix(u.String(), "/"),
+		APIKey:  apiKey,
+		Subnets: cleanSubnets,
+		AddedAt: time.Now(),
+	}
+
+	if err := ss.save(); err != nil {
+		// Keep memory in step with the file
+		delete(ss.Sites, name)
+		return err
+	}
+	return nil
+}
+
+func (ss *SiteStore) RemoveSite(name string) error {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	site, exists := ss.Sites[name]
+	if !exists {
+		return fmt.Errorf("site '%s' not found", name)
+	}
+
+	delete(ss.Sites, name)
+	if err := ss.save(); err != nil {
+		ss.Sites[name] = site
+		return err
+	}
+	return nil
+}
+
+func (ss *SiteStore) GetSite(name string) (*Site, error) {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+
+	site, exists := ss.Sites[name]
+	if !exists {
+		return nil, fmt.Errorf("site '%s' not found", name)
+	}
+
+	return site.clone(), nil
+}
+
+func (ss *SiteStore) ListSites() []*Site {
+	ss.mu.RLock()
+	sites := make([]*Site, 0, len(ss.Sites))
+	for _, site := range ss.Sites {
+		sites = append(sites, site.clone())
+	}
+	ss.mu.RUnlock()
+
+	sort.Slice(sites, func(i, j int) bool {
+		return sites[i].Name < sites[j].Name
+	})
+
+	return sites
+}
+
+// SiteForDevice returns the site a device is homed to: its remote
+// wol-server, the site named in its Site field, or else the site whose
+// subnets contain its IP address. ok is false for devices woken locally.
+func (ss *SiteStore) SiteForDevice(device *wol_device.Device) (*Site, bool, error) {
+	if device.Remote != "" {
+		return RemoteSite(device), true, nil
+	}
+	if ss == nil {
+		return nil, false, nil
+	}
+
+	if device.Site != "" {
+		site, err := ss.GetSite(device.Site)
+		if err != nil {
+			return nil, false, err
+		}
+		return site, true, nil
+	}
+
+	ip := net.ParseIP(device.IPAddress)
+	if ip == nil {
+		return nil, false, nil
+	}
+
+	for _, site := range ss.ListSites() {
+		for _, subnet := range site.Subnets {
+			if _, network, err := net.ParseCIDR(subnet); err == nil && network.Contains(ip) {
+				return site, true, nil
+			}
+		}
+	}
+
+	return nil, false, nil
+}
+
+// RemoteSite is the ad-hoc site for a device marked remote, named after the
+// peer's host.
+func RemoteSite(device *wol_device.Device) *Site {
+	name := device.Remote
+	if u, err := url.Parse(device.Remote); err == nil && u.Host != "" {
+		name = u.Host
+	}
+	return &Site{Name: name, URL: strings.TrimSuffix(device.Remote, "/"), APIKey: device.RemoteKey}
+}
+
+func (ss *SiteStore) Load() error {
+	data, err := os.ReadFile(ss.configPath)
+	if err != nil {
+		return err
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return json.Unmarshal(data, ss)
+}
+
+func (ss *SiteStore) Save() error {
+	ss.mu.RLock()
+	defer ss.mu.RUnlock()
+	return ss.save()
+}
+
+// save writes the sites out; the caller must hold ss.mu.
+func (ss *SiteStore) save() error {
+	configDir := filepath.Dir(ss.configPath)
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(ss, "", "	")
+	if err != nil {
+		return fmt.Errorf("failed to marshal sites: %w", err)
+	}
+
+	// Sites hold API keys, so keep the file private
+	err = os.WriteFile(ss.configPath, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write sites file: %w", err)
+	}
+
+	return nil
+}
+
+// RemoteResult is the outcome of a request forwarded to a site.
+type RemoteResult struct {
+	Site       string          `json:"site"`
+	Success    bool            `json:"success"`
+	StatusCode int             `json:"status_code,omitempty"`
+	Message    string          `json:"message,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	Duration   string          `json:"duration"`
+}
+
+type Client struct {
+	httpClient *http.Client
+	// RequestID, if set, is sent as X-Request-ID so the site logs the
+	// request under the same ID as the one that forwarded it
+	RequestID string
+}
+
+func NewClient(timeout time.Duration) *Client {
+	return &Client{httpClient: &http.Client{Timeout: timeout}}
+}
+
+// ForwardWake asks site to wake mac on port via its /api/wake endpoint.
+func (c *Client) ForwardWake(site *Site, mac string, port int) (*RemoteResult, error) {
+	body, err := json.Marshal(map[string]interface{}{"mac": mac, "port": port})
+	if err != nil {
+		return nil, err
+	}
+
+	return c.do(site, "POST", "/api/wake", body)
+}
+
+// CheckHealth queries the site's /api/health endpoint.
+func (c *Client) CheckHealth(site *Site) (*RemoteResult, error) {
+	return c.do(site, "GET", "/api/health", nil)
+}
+
+func (c *Client) do(site *Site, method, path string, body []byte) (*RemoteResult, error) {
+	start := time.Now()
+	result := &RemoteResult{Site: site.Name}
+
+	req, err := http.NewRequest(method, site.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request for site %s: %w", site.Name, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.RequestID != "" {
+		req.Header.Set("X-Request-ID", c.RequestID)
+	}
+	if site.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+site.APIKey)
+		req.Header.Set("X-API-Key", site.APIKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	result.Duration = time.Since(start).Round(time.Millisecond).String()
+	if err != nil {
+		result.Error = err.Error()
+		return result, fmt.Errorf("site %s unreachable: %w", site.Name, err)
+	}
+	defer resp.Body.Close()
+
+	result.StatusCode = resp.StatusCode
+
+	var apiResponse struct {
+		Success bool            `json:"success"`
+		Message string          `json:"message"`
+		Error   string          `json:"error"`
+		Data    json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&apiResponse); err != nil {
+		result.Error = fmt.Sprintf("invalid response: %v", err)
+		return result, fmt.Errorf("site %s returned an invalid response: %w", site.Name, err)
+	}
+
+	result.Success = apiResponse.Success && resp.StatusCode < 300
+	result.Message = apiResponse.Message
+	result.Error = apiResponse.Error
+	result.Data = apiResponse.Data
+
+	if !result.Success {
+		return result, fmt.Errorf("site %s: %s", site.Name, result.Error)
+	}
+
+	return result, nil
+}
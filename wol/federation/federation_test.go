@@ -0,0 +1,213 @@
+package wol_federation
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	wol_device "wol-server/wol/device"
+)
+
+func createTestSiteStore(t *testing.T) *SiteStore {
+	store, err := NewSiteStore(filepath.Join(t.TempDir(), "sites.json"))
+	if err != nil {
+		t.Fatalf("Failed to create site store: %v", err)
+	}
+	return store
+}
+
+func TestSiteStore_AddSite(t *testing.T) {
+	store := createTestSiteStore(t)
+
+	tests := []struct {
+		name    string
+		site    string
+		url     string
+		subnets []string
+		wantErr bool
+	}{
+		{"valid site", "office", "https://wol.office.example:8080/", []string{"10.1.0.0/16"}, false},
+		{"duplicate site", "office", "https://other.example", nil, true},
+		{"empty name", " ", "https://other.example", nil, true},
+		{"invalid URL scheme", "ftp", "ftp://example.com", nil, true},
+		{"invalid subnet", "bad-subnet", "http://example.com", []string{"10.1.0.0"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := store.AddSite(tt.site, tt.url, "key", tt.subnets)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("AddSite() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	site, err := store.GetSite("office")
+	if err != nil {
+		t.Fatalf("GetSite() error = %v", err)
+	}
+	if site.URL != "https://wol.office.example:8080" {
+		t.Errorf("Site.URL = %s, want trailing slash trimmed", site.URL)
+	}
+
+	reloaded, err := NewSiteStore(store.configPath)
+	if err != nil || len(reloaded.Sites) != 1 {
+		t.Errorf("reloaded store has %d sites (err %v), want 1", len(reloaded.Sites), err)
+	}
+}
+
+func TestSiteStore_Concurrent(t *testing.T) {
+	store := createTestSiteStore(t)
+	store.AddSite("office", "http://office.example", "", []string{"10.1.0.0/16"})
+	device := &wol_device.Device{IPAddress: "10.1.2.3"}
+
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			name := fmt.Sprintf("site-%d", i)
+			if err := store.AddSite(name, "http://"+name+".example", "", []string{"192.168.0.0/16"}); err != nil {
+				t.Errorf("AddSite() error = %v", err)
+			}
+			store.RemoveSite(name)
+		}()
+		go func() {
+			defer wg.Done()
+			if site, ok, err := store.SiteForDevice(device); err != nil || !ok || site.Name != "office" {
+				t.Errorf("SiteForDevice() = %v, %v, %v, want office", site, ok, err)
+			}
+			store.ListSites()
+		}()
+	}
+	wg.Wait()
+
+	if sites := store.ListSites(); len(sites) != 1 {
+		t.Errorf("ListSites() = %d sites, want only office left", len(sites))
+	}
+}
+
+func TestSiteStore_FailedSave(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewSiteStore(filepath.Join(dir, "sites.json"))
+	if err != nil {
+		t.Fatalf("NewSiteStore() error = %v", err)
+	}
+	if err := store.AddSite("office", "http://office.example", "", nil); err != nil {
+		t.Fatalf("AddSite() error = %v", err)
+	}
+
+	// A directory in place of the file makes every write fail
+	store.configPath = dir
+	if err := store.AddSite("parents", "http://parents.example", "", nil); err == nil {
+		t.Fatal("AddSite() error = nil, want the write to fail")
+	}
+	if _, err := store.GetSite("parents"); err == nil {
+		t.Error("a failed AddSite() left the site in memory")
+	}
+	if err := store.RemoveSite("office"); err == nil {
+		t.Fatal("RemoveSite() error = nil, want the write to fail")
+	}
+	if _, err := store.GetSite("office"); err != nil {
+		t.Error("a failed RemoveSite() removed the site from memory")
+	}
+}
+
+func TestSiteStore_SiteForDevice(t *testing.T) {
+	store := createTestSiteStore(t)
+	store.AddSite("office", "http://office.example", "", []string{"10.1.0.0/16"})
+	store.AddSite("parents", "http://parents.example", "", nil)
+
+	tests := []struct {
+		name     string
+		device   wol_device.Device
+		wantSite string
+		wantErr  bool
+	}{
+		{"explicit site", wol_device.Device{Site: "parents", IPAddress: "10.1.2.3"}, "parents", false},
+		{"subnet match", wol_device.Device{IPAddress: "10.1.2.3"}, "office", false},
+		{"local device", wol_device.Device{IPAddress: "192.168.1.10"}, "", false},
+		{"no IP", wol_device.Device{}, "", false},
+		{"unknown site", wol_device.Device{Site: "missing"}, "", true},
+		{"remote peer", wol_device.Device{Remote: "http://peer.example:8080", Site: "parents"}, "peer.example:8080", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			site, remote, err := store.SiteForDevice(&tt.device)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("SiteForDevice() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantSite == "" {
+				if remote {
+					t.Errorf("SiteForDevice() = %s, want local", site.Name)
+				}
+				return
+			}
+			if !remote || site.Name != tt.wantSite {
+				t.Errorf("SiteForDevice() = %v, %v, want %s", site, remote, tt.wantSite)
+			}
+		})
+	}
+}
+
+func TestSiteForDevice_NoSiteStore(t *testing.T) {
+	var store *SiteStore
+
+	site, remote, err := store.SiteForDevice(&wol_device.Device{Remote: "http://peer.example", RemoteKey: "key"})
+	if err != nil || !remote || site.URL != "http://peer.example" || site.APIKey != "key" {
+		t.Errorf("SiteForDevice() = %+v, %v, %v, want the remote peer", site, remote, err)
+	}
+
+	if _, remote, err := store.SiteForDevice(&wol_device.Device{IPAddress: "10.1.2.3"}); err != nil || remote {
+		t.Errorf("SiteForDevice() = %v, %v, want local", remote, err)
+	}
+}
+
+func TestClient_ForwardWake(t *testing.T) {
+	var gotKey, gotRequestID string
+	var gotBody map[string]interface{}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotKey = r.Header.Get("X-API-Key")
+		gotRequestID = r.Header.Get("X-Request-ID")
+		json.NewDecoder(r.Body).Decode(&gotBody)
+
+		if r.URL.Path != "/api/wake" {
+			w.WriteHeader(http.StatusNotFound)
+			json.NewEncoder(w).Encode(map[string]interface{}{"success": false, "error": "not found"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "message": "Wake packet sent"})
+	}))
+	defer server.Close()
+
+	site := &Site{Name: "office", URL: server.URL, APIKey: "s3cret"}
+	client := NewClient(5 * time.Second)
+	client.RequestID = "3f2a9c"
+
+	result, err := client.ForwardWake(site, "AA:BB:CC:DD:EE:FF", 9)
+	if err != nil {
+		t.Fatalf("ForwardWake() error = %v", err)
+	}
+	if !result.Success || result.Message != "Wake packet sent" {
+		t.Errorf("ForwardWake() result = %+v", result)
+	}
+	if gotKey != "s3cret" {
+		t.Errorf("X-API-Key header = %q, want s3cret", gotKey)
+	}
+	if gotRequestID != "3f2a9c" {
+		t.Errorf("X-Request-ID header = %q, want 3f2a9c", gotRequestID)
+	}
+	if gotBody["mac"] != "AA:BB:CC:DD:EE:FF" {
+		t.Errorf("forwarded body = %v", gotBody)
+	}
+
+	if _, err := client.CheckHealth(site); err == nil {
+		t.Error("CheckHealth() expected error for 404 response")
+	}
+}
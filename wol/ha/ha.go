@@ -0,0 +1,453 @@
+package wol_ha
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	wol_log "wol-server/wol/log"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type Role string
+
+const (
+	RoleLeader  Role = "leader"
+	RoleStandby Role = "standby"
+
+	DefaultLeaseTTL = 15 * time.Second
+
+	// SecretHeader carries Config.Secret on a node's status requests to
+	// its peers
+	SecretHeader = "X-HA-Secret"
+)
+
+// LeaseBackend is shared storage that lets exactly one node hold the
+// leadership lease at a time.
+type LeaseBackend interface {
+	// Acquire takes or renews the lease for nodeID. It returns the current
+	// holder, which is nodeID when the call succeeded.
+	Acquire(nodeID string, ttl time.Duration) (Lease, error)
+	// Release gives up the lease if nodeID holds it
+	Release(nodeID string, ttl time.Duration) error
+}
+
+type Lease struct {
+	Holder  string    `json:"holder"`
+	Expires time.Time `json:"expires"`
+}
+
+type Config struct {
+	NodeID   string
+	Backend  LeaseBackend
+	LeaseTTL time.Duration
+	Peers    []string
+	// Secret is shared by all nodes. Peers sending it may read a node's
+	// local status without the API's credentials; without one, anyone may.
+	Secret string
+	// Sync is called on every lease tick while this node is standby, so it
+	// can pick up state written by the leader.
+	Sync func()
+}
+
+type PeerStatus struct {
+	URL     string `json:"url"`
+	Healthy bool   `json:"healthy"`
+	NodeID  string `json:"node_id,omitempty"`
+	Role    Role   `json:"role,omitempty"`
+	Error   string `json:"error,omitempty"`
+}
+
+type Status struct {
+	NodeID       string       `json:"node_id"`
+	Role         Role         `json:"role"`
+	Leader       string       `json:"leader,omitempty"`
+	LeaseExpires time.Time    `json:"lease_expires,omitempty"`
+	Peers        []PeerStatus `json:"peers,omitempty"`
+}
+
+type Coordinator struct {
+	config Config
+	logger *wol_log.Logger
+	client *http.Client
+
+	mu    sync.RWMutex
+	lease Lease
+
+	stop chan struct{}
+	wg   sync.WaitGroup
+}
+
+func NewCoordinator(config Config, logger *wol_log.Logger) (*Coordinator, error) {
+	if config.NodeID == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("node ID is required: %w", err)
+		}
+		config.NodeID = hostname
+	}
+	if config.Backend == nil {
+		return nil, fmt.Errorf("a lease backend is required")
+	}
+	if config.LeaseTTL <= 0 {
+		config.LeaseTTL = DefaultLeaseTTL
+	}
+
+	return &Coordinator{
+		config: config,
+		logger: logger,
+		client: &http.Client{Timeout: 3 * time.Second},
+		stop:   make(chan struct{}),
+	}, nil
+}
+
+func (c *Coordinator) Start() {
+	c.tick()
+
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(c.config.LeaseTTL / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				c.tick()
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (c *Coordinator) Stop() {
+	close(c.stop)
+	c.wg.Wait()
+
+	if c.IsLeader() {
+		if err := c.config.Backend.Release(c.config.NodeID, c.config.LeaseTTL); err != nil {
+			c.logger.Warn("HA: Failed to release leadership lease: %v", err)
+		}
+	}
+
+	// Whether or not the release worked, this node no longer renews the
+	// lease, so it must not act as leader for the rest of its shutdown
+	c.mu.Lock()
+	c.lease = Lease{}
+	c.mu.Unlock()
+}
+
+func (c *Coordinator) tick() {
+	wasLeader := c.IsLeader()
+
+	lease, err := c.config.Backend.Acquire(c.config.NodeID, c.config.LeaseTTL)
+	if err != nil {
+		c.logger.Error("HA: Failed to acquire leadership lease: %v", err)
+		// Without a renewed lease we cannot be sure we are still leader
+		lease = Lease{}
+	}
+
+	c.mu.Lock()
+	c.lease = lease
+	c.mu.Unlock()
+
+	isLeader := c.IsLeader()
+	switch {
+	case isLeader && !wasLeader:
+		c.logger.Info("HA: Node %s became leader", c.config.NodeID)
+	case !isLeader && wasLeader:
+		c.logger.Warn("HA: Node %s lost leadership to %q", c.config.NodeID, lease.Holder)
+	}
+
+	if !isLeader && c.config.Sync != nil {
+		c.config.Sync()
+	}
+}
+
+// IsLeader reports whether this node currently holds an unexpired lease.
+// Work that must happen exactly once, such as scheduled wakes, should only
+// run on the leader.
+func (c *Coordinator) IsLeader() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return c.lease.Holder == c.config.NodeID && time.Now().Before(c.lease.Expires)
+}
+
+func (c *Coordinator) NodeID() string {
+	return c.config.NodeID
+}
+
+// LocalStatus returns this node's view of the cluster without contacting
+// peers; it is what peers receive from the status endpoint.
+func (c *Coordinator) LocalStatus() Status {
+	c.mu.RLock()
+	lease := c.lease
+	c.mu.RUnlock()
+
+	role := RoleStandby
+	if c.IsLeader() {
+		role = RoleLeader
+	}
+
+	return Status{
+		NodeID:       c.config.NodeID,
+		Role:         role,
+		Leader:       lease.Holder,
+		LeaseExpires: lease.Expires,
+	}
+}
+
+// Status returns LocalStatus plus the health of every configured peer.
+func (c *Coordinator) Status() Status {
+	status := c.LocalStatus()
+
+	status.Peers = make([]PeerStatus, len(c.config.Peers))
+	var wg sync.WaitGroup
+	for i, peer := range c.config.Peers {
+		wg.Add(1)
+		go func(i int, peer string) {
+			defer wg.Done()
+			status.Peers[i] = c.checkPeer(peer)
+		}(i, peer)
+	}
+	wg.Wait()
+
+	return status
+}
+
+// IsPeer reports whether r is a peer's request for this node's local
+// status, carrying the shared secret if one is configured.
+func (c *Coordinator) IsPeer(r *http.Request) bool {
+	if r.URL.Query().Get("local") != "true" {
+		return false
+	}
+	if c.config.Secret == "" {
+		return true
+	}
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get(SecretHeader)), []byte(c.config.Secret)) == 1
+}
+
+func (c *Coordinator) checkPeer(peer string) PeerStatus {
+	result := PeerStatus{URL: peer}
+
+	req, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(peer, "/")+"/api/ha/status?local=true", nil)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if c.config.Secret != "" {
+		req.Header.Set(SecretHeader, c.config.Secret)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		result.Error = fmt.Sprintf("peer returned status %d", resp.StatusCode)
+		return result
+	}
+
+	var body struct {
+		Data Status `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		result.Error = fmt.Sprintf("invalid peer response: %v", err)
+		return result
+	}
+
+	result.Healthy = true
+	result.NodeID = body.Data.NodeID
+	result.Role = body.Data.Role
+	return result
+}
+
+// FileLease stores the leadership lease in a JSON file on storage shared by
+// all nodes (e.g. next to a shared devices.json). An flock on a sibling
+// ".lock" file serializes read-modify-write cycles between nodes, so the
+// shared filesystem must support it, as local disks and NFSv4 do.
+//
+// Each node compares the lease's Expires with its own clock, so the nodes'
+// clocks must agree (e.g. through NTP) to well within the lease TTL; a node
+// whose clock runs ahead takes over a lease that has not yet expired.
+type FileLease struct {
+	Path string
+}
+
+func (fl *FileLease) Acquire(nodeID string, ttl time.Duration) (Lease, error) {
+	var result Lease
+
+	err := fl.withLock(func() error {
+		current, err := fl.read()
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if current.Holder != "" && current.Holder != nodeID && now.Before(current.Expires) {
+			result = current
+			return nil
+		}
+
+		result = Lease{Holder: nodeID, Expires: now.Add(ttl)}
+		return fl.write(result)
+	})
+
+	return result, err
+}
+
+func (fl *FileLease) Release(nodeID string, ttl time.Duration) error {
+	return fl.withLock(func() error {
+		current, err := fl.read()
+		if err != nil {
+			return err
+		}
+		if current.Holder != nodeID {
+			return nil
+		}
+		return fl.write(Lease{})
+	})
+}
+
+func (fl *FileLease) read() (Lease, error) {
+	var lease Lease
+
+	data, err := os.ReadFile(fl.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return lease, nil
+	}
+	if err != nil {
+		return lease, fmt.Errorf("failed to read lease file: %w", err)
+	}
+	if len(data) == 0 {
+		return lease, nil
+	}
+
+	if err := json.Unmarshal(data, &lease); err != nil {
+		return lease, fmt.Errorf("failed to parse lease file: %w", err)
+	}
+	return lease, nil
+}
+
+func (fl *FileLease) write(lease Lease) error {
+	data, err := json.Marshal(lease)
+	if err != nil {
+		return err
+	}
+
+	tmp := fl.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write lease file: %w", err)
+	}
+	return os.Rename(tmp, fl.Path)
+}
+
+// withLock runs fn holding the lease lock. The lock file itself is never
+// removed: a node that removed it could lock a new file while another
+// still holds the old one.
+func (fl *FileLease) withLock(fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(fl.Path), 0755); err != nil {
+		return fmt.Errorf("failed to create lease directory: %w", err)
+	}
+
+	lockPath := fl.Path + ".lock"
+	lock, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open lock file: %w", err)
+	}
+	// Closing the file releases the lock
+	defer lock.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		locked, err := tryLock(lock)
+		if err != nil {
+			return fmt.Errorf("failed to lock %s: %w", lockPath, err)
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for lease lock %s", lockPath)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return fn()
+}
+
+// redisAcquire takes the lease if it is free or already held by ARGV[1],
+// and returns the holder and the milliseconds left on the lease.
+var redisAcquire = redis.NewScript(`
+local holder = redis.call("GET", KEYS[1])
+if not holder or holder == ARGV[1] then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return {ARGV[1], tonumber(ARGV[2])}
+end
+return {holder, redis.call("PTTL", KEYS[1])}
+`)
+
+// redisRelease deletes the lease if ARGV[1] holds it.
+var redisRelease = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// RedisLease stores the leadership lease in a Redis key that expires with
+// it, on the Redis server the nodes share their devices through.
+type RedisLease struct {
+	Client *redis.Client
+	// Key defaults to DefaultRedisLeaseKey
+	Key string
+}
+
+const DefaultRedisLeaseKey = "wol:ha:lease"
+
+func (rl *RedisLease) key() string {
+	if rl.Key == "" {
+		return DefaultRedisLeaseKey
+	}
+	return rl.Key
+}
+
+func (rl *RedisLease) Acquire(nodeID string, ttl time.Duration) (Lease, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), ttl)
+	defer cancel()
+
+	result, err := redisAcquire.Run(ctx, rl.Client, []string{rl.key()}, nodeID, ttl.Milliseconds()).Slice()
+	if err != nil {
+		return Lease{}, fmt.Errorf("failed to acquire Redis lease: %w", err)
+	}
+	if len(result) != 2 {
+		return Lease{}, fmt.Errorf("unexpected Redis lease reply %v", result)
+	}
+	holder, _ := result[0].(string)
+	left, _ := result[1].(int64)
+	return Lease{Holder: holder, Expires: time.Now().Add(time.Duration(left) * time.Millisecond)}, nil
+}
+
+func (rl *RedisLease) Release(nodeID string, ttl time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), ttl)
+	defer cancel()
+
+	if err := redisRelease.Run(ctx, rl.Client, []string{rl.key()}, nodeID).Err(); err != nil {
+		return fmt.Errorf("failed to release Redis lease: %w", err)
+	}
+	return nil
+}
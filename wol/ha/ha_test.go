@@ -0,0 +1,222 @@
+package wol_ha
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	wol_log "wol-server/wol/log"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestFileLease_Acquire(t *testing.T) {
+	lease := &FileLease{Path: filepath.Join(t.TempDir(), "leader.json")}
+
+	got, err := lease.Acquire("node-a", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if got.Holder != "node-a" {
+		t.Errorf("Acquire() holder = %s, want node-a", got.Holder)
+	}
+
+	got, err = lease.Acquire("node-b", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if got.Holder != "node-a" {
+		t.Errorf("Acquire() by second node holder = %s, want node-a to keep lease", got.Holder)
+	}
+
+	if err := lease.Release("node-a", time.Minute); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+
+	got, _ = lease.Acquire("node-b", time.Minute)
+	if got.Holder != "node-b" {
+		t.Errorf("Acquire() after release holder = %s, want node-b", got.Holder)
+	}
+}
+
+func TestFileLease_OneHolder(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "leader.json")
+	// A lock file left by a crashed node does not hold anyone up
+	if err := os.WriteFile(path+".lock", nil, 0644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	holders := make([]string, 8)
+	var wg sync.WaitGroup
+	for i := range holders {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// Separate values, as separate nodes would have
+			lease := &FileLease{Path: path}
+			got, err := lease.Acquire(fmt.Sprintf("node-%d", i), time.Minute)
+			if err != nil {
+				t.Errorf("Acquire() error = %v", err)
+			}
+			holders[i] = got.Holder
+		}(i)
+	}
+	wg.Wait()
+
+	for _, holder := range holders {
+		if holder == "" || holder != holders[0] {
+			t.Fatalf("Acquire() holders = %v, want one node for all", holders)
+		}
+	}
+}
+
+func TestRedisLease(t *testing.T) {
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	lease := &RedisLease{Client: client}
+
+	got, err := lease.Acquire("node-a", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if got.Holder != "node-a" || time.Until(got.Expires) <= 0 {
+		t.Errorf("Acquire() = %+v, want node-a holding an unexpired lease", got)
+	}
+
+	got, _ = lease.Acquire("node-b", time.Minute)
+	if got.Holder != "node-a" || time.Until(got.Expires) <= 0 {
+		t.Errorf("Acquire() by second node = %+v, want node-a to keep the lease", got)
+	}
+	if err := lease.Release("node-b", time.Minute); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if got, _ := lease.Acquire("node-b", time.Minute); got.Holder != "node-a" {
+		t.Errorf("Release() by a node without the lease freed it for %s", got.Holder)
+	}
+
+	// A leader that stops renewing loses the lease when it expires
+	server.FastForward(2 * time.Minute)
+	if got, _ := lease.Acquire("node-b", time.Minute); got.Holder != "node-b" {
+		t.Errorf("Acquire() after expiry holder = %s, want node-b", got.Holder)
+	}
+	if err := lease.Release("node-b", time.Minute); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if got, _ := lease.Acquire("node-a", time.Minute); got.Holder != "node-a" {
+		t.Errorf("Acquire() after release holder = %s, want node-a", got.Holder)
+	}
+}
+
+func TestFileLease_ReleaseStaleLock(t *testing.T) {
+	lease := &FileLease{Path: filepath.Join(t.TempDir(), "leader.json")}
+	if _, err := lease.Acquire("node-a", time.Second); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	// A lock left by a crashed node is stale after the lease's own TTL,
+	// not DefaultLeaseTTL
+	lockPath := lease.Path + ".lock"
+	if err := os.WriteFile(lockPath, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-5 * time.Second)
+	os.Chtimes(lockPath, old, old)
+
+	if err := lease.Release("node-a", time.Second); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if got, _ := lease.Acquire("node-b", time.Second); got.Holder != "node-b" {
+		t.Errorf("Acquire() after release holder = %s, want node-b", got.Holder)
+	}
+}
+
+func TestFileLease_Expiry(t *testing.T) {
+	lease := &FileLease{Path: filepath.Join(t.TempDir(), "leader.json")}
+
+	if _, err := lease.Acquire("node-a", 10*time.Millisecond); err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+
+	got, err := lease.Acquire("node-b", time.Minute)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if got.Holder != "node-b" {
+		t.Errorf("Acquire() of expired lease holder = %s, want node-b", got.Holder)
+	}
+}
+
+func TestCoordinator_SingleLeader(t *testing.T) {
+	backend := &FileLease{Path: filepath.Join(t.TempDir(), "leader.json")}
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+
+	synced := 0
+	a, err := NewCoordinator(Config{NodeID: "a", Backend: backend, LeaseTTL: time.Minute}, logger)
+	if err != nil {
+		t.Fatalf("NewCoordinator() error = %v", err)
+	}
+	b, _ := NewCoordinator(Config{NodeID: "b", Backend: backend, LeaseTTL: time.Minute, Sync: func() { synced++ }}, logger)
+
+	a.tick()
+	b.tick()
+
+	if !a.IsLeader() || b.IsLeader() {
+		t.Errorf("IsLeader() a=%v b=%v, want only a", a.IsLeader(), b.IsLeader())
+	}
+
+	if synced != 1 {
+		t.Errorf("standby Sync called %d times, want 1", synced)
+	}
+
+	status := b.LocalStatus()
+	if status.Role != RoleStandby || status.Leader != "a" {
+		t.Errorf("LocalStatus() = %+v, want standby with leader a", status)
+	}
+}
+
+func TestNewCoordinator_RequiresBackend(t *testing.T) {
+	if _, err := NewCoordinator(Config{NodeID: "a"}, nil); err == nil {
+		t.Error("NewCoordinator() expected error without backend")
+	}
+}
+
+func TestCoordinator_PeerSecret(t *testing.T) {
+	backend := &FileLease{Path: filepath.Join(t.TempDir(), "leader.json")}
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+
+	b, _ := NewCoordinator(Config{NodeID: "b", Backend: backend, Secret: "shared"}, logger)
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !b.IsPeer(r) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]Status{"data": b.LocalStatus()})
+	}))
+	defer peer.Close()
+
+	for _, secret := range []string{"shared", "wrong", ""} {
+		a, _ := NewCoordinator(Config{NodeID: "a", Backend: backend, Peers: []string{peer.URL}, Secret: secret}, logger)
+		got := a.Status().Peers[0]
+		if got.Healthy != (secret == "shared") {
+			t.Errorf("Status() with secret %q: peer = %+v, want healthy only with the shared secret", secret, got)
+		}
+	}
+
+	// Without a secret, any local status request is a peer's
+	open, _ := NewCoordinator(Config{NodeID: "c", Backend: backend}, logger)
+	if !open.IsPeer(httptest.NewRequest("GET", "/api/ha/status?local=true", nil)) {
+		t.Error("IsPeer() = false for a local request without a configured secret")
+	}
+	if open.IsPeer(httptest.NewRequest("GET", "/api/ha/status", nil)) {
+		t.Error("IsPeer() = true for the aggregated status")
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package wol_ha
+
+import (
+	"fmt"
+	"os"
+)
+
+func tryLock(file *os.File) (bool, error) {
+	return false, fmt.Errorf("lease files need flock, which is only available on Unix; use -ha-redis")
+}
@@ -0,0 +1,20 @@
+//go:build unix
+
+package wol_ha
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// tryLock takes an exclusive flock on file without waiting. The kernel
+// drops it when the file is closed or the process dies, so a node that
+// crashes mid-update cannot leave a stale lock behind.
+func tryLock(file *os.File) (bool, error) {
+	err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX|syscall.LOCK_NB)
+	if errors.Is(err, syscall.EWOULDBLOCK) {
+		return false, nil
+	}
+	return err == nil, err
+}
@@ -0,0 +1,232 @@
+package wol_i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Messages are looked up by their English source text, so untranslated
+// strings simply print in English. Catalogs are JSON objects mapping that
+// text to its translation:
+//
+//	{"Device '%s' added successfully": "Gerät '%s' erfolgreich hinzugefügt"}
+//
+// Leading indentation and surrounding newlines are not part of the key. A
+// translation may reorder arguments with explicit indexes such as %[2]s.
+
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var bundled embed.FS
+
+var (
+	mu       sync.RWMutex
+	catalogs = make(map[string]map[string]string)
+	current  = &Localizer{lang: DefaultLanguage}
+)
+
+func init() {
+	entries, _ := bundled.ReadDir("locales")
+	for _, entry := range entries {
+		data, err := bundled.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			continue
+		}
+		addCatalog(strings.TrimSuffix(entry.Name(), ".json"), data)
+	}
+}
+
+// LoadDir merges every <lang>.json catalog in dir over the bundled ones,
+// so downstream packagers can add or correct languages without patching.
+func LoadDir(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return fmt.Errorf("failed to list catalogs: %w", err)
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("failed to read catalog: %w", err)
+		}
+		if err := addCatalog(strings.TrimSuffix(filepath.Base(file), ".json"), data); err != nil {
+			return fmt.Errorf("invalid catalog %s: %w", file, err)
+		}
+	}
+
+	return nil
+}
+
+func addCatalog(lang string, data []byte) error {
+	var messages map[string]string
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	lang = normalize(lang)
+	if catalogs[lang] == nil {
+		catalogs[lang] = make(map[string]string)
+	}
+	for key, value := range messages {
+		catalogs[lang][key] = value
+	}
+	return nil
+}
+
+// Languages lists the languages with a catalog, plus English.
+func Languages() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	langs := []string{DefaultLanguage}
+	for lang := range catalogs {
+		if lang != DefaultLanguage {
+			langs = append(langs, lang)
+		}
+	}
+	sort.Strings(langs[1:])
+	return langs
+}
+
+type Localizer struct {
+	lang     string
+	messages map[string]string
+}
+
+// New returns a localizer for lang ("de", "pt-BR", "de_DE.UTF-8", ...),
+// falling back from a regional variant to the base language, and to
+// English when neither has a catalog.
+func New(lang string) *Localizer {
+	lang = normalize(lang)
+
+	mu.RLock()
+	defer mu.RUnlock()
+
+	if messages, ok := catalogs[lang]; ok {
+		return &Localizer{lang: lang, messages: messages}
+	}
+	if base, _, found := strings.Cut(lang, "-"); found {
+		if messages, ok := catalogs[base]; ok {
+			return &Localizer{lang: base, messages: messages}
+		}
+	}
+	return &Localizer{lang: DefaultLanguage}
+}
+
+func (l *Localizer) Lang() string {
+	return l.lang
+}
+
+// T translates format and applies args to it.
+func (l *Localizer) T(format string, args ...interface{}) string {
+	text := format
+	if l != nil && l.messages != nil {
+		trimmed := strings.TrimLeft(strings.TrimRight(format, "\n"), " \n")
+		if translated, ok := l.messages[trimmed]; ok && translated != "" {
+			start := strings.Index(format, trimmed)
+			text = format[:start] + translated + format[start+len(trimmed):]
+		}
+	}
+
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
+
+// DetectLanguage picks the CLI language: an explicit choice (the -lang
+// flag) wins, then the POSIX locale variables.
+func DetectLanguage(explicit string) string {
+	candidates := []string{explicit, os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG")}
+	for _, candidate := range candidates {
+		if candidate == "" {
+			continue
+		}
+		if candidate == "C" || candidate == "POSIX" {
+			return DefaultLanguage
+		}
+		return normalize(candidate)
+	}
+	return DefaultLanguage
+}
+
+// MatchAcceptLanguage returns the localizer for the most preferred
+// language in an HTTP Accept-Language header that has a catalog.
+func MatchAcceptLanguage(header string) *Localizer {
+	type weighted struct {
+		lang string
+		q    float64
+	}
+
+	var prefs []weighted
+	for _, part := range strings.Split(header, ",") {
+		lang, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if lang == "" || lang == "*" {
+			continue
+		}
+
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		prefs = append(prefs, weighted{lang, q})
+	}
+
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+
+	for _, pref := range prefs {
+		if pref.q <= 0 {
+			continue
+		}
+		if localizer := New(pref.lang); localizer.lang != DefaultLanguage || strings.HasPrefix(normalize(pref.lang), DefaultLanguage) {
+			return localizer
+		}
+	}
+	return &Localizer{lang: DefaultLanguage}
+}
+
+// normalize turns locale names such as "de_DE.UTF-8" into "de-de".
+func normalize(lang string) string {
+	lang, _, _ = strings.Cut(lang, ".")
+	lang, _, _ = strings.Cut(lang, "@")
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(lang), "_", "-"))
+}
+
+// SetLanguage selects the language used by the package-level helpers.
+func SetLanguage(lang string) {
+	localizer := New(lang)
+
+	mu.Lock()
+	defer mu.Unlock()
+	current = localizer
+}
+
+func T(format string, args ...interface{}) string {
+	mu.RLock()
+	localizer := current
+	mu.RUnlock()
+
+	return localizer.T(format, args...)
+}
+
+// Printf prints the translation of format.
+func Printf(format string, args ...interface{}) {
+	fmt.Print(T(format, args...))
+}
+
+// Println prints the translation of text followed by a newline.
+func Println(text string) {
+	fmt.Println(T(text))
+}
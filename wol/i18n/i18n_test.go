@@ -0,0 +1,118 @@
+package wol_i18n
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLocalizer_T(t *testing.T) {
+	de := New("de")
+
+	tests := []struct {
+		name   string
+		format string
+		args   []interface{}
+		want   string
+	}{
+		{"translated with args", "Device '%s' added successfully", []interface{}{"nas"}, "Gerät 'nas' erfolgreich hinzugefügt"},
+		{"keeps trailing newline", "Error: %v\n", []interface{}{"boom"}, "Fehler: boom\n"},
+		{"keeps indentation", "  Setup:", nil, "  Einrichtung:"},
+		{"untranslated falls back", "Nothing like this exists", nil, "Nothing like this exists"},
+		{"no args leaves verbs alone", "100% done", nil, "100% done"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := de.T(tt.format, tt.args...); got != tt.want {
+				t.Errorf("T() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		lang string
+		want string
+	}{
+		{"de", "de"},
+		{"de_AT.UTF-8", "de"},
+		{"es-MX", "es"},
+		{"fr", DefaultLanguage},
+		{"", DefaultLanguage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.lang, func(t *testing.T) {
+			if got := New(tt.lang).Lang(); got != tt.want {
+				t.Errorf("New(%q).Lang() = %s, want %s", tt.lang, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		name     string
+		explicit string
+		env      map[string]string
+		want     string
+	}{
+		{"flag wins", "es", map[string]string{"LANG": "de_DE.UTF-8"}, "es"},
+		{"LC_ALL before LANG", "", map[string]string{"LC_ALL": "es_ES.UTF-8", "LANG": "de_DE.UTF-8"}, "es-es"},
+		{"LANG", "", map[string]string{"LANG": "de_DE.UTF-8"}, "de-de"},
+		{"C locale", "", map[string]string{"LANG": "C"}, DefaultLanguage},
+		{"nothing set", "", nil, DefaultLanguage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+				t.Setenv(key, tt.env[key])
+			}
+			if got := DetectLanguage(tt.explicit); got != tt.want {
+				t.Errorf("DetectLanguage() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchAcceptLanguage(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"de-DE,de;q=0.9,en;q=0.8", "de"},
+		{"fr-FR,es;q=0.5", "es"},
+		{"en-US,de;q=0.5", "en"},
+		{"es;q=0.2,de;q=0.8", "de"},
+		{"fr", DefaultLanguage},
+		{"", DefaultLanguage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.header, func(t *testing.T) {
+			if got := MatchAcceptLanguage(tt.header).Lang(); got != tt.want {
+				t.Errorf("MatchAcceptLanguage(%q) = %s, want %s", tt.header, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "nl.json"), []byte(`{"Usage:": "Gebruik:"}`), 0644)
+
+	if err := LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir() error = %v", err)
+	}
+	if got := New("nl").T("Usage:"); got != "Gebruik:" {
+		t.Errorf("T() = %q, want Gebruik:", got)
+	}
+
+	os.WriteFile(filepath.Join(dir, "bad.json"), []byte(`not json`), 0644)
+	if err := LoadDir(dir); err == nil {
+		t.Error("LoadDir() expected error for invalid catalog")
+	}
+}
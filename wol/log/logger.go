@@ -1,11 +1,13 @@
 package wol_log
 
 import (
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -40,6 +42,10 @@ type Logger struct {
 	debugLogger *log.Logger
 	level       LogLevel
 	logFile     *os.File
+	// prefix starts every message, see With
+	prefix string
+	// jsonLogger writes JSON lines without a prefix, see JSON
+	jsonLogger *log.Logger
 }
 
 type LoggerConfig struct {
@@ -97,6 +103,7 @@ func NewLogger(config LoggerConfig) (*Logger, error) {
 	logger.infoLogger = log.New(multiWriter, "[INFO] ", flags)
 	logger.warnLogger = log.New(multiWriter, "[WARN] ", flags)
 	logger.errorLogger = log.New(multiWriter, "[ERROR] ", flags)
+	logger.jsonLogger = log.New(multiWriter, "", 0)
 
 	return logger, nil
 }
@@ -111,28 +118,53 @@ func (l *Logger) Close() error {
 
 func (l *Logger) Debug(format string, args ...interface{}) {
 	if l.level <= DEBUG {
-		l.debugLogger.Printf(format, args...)
+		l.debugLogger.Printf(l.prefix+format, args...)
 	}
 }
 
 func (l *Logger) Info(format string, args ...interface{}) {
 	if l.level <= INFO {
-		l.infoLogger.Printf(format, args...)
+		l.infoLogger.Printf(l.prefix+format, args...)
 	}
 }
 
 func (l *Logger) Warn(format string, args ...interface{}) {
 	if l.level <= WARN {
-		l.warnLogger.Printf(format, args...)
+		l.warnLogger.Printf(l.prefix+format, args...)
 	}
 }
 
 func (l *Logger) Error(format string, args ...interface{}) {
 	if l.level <= ERROR {
-		l.errorLogger.Printf(format, args...)
+		l.errorLogger.Printf(l.prefix+format, args...)
 	}
 }
 
+// JSON writes v as a single line of JSON, without the level and time
+// prefix of the other methods, for log collectors that parse each line.
+// Nothing is written below the logger's level.
+func (l *Logger) JSON(level LogLevel, v interface{}) error {
+	if level < l.level {
+		return nil
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal log entry: %w", err)
+	}
+	l.jsonLogger.Print(string(data))
+	return nil
+}
+
+// With returns a logger writing to the same place that starts every
+// message with prefix, such as the ID of the request being handled. It
+// shares l's log file, so only l should be closed.
+func (l *Logger) With(prefix string) *Logger {
+	with := *l
+	with.prefix = l.prefix + strings.ReplaceAll(prefix, "%", "%%")
+	return &with
+}
+
 func (l *Logger) LogWakeAttempt(mac string, port int, success bool, err error) {
 	if success {
 		l.Info("Wake-on-LAN packet sent successfully to MAC=%s on port=%d", mac, port)
@@ -423,3 +423,64 @@ func TestLogger_MultipleLogs(t *testing.T) {
 		}
 	}
 }
+
+func TestLogger_With(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "with.log")
+
+	logger, err := NewLogger(LoggerConfig{Level: INFO, LogToFile: true, LogFilePath: logPath})
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+
+	request := logger.With("[req 50%] ")
+	request.Info("Waking %s", "nas")
+	request.With("[site lab] ").Warn("Forwarded")
+	request.Debug("Below the level")
+	logger.Info("Plain")
+	logger.Close()
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	want := []string{"[req 50%] Waking nas", "[req 50%] [site lab] Forwarded", "Plain"}
+	if len(lines) != len(want) {
+		t.Fatalf("got %d log lines, want %d:\n%s", len(lines), len(want), content)
+	}
+	for i, suffix := range want {
+		if !strings.HasSuffix(lines[i], suffix) {
+			t.Errorf("line %d = %q, want it to end with %q", i, lines[i], suffix)
+		}
+	}
+	if strings.Contains(lines[2], "req") {
+		t.Errorf("With() changed the original logger: %q", lines[2])
+	}
+}
+
+func TestLogger_JSON(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "json.log")
+
+	logger, err := NewLogger(LoggerConfig{Level: INFO, LogToFile: true, LogFilePath: logPath})
+	if err != nil {
+		t.Fatalf("NewLogger() error = %v", err)
+	}
+
+	if err := logger.JSON(INFO, map[string]interface{}{"method": "GET", "status": 200}); err != nil {
+		t.Fatalf("JSON() error = %v", err)
+	}
+	logger.JSON(DEBUG, map[string]string{"path": "/healthz"})
+	if err := logger.JSON(INFO, func() {}); err == nil {
+		t.Error("JSON() of a value that cannot be marshalled should fail")
+	}
+	logger.Close()
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if want := "{\"method\":\"GET\",\"status\":200}\n"; string(content) != want {
+		t.Errorf("log = %q, want %q", content, want)
+	}
+}
@@ -0,0 +1,759 @@
+package wol_mdns
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	wol_log "wol-server/wol/log"
+)
+
+// Minimal multicast DNS (RFC 6762) responder and browser for DNS-SD
+// (RFC 6763) service discovery. Only the record types needed to advertise
+// and find a single service are implemented.
+
+const (
+	ServiceType = "_wol-server._tcp"
+	Domain      = "local."
+
+	DefaultTTL = 120 * time.Second
+
+	servicesEnumeration = "_services._dns-sd._udp.local."
+	// legacyUnicastTTL caps TTLs in replies to one-shot queriers
+	legacyUnicastTTL = 10
+)
+
+var groupAddr = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+const (
+	typeA      uint16 = 1
+	typePTR    uint16 = 12
+	typeTXT    uint16 = 16
+	typeSRV    uint16 = 33
+	typeANY    uint16 = 255
+	classIN    uint16 = 1
+	classQU           = 0x8000 // unicast-response bit in questions
+	cacheFlush        = 0x8000 // cache-flush bit in unique records
+
+	flagResponse      = 0x8000
+	flagAuthoritative = 0x0400
+)
+
+type question struct {
+	Name  string
+	Type  uint16
+	Class uint16
+}
+
+type record struct {
+	Name  string
+	Type  uint16
+	Class uint16
+	TTL   uint32
+
+	// Decoded RDATA, depending on Type
+	Target string   // PTR, SRV
+	Port   uint16   // SRV
+	Text   []string // TXT
+	IP     net.IP   // A
+}
+
+type message struct {
+	ID        uint16
+	Flags     uint16
+	Questions []question
+	Answers   []record
+	Extra     []record
+}
+
+// Service is a discovered wol-server instance.
+type Service struct {
+	Instance string            `json:"instance"`
+	Host     string            `json:"host"`
+	Port     int               `json:"port"`
+	Addrs    []net.IP          `json:"addresses"`
+	TXT      map[string]string `json:"txt,omitempty"`
+}
+
+// URL returns the base URL of the service's HTTP API.
+func (s Service) URL() string {
+	scheme := "http"
+	if s.TXT["tls"] == "true" {
+		scheme = "https"
+	}
+
+	host := strings.TrimSuffix(s.Host, ".")
+	if len(s.Addrs) > 0 {
+		host = s.Addrs[0].String()
+	}
+
+	return fmt.Sprintf("%s://%s", scheme, net.JoinHostPort(host, fmt.Sprint(s.Port)))
+}
+
+type Config struct {
+	// Instance is the human-readable service name (default "wol-server on <hostname>")
+	Instance string
+	Port     int
+	// TXT holds key=value pairs describing the server's API
+	TXT []string
+	// Addrs overrides the advertised IPv4 addresses (default: all up, non-loopback interfaces)
+	Addrs []net.IP
+}
+
+type Responder struct {
+	config  Config
+	host    string
+	service string
+	name    string
+	logger  *wol_log.Logger
+
+	conn *net.UDPConn
+	wg   sync.WaitGroup
+}
+
+func NewResponder(config Config, logger *wol_log.Logger) (*Responder, error) {
+	if config.Port <= 0 || config.Port > 65535 {
+		return nil, fmt.Errorf("invalid service port: %d", config.Port)
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "wol-server"
+	}
+	hostname = sanitizeLabel(strings.Split(hostname, ".")[0])
+
+	if config.Instance == "" {
+		config.Instance = "wol-server on " + hostname
+	}
+	config.Instance = sanitizeLabel(config.Instance)
+
+	if len(config.Addrs) == 0 {
+		config.Addrs = localIPv4Addrs()
+	}
+	if len(config.Addrs) == 0 {
+		return nil, fmt.Errorf("no IPv4 addresses to advertise")
+	}
+
+	service := ServiceType + "." + Domain
+	return &Responder{
+		config:  config,
+		host:    hostname + "." + Domain,
+		service: service,
+		name:    config.Instance + "." + service,
+		logger:  logger,
+	}, nil
+}
+
+func (r *Responder) Start() error {
+	conn, err := net.ListenMulticastUDP("udp4", nil, groupAddr)
+	if err != nil {
+		return fmt.Errorf("failed to join mDNS multicast group: %w", err)
+	}
+	r.conn = conn
+
+	r.wg.Add(1)
+	go r.serve()
+
+	// Announce twice, one second apart, as RFC 6762 section 8.3 recommends
+	r.announce(uint32(DefaultTTL.Seconds()))
+	go func() {
+		time.Sleep(time.Second)
+		r.announce(uint32(DefaultTTL.Seconds()))
+	}()
+
+	r.logger.Info("mDNS: Advertising %s on port %d", r.name, r.config.Port)
+	return nil
+}
+
+// Stop sends a goodbye packet so browsers drop the service immediately.
+func (r *Responder) Stop() {
+	if r.conn == nil {
+		return
+	}
+
+	r.announce(0)
+	r.conn.Close()
+	r.wg.Wait()
+	r.conn = nil
+}
+
+func (r *Responder) announce(ttl uint32) {
+	msg := &message{Flags: flagResponse | flagAuthoritative}
+	msg.Answers = append(r.serviceRecords(ttl, true), r.hostRecords(ttl, true)...)
+
+	if _, err := r.conn.WriteToUDP(msg.pack(), groupAddr); err != nil {
+		r.logger.Debug("mDNS: Failed to send announcement: %v", err)
+	}
+}
+
+func (r *Responder) serve() {
+	defer r.wg.Done()
+
+	buf := make([]byte, 9000)
+	for {
+		n, src, err := r.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		query, err := parseMessage(buf[:n])
+		if err != nil || query.Flags&flagResponse != 0 {
+			continue
+		}
+
+		legacy := src.Port != groupAddr.Port
+		reply := r.answer(query, legacy)
+		if reply == nil {
+			continue
+		}
+
+		dst := groupAddr
+		if legacy || wantsUnicast(query) {
+			dst = src
+		}
+
+		if _, err := r.conn.WriteToUDP(reply.pack(), dst); err != nil {
+			r.logger.Debug("mDNS: Failed to reply to %s: %v", src, err)
+		}
+	}
+}
+
+// answer builds the reply to query, or nil if none of its questions are
+// about this service. Legacy (one-shot) queriers get the question echoed,
+// their ID preserved and short TTLs, per RFC 6762 section 6.7.
+func (r *Responder) answer(query *message, legacy bool) *message {
+	ttl := uint32(DefaultTTL.Seconds())
+	if legacy {
+		ttl = legacyUnicastTTL
+	}
+	flush := !legacy
+
+	reply := &message{Flags: flagResponse | flagAuthoritative}
+	if legacy {
+		reply.ID = query.ID
+	}
+
+	var extra []record
+	for _, q := range query.Questions {
+		name := strings.ToLower(q.Name)
+		matched := true
+
+		switch {
+		case name == servicesEnumeration && matchesType(q.Type, typePTR):
+			reply.Answers = append(reply.Answers, record{Name: servicesEnumeration, Type: typePTR, Class: classIN, TTL: ttl, Target: r.service})
+		case name == strings.ToLower(r.service) && matchesType(q.Type, typePTR):
+			reply.Answers = append(reply.Answers, r.serviceRecords(ttl, flush)[0])
+			extra = append(extra, r.serviceRecords(ttl, flush)[1:]...)
+			extra = append(extra, r.hostRecords(ttl, flush)...)
+		case name == strings.ToLower(r.name) && (matchesType(q.Type, typeSRV) || matchesType(q.Type, typeTXT)):
+			reply.Answers = append(reply.Answers, r.serviceRecords(ttl, flush)[1:]...)
+			extra = append(extra, r.hostRecords(ttl, flush)...)
+		case name == strings.ToLower(r.host) && matchesType(q.Type, typeA):
+			reply.Answers = append(reply.Answers, r.hostRecords(ttl, flush)...)
+		default:
+			matched = false
+		}
+
+		if matched && legacy {
+			reply.Questions = append(reply.Questions, question{Name: q.Name, Type: q.Type, Class: q.Class &^ classQU})
+		}
+	}
+
+	if len(reply.Answers) == 0 {
+		return nil
+	}
+	reply.Extra = extra
+	return reply
+}
+
+// serviceRecords returns the PTR, SRV and TXT records for the service.
+func (r *Responder) serviceRecords(ttl uint32, flush bool) []record {
+	class := classIN
+	if flush {
+		class |= cacheFlush
+	}
+
+	text := r.config.TXT
+	if len(text) == 0 {
+		// DNS-SD requires at least one (possibly empty) string
+		text = []string{""}
+	}
+
+	return []record{
+		{Name: r.service, Type: typePTR, Class: classIN, TTL: ttl, Target: r.name},
+		{Name: r.name, Type: typeSRV, Class: class, TTL: ttl, Target: r.host, Port: uint16(r.config.Port)},
+		{Name: r.name, Type: typeTXT, Class: class, TTL: ttl, Text: text},
+	}
+}
+
+func (r *Responder) hostRecords(ttl uint32, flush bool) []record {
+	class := classIN
+	if flush {
+		class |= cacheFlush
+	}
+
+	var records []record
+	for _, ip := range r.config.Addrs {
+		if ip4 := ip.To4(); ip4 != nil {
+			records = append(records, record{Name: r.host, Type: typeA, Class: class, TTL: ttl, IP: ip4})
+		}
+	}
+	return records
+}
+
+// Browse queries the LAN for wol-server instances and collects the replies
+// that arrive within timeout.
+func Browse(timeout time.Duration) ([]Service, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open mDNS socket: %w", err)
+	}
+	defer conn.Close()
+
+	service := ServiceType + "." + Domain
+	query := &message{
+		ID:        uint16(time.Now().UnixNano()),
+		Questions: []question{{Name: service, Type: typePTR, Class: classIN}},
+	}
+	if _, err := conn.WriteToUDP(query.pack(), groupAddr); err != nil {
+		return nil, fmt.Errorf("failed to send mDNS query: %w", err)
+	}
+
+	var records []record
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				break
+			}
+			return nil, fmt.Errorf("failed to read mDNS reply: %w", err)
+		}
+
+		msg, err := parseMessage(buf[:n])
+		if err != nil || msg.Flags&flagResponse == 0 {
+			continue
+		}
+		records = append(records, msg.Answers...)
+		records = append(records, msg.Extra...)
+	}
+
+	return collectServices(service, records), nil
+}
+
+// LookupAddr asks the LAN over mDNS for the host name of ip, as answered
+// by the host's own responder (Avahi, Bonjour), and returns it without the
+// trailing dot.
+func LookupAddr(ip net.IP, timeout time.Duration) (string, error) {
+	return lookupAddr(ip, timeout, groupAddr)
+}
+
+func lookupAddr(ip net.IP, timeout time.Duration, dest *net.UDPAddr) (string, error) {
+	ip4 := ip.To4()
+	if ip4 == nil {
+		return "", fmt.Errorf("only IPv4 addresses can be looked up")
+	}
+	reverse := fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0])
+
+	rr, err := unicastQuery(question{Name: reverse, Type: typePTR, Class: classIN}, timeout, dest, func(rr record) bool {
+		return rr.Type == typePTR && strings.EqualFold(rr.Name, reverse) && rr.Target != ""
+	})
+	if err != nil {
+		return "", fmt.Errorf("no mDNS name for %s: %w", ip, err)
+	}
+	return strings.TrimSuffix(rr.Target, "."), nil
+}
+
+// LookupHost asks the LAN over mDNS for the IPv4 address of name, such as
+// "nas" or "nas.local".
+func LookupHost(name string, timeout time.Duration) (net.IP, error) {
+	return lookupHost(name, timeout, groupAddr)
+}
+
+func lookupHost(name string, timeout time.Duration, dest *net.UDPAddr) (net.IP, error) {
+	fqdn := strings.TrimSuffix(name, ".") + "."
+	if !strings.HasSuffix(strings.ToLower(fqdn), "."+Domain) {
+		fqdn += Domain
+	}
+
+	rr, err := unicastQuery(question{Name: fqdn, Type: typeA, Class: classIN}, timeout, dest, func(rr record) bool {
+		return rr.Type == typeA && strings.EqualFold(rr.Name, fqdn) && rr.IP != nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("no mDNS address for %s: %w", name, err)
+	}
+	return rr.IP, nil
+}
+
+// unicastQuery sends q to dest and returns the first answer accept takes.
+// Sent from an ephemeral port, it is a legacy unicast query and answers
+// come straight back to us.
+func unicastQuery(q question, timeout time.Duration, dest *net.UDPAddr, accept func(record) bool) (record, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return record{}, fmt.Errorf("failed to open mDNS socket: %w", err)
+	}
+	defer conn.Close()
+
+	query := &message{
+		ID:        uint16(time.Now().UnixNano()),
+		Questions: []question{q},
+	}
+	if _, err := conn.WriteToUDP(query.pack(), dest); err != nil {
+		return record{}, fmt.Errorf("failed to send mDNS query: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buf := make([]byte, 9000)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return record{}, err
+		}
+
+		msg, err := parseMessage(buf[:n])
+		if err != nil || msg.Flags&flagResponse == 0 {
+			continue
+		}
+		for _, rr := range msg.Answers {
+			if accept(rr) {
+				return rr, nil
+			}
+		}
+	}
+}
+
+// collectServices assembles services of the given type from a flat list
+// of records gathered from any number of replies.
+func collectServices(service string, records []record) []Service {
+	service = strings.ToLower(service)
+
+	instances := make(map[string]*Service)
+	var order []string
+	for _, rr := range records {
+		if rr.Type == typePTR && strings.ToLower(rr.Name) == service && rr.TTL > 0 {
+			key := strings.ToLower(rr.Target)
+			if _, exists := instances[key]; !exists {
+				instances[key] = &Service{Instance: strings.TrimSuffix(rr.Target, "."+ServiceType+"."+Domain)}
+				order = append(order, key)
+			}
+		}
+	}
+
+	hosts := make(map[string][]net.IP)
+	for _, rr := range records {
+		key := strings.ToLower(rr.Name)
+		switch rr.Type {
+		case typeSRV:
+			if svc, ok := instances[key]; ok {
+				svc.Host = rr.Target
+				svc.Port = int(rr.Port)
+			}
+		case typeTXT:
+			if svc, ok := instances[key]; ok {
+				svc.TXT = parseTXT(rr.Text)
+			}
+		case typeA:
+			if !containsIP(hosts[key], rr.IP) {
+				hosts[key] = append(hosts[key], rr.IP)
+			}
+		}
+	}
+
+	var services []Service
+	for _, key := range order {
+		svc := instances[key]
+		if svc.Port == 0 {
+			continue
+		}
+		svc.Addrs = hosts[strings.ToLower(svc.Host)]
+		services = append(services, *svc)
+	}
+
+	sort.Slice(services, func(i, j int) bool {
+		return services[i].Instance < services[j].Instance
+	})
+	return services
+}
+
+func parseTXT(text []string) map[string]string {
+	values := make(map[string]string)
+	for _, entry := range text {
+		if entry == "" {
+			continue
+		}
+		key, value, _ := strings.Cut(entry, "=")
+		values[strings.ToLower(key)] = value
+	}
+	return values
+}
+
+func matchesType(qtype, want uint16) bool {
+	return qtype == want || qtype == typeANY
+}
+
+func wantsUnicast(query *message) bool {
+	for _, q := range query.Questions {
+		if q.Class&classQU != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func containsIP(ips []net.IP, ip net.IP) bool {
+	for _, existing := range ips {
+		if existing.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func localIPv4Addrs() []net.IP {
+	interfaces, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+
+	var addrs []net.IP
+	for _, iface := range interfaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range ifaceAddrs {
+			if ipnet, ok := addr.(*net.IPNet); ok {
+				if ip4 := ipnet.IP.To4(); ip4 != nil {
+					addrs = append(addrs, ip4)
+				}
+			}
+		}
+	}
+	return addrs
+}
+
+// sanitizeLabel makes s usable as a single DNS label.
+func sanitizeLabel(s string) string {
+	s = strings.ReplaceAll(strings.TrimSpace(s), ".", "-")
+	if len(s) > 63 {
+		s = s[:63]
+	}
+	return s
+}
+
+// Wire format
+
+func (m *message) pack() []byte {
+	buf := make([]byte, 12, 512)
+	binary.BigEndian.PutUint16(buf[0:], m.ID)
+	binary.BigEndian.PutUint16(buf[2:], m.Flags)
+	binary.BigEndian.PutUint16(buf[4:], uint16(len(m.Questions)))
+	binary.BigEndian.PutUint16(buf[6:], uint16(len(m.Answers)))
+	binary.BigEndian.PutUint16(buf[10:], uint16(len(m.Extra)))
+
+	for _, q := range m.Questions {
+		buf = appendName(buf, q.Name)
+		buf = binary.BigEndian.AppendUint16(buf, q.Type)
+		buf = binary.BigEndian.AppendUint16(buf, q.Class)
+	}
+	for _, rr := range m.Answers {
+		buf = rr.append(buf)
+	}
+	for _, rr := range m.Extra {
+		buf = rr.append(buf)
+	}
+	return buf
+}
+
+func (rr record) append(buf []byte) []byte {
+	var rdata []byte
+	switch rr.Type {
+	case typePTR:
+		rdata = appendName(nil, rr.Target)
+	case typeSRV:
+		rdata = binary.BigEndian.AppendUint16(rdata, 0) // priority
+		rdata = binary.BigEndian.AppendUint16(rdata, 0) // weight
+		rdata = binary.BigEndian.AppendUint16(rdata, rr.Port)
+		rdata = appendName(rdata, rr.Target)
+	case typeTXT:
+		for _, s := range rr.Text {
+			if len(s) > 255 {
+				s = s[:255]
+			}
+			rdata = append(rdata, byte(len(s)))
+			rdata = append(rdata, s...)
+		}
+	case typeA:
+		rdata = append(rdata, rr.IP.To4()...)
+	}
+
+	buf = appendName(buf, rr.Name)
+	buf = binary.BigEndian.AppendUint16(buf, rr.Type)
+	buf = binary.BigEndian.AppendUint16(buf, rr.Class)
+	buf = binary.BigEndian.AppendUint32(buf, rr.TTL)
+	buf = binary.BigEndian.AppendUint16(buf, uint16(len(rdata)))
+	return append(buf, rdata...)
+}
+
+// appendName encodes a dotted name without compression. The first label
+// of an instance name may contain spaces; labels never contain dots.
+func appendName(buf []byte, name string) []byte {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		buf = append(buf, byte(len(label)))
+		buf = append(buf, label...)
+	}
+	return append(buf, 0)
+}
+
+func parseMessage(data []byte) (*message, error) {
+	if len(data) < 12 {
+		return nil, fmt.Errorf("message too short")
+	}
+
+	msg := &message{
+		ID:    binary.BigEndian.Uint16(data[0:]),
+		Flags: binary.BigEndian.Uint16(data[2:]),
+	}
+	qdCount := int(binary.BigEndian.Uint16(data[4:]))
+	anCount := int(binary.BigEndian.Uint16(data[6:]))
+	nsCount := int(binary.BigEndian.Uint16(data[8:]))
+	arCount := int(binary.BigEndian.Uint16(data[10:]))
+
+	off := 12
+	for i := 0; i < qdCount; i++ {
+		name, next, err := readName(data, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(data) {
+			return nil, fmt.Errorf("truncated question")
+		}
+		msg.Questions = append(msg.Questions, question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(data[next:]),
+			Class: binary.BigEndian.Uint16(data[next+2:]),
+		})
+		off = next + 4
+	}
+
+	for i := 0; i < anCount+nsCount+arCount; i++ {
+		rr, next, err := readRecord(data, off)
+		if err != nil {
+			return nil, err
+		}
+		off = next
+
+		switch {
+		case i < anCount:
+			msg.Answers = append(msg.Answers, rr)
+		case i >= anCount+nsCount:
+			msg.Extra = append(msg.Extra, rr)
+		}
+	}
+
+	return msg, nil
+}
+
+func readRecord(data []byte, off int) (record, int, error) {
+	name, off, err := readName(data, off)
+	if err != nil {
+		return record{}, 0, err
+	}
+	if off+10 > len(data) {
+		return record{}, 0, fmt.Errorf("truncated record")
+	}
+
+	rr := record{
+		Name:  name,
+		Type:  binary.BigEndian.Uint16(data[off:]),
+		Class: binary.BigEndian.Uint16(data[off+2:]),
+		TTL:   binary.BigEndian.Uint32(data[off+4:]),
+	}
+	rdLen := int(binary.BigEndian.Uint16(data[off+8:]))
+	start := off + 10
+	end := start + rdLen
+	if end > len(data) {
+		return record{}, 0, fmt.Errorf("truncated record data")
+	}
+
+	switch rr.Type {
+	case typePTR:
+		rr.Target, _, err = readName(data, start)
+	case typeSRV:
+		if rdLen < 7 {
+			return record{}, 0, fmt.Errorf("short SRV record")
+		}
+		rr.Port = binary.BigEndian.Uint16(data[start+4:])
+		rr.Target, _, err = readName(data, start+6)
+	case typeTXT:
+		for i := start; i < end; {
+			l := int(data[i])
+			if i+1+l > end {
+				return record{}, 0, fmt.Errorf("truncated TXT string")
+			}
+			rr.Text = append(rr.Text, string(data[i+1:i+1+l]))
+			i += 1 + l
+		}
+	case typeA:
+		if rdLen == 4 {
+			rr.IP = net.IP(append([]byte(nil), data[start:end]...))
+		}
+	}
+	if err != nil {
+		return record{}, 0, err
+	}
+
+	return rr, end, nil
+}
+
+// readName decodes a possibly compressed name starting at off and returns
+// it with a trailing dot, plus the offset just past it.
+func readName(data []byte, off int) (string, int, error) {
+	var labels []string
+	next := -1
+
+	for jumps := 0; ; {
+		if off >= len(data) {
+			return "", 0, fmt.Errorf("truncated name")
+		}
+
+		l := int(data[off])
+		switch {
+		case l == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			return strings.Join(labels, ".") + ".", next, nil
+		case l&0xC0 == 0xC0:
+			if off+1 >= len(data) {
+				return "", 0, fmt.Errorf("truncated name pointer")
+			}
+			if jumps++; jumps > 16 {
+				return "", 0, fmt.Errorf("name compression loop")
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(data[off:]) & 0x3FFF)
+		default:
+			if off+1+l > len(data) {
+				return "", 0, fmt.Errorf("truncated label")
+			}
+			labels = append(labels, string(data[off+1:off+1+l]))
+			off += 1 + l
+		}
+	}
+}
@@ -0,0 +1,239 @@
+package wol_mdns
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+	wol_log "wol-server/wol/log"
+)
+
+func createTestResponder(t *testing.T) *Responder {
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+
+	responder, err := NewResponder(Config{
+		Instance: "wol-server on test.host",
+		Port:     8080,
+		TXT:      []string{"version=1.0.0", "path=/api", "auth=false"},
+		Addrs:    []net.IP{net.ParseIP("192.168.1.10")},
+	}, logger)
+	if err != nil {
+		t.Fatalf("Failed to create responder: %v", err)
+	}
+	return responder
+}
+
+func TestNewResponder(t *testing.T) {
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{"valid", Config{Port: 8080, Addrs: []net.IP{net.ParseIP("10.0.0.1")}}, false},
+		{"zero port", Config{Port: 0, Addrs: []net.IP{net.ParseIP("10.0.0.1")}}, true},
+		{"port too large", Config{Port: 70000, Addrs: []net.IP{net.ParseIP("10.0.0.1")}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewResponder(tt.config, logger)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewResponder() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResponder_Answer(t *testing.T) {
+	responder := createTestResponder(t)
+
+	tests := []struct {
+		name        string
+		question    question
+		wantAnswers int
+		wantNil     bool
+	}{
+		{"service PTR", question{Name: "_wol-server._tcp.local.", Type: typePTR, Class: classIN}, 1, false},
+		{"case insensitive", question{Name: "_WOL-SERVER._TCP.LOCAL.", Type: typePTR, Class: classIN}, 1, false},
+		{"service enumeration", question{Name: servicesEnumeration, Type: typePTR, Class: classIN}, 1, false},
+		{"instance ANY", question{Name: "wol-server on test-host._wol-server._tcp.local.", Type: typeANY, Class: classIN}, 2, false},
+		{"host A", question{Name: responder.host, Type: typeA, Class: classIN}, 1, false},
+		{"other service", question{Name: "_http._tcp.local.", Type: typePTR, Class: classIN}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reply := responder.answer(&message{Questions: []question{tt.question}}, false)
+			if tt.wantNil {
+				if reply != nil {
+					t.Errorf("answer() = %+v, want nil", reply)
+				}
+				return
+			}
+			if reply == nil {
+				t.Fatal("answer() = nil, want reply")
+			}
+			if len(reply.Answers) != tt.wantAnswers {
+				t.Errorf("answer() returned %d answers, want %d", len(reply.Answers), tt.wantAnswers)
+			}
+			if reply.Flags&flagResponse == 0 {
+				t.Error("reply is not flagged as a response")
+			}
+		})
+	}
+}
+
+func TestResponder_LegacyUnicast(t *testing.T) {
+	responder := createTestResponder(t)
+
+	query := &message{ID: 4242, Questions: []question{{Name: "_wol-server._tcp.local.", Type: typePTR, Class: classIN}}}
+	reply := responder.answer(query, true)
+	if reply == nil {
+		t.Fatal("answer() = nil, want reply")
+	}
+	if reply.ID != 4242 {
+		t.Errorf("reply ID = %d, want 4242", reply.ID)
+	}
+	if len(reply.Questions) != 1 {
+		t.Errorf("reply echoes %d questions, want 1", len(reply.Questions))
+	}
+	for _, rr := range append(reply.Answers, reply.Extra...) {
+		if rr.TTL > legacyUnicastTTL {
+			t.Errorf("record %s TTL = %d, want <= %d", rr.Name, rr.TTL, legacyUnicastTTL)
+		}
+		if rr.Class&cacheFlush != 0 {
+			t.Errorf("record %s has cache-flush bit set in legacy reply", rr.Name)
+		}
+	}
+}
+
+func TestBrowse_CollectServices(t *testing.T) {
+	responder := createTestResponder(t)
+
+	// Round-trip the reply through the wire format, as Browse would see it
+	query := &message{Questions: []question{{Name: "_wol-server._tcp.local.", Type: typePTR, Class: classIN}}}
+	parsed, err := parseMessage(responder.answer(query, true).pack())
+	if err != nil {
+		t.Fatalf("parseMessage() error = %v", err)
+	}
+
+	services := collectServices(ServiceType+"."+Domain, append(parsed.Answers, parsed.Extra...))
+	if len(services) != 1 {
+		t.Fatalf("collectServices() found %d services, want 1", len(services))
+	}
+
+	svc := services[0]
+	if svc.Instance != "wol-server on test-host" {
+		t.Errorf("Instance = %q, want %q", svc.Instance, "wol-server on test-host")
+	}
+	if svc.Port != 8080 {
+		t.Errorf("Port = %d, want 8080", svc.Port)
+	}
+	if svc.TXT["path"] != "/api" || svc.TXT["version"] != "1.0.0" {
+		t.Errorf("TXT = %v", svc.TXT)
+	}
+	if svc.URL() != "http://192.168.1.10:8080" {
+		t.Errorf("URL() = %s, want http://192.168.1.10:8080", svc.URL())
+	}
+}
+
+func TestLookupAddr(t *testing.T) {
+	responder, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer responder.Close()
+
+	go func() {
+		buf := make([]byte, 512)
+		n, from, err := responder.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		query, err := parseMessage(buf[:n])
+		if err != nil || len(query.Questions) != 1 {
+			return
+		}
+		reply := &message{
+			ID:      query.ID,
+			Flags:   flagResponse | flagAuthoritative,
+			Answers: []record{{Name: query.Questions[0].Name, Type: typePTR, Class: classIN, TTL: 10, Target: "nas.local."}},
+		}
+		responder.WriteToUDP(reply.pack(), from)
+	}()
+
+	name, err := lookupAddr(net.IPv4(192, 168, 1, 20), time.Second, responder.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatalf("lookupAddr() error = %v", err)
+	}
+	if name != "nas.local" {
+		t.Errorf("lookupAddr() = %q, want %q", name, "nas.local")
+	}
+
+	if _, err := LookupAddr(net.ParseIP("::1"), time.Millisecond); err == nil {
+		t.Error("LookupAddr() expected error for an IPv6 address")
+	}
+}
+
+func TestLookupHost(t *testing.T) {
+	responder, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer responder.Close()
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := responder.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			query, err := parseMessage(buf[:n])
+			if err != nil || len(query.Questions) != 1 || !strings.EqualFold(query.Questions[0].Name, "nas.local.") {
+				continue
+			}
+			reply := &message{
+				ID:      query.ID,
+				Flags:   flagResponse | flagAuthoritative,
+				Answers: []record{{Name: "nas.local.", Type: typeA, Class: classIN, TTL: 10, IP: net.IPv4(192, 168, 1, 20)}},
+			}
+			responder.WriteToUDP(reply.pack(), from)
+		}
+	}()
+
+	for _, name := range []string{"nas", "nas.local", "NAS.local."} {
+		ip, err := lookupHost(name, time.Second, responder.LocalAddr().(*net.UDPAddr))
+		if err != nil {
+			t.Fatalf("lookupHost(%q) error = %v", name, err)
+		}
+		if !ip.Equal(net.IPv4(192, 168, 1, 20)) {
+			t.Errorf("lookupHost(%q) = %s, want 192.168.1.20", name, ip)
+		}
+	}
+}
+
+func TestReadName_Compression(t *testing.T) {
+	// "local." at offset 12, then "a" + pointer to offset 12
+	data := make([]byte, 12)
+	data = append(data, 5, 'l', 'o', 'c', 'a', 'l', 0)
+	data = append(data, 1, 'a', 0xC0, 12)
+
+	name, next, err := readName(data, 19)
+	if err != nil {
+		t.Fatalf("readName() error = %v", err)
+	}
+	if name != "a.local." {
+		t.Errorf("readName() = %q, want %q", name, "a.local.")
+	}
+	if next != len(data) {
+		t.Errorf("readName() next = %d, want %d", next, len(data))
+	}
+
+	loop := append(make([]byte, 12), 0xC0, 12)
+	if _, _, err := readName(loop, 12); err == nil {
+		t.Error("readName() expected error for compression loop")
+	}
+}
@@ -0,0 +1,244 @@
+package wol_metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType is the Prometheus text exposition format version 0.0.4.
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets suit HTTP request durations in seconds.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type metric interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds metrics in the order they were created and writes them in
+// the Prometheus text format.
+type Registry struct {
+	mu      sync.Mutex
+	metrics []metric
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+func (r *Registry) add(m metric) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metrics = append(r.metrics, m)
+}
+
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	metrics := append([]metric(nil), r.metrics...)
+	r.mu.Unlock()
+
+	counter := &countingWriter{w: w}
+	buf := bufio.NewWriter(counter)
+	for _, m := range metrics {
+		m.write(buf)
+	}
+	err := buf.Flush()
+	return counter.n, err
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteTo(w)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// series is the label values of one time series, joined by 0xff, which
+// never occurs in UTF-8 text.
+type series string
+
+func newSeries(labels []string, values []string) series {
+	if len(values) != len(labels) {
+		panic(fmt.Sprintf("metrics: got %d label values for labels %v", len(values), labels))
+	}
+	return series(strings.Join(values, "\xff"))
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func (s series) labels(names []string, extra ...string) string {
+	var pairs []string
+	if len(names) > 0 {
+		for i, value := range strings.Split(string(s), "\xff") {
+			pairs = append(pairs, names[i]+`="`+labelEscaper.Replace(value)+`"`)
+		}
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, extra[i]+`="`+labelEscaper.Replace(extra[i+1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedSeries[V any](values map[series]V) []series {
+	keys := make([]series, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+	return keys
+}
+
+func writeHeader(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, strings.ReplaceAll(help, "\n", " "))
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing value per combination of label
+// values.
+type Counter struct {
+	name, help string
+	labels     []string
+
+	mu     sync.Mutex
+	values map[series]float64
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) *Counter {
+	c := &Counter{name: name, help: help, labels: labels, values: make(map[series]float64)}
+	r.add(c)
+	return c
+}
+
+// Inc adds one to the series with the given label values, in the order
+// the labels were declared.
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+func (c *Counter) Add(v float64, labelValues ...string) {
+	key := newSeries(c.labels, labelValues)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.values[key] += v
+}
+
+func (c *Counter) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	writeHeader(w, c.name, c.help, "counter")
+	for _, key := range sortedSeries(c.values) {
+		fmt.Fprintf(w, "%s%s %s\n", c.name, key.labels(c.labels), formatFloat(c.values[key]))
+	}
+}
+
+// GaugeFunc reports the value of a function at scrape time.
+type GaugeFunc struct {
+	name, help string
+	fn         func() float64
+}
+
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) *GaugeFunc {
+	g := &GaugeFunc{name: name, help: help, fn: fn}
+	r.add(g)
+	return g
+}
+
+func (g *GaugeFunc) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	fmt.Fprintf(w, "%s %s\n", g.name, formatFloat(g.fn()))
+}
+
+// Histogram counts observations into cumulative buckets per combination
+// of label values.
+type Histogram struct {
+	name, help string
+	labels     []string
+	buckets    []float64
+
+	mu     sync.Mutex
+	values map[series]*histogramValue
+}
+
+type histogramValue struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewHistogram makes a histogram with the given upper bounds, which must
+// be in increasing order; nil means DefaultBuckets.
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &Histogram{name: name, help: help, labels: labels, buckets: buckets, values: make(map[series]*histogramValue)}
+	r.add(h)
+	return h
+}
+
+func (h *Histogram) Observe(v float64, labelValues ...string) {
+	key := newSeries(h.labels, labelValues)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	value, ok := h.values[key]
+	if !ok {
+		value = &histogramValue{counts: make([]uint64, len(h.buckets))}
+		h.values[key] = value
+	}
+	for i, bound := range h.buckets {
+		if v <= bound {
+			value.counts[i]++
+		}
+	}
+	value.count++
+	value.sum += v
+}
+
+func (h *Histogram) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	writeHeader(w, h.name, h.help, "histogram")
+	for _, key := range sortedSeries(h.values) {
+		value := h.values[key]
+		for i, bound := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, key.labels(h.labels, "le", formatFloat(bound)), value.counts[i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name, key.labels(h.labels, "le", "+Inf"), value.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name, key.labels(h.labels), formatFloat(value.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.name, key.labels(h.labels), value.count)
+	}
+}
@@ -0,0 +1,69 @@
+package wol_metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	registry := NewRegistry()
+	wakes := registry.NewCounter("wol_wake_attempts_total", "Wake attempts.", "result")
+	registry.NewGaugeFunc("wol_devices", "Configured devices.", func() float64 { return 3 })
+	durations := registry.NewHistogram("wol_http_request_duration_seconds", "Request durations.", []float64{0.1, 1}, "route")
+
+	wakes.Inc("success")
+	wakes.Inc("success")
+	wakes.Inc(`fail"ure`)
+	durations.Observe(0.05, "/api/wake")
+	durations.Observe(0.5, "/api/wake")
+	durations.Observe(3, "/api/wake")
+
+	var b strings.Builder
+	if _, err := registry.WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+
+	want := `# HELP wol_wake_attempts_total Wake attempts.
+# TYPE wol_wake_attempts_total counter
+wol_wake_attempts_total{result="fail\"ure"} 1
+wol_wake_attempts_total{result="success"} 2
+# HELP wol_devices Configured devices.
+# TYPE wol_devices gauge
+wol_devices 3
+# HELP wol_http_request_duration_seconds Request durations.
+# TYPE wol_http_request_duration_seconds histogram
+wol_http_request_duration_seconds_bucket{route="/api/wake",le="0.1"} 1
+wol_http_request_duration_seconds_bucket{route="/api/wake",le="1"} 2
+wol_http_request_duration_seconds_bucket{route="/api/wake",le="+Inf"} 3
+wol_http_request_duration_seconds_sum{route="/api/wake"} 3.55
+wol_http_request_duration_seconds_count{route="/api/wake"} 3
+`
+	if b.String() != want {
+		t.Errorf("WriteTo() =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestRegistry_Handler(t *testing.T) {
+	registry := NewRegistry()
+	registry.NewCounter("wol_test_total", "Test.").Inc()
+
+	rec := httptest.NewRecorder()
+	registry.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if rec.Header().Get("Content-Type") != ContentType {
+		t.Errorf("Content-Type = %q", rec.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rec.Body.String(), "wol_test_total 1\n") {
+		t.Errorf("body = %q", rec.Body.String())
+	}
+}
+
+func TestCounter_WrongLabelCount(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc() with the wrong number of label values should panic")
+		}
+	}()
+	NewRegistry().NewCounter("wol_test_total", "Test.", "result").Inc()
+}
@@ -0,0 +1,443 @@
+package wol_monitor
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_log "wol-server/wol/log"
+	wol_packet "wol-server/wol/packet"
+)
+
+const (
+	DefaultHistory = 200
+
+	ViaUDP = "udp"
+	ViaRaw = "raw"
+
+	etherTypeIPv4 = 0x0800
+	etherTypeIPv6 = 0x86DD
+	etherTypeVLAN = 0x8100
+	etherTypeWoL  = 0x0842
+)
+
+// DefaultPorts are the UDP ports wake tools commonly send to.
+var DefaultPorts = []int{7, 9}
+
+// Packet is a magic packet seen on the network.
+type Packet struct {
+	Time      time.Time `json:"time"`
+	Source    string    `json:"source"`
+	TargetMAC string    `json:"target_mac"`
+	Device    string    `json:"device,omitempty"`
+	Port      int       `json:"port,omitempty"`
+	Via       string    `json:"via"`
+	SecureOn  bool      `json:"secureon,omitempty"`
+}
+
+func (p Packet) String() string {
+	target := p.TargetMAC
+	if p.Device != "" {
+		target = fmt.Sprintf("%s (%s)", p.Device, p.TargetMAC)
+	}
+
+	via := p.Via
+	if p.Port != 0 {
+		via = fmt.Sprintf("%s/%d", p.Via, p.Port)
+	}
+
+	return fmt.Sprintf("%s -> %s via %s", p.Source, target, via)
+}
+
+type Config struct {
+	// Ports are the UDP ports to bind (default 7 and 9)
+	Ports []int
+	// Raw captures every frame on Interface through a raw socket instead
+	// of binding ports, which also sees EtherType 0x0842 packets and
+	// packets to any UDP port. Linux only; needs CAP_NET_RAW.
+	Raw       bool
+	Interface string
+	History   int
+	// RecordFile appends every packet seen to this file as a line of JSON,
+	// an audit trail that also restores the history after a restart
+	RecordFile string
+}
+
+// rawCapture reads whole link-layer frames; see raw_linux.go.
+type rawCapture interface {
+	ReadFrame(buffer []byte) (int, error)
+	Close() error
+}
+
+// Monitor listens for magic packets from any sender and records who woke
+// what.
+type Monitor struct {
+	config Config
+	store  *wol_device.DeviceStore
+	logger *wol_log.Logger
+
+	mu          sync.Mutex
+	history     []Packet
+	subscribers map[chan Packet]struct{}
+	conns       []*net.UDPConn
+	recordFile  *os.File
+	done        chan struct{}
+	wg          sync.WaitGroup
+}
+
+func NewMonitor(config Config, store *wol_device.DeviceStore, logger *wol_log.Logger) *Monitor {
+	if len(config.Ports) == 0 {
+		config.Ports = DefaultPorts
+	}
+	if config.History <= 0 {
+		config.History = DefaultHistory
+	}
+
+	return &Monitor{
+		config:      config,
+		store:       store,
+		logger:      logger,
+		subscribers: make(map[chan Packet]struct{}),
+		done:        make(chan struct{}),
+	}
+}
+
+func (m *Monitor) Start() error {
+	if m.config.RecordFile != "" {
+		if err := m.openRecord(); err != nil {
+			return err
+		}
+	}
+
+	if m.config.Raw {
+		capture, err := openRawCapture(m.config.Interface)
+		if err != nil {
+			return fmt.Errorf("failed to open raw capture: %w", err)
+		}
+
+		m.wg.Add(1)
+		go m.captureRaw(capture)
+		m.logger.Info("Monitor: Capturing magic packets on %s", describeInterface(m.config.Interface))
+		return nil
+	}
+
+	var bound []string
+	for _, port := range m.config.Ports {
+		conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+		if err != nil {
+			// Port 7 is often taken by an echo service; keep the others
+			m.logger.Warn("Monitor: Failed to listen on UDP port %d: %v", port, err)
+			continue
+		}
+
+		m.mu.Lock()
+		m.conns = append(m.conns, conn)
+		m.mu.Unlock()
+
+		m.wg.Add(1)
+		go m.listenUDP(conn, port)
+		bound = append(bound, fmt.Sprint(port))
+	}
+
+	if len(bound) == 0 {
+		return fmt.Errorf("failed to listen on any of UDP ports %v", m.config.Ports)
+	}
+
+	m.logger.Info("Monitor: Listening for magic packets on UDP ports %s", strings.Join(bound, ", "))
+	return nil
+}
+
+func (m *Monitor) Stop() {
+	m.mu.Lock()
+	select {
+	case <-m.done:
+	default:
+		close(m.done)
+	}
+	for _, conn := range m.conns {
+		conn.Close()
+	}
+	m.conns = nil
+	m.mu.Unlock()
+
+	m.wg.Wait()
+
+	m.mu.Lock()
+	if m.recordFile != nil {
+		m.recordFile.Close()
+		m.recordFile = nil
+	}
+	m.mu.Unlock()
+}
+
+// openRecord loads the newest recorded packets into the history and opens
+// the record file for appending.
+func (m *Monitor) openRecord() error {
+	if data, err := os.ReadFile(m.config.RecordFile); err == nil {
+		var history []Packet
+		for _, line := range strings.Split(string(data), "\n") {
+			var packet Packet
+			if line = strings.TrimSpace(line); line != "" && json.Unmarshal([]byte(line), &packet) == nil {
+				history = append(history, packet)
+			}
+		}
+		if len(history) > m.config.History {
+			history = history[len(history)-m.config.History:]
+		}
+		m.mu.Lock()
+		m.history = history
+		m.mu.Unlock()
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read packet record: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.config.RecordFile), 0755); err != nil {
+		return fmt.Errorf("failed to create packet record directory: %w", err)
+	}
+	file, err := os.OpenFile(m.config.RecordFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open packet record: %w", err)
+	}
+
+	m.mu.Lock()
+	m.recordFile = file
+	m.mu.Unlock()
+	return nil
+}
+
+// Recent returns up to limit of the most recently seen packets, newest
+// first. A limit of 0 returns the whole history.
+func (m *Monitor) Recent(limit int) []Packet {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if limit <= 0 || limit > len(m.history) {
+		limit = len(m.history)
+	}
+
+	packets := make([]Packet, 0, limit)
+	for i := len(m.history) - 1; i >= len(m.history)-limit; i-- {
+		packets = append(packets, m.history[i])
+	}
+	return packets
+}
+
+// Subscribe returns a channel receiving every packet seen from now on and
+// a function that ends the subscription. Slow subscribers miss packets
+// rather than block the monitor.
+func (m *Monitor) Subscribe() (<-chan Packet, func()) {
+	ch := make(chan Packet, 16)
+
+	m.mu.Lock()
+	m.subscribers[ch] = struct{}{}
+	m.mu.Unlock()
+
+	return ch, func() {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if _, ok := m.subscribers[ch]; ok {
+			delete(m.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (m *Monitor) listenUDP(conn *net.UDPConn, port int) {
+	defer m.wg.Done()
+
+	buffer := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			select {
+			case <-m.done:
+				return
+			default:
+				m.logger.Debug("Monitor: Read on UDP port %d failed: %v", port, err)
+				continue
+			}
+		}
+
+		mac, secureOn, ok := findMagicPacket(buffer[:n])
+		if !ok {
+			continue
+		}
+
+		m.record(Packet{
+			Time:      time.Now(),
+			Source:    addr.IP.String(),
+			TargetMAC: mac,
+			Port:      port,
+			Via:       ViaUDP,
+			SecureOn:  secureOn,
+		})
+	}
+}
+
+func (m *Monitor) captureRaw(capture rawCapture) {
+	defer m.wg.Done()
+	defer capture.Close()
+
+	buffer := make([]byte, 65536)
+	for {
+		select {
+		case <-m.done:
+			return
+		default:
+		}
+
+		n, err := capture.ReadFrame(buffer)
+		if err != nil || n == 0 {
+			continue
+		}
+
+		packet, ok := parseFrame(buffer[:n])
+		if !ok {
+			continue
+		}
+
+		packet.Time = time.Now()
+		m.record(packet)
+	}
+}
+
+func (m *Monitor) record(packet Packet) {
+	if device := m.matchDevice(packet.TargetMAC); device != nil {
+		packet.Device = device.Name
+	}
+
+	m.logger.Info("Monitor: Magic packet %s", packet)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.history = append(m.history, packet)
+	if len(m.history) > m.config.History {
+		m.history = m.history[len(m.history)-m.config.History:]
+	}
+
+	if m.recordFile != nil {
+		line, _ := json.Marshal(packet)
+		if _, err := m.recordFile.Write(append(line, '\n')); err != nil {
+			m.logger.Warn("Monitor: Failed to record packet: %v", err)
+		}
+	}
+
+	for ch := range m.subscribers {
+		select {
+		case ch <- packet:
+		default:
+		}
+	}
+}
+
+func (m *Monitor) matchDevice(mac string) *wol_device.Device {
+	if m.store == nil {
+		return nil
+	}
+
+	device, err := m.store.FindByMAC(mac)
+	if err != nil {
+		return nil
+	}
+	return device
+}
+
+// findMagicPacket looks for a synchronization stream of six 0xFF bytes
+// followed by sixteen repetitions of a MAC address anywhere in payload,
+// and reports whether a 4 or 6 byte SecureOn password follows it.
+func findMagicPacket(payload []byte) (string, bool, bool) {
+	for i := 0; i+102 <= len(payload); i++ {
+		if !magicPacketAt(payload, i) {
+			continue
+		}
+
+		// In a run of more than six 0xFF bytes the sync stream is the last
+		// six, not the first
+		for payload[i+6] == 0xFF && magicPacketAt(payload, i+1) {
+			i++
+		}
+
+		rest := len(payload) - (i + 102)
+		return strings.ToUpper(net.HardwareAddr(payload[i+6 : i+12]).String()), rest == 4 || rest == 6, true
+	}
+
+	return "", false, false
+}
+
+func magicPacketAt(payload []byte, i int) bool {
+	if i+102 > len(payload) {
+		return false
+	}
+
+	_, _, err := wol_packet.ParseMagicPacket(payload[i : i+102])
+	return err == nil
+}
+
+// parseFrame extracts a magic packet from an Ethernet frame carrying
+// either EtherType 0x0842 or UDP over IPv4/IPv6.
+func parseFrame(frame []byte) (Packet, bool) {
+	if len(frame) < 14 {
+		return Packet{}, false
+	}
+
+	source := strings.ToUpper(net.HardwareAddr(frame[6:12]).String())
+	etherType := binary.BigEndian.Uint16(frame[12:14])
+	offset := 14
+	if etherType == etherTypeVLAN && len(frame) >= 18 {
+		etherType = binary.BigEndian.Uint16(frame[16:18])
+		offset = 18
+	}
+	payload := frame[offset:]
+
+	packet := Packet{Source: source, Via: ViaRaw}
+
+	switch etherType {
+	case etherTypeWoL:
+	case etherTypeIPv4:
+		if len(payload) < 20 || payload[9] != 17 {
+			return Packet{}, false
+		}
+		headerLen := int(payload[0]&0x0F) * 4
+		packet.Source = net.IP(payload[12:16]).String()
+		payload = payload[min(headerLen, len(payload)):]
+	case etherTypeIPv6:
+		if len(payload) < 40 || payload[6] != 17 {
+			return Packet{}, false
+		}
+		packet.Source = net.IP(payload[8:24]).String()
+		payload = payload[40:]
+	default:
+		return Packet{}, false
+	}
+
+	if etherType != etherTypeWoL {
+		if len(payload) < 8 {
+			return Packet{}, false
+		}
+		packet.Port = int(binary.BigEndian.Uint16(payload[2:4]))
+		payload = payload[8:]
+	}
+
+	mac, secureOn, ok := findMagicPacket(payload)
+	if !ok {
+		return Packet{}, false
+	}
+
+	packet.TargetMAC = mac
+	packet.SecureOn = secureOn
+	return packet, true
+}
+
+func describeInterface(name string) string {
+	if name == "" {
+		return "all interfaces"
+	}
+	return name
+}
@@ -0,0 +1,203 @@
+package wol_monitor
+
+import (
+	"encoding/binary"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_log "wol-server/wol/log"
+	wol_packet "wol-server/wol/packet"
+)
+
+func magicPacket(t *testing.T, mac string) []byte {
+	t.Helper()
+	packet, err := wol_packet.BuildMagicPacket(mac)
+	if err != nil {
+		t.Fatalf("BuildMagicPacket() error = %v", err)
+	}
+	return packet
+}
+
+func TestFindMagicPacket(t *testing.T) {
+	packet := magicPacket(t, "AA:BB:CC:DD:EE:FF")
+
+	tests := []struct {
+		name         string
+		payload      []byte
+		wantMAC      string
+		wantSecureOn bool
+		wantOK       bool
+	}{
+		{"plain", packet, "AA:BB:CC:DD:EE:FF", false, true},
+		{"after header", append([]byte{0x01, 0x02, 0xFF}, packet...), "AA:BB:CC:DD:EE:FF", false, true},
+		{"SecureOn password", append(append([]byte{}, packet...), 1, 2, 3, 4, 5, 6), "AA:BB:CC:DD:EE:FF", true, true},
+		{"truncated", packet[:101], "", false, false},
+		{"not repeated", append(append([]byte{}, packet[:96]...), 0, 0, 0, 0, 0, 0), "", false, false},
+		{"empty", nil, "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mac, secureOn, ok := findMagicPacket(tt.payload)
+			if ok != tt.wantOK || mac != tt.wantMAC || secureOn != tt.wantSecureOn {
+				t.Errorf("findMagicPacket() = %q, %v, %v, want %q, %v, %v", mac, secureOn, ok, tt.wantMAC, tt.wantSecureOn, tt.wantOK)
+			}
+		})
+	}
+}
+
+func ethernetFrame(etherType uint16, payload []byte) []byte {
+	frame := []byte{
+		0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, // destination
+		0x02, 0x00, 0x00, 0x00, 0x00, 0x01, // source
+		0, 0,
+	}
+	binary.BigEndian.PutUint16(frame[12:], etherType)
+	return append(frame, payload...)
+}
+
+func udpIPv4(src net.IP, port uint16, payload []byte) []byte {
+	ip := make([]byte, 20)
+	ip[0] = 0x45
+	ip[9] = 17
+	copy(ip[12:16], src.To4())
+
+	udp := make([]byte, 8)
+	binary.BigEndian.PutUint16(udp[2:], port)
+	return append(append(ip, udp...), payload...)
+}
+
+func TestParseFrame(t *testing.T) {
+	packet := magicPacket(t, "00:11:22:33:44:55")
+	vlan := append([]byte{0x00, 0x0A, 0x08, 0x42}, packet...)
+
+	tests := []struct {
+		name       string
+		frame      []byte
+		wantSource string
+		wantPort   int
+		wantOK     bool
+	}{
+		{"EtherType 0x0842", ethernetFrame(etherTypeWoL, packet), "02:00:00:00:00:01", 0, true},
+		{"UDP over IPv4", ethernetFrame(etherTypeIPv4, udpIPv4(net.ParseIP("192.168.1.10"), 9, packet)), "192.168.1.10", 9, true},
+		{"VLAN tagged", ethernetFrame(etherTypeVLAN, vlan), "02:00:00:00:00:01", 0, true},
+		{"TCP is ignored", ethernetFrame(etherTypeIPv4, append([]byte{0x45, 0, 0, 0, 0, 0, 0, 0, 0, 6}, make([]byte, 10)...)), "", 0, false},
+		{"ARP is ignored", ethernetFrame(0x0806, make([]byte, 28)), "", 0, false},
+		{"runt", []byte{1, 2, 3}, "", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseFrame(tt.frame)
+			if ok != tt.wantOK {
+				t.Fatalf("parseFrame() ok = %v, want %v", ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if got.Source != tt.wantSource || got.Port != tt.wantPort || got.TargetMAC != "00:11:22:33:44:55" {
+				t.Errorf("parseFrame() = %+v", got)
+			}
+		})
+	}
+}
+
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("failed to find a free port: %v", err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestMonitor(t *testing.T) {
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+
+	config := wol_device.DefaultDeviceConfig()
+	config.ConfigPath = filepath.Join(t.TempDir(), "devices.json")
+	store, err := wol_device.NewDeviceStore(config)
+	if err != nil {
+		t.Fatalf("NewDeviceStore() error = %v", err)
+	}
+	store.AddDevice("nas", "aa-bb-cc-dd-ee-ff", "", "", 9)
+
+	port := freeUDPPort(t)
+	monitor := NewMonitor(Config{Ports: []int{port}}, store, logger)
+	if err := monitor.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer monitor.Stop()
+
+	packets, cancel := monitor.Subscribe()
+	defer cancel()
+
+	conn, err := net.Dial("udp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatalf("Dial() error = %v", err)
+	}
+	conn.Write([]byte("not a magic packet"))
+	conn.Write(magicPacket(t, "AA:BB:CC:DD:EE:FF"))
+	conn.Close()
+
+	select {
+	case packet := <-packets:
+		if packet.Device != "nas" || packet.TargetMAC != "AA:BB:CC:DD:EE:FF" || packet.Source != "127.0.0.1" || packet.Port != port {
+			t.Errorf("packet = %+v", packet)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no packet received")
+	}
+
+	if recent := monitor.Recent(10); len(recent) != 1 {
+		t.Errorf("Recent() returned %d packets, want 1", len(recent))
+	}
+}
+
+func TestMonitor_History(t *testing.T) {
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+	monitor := NewMonitor(Config{History: 3}, nil, logger)
+
+	for i := 1; i <= 5; i++ {
+		monitor.record(Packet{TargetMAC: "00:00:00:00:00:0" + strconv.Itoa(i)})
+	}
+
+	recent := monitor.Recent(0)
+	if len(recent) != 3 {
+		t.Fatalf("Recent() returned %d packets, want 3", len(recent))
+	}
+	if recent[0].TargetMAC != "00:00:00:00:00:05" || recent[2].TargetMAC != "00:00:00:00:00:03" {
+		t.Errorf("Recent() = %+v, want newest first", recent)
+	}
+	if got := monitor.Recent(1); len(got) != 1 || got[0].TargetMAC != "00:00:00:00:00:05" {
+		t.Errorf("Recent(1) = %+v", got)
+	}
+}
+
+func TestMonitor_RecordFile(t *testing.T) {
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+	record := filepath.Join(t.TempDir(), "packets.jsonl")
+
+	first := NewMonitor(Config{Ports: []int{freeUDPPort(t)}, RecordFile: record}, nil, logger)
+	if err := first.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	first.record(Packet{Source: "192.168.1.5", TargetMAC: "00:11:22:33:44:55", Via: ViaUDP})
+	first.record(Packet{Source: "192.168.1.6", TargetMAC: "AA:BB:CC:DD:EE:FF", Via: ViaUDP})
+	first.Stop()
+
+	second := NewMonitor(Config{Ports: []int{freeUDPPort(t)}, RecordFile: record, History: 1}, nil, logger)
+	if err := second.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer second.Stop()
+
+	recent := second.Recent(0)
+	if len(recent) != 1 || recent[0].Source != "192.168.1.6" {
+		t.Errorf("Recent() after restart = %+v, want the newest recorded packet", recent)
+	}
+}
@@ -0,0 +1,60 @@
+//go:build linux
+
+package wol_monitor
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+const ethPAll = 0x0003
+
+type packetSocket struct {
+	fd int
+}
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+// openRawCapture opens an AF_PACKET socket receiving every frame on iface,
+// or on all interfaces when iface is empty.
+func openRawCapture(iface string) (rawCapture, error) {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(ethPAll)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open packet socket (needs root or CAP_NET_RAW): %w", err)
+	}
+
+	if iface != "" {
+		ifi, err := net.InterfaceByName(iface)
+		if err != nil {
+			syscall.Close(fd)
+			return nil, fmt.Errorf("unknown interface %s: %w", iface, err)
+		}
+
+		addr := &syscall.SockaddrLinklayer{Protocol: htons(ethPAll), Ifindex: ifi.Index}
+		if err := syscall.Bind(fd, addr); err != nil {
+			syscall.Close(fd)
+			return nil, fmt.Errorf("failed to bind to %s: %w", iface, err)
+		}
+	}
+
+	// Wake up periodically so Stop is noticed
+	timeout := syscall.Timeval{Sec: 1}
+	if err := syscall.SetsockoptTimeval(fd, syscall.SOL_SOCKET, syscall.SO_RCVTIMEO, &timeout); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("failed to set read timeout: %w", err)
+	}
+
+	return &packetSocket{fd: fd}, nil
+}
+
+func (s *packetSocket) ReadFrame(buffer []byte) (int, error) {
+	n, _, err := syscall.Recvfrom(s.fd, buffer, 0)
+	return n, err
+}
+
+func (s *packetSocket) Close() error {
+	return syscall.Close(s.fd)
+}
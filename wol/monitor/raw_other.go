@@ -0,0 +1,9 @@
+//go:build !linux
+
+package wol_monitor
+
+import "fmt"
+
+func openRawCapture(iface string) (rawCapture, error) {
+	return nil, fmt.Errorf("raw capture is only supported on Linux")
+}
@@ -0,0 +1,170 @@
+package wol_network
+
+import (
+	"fmt"
+	"net"
+	"runtime"
+	"strconv"
+	"time"
+	wol_packet "wol-server/wol/packet"
+)
+
+const (
+	// BenchBuild only builds packets, measuring the packet code alone
+	BenchBuild = "build"
+	// BenchUnicast builds and sends each packet to Target the way a wake
+	// does: a fresh socket per packet
+	BenchUnicast = "unicast"
+	// BenchBroadcast is BenchUnicast to the limited broadcast address;
+	// every host on the LAN receives the packets
+	BenchBroadcast = "broadcast"
+	// BenchReuse sends every packet through one socket, the lower bound for
+	// per-packet overhead
+	BenchReuse = "reuse"
+	// BenchPool sends every packet through a Sender, as bulk wakes do
+	BenchPool = "pool"
+
+	// BenchMAC is a locally administered address no real NIC will have, so
+	// benchmark packets never wake anything.
+	BenchMAC = "02:00:5E:00:53:01"
+)
+
+type BenchConfig struct {
+	Mode   string
+	Count  int
+	Target string
+	Port   int
+}
+
+type BenchResult struct {
+	Mode             string        `json:"mode"`
+	Packets          int           `json:"packets"`
+	Errors           int           `json:"errors"`
+	Elapsed          time.Duration `json:"elapsed"`
+	PacketsPerSecond float64       `json:"packets_per_second"`
+	AllocsPerPacket  float64       `json:"allocs_per_packet"`
+	BytesPerPacket   float64       `json:"bytes_per_packet"`
+}
+
+func (r *BenchResult) String() string {
+	return fmt.Sprintf("%-10s %8d pkts %6d errs %10.0f pkt/s %8.1f allocs/pkt %10.1f B/pkt",
+		r.Mode, r.Packets, r.Errors, r.PacketsPerSecond, r.AllocsPerPacket, r.BytesPerPacket)
+}
+
+// Bench measures the throughput and allocations of the build+send pipeline.
+// Without a Target, unicast, reuse and pool modes send to a sink on the loopback
+// interface so nothing leaves the host.
+func Bench(config BenchConfig) (*BenchResult, error) {
+	if config.Count <= 0 {
+		config.Count = 1000
+	}
+	if config.Port == 0 {
+		config.Port = DefaultWoLPort
+	}
+
+	address := net.JoinHostPort(config.Target, strconv.Itoa(config.Port))
+	if config.Target == "" && config.Mode != BenchBroadcast {
+		sink, err := startSink()
+		if err != nil {
+			return nil, err
+		}
+		defer sink.Close()
+		address = sink.LocalAddr().String()
+	}
+
+	var step func() error
+	var cleanup func()
+
+	switch config.Mode {
+	case BenchBuild:
+		step = func() error {
+			_, err := wol_packet.BuildMagicPacket(BenchMAC)
+			return err
+		}
+	case BenchUnicast, BenchBroadcast:
+		if config.Mode == BenchBroadcast {
+			address = fmt.Sprintf("255.255.255.255:%d", config.Port)
+		}
+		step = func() error {
+			packet, err := wol_packet.BuildMagicPacket(BenchMAC)
+			if err != nil {
+				return err
+			}
+			return sendPacketTo(packet, address, "", nil, nil)
+		}
+	case BenchReuse:
+		conn, err := net.Dial("udp", address)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create UDP connection: %w", err)
+		}
+		cleanup = func() { conn.Close() }
+
+		step = func() error {
+			packet, err := wol_packet.BuildMagicPacket(BenchMAC)
+			if err != nil {
+				return err
+			}
+			_, err = conn.Write(packet)
+			return err
+		}
+	case BenchPool:
+		sender := NewSender()
+		cleanup = func() { sender.Close() }
+
+		step = func() error {
+			packet, err := wol_packet.BuildMagicPacket(BenchMAC)
+			if err != nil {
+				return err
+			}
+			return sender.sendTo(packet, address, "", nil, nil)
+		}
+	default:
+		return nil, fmt.Errorf("unknown bench mode: %s (supported: build, unicast, broadcast, reuse, pool)", config.Mode)
+	}
+
+	if cleanup != nil {
+		defer cleanup()
+	}
+
+	result := &BenchResult{Mode: config.Mode, Packets: config.Count}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+
+	for i := 0; i < config.Count; i++ {
+		if err := step(); err != nil {
+			result.Errors++
+		}
+	}
+
+	result.Elapsed = time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	result.PacketsPerSecond = float64(config.Count) / result.Elapsed.Seconds()
+	result.AllocsPerPacket = float64(after.Mallocs-before.Mallocs) / float64(config.Count)
+	result.BytesPerPacket = float64(after.TotalAlloc-before.TotalAlloc) / float64(config.Count)
+
+	return result, nil
+}
+
+// startSink drains packets on a loopback port so the benchmark does not
+// trip over ICMP port unreachable errors.
+func startSink() (*net.UDPConn, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, fmt.Errorf("failed to start benchmark sink: %w", err)
+	}
+
+	go func() {
+		buffer := make([]byte, 1500)
+		for {
+			if _, _, err := conn.ReadFromUDP(buffer); err != nil {
+				return
+			}
+		}
+	}()
+
+	return conn, nil
+}
@@ -0,0 +1,65 @@
+//go:build pcap
+
+package wol_network
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/gopacket/pcap"
+)
+
+// Building with -tags pcap needs cgo and the libpcap headers (the Npcap
+// SDK on Windows).
+func init() {
+	openCapture = openPcapCapture
+}
+
+type pcapCapture struct {
+	handle *pcap.Handle
+	iface  string
+}
+
+// openPcapCapture captures wake packets, UDP or EtherType 0x0842, as they
+// leave iface, or the default route's interface when iface is empty.
+func openPcapCapture(iface string, port int) (captureSource, error) {
+	if iface == "" {
+		info, err := getNetworkInfo()
+		if err != nil || info.InterfaceName == "" {
+			return nil, fmt.Errorf("could not determine the interface to capture on")
+		}
+		iface = info.InterfaceName
+	}
+
+	handle, err := pcap.OpenLive(iface, 1600, false, 100*time.Millisecond)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s for capture: %w", iface, err)
+	}
+
+	filter := fmt.Sprintf("udp dst port %d or ether proto 0x%04x", port, EtherTypeWoL)
+	if err := handle.SetBPFFilter(filter); err != nil {
+		handle.Close()
+		return nil, fmt.Errorf("failed to set capture filter %q: %w", filter, err)
+	}
+
+	return &pcapCapture{handle: handle, iface: iface}, nil
+}
+
+func (c *pcapCapture) Read(deadline time.Time) ([]byte, string, error) {
+	for time.Now().Before(deadline) {
+		data, _, err := c.handle.ReadPacketData()
+		if err == pcap.NextErrorTimeoutExpired {
+			continue
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return data, c.iface, nil
+	}
+	return nil, "", fmt.Errorf("capture timed out")
+}
+
+func (c *pcapCapture) Close() error {
+	c.handle.Close()
+	return nil
+}
@@ -0,0 +1,283 @@
+package wol_network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// Diagnostic check outcomes
+const (
+	DiagnosticPass = "pass"
+	DiagnosticWarn = "warn"
+	DiagnosticFail = "fail"
+)
+
+// diagnosticProbe is what the send checks transmit: harmless, and not a
+// magic packet, so nothing wakes.
+const diagnosticProbe = "wol-server diagnostic probe"
+
+// DiagnosticCheck is the outcome of one check, with a hint on how to fix
+// it unless it passed.
+type DiagnosticCheck struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Details string `json:"details"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// DiagnosticReport is what RunDiagnostics found. Healthy is false if any
+// check failed.
+type DiagnosticReport struct {
+	Interface string            `json:"interface,omitempty"`
+	Port      int               `json:"port"`
+	Healthy   bool              `json:"healthy"`
+	Checks    []DiagnosticCheck `json:"checks"`
+}
+
+type DiagnosticOptions struct {
+	// Interface is checked instead of the default route's
+	Interface string
+	// Port is the wake port probed (default 9)
+	Port int
+	// Timeout bounds waiting for the loopback probe (default 1s)
+	Timeout time.Duration
+}
+
+// RunDiagnostics checks that this host can send wake packets: that the
+// interface exists and supports broadcast, that sockets get SO_BROADCAST,
+// that broadcasts are not blocked by a firewall and that datagrams to the
+// wake port go out.
+func RunDiagnostics() *DiagnosticReport {
+	return RunDiagnosticsWith(DiagnosticOptions{})
+}
+
+func RunDiagnosticsWith(opts DiagnosticOptions) *DiagnosticReport {
+	if opts.Port == 0 {
+		opts.Port = DefaultWoLPort
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Second
+	}
+
+	report := &DiagnosticReport{Port: opts.Port, Healthy: true}
+	add := func(check DiagnosticCheck) {
+		if check.Status == DiagnosticFail {
+			report.Healthy = false
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	iface, check := diagnoseInterface(opts.Interface)
+	add(check)
+	if iface == nil {
+		return report
+	}
+	report.Interface = iface.Name
+
+	add(diagnoseBroadcastCapable(*iface))
+	add(diagnoseBroadcastOption())
+
+	directed := ""
+	if info, ok := networkInfoFor(*iface, ""); ok {
+		directed = info.BroadcastIP
+	}
+	add(diagnoseSend("limited_broadcast", "255.255.255.255", iface.Name, opts.Port))
+	if directed != "" {
+		add(diagnoseSend("directed_broadcast", directed, iface.Name, opts.Port))
+	}
+	add(diagnosePort(directed, iface.Name, opts.Port, opts.Timeout))
+
+	return report
+}
+
+// CheckInterface is the interface check of RunDiagnostics on its own: it
+// checks that the named interface, or the default one, is up with an
+// address wake packets can be sent from. With ipv6 the address must be an
+// IPv6 one.
+func CheckInterface(name string, ipv6 bool) DiagnosticCheck {
+	if !ipv6 {
+		_, check := diagnoseInterface(name)
+		return check
+	}
+
+	check := DiagnosticCheck{Name: "interface"}
+	if name == "" {
+		var err error
+		if name, err = ipv6Interface(); err != nil {
+			check.Status, check.Details = DiagnosticFail, err.Error()
+			check.Hint = "Bring up a network interface with an IPv6 address"
+			return check
+		}
+	}
+	iface, err := net.InterfaceByName(name)
+	if err != nil || iface.Flags&net.FlagUp == 0 {
+		check.Status, check.Details = DiagnosticFail, fmt.Sprintf("interface %s not found or down", name)
+		check.Hint = "List the interfaces with verify-network"
+		return check
+	}
+	check.Status, check.Details = DiagnosticPass, name
+	return check
+}
+
+// diagnoseInterface finds the named interface, or the default one.
+func diagnoseInterface(name string) (*InterfaceInfo, DiagnosticCheck) {
+	check := DiagnosticCheck{Name: "interface"}
+
+	interfaces, err := ListInterfaces()
+	if err != nil {
+		check.Status, check.Details = DiagnosticFail, err.Error()
+		return nil, check
+	}
+
+	if name == "" {
+		info, err := getNetworkInfo()
+		if err != nil {
+			check.Status, check.Details = DiagnosticFail, err.Error()
+			check.Hint = "Bring up a network interface with an IPv4 address"
+			return nil, check
+		}
+		name = info.InterfaceName
+	}
+
+	for i := range interfaces {
+		iface := &interfaces[i]
+		if iface.Name != name {
+			continue
+		}
+		info, ok := networkInfoFor(*iface, "")
+		if !ok {
+			check.Status, check.Details = DiagnosticFail, fmt.Sprintf("%s has no IPv4 address", name)
+			check.Hint = "Use -6 to wake over IPv6, or pick another interface with -iface"
+			return nil, check
+		}
+		check.Status = DiagnosticPass
+		check.Details = fmt.Sprintf("%s (%s)", name, info.LocalIP)
+		return iface, check
+	}
+
+	check.Status, check.Details = DiagnosticFail, fmt.Sprintf("interface %s not found or down", name)
+	check.Hint = "List the interfaces with verify-network"
+	return nil, check
+}
+
+func diagnoseBroadcastCapable(iface InterfaceInfo) DiagnosticCheck {
+	check := DiagnosticCheck{Name: "interface_broadcast"}
+	switch {
+	case iface.Loopback:
+		check.Status, check.Details = DiagnosticFail, fmt.Sprintf("%s is a loopback interface", iface.Name)
+		check.Hint = "Send from the LAN interface with -iface"
+	case !iface.Broadcast:
+		check.Status, check.Details = DiagnosticFail, fmt.Sprintf("%s does not support broadcast (a VPN or point-to-point link?)", iface.Name)
+		check.Hint = "Send from the LAN interface with -iface, or use -unicast or a relay"
+	default:
+		check.Status, check.Details = DiagnosticPass, fmt.Sprintf("%s supports broadcast", iface.Name)
+	}
+	return check
+}
+
+// diagnoseBroadcastOption checks that new UDP sockets get SO_BROADCAST,
+// without which the kernel refuses broadcast destinations.
+func diagnoseBroadcastOption() DiagnosticCheck {
+	check := DiagnosticCheck{Name: "broadcast_permission"}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		check.Status, check.Details = DiagnosticFail, fmt.Sprintf("cannot open a UDP socket: %v", err)
+		check.Hint = "Check that the process may create network sockets (sandbox, seccomp, SELinux)"
+		return check
+	}
+	defer conn.Close()
+
+	enabled, err := broadcastOption(conn)
+	switch {
+	case err != nil:
+		check.Status, check.Details = DiagnosticWarn, fmt.Sprintf("could not read SO_BROADCAST: %v", err)
+	case !enabled:
+		check.Status, check.Details = DiagnosticFail, "SO_BROADCAST is not set on UDP sockets"
+	default:
+		check.Status, check.Details = DiagnosticPass, "SO_BROADCAST is set on UDP sockets"
+	}
+	return check
+}
+
+// diagnoseSend sends the probe to address and explains a failure.
+func diagnoseSend(name, address, iface string, port int) DiagnosticCheck {
+	check := DiagnosticCheck{Name: name}
+
+	target := net.JoinHostPort(address, strconv.Itoa(port))
+	if err := sendPacketTo([]byte(diagnosticProbe), target, iface, nil, nil); err != nil {
+		check.Status = DiagnosticFail
+		check.Details, check.Hint = explainSendError(target, err)
+		return check
+	}
+
+	check.Status, check.Details = DiagnosticPass, fmt.Sprintf("sent to %s", target)
+	return check
+}
+
+// diagnosePort listens on port and sends the probe to the directed
+// broadcast, which the host receives itself if nothing drops it.
+func diagnosePort(directed, iface string, port int, timeout time.Duration) DiagnosticCheck {
+	check := DiagnosticCheck{Name: "port_reachable"}
+	if directed == "" {
+		check.Status, check.Details = DiagnosticWarn, "no directed broadcast address to probe"
+		return check
+	}
+
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{Port: port})
+	if err != nil {
+		check.Status = DiagnosticWarn
+		check.Details = fmt.Sprintf("could not listen on UDP port %d to check it: %v", port, err)
+		if port < 1024 {
+			check.Hint = "Run as root, or with CAP_NET_BIND_SERVICE, to check a privileged port"
+		}
+		return check
+	}
+	defer listener.Close()
+
+	target := net.JoinHostPort(directed, strconv.Itoa(port))
+	if err := sendPacketTo([]byte(diagnosticProbe), target, iface, nil, nil); err != nil {
+		check.Status = DiagnosticFail
+		check.Details, check.Hint = explainSendError(target, err)
+		return check
+	}
+
+	buffer := make([]byte, 512)
+	listener.SetReadDeadline(time.Now().Add(timeout))
+	for {
+		n, _, err := listener.ReadFromUDP(buffer)
+		if err != nil {
+			check.Status = DiagnosticWarn
+			check.Details = fmt.Sprintf("probe to %s was sent but not seen coming back within %v", target, timeout)
+			check.Hint = fmt.Sprintf("A host firewall may drop UDP port %d; the packet may still reach other hosts", port)
+			return check
+		}
+		if string(buffer[:n]) == diagnosticProbe {
+			check.Status, check.Details = DiagnosticPass, fmt.Sprintf("probe to %s went out and came back", target)
+			return check
+		}
+	}
+}
+
+// explainSendError describes why sending to target failed and suggests a
+// fix.
+func explainSendError(target string, err error) (string, string) {
+	details := fmt.Sprintf("sending to %s failed: %v", target, err)
+	switch {
+	case errors.Is(err, syscall.EPERM):
+		return details, "A firewall rule blocks outgoing UDP; allow it in iptables/nftables or the host firewall"
+	case errors.Is(err, syscall.EACCES):
+		return details, "Broadcast is not permitted on this socket or interface; check the firewall and container network mode"
+	case errors.Is(err, syscall.ENETUNREACH), errors.Is(err, syscall.EHOSTUNREACH):
+		return details, "There is no route for this address; name the LAN interface with -iface"
+	case strings.Contains(err.Error(), "unknown interface"):
+		return details, "Check the -iface name with verify-network"
+	default:
+		return details, ""
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !unix
+
+package wol_network
+
+import (
+	"fmt"
+	"net"
+)
+
+func broadcastOption(conn *net.UDPConn) (bool, error) {
+	return false, fmt.Errorf("reading socket options is not supported on this platform")
+}
@@ -0,0 +1,104 @@
+package wol_network
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestRunDiagnostics_UnknownInterface(t *testing.T) {
+	report := RunDiagnosticsWith(DiagnosticOptions{Interface: "does-not-exist0"})
+	if report.Healthy {
+		t.Error("report is healthy for an unknown interface")
+	}
+	if len(report.Checks) != 1 || report.Checks[0].Name != "interface" || report.Checks[0].Status != DiagnosticFail {
+		t.Errorf("Checks = %+v, want only a failed interface check", report.Checks)
+	}
+}
+
+func TestCheckInterface(t *testing.T) {
+	lo := loopbackInterface(t)
+
+	tests := []struct {
+		name string
+		ipv6 bool
+		want string
+	}{
+		{lo, false, DiagnosticPass},
+		{lo, true, DiagnosticPass},
+		{"does-not-exist0", false, DiagnosticFail},
+		{"does-not-exist0", true, DiagnosticFail},
+	}
+
+	for _, tt := range tests {
+		if check := CheckInterface(tt.name, tt.ipv6); check.Status != tt.want {
+			t.Errorf("CheckInterface(%q, %v) = %+v, want %s", tt.name, tt.ipv6, check, tt.want)
+		}
+	}
+}
+
+func TestRunDiagnostics_Loopback(t *testing.T) {
+	lo := loopbackInterface(t)
+
+	report := RunDiagnosticsWith(DiagnosticOptions{Interface: lo, Port: 40009})
+	if report.Interface != lo || report.Port != 40009 {
+		t.Errorf("report = %s port %d, want %s port 40009", report.Interface, report.Port, lo)
+	}
+	if report.Healthy {
+		t.Error("report is healthy for a loopback interface")
+	}
+
+	statuses := make(map[string]string)
+	for _, check := range report.Checks {
+		statuses[check.Name] = check.Status
+	}
+	if statuses["interface"] != DiagnosticPass || statuses["interface_broadcast"] != DiagnosticFail {
+		t.Errorf("Checks = %+v", report.Checks)
+	}
+}
+
+func TestDiagnoseBroadcastCapable(t *testing.T) {
+	tests := []struct {
+		name  string
+		iface InterfaceInfo
+		want  string
+	}{
+		{"ethernet", InterfaceInfo{Name: "eth0", Broadcast: true}, DiagnosticPass},
+		{"loopback", InterfaceInfo{Name: "lo", Loopback: true}, DiagnosticFail},
+		{"point-to-point", InterfaceInfo{Name: "wg0"}, DiagnosticFail},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			check := diagnoseBroadcastCapable(tt.iface)
+			if check.Status != tt.want {
+				t.Errorf("Status = %s, want %s", check.Status, tt.want)
+			}
+			if check.Status != DiagnosticPass && check.Hint == "" {
+				t.Error("failed check has no hint")
+			}
+		})
+	}
+}
+
+func TestExplainSendError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantHint bool
+	}{
+		{"firewall", fmt.Errorf("write: %w", syscall.EPERM), true},
+		{"no broadcast", fmt.Errorf("write: %w", syscall.EACCES), true},
+		{"no route", fmt.Errorf("write: %w", syscall.ENETUNREACH), true},
+		{"other", fmt.Errorf("something else"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details, hint := explainSendError("255.255.255.255:9", tt.err)
+			if details == "" || (hint != "") != tt.wantHint {
+				t.Errorf("explainSendError() = %q, %q", details, hint)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+//go:build unix
+
+package wol_network
+
+import (
+	"net"
+	"syscall"
+)
+
+// broadcastOption reports whether SO_BROADCAST is set on conn's socket.
+func broadcastOption(conn *net.UDPConn) (bool, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return false, err
+	}
+
+	var value int
+	var sockErr error
+	err = raw.Control(func(fd uintptr) {
+		value, sockErr = syscall.GetsockoptInt(int(fd), syscall.SOL_SOCKET, syscall.SO_BROADCAST)
+	})
+	if err == nil {
+		err = sockErr
+	}
+	return value != 0, err
+}
@@ -0,0 +1,231 @@
+package wol_network
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+	wol_mdns "wol-server/wol/mdns"
+)
+
+// DefaultDiscoverWait is how long DiscoverDevices waits for hosts to answer
+// the sweep before reading the neighbor table.
+const DefaultDiscoverWait = 3 * time.Second
+
+// DefaultNameTimeout bounds each host name lookup during discovery.
+const DefaultNameTimeout = time.Second
+
+// Name sources, in the order they are tried
+const (
+	NameSourceDNS     = "dns"
+	NameSourceMDNS    = "mdns"
+	NameSourceNetBIOS = "netbios"
+)
+
+// maxNameLookups is how many hosts have their names looked up at once.
+const maxNameLookups = 16
+
+// Candidate is a host found on a local subnet that could be added as a
+// device.
+type Candidate struct {
+	IPAddress  string `json:"ip_address"`
+	MACAddress string `json:"mac_address"`
+	Interface  string `json:"interface,omitempty"`
+	Subnet     string `json:"subnet"`
+	Hostname   string `json:"hostname,omitempty"`
+	NameSource string `json:"name_source,omitempty"`
+	// Name is Hostname shortened to something usable as a device name
+	Name string `json:"name,omitempty"`
+}
+
+// DiscoverOptions limits DiscoverDevicesWith to one interface and sets how
+// long to wait for replies.
+type DiscoverOptions struct {
+	Interface string
+	Wait      time.Duration
+	// SkipNames leaves out the reverse DNS, mDNS and NetBIOS lookups
+	SkipNames   bool
+	NameTimeout time.Duration
+}
+
+// DiscoverDevices sweeps every local IPv4 subnet and returns the hosts that
+// answered, sorted by IP address and named where a lookup succeeds.
+func DiscoverDevices() ([]Candidate, error) {
+	return DiscoverDevicesWith(DiscoverOptions{})
+}
+
+func DiscoverDevicesWith(opts DiscoverOptions) ([]Candidate, error) {
+	logger := getLogger()
+
+	wait := opts.Wait
+	if wait <= 0 {
+		wait = DefaultDiscoverWait
+	}
+
+	subnets, err := localSubnets(opts.Interface)
+	if err != nil {
+		return nil, err
+	}
+
+	var swept []*net.IPNet
+	for _, subnet := range subnets {
+		if err := SweepSubnet(subnet, 0); err != nil {
+			logger.Warn("Discovery: skipping %s: %v", subnet, err)
+			continue
+		}
+		swept = append(swept, subnet)
+	}
+	if len(swept) == 0 {
+		return nil, fmt.Errorf("no local IPv4 subnet small enough to sweep")
+	}
+	time.Sleep(wait)
+
+	neighbors, err := ReadNeighbors()
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := candidatesIn(neighbors, swept)
+	if !opts.SkipNames {
+		nameTimeout := opts.NameTimeout
+		if nameTimeout <= 0 {
+			nameTimeout = DefaultNameTimeout
+		}
+		resolveNames(candidates, nameTimeout)
+	}
+	logger.Info("Discovery: found %d host(s) on %d subnet(s)", len(candidates), len(swept))
+	return candidates, nil
+}
+
+// candidatesIn keeps the neighbors inside subnets, sorted by IP address.
+func candidatesIn(neighbors []Neighbor, subnets []*net.IPNet) []Candidate {
+	var candidates []Candidate
+	for _, neighbor := range neighbors {
+		ip := net.ParseIP(neighbor.IPAddress)
+		if ip == nil {
+			continue
+		}
+		for _, subnet := range subnets {
+			if subnet.Contains(ip) {
+				candidates = append(candidates, Candidate{
+					IPAddress:  neighbor.IPAddress,
+					MACAddress: neighbor.MACAddress,
+					Interface:  neighbor.Interface,
+					Subnet:     subnet.String(),
+				})
+				break
+			}
+		}
+	}
+
+	slices.SortFunc(candidates, func(a, b Candidate) int {
+		return bytes.Compare(net.ParseIP(a.IPAddress).To16(), net.ParseIP(b.IPAddress).To16())
+	})
+	return candidates
+}
+
+// resolveNames fills in the host names of candidates concurrently.
+func resolveNames(candidates []Candidate, timeout time.Duration) {
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, maxNameLookups)
+
+	for i := range candidates {
+		wg.Add(1)
+		go func(c *Candidate) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			c.Hostname, c.NameSource = ResolveHostname(c.IPAddress, timeout)
+			c.Name = SuggestDeviceName(c.Hostname)
+		}(&candidates[i])
+	}
+	wg.Wait()
+}
+
+// ResolveHostname looks up a name for ip by reverse DNS, then mDNS, then
+// NetBIOS, each bounded by timeout, and reports which one answered. Both
+// are empty if none did.
+func ResolveHostname(ip string, timeout time.Duration) (string, string) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	names, err := net.DefaultResolver.LookupAddr(ctx, ip)
+	cancel()
+	if err == nil && len(names) > 0 {
+		return strings.TrimSuffix(names[0], "."), NameSourceDNS
+	}
+
+	if parsed := net.ParseIP(ip); parsed != nil {
+		if name, err := wol_mdns.LookupAddr(parsed, timeout); err == nil {
+			return name, NameSourceMDNS
+		}
+	}
+
+	if name, err := LookupNetBIOSName(ip, timeout); err == nil && name != "" {
+		return name, NameSourceNetBIOS
+	}
+
+	return "", ""
+}
+
+// SuggestDeviceName turns a host name such as "NAS.home.lan" or
+// "DESKTOP-4F2 " into a device name: its first label, lower-cased, with
+// anything but letters, digits, '-' and '_' replaced by '-'.
+func SuggestDeviceName(hostname string) string {
+	label, _, _ := strings.Cut(strings.TrimSpace(hostname), ".")
+
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '_':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '-'
+		}
+	}, label)
+
+	return strings.Trim(name, "-")
+}
+
+// localSubnets returns the IPv4 subnets of the up, non-loopback interfaces,
+// or of iface alone.
+func localSubnets(iface string) ([]*net.IPNet, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+
+	var subnets []*net.IPNet
+	for _, ifi := range ifaces {
+		if iface != "" && !strings.EqualFold(ifi.Name, iface) {
+			continue
+		}
+		if ifi.Flags&net.FlagUp == 0 || ifi.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok || ipnet.IP.To4() == nil {
+				continue
+			}
+			subnets = append(subnets, &net.IPNet{IP: ipnet.IP.Mask(ipnet.Mask), Mask: ipnet.Mask})
+		}
+	}
+
+	if len(subnets) == 0 {
+		if iface != "" {
+			return nil, fmt.Errorf("interface %s has no IPv4 subnet", iface)
+		}
+		return nil, fmt.Errorf("no active IPv4 network interfaces found")
+	}
+	return subnets, nil
+}
@@ -0,0 +1,148 @@
+package wol_network
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCandidatesIn(t *testing.T) {
+	_, lan, _ := net.ParseCIDR("192.168.1.0/24")
+	_, lab, _ := net.ParseCIDR("10.0.0.0/28")
+
+	neighbors := []Neighbor{
+		{IPAddress: "192.168.1.20", MACAddress: "AA:BB:CC:DD:EE:20", Interface: "eth0"},
+		{IPAddress: "10.0.0.99", MACAddress: "AA:BB:CC:DD:EE:99", Interface: "eth1"},
+		{IPAddress: "192.168.1.3", MACAddress: "AA:BB:CC:DD:EE:03", Interface: "eth0"},
+		{IPAddress: "10.0.0.5", MACAddress: "AA:BB:CC:DD:EE:05", Interface: "eth1"},
+		{IPAddress: "172.16.0.1", MACAddress: "AA:BB:CC:DD:EE:01", Interface: "eth2"},
+	}
+
+	tests := []struct {
+		name    string
+		subnets []*net.IPNet
+		wantIPs []string
+	}{
+		{"one subnet", []*net.IPNet{lan}, []string{"192.168.1.3", "192.168.1.20"}},
+		{"two subnets, sorted", []*net.IPNet{lan, lab}, []string{"10.0.0.5", "192.168.1.3", "192.168.1.20"}},
+		{"no subnets", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			candidates := candidatesIn(neighbors, tt.subnets)
+			if len(candidates) != len(tt.wantIPs) {
+				t.Fatalf("candidatesIn() = %+v, want IPs %v", candidates, tt.wantIPs)
+			}
+			for i, candidate := range candidates {
+				if candidate.IPAddress != tt.wantIPs[i] {
+					t.Errorf("candidate %d = %s, want %s", i, candidate.IPAddress, tt.wantIPs[i])
+				}
+				if candidate.Subnet == "" {
+					t.Errorf("candidate %s has no subnet", candidate.IPAddress)
+				}
+			}
+		})
+	}
+}
+
+func TestLocalSubnets_UnknownInterface(t *testing.T) {
+	if _, err := localSubnets("does-not-exist0"); err == nil {
+		t.Error("localSubnets() expected error for unknown interface")
+	}
+}
+
+type netbiosName struct {
+	name   string
+	suffix byte
+	group  bool
+}
+
+// netbiosStatusReply builds a node status response listing names.
+func netbiosStatusReply(id uint16, names ...netbiosName) []byte {
+	reply := []byte{byte(id >> 8), byte(id), 0x84, 0, 0, 0, 0, 1, 0, 0, 0, 0}
+	// The answer repeats the question's name, type and class
+	reply = append(reply, netbiosStatusQuery(id)[12:]...)
+	reply = append(reply, 0, 0, 0, 0) // TTL
+	reply = append(reply, 0, 0)       // RDLENGTH, not checked
+	reply = append(reply, byte(len(names)))
+	for _, n := range names {
+		entry := []byte(fmt.Sprintf("%-15s", n.name))
+		entry = append(entry, n.suffix, 0x04, 0)
+		if n.group {
+			entry[16] |= 0x80
+		}
+		reply = append(reply, entry...)
+	}
+	return reply
+}
+
+func TestParseNetBIOSStatus(t *testing.T) {
+	tests := []struct {
+		name    string
+		reply   []byte
+		want    string
+		wantErr bool
+	}{
+		{"workstation name", netbiosStatusReply(1, netbiosName{"WORKGROUP", 0x00, true}, netbiosName{"DESKTOP-4F2", 0x00, false}), "DESKTOP-4F2", false},
+		{"server name only", netbiosStatusReply(1, netbiosName{"NAS", 0x20, false}), "", true},
+		{"truncated", []byte{0, 1, 0x84, 0}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseNetBIOSStatus(tt.reply)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseNetBIOSStatus() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseNetBIOSStatus() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookupNetBIOSName(t *testing.T) {
+	responder, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer responder.Close()
+
+	go func() {
+		buffer := make([]byte, 512)
+		n, from, err := responder.ReadFromUDP(buffer)
+		if err != nil || n < 2 {
+			return
+		}
+		id := uint16(buffer[0])<<8 | uint16(buffer[1])
+		responder.WriteToUDP(netbiosStatusReply(id, netbiosName{"MEDIA-PC", 0x00, false}), from)
+	}()
+
+	name, err := lookupNetBIOSName("127.0.0.1", responder.LocalAddr().(*net.UDPAddr).Port, time.Second)
+	if err != nil {
+		t.Fatalf("lookupNetBIOSName() error = %v", err)
+	}
+	if name != "MEDIA-PC" {
+		t.Errorf("lookupNetBIOSName() = %q, want MEDIA-PC", name)
+	}
+}
+
+func TestSuggestDeviceName(t *testing.T) {
+	tests := []struct {
+		hostname string
+		want     string
+	}{
+		{"nas.home.lan", "nas"},
+		{"DESKTOP-4F2", "desktop-4f2"},
+		{"Living Room TV.local", "living-room-tv"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		if got := SuggestDeviceName(tt.hostname); got != tt.want {
+			t.Errorf("SuggestDeviceName(%q) = %q, want %q", tt.hostname, got, tt.want)
+		}
+	}
+}
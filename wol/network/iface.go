@@ -0,0 +1,120 @@
+package wol_network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// interfaceAddr returns the first IPv4 address of the named interface, to
+// bind a sending socket to.
+func interfaceAddr(name string) (*net.UDPAddr, error) {
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown interface %s: %w", name, err)
+	}
+	if ifi.Flags&net.FlagUp == 0 {
+		return nil, fmt.Errorf("interface %s is down", name)
+	}
+
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read addresses of %s: %w", name, err)
+	}
+
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			return &net.UDPAddr{IP: ipnet.IP}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("interface %s has no IPv4 address", name)
+}
+
+// ListenUDP listens on UDP port of every IPv4 address, receiving only what
+// arrives on iface if it is not empty (Linux, needs CAP_NET_RAW).
+func ListenUDP(iface string, port int) (*net.UDPConn, error) {
+	config := net.ListenConfig{}
+	if iface != "" {
+		if _, err := net.InterfaceByName(iface); err != nil {
+			return nil, fmt.Errorf("unknown interface %s: %w", iface, err)
+		}
+		config.Control = bindToDevice(iface)
+	}
+
+	conn, err := config.ListenPacket(context.Background(), "udp4", ":"+strconv.Itoa(port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on UDP port %d: %w", port, err)
+	}
+	return conn.(*net.UDPConn), nil
+}
+
+// InterfaceInfo describes an up network interface and its addresses.
+type InterfaceInfo struct {
+	Name      string             `json:"name"`
+	Index     int                `json:"index"`
+	MAC       string             `json:"mac,omitempty"`
+	MTU       int                `json:"mtu"`
+	Loopback  bool               `json:"loopback,omitempty"`
+	Broadcast bool               `json:"broadcast"`
+	Addresses []InterfaceAddress `json:"addresses"`
+}
+
+// InterfaceAddress is one address of an interface. Broadcast is the
+// subnet-directed broadcast address, for IPv4 addresses only.
+type InterfaceAddress struct {
+	IP        string `json:"ip"`
+	Subnet    string `json:"subnet"`
+	Broadcast string `json:"broadcast,omitempty"`
+}
+
+// ListInterfaces returns every interface that is up, loopback included,
+// with its IPv4 and IPv6 addresses.
+func ListInterfaces() ([]InterfaceInfo, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+
+	var result []InterfaceInfo
+	for _, ifi := range ifaces {
+		if ifi.Flags&net.FlagUp == 0 {
+			continue
+		}
+
+		info := InterfaceInfo{
+			Name:      ifi.Name,
+			Index:     ifi.Index,
+			MAC:       strings.ToUpper(ifi.HardwareAddr.String()),
+			MTU:       ifi.MTU,
+			Loopback:  ifi.Flags&net.FlagLoopback != 0,
+			Broadcast: ifi.Flags&net.FlagBroadcast != 0,
+		}
+
+		addrs, err := ifi.Addrs()
+		if err != nil {
+			getLogger().Debug("Could not read addresses of %s: %v", ifi.Name, err)
+		}
+		for _, addr := range addrs {
+			ipnet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+
+			address := InterfaceAddress{
+				IP:     ipnet.IP.String(),
+				Subnet: (&net.IPNet{IP: ipnet.IP.Mask(ipnet.Mask), Mask: ipnet.Mask}).String(),
+			}
+			if ipnet.IP.To4() != nil && info.Broadcast {
+				address.Broadcast = subnetBroadcast(ipnet).String()
+			}
+			info.Addresses = append(info.Addresses, address)
+		}
+
+		result = append(result, info)
+	}
+
+	return result, nil
+}
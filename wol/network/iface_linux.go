@@ -0,0 +1,16 @@
+//go:build linux
+
+package wol_network
+
+import "syscall"
+
+// bindToDevice pins a socket to iface with SO_BINDTODEVICE, so broadcasts
+// leave through it whatever the routing table says. Binding needs
+// CAP_NET_RAW; without it the socket is only bound to the address.
+func bindToDevice(iface string) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) error {
+		return c.Control(func(fd uintptr) {
+			syscall.SetsockoptString(int(fd), syscall.SOL_SOCKET, syscall.SO_BINDTODEVICE, iface)
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package wol_network
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// AllNodesMulticast is the link-local all-nodes group, IPv6's stand-in for
+// the IPv4 broadcast address.
+const AllNodesMulticast = "ff02::1"
+
+// sendIPv6 sends packet to opts.IPv6Address, or to ff02::1 on
+// opts.Interface. A link-local destination needs an interface; without
+// one the first multicast-capable interface with IPv6 is used.
+func sendIPv6(packet []byte, opts SendOptions) error {
+	target := opts.IPv6Address
+	if target == "" {
+		target = AllNodesMulticast
+	}
+
+	host, zone := splitZone(target)
+	ip := net.ParseIP(host)
+	if ip == nil || ip.To4() != nil {
+		return fmt.Errorf("invalid IPv6 address: %s", target)
+	}
+
+	iface := opts.Interface
+	if zone != "" {
+		iface = zone
+	}
+	if iface == "" && (ip.IsLinkLocalMulticast() || ip.IsLinkLocalUnicast()) {
+		name, err := ipv6Interface()
+		if err != nil {
+			return err
+		}
+		iface = name
+	}
+
+	address := net.JoinHostPort(host, strconv.Itoa(opts.Port))
+	getLogger().Debug("Target IPv6 address: %s on %s", address, iface)
+
+	source, _ := opts.source()
+	return opts.sendTo(packet, address, iface, source)
+}
+
+func splitZone(address string) (string, string) {
+	for i := len(address) - 1; i >= 0; i-- {
+		if address[i] == '%' {
+			return address[:i], address[i+1:]
+		}
+	}
+	return address, ""
+}
+
+// ipv6Interface returns the first up, multicast-capable, non-loopback
+// interface with an IPv6 address.
+func ipv6Interface() (string, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return "", fmt.Errorf("failed to list interfaces: %w", err)
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagLoopback != 0 || iface.Flags&net.FlagMulticast == 0 {
+			continue
+		}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range addrs {
+			if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() == nil {
+				return iface.Name, nil
+			}
+		}
+	}
+
+	return "", fmt.Errorf("no interface with IPv6 found, name one explicitly")
+}
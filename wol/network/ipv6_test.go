@@ -0,0 +1,63 @@
+package wol_network
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSplitZone(t *testing.T) {
+	tests := []struct {
+		address, host, zone string
+	}{
+		{"ff02::1", "ff02::1", ""},
+		{"ff02::1%eth0", "ff02::1", "eth0"},
+		{"fe80::1%en0", "fe80::1", "en0"},
+	}
+
+	for _, tt := range tests {
+		host, zone := splitZone(tt.address)
+		if host != tt.host || zone != tt.zone {
+			t.Errorf("splitZone(%q) = %q, %q, want %q, %q", tt.address, host, zone, tt.host, tt.zone)
+		}
+	}
+}
+
+func TestSendIPv6(t *testing.T) {
+	listener, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer listener.Close()
+	port := listener.LocalAddr().(*net.UDPAddr).Port
+
+	err = SendWakeOnLANWith("AA:BB:CC:DD:EE:FF", SendOptions{Port: port, IPv6: true, IPv6Address: "::1"})
+	if err != nil {
+		t.Fatalf("SendWakeOnLANWith() error = %v", err)
+	}
+
+	receive := func() {
+		t.Helper()
+		buffer := make([]byte, 256)
+		listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := listener.ReadFromUDP(buffer)
+		if err != nil {
+			t.Fatalf("IPv6 packet not received: %v", err)
+		}
+		if !isMagicPacket(buffer[:n], "AA:BB:CC:DD:EE:FF") {
+			t.Errorf("received %d bytes that are not the magic packet", n)
+		}
+	}
+	receive()
+
+	// Verified wakes go to the same address
+	config := VerificationConfig{SendOptions: SendOptions{Port: port, IPv6: true, IPv6Address: "::1"}}
+	if _, err := SendWakeOnLANWithVerification("AA:BB:CC:DD:EE:FF", config); err != nil {
+		t.Fatalf("SendWakeOnLANWithVerification() error = %v", err)
+	}
+	receive()
+
+	if err := SendWakeOnLANWith("AA:BB:CC:DD:EE:FF", SendOptions{IPv6: true, IPv6Address: "192.168.1.1"}); err == nil {
+		t.Error("SendWakeOnLANWith() expected error for an IPv4 address in IPv6 mode")
+	}
+}
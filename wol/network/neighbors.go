@@ -0,0 +1,401 @@
+package wol_network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+	wol_packet "wol-server/wol/packet"
+)
+
+// Neighbor is an IP-to-MAC mapping from the operating system's neighbor
+// (ARP) table.
+type Neighbor struct {
+	IPAddress  string
+	MACAddress string
+	Interface  string
+}
+
+const procNetARP = "/proc/net/arp"
+
+// maxSweepHosts bounds SweepSubnet to a /22 so a misconfigured wide
+// netmask does not send tens of thousands of datagrams.
+const maxSweepHosts = 1024
+
+// readNeighborTable is the platform reader; see neighbors_<os>.go.
+var readNeighborTable = readNeighbors
+
+// ReadNeighbors returns the complete entries of the neighbor table.
+func ReadNeighbors() ([]Neighbor, error) {
+	neighbors, err := readNeighborTable()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read neighbor table: %w", err)
+	}
+	return neighbors, nil
+}
+
+// LookupMAC returns the MAC address the neighbor table holds for ip.
+func LookupMAC(ip string) (string, error) {
+	target := net.ParseIP(ip)
+	if target == nil {
+		return "", fmt.Errorf("invalid IP address: %s", ip)
+	}
+
+	neighbors, err := ReadNeighbors()
+	if err != nil {
+		return "", err
+	}
+
+	for _, neighbor := range neighbors {
+		if target.Equal(net.ParseIP(neighbor.IPAddress)) {
+			return neighbor.MACAddress, nil
+		}
+	}
+
+	return "", fmt.Errorf("no neighbor table entry for %s", ip)
+}
+
+// ResolveMAC is LookupMAC for hosts that may not be in the table yet: on a
+// miss it sends the host a datagram so the kernel resolves its address,
+// then looks again until timeout.
+func ResolveMAC(ip string, timeout time.Duration) (string, error) {
+	if mac, err := LookupMAC(ip); err == nil || net.ParseIP(ip) == nil {
+		return mac, err
+	}
+
+	if conn, err := net.Dial("udp", net.JoinHostPort(ip, strconv.Itoa(DefaultWoLPort))); err == nil {
+		conn.Write([]byte{0})
+		conn.Close()
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		mac, err := LookupMAC(ip)
+		if err == nil || time.Now().After(deadline) {
+			return mac, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// NewNeighbors returns the neighbors seen on iface, or on any interface if
+// it is empty, whose MAC address known does not report, each MAC address
+// once.
+func NewNeighbors(neighbors []Neighbor, iface string, known func(mac string) bool) []Neighbor {
+	var found []Neighbor
+	seen := make(map[string]bool)
+	for _, neighbor := range neighbors {
+		mac := wol_packet.CleanMAC(neighbor.MACAddress)
+		if (iface != "" && neighbor.Interface != iface) || seen[mac] || known(neighbor.MACAddress) {
+			continue
+		}
+		seen[mac] = true
+		found = append(found, neighbor)
+	}
+	return found
+}
+
+// NeighborDeviceName suggests a name for a neighbor's device that taken
+// does not report: SuggestDeviceName of the reverse DNS name lookup finds
+// for its IP address, or "host-" and the address with dashes, followed by
+// -2, -3 and so on if the name is taken.
+func NeighborDeviceName(neighbor Neighbor, lookup func(ip string) ([]string, error), taken func(name string) bool) string {
+	name := "host-" + strings.NewReplacer(".", "-", ":", "-").Replace(neighbor.IPAddress)
+	if names, err := lookup(neighbor.IPAddress); err == nil && len(names) > 0 {
+		if suggested := SuggestDeviceName(names[0]); suggested != "" {
+			name = suggested
+		}
+	}
+
+	candidate := name
+	for i := 2; taken(candidate); i++ {
+		candidate = fmt.Sprintf("%s-%d", name, i)
+	}
+	return candidate
+}
+
+func readProcNetARP() ([]Neighbor, error) {
+	file, err := os.Open(procNetARP)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return parseProcNetARP(file)
+}
+
+// parseProcNetARP parses the Linux /proc/net/arp format:
+//
+//	IP address       HW type     Flags       HW address            Mask     Device
+//	192.168.1.20     0x1         0x2         aa:bb:cc:dd:ee:ff     *        eth0
+func parseProcNetARP(r io.Reader) ([]Neighbor, error) {
+	var neighbors []Neighbor
+
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+
+		// Flags 0x0 marks an incomplete entry that never got a reply
+		flags, err := strconv.ParseUint(strings.TrimPrefix(fields[2], "0x"), 16, 32)
+		if err != nil || flags == 0 {
+			continue
+		}
+
+		mac := fields[3]
+		if wol_packet.ValidateMAC(mac) != nil || mac == "00:00:00:00:00:00" {
+			continue
+		}
+
+		neighbors = append(neighbors, Neighbor{
+			IPAddress:  fields[0],
+			MACAddress: strings.ToUpper(mac),
+			Interface:  fields[5],
+		})
+	}
+
+	return neighbors, scanner.Err()
+}
+
+// SweepSubnet sends a single UDP datagram to every host address in subnet
+// so the kernel resolves and caches their MAC addresses, then waits for
+// the replies to arrive. Read the results with ReadNeighbors.
+func SweepSubnet(subnet *net.IPNet, wait time.Duration) error {
+	logger := getLogger()
+
+	base := subnet.IP.To4()
+	if base == nil {
+		return fmt.Errorf("only IPv4 subnets can be swept")
+	}
+
+	ones, bits := subnet.Mask.Size()
+	hosts := 1 << (bits - ones)
+	if hosts > maxSweepHosts {
+		return fmt.Errorf("subnet %s is too large to sweep (more than %d addresses)", subnet, maxSweepHosts)
+	}
+
+	start := uint32(base[0])<<24 | uint32(base[1])<<16 | uint32(base[2])<<8 | uint32(base[3])
+	start &= binaryMask(subnet.Mask)
+
+	logger.Debug("Sweeping %s (%d addresses)", subnet, hosts)
+
+	// Skip the network and broadcast addresses
+	for i := 1; i < hosts-1; i++ {
+		n := start + uint32(i)
+		ip := net.IPv4(byte(n>>24), byte(n>>16), byte(n>>8), byte(n))
+
+		conn, err := net.Dial("udp4", net.JoinHostPort(ip.String(), strconv.Itoa(DefaultWoLPort)))
+		if err != nil {
+			continue
+		}
+		conn.Write([]byte{0})
+		conn.Close()
+	}
+
+	time.Sleep(wait)
+	return nil
+}
+
+func binaryMask(mask net.IPMask) uint32 {
+	m := mask
+	if len(m) == net.IPv6len {
+		m = m[12:]
+	}
+	return uint32(m[0])<<24 | uint32(m[1])<<16 | uint32(m[2])<<8 | uint32(m[3])
+}
+
+// Neighbor states from linux/neighbour.h
+const (
+	nudIncomplete = 0x01
+	nudFailed     = 0x20
+	nudNoARP      = 0x40
+
+	rtmNewNeigh = 28
+	ndaDst      = 1
+	ndaLLAddr   = 2
+)
+
+// parseNetlinkNeighbors parses an RTM_GETNEIGH dump: netlink headers, each
+// followed by an ndmsg and its route attributes.
+func parseNetlinkNeighbors(rib []byte, ifname func(index int) string) []Neighbor {
+	var neighbors []Neighbor
+
+	for len(rib) >= 16 {
+		length := int(binary.NativeEndian.Uint32(rib[0:4]))
+		msgType := binary.NativeEndian.Uint16(rib[4:6])
+		if length < 16 || length > len(rib) {
+			break
+		}
+		msg := rib[16:length]
+		rib = rib[align(length, 4):]
+
+		// struct ndmsg: family, pad, pad16, ifindex, state, flags, type
+		if msgType != rtmNewNeigh || len(msg) < 12 {
+			continue
+		}
+		index := int(int32(binary.NativeEndian.Uint32(msg[4:8])))
+		state := binary.NativeEndian.Uint16(msg[8:10])
+		if state == 0 || state&(nudIncomplete|nudFailed|nudNoARP) != 0 {
+			continue
+		}
+
+		var ip net.IP
+		var mac net.HardwareAddr
+		for attrs := msg[12:]; len(attrs) >= 4; {
+			attrLen := int(binary.NativeEndian.Uint16(attrs[0:2]))
+			attrType := binary.NativeEndian.Uint16(attrs[2:4])
+			if attrLen < 4 || attrLen > len(attrs) {
+				break
+			}
+
+			value := attrs[4:attrLen]
+			switch {
+			case attrType == ndaDst && (len(value) == net.IPv4len || len(value) == net.IPv6len):
+				ip = net.IP(value)
+			case attrType == ndaLLAddr && len(value) == 6:
+				mac = net.HardwareAddr(value)
+			}
+			attrs = attrs[min(align(attrLen, 4), len(attrs)):]
+		}
+
+		if ip == nil || mac == nil || isZeroMAC(mac) {
+			continue
+		}
+		neighbors = append(neighbors, Neighbor{
+			IPAddress:  ip.String(),
+			MACAddress: strings.ToUpper(mac.String()),
+			Interface:  ifname(index),
+		})
+	}
+
+	return neighbors
+}
+
+// parseIPNetTable parses the MIB_IPNETTABLE filled in by Windows'
+// GetIpNetTable: an entry count followed by 24-byte MIB_IPNETROW entries.
+func parseIPNetTable(table []byte, ifname func(index int) string) []Neighbor {
+	const (
+		rowSize     = 24
+		typeInvalid = 2
+	)
+
+	if len(table) < 4 {
+		return nil
+	}
+
+	var neighbors []Neighbor
+	count := int(binary.LittleEndian.Uint32(table[0:4]))
+	for i := 0; i < count && 4+(i+1)*rowSize <= len(table); i++ {
+		row := table[4+i*rowSize : 4+(i+1)*rowSize]
+
+		index := int(binary.LittleEndian.Uint32(row[0:4]))
+		macLen := binary.LittleEndian.Uint32(row[4:8])
+		rowType := binary.LittleEndian.Uint32(row[20:24])
+		mac := net.HardwareAddr(row[8:14])
+		if macLen != 6 || rowType == typeInvalid || isZeroMAC(mac) {
+			continue
+		}
+
+		neighbors = append(neighbors, Neighbor{
+			IPAddress:  net.IP(row[16:20]).String(),
+			MACAddress: strings.ToUpper(mac.String()),
+			Interface:  ifname(index),
+		})
+	}
+
+	return neighbors
+}
+
+// parseRouteNeighbor parses the sockaddrs of a BSD routing message from
+// an RTF_LLINFO sysctl dump: the destination IP and the link-layer
+// gateway carrying the MAC address. sockaddrs are padded to alignment.
+func parseRouteNeighbor(addrs int32, data []byte, alignment int, ifname func(index int) string) (Neighbor, bool) {
+	const (
+		rtaxDst     = 0
+		rtaxGateway = 1
+		afInet      = 2
+		afLink      = 18
+	)
+
+	var ip net.IP
+	var mac net.HardwareAddr
+	index := 0
+
+	for i := 0; i <= rtaxGateway && len(data) > 0; i++ {
+		if addrs&(1<<i) == 0 {
+			continue
+		}
+
+		length := int(data[0])
+		if length > len(data) {
+			break
+		}
+
+		switch {
+		case i == rtaxDst && data[1] == afInet && length >= 8:
+			ip = net.IP(data[4:8])
+		case i == rtaxDst && length >= 24:
+			// sockaddr_in6; AF_INET6 differs between the BSDs
+			ip = net.IP(data[8:24])
+		case i == rtaxGateway && data[1] == afLink && length >= 8:
+			// sockaddr_dl: len, family, index, type, nlen, alen, slen, data
+			index = int(binary.NativeEndian.Uint16(data[2:4]))
+			nameLen, addrLen := int(data[5]), int(data[6])
+			if addrLen == 6 && 8+nameLen+6 <= length {
+				mac = net.HardwareAddr(data[8+nameLen : 8+nameLen+6])
+			}
+		}
+
+		if length == 0 {
+			length = alignment
+		}
+		data = data[min(align(length, alignment), len(data)):]
+	}
+
+	if ip == nil || mac == nil || isZeroMAC(mac) {
+		return Neighbor{}, false
+	}
+
+	return Neighbor{
+		IPAddress:  ip.String(),
+		MACAddress: strings.ToUpper(mac.String()),
+		Interface:  ifname(index),
+	}, true
+}
+
+func align(n, to int) int {
+	return (n + to - 1) &^ (to - 1)
+}
+
+func isZeroMAC(mac net.HardwareAddr) bool {
+	for _, b := range mac {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// interfaceNames maps interface indexes to names, caching lookups.
+func interfaceNames() func(index int) string {
+	names := make(map[int]string)
+	return func(index int) string {
+		if name, ok := names[index]; ok {
+			return name
+		}
+		name := ""
+		if iface, err := net.InterfaceByIndex(index); err == nil {
+			name = iface.Name
+		}
+		names[index] = name
+		return name
+	}
+}
@@ -0,0 +1,44 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+
+package wol_network
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// readNeighbors reads the ARP cache through the routing sysctl, the same
+// source `arp -an` uses.
+func readNeighbors() ([]Neighbor, error) {
+	rib, err := syscall.RouteRIB(syscall.NET_RT_FLAGS, syscall.RTF_LLINFO)
+	if err != nil {
+		return nil, fmt.Errorf("routing sysctl failed: %w", err)
+	}
+
+	msgs, err := syscall.ParseRoutingMessage(rib)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse routing messages: %w", err)
+	}
+
+	// Darwin pads sockaddrs to 4 bytes, the other BSDs to a long
+	alignment := int(unsafe.Sizeof(uintptr(0)))
+	if runtime.GOOS == "darwin" {
+		alignment = 4
+	}
+
+	ifname := interfaceNames()
+	var neighbors []Neighbor
+	for _, msg := range msgs {
+		route, ok := msg.(*syscall.RouteMessage)
+		if !ok {
+			continue
+		}
+		if neighbor, ok := parseRouteNeighbor(route.Header.Addrs, route.Data, alignment, ifname); ok {
+			neighbors = append(neighbors, neighbor)
+		}
+	}
+
+	return neighbors, nil
+}
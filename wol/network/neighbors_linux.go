@@ -0,0 +1,17 @@
+//go:build linux
+
+package wol_network
+
+import "syscall"
+
+// readNeighbors dumps the kernel neighbor table over rtnetlink, which
+// covers IPv6 as well, falling back to /proc/net/arp.
+func readNeighbors() ([]Neighbor, error) {
+	rib, err := syscall.NetlinkRIB(syscall.RTM_GETNEIGH, syscall.AF_UNSPEC)
+	if err != nil {
+		getLogger().Debug("Netlink neighbor dump failed, reading %s: %v", procNetARP, err)
+		return readProcNetARP()
+	}
+
+	return parseNetlinkNeighbors(rib, interfaceNames()), nil
+}
@@ -0,0 +1,9 @@
+//go:build !linux && !windows && !darwin && !dragonfly && !freebsd && !netbsd && !openbsd
+
+package wol_network
+
+import "fmt"
+
+func readNeighbors() ([]Neighbor, error) {
+	return nil, fmt.Errorf("reading the neighbor table is not supported on this platform")
+}
@@ -0,0 +1,248 @@
+package wol_network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseProcNetARP(t *testing.T) {
+	input := `IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.20     0x1         0x2         aa:bb:cc:dd:ee:ff     *        eth0
+192.168.1.21     0x1         0x0         00:00:00:00:00:00     *        eth0
+10.0.0.5         0x1         0x6         11:22:33:44:55:66     *        wlan0
+garbage
+`
+
+	neighbors, err := parseProcNetARP(strings.NewReader(input))
+	if err != nil {
+		t.Fatalf("parseProcNetARP() error = %v", err)
+	}
+
+	want := []Neighbor{
+		{IPAddress: "192.168.1.20", MACAddress: "AA:BB:CC:DD:EE:FF", Interface: "eth0"},
+		{IPAddress: "10.0.0.5", MACAddress: "11:22:33:44:55:66", Interface: "wlan0"},
+	}
+	if len(neighbors) != len(want) {
+		t.Fatalf("parseProcNetARP() returned %d neighbors, want %d: %v", len(neighbors), len(want), neighbors)
+	}
+	for i := range want {
+		if neighbors[i] != want[i] {
+			t.Errorf("neighbor %d = %+v, want %+v", i, neighbors[i], want[i])
+		}
+	}
+}
+
+func TestNewNeighbors(t *testing.T) {
+	neighbors := []Neighbor{
+		{IPAddress: "192.168.1.20", MACAddress: "AA:BB:CC:DD:EE:01", Interface: "eth0"},
+		{IPAddress: "192.168.1.21", MACAddress: "AA:BB:CC:DD:EE:02", Interface: "eth0"},
+		{IPAddress: "10.0.0.5", MACAddress: "AA:BB:CC:DD:EE:03", Interface: "wlan0"},
+		// The same host seen on a second interface
+		{IPAddress: "10.0.0.6", MACAddress: "aa-bb-cc-dd-ee-02", Interface: "wlan0"},
+	}
+	known := func(mac string) bool { return mac == "AA:BB:CC:DD:EE:01" }
+
+	tests := []struct {
+		name  string
+		iface string
+		want  []string
+	}{
+		{"every interface", "", []string{"192.168.1.21", "10.0.0.5"}},
+		{"one interface", "wlan0", []string{"10.0.0.5", "10.0.0.6"}},
+		{"no such interface", "eth1", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, neighbor := range NewNeighbors(neighbors, tt.iface, known) {
+				got = append(got, neighbor.IPAddress)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("NewNeighbors() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNeighborDeviceName(t *testing.T) {
+	lookup := func(ip string) ([]string, error) {
+		switch ip {
+		case "192.168.1.20":
+			return []string{"NAS.home.lan."}, nil
+		case "192.168.1.21":
+			return []string{"."}, nil
+		}
+		return nil, fmt.Errorf("no PTR record for %s", ip)
+	}
+
+	tests := []struct {
+		name  string
+		ip    string
+		taken []string
+		want  string
+	}{
+		{"reverse DNS name", "192.168.1.20", nil, "nas"},
+		{"taken name", "192.168.1.20", []string{"nas"}, "nas-2"},
+		{"several taken", "192.168.1.20", []string{"nas", "nas-2", "nas-3"}, "nas-4"},
+		{"no reverse DNS name", "192.168.1.30", nil, "host-192-168-1-30"},
+		{"empty reverse DNS name", "192.168.1.21", nil, "host-192-168-1-21"},
+		{"IPv6 address", "fd00::1", []string{"host-fd00--1"}, "host-fd00--1-2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			taken := func(name string) bool { return slices.Contains(tt.taken, name) }
+			if got := NeighborDeviceName(Neighbor{IPAddress: tt.ip}, lookup, taken); got != tt.want {
+				t.Errorf("NeighborDeviceName(%s) = %q, want %q", tt.ip, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSweepSubnet_TooLarge(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.0.0.0/16")
+	if err := SweepSubnet(subnet, 0); err == nil {
+		t.Error("SweepSubnet() expected error for /16")
+	}
+
+	_, v6, _ := net.ParseCIDR("fd00::/120")
+	if err := SweepSubnet(v6, 0); err == nil {
+		t.Error("SweepSubnet() expected error for IPv6 subnet")
+	}
+}
+
+func noNames(int) string { return "eth0" }
+
+func netlinkNeighbor(state uint16, ip net.IP, mac []byte) []byte {
+	attr := func(attrType uint16, value []byte) []byte {
+		b := make([]byte, 4, align(4+len(value), 4))
+		binary.NativeEndian.PutUint16(b[0:2], uint16(4+len(value)))
+		binary.NativeEndian.PutUint16(b[2:4], attrType)
+		b = append(b, value...)
+		return append(b, make([]byte, cap(b)-len(b))...)
+	}
+
+	ndmsg := make([]byte, 12)
+	binary.NativeEndian.PutUint32(ndmsg[4:8], 2)
+	binary.NativeEndian.PutUint16(ndmsg[8:10], state)
+	body := append(ndmsg, attr(ndaDst, ip)...)
+	body = append(body, attr(ndaLLAddr, mac)...)
+
+	header := make([]byte, 16)
+	binary.NativeEndian.PutUint32(header[0:4], uint32(16+len(body)))
+	binary.NativeEndian.PutUint16(header[4:6], rtmNewNeigh)
+	return append(header, body...)
+}
+
+func TestParseNetlinkNeighbors(t *testing.T) {
+	mac := []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+
+	var rib []byte
+	rib = append(rib, netlinkNeighbor(0x02, net.ParseIP("192.168.1.20").To4(), mac)...)
+	rib = append(rib, netlinkNeighbor(nudFailed, net.ParseIP("192.168.1.21").To4(), mac)...)
+	rib = append(rib, netlinkNeighbor(0x04, net.ParseIP("fe80::1"), []byte{1, 2, 3, 4, 5, 6})...)
+	rib = append(rib, netlinkNeighbor(0x02, net.ParseIP("192.168.1.22").To4(), make([]byte, 6))...)
+
+	neighbors := parseNetlinkNeighbors(rib, noNames)
+
+	want := []Neighbor{
+		{IPAddress: "192.168.1.20", MACAddress: "AA:BB:CC:DD:EE:FF", Interface: "eth0"},
+		{IPAddress: "fe80::1", MACAddress: "01:02:03:04:05:06", Interface: "eth0"},
+	}
+	if len(neighbors) != len(want) {
+		t.Fatalf("parseNetlinkNeighbors() = %+v, want %+v", neighbors, want)
+	}
+	for i := range want {
+		if neighbors[i] != want[i] {
+			t.Errorf("neighbor %d = %+v, want %+v", i, neighbors[i], want[i])
+		}
+	}
+}
+
+func TestParseIPNetTable(t *testing.T) {
+	row := func(mac []byte, ip net.IP, rowType uint32) []byte {
+		b := make([]byte, 24)
+		binary.LittleEndian.PutUint32(b[0:4], 7)
+		binary.LittleEndian.PutUint32(b[4:8], 6)
+		copy(b[8:14], mac)
+		copy(b[16:20], ip.To4())
+		binary.LittleEndian.PutUint32(b[20:24], rowType)
+		return b
+	}
+
+	table := []byte{3, 0, 0, 0}
+	table = append(table, row([]byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}, net.ParseIP("10.0.0.5"), 3)...)
+	table = append(table, row([]byte{1, 2, 3, 4, 5, 6}, net.ParseIP("10.0.0.6"), 2)...)
+	table = append(table, row([]byte{1, 2, 3, 4, 5, 7}, net.ParseIP("10.0.0.7"), 4)...)
+
+	neighbors := parseIPNetTable(table, noNames)
+	if len(neighbors) != 2 {
+		t.Fatalf("parseIPNetTable() = %+v, want 2 entries", neighbors)
+	}
+	if neighbors[0].IPAddress != "10.0.0.5" || neighbors[0].MACAddress != "AA:BB:CC:DD:EE:FF" {
+		t.Errorf("neighbor 0 = %+v", neighbors[0])
+	}
+	if neighbors[1].IPAddress != "10.0.0.7" {
+		t.Errorf("neighbor 1 = %+v", neighbors[1])
+	}
+}
+
+func TestParseRouteNeighbor(t *testing.T) {
+	// sockaddr_in for 192.168.1.30, then sockaddr_dl for "en0" with a MAC
+	dst := []byte{16, 2, 0, 0, 192, 168, 1, 30, 0, 0, 0, 0, 0, 0, 0, 0}
+	gateway := []byte{20, 18, 4, 0, 6, 3, 6, 0, 'e', 'n', '0', 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0, 0, 0}
+	binary.NativeEndian.PutUint16(gateway[2:4], 4)
+
+	neighbor, ok := parseRouteNeighbor(0x3, append(dst, gateway...), 4, noNames)
+	if !ok {
+		t.Fatal("parseRouteNeighbor() found no neighbor")
+	}
+	if neighbor.IPAddress != "192.168.1.30" || neighbor.MACAddress != "11:22:33:44:55:66" {
+		t.Errorf("parseRouteNeighbor() = %+v", neighbor)
+	}
+
+	// An incomplete entry has an empty link-layer address
+	gateway[6] = 0
+	if _, ok := parseRouteNeighbor(0x3, append(dst, gateway...), 4, noNames); ok {
+		t.Error("parseRouteNeighbor() accepted an entry without a MAC")
+	}
+}
+
+func TestLookupMAC(t *testing.T) {
+	original := readNeighborTable
+	defer func() { readNeighborTable = original }()
+	readNeighborTable = func() ([]Neighbor, error) {
+		return []Neighbor{
+			{IPAddress: "192.168.1.20", MACAddress: "AA:BB:CC:DD:EE:FF"},
+			{IPAddress: "fe80::1", MACAddress: "01:02:03:04:05:06"},
+		}, nil
+	}
+
+	tests := []struct {
+		ip      string
+		want    string
+		wantErr bool
+	}{
+		{"192.168.1.20", "AA:BB:CC:DD:EE:FF", false},
+		{"fe80:0::1", "01:02:03:04:05:06", false},
+		{"192.168.1.99", "", true},
+		{"not-an-ip", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			got, err := LookupMAC(tt.ip)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("LookupMAC() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("LookupMAC() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+//go:build windows
+
+package wol_network
+
+import (
+	"fmt"
+	"syscall"
+	"unsafe"
+)
+
+var procGetIpNetTable = syscall.NewLazyDLL("iphlpapi.dll").NewProc("GetIpNetTable")
+
+const errorInsufficientBuffer = 122
+
+func readNeighbors() ([]Neighbor, error) {
+	var size uint32
+	r, _, _ := procGetIpNetTable.Call(0, uintptr(unsafe.Pointer(&size)), 0)
+	if r != errorInsufficientBuffer && r != 0 {
+		return nil, fmt.Errorf("GetIpNetTable failed: %w", syscall.Errno(r))
+	}
+	if size == 0 {
+		return nil, nil
+	}
+
+	table := make([]byte, size)
+	r, _, _ = procGetIpNetTable.Call(uintptr(unsafe.Pointer(&table[0])), uintptr(unsafe.Pointer(&size)), 1)
+	if r != 0 {
+		return nil, fmt.Errorf("GetIpNetTable failed: %w", syscall.Errno(r))
+	}
+
+	return parseIPNetTable(table, interfaceNames()), nil
+}
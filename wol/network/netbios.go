@@ -0,0 +1,107 @@
+package wol_network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NetBIOSPort is the NetBIOS name service port Windows and Samba hosts
+// answer node status queries on.
+const NetBIOSPort = 137
+
+// LookupNetBIOSName asks the host at ip for its NetBIOS workstation name
+// with a node status (NBSTAT) query.
+func LookupNetBIOSName(ip string, timeout time.Duration) (string, error) {
+	return lookupNetBIOSName(ip, NetBIOSPort, timeout)
+}
+
+func lookupNetBIOSName(ip string, port int, timeout time.Duration) (string, error) {
+	conn, err := net.Dial("udp4", net.JoinHostPort(ip, strconv.Itoa(port)))
+	if err != nil {
+		return "", fmt.Errorf("failed to open NetBIOS socket: %w", err)
+	}
+	defer conn.Close()
+
+	id := uint16(time.Now().UnixNano())
+	if _, err := conn.Write(netbiosStatusQuery(id)); err != nil {
+		return "", fmt.Errorf("failed to send NetBIOS query: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	buffer := make([]byte, 1500)
+	for {
+		n, err := conn.Read(buffer)
+		if err != nil {
+			return "", fmt.Errorf("no NetBIOS name for %s: %w", ip, err)
+		}
+		if n >= 2 && binary.BigEndian.Uint16(buffer[0:2]) == id {
+			return parseNetBIOSStatus(buffer[:n])
+		}
+	}
+}
+
+// netbiosStatusQuery builds an NBSTAT query for the wildcard name "*",
+// first-level encoded as RFC 1002 describes.
+func netbiosStatusQuery(id uint16) []byte {
+	query := []byte{byte(id >> 8), byte(id), 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0x20}
+
+	name := make([]byte, 16)
+	name[0] = '*'
+	for _, c := range name {
+		query = append(query, 'A'+c>>4, 'A'+c&0x0F)
+	}
+
+	// terminator, type NBSTAT, class IN
+	return append(query, 0, 0, 0x21, 0, 1)
+}
+
+// parseNetBIOSStatus returns the workstation name, the unique name with
+// suffix 0x00, from a node status response.
+func parseNetBIOSStatus(response []byte) (string, error) {
+	const (
+		entrySize = 18
+		groupFlag = 0x8000
+	)
+
+	if len(response) < 12 {
+		return "", fmt.Errorf("NetBIOS reply too short")
+	}
+
+	off := 12
+	for off < len(response) {
+		l := int(response[off])
+		if l == 0 {
+			off++
+			break
+		}
+		if l&0xC0 == 0xC0 {
+			off += 2
+			break
+		}
+		off += 1 + l
+	}
+
+	// type, class, TTL and RDLENGTH precede the name count
+	off += 10
+	if off >= len(response) {
+		return "", fmt.Errorf("truncated NetBIOS reply")
+	}
+
+	count := int(response[off])
+	off++
+	for i := 0; i < count && off+entrySize <= len(response); i++ {
+		entry := response[off : off+entrySize]
+		off += entrySize
+
+		flags := binary.BigEndian.Uint16(entry[16:18])
+		if entry[15] == 0x00 && flags&groupFlag == 0 {
+			return strings.TrimRight(string(entry[:15]), " \x00"), nil
+		}
+	}
+
+	return "", fmt.Errorf("no workstation name in NetBIOS reply")
+}
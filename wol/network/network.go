@@ -1,43 +1,122 @@
 package wol_network
 
 import (
+	"encoding/json"
 	"fmt"
 	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 	wol_log "wol-server/wol/log"
 	wol_packet "wol-server/wol/packet"
 )
 
+// VerificationConfig sends a wake packet with its SendOptions and checks
+// that it went out or that the device woke.
 type VerificationConfig struct {
+	SendOptions
 	EnableCapture    bool
 	CaptureInterface string
 	CaptureTimeout   time.Duration
-	EnablePing       bool
-	PingTimeout      time.Duration
+	// EnablePing checks the target accepts TCP connections; no privileges
+	// needed, unlike EnableICMP
+	EnablePing  bool
+	PingTimeout time.Duration
+	EnableARP   bool
+	EnableICMP  bool
+	// AgentURL is polled until it answers 2xx
+	AgentURL string
+	// CheckTimeout applies to ARP, ICMP and agent checks
+	CheckTimeout time.Duration
+	// TargetIP is the woken device's address, needed by every check except
+	// capture
+	TargetIP string
+	// Verifiers are additional checks, run with CheckTimeout
+	Verifiers []Verifier
+	// Unicast also sends the packet straight to TargetIP, once resolved
+	Unicast bool
 }
 
 type PacketVerificationResult struct {
-	PacketSent      bool
-	PacketCaptured  bool
-	TargetReachable bool
-	BroadcastSent   bool
-	Interface       string
-	Error           error
-	CaptureDetails  string
-	NetworkInfo     NetworkInfo
+	PacketSent      bool   `json:"packet_sent"`
+	PacketCaptured  bool   `json:"packet_captured"`
+	TargetReachable bool   `json:"target_reachable"`
+	BroadcastSent   bool   `json:"broadcast_sent"`
+	Interface       string `json:"interface,omitempty"`
+	// Error is only set when SendWakeOnLANWithVerification returns it too
+	Error          error            `json:"-"`
+	CaptureDetails string           `json:"capture_details,omitempty"`
+	NetworkInfo    NetworkInfo      `json:"network_info"`
+	Checks         []VerifierResult `json:"checks"`
+	Ports          []PortResult     `json:"ports"`
+	Timing         SendTiming       `json:"timing"`
+}
+
+const (
+	defaultCaptureTimeout = 3 * time.Second
+	defaultCheckTimeout   = 30 * time.Second
+)
+
+// Pipeline builds the verification pipeline the config describes.
+func (c VerificationConfig) Pipeline() *Pipeline {
+	checkTimeout := c.CheckTimeout
+	if checkTimeout <= 0 {
+		checkTimeout = defaultCheckTimeout
+	}
+	pingTimeout := c.PingTimeout
+	if pingTimeout <= 0 {
+		pingTimeout = checkTimeout
+	}
+
+	captureTimeout := c.CaptureTimeout
+	if captureTimeout <= 0 {
+		captureTimeout = defaultCaptureTimeout
+	}
+
+	pipeline := NewPipeline()
+	if c.EnableCapture {
+		pipeline.Add(&CaptureVerifier{Interface: c.CaptureInterface}, captureTimeout)
+	}
+	if c.EnableARP {
+		pipeline.Add(ARPVerifier{}, checkTimeout)
+	}
+	if c.EnableICMP {
+		pipeline.Add(ICMPVerifier{}, checkTimeout)
+	}
+	if c.EnablePing {
+		pipeline.Add(TCPVerifier{}, pingTimeout)
+	}
+	if c.AgentURL != "" {
+		pipeline.Add(AgentVerifier{URL: c.AgentURL}, checkTimeout)
+	}
+	for _, verifier := range c.Verifiers {
+		pipeline.Add(verifier, checkTimeout)
+	}
+	return pipeline
 }
 
 type NetworkInfo struct {
-	LocalIP       string
-	BroadcastIP   string
-	InterfaceName string
-	MACAddress    string
+	LocalIP       string `json:"local_ip"`
+	BroadcastIP   string `json:"broadcast_ip"`
+	InterfaceName string `json:"interface"`
+	MACAddress    string `json:"mac_address"`
+	MTU           int    `json:"mtu,omitempty"`
+	// Gateway, DNSServers and BroadcastInterfaces are only filled in by
+	// VerifyNetworkConnectivity
+	Gateway             string            `json:"gateway,omitempty"`
+	DNSServers          []string          `json:"dns_servers,omitempty"`
+	BroadcastInterfaces []BroadcastTarget `json:"broadcast_interfaces,omitempty"`
 }
 
 const (
 	DefaultWoLPort = 9
 
 	AlternativeWoLPort = 7
+
+	// DefaultCopyInterval spaces the copies of a packet sent with Copies
+	DefaultCopyInterval = 500 * time.Millisecond
 )
 
 type Logger = wol_log.Logger
@@ -72,16 +151,426 @@ func SendWakePacket(packet []byte, port int) error {
 
 	logger.Debug("Validated magic packet: %d bytes", len(packet))
 
-	broadcastAddr := fmt.Sprintf("255.255.255.255:%d", port)
-	logger.Debug("Target broadcast address: %s", broadcastAddr)
+	return sendBroadcast(packet, SendOptions{Port: port})
+}
+
+// Broadcast modes: the limited broadcast 255.255.255.255, the directed
+// broadcast of the sending interface's subnet, e.g. 192.168.1.255, which
+// routers are more likely to forward, or the directed broadcast of every
+// subnet on every interface, for hosts that straddle several VLANs.
+const (
+	BroadcastLimited  = "limited"
+	BroadcastDirected = "directed"
+	BroadcastAll      = "all"
+)
+
+func ParseBroadcastMode(mode string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case "", BroadcastLimited:
+		return BroadcastLimited, nil
+	case BroadcastDirected:
+		return BroadcastDirected, nil
+	case BroadcastAll:
+		return BroadcastAll, nil
+	default:
+		return "", fmt.Errorf("unknown broadcast mode '%s' (use limited, directed or all)", mode)
+	}
+}
+
+// sendToPorts sends packet, with retries, to opts.Port and each of
+// opts.ExtraPorts.
+func sendToPorts(packet []byte, opts SendOptions) []PortResult {
+	if _, err := opts.source(); err != nil {
+		return []PortResult{{Port: opts.Port, Error: err}}
+	}
+	if opts.Timing == nil {
+		opts.Timing = &SendTiming{}
+	}
+	defer func() {
+		getLogger().Debug("Send timing: %s", opts.Timing)
+	}()
+
+	// A host name that does not resolve, such as a sleeping host's mDNS
+	// name, only costs the unicast copy; the broadcast still goes out
+	if opts.UnicastIP != "" {
+		start := time.Now()
+		ip, err := ResolveHost(opts.UnicastIP, DefaultResolveTimeout)
+		opts.Timing.resolved(start)
+		if err != nil {
+			getLogger().Warn("Skipping unicast: %v", err)
+		}
+		opts.UnicastIP = ip
+	}
+
+	if opts.WakeAddress != "" {
+		host, port, err := ParseWakeAddress(opts.WakeAddress)
+		if err != nil {
+			return []PortResult{{Port: opts.Port, Error: err}}
+		}
+		start := time.Now()
+		opts.WakeAddress, err = ResolveHost(host, DefaultResolveTimeout)
+		opts.Timing.resolved(start)
+		if err != nil {
+			return []PortResult{{Port: opts.Port, Error: err}}
+		}
+		if port != 0 {
+			opts.Port = port
+		}
+	}
+
+	ports := []int{opts.Port}
+	for _, port := range opts.ExtraPorts {
+		if !slices.Contains(ports, port) {
+			ports = append(ports, port)
+		}
+	}
+
+	results := make([]PortResult, 0, len(ports))
+	for _, port := range ports {
+		portOpts := opts
+		portOpts.Port = port
+		copies := 0
+		err := opts.Retry.Do(func() error {
+			var err error
+			copies, err = sendCopies(packet, portOpts)
+			return err
+		})
+		if err != nil && len(ports) > 1 {
+			getLogger().Warn("Failed to send to port %d: %v", port, err)
+		}
+		results = append(results, PortResult{Port: port, Sent: err == nil, Copies: copies, Error: err})
+	}
+	return results
+}
+
+// sendCopies sends opts.Copies copies of packet, opts.CopyInterval apart,
+// and returns how many went out. It fails only if none did, so a retry
+// resends all of them.
+func sendCopies(packet []byte, opts SendOptions) (int, error) {
+	copies := max(opts.Copies, 1)
+	interval := opts.CopyInterval
+	if interval <= 0 {
+		interval = DefaultCopyInterval
+	}
+
+	sent := 0
+	var lastErr error
+	for i := 0; i < copies; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		if err := sendPacket(packet, opts); err != nil {
+			getLogger().Debug("Copy %d/%d to port %d failed: %v", i+1, copies, opts.Port, err)
+			lastErr = err
+			continue
+		}
+		sent++
+	}
+
+	if sent == 0 {
+		return 0, lastErr
+	}
+	if copies > 1 {
+		getLogger().Debug("Sent %d/%d copies to port %d", sent, copies, opts.Port)
+	}
+	return sent, nil
+}
+
+// portsError fails a multi-port send only if no port was sent to.
+func portsError(results []PortResult) error {
+	for _, result := range results {
+		if result.Sent {
+			return nil
+		}
+	}
+	if len(results) == 1 {
+		return results[0].Error
+	}
+	return fmt.Errorf("sending failed on all %d ports: %w", len(results), results[0].Error)
+}
+
+// sendPacket broadcasts packet and, with UnicastIP set, sends it there too.
+func sendPacket(packet []byte, opts SendOptions) error {
+	send := sendBroadcast
+	if opts.IPv6 {
+		send = sendIPv6
+	}
+	if opts.WakeAddress != "" {
+		send = sendWakeAddress
+	}
+	if err := send(packet, opts); err != nil {
+		return err
+	}
+	if opts.UnicastIP == "" {
+		return nil
+	}
+
+	address := net.JoinHostPort(opts.UnicastIP, strconv.Itoa(opts.Port))
+	getLogger().Debug("Target unicast address: %s", address)
+	source, _ := opts.source()
+	if err := opts.sendTo(packet, address, opts.Interface, source); err != nil {
+		return fmt.Errorf("broadcast sent, but unicast to %s failed: %w", opts.UnicastIP, err)
+	}
+	return nil
+}
+
+// sendWakeAddress sends packet to opts.WakeAddress, already resolved to an
+// IP address by sendToPorts.
+func sendWakeAddress(packet []byte, opts SendOptions) error {
+	address := net.JoinHostPort(opts.WakeAddress, strconv.Itoa(opts.Port))
+	getLogger().Debug("Target wake address: %s", address)
 
-	addr, err := net.ResolveUDPAddr("udp", broadcastAddr)
+	source, _ := opts.source()
+	return opts.sendTo(packet, address, opts.Interface, source)
+}
+
+// ParseBroadcastAddress checks a broadcast address is an IPv4 address.
+func ParseBroadcastAddress(address string) (string, error) {
+	ip := net.ParseIP(strings.TrimSpace(address))
+	if ip == nil || ip.To4() == nil || ip.IsUnspecified() {
+		return "", fmt.Errorf("invalid broadcast address %s (expected an IPv4 address such as 192.168.20.255)", address)
+	}
+	return ip.String(), nil
+}
+
+// ParseWakeAddress splits a wake address, "host" or "host:port", into its
+// host and port; port is 0 if the address has none.
+func ParseWakeAddress(address string) (string, int, error) {
+	address = strings.TrimSpace(address)
+	if address == "" {
+		return "", 0, fmt.Errorf("empty wake address")
+	}
+
+	host, portStr, err := net.SplitHostPort(address)
 	if err != nil {
-		logger.Error("Failed to resolve UDP address %s: %v", broadcastAddr, err)
-		return fmt.Errorf("failed to resolve UDP address %s: %w", broadcastAddr, err)
+		// A bare host, or a bare IPv6 address with its colons
+		host = strings.Trim(address, "[]")
+		if strings.Contains(host, ":") && net.ParseIP(host) == nil {
+			return "", 0, fmt.Errorf("invalid wake address %s (expected host or host:port)", address)
+		}
+		return host, 0, nil
 	}
+	if host == "" {
+		return "", 0, fmt.Errorf("invalid wake address %s: no host", address)
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port < 1 || port > 65535 {
+		return "", 0, fmt.Errorf("invalid port in wake address %s", address)
+	}
+	return host, port, nil
+}
+
+func sendBroadcast(packet []byte, opts SendOptions) error {
+	if opts.Broadcast == BroadcastAll && opts.BroadcastAddress == "" {
+		return sendBroadcastAll(packet, opts)
+	}
+
+	ip := "255.255.255.255"
+	if opts.BroadcastAddress != "" {
+		ip = opts.BroadcastAddress
+	} else if opts.Broadcast == BroadcastDirected {
+		directed, err := directedBroadcast(opts.Interface)
+		if err != nil {
+			return err
+		}
+		ip = directed.String()
+	}
+
+	broadcastAddr := net.JoinHostPort(ip, strconv.Itoa(opts.Port))
+	getLogger().Debug("Target broadcast address: %s", broadcastAddr)
+
+	source, _ := opts.source()
+	return opts.sendTo(packet, broadcastAddr, opts.Interface, source)
+}
+
+// BroadcastTarget is a subnet-directed broadcast address and the interface
+// it is sent from.
+type BroadcastTarget struct {
+	Interface string `json:"interface"`
+	Address   string `json:"address"`
+}
+
+// sendBroadcastAll sends packet to the directed broadcast of every IPv4
+// subnet on every broadcast-capable interface, from that interface's own
+// address, so only opts.SourcePort applies. It fails only if no interface
+// could send.
+func sendBroadcastAll(packet []byte, opts SendOptions) error {
+	logger := getLogger()
 
-	conn, err := net.DialUDP("udp", nil, addr)
+	interfaces, err := ListInterfaces()
+	if err != nil {
+		return err
+	}
+	targets := broadcastTargets(interfaces)
+	if len(targets) == 0 {
+		return fmt.Errorf("no broadcast-capable IPv4 interfaces found")
+	}
+
+	var source *net.UDPAddr
+	if opts.SourcePort != 0 {
+		source = &net.UDPAddr{Port: opts.SourcePort}
+	}
+
+	var sent int
+	var firstErr error
+	for _, target := range targets {
+		address := net.JoinHostPort(target.Address, strconv.Itoa(opts.Port))
+		logger.Debug("Target broadcast address: %s via %s", address, target.Interface)
+
+		if err := opts.sendTo(packet, address, target.Interface, source); err != nil {
+			logger.Warn("Failed to broadcast on %s: %v", target.Interface, err)
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		sent++
+	}
+
+	if sent == 0 {
+		return fmt.Errorf("broadcast failed on all %d interfaces: %w", len(targets), firstErr)
+	}
+	return nil
+}
+
+// broadcastTargets lists the directed broadcasts of the non-loopback,
+// broadcast-capable interfaces, once per address.
+func broadcastTargets(interfaces []InterfaceInfo) []BroadcastTarget {
+	var targets []BroadcastTarget
+	for _, iface := range interfaces {
+		if iface.Loopback || !iface.Broadcast {
+			continue
+		}
+		for _, addr := range iface.Addresses {
+			target := BroadcastTarget{Interface: iface.Name, Address: addr.Broadcast}
+			if addr.Broadcast != "" && !slices.Contains(targets, target) {
+				targets = append(targets, target)
+			}
+		}
+	}
+	return targets
+}
+
+// directedBroadcast returns the subnet broadcast address of iface, or of
+// the default route's interface when iface is empty.
+func directedBroadcast(iface string) (net.IP, error) {
+	if iface == "" {
+		info, err := getNetworkInfo()
+		if err != nil || info.BroadcastIP == "" {
+			return nil, fmt.Errorf("could not determine the subnet broadcast address, name an interface")
+		}
+		return net.ParseIP(info.BroadcastIP), nil
+	}
+
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return nil, fmt.Errorf("unknown interface %s: %w", iface, err)
+	}
+	addrs, err := ifi.Addrs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read addresses of %s: %w", iface, err)
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.To4() != nil {
+			return subnetBroadcast(ipnet), nil
+		}
+	}
+	return nil, fmt.Errorf("interface %s has no IPv4 address", iface)
+}
+
+func subnetBroadcast(ipnet *net.IPNet) net.IP {
+	ip := ipnet.IP.To4()
+	mask := ipnet.Mask
+	if len(mask) == net.IPv6len {
+		mask = mask[12:]
+	}
+
+	broadcast := make(net.IP, 4)
+	for i := range ip {
+		broadcast[i] = ip[i] | ^mask[i]
+	}
+	return broadcast
+}
+
+// sendSocket is how a socket sending to one address is set up: the local
+// address it binds, if any, and the control function pinning it to an
+// interface.
+type sendSocket struct {
+	local   *net.UDPAddr
+	control func(network, address string, c syscall.RawConn) error
+}
+
+// socketFor sets up sending to addr from iface and source, scoping
+// link-local IPv6 destinations to iface.
+func socketFor(addr *net.UDPAddr, iface string, source *net.UDPAddr) (sendSocket, error) {
+	logger := getLogger()
+
+	var socket sendSocket
+	switch {
+	case iface == "":
+	case addr.IP.To4() != nil:
+		local, err := interfaceAddr(iface)
+		if err != nil {
+			return socket, err
+		}
+		socket.local = local
+		socket.control = bindToDevice(iface)
+		logger.Debug("Sending from %s (%s)", iface, local.IP)
+	default:
+		// Link-local and multicast IPv6 destinations are scoped by zone
+		if addr.Zone == "" && (addr.IP.IsLinkLocalMulticast() || addr.IP.IsLinkLocalUnicast() || addr.IP.IsInterfaceLocalMulticast()) {
+			addr.Zone = iface
+		}
+		socket.control = bindToDevice(iface)
+		logger.Debug("Sending from %s", iface)
+	}
+
+	if source != nil {
+		local := &net.UDPAddr{IP: source.IP, Port: source.Port}
+		if local.IP == nil && socket.local != nil {
+			local.IP = socket.local.IP
+		}
+		socket.local = local
+		logger.Debug("Sending from source address %s", local)
+	}
+	return socket, nil
+}
+
+// sendTo sends packet through opts' Sender, or a socket of its own.
+func (opts SendOptions) sendTo(packet []byte, address, iface string, source *net.UDPAddr) error {
+	if opts.sender != nil {
+		return opts.sender.sendTo(packet, address, iface, source, opts.Timing)
+	}
+	return sendPacketTo(packet, address, iface, source, opts.Timing)
+}
+
+// sendPacketTo sends packet in a single UDP datagram to address, from
+// iface if it is not empty. A non-nil source binds the socket to its
+// address and port; a zero part of it is left to iface or the system.
+// The durations of each step are added to a non-nil timing.
+func sendPacketTo(packet []byte, address, iface string, source *net.UDPAddr, timing *SendTiming) error {
+	logger := getLogger()
+
+	start := time.Now()
+	addr, err := net.ResolveUDPAddr("udp", address)
+	timing.resolved(start)
+	if err != nil {
+		logger.Error("Failed to resolve UDP address %s: %v", address, err)
+		return fmt.Errorf("failed to resolve UDP address %s: %w", address, err)
+	}
+
+	start = time.Now()
+	socket, err := socketFor(addr, iface, source)
+	if err != nil {
+		return err
+	}
+	dialer := net.Dialer{Control: socket.control}
+	if socket.local != nil {
+		dialer.LocalAddr = socket.local
+	}
+
+	conn, err := dialer.Dial("udp", addr.String())
+	timing.dialed(start)
 	if err != nil {
 		logger.Error("Failed to create UDP connection: %v", err)
 		return fmt.Errorf("failed to create UDP connection: %w", err)
@@ -98,7 +587,9 @@ func SendWakePacket(packet []byte, port int) error {
 	}
 
 	logger.Debug("Sending magic packet...")
+	start = time.Now()
 	bytesWritten, err := conn.Write(packet)
+	timing.wrote(start)
 	if err != nil {
 		logger.Error("Failed to send magic packet: %v", err)
 		return fmt.Errorf("failed to send magic packet: %w", err)
@@ -114,12 +605,120 @@ func SendWakePacket(packet []byte, port int) error {
 	return nil
 }
 
+// SendOptions selects how SendWakeOnLANWith builds and sends the packet.
+type SendOptions struct {
+	Port   int
+	Packet wol_packet.PacketOptions
+	// Interface sends from this network interface instead of the one the
+	// default route picks
+	Interface string
+	// Broadcast is BroadcastLimited (the default) or BroadcastDirected
+	Broadcast string
+	// BroadcastAddress is sent to instead of the address Broadcast picks,
+	// such as the directed broadcast of a subnet on another VLAN
+	BroadcastAddress string
+	// UnicastIP also sends the packet straight to this address, which
+	// reaches hosts on routed segments that broadcasts do not
+	UnicastIP string
+	// IPv6 sends to the all-nodes multicast group ff02::1, or IPv6Address,
+	// instead of an IPv4 broadcast
+	IPv6        bool
+	IPv6Address string
+	Retry       RetryConfig
+	// ExtraPorts are sent to in addition to Port; different NIC firmware
+	// listens on 9 or 7
+	ExtraPorts []int
+	// SourceIP and SourcePort bind the outgoing socket, for policy routing
+	// and firewall rules keyed on the source; zero values let the system
+	// choose. SourceIP must belong to this host.
+	SourceIP   string
+	SourcePort int
+	// WakeAddress sends the packet to this host[:port] instead of
+	// broadcasting it, such as a router's public address with a port
+	// forwarded to the LAN; its port, if any, replaces Port
+	WakeAddress string
+	// Copies sends the packet this many times, CopyInterval apart (default
+	// DefaultCopyInterval), as one attempt; NICs and switches waking from a
+	// deep sleep state can miss a single packet
+	Copies       int
+	CopyInterval time.Duration
+	// Raw sends a raw Ethernet frame on Interface instead, tagged for VLAN
+	// unless it is 0; the UDP settings above do not apply
+	Raw  bool
+	VLAN int
+	// Timing, if set, has the durations of the send added to it
+	Timing *SendTiming
+
+	// sender is the Sender whose sockets the packet goes out through
+	sender *Sender
+}
+
+// source returns the address the socket is bound to, or nil if neither
+// SourceIP nor SourcePort is set.
+func (opts SendOptions) source() (*net.UDPAddr, error) {
+	if opts.SourceIP == "" && opts.SourcePort == 0 {
+		return nil, nil
+	}
+	if opts.SourcePort < 0 || opts.SourcePort > 65535 {
+		return nil, fmt.Errorf("invalid source port %d", opts.SourcePort)
+	}
+
+	source := &net.UDPAddr{Port: opts.SourcePort}
+	if opts.SourceIP != "" {
+		if source.IP = net.ParseIP(opts.SourceIP); source.IP == nil {
+			return nil, fmt.Errorf("invalid source IP address: %s", opts.SourceIP)
+		}
+	}
+	return source, nil
+}
+
+// PortResult is the outcome of sending to one UDP port.
+type PortResult struct {
+	Port int
+	Sent bool
+	// Copies is how many copies of the packet went out
+	Copies int
+	Error  error
+}
+
+func (p PortResult) MarshalJSON() ([]byte, error) {
+	result := struct {
+		Port   int    `json:"port"`
+		Sent   bool   `json:"sent"`
+		Copies int    `json:"copies"`
+		Error  string `json:"error,omitempty"`
+	}{Port: p.Port, Sent: p.Sent, Copies: p.Copies}
+	if p.Error != nil {
+		result.Error = p.Error.Error()
+	}
+	return json.Marshal(result)
+}
+
 func SendWakeOnLAN(mac string, port int) error {
+	return SendWakeOnLANWith(mac, SendOptions{Port: port})
+}
+
+// SendWakeOnLANOpts is SendWakeOnLAN with extra MAC repetitions, padding
+// or a SecureOn password.
+func SendWakeOnLANOpts(mac string, port int, opts wol_packet.PacketOptions) error {
+	return SendWakeOnLANWith(mac, SendOptions{Port: port, Packet: opts})
+}
+
+func SendWakeOnLANWith(mac string, opts SendOptions) error {
+	if opts.Raw {
+		return SendWakeOnLANRaw(mac, opts.Interface, opts.VLAN, opts.Packet)
+	}
+
 	logger := getLogger()
 
+	port := opts.Port
+	if port == 0 {
+		port = DefaultWoLPort
+	}
+
 	logger.Info("Initiating Wake-on-LAN for MAC=%s on port=%d", mac, port)
 
-	packet, err := wol_packet.BuildMagicPacket(mac)
+	packet, err := wol_packet.BuildMagicPacketOpts(mac, opts.Packet)
 	if err != nil {
 		logger.LogWakeAttempt(mac, port, false, err)
 		return fmt.Errorf("failed to build magic packet: %w", err)
@@ -127,7 +726,8 @@ func SendWakeOnLAN(mac string, port int) error {
 
 	logger.LogPacketDetails(mac, len(packet), port)
 
-	err = SendWakePacket(packet, port)
+	opts.Port = port
+	err = portsError(sendToPorts(packet, opts))
 	if err != nil {
 		logger.LogWakeAttempt(mac, port, false, err)
 		return fmt.Errorf("failed to send wake packet: %w", err)
@@ -137,11 +737,23 @@ func SendWakeOnLAN(mac string, port int) error {
 	return nil
 }
 
+// SendMagicPacket sends an already built packet, such as one received for
+// relaying, the way SendWakeOnLANWith would.
+func SendMagicPacket(packet []byte, opts SendOptions) error {
+	if len(packet) > wol_packet.MaxPacketSize {
+		return fmt.Errorf("packet of %d bytes exceeds the maximum of %d", len(packet), wol_packet.MaxPacketSize)
+	}
+	if opts.Port == 0 {
+		opts.Port = DefaultWoLPort
+	}
+	return portsError(sendToPorts(packet, opts))
+}
+
 func SendWakeOnLANDefault(mac string) error {
 	return SendWakeOnLAN(mac, DefaultWoLPort)
 }
 
-func SendWakeOnLANWithVerification(mac string, port int, config VerificationConfig) (*PacketVerificationResult, error) {
+func SendWakeOnLANWithVerification(mac string, config VerificationConfig) (*PacketVerificationResult, error) {
 	logger := getLogger()
 	result := &PacketVerificationResult{}
 
@@ -156,208 +768,142 @@ func SendWakeOnLANWithVerification(mac string, port int, config VerificationConf
 			netInfo.LocalIP, netInfo.BroadcastIP, netInfo.InterfaceName)
 	}
 
-	packet, err := wol_packet.BuildMagicPacket(mac)
+	packet, err := wol_packet.BuildMagicPacketOpts(mac, config.Packet)
 	if err != nil {
 		result.Error = fmt.Errorf("failed to build magic packet: %w", err)
 		return result, result.Error
 	}
 
-	var captureResult chan bool
-	if config.EnableCapture {
-		captureResult = make(chan bool, 1)
-		go captureWoLPacket(mac, port, config.CaptureInterface, config.CaptureTimeout, captureResult, logger)
-		time.Sleep(100 * time.Millisecond)
+	targetIP, err := ResolveHost(config.TargetIP, DefaultResolveTimeout)
+	if err != nil {
+		logger.Warn("Verification: %v", err)
+		targetIP = config.TargetIP
 	}
 
-	err = SendWakePacket(packet, port)
+	opts := config.SendOptions
+	if opts.Port == 0 {
+		opts.Port = DefaultWoLPort
+	}
+
+	target := VerifyTarget{MAC: mac, Port: opts.Port, IP: targetIP}
+	checks, err := config.Pipeline().Run(target, func() error {
+		if opts.Raw {
+			return SendWakeOnLANRaw(mac, opts.Interface, opts.VLAN, opts.Packet)
+		}
+		if config.Unicast {
+			opts.UnicastIP = targetIP
+		}
+		opts.Timing = &result.Timing
+		result.Ports = sendToPorts(packet, opts)
+		return portsError(result.Ports)
+	})
 	if err != nil {
 		result.Error = fmt.Errorf("failed to send wake packet: %w", err)
 		return result, result.Error
 	}
 	result.PacketSent = true
 	result.BroadcastSent = true
-
-	if config.EnableCapture {
-		select {
-		case captured := <-captureResult:
-			result.PacketCaptured = captured
-			if captured {
-				result.CaptureDetails = "Magic packet detected on network"
+	result.Checks = checks
+
+	for _, check := range checks {
+		switch {
+		case check.Name == "capture":
+			result.PacketCaptured = check.Success
+			result.CaptureDetails = check.Details
+			if check.Success {
 				logger.Info("Verification: Magic packet successfully captured on network")
 			} else {
-				result.CaptureDetails = "No magic packet detected during capture window"
 				logger.Warn("Verification: Magic packet not detected on network")
 			}
-		case <-time.After(config.CaptureTimeout + time.Second):
-			result.CaptureDetails = "Capture timeout"
-			logger.Warn("Verification: Packet capture timed out")
-		}
-	}
-
-	if config.EnablePing {
-		targetIP := netInfo.BroadcastIP
-		if targetIP != "" {
-			result.TargetReachable = pingHost(targetIP, config.PingTimeout, logger)
-			if result.TargetReachable {
-				logger.Info("Verification: Target appears to be reachable")
-			} else {
-				logger.Debug("Verification: Target not reachable (expected if device was already off)")
-			}
+		case check.Success:
+			result.TargetReachable = true
+			logger.Info("Verification: Target confirmed awake by %s: %s", check.Name, check.Details)
 		}
 	}
 
 	return result, nil
 }
 
+// getNetworkInfo describes the interface wake packets leave from by
+// default. It takes the default route's interface from the routing table,
+// or the interface the route to a public address would use, or else the
+// first up broadcast interface with an IPv4 address, none of which sends
+// any traffic, so it works on LANs without internet access.
 func getNetworkInfo() (NetworkInfo, error) {
-	var info NetworkInfo
+	logger := getLogger()
 
-	conn, err := net.Dial("udp", "8.8.8.8:80")
+	interfaces, err := ListInterfaces()
 	if err != nil {
-		return info, err
+		return NetworkInfo{}, err
 	}
-	defer conn.Close()
 
-	localAddr := conn.LocalAddr().(*net.UDPAddr)
-	info.LocalIP = localAddr.IP.String()
+	if route, err := readDefaultRoute(); err == nil {
+		for _, iface := range interfaces {
+			if iface.Name != route.Interface {
+				continue
+			}
+			if info, ok := networkInfoFor(iface, ""); ok {
+				return info, nil
+			}
+		}
+	} else {
+		logger.Debug("No default route in the routing table: %v", err)
+	}
 
-	interfaces, err := net.Interfaces()
-	if err != nil {
-		return info, err
+	// Connecting a UDP socket only picks a route; nothing is sent
+	if conn, err := net.Dial("udp4", "8.8.8.8:80"); err == nil {
+		localIP := conn.LocalAddr().(*net.UDPAddr).IP.String()
+		conn.Close()
+		for _, iface := range interfaces {
+			if info, ok := networkInfoFor(iface, localIP); ok {
+				return info, nil
+			}
+		}
 	}
 
 	for _, iface := range interfaces {
-		addrs, err := iface.Addrs()
-		if err != nil {
+		if iface.Loopback || !iface.Broadcast {
 			continue
 		}
-
-		for _, addr := range addrs {
-			if ipnet, ok := addr.(*net.IPNet); ok {
-				if ipnet.IP.String() == info.LocalIP {
-					info.InterfaceName = iface.Name
-					info.MACAddress = iface.HardwareAddr.String()
-
-					ip := ipnet.IP.To4()
-					mask := ipnet.Mask
-					if ip != nil && mask != nil {
-						broadcast := make(net.IP, 4)
-						for i := range ip {
-							broadcast[i] = ip[i] | ^mask[i]
-						}
-						info.BroadcastIP = broadcast.String()
-					}
-					return info, nil
-				}
-			}
+		if info, ok := networkInfoFor(iface, ""); ok {
+			return info, nil
 		}
 	}
 
-	return info, nil
+	return NetworkInfo{}, fmt.Errorf("no active IPv4 network interface found")
 }
 
-func captureWoLPacket(targetMAC string, port int, iface string, timeout time.Duration, result chan bool, logger *Logger) {
-	// This is a simplified version - in a real implementation, you'd use a packet capture library
-	// like gopacket/pcap, but that requires additional dependencies and platform-specific setup
-
-	logger.Debug("Starting packet capture simulation for %s on port %d", targetMAC, port)
-
-	// For now, we'll simulate packet detection by monitoring our own broadcast
-	// In a real implementation, this would use libpcap or similar
-
-	// Create a UDP listener on the WoL port to detect our own broadcast
-	addr, err := net.ResolveUDPAddr("udp", fmt.Sprintf(":%d", port))
-	if err != nil {
-		logger.Error("Failed to resolve UDP address for capture: %v", err)
-		result <- false
-		return
-	}
-
-	conn, err := net.ListenUDP("udp", addr)
-	if err != nil {
-		logger.Debug("Could not listen for packet capture (port may be in use): %v", err)
-		result <- false
-		return
-	}
-	defer conn.Close()
-
-	// Set read timeout
-	conn.SetReadDeadline(time.Now().Add(timeout))
-
-	buffer := make([]byte, 1024)
-	for {
-		n, clientAddr, err := conn.ReadFromUDP(buffer)
-		if err != nil {
-			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
-				result <- false
-				return
-			}
+// networkInfoFor describes iface by its first IPv4 address, or by ip if
+// it is not empty.
+func networkInfoFor(iface InterfaceInfo, ip string) (NetworkInfo, bool) {
+	for _, addr := range iface.Addresses {
+		if parsed := net.ParseIP(addr.IP); parsed == nil || parsed.To4() == nil {
 			continue
 		}
-
-		if n == 102 { // Magic packet size
-			logger.Debug("Detected potential WoL packet from %s (%d bytes)", clientAddr, n)
-
-			// Verify it's actually a magic packet
-			if isMagicPacket(buffer[:n], targetMAC) {
-				logger.Info("Confirmed magic packet for %s captured", targetMAC)
-				result <- true
-				return
-			}
+		if ip != "" && addr.IP != ip {
+			continue
 		}
+
+		return NetworkInfo{
+			LocalIP:       addr.IP,
+			BroadcastIP:   addr.Broadcast,
+			InterfaceName: iface.Name,
+			MACAddress:    iface.MAC,
+			MTU:           iface.MTU,
+		}, true
 	}
+	return NetworkInfo{}, false
 }
 
-// isMagicPacket verifies if a packet is a valid WoL magic packet
+// isMagicPacket reports whether packet starts with a magic packet for
+// targetMAC, ignoring extra repetitions, a password or padding.
 func isMagicPacket(packet []byte, targetMAC string) bool {
-	if len(packet) != 102 {
+	if len(packet) < 102 {
 		return false
 	}
 
-	// Check for 6 bytes of 0xFF
-	for i := 0; i < 6; i++ {
-		if packet[i] != 0xFF {
-			return false
-		}
-	}
-
-	// Clean target MAC for comparison
-	cleanTargetMAC := wol_packet.CleanMAC(targetMAC)
-	targetBytes := make([]byte, 6)
-	for i := 0; i < 6; i++ {
-		fmt.Sscanf(cleanTargetMAC[i*2:i*2+2], "%02X", &targetBytes[i])
-	}
-
-	// Check that the MAC is repeated 16 times
-	for i := 0; i < 16; i++ {
-		start := 6 + i*6
-		for j := 0; j < 6; j++ {
-			if packet[start+j] != targetBytes[j] {
-				return false
-			}
-		}
-	}
-
-	return true
-}
-
-// pingHost attempts to ping a host to check reachability
-func pingHost(host string, timeout time.Duration, logger *Logger) bool {
-	// Simple TCP dial test (more reliable than ICMP ping which requires privileges)
-	commonPorts := []int{22, 80, 443, 135, 445, 3389} // SSH, HTTP, HTTPS, RPC, SMB, RDP
-
-	for _, port := range commonPorts {
-		address := fmt.Sprintf("%s:%d", host, port)
-		conn, err := net.DialTimeout("tcp", address, timeout/time.Duration(len(commonPorts)))
-		if err == nil {
-			conn.Close()
-			logger.Debug("Host %s is reachable on port %d", host, port)
-			return true
-		}
-	}
-
-	logger.Debug("Host %s not reachable on common ports", host)
-	return false
+	mac, _, err := wol_packet.ParseMagicPacket(packet[:102])
+	return err == nil && wol_packet.CleanMAC(mac) == wol_packet.CleanMAC(targetMAC)
 }
 
 // VerifyNetworkConnectivity performs basic network connectivity checks
@@ -373,7 +919,7 @@ func VerifyNetworkConnectivity() (*NetworkInfo, error) {
 		netInfo.InterfaceName, netInfo.LocalIP, netInfo.BroadcastIP)
 
 	// Test UDP broadcast capability
-	testAddr := fmt.Sprintf("%s:%d", netInfo.BroadcastIP, DefaultWoLPort)
+	testAddr := net.JoinHostPort(netInfo.BroadcastIP, strconv.Itoa(DefaultWoLPort))
 	conn, err := net.Dial("udp", testAddr)
 	if err != nil {
 		return &netInfo, fmt.Errorf("cannot create UDP connection to broadcast address: %w", err)
@@ -381,5 +927,19 @@ func VerifyNetworkConnectivity() (*NetworkInfo, error) {
 	conn.Close()
 
 	logger.Info("Network connectivity verified - UDP broadcast capability confirmed")
+
+	extendNetworkInfo(&netInfo)
 	return &netInfo, nil
 }
+
+// extendNetworkInfo adds the default gateway, if it is on info's
+// interface, the DNS servers and every interface that can broadcast.
+func extendNetworkInfo(info *NetworkInfo) {
+	if route, err := readDefaultRoute(); err == nil && route.Interface == info.InterfaceName {
+		info.Gateway = route.Gateway
+	}
+	info.DNSServers = dnsServers()
+	if interfaces, err := ListInterfaces(); err == nil {
+		info.BroadcastInterfaces = broadcastTargets(interfaces)
+	}
+}
@@ -1,8 +1,13 @@
 package wol_network
 
 import (
+	"encoding/json"
 	"net"
+	"slices"
+	"strconv"
 	"testing"
+	"time"
+	wol_packet "wol-server/wol/packet"
 )
 
 func TestSendPacket(t *testing.T) {
@@ -236,3 +241,485 @@ func isNetworkError(err error) bool {
 
 	return false
 }
+
+func TestBench(t *testing.T) {
+	for _, mode := range []string{BenchBuild, BenchUnicast, BenchReuse, BenchPool} {
+		t.Run(mode, func(t *testing.T) {
+			result, err := Bench(BenchConfig{Mode: mode, Count: 50})
+			if err != nil {
+				t.Fatalf("Bench() error = %v", err)
+			}
+			if result.Packets != 50 || result.Errors != 0 {
+				t.Errorf("Bench() = %d packets, %d errors, want 50, 0", result.Packets, result.Errors)
+			}
+			if result.PacketsPerSecond <= 0 {
+				t.Errorf("PacketsPerSecond = %v, want > 0", result.PacketsPerSecond)
+			}
+		})
+	}
+
+	if _, err := Bench(BenchConfig{Mode: "carrier-pigeon"}); err == nil {
+		t.Error("Bench() expected error for unknown mode")
+	}
+}
+
+func benchmarkSend(b *testing.B, mode string) {
+	sink, err := startSink()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer sink.Close()
+
+	host, port, _ := net.SplitHostPort(sink.LocalAddr().String())
+	portNum, _ := strconv.Atoi(port)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	if _, err := Bench(BenchConfig{Mode: mode, Count: b.N, Target: host, Port: portNum}); err != nil {
+		b.Fatal(err)
+	}
+}
+
+func BenchmarkSendUnicast(b *testing.B) { benchmarkSend(b, BenchUnicast) }
+
+func BenchmarkSendReuse(b *testing.B) { benchmarkSend(b, BenchReuse) }
+
+func BenchmarkSendPool(b *testing.B) { benchmarkSend(b, BenchPool) }
+
+func TestSendFromInterface(t *testing.T) {
+	lo := loopbackInterface(t)
+
+	if _, err := interfaceAddr("does-not-exist0"); err == nil {
+		t.Error("interfaceAddr() expected error for unknown interface")
+	}
+
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() error = %v", err)
+	}
+	defer listener.Close()
+
+	if err := sendPacketTo(make([]byte, 102), listener.LocalAddr().String(), lo, nil, nil); err != nil {
+		t.Fatalf("sendPacketTo() error = %v", err)
+	}
+
+	buffer := make([]byte, 256)
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, from, err := listener.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatalf("ReadFromUDP() error = %v", err)
+	}
+	if n != 102 || !from.IP.IsLoopback() {
+		t.Errorf("received %d bytes from %s, want 102 from loopback", n, from)
+	}
+
+	if err := SendWakeOnLANWith("AA:BB:CC:DD:EE:FF", SendOptions{Interface: "does-not-exist0"}); err == nil {
+		t.Error("SendWakeOnLANWith() expected error for unknown interface")
+	}
+}
+
+func TestSendFromSource(t *testing.T) {
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() error = %v", err)
+	}
+	defer listener.Close()
+
+	probe, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sourcePort := probe.LocalAddr().(*net.UDPAddr).Port
+	probe.Close()
+
+	source, err := SendOptions{SourceIP: "127.0.0.1", SourcePort: sourcePort}.source()
+	if err != nil {
+		t.Fatalf("source() error = %v", err)
+	}
+	if err := sendPacketTo(make([]byte, 102), listener.LocalAddr().String(), "", source, nil); err != nil {
+		t.Fatalf("sendPacketTo() error = %v", err)
+	}
+
+	buffer := make([]byte, 256)
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, from, err := listener.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatalf("ReadFromUDP() error = %v", err)
+	}
+	if from.Port != sourcePort {
+		t.Errorf("packet came from port %d, want %d", from.Port, sourcePort)
+	}
+
+	invalid := []SendOptions{
+		{SourceIP: "not-an-ip"},
+		{SourcePort: 70000},
+	}
+	for _, opts := range invalid {
+		if err := SendWakeOnLANWith("AA:BB:CC:DD:EE:FF", opts); err == nil {
+			t.Errorf("SendWakeOnLANWith(%+v) expected error", opts)
+		}
+	}
+}
+
+func TestParseWakeAddress(t *testing.T) {
+	tests := []struct {
+		address  string
+		wantHost string
+		wantPort int
+		wantErr  bool
+	}{
+		{"203.0.113.7:9", "203.0.113.7", 9, false},
+		{"home.example.com", "home.example.com", 0, false},
+		{" home.example.com:4009 ", "home.example.com", 4009, false},
+		{"[2001:db8::1]:9", "2001:db8::1", 9, false},
+		{"2001:db8::1", "2001:db8::1", 0, false},
+		{"home.example.com:0", "", 0, true},
+		{"home.example.com:wol", "", 0, true},
+		{":9", "", 0, true},
+		{"", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			host, port, err := ParseWakeAddress(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseWakeAddress() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if host != tt.wantHost || port != tt.wantPort {
+				t.Errorf("ParseWakeAddress() = %q, %d, want %q, %d", host, port, tt.wantHost, tt.wantPort)
+			}
+		})
+	}
+}
+
+func TestSendToWakeAddress(t *testing.T) {
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() error = %v", err)
+	}
+	defer listener.Close()
+
+	opts := SendOptions{Port: DefaultWoLPort, WakeAddress: listener.LocalAddr().String()}
+	if err := SendWakeOnLANWith("AA:BB:CC:DD:EE:FF", opts); err != nil {
+		t.Fatalf("SendWakeOnLANWith() error = %v", err)
+	}
+
+	buffer := make([]byte, 256)
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := listener.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatalf("packet not received at wake address: %v", err)
+	}
+	if mac, _, err := wol_packet.ParseMagicPacket(buffer[:n]); err != nil || mac != "AA:BB:CC:DD:EE:FF" {
+		t.Errorf("received packet = %q, %v, want AA:BB:CC:DD:EE:FF", mac, err)
+	}
+
+	opts.WakeAddress = "home.example.com:99999"
+	if err := SendWakeOnLANWith("AA:BB:CC:DD:EE:FF", opts); err == nil {
+		t.Error("SendWakeOnLANWith() expected error for invalid wake address")
+	}
+}
+
+func TestSendCopies(t *testing.T) {
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() error = %v", err)
+	}
+	defer listener.Close()
+
+	packet, _ := wol_packet.BuildMagicPacket("AA:BB:CC:DD:EE:FF")
+	opts := SendOptions{
+		Port:         DefaultWoLPort,
+		WakeAddress:  listener.LocalAddr().String(),
+		Copies:       3,
+		CopyInterval: 20 * time.Millisecond,
+	}
+
+	start := time.Now()
+	results := sendToPorts(packet, opts)
+	if elapsed := time.Since(start); elapsed < 2*opts.CopyInterval {
+		t.Errorf("copies sent in %v, want at least %v apart", elapsed, opts.CopyInterval)
+	}
+	if len(results) != 1 || !results[0].Sent || results[0].Copies != 3 {
+		t.Fatalf("sendToPorts() = %+v, want one result with 3 copies", results)
+	}
+
+	buffer := make([]byte, 256)
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for i := 0; i < opts.Copies; i++ {
+		if _, _, err := listener.ReadFromUDP(buffer); err != nil {
+			t.Fatalf("copy %d not received: %v", i+1, err)
+		}
+	}
+}
+
+func loopbackInterface(t *testing.T) string {
+	t.Helper()
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagLoopback != 0 && iface.Flags&net.FlagUp != 0 {
+			return iface.Name
+		}
+	}
+	t.Skip("no loopback interface")
+	return ""
+}
+
+func TestListInterfaces(t *testing.T) {
+	name := loopbackInterface(t)
+
+	interfaces, err := ListInterfaces()
+	if err != nil {
+		t.Fatalf("ListInterfaces() error = %v", err)
+	}
+
+	for _, info := range interfaces {
+		if info.Name != name {
+			continue
+		}
+		if !info.Loopback {
+			t.Errorf("%s: Loopback = false, want true", name)
+		}
+		for _, addr := range info.Addresses {
+			if addr.IP == "127.0.0.1" {
+				if addr.Subnet != "127.0.0.0/8" {
+					t.Errorf("127.0.0.1: Subnet = %s, want 127.0.0.0/8", addr.Subnet)
+				}
+				return
+			}
+		}
+		t.Errorf("%s has no 127.0.0.1 address: %+v", name, info.Addresses)
+		return
+	}
+	t.Errorf("ListInterfaces() is missing the loopback interface %s", name)
+}
+
+func TestSubnetBroadcast(t *testing.T) {
+	tests := []struct {
+		cidr string
+		want string
+	}{
+		{"192.168.1.20/24", "192.168.1.255"},
+		{"10.1.2.3/8", "10.255.255.255"},
+		{"172.16.5.9/20", "172.16.15.255"},
+		{"192.0.2.7/32", "192.0.2.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cidr, func(t *testing.T) {
+			ip, ipnet, _ := net.ParseCIDR(tt.cidr)
+			ipnet.IP = ip
+			if got := subnetBroadcast(ipnet).String(); got != tt.want {
+				t.Errorf("subnetBroadcast() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseBroadcastMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    string
+		wantErr bool
+	}{
+		{"", BroadcastLimited, false},
+		{"limited", BroadcastLimited, false},
+		{"Directed", BroadcastDirected, false},
+		{"all", BroadcastAll, false},
+		{"multicast", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBroadcastMode(tt.mode)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseBroadcastMode(%q) = %q, %v, want %q", tt.mode, got, err, tt.want)
+		}
+	}
+}
+
+func TestBroadcastTargets(t *testing.T) {
+	interfaces := []InterfaceInfo{
+		{Name: "lo", Loopback: true, Addresses: []InterfaceAddress{{IP: "127.0.0.1", Subnet: "127.0.0.0/8"}}},
+		{Name: "eth0", Broadcast: true, Addresses: []InterfaceAddress{
+			{IP: "192.168.1.2", Subnet: "192.168.1.0/24", Broadcast: "192.168.1.255"},
+			{IP: "fe80::1", Subnet: "fe80::/64"},
+		}},
+		{Name: "eth0.20", Broadcast: true, Addresses: []InterfaceAddress{
+			{IP: "10.20.0.2", Subnet: "10.20.0.0/16", Broadcast: "10.20.255.255"},
+			{IP: "10.20.0.3", Subnet: "10.20.0.0/16", Broadcast: "10.20.255.255"},
+		}},
+		{Name: "tun0", Addresses: []InterfaceAddress{{IP: "10.8.0.2", Subnet: "10.8.0.0/24"}}},
+	}
+
+	want := []BroadcastTarget{
+		{Interface: "eth0", Address: "192.168.1.255"},
+		{Interface: "eth0.20", Address: "10.20.255.255"},
+	}
+
+	got := broadcastTargets(interfaces)
+	if !slices.Equal(got, want) {
+		t.Errorf("broadcastTargets() = %+v, want %+v", got, want)
+	}
+}
+
+func TestDirectedBroadcast(t *testing.T) {
+	lo := loopbackInterface(t)
+
+	ip, err := directedBroadcast(lo)
+	if err != nil {
+		t.Fatalf("directedBroadcast() error = %v", err)
+	}
+	if !ip.IsLoopback() {
+		t.Errorf("directedBroadcast(%s) = %s, want a loopback address", lo, ip)
+	}
+
+	if _, err := directedBroadcast("does-not-exist0"); err == nil {
+		t.Error("directedBroadcast() expected error for unknown interface")
+	}
+}
+
+func TestSendWakeOnLANUnicast(t *testing.T) {
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() error = %v", err)
+	}
+	defer listener.Close()
+	port := listener.LocalAddr().(*net.UDPAddr).Port
+
+	err = SendWakeOnLANWith("AA:BB:CC:DD:EE:FF", SendOptions{Port: port, UnicastIP: "127.0.0.1"})
+	if err != nil {
+		t.Fatalf("SendWakeOnLANWith() error = %v", err)
+	}
+
+	buffer := make([]byte, 256)
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := listener.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatalf("unicast packet not received: %v", err)
+	}
+	if !isMagicPacket(buffer[:n], "AA:BB:CC:DD:EE:FF") {
+		t.Errorf("received %d bytes that are not the magic packet", n)
+	}
+}
+
+func TestSendToPorts(t *testing.T) {
+	var listeners []*net.UDPConn
+	var ports []int
+	for i := 0; i < 2; i++ {
+		listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+		if err != nil {
+			t.Fatalf("ListenUDP() error = %v", err)
+		}
+		defer listener.Close()
+		listeners = append(listeners, listener)
+		ports = append(ports, listener.LocalAddr().(*net.UDPAddr).Port)
+	}
+
+	packet := make([]byte, 102)
+	results := sendToPorts(packet, SendOptions{Port: ports[0], ExtraPorts: []int{ports[1], ports[0]}, UnicastIP: "127.0.0.1"})
+	if len(results) != 2 {
+		t.Fatalf("got %d port results, want 2 (duplicates dropped)", len(results))
+	}
+	for i, result := range results {
+		if result.Port != ports[i] || !result.Sent {
+			t.Errorf("result %d = %+v, want port %d sent", i, result, ports[i])
+		}
+	}
+	if err := portsError(results); err != nil {
+		t.Errorf("portsError() = %v", err)
+	}
+
+	buffer := make([]byte, 256)
+	for _, listener := range listeners {
+		listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := listener.ReadFromUDP(buffer); err != nil {
+			t.Errorf("no packet on %s: %v", listener.LocalAddr(), err)
+		}
+	}
+}
+
+func TestPortsError(t *testing.T) {
+	failed := PortResult{Port: 9, Error: net.ErrClosed}
+	sent := PortResult{Port: 7, Sent: true}
+
+	if err := portsError([]PortResult{failed, sent}); err != nil {
+		t.Errorf("portsError() = %v, want nil when one port was sent to", err)
+	}
+	if err := portsError([]PortResult{failed}); err != net.ErrClosed {
+		t.Errorf("portsError() = %v, want the single port's error", err)
+	}
+	if err := portsError([]PortResult{failed, failed}); err == nil {
+		t.Error("portsError() = nil, want error when every port failed")
+	}
+}
+
+func TestPortResult_MarshalJSON(t *testing.T) {
+	tests := []struct {
+		result PortResult
+		want   string
+	}{
+		{PortResult{Port: 9, Sent: true, Copies: 2}, `{"port":9,"sent":true,"copies":2}`},
+		{PortResult{Port: 7, Error: net.ErrClosed}, `{"port":7,"sent":false,"copies":0,"error":"use of closed network connection"}`},
+	}
+
+	for _, tt := range tests {
+		data, err := json.Marshal(tt.result)
+		if err != nil {
+			t.Fatalf("Marshal() error = %v", err)
+		}
+		if string(data) != tt.want {
+			t.Errorf("Marshal() = %s, want %s", data, tt.want)
+		}
+	}
+}
+
+func TestSendToBroadcastAddress(t *testing.T) {
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() error = %v", err)
+	}
+	defer listener.Close()
+
+	// The address replaces every broadcast mode's own
+	for _, mode := range []string{BroadcastLimited, BroadcastAll} {
+		opts := SendOptions{
+			Port:             listener.LocalAddr().(*net.UDPAddr).Port,
+			Broadcast:        mode,
+			BroadcastAddress: "127.0.0.1",
+		}
+		if err := SendWakeOnLANWith("AA:BB:CC:DD:EE:FF", opts); err != nil {
+			t.Fatalf("SendWakeOnLANWith(%s) error = %v", mode, err)
+		}
+
+		buffer := make([]byte, 256)
+		listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+		if _, _, err := listener.ReadFromUDP(buffer); err != nil {
+			t.Fatalf("%s: packet not received at broadcast address: %v", mode, err)
+		}
+	}
+}
+
+func TestParseBroadcastAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    string
+		wantErr bool
+	}{
+		{"192.168.20.255", "192.168.20.255", false},
+		{" 10.0.0.255 ", "10.0.0.255", false},
+		{"0.0.0.0", "", true},
+		{"ff02::1", "", true},
+		{"lan.example", "", true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseBroadcastAddress(tt.address)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseBroadcastAddress(%q) error = %v, wantErr %v", tt.address, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseBroadcastAddress(%q) = %q, want %q", tt.address, got, tt.want)
+		}
+	}
+}
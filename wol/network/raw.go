@@ -0,0 +1,123 @@
+package wol_network
+
+import (
+	"fmt"
+	"net"
+	wol_packet "wol-server/wol/packet"
+)
+
+// EtherTypeWoL is the EtherType of a magic packet sent directly in an
+// Ethernet frame rather than in a UDP datagram.
+const EtherTypeWoL = 0x0842
+
+// minFrameSize is the minimum Ethernet frame length without the FCS.
+const minFrameSize = 60
+
+// etherTypeVLAN is the TPID of an 802.1Q VLAN tag, which grows the header,
+// and the minimum frame size, by 4 bytes.
+const (
+	etherTypeVLAN = 0x8100
+	vlanTagSize   = 4
+	maxVLANID     = 4094
+)
+
+var broadcastMAC = net.HardwareAddr{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+// BuildEthernetFrame wraps payload in an Ethernet II frame with EtherType
+// 0x0842, padded to the minimum frame size.
+func BuildEthernetFrame(dst, src net.HardwareAddr, payload []byte) []byte {
+	return BuildVLANFrame(dst, src, 0, payload)
+}
+
+// BuildVLANFrame is BuildEthernetFrame with an 802.1Q tag for vlan, so a
+// frame sent on a trunk port reaches hosts on that VLAN; vlan 0 leaves the
+// frame untagged.
+func BuildVLANFrame(dst, src net.HardwareAddr, vlan int, payload []byte) []byte {
+	header, minSize := 14, minFrameSize
+	if vlan != 0 {
+		header += vlanTagSize
+		minSize += vlanTagSize
+	}
+
+	frame := make([]byte, max(header+len(payload), minSize))
+	copy(frame[0:6], dst)
+	copy(frame[6:12], src)
+	off := 12
+	if vlan != 0 {
+		frame[12] = etherTypeVLAN >> 8
+		frame[13] = etherTypeVLAN & 0xFF
+		frame[14] = byte(vlan>>8) & 0x0F
+		frame[15] = byte(vlan)
+		off += vlanTagSize
+	}
+	frame[off] = EtherTypeWoL >> 8
+	frame[off+1] = EtherTypeWoL & 0xFF
+	copy(frame[header:], payload)
+	return frame
+}
+
+// ValidateVLAN checks an 802.1Q VLAN ID; 0 means untagged.
+func ValidateVLAN(vlan int) error {
+	if vlan < 0 || vlan > maxVLANID {
+		return fmt.Errorf("invalid VLAN ID %d (expected 1-%d)", vlan, maxVLANID)
+	}
+	return nil
+}
+
+// SendWakeOnLANRaw broadcasts the magic packet as a raw Ethernet frame on
+// iface, or on the interface of the default route when iface is empty,
+// tagged for vlan unless it is 0. Some firmware only wakes for this
+// variant. It needs root (CAP_NET_RAW).
+func SendWakeOnLANRaw(mac, iface string, vlan int, opts wol_packet.PacketOptions) error {
+	logger := getLogger()
+
+	if err := ValidateVLAN(vlan); err != nil {
+		return err
+	}
+
+	logger.Info("Initiating raw Ethernet Wake-on-LAN for MAC=%s", mac)
+
+	packet, err := wol_packet.BuildMagicPacketOpts(mac, opts)
+	if err != nil {
+		return fmt.Errorf("failed to build magic packet: %w", err)
+	}
+
+	ifi, err := rawInterface(iface)
+	if err != nil {
+		return err
+	}
+
+	frame := BuildVLANFrame(broadcastMAC, ifi.HardwareAddr, vlan, packet)
+	if vlan != 0 {
+		logger.Debug("Sending %d byte Ethernet frame on %s, VLAN %d", len(frame), ifi.Name, vlan)
+	} else {
+		logger.Debug("Sending %d byte Ethernet frame on %s", len(frame), ifi.Name)
+	}
+
+	if err := sendRawFrame(ifi, frame); err != nil {
+		logger.LogWakeAttempt(mac, 0, false, err)
+		return fmt.Errorf("failed to send Ethernet frame on %s: %w", ifi.Name, err)
+	}
+
+	logger.LogWakeAttempt(mac, 0, true, nil)
+	return nil
+}
+
+func rawInterface(name string) (*net.Interface, error) {
+	if name == "" {
+		info, err := getNetworkInfo()
+		if err != nil || info.InterfaceName == "" {
+			return nil, fmt.Errorf("could not determine the default interface, name one explicitly")
+		}
+		name = info.InterfaceName
+	}
+
+	ifi, err := net.InterfaceByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown interface %s: %w", name, err)
+	}
+	if len(ifi.HardwareAddr) != 6 {
+		return nil, fmt.Errorf("interface %s has no Ethernet address", name)
+	}
+	return ifi, nil
+}
@@ -0,0 +1,30 @@
+//go:build linux
+
+package wol_network
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+)
+
+func htons(v uint16) uint16 {
+	return v<<8 | v>>8
+}
+
+func sendRawFrame(ifi *net.Interface, frame []byte) error {
+	fd, err := syscall.Socket(syscall.AF_PACKET, syscall.SOCK_RAW, int(htons(EtherTypeWoL)))
+	if err != nil {
+		return fmt.Errorf("failed to open packet socket (needs root or CAP_NET_RAW): %w", err)
+	}
+	defer syscall.Close(fd)
+
+	addr := &syscall.SockaddrLinklayer{
+		Protocol: htons(EtherTypeWoL),
+		Ifindex:  ifi.Index,
+		Halen:    6,
+	}
+	copy(addr.Addr[:], frame[0:6])
+
+	return syscall.Sendto(fd, frame, 0, addr)
+}
@@ -0,0 +1,12 @@
+//go:build !linux
+
+package wol_network
+
+import (
+	"fmt"
+	"net"
+)
+
+func sendRawFrame(ifi *net.Interface, frame []byte) error {
+	return fmt.Errorf("raw Ethernet frames are only supported on Linux")
+}
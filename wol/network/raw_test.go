@@ -0,0 +1,106 @@
+package wol_network
+
+import (
+	"bytes"
+	"net"
+	"testing"
+	wol_packet "wol-server/wol/packet"
+)
+
+func TestBuildEthernetFrame(t *testing.T) {
+	src := net.HardwareAddr{0x02, 0x00, 0x5E, 0x00, 0x53, 0x01}
+
+	tests := []struct {
+		name    string
+		payload []byte
+		wantLen int
+	}{
+		{"magic packet", mustMagicPacket(t, wol_packet.PacketOptions{}), 116},
+		{"short payload is padded", []byte{1, 2, 3}, minFrameSize},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frame := BuildEthernetFrame(broadcastMAC, src, tt.payload)
+
+			if len(frame) != tt.wantLen {
+				t.Errorf("len = %d, want %d", len(frame), tt.wantLen)
+			}
+			if !bytes.Equal(frame[0:6], broadcastMAC) || !bytes.Equal(frame[6:12], src) {
+				t.Errorf("addresses = % X, want broadcast and % X", frame[0:12], src)
+			}
+			if frame[12] != 0x08 || frame[13] != 0x42 {
+				t.Errorf("EtherType = %02X%02X, want 0842", frame[12], frame[13])
+			}
+			if !bytes.Equal(frame[14:14+len(tt.payload)], tt.payload) {
+				t.Error("payload not copied after the header")
+			}
+		})
+	}
+}
+
+func TestBuildVLANFrame(t *testing.T) {
+	src := net.HardwareAddr{0x02, 0x00, 0x5E, 0x00, 0x53, 0x01}
+	payload := mustMagicPacket(t, wol_packet.PacketOptions{})
+
+	frame := BuildVLANFrame(broadcastMAC, src, 42, payload)
+	if len(frame) != 120 {
+		t.Errorf("len = %d, want 120", len(frame))
+	}
+	if !bytes.Equal(frame[12:18], []byte{0x81, 0x00, 0x00, 42, 0x08, 0x42}) {
+		t.Errorf("tag and EtherType = % X, want 81 00 00 2A 08 42", frame[12:18])
+	}
+	if !bytes.Equal(frame[18:], payload) {
+		t.Error("payload not copied after the tag")
+	}
+
+	if short := BuildVLANFrame(broadcastMAC, src, 4094, []byte{1}); len(short) != minFrameSize+vlanTagSize || short[14] != 0x0F || short[15] != 0xFE {
+		t.Errorf("short tagged frame = % X", short[:18])
+	}
+	if untagged := BuildVLANFrame(broadcastMAC, src, 0, payload); !bytes.Equal(untagged, BuildEthernetFrame(broadcastMAC, src, payload)) {
+		t.Error("VLAN 0 frame differs from untagged frame")
+	}
+}
+
+func TestValidateVLAN(t *testing.T) {
+	for _, vlan := range []int{0, 1, 100, 4094} {
+		if err := ValidateVLAN(vlan); err != nil {
+			t.Errorf("ValidateVLAN(%d) error = %v", vlan, err)
+		}
+	}
+	for _, vlan := range []int{-1, 4095, 5000} {
+		if err := ValidateVLAN(vlan); err == nil {
+			t.Errorf("ValidateVLAN(%d) expected error", vlan)
+		}
+	}
+}
+
+func TestRawInterface(t *testing.T) {
+	if _, err := rawInterface("does-not-exist0"); err == nil {
+		t.Error("rawInterface() expected error for unknown interface")
+	}
+	if _, err := rawInterface(loopbackInterface(t)); err == nil {
+		t.Error("rawInterface() expected error for interface without an Ethernet address")
+	}
+}
+
+func mustMagicPacket(t *testing.T, opts wol_packet.PacketOptions) []byte {
+	t.Helper()
+	packet, err := wol_packet.BuildMagicPacketOpts("AA:BB:CC:DD:EE:FF", opts)
+	if err != nil {
+		t.Fatalf("BuildMagicPacketOpts() error = %v", err)
+	}
+	return packet
+}
+
+func TestSendOptions_Raw(t *testing.T) {
+	// An invalid VLAN fails before any socket is opened, so this shows the
+	// raw path was taken without needing root
+	opts := SendOptions{Raw: true, VLAN: 5000}
+	if err := SendWakeOnLANWith("AA:BB:CC:DD:EE:FF", opts); err == nil {
+		t.Error("SendWakeOnLANWith() sent over UDP instead of a raw frame")
+	}
+	if _, err := SendWakeOnLANWithVerification("AA:BB:CC:DD:EE:FF", VerificationConfig{SendOptions: opts}); err == nil {
+		t.Error("SendWakeOnLANWithVerification() sent over UDP instead of a raw frame")
+	}
+}
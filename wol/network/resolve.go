@@ -0,0 +1,62 @@
+package wol_network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+	wol_mdns "wol-server/wol/mdns"
+)
+
+// DefaultResolveTimeout bounds each lookup of a device host name.
+const DefaultResolveTimeout = 2 * time.Second
+
+// ResolveHost returns host as an IP address. A device's IP address may be
+// a host name, which keeps working as DHCP hands out new addresses: it is
+// looked up in DNS and, for single-label and .local names, over mDNS,
+// preferring IPv4. Addresses and empty strings are returned unchanged.
+func ResolveHost(host string, timeout time.Duration) (string, error) {
+	host = strings.TrimSpace(host)
+	if host == "" || net.ParseIP(host) != nil {
+		return host, nil
+	}
+	if timeout <= 0 {
+		timeout = DefaultResolveTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	cancel()
+	if err == nil && len(addrs) > 0 {
+		ip := preferIPv4(addrs)
+		getLogger().Debug("Resolved %s to %s", host, ip)
+		return ip.String(), nil
+	}
+
+	name := strings.ToLower(strings.TrimSuffix(host, "."))
+	if !strings.Contains(name, ".") || strings.HasSuffix(name, ".local") {
+		ip, mdnsErr := wol_mdns.LookupHost(name, timeout)
+		if mdnsErr == nil {
+			getLogger().Debug("Resolved %s to %s over mDNS", host, ip)
+			return ip.String(), nil
+		}
+		if err == nil {
+			err = mdnsErr
+		}
+	}
+
+	if err == nil {
+		err = fmt.Errorf("no addresses")
+	}
+	return "", fmt.Errorf("failed to resolve %s: %w", host, err)
+}
+
+func preferIPv4(addrs []net.IPAddr) net.IP {
+	for _, addr := range addrs {
+		if addr.IP.To4() != nil {
+			return addr.IP
+		}
+	}
+	return addrs[0].IP
+}
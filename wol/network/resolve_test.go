@@ -0,0 +1,43 @@
+package wol_network
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestResolveHost(t *testing.T) {
+	tests := []struct {
+		host    string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"192.168.1.20", "192.168.1.20", false},
+		{"fe80::1", "fe80::1", false},
+		{"localhost", "127.0.0.1", false},
+		{"does-not-exist.invalid", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.host, func(t *testing.T) {
+			got, err := ResolveHost(tt.host, 500*time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveHost() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ResolveHost() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreferIPv4(t *testing.T) {
+	addrs := []net.IPAddr{{IP: net.ParseIP("::1")}, {IP: net.ParseIP("127.0.0.1")}}
+	if ip := preferIPv4(addrs); !ip.Equal(net.IPv4(127, 0, 0, 1)) {
+		t.Errorf("preferIPv4() = %s, want 127.0.0.1", ip)
+	}
+	if ip := preferIPv4(addrs[:1]); !ip.Equal(net.IPv6loopback) {
+		t.Errorf("preferIPv4() = %s, want ::1", ip)
+	}
+}
@@ -0,0 +1,38 @@
+package wol_network
+
+import "time"
+
+const (
+	DefaultRetryInterval = 500 * time.Millisecond
+	DefaultRetryBackoff  = 2.0
+)
+
+// RetryConfig resends a wake packet whose send failed, e.g. because the
+// network was briefly unreachable. Interval is multiplied by Backoff after
+// every attempt; a Backoff below 1 keeps it constant.
+type RetryConfig struct {
+	Count    int
+	Interval time.Duration
+	Backoff  float64
+}
+
+// Do calls send until it succeeds or Count retries are used up, returning
+// the last error.
+func (r RetryConfig) Do(send func() error) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultRetryInterval
+	}
+
+	err := send()
+	for attempt := 1; err != nil && attempt <= r.Count; attempt++ {
+		getLogger().Warn("Send failed, retry %d/%d in %v: %v", attempt, r.Count, interval, err)
+		time.Sleep(interval)
+
+		err = send()
+		if r.Backoff > 1 {
+			interval = time.Duration(float64(interval) * r.Backoff)
+		}
+	}
+	return err
+}
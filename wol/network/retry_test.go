@@ -0,0 +1,55 @@
+package wol_network
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestRetryConfig_Do(t *testing.T) {
+	tests := []struct {
+		name         string
+		retry        RetryConfig
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"no retries, success", RetryConfig{}, 0, 1, false},
+		{"no retries, failure", RetryConfig{}, 1, 1, true},
+		{"succeeds on retry", RetryConfig{Count: 3, Interval: time.Millisecond}, 2, 3, false},
+		{"retries exhausted", RetryConfig{Count: 2, Interval: time.Millisecond}, 5, 3, true},
+		{"with backoff", RetryConfig{Count: 3, Interval: time.Millisecond, Backoff: 2}, 3, 4, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := tt.retry.Do(func() error {
+				attempts++
+				if attempts <= tt.failures {
+					return fmt.Errorf("attempt %d failed", attempts)
+				}
+				return nil
+			})
+
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Do() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
+
+func TestRetryConfig_Backoff(t *testing.T) {
+	start := time.Now()
+	RetryConfig{Count: 3, Interval: 10 * time.Millisecond, Backoff: 2}.Do(func() error {
+		return fmt.Errorf("unreachable")
+	})
+
+	// 10 + 20 + 40 ms
+	if elapsed := time.Since(start); elapsed < 70*time.Millisecond {
+		t.Errorf("retries took %v, want at least 70ms with backoff", elapsed)
+	}
+}
@@ -0,0 +1,115 @@
+package wol_network
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	procNetRoute = "/proc/net/route"
+	resolvConf   = "/etc/resolv.conf"
+)
+
+// defaultRoute is the interface and gateway of the IPv4 default route; the
+// gateway is empty for an on-link route.
+type defaultRoute struct {
+	Interface string
+	Gateway   string
+}
+
+// readDefaultRoute returns the IPv4 default route from the Linux routing
+// table.
+func readDefaultRoute() (defaultRoute, error) {
+	file, err := os.Open(procNetRoute)
+	if err != nil {
+		return defaultRoute{}, err
+	}
+	defer file.Close()
+
+	return parseProcNetRoute(file)
+}
+
+// parseProcNetRoute finds the default route with the lowest metric in the
+// Linux /proc/net/route format:
+//
+//	Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask	...
+//	eth0	00000000	0101A8C0	0003	0	0	100	00000000	...
+func parseProcNetRoute(r io.Reader) (defaultRoute, error) {
+	const flagUp = 0x1
+
+	var best defaultRoute
+	bestMetric := -1
+
+	scanner := bufio.NewScanner(r)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&flagUp == 0 {
+			continue
+		}
+		metric, err := strconv.Atoi(fields[6])
+		if err != nil {
+			continue
+		}
+
+		if bestMetric < 0 || metric < bestMetric {
+			best = defaultRoute{Interface: fields[0], Gateway: parseRouteAddr(fields[2])}
+			bestMetric = metric
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return defaultRoute{}, err
+	}
+
+	if best.Interface == "" {
+		return defaultRoute{}, fmt.Errorf("no default route")
+	}
+	return best, nil
+}
+
+// parseRouteAddr decodes an address from /proc/net/route, hex in host
+// (little-endian) byte order, or returns "" for 0.0.0.0.
+func parseRouteAddr(hex string) string {
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil || v == 0 {
+		return ""
+	}
+	ip := make(net.IP, 4)
+	binary.LittleEndian.PutUint32(ip, uint32(v))
+	return ip.String()
+}
+
+// dnsServers returns the name servers in /etc/resolv.conf, or nil where
+// there is none.
+func dnsServers() []string {
+	file, err := os.Open(resolvConf)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+
+	return parseResolvConf(file)
+}
+
+func parseResolvConf(r io.Reader) []string {
+	var servers []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			servers = append(servers, fields[1])
+		}
+	}
+	return servers
+}
@@ -0,0 +1,98 @@
+package wol_network
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestParseProcNetRoute(t *testing.T) {
+	const header = "Iface\tDestination\tGateway \tFlags\tRefCnt\tUse\tMetric\tMask\t\tMTU\tWindow\tIRTT\n"
+
+	tests := []struct {
+		name    string
+		routes  string
+		want    defaultRoute
+		wantErr bool
+	}{
+		{
+			"single default route",
+			"eth0\t00000000\t0101A8C0\t0003\t0\t0\t100\t00000000\t0\t0\t0\n" +
+				"eth0\t0001A8C0\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n",
+			defaultRoute{"eth0", "192.168.1.1"}, false,
+		},
+		{
+			"lowest metric wins",
+			"wlan0\t00000000\t0101A8C0\t0003\t0\t0\t600\t00000000\t0\t0\t0\n" +
+				"eth0\t00000000\t0100000A\t0003\t0\t0\t100\t00000000\t0\t0\t0\n",
+			defaultRoute{"eth0", "10.0.0.1"}, false,
+		},
+		{
+			"on-link default route",
+			"ppp0\t00000000\t00000000\t0001\t0\t0\t0\t00000000\t0\t0\t0\n",
+			defaultRoute{"ppp0", ""}, false,
+		},
+		{
+			"route that is down",
+			"eth0\t00000000\t0101A8C0\t0002\t0\t0\t100\t00000000\t0\t0\t0\n",
+			defaultRoute{}, true,
+		},
+		{
+			"air-gapped LAN",
+			"eth0\t0001A8C0\t00000000\t0001\t0\t0\t100\t00FFFFFF\t0\t0\t0\n",
+			defaultRoute{}, true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseProcNetRoute(strings.NewReader(header + tt.routes))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseProcNetRoute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseProcNetRoute() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseResolvConf(t *testing.T) {
+	conf := "# generated by resolvconf\n" +
+		"search home.lan\n" +
+		"nameserver 192.168.1.1\n" +
+		"nameserver\t2001:db8::53\n" +
+		"options edns0\n"
+
+	got := parseResolvConf(strings.NewReader(conf))
+	want := []string{"192.168.1.1", "2001:db8::53"}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseResolvConf() = %v, want %v", got, want)
+	}
+}
+
+func TestNetworkInfoFor(t *testing.T) {
+	iface := InterfaceInfo{
+		Name: "eth0",
+		MAC:  "AA:BB:CC:DD:EE:FF",
+		MTU:  1500,
+		Addresses: []InterfaceAddress{
+			{IP: "fe80::1", Subnet: "fe80::/64"},
+			{IP: "192.168.1.2", Subnet: "192.168.1.0/24", Broadcast: "192.168.1.255"},
+			{IP: "10.0.0.2", Subnet: "10.0.0.0/8", Broadcast: "10.255.255.255"},
+		},
+	}
+
+	info, ok := networkInfoFor(iface, "")
+	if !ok || info.LocalIP != "192.168.1.2" || info.BroadcastIP != "192.168.1.255" || info.InterfaceName != "eth0" || info.MTU != 1500 {
+		t.Errorf("networkInfoFor() = %+v, %v, want the first IPv4 address", info, ok)
+	}
+
+	if info, ok := networkInfoFor(iface, "10.0.0.2"); !ok || info.BroadcastIP != "10.255.255.255" {
+		t.Errorf("networkInfoFor(10.0.0.2) = %+v, %v", info, ok)
+	}
+
+	if _, ok := networkInfoFor(InterfaceInfo{Name: "lo6"}, ""); ok {
+		t.Error("networkInfoFor() accepted an interface without IPv4")
+	}
+}
@@ -0,0 +1,137 @@
+package wol_network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Sender sends wake packets through sockets it keeps open, one per
+// interface and source address, instead of opening a socket per packet.
+// Use one for bulk wakes and Close it when done. It is safe for concurrent
+// use.
+type Sender struct {
+	mu     sync.Mutex
+	conns  map[string]*net.UDPConn
+	closed bool
+}
+
+func NewSender() *Sender {
+	return &Sender{conns: make(map[string]*net.UDPConn)}
+}
+
+// Wake is SendWakeOnLANWith through the sender's sockets.
+func (s *Sender) Wake(mac string, opts SendOptions) error {
+	opts.sender = s
+	return SendWakeOnLANWith(mac, opts)
+}
+
+// Send is SendMagicPacket through the sender's sockets.
+func (s *Sender) Send(packet []byte, opts SendOptions) error {
+	opts.sender = s
+	return SendMagicPacket(packet, opts)
+}
+
+func (s *Sender) sendTo(packet []byte, address, iface string, source *net.UDPAddr, timing *SendTiming) error {
+	logger := getLogger()
+
+	start := time.Now()
+	addr, err := net.ResolveUDPAddr("udp", address)
+	timing.resolved(start)
+	if err != nil {
+		return fmt.Errorf("failed to resolve UDP address %s: %w", address, err)
+	}
+
+	start = time.Now()
+	socket, err := socketFor(addr, iface, source)
+	if err != nil {
+		return err
+	}
+
+	key, conn, err := s.conn(addr, iface, socket)
+	timing.dialed(start)
+	if err != nil {
+		return err
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+	start = time.Now()
+	bytesWritten, err := conn.WriteToUDP(packet, addr)
+	timing.wrote(start)
+	if err != nil {
+		// The interface may have gone away; open a fresh socket next time
+		s.drop(key, conn)
+		logger.Error("Failed to send magic packet: %v", err)
+		return fmt.Errorf("failed to send magic packet: %w", err)
+	}
+	if bytesWritten != len(packet) {
+		return fmt.Errorf("incomplete packet sent: sent %d bytes, expected %d", bytesWritten, len(packet))
+	}
+
+	logger.Debug("Magic packet sent to %s: %d bytes", addr, bytesWritten)
+	return nil
+}
+
+// conn returns the open socket for sending to addr's address family from
+// iface and socket's local address, opening it the first time. Go enables
+// SO_BROADCAST on every UDP socket it creates, so this is also the only
+// time that is set.
+func (s *Sender) conn(addr *net.UDPAddr, iface string, socket sendSocket) (string, *net.UDPConn, error) {
+	network := "udp4"
+	if addr.IP.To4() == nil {
+		network = "udp6"
+	}
+	local := ""
+	if socket.local != nil {
+		local = socket.local.String()
+	}
+	key := network + "/" + iface + "/" + local
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return "", nil, fmt.Errorf("sender is closed")
+	}
+	if conn, ok := s.conns[key]; ok {
+		return key, conn, nil
+	}
+
+	config := net.ListenConfig{Control: socket.control}
+	packetConn, err := config.ListenPacket(context.Background(), network, local)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create UDP socket: %w", err)
+	}
+	conn := packetConn.(*net.UDPConn)
+	s.conns[key] = conn
+	getLogger().Debug("Opened UDP socket %s for %s", conn.LocalAddr(), key)
+	return key, conn, nil
+}
+
+func (s *Sender) drop(key string, conn *net.UDPConn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conns[key] == conn {
+		delete(s.conns, key)
+		conn.Close()
+	}
+}
+
+// Close closes every socket; the sender cannot be used afterwards.
+func (s *Sender) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var firstErr error
+	for key, conn := range s.conns {
+		if err := conn.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.conns, key)
+	}
+	s.closed = true
+	return firstErr
+}
@@ -0,0 +1,49 @@
+package wol_network
+
+import (
+	"net"
+	"testing"
+	"time"
+	wol_packet "wol-server/wol/packet"
+)
+
+func TestSender_ReusesSocket(t *testing.T) {
+	sink, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer sink.Close()
+	opts := SendOptions{Port: sink.LocalAddr().(*net.UDPAddr).Port, IPv6: true, IPv6Address: "::1"}
+
+	sender := NewSender()
+	macs := []string{"AA:BB:CC:DD:EE:01", "AA:BB:CC:DD:EE:02", "AA:BB:CC:DD:EE:03"}
+	for _, mac := range macs {
+		if err := sender.Wake(mac, opts); err != nil {
+			t.Fatalf("Wake(%s) error = %v", mac, err)
+		}
+	}
+
+	sourcePorts := make(map[int]bool)
+	buffer := make([]byte, 256)
+	for _, want := range macs {
+		sink.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, from, err := sink.ReadFromUDP(buffer)
+		if err != nil {
+			t.Fatalf("ReadFromUDP() error = %v", err)
+		}
+		if mac, _, err := wol_packet.ParseMagicPacket(buffer[:n]); err != nil || mac != want {
+			t.Errorf("received packet for %q (%v), want %s", mac, err, want)
+		}
+		sourcePorts[from.Port] = true
+	}
+	if len(sourcePorts) != 1 {
+		t.Errorf("packets came from %d source ports, want 1", len(sourcePorts))
+	}
+
+	if err := sender.Close(); err != nil {
+		t.Errorf("Close() error = %v", err)
+	}
+	if err := sender.Wake(macs[0], opts); err == nil {
+		t.Error("Wake() after Close() expected error")
+	}
+}
@@ -0,0 +1,58 @@
+package wol_network
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// SendTiming is how long the steps of a wake took, summed over every
+// packet it sent: resolving host names and addresses, opening sockets
+// and writing the packets. A slow Resolve points at DNS or mDNS, a slow
+// Dial at the interface or source address.
+type SendTiming struct {
+	Resolve time.Duration
+	Dial    time.Duration
+	Write   time.Duration
+}
+
+func (t SendTiming) Total() time.Duration {
+	return t.Resolve + t.Dial + t.Write
+}
+
+func (t SendTiming) String() string {
+	return fmt.Sprintf("resolve %v, dial %v, write %v", t.Resolve, t.Dial, t.Write)
+}
+
+// MarshalJSON reports the durations in milliseconds.
+func (t SendTiming) MarshalJSON() ([]byte, error) {
+	ms := func(d time.Duration) float64 {
+		return float64(d.Microseconds()) / 1000
+	}
+	return json.Marshal(map[string]float64{
+		"resolve_ms": ms(t.Resolve),
+		"dial_ms":    ms(t.Dial),
+		"write_ms":   ms(t.Write),
+		"total_ms":   ms(t.Total()),
+	})
+}
+
+// The recording methods do nothing on a nil SendTiming.
+
+func (t *SendTiming) resolved(start time.Time) {
+	if t != nil {
+		t.Resolve += time.Since(start)
+	}
+}
+
+func (t *SendTiming) dialed(start time.Time) {
+	if t != nil {
+		t.Dial += time.Since(start)
+	}
+}
+
+func (t *SendTiming) wrote(start time.Time) {
+	if t != nil {
+		t.Write += time.Since(start)
+	}
+}
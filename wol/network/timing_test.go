@@ -0,0 +1,53 @@
+package wol_network
+
+import (
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestSendTiming_Recorded(t *testing.T) {
+	listener, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatalf("ListenUDP() error = %v", err)
+	}
+	defer listener.Close()
+
+	var timing SendTiming
+	opts := SendOptions{WakeAddress: listener.LocalAddr().String(), Timing: &timing}
+	if err := SendWakeOnLANWith("AA:BB:CC:DD:EE:FF", opts); err != nil {
+		t.Fatalf("SendWakeOnLANWith() error = %v", err)
+	}
+
+	if timing.Dial <= 0 || timing.Write <= 0 {
+		t.Errorf("timing = %s, want dial and write recorded", timing)
+	}
+	if timing.Total() != timing.Resolve+timing.Dial+timing.Write {
+		t.Errorf("Total() = %v, want the sum of the steps", timing.Total())
+	}
+
+	// A nil SendTiming records nothing
+	var none *SendTiming
+	none.resolved(time.Now())
+}
+
+func TestSendTiming_MarshalJSON(t *testing.T) {
+	timing := SendTiming{Resolve: 1500 * time.Microsecond, Dial: 2 * time.Millisecond, Write: 250 * time.Microsecond}
+
+	data, err := json.Marshal(timing)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+	var got map[string]float64
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	want := map[string]float64{"resolve_ms": 1.5, "dial_ms": 2, "write_ms": 0.25, "total_ms": 3.75}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+}
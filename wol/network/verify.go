@@ -0,0 +1,403 @@
+package wol_network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+	wol_packet "wol-server/wol/packet"
+)
+
+// VerifyTarget describes the wake being verified.
+type VerifyTarget struct {
+	MAC  string
+	Port int
+	// IP is the device's address, needed by the checks that talk to the
+	// host itself (ARP, ICMP, TCP)
+	IP string
+}
+
+// Verifier checks one sign that a wake worked. Verify is called after the
+// packet was sent and should keep checking until it succeeds or ctx ends.
+type Verifier interface {
+	Name() string
+	Verify(ctx context.Context, target VerifyTarget) VerifierResult
+}
+
+// Preparer is implemented by verifiers that must be set up before the
+// packet is sent, such as a capture that has to be listening already.
+type Preparer interface {
+	Prepare(target VerifyTarget) error
+}
+
+type VerifierResult struct {
+	Name     string        `json:"name"`
+	Success  bool          `json:"success"`
+	Skipped  bool          `json:"skipped,omitempty"`
+	Details  string        `json:"details"`
+	Duration time.Duration `json:"duration"`
+}
+
+type pipelineStage struct {
+	verifier Verifier
+	timeout  time.Duration
+}
+
+// Pipeline runs a set of verifiers concurrently around a wake, each with its
+// own timeout.
+type Pipeline struct {
+	stages []pipelineStage
+}
+
+func NewPipeline() *Pipeline {
+	return &Pipeline{}
+}
+
+func (p *Pipeline) Add(verifier Verifier, timeout time.Duration) *Pipeline {
+	p.stages = append(p.stages, pipelineStage{verifier: verifier, timeout: timeout})
+	return p
+}
+
+func (p *Pipeline) Len() int {
+	return len(p.stages)
+}
+
+// Run prepares every verifier, calls send, then runs the verifiers
+// concurrently and collects their results in the order they were added.
+// A verifier that fails to prepare is reported as failed rather than
+// stopping the wake.
+func (p *Pipeline) Run(target VerifyTarget, send func() error) ([]VerifierResult, error) {
+	logger := getLogger()
+	results := make([]VerifierResult, len(p.stages))
+	prepared := make([]bool, len(p.stages))
+
+	for i, stage := range p.stages {
+		prepared[i] = true
+		if preparer, ok := stage.verifier.(Preparer); ok {
+			if err := preparer.Prepare(target); err != nil {
+				logger.Debug("Verification: %s could not start: %v", stage.verifier.Name(), err)
+				results[i] = VerifierResult{Name: stage.verifier.Name(), Details: err.Error()}
+				prepared[i] = false
+			}
+		}
+	}
+
+	if err := send(); err != nil {
+		// Let prepared verifiers release what they hold
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		for i, stage := range p.stages {
+			if prepared[i] {
+				stage.verifier.Verify(ctx, target)
+			}
+		}
+		return nil, err
+	}
+
+	var wg sync.WaitGroup
+	for i, stage := range p.stages {
+		if !prepared[i] {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, stage pipelineStage) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(context.Background(), stage.timeout)
+			defer cancel()
+
+			start := time.Now()
+			result := stage.verifier.Verify(ctx, target)
+			result.Name = stage.verifier.Name()
+			result.Duration = time.Since(start)
+			results[i] = result
+
+			logger.Debug("Verification: %s success=%v skipped=%v (%s) in %v", result.Name, result.Success, result.Skipped, result.Details, result.Duration)
+		}(i, stage)
+	}
+	wg.Wait()
+
+	return results, nil
+}
+
+func skipped(reason string) VerifierResult {
+	return VerifierResult{Skipped: true, Details: reason}
+}
+
+// retry calls check every interval until it succeeds or ctx ends.
+func retry(ctx context.Context, interval time.Duration, check func() bool) bool {
+	for {
+		if check() {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(interval):
+		}
+	}
+}
+
+// CaptureVerifier watches for the magic packet itself, confirming it left
+// the host. By default it listens on the wake port for the broadcast to
+// come back, which fails if another process owns the port; built with the
+// pcap tag it captures on Interface through libpcap instead.
+type CaptureVerifier struct {
+	Interface string
+	source    captureSource
+}
+
+// captureSource delivers datagrams or whole frames that may hold the
+// magic packet.
+type captureSource interface {
+	// Read blocks until data arrives or deadline passes; from describes
+	// where it was seen
+	Read(deadline time.Time) (data []byte, from string, err error)
+	Close() error
+}
+
+// openCapture is replaced by the libpcap backend in capture_pcap.go.
+var openCapture = openUDPCapture
+
+func (v *CaptureVerifier) Name() string { return "capture" }
+
+func (v *CaptureVerifier) Prepare(target VerifyTarget) error {
+	source, err := openCapture(v.Interface, target.Port)
+	if err != nil {
+		return err
+	}
+	v.source = source
+	return nil
+}
+
+func (v *CaptureVerifier) Verify(ctx context.Context, target VerifyTarget) VerifierResult {
+	defer v.source.Close()
+
+	for ctx.Err() == nil {
+		// Short reads so cancellation is noticed
+		data, from, err := v.source.Read(time.Now().Add(250 * time.Millisecond))
+		if err == nil && containsMagicPacket(data, target.MAC) {
+			return VerifierResult{Success: true, Details: fmt.Sprintf("Magic packet detected on network from %s", from)}
+		}
+	}
+
+	return VerifierResult{Details: "No magic packet detected during capture window"}
+}
+
+// containsMagicPacket reports whether a magic packet for mac starts
+// anywhere in data, which may be a whole frame with its headers.
+func containsMagicPacket(data []byte, mac string) bool {
+	for i := 0; i+102 <= len(data); i++ {
+		if data[i] == 0xFF && isMagicPacket(data[i:], mac) {
+			return true
+		}
+	}
+	return false
+}
+
+type udpCapture struct {
+	conn   *net.UDPConn
+	buffer []byte
+}
+
+func openUDPCapture(iface string, port int) (captureSource, error) {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{Port: port})
+	if err != nil {
+		return nil, fmt.Errorf("could not listen on port %d (port may be in use): %w", port, err)
+	}
+	return &udpCapture{conn: conn, buffer: make([]byte, 2048)}, nil
+}
+
+func (c *udpCapture) Read(deadline time.Time) ([]byte, string, error) {
+	c.conn.SetReadDeadline(deadline)
+	n, from, err := c.conn.ReadFromUDP(c.buffer)
+	if err != nil {
+		return nil, "", err
+	}
+	return c.buffer[:n], from.IP.String(), nil
+}
+
+func (c *udpCapture) Close() error {
+	return c.conn.Close()
+}
+
+// ARPVerifier waits for the device's IP to resolve to its MAC address.
+// Only meaningful for hosts whose neighbor entry had expired while asleep.
+type ARPVerifier struct{}
+
+func (ARPVerifier) Name() string { return "arp" }
+
+func (ARPVerifier) Verify(ctx context.Context, target VerifyTarget) VerifierResult {
+	if target.IP == "" {
+		return skipped("device has no IP address")
+	}
+
+	var mac string
+	ok := retry(ctx, time.Second, func() bool {
+		found, err := ResolveMAC(target.IP, 500*time.Millisecond)
+		mac = found
+		return err == nil && wol_packet.CleanMAC(found) == wol_packet.CleanMAC(target.MAC)
+	})
+	if ok {
+		return VerifierResult{Success: true, Details: fmt.Sprintf("%s answers ARP as %s", target.IP, mac)}
+	}
+	if mac != "" {
+		return VerifierResult{Details: fmt.Sprintf("%s resolves to %s, not the woken MAC", target.IP, mac)}
+	}
+	return VerifierResult{Details: fmt.Sprintf("%s did not answer ARP", target.IP)}
+}
+
+// ICMPVerifier pings the device. Raw ICMP sockets need root or
+// CAP_NET_RAW.
+type ICMPVerifier struct{}
+
+func (ICMPVerifier) Name() string { return "icmp" }
+
+func (ICMPVerifier) Verify(ctx context.Context, target VerifyTarget) VerifierResult {
+	ip := net.ParseIP(target.IP).To4()
+	if ip == nil {
+		return skipped("device has no IPv4 address")
+	}
+
+	conn, err := net.ListenPacket("ip4:icmp", "0.0.0.0")
+	if err != nil {
+		return skipped(fmt.Sprintf("cannot open ICMP socket: %v", err))
+	}
+	defer conn.Close()
+
+	id := os.Getpid() & 0xFFFF
+	seq := 0
+	ok := retry(ctx, time.Second, func() bool {
+		seq++
+		if _, err := conn.WriteTo(icmpEcho(id, seq), &net.IPAddr{IP: ip}); err != nil {
+			return false
+		}
+
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		buffer := make([]byte, 1500)
+		for {
+			n, from, err := conn.ReadFrom(buffer)
+			if err != nil {
+				return false
+			}
+			if isEchoReply(buffer[:n], id) && from.(*net.IPAddr).IP.Equal(ip) {
+				return true
+			}
+		}
+	})
+
+	if ok {
+		return VerifierResult{Success: true, Details: fmt.Sprintf("%s answers ping", target.IP)}
+	}
+	return VerifierResult{Details: fmt.Sprintf("%s does not answer ping", target.IP)}
+}
+
+// icmpEcho builds an ICMP echo request.
+func icmpEcho(id, seq int) []byte {
+	msg := []byte{8, 0, 0, 0, byte(id >> 8), byte(id), byte(seq >> 8), byte(seq), 'w', 'o', 'l'}
+	sum := icmpChecksum(msg)
+	msg[2], msg[3] = byte(sum>>8), byte(sum)
+	return msg
+}
+
+func icmpChecksum(msg []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(msg); i += 2 {
+		sum += uint32(msg[i])<<8 | uint32(msg[i+1])
+	}
+	if len(msg)%2 == 1 {
+		sum += uint32(msg[len(msg)-1]) << 8
+	}
+	for sum>>16 != 0 {
+		sum = sum&0xFFFF + sum>>16
+	}
+	return ^uint16(sum)
+}
+
+func isEchoReply(msg []byte, id int) bool {
+	return len(msg) >= 8 && msg[0] == 0 && int(msg[4])<<8|int(msg[5]) == id
+}
+
+// TCPVerifier waits for the device to accept a connection on any of
+// Ports. Unlike ICMP it needs no privileges.
+type TCPVerifier struct {
+	Ports []int
+}
+
+// DefaultTCPPorts are SSH, HTTP, HTTPS, RPC, SMB and RDP.
+var DefaultTCPPorts = []int{22, 80, 443, 135, 445, 3389}
+
+func (TCPVerifier) Name() string { return "tcp" }
+
+func (v TCPVerifier) Verify(ctx context.Context, target VerifyTarget) VerifierResult {
+	if target.IP == "" {
+		return skipped("device has no IP address")
+	}
+
+	ports := v.Ports
+	if len(ports) == 0 {
+		ports = DefaultTCPPorts
+	}
+
+	var open int
+	ok := retry(ctx, time.Second, func() bool {
+		for _, port := range ports {
+			dialer := net.Dialer{Timeout: 500 * time.Millisecond}
+			conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(target.IP, strconv.Itoa(port)))
+			if err == nil {
+				conn.Close()
+				open = port
+				return true
+			}
+		}
+		return false
+	})
+
+	if ok {
+		return VerifierResult{Success: true, Details: fmt.Sprintf("%s accepts connections on port %d", target.IP, open)}
+	}
+	return VerifierResult{Details: fmt.Sprintf("%s not reachable on ports %v", target.IP, ports)}
+}
+
+// AgentVerifier polls an HTTP endpoint on the woken host, such as an
+// agent's health check, until it answers with a 2xx status.
+type AgentVerifier struct {
+	URL string
+}
+
+func (AgentVerifier) Name() string { return "agent" }
+
+func (v AgentVerifier) Verify(ctx context.Context, target VerifyTarget) VerifierResult {
+	if v.URL == "" {
+		return skipped("no agent URL configured")
+	}
+
+	client := &http.Client{Timeout: 2 * time.Second}
+	var status string
+	ok := retry(ctx, 2*time.Second, func() bool {
+		req, err := http.NewRequestWithContext(ctx, "GET", v.URL, nil)
+		if err != nil {
+			return false
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return false
+		}
+		resp.Body.Close()
+		status = resp.Status
+		return resp.StatusCode >= 200 && resp.StatusCode < 300
+	})
+
+	if ok {
+		return VerifierResult{Success: true, Details: fmt.Sprintf("agent answered %s", status)}
+	}
+	if status != "" {
+		return VerifierResult{Details: fmt.Sprintf("agent answered %s", status)}
+	}
+	return VerifierResult{Details: "agent did not answer"}
+}
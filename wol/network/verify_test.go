@@ -0,0 +1,231 @@
+package wol_network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	wol_packet "wol-server/wol/packet"
+)
+
+type fakeVerifier struct {
+	name       string
+	delay      time.Duration
+	prepareErr error
+}
+
+func (v fakeVerifier) Name() string { return v.name }
+
+func (v fakeVerifier) Prepare(VerifyTarget) error { return v.prepareErr }
+
+func (v fakeVerifier) Verify(ctx context.Context, target VerifyTarget) VerifierResult {
+	select {
+	case <-time.After(v.delay):
+		return VerifierResult{Success: true, Details: "ok"}
+	case <-ctx.Done():
+		return VerifierResult{Details: "timed out"}
+	}
+}
+
+func TestPipeline_Run(t *testing.T) {
+	pipeline := NewPipeline().
+		Add(fakeVerifier{name: "slow", delay: 100 * time.Millisecond}, time.Second).
+		Add(fakeVerifier{name: "also-slow", delay: 100 * time.Millisecond}, time.Second).
+		Add(fakeVerifier{name: "too-slow", delay: time.Second}, 50*time.Millisecond).
+		Add(fakeVerifier{name: "broken", prepareErr: fmt.Errorf("no socket")}, time.Second)
+
+	sent := false
+	start := time.Now()
+	results, err := pipeline.Run(VerifyTarget{MAC: "AA:BB:CC:DD:EE:FF"}, func() error {
+		sent = true
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !sent {
+		t.Error("Run() did not send the packet")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Run() took %v, verifiers did not run concurrently", elapsed)
+	}
+
+	want := []struct {
+		name    string
+		success bool
+	}{
+		{"slow", true},
+		{"also-slow", true},
+		{"too-slow", false},
+		{"broken", false},
+	}
+	if len(results) != len(want) {
+		t.Fatalf("Run() returned %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		if results[i].Name != w.name || results[i].Success != w.success {
+			t.Errorf("result %d = %+v, want %s success=%v", i, results[i], w.name, w.success)
+		}
+	}
+}
+
+func TestPipeline_SendError(t *testing.T) {
+	pipeline := NewPipeline().Add(fakeVerifier{name: "slow", delay: time.Second}, time.Second)
+
+	start := time.Now()
+	_, err := pipeline.Run(VerifyTarget{}, func() error { return fmt.Errorf("network unreachable") })
+	if err == nil {
+		t.Fatal("Run() expected send error")
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Error("Run() waited for verifiers after a failed send")
+	}
+}
+
+func TestCaptureVerifier(t *testing.T) {
+	port := freeUDPPort(t)
+	verifier := &CaptureVerifier{}
+	target := VerifyTarget{MAC: "AA:BB:CC:DD:EE:FF", Port: port}
+
+	results, err := NewPipeline().Add(verifier, 2*time.Second).Run(target, func() error {
+		packet, _ := wol_packet.BuildMagicPacket(target.MAC)
+		return sendPacketTo(packet, fmt.Sprintf("127.0.0.1:%d", port), "", nil, nil)
+	})
+	if err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if !results[0].Success {
+		t.Errorf("capture result = %+v, want success", results[0])
+	}
+}
+
+func TestTCPVerifier(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	result := TCPVerifier{Ports: []int{port}}.Verify(ctx, VerifyTarget{IP: "127.0.0.1"})
+	if !result.Success {
+		t.Errorf("Verify() = %+v, want success", result)
+	}
+
+	result = TCPVerifier{}.Verify(ctx, VerifyTarget{})
+	if !result.Skipped {
+		t.Errorf("Verify() without IP = %+v, want skipped", result)
+	}
+}
+
+func TestVerificationTargetIP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name          string
+		targetIP      string
+		wantReachable bool
+	}{
+		{"device IP answers", "127.0.0.1", true},
+		{"no device IP", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := SendWakeOnLANWithVerification("AA:BB:CC:DD:EE:FF", VerificationConfig{
+				TargetIP:     tt.targetIP,
+				Verifiers:    []Verifier{TCPVerifier{Ports: []int{port}}},
+				CheckTimeout: 500 * time.Millisecond,
+			})
+			if err != nil {
+				t.Skipf("cannot send broadcast here: %v", err)
+			}
+			if result.TargetReachable != tt.wantReachable {
+				t.Errorf("TargetReachable = %v, want %v (%+v)", result.TargetReachable, tt.wantReachable, result.Checks)
+			}
+		})
+	}
+}
+
+func TestAgentVerifier(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	result := AgentVerifier{URL: server.URL}.Verify(ctx, VerifyTarget{})
+	if !result.Success || calls != 2 {
+		t.Errorf("Verify() = %+v after %d calls, want success after 2", result, calls)
+	}
+}
+
+func TestICMPEcho(t *testing.T) {
+	msg := icmpEcho(0x1234, 1)
+	if msg[0] != 8 || msg[4] != 0x12 || msg[5] != 0x34 {
+		t.Errorf("icmpEcho() = %x", msg)
+	}
+	// A message including its own checksum sums to zero
+	if sum := icmpChecksum(msg); sum != 0 {
+		t.Errorf("checksum of echo request = %#x, want 0", sum)
+	}
+
+	reply := append([]byte{0}, msg[1:]...)
+	if !isEchoReply(reply, 0x1234) || isEchoReply(reply, 0x4321) || isEchoReply(msg, 0x1234) {
+		t.Error("isEchoReply() matched the wrong messages")
+	}
+}
+
+func freeUDPPort(t *testing.T) int {
+	t.Helper()
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.LocalAddr().(*net.UDPAddr).Port
+}
+
+func TestContainsMagicPacket(t *testing.T) {
+	packet, _ := wol_packet.BuildMagicPacket("AA:BB:CC:DD:EE:FF")
+	frame := BuildEthernetFrame(broadcastMAC, net.HardwareAddr{2, 0, 0, 0, 0, 1}, packet)
+
+	tests := []struct {
+		name string
+		data []byte
+		mac  string
+		want bool
+	}{
+		{"bare packet", packet, "AA:BB:CC:DD:EE:FF", true},
+		{"inside a frame", frame, "aa-bb-cc-dd-ee-ff", true},
+		{"other MAC", frame, "11:22:33:44:55:66", false},
+		{"truncated", frame[:100], "AA:BB:CC:DD:EE:FF", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containsMagicPacket(tt.data, tt.mac); got != tt.want {
+				t.Errorf("containsMagicPacket() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,161 @@
+package wol_network
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// DefaultWaitInterval is how often WakeAndWait polls the device.
+const DefaultWaitInterval = 2 * time.Second
+
+// WaitOptions adjusts how WakeAndWaitWith sends the packet and polls.
+type WaitOptions struct {
+	Send SendOptions
+	// Checks poll the device; ping, ARP and TCP by default
+	Checks   []Verifier
+	Interval time.Duration
+	// Progress is called after every poll
+	Progress func(WaitProgress)
+}
+
+// WaitProgress reports one poll of a device that is being waited for.
+type WaitProgress struct {
+	Attempt int           `json:"attempt"`
+	Elapsed time.Duration `json:"elapsed"`
+	Online  bool          `json:"online"`
+	Details string        `json:"details"`
+}
+
+// WaitResult is the outcome of WakeAndWait. Check names the check that saw
+// the device come up.
+type WaitResult struct {
+	Online   bool          `json:"online"`
+	Elapsed  time.Duration `json:"elapsed"`
+	Attempts int           `json:"attempts"`
+	Check    string        `json:"check,omitempty"`
+	Details  string        `json:"details"`
+}
+
+// WakeAndWait sends a magic packet to mac and then polls ip until the host
+// responds or timeout expires. A device that stays offline is not an
+// error; check WaitResult.Online.
+func WakeAndWait(mac, ip string, timeout time.Duration) (*WaitResult, error) {
+	return WakeAndWaitWith(mac, ip, timeout, WaitOptions{})
+}
+
+func WakeAndWaitWith(mac, ip string, timeout time.Duration, opts WaitOptions) (*WaitResult, error) {
+	if ip == "" {
+		return nil, fmt.Errorf("an IP address is required to wait for the device")
+	}
+	if err := SendWakeOnLANWith(mac, opts.Send); err != nil {
+		return nil, err
+	}
+	return WaitForOnline(mac, ip, timeout, opts)
+}
+
+// WaitForOnline polls ip until the host with mac responds or timeout
+// expires, for a wake that was sent some other way.
+func WaitForOnline(mac, ip string, timeout time.Duration, opts WaitOptions) (*WaitResult, error) {
+	logger := getLogger()
+
+	if ip == "" {
+		return nil, fmt.Errorf("an IP address is required to wait for the device")
+	}
+
+	checks := opts.Checks
+	if len(checks) == 0 {
+		checks = []Verifier{ICMPVerifier{}, ARPVerifier{}, TCPVerifier{}}
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DefaultWaitInterval
+	}
+
+	start := time.Now()
+	deadline := start.Add(timeout)
+	target := VerifyTarget{MAC: mac, Port: opts.Send.Port}
+	result := &WaitResult{}
+
+	for {
+		result.Attempts++
+
+		next := time.Now().Add(interval)
+		var online VerifierResult
+		var check string
+		// A host name is looked up each round until it resolves, since a
+		// sleeping host does not answer mDNS
+		if target.IP == "" {
+			resolved, err := ResolveHost(ip, time.Until(minTime(next, deadline)))
+			if err != nil {
+				online.Details = err.Error()
+			}
+			target.IP = resolved
+		}
+		if target.IP != "" {
+			ctx, cancel := context.WithDeadline(context.Background(), minTime(next, deadline))
+			online, check = pollOnline(ctx, checks, target)
+			cancel()
+		}
+
+		result.Elapsed = time.Since(start)
+		result.Online = online.Success
+		result.Details = online.Details
+		if online.Success {
+			result.Check = check
+		}
+
+		logger.Debug("Wait: %s attempt %d online=%v (%s)", ip, result.Attempts, result.Online, result.Details)
+		if opts.Progress != nil {
+			opts.Progress(WaitProgress{
+				Attempt: result.Attempts,
+				Elapsed: result.Elapsed,
+				Online:  result.Online,
+				Details: result.Details,
+			})
+		}
+
+		if result.Online || !time.Now().Before(deadline) {
+			return result, nil
+		}
+		time.Sleep(time.Until(minTime(next, deadline)))
+	}
+}
+
+// pollOnline runs checks concurrently until one sees the device or ctx
+// ends, and returns the successful result, or the last failure.
+func pollOnline(ctx context.Context, checks []Verifier, target VerifyTarget) (VerifierResult, string) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type outcome struct {
+		result VerifierResult
+		name   string
+	}
+	outcomes := make(chan outcome, len(checks))
+	for _, check := range checks {
+		go func(check Verifier) {
+			outcomes <- outcome{check.Verify(ctx, target), check.Name()}
+		}(check)
+	}
+
+	last := VerifierResult{Details: fmt.Sprintf("%s is not responding", target.IP)}
+	for range checks {
+		o := <-outcomes
+		if o.result.Success {
+			cancel()
+			return o.result, o.name
+		}
+		if !o.result.Skipped {
+			last = o.result
+		}
+	}
+	return last, ""
+}
+
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,87 @@
+package wol_network
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+)
+
+// onlineAfter reports the device online from its nth Verify call on.
+type onlineAfter struct {
+	n     int
+	calls *int
+}
+
+func (onlineAfter) Name() string { return "fake" }
+
+func (v onlineAfter) Verify(ctx context.Context, target VerifyTarget) VerifierResult {
+	*v.calls++
+	if v.n > 0 && *v.calls >= v.n {
+		return VerifierResult{Success: true, Details: "up"}
+	}
+	return VerifierResult{Details: "down"}
+}
+
+func TestWakeAndWait(t *testing.T) {
+	sink, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer sink.Close()
+	send := SendOptions{Port: sink.LocalAddr().(*net.UDPAddr).Port, IPv6: true, IPv6Address: "::1"}
+
+	tcp, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer tcp.Close()
+	tcpPort := tcp.Addr().(*net.TCPAddr).Port
+
+	tests := []struct {
+		name         string
+		ip           string
+		check        func(calls *int) Verifier
+		wantOnline   bool
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"online on third poll", "192.0.2.10", func(calls *int) Verifier { return onlineAfter{3, calls} }, true, 3, false},
+		{"never online", "192.0.2.10", func(calls *int) Verifier { return onlineAfter{0, calls} }, false, 0, false},
+		{"tcp port open", "127.0.0.1", func(*int) Verifier { return TCPVerifier{Ports: []int{tcpPort}} }, true, 1, false},
+		{"no IP", "", func(calls *int) Verifier { return onlineAfter{1, calls} }, false, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			var progress []WaitProgress
+
+			result, err := WakeAndWaitWith("AA:BB:CC:DD:EE:FF", tt.ip, 200*time.Millisecond, WaitOptions{
+				Send:     send,
+				Checks:   []Verifier{tt.check(&calls)},
+				Interval: 20 * time.Millisecond,
+				Progress: func(p WaitProgress) { progress = append(progress, p) },
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("WakeAndWaitWith() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if result.Online != tt.wantOnline {
+				t.Errorf("Online = %v, want %v (%s)", result.Online, tt.wantOnline, result.Details)
+			}
+			if tt.wantAttempts > 0 && result.Attempts != tt.wantAttempts {
+				t.Errorf("Attempts = %d, want %d", result.Attempts, tt.wantAttempts)
+			}
+			if !tt.wantOnline && result.Attempts < 2 {
+				t.Errorf("Attempts = %d, want polling until the timeout", result.Attempts)
+			}
+			if len(progress) != result.Attempts {
+				t.Errorf("progress called %d times, want %d", len(progress), result.Attempts)
+			}
+		})
+	}
+}
@@ -1,20 +1,76 @@
 package wol_packet
 
 import (
+	"bytes"
+	"crypto/rand"
 	"encoding/hex"
 	"fmt"
+	"net"
 	"regexp"
 	"strings"
 )
 
 func CleanMAC(mac string) string {
 	return strings.ToUpper(
-		strings.ReplaceAll(
-			strings.ReplaceAll(mac, ":", ""),
-			"-", ""),
+		strings.NewReplacer(":", "", "-", "", ".", "").Replace(mac),
 	)
 }
 
+// MACStyle selects how FormatMAC writes an address.
+type MACStyle string
+
+const (
+	MACStyleColon  MACStyle = "colon"  // AA:BB:CC:DD:EE:FF
+	MACStyleHyphen MACStyle = "hyphen" // AA-BB-CC-DD-EE-FF
+	MACStyleDotted MACStyle = "dotted" // AABB.CCDD.EEFF
+	MACStyleBare   MACStyle = "bare"   // AABBCCDDEEFF
+)
+
+func ParseMACStyle(style string) (MACStyle, error) {
+	switch s := MACStyle(strings.ToLower(strings.TrimSpace(style))); s {
+	case MACStyleColon, MACStyleHyphen, MACStyleDotted, MACStyleBare:
+		return s, nil
+	case "":
+		return MACStyleColon, nil
+	default:
+		return "", fmt.Errorf("unknown MAC style '%s' (use colon, hyphen, dotted or bare)", style)
+	}
+}
+
+// FormatMAC validates mac and writes it upper-case in the given style; an
+// empty style means colons.
+func FormatMAC(mac string, style MACStyle) (string, error) {
+	if err := ValidateMAC(mac); err != nil {
+		return "", err
+	}
+	clean := CleanMAC(mac)
+
+	var groups []string
+	sep := ""
+	switch style {
+	case MACStyleColon, "":
+		groups, sep = splitEvery(clean, 2), ":"
+	case MACStyleHyphen:
+		groups, sep = splitEvery(clean, 2), "-"
+	case MACStyleDotted:
+		groups, sep = splitEvery(clean, 4), "."
+	case MACStyleBare:
+		return clean, nil
+	default:
+		return "", fmt.Errorf("unknown MAC style '%s'", style)
+	}
+
+	return strings.Join(groups, sep), nil
+}
+
+func splitEvery(s string, n int) []string {
+	var parts []string
+	for i := 0; i < len(s); i += n {
+		parts = append(parts, s[i:i+n])
+	}
+	return parts
+}
+
 func ValidateMAC(mac string) error {
 	cleanMAC := CleanMAC(mac)
 
@@ -30,32 +86,248 @@ func ValidateMAC(mac string) error {
 	return nil
 }
 
+// ValidateMACStrict is ValidateMAC that also rejects the broadcast address
+// and multicast addresses (odd first octet), which no NIC can be woken by.
+func ValidateMACStrict(mac string) error {
+	addr, err := ParseMAC(mac)
+	if err != nil {
+		return err
+	}
+
+	if bytes.Equal(addr, []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}) {
+		return fmt.Errorf("MAC address %s is the broadcast address, not a device", mac)
+	}
+	if addr[0]&0x01 != 0 {
+		return fmt.Errorf("MAC address %s is a multicast address, not a device (first octet %02X is odd)", mac, addr[0])
+	}
+
+	return nil
+}
+
+// GenerateTestMAC returns a random unicast, locally administered MAC
+// address, which cannot collide with a vendor-assigned one.
+func GenerateTestMAC() string {
+	addr := make(net.HardwareAddr, 6)
+	rand.Read(addr)
+	addr[0] = addr[0]&^0x01 | 0x02
+
+	return strings.ToUpper(addr.String())
+}
+
+// ParsePassword parses a SecureOn password, written either like a MAC
+// address (6 bytes, e.g. 00:11:22:33:44:55) or like an IPv4 address
+// (4 bytes, e.g. 192.168.1.1).
+func ParsePassword(password string) ([]byte, error) {
+	password = strings.TrimSpace(password)
+
+	if ip := net.ParseIP(password); ip != nil && ip.To4() != nil && strings.Count(password, ".") == 3 {
+		return []byte(ip.To4()), nil
+	}
+
+	clean := CleanMAC(password)
+	if len(clean) != 8 && len(clean) != 12 {
+		return nil, fmt.Errorf("SecureOn password must be 4 or 6 bytes, like 192.168.1.1 or 00:11:22:33:44:55")
+	}
+	decoded, err := hex.DecodeString(clean)
+	if err != nil {
+		return nil, fmt.Errorf("SecureOn password contains invalid characters: %s", password)
+	}
+	return decoded, nil
+}
+
+// PacketOptions adjusts the magic packet for NICs that need more than the
+// standard 102 bytes.
+type PacketOptions struct {
+	// Password is a 4 or 6 byte SecureOn password appended to the packet
+	Password []byte
+	// RepeatCount is how often the MAC is repeated; at least 16 (the default)
+	RepeatCount int
+	// Padding is the number of zero bytes appended after the password
+	Padding int
+}
+
+const (
+	DefaultRepeatCount = 16
+	// MaxPacketSize keeps the packet within a single Ethernet frame once
+	// IP and UDP headers are added
+	MaxPacketSize = 1472
+)
+
+func (opts PacketOptions) Validate() error {
+	if len(opts.Password) != 0 && len(opts.Password) != 4 && len(opts.Password) != 6 {
+		return fmt.Errorf("SecureOn password must be 4 or 6 bytes, got %d", len(opts.Password))
+	}
+	if opts.RepeatCount != 0 && opts.RepeatCount < DefaultRepeatCount {
+		return fmt.Errorf("repeat count must be at least %d, got %d", DefaultRepeatCount, opts.RepeatCount)
+	}
+	if opts.Padding < 0 {
+		return fmt.Errorf("padding must not be negative, got %d", opts.Padding)
+	}
+	if size := opts.Size(); size > MaxPacketSize {
+		return fmt.Errorf("packet of %d bytes exceeds the maximum of %d", size, MaxPacketSize)
+	}
+	return nil
+}
+
+// Size is the length of a packet built with these options.
+func (opts PacketOptions) Size() int {
+	repeats := opts.RepeatCount
+	if repeats == 0 {
+		repeats = DefaultRepeatCount
+	}
+	return 6 + repeats*6 + len(opts.Password) + opts.Padding
+}
+
 func BuildMagicPacket(mac string) ([]byte, error) {
+	return BuildMagicPacketOpts(mac, PacketOptions{})
+}
 
-	if err := ValidateMAC(mac); err != nil {
+func BuildMagicPacketOpts(mac string, opts PacketOptions) ([]byte, error) {
+	addr, err := ParseMAC(mac)
+	if err != nil {
 		return nil, err
 	}
+	return buildMagicPacket(addr, opts)
+}
+
+// BuildMagicPacketFromHardwareAddr builds a standard magic packet for addr.
+func BuildMagicPacketFromHardwareAddr(addr net.HardwareAddr) ([]byte, error) {
+	if len(addr) != 6 {
+		return nil, fmt.Errorf("MAC address must be exactly 6 bytes, got %d", len(addr))
+	}
+	return buildMagicPacket(addr, PacketOptions{})
+}
 
-	cleanMAC := CleanMAC(mac)
+// ParseMAC validates mac and returns it as a net.HardwareAddr.
+func ParseMAC(mac string) (net.HardwareAddr, error) {
+	if err := ValidateMAC(mac); err != nil {
+		return nil, err
+	}
 
-	macBytes, err := hex.DecodeString(cleanMAC)
+	macBytes, err := hex.DecodeString(CleanMAC(mac))
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode MAC address: %w", err)
 	}
 
-	if len(macBytes) != 6 {
-		return nil, fmt.Errorf("MAC address must be exactly 6 bytes, got %d", len(macBytes))
+	return net.HardwareAddr(macBytes), nil
+}
+
+func buildMagicPacket(macBytes net.HardwareAddr, opts PacketOptions) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	repeats := opts.RepeatCount
+	if repeats == 0 {
+		repeats = DefaultRepeatCount
 	}
 
-	packet := make([]byte, 102)
+	packet := make([]byte, opts.Size())
 
 	for i := 0; i < 6; i++ {
 		packet[i] = 0xFF
 	}
 
-	for i := 0; i < 16; i++ {
+	for i := 0; i < repeats; i++ {
 		copy(packet[6+i*6:6+(i+1)*6], macBytes)
 	}
 
+	copy(packet[6+repeats*6:], opts.Password)
+
 	return packet, nil
 }
+
+// ParseMagicPacket validates a magic packet, a 6-byte 0xFF synchronization
+// stream followed by 16 repetitions of the target MAC and an optional 4 or
+// 6 byte SecureOn password, and returns the MAC and password. Extra MAC
+// repetitions and padding, as BuildMagicPacketOpts can add, are accepted;
+// the bytes left after any extra repetitions are only taken as a password
+// when there are exactly 4 or 6 of them.
+func ParseMagicPacket(packet []byte) (string, []byte, error) {
+	if len(packet) < 102 || len(packet) > MaxPacketSize {
+		return "", nil, fmt.Errorf("invalid magic packet length: %d bytes (expected 102 to %d)", len(packet), MaxPacketSize)
+	}
+
+	for i := 0; i < 6; i++ {
+		if packet[i] != 0xFF {
+			return "", nil, fmt.Errorf("missing synchronization stream at byte %d", i)
+		}
+	}
+
+	mac := packet[6:12]
+	for i := 1; i < 16; i++ {
+		if !bytes.Equal(packet[6+i*6:12+i*6], mac) {
+			return "", nil, fmt.Errorf("MAC repetition %d does not match the first", i+1)
+		}
+	}
+
+	tail := packet[102:]
+	for len(tail) >= 6 && bytes.Equal(tail[:6], mac) {
+		tail = tail[6:]
+	}
+
+	var password []byte
+	if len(tail) == 4 || len(tail) == 6 {
+		password = append([]byte(nil), tail...)
+	}
+
+	return strings.ToUpper(net.HardwareAddr(mac).String()), password, nil
+}
+
+// DumpPacket renders packet as an annotated hex dump, one magic packet
+// section per line: the sync stream, each MAC repetition and any password
+// or padding. Anything else is dumped 16 bytes to a line.
+func DumpPacket(packet []byte) string {
+	var b strings.Builder
+	line := func(offset int, data []byte, note string) {
+		fmt.Fprintf(&b, "%04X  %-47s  %s\n", offset, hexBytes(data), note)
+	}
+
+	offset := 0
+	if len(packet) >= 12 && bytes.Equal(packet[:6], []byte{0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}) {
+		line(0, packet[:6], "sync stream")
+
+		mac := packet[6:12]
+		repeats := 0
+		for offset = 6; offset+6 <= len(packet) && bytes.Equal(packet[offset:offset+6], mac); offset += 6 {
+			repeats++
+		}
+		for i := 0; i < repeats; i++ {
+			line(6+i*6, mac, fmt.Sprintf("MAC %2d/%d  %s", i+1, repeats, strings.ToUpper(net.HardwareAddr(mac).String())))
+		}
+
+		// A password is 4 or 6 bytes and only zero padding may follow it
+		rest := packet[offset:]
+		for _, n := range []int{0, 6, 4} {
+			if len(rest) >= n && isZero(rest[n:]) {
+				if n > 0 {
+					line(offset, rest[:n], "SecureOn password")
+					offset += n
+				}
+				for ; offset < len(packet); offset += 16 {
+					line(offset, packet[offset:min(offset+16, len(packet))], "padding")
+				}
+				break
+			}
+		}
+	}
+
+	for ; offset < len(packet); offset += 16 {
+		line(offset, packet[offset:min(offset+16, len(packet))], "")
+	}
+
+	fmt.Fprintf(&b, "%d bytes", len(packet))
+	return b.String()
+}
+
+func hexBytes(data []byte) string {
+	parts := make([]string, len(data))
+	for i, c := range data {
+		parts[i] = fmt.Sprintf("%02X", c)
+	}
+	return strings.Join(parts, " ")
+}
+
+func isZero(data []byte) bool {
+	return bytes.Count(data, []byte{0}) == len(data)
+}
@@ -2,6 +2,8 @@ package wol_packet
 
 import (
 	"bytes"
+	"net"
+	"strings"
 	"testing"
 )
 
@@ -16,6 +18,7 @@ func TestValidateMAC(t *testing.T) {
 		{"valid lowercase", "aa:bb:cc:dd:ee:ff", false},
 		{"valid mixed case", "Aa:Bb:Cc:Dd:Ee:Ff", false},
 		{"valid no separators", "AABBCCDDEEFF", false},
+		{"valid dotted format", "aabb.ccdd.eeff", false},
 		{"invalid too short", "AA:BB:CC:DD:EE", true},
 		{"invalid too long", "AA:BB:CC:DD:EE:FF:00", true},
 		{"invalid characters", "GG:BB:CC:DD:EE:FF", true},
@@ -93,3 +96,287 @@ func TestBuildMagicPacketSpecificMAC(t *testing.T) {
 		}
 	}
 }
+
+func BenchmarkBuildMagicPacket(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := BuildMagicPacket("AA:BB:CC:DD:EE:FF"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseMagicPacket(t *testing.T) {
+	packet, _ := BuildMagicPacket("aa-bb-cc-dd-ee-ff")
+
+	corrupt := append([]byte{}, packet...)
+	corrupt[50] ^= 0x01
+
+	noSync := append([]byte{}, packet...)
+	noSync[3] = 0x00
+
+	tests := []struct {
+		name         string
+		packet       []byte
+		wantMAC      string
+		wantPassword []byte
+		wantErr      bool
+	}{
+		{"plain", packet, "AA:BB:CC:DD:EE:FF", nil, false},
+		{"4-byte password", append(append([]byte{}, packet...), 192, 168, 1, 1), "AA:BB:CC:DD:EE:FF", []byte{192, 168, 1, 1}, false},
+		{"6-byte password", append(append([]byte{}, packet...), 1, 2, 3, 4, 5, 6), "AA:BB:CC:DD:EE:FF", []byte{1, 2, 3, 4, 5, 6}, false},
+		{"padding", append(append([]byte{}, packet...), 0, 0, 0, 0, 0), "AA:BB:CC:DD:EE:FF", nil, false},
+		{"extra repetitions", append(append([]byte{}, packet...), packet[6:18]...), "AA:BB:CC:DD:EE:FF", nil, false},
+		{"extra repetitions and password", append(append(append([]byte{}, packet...), packet[6:12]...), 1, 2, 3, 4), "AA:BB:CC:DD:EE:FF", []byte{1, 2, 3, 4}, false},
+		{"too large", append(append([]byte{}, packet...), make([]byte, MaxPacketSize)...), "", nil, true},
+		{"truncated", packet[:101], "", nil, true},
+		{"missing sync stream", noSync, "", nil, true},
+		{"corrupt repetition", corrupt, "", nil, true},
+		{"empty", nil, "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mac, password, err := ParseMagicPacket(tt.packet)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMagicPacket() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if mac != tt.wantMAC {
+				t.Errorf("ParseMagicPacket() mac = %s, want %s", mac, tt.wantMAC)
+			}
+			if !bytes.Equal(password, tt.wantPassword) {
+				t.Errorf("ParseMagicPacket() password = %v, want %v", password, tt.wantPassword)
+			}
+		})
+	}
+}
+
+func TestBuildMagicPacketOpts(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     PacketOptions
+		wantLen  int
+		wantTail []byte
+		wantErr  bool
+	}{
+		{"defaults", PacketOptions{}, 102, nil, false},
+		{"password", PacketOptions{Password: []byte{1, 2, 3, 4}}, 106, []byte{1, 2, 3, 4}, false},
+		{"extra repetitions", PacketOptions{RepeatCount: 20}, 126, []byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}, false},
+		{"padding after password", PacketOptions{Password: []byte{1, 2, 3, 4, 5, 6}, Padding: 3}, 111, []byte{5, 6, 0, 0, 0}, false},
+		{"too few repetitions", PacketOptions{RepeatCount: 8}, 0, nil, true},
+		{"bad password length", PacketOptions{Password: []byte{1, 2, 3}}, 0, nil, true},
+		{"negative padding", PacketOptions{Padding: -1}, 0, nil, true},
+		{"too large", PacketOptions{Padding: MaxPacketSize}, 0, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet, err := BuildMagicPacketOpts("AA:BB:CC:DD:EE:FF", tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("BuildMagicPacketOpts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if len(packet) != tt.wantLen {
+				t.Errorf("len = %d, want %d", len(packet), tt.wantLen)
+			}
+			if tt.wantTail != nil && !bytes.HasSuffix(packet, tt.wantTail) {
+				t.Errorf("packet ends with %x, want %x", packet[len(packet)-len(tt.wantTail):], tt.wantTail)
+			}
+			if mac, _, err := ParseMagicPacket(packet); err != nil || mac != "AA:BB:CC:DD:EE:FF" {
+				t.Errorf("built packet does not parse: %v", err)
+			}
+		})
+	}
+}
+
+func TestDumpPacket(t *testing.T) {
+	tests := []struct {
+		name      string
+		opts      PacketOptions
+		raw       []byte
+		wantLines int
+		want      []string
+	}{
+		{"standard", PacketOptions{}, nil, 18, []string{"0000  FF FF FF FF FF FF", "sync stream", "MAC 16/16  AA:BB:CC:DD:EE:FF", "102 bytes"}},
+		{"password", PacketOptions{Password: []byte{1, 2, 3, 4}}, nil, 19, []string{"0066  01 02 03 04", "SecureOn password", "106 bytes"}},
+		{"extra repetitions", PacketOptions{RepeatCount: 20}, nil, 22, []string{"MAC 20/20"}},
+		{"password and padding", PacketOptions{Password: []byte{1, 2, 3, 4, 5, 6}, Padding: 20}, nil, 21, []string{"SecureOn password", "006C  00 00", "padding", "128 bytes"}},
+		{"not a magic packet", PacketOptions{}, []byte("hello, world"), 2, []string{"0000  68 65 6C 6C 6F", "12 bytes"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			packet := tt.raw
+			if packet == nil {
+				var err error
+				if packet, err = BuildMagicPacketOpts("AA:BB:CC:DD:EE:FF", tt.opts); err != nil {
+					t.Fatalf("BuildMagicPacketOpts() error = %v", err)
+				}
+			}
+
+			dump := DumpPacket(packet)
+			if lines := strings.Count(dump, "\n") + 1; lines != tt.wantLines {
+				t.Errorf("DumpPacket() has %d lines, want %d:\n%s", lines, tt.wantLines, dump)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(dump, want) {
+					t.Errorf("DumpPacket() missing %q:\n%s", want, dump)
+				}
+			}
+		})
+	}
+}
+
+func TestParseMAC(t *testing.T) {
+	tests := []struct {
+		name    string
+		mac     string
+		want    net.HardwareAddr
+		wantErr bool
+	}{
+		{"colons", "aa:bb:cc:dd:ee:ff", net.HardwareAddr{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}, false},
+		{"hyphens", "01-23-45-67-89-AB", net.HardwareAddr{0x01, 0x23, 0x45, 0x67, 0x89, 0xAB}, false},
+		{"bare", "0123456789ab", net.HardwareAddr{0x01, 0x23, 0x45, 0x67, 0x89, 0xAB}, false},
+		{"invalid", "GG:HH:II:JJ:KK:LL", nil, true},
+		{"too short", "AA:BB:CC", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMAC(tt.mac)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMAC() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("ParseMAC() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildMagicPacketFromHardwareAddr(t *testing.T) {
+	addr := net.HardwareAddr{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}
+
+	packet, err := BuildMagicPacketFromHardwareAddr(addr)
+	if err != nil {
+		t.Fatalf("BuildMagicPacketFromHardwareAddr() error = %v", err)
+	}
+
+	want, _ := BuildMagicPacket("AA:BB:CC:DD:EE:FF")
+	if !bytes.Equal(packet, want) {
+		t.Errorf("packet differs from BuildMagicPacket:\n%x\n%x", packet, want)
+	}
+
+	eui64 := net.HardwareAddr{0, 1, 2, 3, 4, 5, 6, 7}
+	if _, err := BuildMagicPacketFromHardwareAddr(eui64); err == nil {
+		t.Error("BuildMagicPacketFromHardwareAddr() expected error for 8-byte address")
+	}
+}
+
+func TestFormatMAC(t *testing.T) {
+	tests := []struct {
+		name    string
+		mac     string
+		style   MACStyle
+		want    string
+		wantErr bool
+	}{
+		{"colon", "aa-bb-cc-dd-ee-ff", MACStyleColon, "AA:BB:CC:DD:EE:FF", false},
+		{"default", "aabbccddeeff", "", "AA:BB:CC:DD:EE:FF", false},
+		{"hyphen", "AA:BB:CC:DD:EE:FF", MACStyleHyphen, "AA-BB-CC-DD-EE-FF", false},
+		{"dotted", "AA:BB:CC:DD:EE:FF", MACStyleDotted, "AABB.CCDD.EEFF", false},
+		{"bare", "aabb.ccdd.eeff", MACStyleBare, "AABBCCDDEEFF", false},
+		{"unknown style", "AA:BB:CC:DD:EE:FF", "cisco", "", true},
+		{"invalid MAC", "AA:BB:CC", MACStyleColon, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FormatMAC(tt.mac, tt.style)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("FormatMAC() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("FormatMAC() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateMACStrict(t *testing.T) {
+	tests := []struct {
+		name    string
+		mac     string
+		wantErr bool
+	}{
+		{"unicast", "AA:BB:CC:DD:EE:FF", false},
+		{"locally administered", "02:00:5E:00:53:01", false},
+		{"broadcast", "FF:FF:FF:FF:FF:FF", true},
+		{"IPv4 multicast", "01:00:5E:00:00:FB", true},
+		{"IPv6 multicast", "33:33:00:00:00:01", true},
+		{"invalid", "AA:BB:CC", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateMACStrict(tt.mac)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateMACStrict() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && ValidateMAC(tt.mac) != nil {
+				t.Error("ValidateMACStrict() accepted an address ValidateMAC rejects")
+			}
+		})
+	}
+}
+
+func TestGenerateTestMAC(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		mac := GenerateTestMAC()
+		if err := ValidateMACStrict(mac); err != nil {
+			t.Fatalf("GenerateTestMAC() = %s, invalid: %v", mac, err)
+		}
+
+		addr, _ := ParseMAC(mac)
+		if addr[0]&0x02 == 0 {
+			t.Errorf("GenerateTestMAC() = %s, not locally administered", mac)
+		}
+		seen[mac] = true
+	}
+
+	if len(seen) < 99 {
+		t.Errorf("GenerateTestMAC() produced only %d distinct addresses in 100 calls", len(seen))
+	}
+}
+
+func TestParsePassword(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     []byte
+		wantErr  bool
+	}{
+		{"MAC style", "00:11:22:33:44:55", []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55}, false},
+		{"bare hex", "AABBCCDDEEFF", []byte{0xAA, 0xBB, 0xCC, 0xDD, 0xEE, 0xFF}, false},
+		{"IPv4 style", "192.168.1.1", []byte{192, 168, 1, 1}, false},
+		{"4 bytes hex", "de:ad:be:ef", []byte{0xDE, 0xAD, 0xBE, 0xEF}, false},
+		{"wrong length", "00:11:22", nil, true},
+		{"invalid hex", "GG:11:22:33:44:55", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParsePassword(tt.password)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParsePassword() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("ParsePassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
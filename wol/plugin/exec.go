@@ -0,0 +1,247 @@
+package wol_plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+	wol_auth "wol-server/wol/auth"
+)
+
+// External plugins are executables that speak newline-delimited JSON over
+// stdin/stdout. The host writes one request per line:
+//
+//	{"id": 1, "method": "wake", "params": {...}}
+//
+// and the plugin answers each with exactly one line:
+//
+//	{"id": 1, "result": {...}}  or  {"id": 1, "error": "message"}
+//
+// The first request is always "handshake"; its result names the plugin and
+// lists its capabilities. Anything the plugin writes to stderr is ignored.
+
+const (
+	ProtocolVersion = 1
+
+	CapabilityNotifier      = "notifier"
+	CapabilityWakeTransport = "wake_transport"
+	CapabilityAuth          = "auth"
+
+	MethodHandshake    = "handshake"
+	MethodNotify       = "notify"
+	MethodWake         = "wake"
+	MethodAuthenticate = "authenticate"
+
+	DefaultCallTimeout = 10 * time.Second
+)
+
+type request struct {
+	ID     int         `json:"id"`
+	Method string      `json:"method"`
+	Params interface{} `json:"params,omitempty"`
+}
+
+type response struct {
+	ID     int             `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type Handshake struct {
+	Name            string   `json:"name"`
+	ProtocolVersion int      `json:"protocol_version"`
+	Capabilities    []string `json:"capabilities"`
+}
+
+type ExecPlugin struct {
+	path      string
+	handshake Handshake
+	timeout   time.Duration
+
+	mu     sync.Mutex
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	lines  chan []byte
+	nextID int
+	// dead is set once the plugin has exited or been stopped after a
+	// timeout; every later call fails with it straight away
+	dead error
+}
+
+func StartExecPlugin(path string, args ...string) (*ExecPlugin, error) {
+	cmd := exec.Command(path, args...)
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin stdin: %w", err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open plugin stdout: %w", err)
+	}
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin: %w", err)
+	}
+
+	plugin := &ExecPlugin{
+		path:    path,
+		timeout: DefaultCallTimeout,
+		cmd:     cmd,
+		stdin:   stdin,
+		lines:   make(chan []byte),
+	}
+	go plugin.readLines(stdout)
+
+	params := map[string]int{"protocol_version": ProtocolVersion}
+	if err := plugin.call(MethodHandshake, params, &plugin.handshake); err != nil {
+		plugin.Close()
+		return nil, fmt.Errorf("handshake failed: %w", err)
+	}
+
+	if plugin.handshake.ProtocolVersion != ProtocolVersion {
+		plugin.Close()
+		return nil, fmt.Errorf("unsupported protocol version %d (want %d)", plugin.handshake.ProtocolVersion, ProtocolVersion)
+	}
+
+	if plugin.handshake.Name == "" {
+		plugin.handshake.Name = filepath.Base(path)
+	}
+
+	return plugin, nil
+}
+
+func (p *ExecPlugin) Name() string {
+	return p.handshake.Name
+}
+
+func (p *ExecPlugin) Capabilities() []string {
+	return p.handshake.Capabilities
+}
+
+func (p *ExecPlugin) Notify(event Event) error {
+	return p.call(MethodNotify, event, nil)
+}
+
+func (p *ExecPlugin) Wake(req WakeRequest) error {
+	return p.call(MethodWake, req, nil)
+}
+
+// Authenticate implements wol_auth.Provider. A null result means the
+// plugin did not recognise any credentials on the request.
+func (p *ExecPlugin) Authenticate(r *http.Request) (*wol_auth.Identity, error) {
+	var identity *wol_auth.Identity
+	if err := p.call(MethodAuthenticate, newAuthRequest(r), &identity); err != nil {
+		return nil, err
+	}
+	if identity == nil {
+		return nil, wol_auth.ErrNoCredentials
+	}
+
+	if _, err := wol_auth.ParseRole(string(identity.Role)); err != nil {
+		return nil, fmt.Errorf("plugin returned %w", err)
+	}
+	identity.Provider = p.Name()
+	return identity, nil
+}
+
+func (p *ExecPlugin) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.stdin.Close()
+	p.dead = fmt.Errorf("plugin %s is closed", p.path)
+
+	done := make(chan error, 1)
+	go func() { done <- p.cmd.Wait() }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(2 * time.Second):
+		p.cmd.Process.Kill()
+		err = <-done
+	}
+
+	// Wait has closed stdout, so the reader stops after any line it
+	// was still holding
+	for range p.lines {
+	}
+	return err
+}
+
+// readLines is the only reader of the plugin's stdout. It runs for the
+// life of the process and closes p.lines when stdout reaches EOF.
+func (p *ExecPlugin) readLines(stdout io.Reader) {
+	defer close(p.lines)
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		p.lines <- append([]byte(nil), scanner.Bytes()...)
+	}
+}
+
+func (p *ExecPlugin) call(method string, params interface{}, result interface{}) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.dead != nil {
+		return p.dead
+	}
+
+	p.nextID++
+	id := p.nextID
+
+	data, err := json.Marshal(request{ID: id, Method: method, Params: params})
+	if err != nil {
+		return fmt.Errorf("failed to encode %s request: %w", method, err)
+	}
+
+	if _, err := p.stdin.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write to plugin: %w", err)
+	}
+
+	timer := time.NewTimer(p.timeout)
+	defer timer.Stop()
+
+	var line []byte
+	select {
+	case l, ok := <-p.lines:
+		if !ok {
+			p.dead = fmt.Errorf("plugin %s has exited", p.path)
+			return fmt.Errorf("plugin exited while handling %s", method)
+		}
+		line = l
+	case <-timer.C:
+		// A late answer would be read as the reply to the next request,
+		// so the plugin cannot be used again; stop it
+		p.cmd.Process.Kill()
+		p.dead = fmt.Errorf("plugin %s was stopped after timing out", p.path)
+		return fmt.Errorf("plugin timed out handling %s", method)
+	}
+
+	var resp response
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return fmt.Errorf("invalid plugin response: %w", err)
+	}
+	if resp.ID != id {
+		return fmt.Errorf("plugin response id %d does not match request id %d", resp.ID, id)
+	}
+	if resp.Error != "" {
+		return fmt.Errorf("%s", resp.Error)
+	}
+
+	if result != nil && len(resp.Result) > 0 {
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("invalid %s result: %w", method, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,341 @@
+package wol_plugin
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+	wol_auth "wol-server/wol/auth"
+	wol_device "wol-server/wol/device"
+	wol_log "wol-server/wol/log"
+)
+
+// Extension points. In-tree integrations register a factory for one of
+// these at init time; external executables are adapted to them by
+// ExecPlugin.
+
+type Event struct {
+	Type      string                 `json:"type"`
+	Device    string                 `json:"device,omitempty"`
+	MAC       string                 `json:"mac,omitempty"`
+	Success   bool                   `json:"success"`
+	Error     string                 `json:"error,omitempty"`
+	Timestamp time.Time              `json:"timestamp"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
+const (
+	EventWake = "wake"
+)
+
+type Notifier interface {
+	Notify(event Event) error
+}
+
+type WakeRequest struct {
+	Device     string            `json:"device,omitempty"`
+	MAC        string            `json:"mac"`
+	IPAddress  string            `json:"ip_address,omitempty"`
+	Port       int               `json:"port"`
+	Parameters map[string]string `json:"parameters,omitempty"`
+}
+
+// WakeTransport delivers a wake request by some means other than the
+// built-in UDP broadcast (e.g. a smart plug, a BMC or a remote relay).
+type WakeTransport interface {
+	Wake(req WakeRequest) error
+}
+
+// StorageBackend persists the device list.
+type StorageBackend interface {
+	LoadDevices() ([]*wol_device.Device, error)
+	SaveDevices(devices []*wol_device.Device) error
+}
+
+type Options map[string]string
+
+type NotifierFactory func(options Options) (Notifier, error)
+type WakeTransportFactory func(options Options) (WakeTransport, error)
+type StorageBackendFactory func(options Options) (StorageBackend, error)
+type AuthProviderFactory func(options Options) (wol_auth.Provider, error)
+
+type Registry[F any] struct {
+	mu        sync.RWMutex
+	kind      string
+	factories map[string]F
+}
+
+func NewRegistry[F any](kind string) *Registry[F] {
+	return &Registry[F]{kind: kind, factories: make(map[string]F)}
+}
+
+func (r *Registry[F]) Register(name string, factory F) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.factories[name]; exists {
+		return fmt.Errorf("%s '%s' is already registered", r.kind, name)
+	}
+
+	r.factories[name] = factory
+	return nil
+}
+
+func (r *Registry[F]) Get(name string) (F, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	factory, exists := r.factories[name]
+	if !exists {
+		return factory, fmt.Errorf("%s '%s' is not registered", r.kind, name)
+	}
+	return factory, nil
+}
+
+func (r *Registry[F]) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+var (
+	Notifiers       = NewRegistry[NotifierFactory]("notifier")
+	WakeTransports  = NewRegistry[WakeTransportFactory]("wake transport")
+	StorageBackends = NewRegistry[StorageBackendFactory]("storage backend")
+	AuthProviders   = NewRegistry[AuthProviderFactory]("auth provider")
+)
+
+// Manager holds the extension instances active in this process: in-tree
+// ones instantiated from the registries and external executables loaded
+// from a plugin directory.
+type Manager struct {
+	logger *wol_log.Logger
+
+	mu         sync.RWMutex
+	notifiers  map[string]Notifier
+	transports map[string]WakeTransport
+	auth       []wol_auth.Provider
+	external   []*ExecPlugin
+
+	// pending tracks notifications still being delivered
+	pending sync.WaitGroup
+}
+
+func NewManager(logger *wol_log.Logger) *Manager {
+	return &Manager{
+		logger:     logger,
+		notifiers:  make(map[string]Notifier),
+		transports: make(map[string]WakeTransport),
+	}
+}
+
+func (m *Manager) AddNotifier(name string, notifier Notifier) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notifiers[name] = notifier
+}
+
+func (m *Manager) AddWakeTransport(name string, transport WakeTransport) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.transports[name] = transport
+}
+
+func (m *Manager) AddAuthProvider(provider wol_auth.Provider) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.auth = append(m.auth, provider)
+}
+
+// Enable instantiates a registered in-tree extension of the given kind
+// ("notifier" or "transport") under its registered name.
+func (m *Manager) Enable(kind, name string, options Options) error {
+	switch kind {
+	case "notifier":
+		factory, err := Notifiers.Get(name)
+		if err != nil {
+			return err
+		}
+		notifier, err := factory(options)
+		if err != nil {
+			return fmt.Errorf("failed to create notifier '%s': %w", name, err)
+		}
+		m.AddNotifier(name, notifier)
+	case "transport":
+		factory, err := WakeTransports.Get(name)
+		if err != nil {
+			return err
+		}
+		transport, err := factory(options)
+		if err != nil {
+			return fmt.Errorf("failed to create wake transport '%s': %w", name, err)
+		}
+		m.AddWakeTransport(name, transport)
+	default:
+		return fmt.Errorf("unknown extension kind: %s", kind)
+	}
+	return nil
+}
+
+// LoadDir starts every executable file in dir as an external plugin and
+// registers it for the capabilities it reports in its handshake.
+func (m *Manager) LoadDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("failed to read plugin directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil || info.Mode()&0111 == 0 {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		plugin, err := StartExecPlugin(path)
+		if err != nil {
+			m.logger.Error("Plugin: Failed to start %s: %v", path, err)
+			continue
+		}
+
+		m.register(plugin)
+		m.logger.Info("Plugin: Loaded %s (%s) with capabilities %v", plugin.Name(), path, plugin.Capabilities())
+	}
+
+	return nil
+}
+
+func (m *Manager) register(plugin *ExecPlugin) {
+	m.mu.Lock()
+	m.external = append(m.external, plugin)
+	m.mu.Unlock()
+
+	for _, capability := range plugin.Capabilities() {
+		switch capability {
+		case CapabilityNotifier:
+			m.AddNotifier(plugin.Name(), plugin)
+		case CapabilityWakeTransport:
+			m.AddWakeTransport(plugin.Name(), plugin)
+		case CapabilityAuth:
+			m.AddAuthProvider(plugin)
+		}
+	}
+}
+
+// Notify delivers event to every notifier in the background so a slow
+// integration cannot hold up a wake. Failures are logged rather than
+// returned; Close waits for deliveries still in flight.
+func (m *Manager) Notify(event Event) {
+	if m == nil {
+		return
+	}
+	if event.Timestamp.IsZero() {
+		event.Timestamp = time.Now()
+	}
+
+	m.mu.RLock()
+	notifiers := make(map[string]Notifier, len(m.notifiers))
+	for name, notifier := range m.notifiers {
+		notifiers[name] = notifier
+	}
+	m.mu.RUnlock()
+
+	for name, notifier := range notifiers {
+		m.pending.Add(1)
+		go func(name string, notifier Notifier) {
+			defer m.pending.Done()
+			if err := notifier.Notify(event); err != nil {
+				m.logger.Warn("Plugin: Notifier %s failed: %v", name, err)
+			}
+		}(name, notifier)
+	}
+}
+
+func (m *Manager) WakeTransport(name string) (WakeTransport, error) {
+	if m == nil {
+		return nil, fmt.Errorf("wake transport '%s' is not available: plugins are not enabled", name)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	transport, exists := m.transports[name]
+	if !exists {
+		return nil, fmt.Errorf("wake transport '%s' is not available", name)
+	}
+	return transport, nil
+}
+
+// WakeDevice wakes device through the wake transport named in its
+// Transport field.
+func (m *Manager) WakeDevice(device *wol_device.Device, port int) error {
+	transport, err := m.WakeTransport(device.Transport)
+	if err != nil {
+		return err
+	}
+
+	return transport.Wake(WakeRequest{
+		Device:    device.Name,
+		MAC:       device.MACAddress,
+		IPAddress: device.IPAddress,
+		Port:      port,
+	})
+}
+
+func (m *Manager) AuthProviders() []wol_auth.Provider {
+	if m == nil {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return append([]wol_auth.Provider(nil), m.auth...)
+}
+
+func (m *Manager) Close() {
+	if m == nil {
+		return
+	}
+
+	m.pending.Wait()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, plugin := range m.external {
+		if err := plugin.Close(); err != nil {
+			m.logger.Warn("Plugin: Failed to stop %s: %v", plugin.Name(), err)
+		}
+	}
+	m.external = nil
+}
+
+// authRequest is the subset of an HTTP request forwarded to auth plugins.
+type authRequest struct {
+	Method  string            `json:"method"`
+	Path    string            `json:"path"`
+	Headers map[string]string `json:"headers"`
+}
+
+func newAuthRequest(r *http.Request) authRequest {
+	headers := make(map[string]string)
+	for _, name := range []string{"Authorization", "X-API-Key", "X-Forwarded-User"} {
+		if value := r.Header.Get(name); value != "" {
+			headers[name] = value
+		}
+	}
+	return authRequest{Method: r.Method, Path: r.URL.Path, Headers: headers}
+}
@@ -0,0 +1,163 @@
+package wol_plugin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_log "wol-server/wol/log"
+)
+
+const testPluginScript = `#!/bin/sh
+while IFS= read -r line; do
+  id=$(echo "$line" | sed -n 's/.*"id":\([0-9]*\).*/\1/p')
+  case "$line" in
+    *'"method":"handshake"'*) echo "{\"id\":$id,\"result\":{\"name\":\"test-plug\",\"protocol_version\":1,\"capabilities\":[\"notifier\",\"wake_transport\"]}}" ;;
+    *'"method":"wake"'*) echo "{\"id\":$id,\"error\":\"device unplugged\"}" ;;
+    *) echo "{\"id\":$id,\"result\":{}}" ;;
+  esac
+done
+`
+
+type recordingNotifier struct {
+	events []Event
+	err    error
+}
+
+func (n *recordingNotifier) Notify(event Event) error {
+	n.events = append(n.events, event)
+	return n.err
+}
+
+func testLogger() *wol_log.Logger {
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+	return logger
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry[NotifierFactory]("notifier")
+
+	factory := func(options Options) (Notifier, error) { return &recordingNotifier{}, nil }
+	if err := registry.Register("log", factory); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := registry.Register("log", factory); err == nil {
+		t.Error("Register() expected error for duplicate name")
+	}
+
+	if _, err := registry.Get("missing"); err == nil {
+		t.Error("Get() expected error for unregistered name")
+	}
+
+	if names := registry.Names(); len(names) != 1 || names[0] != "log" {
+		t.Errorf("Names() = %v, want [log]", names)
+	}
+}
+
+func TestManager_Notify(t *testing.T) {
+	manager := NewManager(testLogger())
+
+	failing := &recordingNotifier{err: errors.New("boom")}
+	working := &recordingNotifier{}
+	manager.AddNotifier("failing", failing)
+	manager.AddNotifier("working", working)
+
+	manager.Notify(Event{Type: EventWake, Device: "desktop", Success: true})
+	// Delivery happens in the background; Close waits for it
+	manager.Close()
+
+	if len(working.events) != 1 || len(failing.events) != 1 {
+		t.Fatalf("notifiers received %d and %d events, want 1 each", len(working.events), len(failing.events))
+	}
+	if working.events[0].Timestamp.IsZero() {
+		t.Error("Notify() should set the event timestamp")
+	}
+
+	// A nil manager is valid and does nothing
+	var nilManager *Manager
+	nilManager.Notify(Event{Type: EventWake})
+	if _, err := nilManager.WakeTransport("plug"); err == nil {
+		t.Error("WakeTransport() on nil manager expected error")
+	}
+}
+
+func TestManager_LoadDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script plugin requires a POSIX shell")
+	}
+
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "test-plug"), []byte(testPluginScript), 0755); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "README"), []byte("not a plugin"), 0644); err != nil {
+		t.Fatalf("Failed to write readme: %v", err)
+	}
+
+	manager := NewManager(testLogger())
+	defer manager.Close()
+
+	if err := manager.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir() error = %v", err)
+	}
+
+	if _, err := manager.WakeTransport("test-plug"); err != nil {
+		t.Fatalf("WakeTransport() error = %v", err)
+	}
+
+	device := &wol_device.Device{Name: "nas", MACAddress: "AA:BB:CC:DD:EE:FF", Transport: "test-plug"}
+	err := manager.WakeDevice(device, 9)
+	if err == nil || err.Error() != "device unplugged" {
+		t.Errorf("WakeDevice() error = %v, want plugin error 'device unplugged'", err)
+	}
+
+	manager.Notify(Event{Type: EventWake, Device: "nas", Success: true})
+}
+
+// testSilentPluginScript completes the handshake and then never answers.
+const testSilentPluginScript = `#!/bin/sh
+IFS= read -r line
+id=$(echo "$line" | sed -n 's/.*"id":\([0-9]*\).*/\1/p')
+echo "{\"id\":$id,\"result\":{\"name\":\"silent\",\"protocol_version\":1,\"capabilities\":[\"notifier\"]}}"
+while IFS= read -r line; do :; done
+`
+
+func TestExecPlugin_Timeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("shell script plugin requires a POSIX shell")
+	}
+
+	path := filepath.Join(t.TempDir(), "silent")
+	if err := os.WriteFile(path, []byte(testSilentPluginScript), 0755); err != nil {
+		t.Fatalf("Failed to write plugin: %v", err)
+	}
+
+	plugin, err := StartExecPlugin(path)
+	if err != nil {
+		t.Fatalf("StartExecPlugin() error = %v", err)
+	}
+	defer plugin.Close()
+	plugin.timeout = 100 * time.Millisecond
+
+	err = plugin.Notify(Event{Type: EventWake, Device: "nas"})
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Fatalf("Notify() error = %v, want timeout", err)
+	}
+
+	// The plugin was stopped, so later calls fail straight away instead
+	// of waiting out another timeout
+	for i := 0; i < 3; i++ {
+		start := time.Now()
+		err := plugin.Wake(WakeRequest{Device: "nas", MAC: "AA:BB:CC:DD:EE:FF", Port: 9})
+		if err == nil {
+			t.Fatalf("Wake() after timeout expected error")
+		}
+		if elapsed := time.Since(start); elapsed >= plugin.timeout {
+			t.Errorf("Wake() after timeout took %v, want immediate failure", elapsed)
+		}
+	}
+}
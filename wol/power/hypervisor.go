@@ -0,0 +1,215 @@
+package wol_power
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+	wol_device "wol-server/wol/device"
+)
+
+// ProxmoxProvider starts QEMU VMs and LXC containers through the Proxmox VE
+// API. Username is either an API token ID ("user@realm!tokenid", with the
+// token secret as password) or a regular "user@realm" login.
+type ProxmoxProvider struct {
+	baseURL  string
+	username string
+	password string
+	guest    string
+	client   *http.Client
+
+	ticket    string
+	csrfToken string
+}
+
+type proxmoxGuest struct {
+	VMID   int    `json:"vmid"`
+	Name   string `json:"name"`
+	Node   string `json:"node"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+func NewProxmoxProvider(config *wol_device.PowerConfig) *ProxmoxProvider {
+	baseURL := strings.TrimSuffix(config.Address, "/")
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+	if !strings.Contains(strings.TrimPrefix(strings.TrimPrefix(baseURL, "https://"), "http://"), ":") {
+		baseURL += ":8006"
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.Insecure {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &ProxmoxProvider{
+		baseURL:  baseURL,
+		username: config.Username,
+		password: config.Password,
+		guest:    config.SystemID,
+		client:   &http.Client{Timeout: 15 * time.Second, Transport: transport},
+	}
+}
+
+func (p *ProxmoxProvider) PowerOn() error {
+	guest, err := p.findGuest()
+	if err != nil {
+		return err
+	}
+
+	path := fmt.Sprintf("/api2/json/nodes/%s/%s/%d/status/start", guest.Node, guest.Type, guest.VMID)
+	return p.do("POST", path, nil)
+}
+
+func (p *ProxmoxProvider) IsPoweredOn() (bool, error) {
+	guest, err := p.findGuest()
+	if err != nil {
+		return false, err
+	}
+
+	return guest.Status == "running", nil
+}
+
+// findGuest looks the configured VM ID or name up across the cluster, so
+// devices keep working when a guest migrates to another node.
+func (p *ProxmoxProvider) findGuest() (*proxmoxGuest, error) {
+	var guests []proxmoxGuest
+	if err := p.do("GET", "/api2/json/cluster/resources?type=vm", &guests); err != nil {
+		return nil, err
+	}
+
+	for _, guest := range guests {
+		if strconv.Itoa(guest.VMID) == p.guest || strings.EqualFold(guest.Name, p.guest) {
+			return &guest, nil
+		}
+	}
+
+	return nil, fmt.Errorf("Proxmox guest '%s' not found", p.guest)
+}
+
+func (p *ProxmoxProvider) login() error {
+	form := url.Values{"username": {p.username}, "password": {p.password}}
+	resp, err := p.client.PostForm(p.baseURL+"/api2/json/access/ticket", form)
+	if err != nil {
+		return fmt.Errorf("Proxmox login failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Proxmox login failed: %s", resp.Status)
+	}
+
+	var result struct {
+		Data struct {
+			Ticket    string `json:"ticket"`
+			CSRFToken string `json:"CSRFPreventionToken"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("failed to decode Proxmox login response: %w", err)
+	}
+
+	p.ticket = result.Data.Ticket
+	p.csrfToken = result.Data.CSRFToken
+	return nil
+}
+
+func (p *ProxmoxProvider) do(method, path string, data interface{}) error {
+	tokenAuth := strings.Contains(p.username, "!")
+	if !tokenAuth && p.ticket == "" {
+		if err := p.login(); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, p.baseURL+path, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create Proxmox request: %w", err)
+	}
+
+	if tokenAuth {
+		req.Header.Set("Authorization", fmt.Sprintf("PVEAPIToken=%s=%s", p.username, p.password))
+	} else {
+		req.AddCookie(&http.Cookie{Name: "PVEAuthCookie", Value: p.ticket})
+		if method != "GET" {
+			req.Header.Set("CSRFPreventionToken", p.csrfToken)
+		}
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("Proxmox request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Tickets expire after two hours; log in again next time
+		p.ticket = ""
+		return fmt.Errorf("Proxmox %s %s returned %s", method, path, resp.Status)
+	}
+
+	if data == nil {
+		return nil
+	}
+
+	envelope := struct {
+		Data interface{} `json:"data"`
+	}{Data: data}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("failed to decode Proxmox response: %w", err)
+	}
+	return nil
+}
+
+// LibvirtProvider starts domains with virsh, which must be installed.
+// Address is the libvirt connection URI, e.g. qemu:///system or
+// qemu+ssh://user@host/system.
+type LibvirtProvider struct {
+	Command string
+
+	uri    string
+	domain string
+}
+
+func NewLibvirtProvider(config *wol_device.PowerConfig) *LibvirtProvider {
+	return &LibvirtProvider{
+		Command: "virsh",
+		uri:     config.Address,
+		domain:  config.SystemID,
+	}
+}
+
+func (p *LibvirtProvider) PowerOn() error {
+	output, err := p.run("start", p.domain)
+	if err != nil && strings.Contains(output, "already active") {
+		return nil
+	}
+	return err
+}
+
+func (p *LibvirtProvider) IsPoweredOn() (bool, error) {
+	output, err := p.run("domstate", p.domain)
+	if err != nil {
+		return false, err
+	}
+
+	return strings.TrimSpace(output) == "running", nil
+}
+
+func (p *LibvirtProvider) run(args ...string) (string, error) {
+	cmd := exec.Command(p.Command, append([]string{"-c", p.uri}, args...)...)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return string(output), fmt.Errorf("virsh %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+
+	return string(output), nil
+}
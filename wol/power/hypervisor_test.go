@@ -0,0 +1,115 @@
+package wol_power
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	wol_device "wol-server/wol/device"
+)
+
+func TestValidateConfig_VirtualMachines(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   wol_device.PowerConfig
+		wantMode string
+		wantErr  bool
+	}{
+		{"proxmox defaults to only", wol_device.PowerConfig{Provider: "proxmox", Address: "pve.lan", SystemID: "101"}, ModeOnly, false},
+		{"libvirt", wol_device.PowerConfig{Provider: "libvirt", Address: "qemu:///system", SystemID: "devbox"}, ModeOnly, false},
+		{"explicit fallback", wol_device.PowerConfig{Provider: "proxmox", Address: "pve.lan", SystemID: "101", Mode: "fallback"}, ModeFallback, false},
+		{"missing VM", wol_device.PowerConfig{Provider: "proxmox", Address: "pve.lan"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfig(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && tt.config.Mode != tt.wantMode {
+				t.Errorf("Mode = %s, want %s", tt.config.Mode, tt.wantMode)
+			}
+		})
+	}
+}
+
+func TestProxmoxProvider(t *testing.T) {
+	status := "stopped"
+	var startPath string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "PVEAPIToken=root@pam!wol=secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/api2/json/cluster/resources":
+			fmt.Fprintf(w, `{"data": [
+				{"id": "qemu/100", "vmid": 100, "name": "router", "node": "pve1", "type": "qemu", "status": "running"},
+				{"id": "qemu/101", "vmid": 101, "name": "win11", "node": "pve2", "type": "qemu", "status": %q}
+			]}`, status)
+		case r.Method == "POST":
+			startPath = r.URL.Path
+			status = "running"
+			fmt.Fprint(w, `{"data": "UPID:pve2:0001"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewProxmoxProvider(&wol_device.PowerConfig{Address: server.URL, Username: "root@pam!wol", Password: "secret", SystemID: "win11"})
+
+	on, err := provider.IsPoweredOn()
+	if err != nil || on {
+		t.Fatalf("IsPoweredOn() = %v, %v, want false", on, err)
+	}
+
+	if err := provider.PowerOn(); err != nil {
+		t.Fatalf("PowerOn() error = %v", err)
+	}
+	if startPath != "/api2/json/nodes/pve2/qemu/101/status/start" {
+		t.Errorf("start path = %s", startPath)
+	}
+
+	if on, _ := provider.IsPoweredOn(); !on {
+		t.Error("IsPoweredOn() = false after start, want true")
+	}
+
+	missing := NewProxmoxProvider(&wol_device.PowerConfig{Address: server.URL, Username: "root@pam!wol", Password: "secret", SystemID: "999"})
+	if err := missing.PowerOn(); err == nil {
+		t.Error("PowerOn() expected error for unknown guest")
+	}
+}
+
+func TestLibvirtProvider(t *testing.T) {
+	// A stand-in virsh that records its arguments
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "args")
+	script := filepath.Join(dir, "virsh")
+	content := fmt.Sprintf("#!/bin/sh\necho \"$@\" >> %s\n[ \"$3\" = domstate ] && echo running\nexit 0\n", logFile)
+	if err := os.WriteFile(script, []byte(content), 0755); err != nil {
+		t.Fatalf("Failed to write fake virsh: %v", err)
+	}
+
+	provider := NewLibvirtProvider(&wol_device.PowerConfig{Address: "qemu:///system", SystemID: "devbox"})
+	provider.Command = script
+
+	if err := provider.PowerOn(); err != nil {
+		t.Fatalf("PowerOn() error = %v", err)
+	}
+	on, err := provider.IsPoweredOn()
+	if err != nil || !on {
+		t.Errorf("IsPoweredOn() = %v, %v, want true", on, err)
+	}
+
+	args, _ := os.ReadFile(logFile)
+	want := "-c qemu:///system start devbox\n-c qemu:///system domstate devbox\n"
+	if string(args) != want {
+		t.Errorf("virsh invoked with %q, want %q", args, want)
+	}
+}
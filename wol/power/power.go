@@ -0,0 +1,384 @@
+package wol_power
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_log "wol-server/wol/log"
+)
+
+const (
+	ProviderRedfish = "redfish"
+	ProviderIPMI    = "ipmi"
+	ProviderProxmox = "proxmox"
+	ProviderLibvirt = "libvirt"
+
+	ModeFallback = "fallback"
+	ModeOnly     = "only"
+
+	MethodWoL = "wol"
+
+	DefaultWaitWindow   = 90 * time.Second
+	DefaultPollInterval = 5 * time.Second
+)
+
+// Provider controls a machine's power out of band: through the baseboard
+// management controller of a physical host or the hypervisor of a VM.
+type Provider interface {
+	PowerOn() error
+	IsPoweredOn() (bool, error)
+}
+
+// ValidateConfig checks a device power configuration and fills in defaults.
+func ValidateConfig(config *wol_device.PowerConfig) error {
+	vm := false
+	switch config.Provider {
+	case ProviderRedfish, ProviderIPMI:
+	case ProviderProxmox, ProviderLibvirt:
+		vm = true
+	default:
+		return fmt.Errorf("unknown power provider: %s (supported: redfish, ipmi, proxmox, libvirt)", config.Provider)
+	}
+
+	if strings.TrimSpace(config.Address) == "" {
+		return fmt.Errorf("%s address is required", config.Provider)
+	}
+	if vm && strings.TrimSpace(config.SystemID) == "" {
+		return fmt.Errorf("%s needs the VM ID or name", config.Provider)
+	}
+
+	switch config.Mode {
+	case "":
+		// A stopped VM has no NIC to receive a magic packet
+		config.Mode = ModeFallback
+		if vm {
+			config.Mode = ModeOnly
+		}
+	case ModeFallback, ModeOnly:
+	default:
+		return fmt.Errorf("unknown power mode: %s (supported: fallback, only)", config.Mode)
+	}
+
+	return nil
+}
+
+func NewProvider(config *wol_device.PowerConfig) (Provider, error) {
+	if err := ValidateConfig(config); err != nil {
+		return nil, err
+	}
+
+	switch config.Provider {
+	case ProviderRedfish:
+		return NewRedfishProvider(config), nil
+	case ProviderProxmox:
+		return NewProxmoxProvider(config), nil
+	case ProviderLibvirt:
+		return NewLibvirtProvider(config), nil
+	default:
+		return NewIPMIProvider(config), nil
+	}
+}
+
+// RedfishProvider uses the DMTF Redfish REST API (iDRAC, iLO, XCC, OpenBMC).
+type RedfishProvider struct {
+	baseURL  string
+	username string
+	password string
+	systemID string
+	client   *http.Client
+}
+
+func NewRedfishProvider(config *wol_device.PowerConfig) *RedfishProvider {
+	baseURL := strings.TrimSuffix(config.Address, "/")
+	if !strings.Contains(baseURL, "://") {
+		baseURL = "https://" + baseURL
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.Insecure {
+		// BMCs almost always ship with self-signed certificates
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+
+	return &RedfishProvider{
+		baseURL:  baseURL,
+		username: config.Username,
+		password: config.Password,
+		systemID: config.SystemID,
+		client:   &http.Client{Timeout: 15 * time.Second, Transport: transport},
+	}
+}
+
+func (p *RedfishProvider) PowerOn() error {
+	path, err := p.systemPath()
+	if err != nil {
+		return err
+	}
+
+	body, _ := json.Marshal(map[string]string{"ResetType": "On"})
+	resp, err := p.do("POST", path+"/Actions/ComputerSystem.Reset", body)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	return nil
+}
+
+func (p *RedfishProvider) IsPoweredOn() (bool, error) {
+	path, err := p.systemPath()
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := p.do("GET", path, nil)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	var system struct {
+		PowerState string `json:"PowerState"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&system); err != nil {
+		return false, fmt.Errorf("failed to decode Redfish system: %w", err)
+	}
+
+	return system.PowerState == "On", nil
+}
+
+// systemPath returns the configured system, or the first one the BMC
+// lists when no system ID is set.
+func (p *RedfishProvider) systemPath() (string, error) {
+	if p.systemID != "" {
+		return "/redfish/v1/Systems/" + p.systemID, nil
+	}
+
+	resp, err := p.do("GET", "/redfish/v1/Systems", nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var collection struct {
+		Members []struct {
+			ID string `json:"@odata.id"`
+		} `json:"Members"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&collection); err != nil {
+		return "", fmt.Errorf("failed to decode Redfish systems: %w", err)
+	}
+	if len(collection.Members) == 0 || collection.Members[0].ID == "" {
+		return "", fmt.Errorf("BMC reports no systems")
+	}
+
+	p.systemID = collection.Members[0].ID[strings.LastIndex(collection.Members[0].ID, "/")+1:]
+	return collection.Members[0].ID, nil
+}
+
+func (p *RedfishProvider) do(method, path string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequest(method, p.baseURL+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Redfish request: %w", err)
+	}
+	req.SetBasicAuth(p.username, p.password)
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("Redfish request failed: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("Redfish %s %s returned %s", method, path, resp.Status)
+	}
+
+	return resp, nil
+}
+
+// IPMIProvider drives IPMI-over-LAN through ipmitool, which must be
+// installed. The password is passed in the environment so it does not
+// show up in the process list.
+type IPMIProvider struct {
+	Command string
+
+	host     string
+	port     string
+	username string
+	password string
+}
+
+func NewIPMIProvider(config *wol_device.PowerConfig) *IPMIProvider {
+	host, port := config.Address, ""
+	if h, p, err := net.SplitHostPort(config.Address); err == nil {
+		host, port = h, p
+	}
+
+	return &IPMIProvider{
+		Command:  "ipmitool",
+		host:     host,
+		port:     port,
+		username: config.Username,
+		password: config.Password,
+	}
+}
+
+func (p *IPMIProvider) PowerOn() error {
+	_, err := p.run("chassis", "power", "on")
+	return err
+}
+
+func (p *IPMIProvider) IsPoweredOn() (bool, error) {
+	output, err := p.run("chassis", "power", "status")
+	if err != nil {
+		return false, err
+	}
+
+	return strings.Contains(strings.ToLower(output), "is on"), nil
+}
+
+func (p *IPMIProvider) run(args ...string) (string, error) {
+	base := []string{"-I", "lanplus", "-H", p.host, "-U", p.username, "-E"}
+	if p.port != "" {
+		base = append(base, "-p", p.port)
+	}
+
+	cmd := exec.Command(p.Command, append(base, args...)...)
+	cmd.Env = append(os.Environ(), "IPMI_PASSWORD="+p.password)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("ipmitool %s failed: %w: %s", strings.Join(args, " "), err, strings.TrimSpace(string(output)))
+	}
+
+	return string(output), nil
+}
+
+type Config struct {
+	// WaitWindow is how long a magic packet gets to power the host on
+	// before the power provider is asked to
+	WaitWindow   time.Duration
+	PollInterval time.Duration
+}
+
+type Result struct {
+	Method    string `json:"method"`
+	PoweredOn bool   `json:"powered_on"`
+}
+
+// Waker applies a device's power configuration around a Wake-on-LAN send.
+type Waker struct {
+	config      Config
+	logger      *wol_log.Logger
+	newProvider func(config *wol_device.PowerConfig) (Provider, error)
+}
+
+func NewWaker(config Config, logger *wol_log.Logger) *Waker {
+	if config.WaitWindow <= 0 {
+		config.WaitWindow = DefaultWaitWindow
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+
+	return &Waker{config: config, logger: logger, newProvider: NewProvider}
+}
+
+// Wake powers device on: by magic packet (sendWoL) unless its power mode
+// is "only", then through its power provider if the host is not on within
+// the wait window. It blocks for up to the wait window.
+func (w *Waker) Wake(device *wol_device.Device, sendWoL func() error) (*Result, error) {
+	if device.Power == nil {
+		if err := sendWoL(); err != nil {
+			return nil, err
+		}
+		return &Result{Method: MethodWoL}, nil
+	}
+
+	if device.Power.Mode == ModeOnly {
+		if err := w.PowerOn(device); err != nil {
+			return nil, err
+		}
+		return &Result{Method: device.Power.Provider, PoweredOn: true}, nil
+	}
+
+	if err := sendWoL(); err != nil {
+		w.logger.Warn("Power: Wake-on-LAN for %s failed (%v), using %s", device.Name, err, device.Power.Provider)
+		if err := w.PowerOn(device); err != nil {
+			return nil, err
+		}
+		return &Result{Method: device.Power.Provider, PoweredOn: true}, nil
+	}
+
+	return w.Fallback(device)
+}
+
+// Fallback waits for device to power on after a magic packet and powers
+// it on through its provider if it has not by the end of the wait window.
+func (w *Waker) Fallback(device *wol_device.Device) (*Result, error) {
+	provider, err := w.newProvider(device.Power)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(w.config.WaitWindow)
+	for time.Now().Before(deadline) {
+		time.Sleep(w.config.PollInterval)
+
+		on, err := provider.IsPoweredOn()
+		if err != nil {
+			w.logger.Debug("Power: Failed to read power state of %s: %v", device.Name, err)
+			continue
+		}
+		if on {
+			w.logger.Info("Power: %s powered on from Wake-on-LAN", device.Name)
+			return &Result{Method: MethodWoL, PoweredOn: true}, nil
+		}
+	}
+
+	w.logger.Info("Power: %s still off after %v, powering on through %s", device.Name, w.config.WaitWindow, device.Power.Provider)
+	if err := provider.PowerOn(); err != nil {
+		return nil, fmt.Errorf("%s power-on failed: %w", device.Power.Provider, err)
+	}
+
+	return &Result{Method: device.Power.Provider, PoweredOn: true}, nil
+}
+
+func (w *Waker) PowerOn(device *wol_device.Device) error {
+	provider, err := w.newProvider(device.Power)
+	if err != nil {
+		return err
+	}
+
+	if err := provider.PowerOn(); err != nil {
+		return fmt.Errorf("%s power-on failed: %w", device.Power.Provider, err)
+	}
+
+	w.logger.Info("Power: %s powered on through %s", device.Name, device.Power.Provider)
+	return nil
+}
+
+// IsPoweredOn asks the device's power provider whether it is running.
+func (w *Waker) IsPoweredOn(device *wol_device.Device) (bool, error) {
+	if device.Power == nil {
+		return false, fmt.Errorf("device '%s' has no power control configured", device.Name)
+	}
+
+	provider, err := w.newProvider(device.Power)
+	if err != nil {
+		return false, err
+	}
+
+	return provider.IsPoweredOn()
+}
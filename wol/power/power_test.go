@@ -0,0 +1,155 @@
+package wol_power
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_log "wol-server/wol/log"
+)
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   wol_device.PowerConfig
+		wantMode string
+		wantErr  bool
+	}{
+		{"redfish default mode", wol_device.PowerConfig{Provider: "redfish", Address: "bmc.lan"}, ModeFallback, false},
+		{"ipmi only", wol_device.PowerConfig{Provider: "ipmi", Address: "10.0.0.5", Mode: "only"}, ModeOnly, false},
+		{"unknown provider", wol_device.PowerConfig{Provider: "amt", Address: "bmc.lan"}, "", true},
+		{"missing address", wol_device.PowerConfig{Provider: "redfish"}, "", true},
+		{"unknown mode", wol_device.PowerConfig{Provider: "redfish", Address: "bmc.lan", Mode: "always"}, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateConfig(&tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && tt.config.Mode != tt.wantMode {
+				t.Errorf("Mode = %s, want %s", tt.config.Mode, tt.wantMode)
+			}
+		})
+	}
+}
+
+func TestRedfishProvider(t *testing.T) {
+	powerState := "Off"
+	var resetType string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "root" || pass != "calvin" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.Method == "GET" && r.URL.Path == "/redfish/v1/Systems":
+			fmt.Fprint(w, `{"Members": [{"@odata.id": "/redfish/v1/Systems/System.Embedded.1"}]}`)
+		case r.Method == "GET" && r.URL.Path == "/redfish/v1/Systems/System.Embedded.1":
+			fmt.Fprintf(w, `{"PowerState": %q}`, powerState)
+		case r.Method == "POST" && r.URL.Path == "/redfish/v1/Systems/System.Embedded.1/Actions/ComputerSystem.Reset":
+			var body map[string]string
+			json.NewDecoder(r.Body).Decode(&body)
+			resetType = body["ResetType"]
+			powerState = "On"
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewRedfishProvider(&wol_device.PowerConfig{Provider: "redfish", Address: server.URL, Username: "root", Password: "calvin"})
+
+	on, err := provider.IsPoweredOn()
+	if err != nil || on {
+		t.Fatalf("IsPoweredOn() = %v, %v, want false", on, err)
+	}
+
+	if err := provider.PowerOn(); err != nil {
+		t.Fatalf("PowerOn() error = %v", err)
+	}
+	if resetType != "On" {
+		t.Errorf("ResetType = %q, want On", resetType)
+	}
+
+	on, err = provider.IsPoweredOn()
+	if err != nil || !on {
+		t.Errorf("IsPoweredOn() = %v, %v, want true", on, err)
+	}
+
+	bad := NewRedfishProvider(&wol_device.PowerConfig{Provider: "redfish", Address: server.URL, Username: "root", Password: "wrong"})
+	if err := bad.PowerOn(); err == nil {
+		t.Error("PowerOn() expected error with bad credentials")
+	}
+}
+
+type fakeProvider struct {
+	onAfter int // IsPoweredOn reports true from this call on; 0 = never
+	calls   int
+	powered bool
+}
+
+func (p *fakeProvider) PowerOn() error {
+	p.powered = true
+	return nil
+}
+
+func (p *fakeProvider) IsPoweredOn() (bool, error) {
+	p.calls++
+	return p.onAfter > 0 && p.calls >= p.onAfter, nil
+}
+
+func TestWaker_Wake(t *testing.T) {
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+
+	tests := []struct {
+		name        string
+		power       *wol_device.PowerConfig
+		onAfter     int
+		wolErr      error
+		wantMethod  string
+		wantWoL     bool
+		wantPowerOn bool
+	}{
+		{"no power config", nil, 0, nil, MethodWoL, true, false},
+		{"woken by packet", &wol_device.PowerConfig{Provider: ProviderRedfish, Mode: ModeFallback}, 1, nil, MethodWoL, true, false},
+		{"BMC fallback", &wol_device.PowerConfig{Provider: ProviderRedfish, Mode: ModeFallback}, 0, nil, ProviderRedfish, true, true},
+		{"packet send fails", &wol_device.PowerConfig{Provider: ProviderRedfish, Mode: ModeFallback}, 0, fmt.Errorf("no route"), ProviderRedfish, true, true},
+		{"BMC only", &wol_device.PowerConfig{Provider: ProviderRedfish, Mode: ModeOnly}, 0, nil, ProviderRedfish, false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &fakeProvider{onAfter: tt.onAfter}
+			waker := NewWaker(Config{WaitWindow: 30 * time.Millisecond, PollInterval: 5 * time.Millisecond}, logger)
+			waker.newProvider = func(*wol_device.PowerConfig) (Provider, error) { return provider, nil }
+
+			sentWoL := false
+			device := &wol_device.Device{Name: "server", Power: tt.power}
+			result, err := waker.Wake(device, func() error {
+				sentWoL = true
+				return tt.wolErr
+			})
+			if err != nil {
+				t.Fatalf("Wake() error = %v", err)
+			}
+
+			if result.Method != tt.wantMethod {
+				t.Errorf("Method = %s, want %s", result.Method, tt.wantMethod)
+			}
+			if sentWoL != tt.wantWoL {
+				t.Errorf("sent magic packet = %v, want %v", sentWoL, tt.wantWoL)
+			}
+			if provider.powered != tt.wantPowerOn {
+				t.Errorf("BMC power-on = %v, want %v", provider.powered, tt.wantPowerOn)
+			}
+		})
+	}
+}
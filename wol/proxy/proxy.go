@@ -0,0 +1,268 @@
+package wol_proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_log "wol-server/wol/log"
+	wol_network "wol-server/wol/network"
+)
+
+const (
+	DefaultWaitTimeout  = 2 * time.Minute
+	DefaultPollInterval = 2 * time.Second
+	// wakeCooldown stops a burst of connections from sending a packet each
+	wakeCooldown = 10 * time.Second
+)
+
+// Mapping forwards connections on ListenAddr to TargetPort on Device.
+type Mapping struct {
+	ListenAddr string
+	Device     string
+	TargetPort int
+}
+
+// ParseMappings parses a comma-separated list of "listen=device:port"
+// entries, e.g. "2222=nas:22,:8096=nas:8096". A bare listen port binds all
+// interfaces.
+func ParseMappings(spec string) ([]Mapping, error) {
+	var mappings []Mapping
+
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		listen, target, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid proxy mapping %q: expected listen=device:port", entry)
+		}
+
+		device, portStr, ok := strings.Cut(target, ":")
+		if !ok || device == "" {
+			return nil, fmt.Errorf("invalid proxy target %q: expected device:port", target)
+		}
+
+		port, err := strconv.Atoi(portStr)
+		if err != nil || port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid proxy target port %q", portStr)
+		}
+
+		if !strings.Contains(listen, ":") {
+			listen = ":" + listen
+		}
+
+		mappings = append(mappings, Mapping{ListenAddr: listen, Device: device, TargetPort: port})
+	}
+
+	if len(mappings) == 0 {
+		return nil, fmt.Errorf("no proxy mappings given")
+	}
+
+	return mappings, nil
+}
+
+type Config struct {
+	Mappings     []Mapping
+	WaitTimeout  time.Duration
+	PollInterval time.Duration
+}
+
+// WakeFunc wakes a device; it is supplied by the caller so the proxy uses
+// the same wake path (broadcast or plugin transport) as the CLI and API.
+type WakeFunc func(device *wol_device.Device) error
+
+type Proxy struct {
+	config Config
+	store  *wol_device.DeviceStore
+	wake   WakeFunc
+	logger *wol_log.Logger
+
+	mu        sync.Mutex
+	listeners []net.Listener
+	lastWake  map[string]time.Time
+	wg        sync.WaitGroup
+}
+
+func NewProxy(config Config, store *wol_device.DeviceStore, wake WakeFunc, logger *wol_log.Logger) *Proxy {
+	if config.WaitTimeout <= 0 {
+		config.WaitTimeout = DefaultWaitTimeout
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = DefaultPollInterval
+	}
+
+	return &Proxy{
+		config:   config,
+		store:    store,
+		wake:     wake,
+		logger:   logger,
+		lastWake: make(map[string]time.Time),
+	}
+}
+
+func (p *Proxy) Start() error {
+	for _, mapping := range p.config.Mappings {
+		listener, err := net.Listen("tcp", mapping.ListenAddr)
+		if err != nil {
+			p.Stop()
+			return fmt.Errorf("failed to listen on %s: %w", mapping.ListenAddr, err)
+		}
+
+		p.mu.Lock()
+		p.listeners = append(p.listeners, listener)
+		p.mu.Unlock()
+
+		p.logger.Info("Proxy: Listening on %s for %s:%d", listener.Addr(), mapping.Device, mapping.TargetPort)
+
+		p.wg.Add(1)
+		go p.serve(listener, mapping)
+	}
+
+	return nil
+}
+
+func (p *Proxy) Stop() {
+	p.mu.Lock()
+	for _, listener := range p.listeners {
+		listener.Close()
+	}
+	p.listeners = nil
+	p.mu.Unlock()
+
+	p.wg.Wait()
+}
+
+// Addrs returns the bound listener addresses, in mapping order.
+func (p *Proxy) Addrs() []net.Addr {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	addrs := make([]net.Addr, len(p.listeners))
+	for i, listener := range p.listeners {
+		addrs[i] = listener.Addr()
+	}
+	return addrs
+}
+
+func (p *Proxy) serve(listener net.Listener, mapping Mapping) {
+	defer p.wg.Done()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go p.handle(conn, mapping)
+	}
+}
+
+func (p *Proxy) handle(client net.Conn, mapping Mapping) {
+	defer client.Close()
+
+	device, err := p.store.GetDevice(mapping.Device)
+	if err != nil {
+		p.logger.Error("Proxy: %v", err)
+		return
+	}
+	if device.IPAddress == "" {
+		p.logger.Error("Proxy: Device %s has no IP address configured", device.Name)
+		return
+	}
+
+	target, err := resolveTarget(device, mapping.TargetPort)
+	var upstream net.Conn
+	if err == nil {
+		upstream, err = net.DialTimeout("tcp", target, p.config.PollInterval)
+	}
+	if err != nil {
+		p.logger.Info("Proxy: %s is not responding on port %d (%v), waking it for %s", device.Name, mapping.TargetPort, err, client.RemoteAddr())
+
+		if err := p.wakeOnce(device); err != nil {
+			p.logger.Error("Proxy: Failed to wake %s: %v", device.Name, err)
+			return
+		}
+
+		upstream, target, err = p.waitForTarget(device, mapping.TargetPort)
+		if err != nil {
+			p.logger.Warn("Proxy: %s did not come online: %v", device.Name, err)
+			return
+		}
+		p.logger.Info("Proxy: %s is online, forwarding connection", device.Name)
+	}
+	defer upstream.Close()
+
+	p.logger.Debug("Proxy: Forwarding %s -> %s", client.RemoteAddr(), target)
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(upstream, client)
+		closeWrite(upstream)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(client, upstream)
+		closeWrite(client)
+		done <- struct{}{}
+	}()
+	<-done
+	<-done
+}
+
+func (p *Proxy) wakeOnce(device *wol_device.Device) error {
+	p.mu.Lock()
+	last := p.lastWake[device.Name]
+	if time.Since(last) < wakeCooldown {
+		p.mu.Unlock()
+		return nil
+	}
+	p.lastWake[device.Name] = time.Now()
+	p.mu.Unlock()
+
+	return p.wake(device)
+}
+
+// waitForTarget polls port on device until it accepts a connection. The
+// device's host name is looked up again each time, since a sleeping host
+// does not answer mDNS.
+func (p *Proxy) waitForTarget(device *wol_device.Device, port int) (net.Conn, string, error) {
+	deadline := time.Now().Add(p.config.WaitTimeout)
+
+	for time.Now().Before(deadline) {
+		target, err := resolveTarget(device, port)
+		if err == nil {
+			conn, err := net.DialTimeout("tcp", target, p.config.PollInterval)
+			if err == nil {
+				return conn, target, nil
+			}
+		}
+		time.Sleep(p.config.PollInterval)
+	}
+
+	return nil, "", fmt.Errorf("timed out after %v waiting for %s port %d", p.config.WaitTimeout, device.IPAddress, port)
+}
+
+// resolveTarget returns the address of port on device, whose IP address
+// may be a host name.
+func resolveTarget(device *wol_device.Device, port int) (string, error) {
+	ip, err := wol_network.ResolveHost(device.IPAddress, wol_network.DefaultResolveTimeout)
+	if err != nil {
+		return "", err
+	}
+	return net.JoinHostPort(ip, strconv.Itoa(port)), nil
+}
+
+func closeWrite(conn net.Conn) {
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.CloseWrite()
+		return
+	}
+	conn.Close()
+}
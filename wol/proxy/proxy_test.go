@@ -0,0 +1,121 @@
+package wol_proxy
+
+import (
+	"bufio"
+	"net"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_log "wol-server/wol/log"
+)
+
+func TestParseMappings(t *testing.T) {
+	tests := []struct {
+		name    string
+		spec    string
+		want    []Mapping
+		wantErr bool
+	}{
+		{"port only", "2222=nas:22", []Mapping{{":2222", "nas", 22}}, false},
+		{"host and port", "127.0.0.1:2222=nas:22", []Mapping{{"127.0.0.1:2222", "nas", 22}}, false},
+		{"multiple", "2222=nas:22, 8096=nas:8096", []Mapping{{":2222", "nas", 22}, {":8096", "nas", 8096}}, false},
+		{"missing target", "2222", nil, true},
+		{"missing port", "2222=nas", nil, true},
+		{"bad port", "2222=nas:99999", nil, true},
+		{"empty", "", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMappings(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMappings() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("ParseMappings() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("mapping %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestProxy_WakesAndForwards(t *testing.T) {
+	// Reserve a port for the "sleeping" backend, then release it so the
+	// first dial fails until the wake function starts the backend
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to reserve port: %v", err)
+	}
+	backendAddr := reserved.Addr().String()
+	reserved.Close()
+	_, backendPort, _ := net.SplitHostPort(backendAddr)
+	port, _ := strconv.Atoi(backendPort)
+
+	store, err := wol_device.NewDeviceStore(wol_device.DeviceConfig{ConfigPath: filepath.Join(t.TempDir(), "devices.json")})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	if err := store.AddDevice("nas", "AA:BB:CC:DD:EE:FF", "", "127.0.0.1", 9); err != nil {
+		t.Fatalf("Failed to add device: %v", err)
+	}
+
+	var wakes int32
+	wake := func(device *wol_device.Device) error {
+		atomic.AddInt32(&wakes, 1)
+		backend, err := net.Listen("tcp", backendAddr)
+		if err != nil {
+			return err
+		}
+		go func() {
+			conn, err := backend.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			defer backend.Close()
+			line, _ := bufio.NewReader(conn).ReadString('\n')
+			conn.Write([]byte("echo:" + line))
+		}()
+		return nil
+	}
+
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+	proxy := NewProxy(Config{
+		Mappings:     []Mapping{{ListenAddr: "127.0.0.1:0", Device: "nas", TargetPort: port}},
+		WaitTimeout:  5 * time.Second,
+		PollInterval: 50 * time.Millisecond,
+	}, store, wake, logger)
+
+	if err := proxy.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer proxy.Stop()
+
+	client, err := net.Dial("tcp", proxy.Addrs()[0].String())
+	if err != nil {
+		t.Fatalf("Failed to connect to proxy: %v", err)
+	}
+	defer client.Close()
+
+	client.SetDeadline(time.Now().Add(5 * time.Second))
+	client.Write([]byte("hello\n"))
+
+	reply, err := bufio.NewReader(client).ReadString('\n')
+	if err != nil {
+		t.Fatalf("Failed to read reply: %v", err)
+	}
+	if reply != "echo:hello\n" {
+		t.Errorf("reply = %q, want %q", reply, "echo:hello\n")
+	}
+
+	if atomic.LoadInt32(&wakes) != 1 {
+		t.Errorf("wake called %d times, want 1", wakes)
+	}
+}
@@ -0,0 +1,217 @@
+package wol_relay
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+	wol_log "wol-server/wol/log"
+	wol_network "wol-server/wol/network"
+	wol_packet "wol-server/wol/packet"
+)
+
+const (
+	DefaultListenPort = 9
+
+	// dedupeWindow drops repeats of a packet for the same MAC, so two relays
+	// bridging the same networks cannot bounce a packet between them
+	dedupeWindow = 2 * time.Second
+)
+
+type Config struct {
+	// ListenPort is the UDP port incoming magic packets arrive on
+	ListenPort int
+	// ListenInterface only accepts packets arriving on this interface
+	// (Linux, needs CAP_NET_RAW); empty accepts them from anywhere, such as
+	// a router's port-forward
+	ListenInterface string
+	// Send is how packets are re-broadcast: the interface, broadcast mode
+	// and port (default ListenPort) on the other side
+	Send wol_network.SendOptions
+}
+
+// Stats counts what the relay has done since it started.
+type Stats struct {
+	Relayed int `json:"relayed"`
+	Dropped int `json:"dropped"`
+	Failed  int `json:"failed"`
+}
+
+// Relay receives magic packets on one network and re-broadcasts them on
+// another, bridging broadcast domains.
+type Relay struct {
+	config Config
+	logger *wol_log.Logger
+	send   func(packet []byte) error
+	sender *wol_network.Sender
+	// isLocal reports addresses of this host, whose packets are the relay's
+	// own re-broadcasts
+	isLocal func(ip net.IP) bool
+
+	mu    sync.Mutex
+	seen  map[string]time.Time
+	stats Stats
+	conn  *net.UDPConn
+	done  chan struct{}
+	wg    sync.WaitGroup
+}
+
+func NewRelay(config Config, logger *wol_log.Logger) *Relay {
+	if config.ListenPort == 0 {
+		config.ListenPort = DefaultListenPort
+	}
+	if config.Send.Port == 0 {
+		config.Send.Port = config.ListenPort
+	}
+
+	r := &Relay{
+		config:  config,
+		logger:  logger,
+		sender:  wol_network.NewSender(),
+		isLocal: isLocalAddress,
+		seen:    make(map[string]time.Time),
+		done:    make(chan struct{}),
+	}
+	r.send = func(packet []byte) error {
+		return r.sender.Send(packet, r.config.Send)
+	}
+	return r
+}
+
+func (r *Relay) Start() error {
+	conn, err := wol_network.ListenUDP(r.config.ListenInterface, r.config.ListenPort)
+	if err != nil {
+		return fmt.Errorf("failed to start relay: %w", err)
+	}
+
+	r.mu.Lock()
+	r.conn = conn
+	r.mu.Unlock()
+
+	r.wg.Add(1)
+	go r.serve(conn)
+
+	from := "any interface"
+	if r.config.ListenInterface != "" {
+		from = r.config.ListenInterface
+	}
+	to := "the default interface"
+	if r.config.Send.Interface != "" {
+		to = r.config.Send.Interface
+	}
+	r.logger.Info("Relay: Forwarding magic packets from UDP port %d on %s to port %d on %s", r.config.ListenPort, from, r.config.Send.Port, to)
+	return nil
+}
+
+func (r *Relay) Stop() {
+	r.mu.Lock()
+	select {
+	case <-r.done:
+	default:
+		close(r.done)
+	}
+	if r.conn != nil {
+		r.conn.Close()
+	}
+	r.mu.Unlock()
+
+	r.wg.Wait()
+	r.sender.Close()
+}
+
+func (r *Relay) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stats
+}
+
+func (r *Relay) serve(conn *net.UDPConn) {
+	defer r.wg.Done()
+
+	buffer := make([]byte, 1500)
+	for {
+		n, addr, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			select {
+			case <-r.done:
+				return
+			default:
+				r.logger.Debug("Relay: Read failed: %v", err)
+				continue
+			}
+		}
+
+		r.handle(append([]byte(nil), buffer[:n]...), addr)
+	}
+}
+
+// handle relays one received datagram and reports whether it was sent.
+func (r *Relay) handle(payload []byte, from *net.UDPAddr) bool {
+	if len(payload) < 102 {
+		r.drop("Relay: Ignoring %d bytes from %s: too short for a magic packet", len(payload), from)
+		return false
+	}
+	// Only the first 102 bytes identify the target; senders may add extra
+	// repetitions or padding, which are relayed as they are
+	mac, _, err := wol_packet.ParseMagicPacket(payload[:102])
+	if err != nil {
+		r.drop("Relay: Ignoring %d bytes from %s: %v", len(payload), from, err)
+		return false
+	}
+	if r.isLocal(from.IP) {
+		r.drop("Relay: Ignoring packet for %s from this host (%s)", mac, from.IP)
+		return false
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	last, seen := r.seen[mac]
+	fresh := !seen || now.Sub(last) >= dedupeWindow
+	if fresh {
+		for seenMAC, at := range r.seen {
+			if now.Sub(at) >= dedupeWindow {
+				delete(r.seen, seenMAC)
+			}
+		}
+		r.seen[mac] = now
+	}
+	r.mu.Unlock()
+	if !fresh {
+		r.drop("Relay: Ignoring repeat of packet for %s from %s", mac, from.IP)
+		return false
+	}
+
+	if err := r.send(payload); err != nil {
+		r.mu.Lock()
+		r.stats.Failed++
+		r.mu.Unlock()
+		r.logger.Error("Relay: Failed to forward packet for %s from %s: %v", mac, from.IP, err)
+		return false
+	}
+
+	r.mu.Lock()
+	r.stats.Relayed++
+	r.mu.Unlock()
+	r.logger.Info("Relay: Forwarded packet for %s from %s", mac, from.IP)
+	return true
+}
+
+func (r *Relay) drop(format string, args ...interface{}) {
+	r.mu.Lock()
+	r.stats.Dropped++
+	r.mu.Unlock()
+	r.logger.Debug(format, args...)
+}
+
+func isLocalAddress(ip net.IP) bool {
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return false
+	}
+	for _, addr := range addrs {
+		if ipnet, ok := addr.(*net.IPNet); ok && ipnet.IP.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
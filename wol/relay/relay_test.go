@@ -0,0 +1,115 @@
+package wol_relay
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+	wol_log "wol-server/wol/log"
+	wol_network "wol-server/wol/network"
+	wol_packet "wol-server/wol/packet"
+)
+
+func magicPacket(t *testing.T, mac string) []byte {
+	t.Helper()
+	packet, err := wol_packet.BuildMagicPacket(mac)
+	if err != nil {
+		t.Fatalf("BuildMagicPacket() error = %v", err)
+	}
+	return packet
+}
+
+func TestRelay_Handle(t *testing.T) {
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+	packet := magicPacket(t, "AA:BB:CC:DD:EE:FF")
+	other := magicPacket(t, "00:11:22:33:44:55")
+	padded, err := wol_packet.BuildMagicPacketOpts("AA:BB:CC:DD:EE:FF", wol_packet.PacketOptions{RepeatCount: 20, Padding: 3})
+	if err != nil {
+		t.Fatalf("BuildMagicPacketOpts() error = %v", err)
+	}
+	remote := &net.UDPAddr{IP: net.IPv4(203, 0, 113, 7), Port: 40000}
+	local := &net.UDPAddr{IP: net.IPv4(192, 168, 1, 2), Port: 40000}
+
+	type datagram struct {
+		payload []byte
+		from    *net.UDPAddr
+	}
+
+	tests := []struct {
+		name        string
+		datagrams   []datagram
+		sendErr     error
+		wantRelayed []bool
+		wantStats   Stats
+	}{
+		{"forwards a magic packet", []datagram{{packet, remote}}, nil, []bool{true}, Stats{Relayed: 1}},
+		{"forwards extra repetitions and padding", []datagram{{padded, remote}}, nil, []bool{true}, Stats{Relayed: 1}},
+		{"ignores other data", []datagram{{[]byte("hello"), remote}}, nil, []bool{false}, Stats{Dropped: 1}},
+		{"ignores own re-broadcast", []datagram{{packet, local}}, nil, []bool{false}, Stats{Dropped: 1}},
+		{"drops repeats", []datagram{{packet, remote}, {packet, remote}, {other, remote}}, nil, []bool{true, false, true}, Stats{Relayed: 2, Dropped: 1}},
+		{"send fails", []datagram{{packet, remote}}, fmt.Errorf("network down"), []bool{false}, Stats{Failed: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			relay := NewRelay(Config{}, logger)
+			relay.isLocal = func(ip net.IP) bool { return ip.Equal(local.IP) }
+
+			relay.send = func([]byte) error { return tt.sendErr }
+
+			for i, d := range tt.datagrams {
+				if got := relay.handle(d.payload, d.from); got != tt.wantRelayed[i] {
+					t.Errorf("handle() #%d = %v, want %v", i, got, tt.wantRelayed[i])
+				}
+			}
+			if stats := relay.Stats(); stats != tt.wantStats {
+				t.Errorf("Stats() = %+v, want %+v", stats, tt.wantStats)
+			}
+		})
+	}
+}
+
+func TestRelay_Forwards(t *testing.T) {
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+
+	sink, err := net.ListenUDP("udp6", &net.UDPAddr{IP: net.IPv6loopback})
+	if err != nil {
+		t.Skipf("IPv6 loopback unavailable: %v", err)
+	}
+	defer sink.Close()
+
+	// Listen on a free port, re-broadcasting over IPv6 to the sink
+	probe, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := probe.LocalAddr().(*net.UDPAddr).Port
+	probe.Close()
+
+	relay := NewRelay(Config{
+		ListenPort: port,
+		Send:       wol_network.SendOptions{Port: sink.LocalAddr().(*net.UDPAddr).Port, IPv6: true, IPv6Address: "::1"},
+	}, logger)
+	relay.isLocal = func(net.IP) bool { return false }
+	if err := relay.Start(); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	defer relay.Stop()
+
+	conn, err := net.Dial("udp4", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.Write(magicPacket(t, "AA:BB:CC:DD:EE:FF"))
+
+	buffer := make([]byte, 256)
+	sink.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := sink.ReadFromUDP(buffer)
+	if err != nil {
+		t.Fatalf("relayed packet not received: %v", err)
+	}
+	if mac, _, err := wol_packet.ParseMagicPacket(buffer[:n]); err != nil || mac != "AA:BB:CC:DD:EE:FF" {
+		t.Errorf("relayed packet = %q, %v, want AA:BB:CC:DD:EE:FF", mac, err)
+	}
+}
@@ -0,0 +1,454 @@
+package wol_schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	wol_log "wol-server/wol/log"
+)
+
+// Schedule wakes a device or a group at the times given either by a cron
+// expression or by a time of day and, optionally, weekdays.
+type Schedule struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Device or Group is the target; exactly one of them is set
+	Device string `json:"device,omitempty"`
+	Group  string `json:"group,omitempty"`
+	// Cron is a five-field cron expression such as "30 7 * * 1-5"
+	Cron string `json:"cron,omitempty"`
+	// Time is HH:MM in the server's time zone, used when Cron is empty
+	Time string `json:"time,omitempty"`
+	// Days such as "mon" or "mon-fri" limit Time to those weekdays; empty
+	// means every day
+	Days    []string `json:"days,omitempty"`
+	Enabled bool     `json:"enabled"`
+	// LastRun and LastError record the most recent run
+	LastRun   time.Time `json:"last_run"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Expression returns the schedule as a cron expression.
+func (s *Schedule) Expression() (string, error) {
+	if s.Cron != "" {
+		return s.Cron, nil
+	}
+
+	clock, err := time.Parse("15:04", s.Time)
+	if err != nil {
+		return "", fmt.Errorf("invalid time %q: expected HH:MM", s.Time)
+	}
+	days := "*"
+	if len(s.Days) > 0 {
+		days = strings.Join(s.Days, ",")
+	}
+	return fmt.Sprintf("%d %d * * %s", clock.Minute(), clock.Hour(), days), nil
+}
+
+func (s *Schedule) cron() (*Cron, error) {
+	expr, err := s.Expression()
+	if err != nil {
+		return nil, err
+	}
+	return ParseCron(expr)
+}
+
+func (s *Schedule) Validate() error {
+	if strings.TrimSpace(s.Name) == "" {
+		return fmt.Errorf("schedule name cannot be empty")
+	}
+	if (s.Device == "") == (s.Group == "") {
+		return fmt.Errorf("schedule must wake either a device or a group")
+	}
+	if (s.Cron == "") == (s.Time == "") {
+		return fmt.Errorf("schedule must have either a cron expression or a time")
+	}
+	if s.Cron != "" && len(s.Days) > 0 {
+		return fmt.Errorf("days can only be given with a time")
+	}
+	_, err := s.cron()
+	return err
+}
+
+// Next returns the schedule's next run after after, or the zero time if
+// it is disabled or never runs.
+func (s *Schedule) Next(after time.Time) time.Time {
+	c, err := s.cron()
+	if err != nil || !s.Enabled {
+		return time.Time{}
+	}
+	return c.Next(after)
+}
+
+func (s *Schedule) clone() *Schedule {
+	clone := *s
+	clone.Days = slices.Clone(s.Days)
+	return &clone
+}
+
+// SharedFile keeps the contents of the schedules file somewhere other than
+// the local disk, such as a key on a server several wol-servers use.
+// ReadFile returns an os.ErrNotExist error while there is nothing there yet.
+type SharedFile interface {
+	ReadFile() ([]byte, error)
+	WriteFile(data []byte) error
+}
+
+// Store keeps schedules in their own file next to the devices. It is safe
+// for concurrent use and returns copies of its schedules.
+type Store struct {
+	mu         sync.Mutex
+	Schedules  map[string]*Schedule `json:"schedules"`
+	configPath string
+	// shared, if set, is where the schedules are kept instead of configPath
+	shared SharedFile
+}
+
+func DefaultSchedulesPath(deviceConfigPath string) string {
+	return filepath.Join(filepath.Dir(deviceConfigPath), "schedules.json")
+}
+
+func NewStore(configPath string) (*Store, error) {
+	return openStore(&Store{configPath: configPath})
+}
+
+// NewSharedStore keeps the schedules in shared, such as a key on a server
+// several wol-servers use, rather than in a local file.
+func NewSharedStore(shared SharedFile) (*Store, error) {
+	return openStore(&Store{shared: shared})
+}
+
+func openStore(store *Store) (*Store, error) {
+	store.Schedules = make(map[string]*Schedule)
+
+	err := store.load()
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load schedule store: %w", err)
+	}
+
+	return store, nil
+}
+
+func (st *Store) AddSchedule(schedule *Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, exists := st.Schedules[schedule.Name]; exists {
+		return fmt.Errorf("schedule '%s' already exists", schedule.Name)
+	}
+
+	added := schedule.clone()
+	added.LastRun, added.LastError = time.Time{}, ""
+	st.Schedules[schedule.Name] = added
+	return st.save()
+}
+
+// UpdateSchedule replaces the schedule called name, keeping its run
+// history.
+func (st *Store) UpdateSchedule(name string, schedule *Schedule) error {
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	existing, exists := st.Schedules[name]
+	if !exists {
+		return fmt.Errorf("schedule '%s' not found", name)
+	}
+	if schedule.Name != name {
+		return fmt.Errorf("schedule '%s' cannot be renamed", name)
+	}
+
+	updated := schedule.clone()
+	updated.LastRun, updated.LastError = existing.LastRun, existing.LastError
+	st.Schedules[name] = updated
+	return st.save()
+}
+
+func (st *Store) RemoveSchedule(name string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	if _, exists := st.Schedules[name]; !exists {
+		return fmt.Errorf("schedule '%s' not found", name)
+	}
+
+	delete(st.Schedules, name)
+	return st.save()
+}
+
+func (st *Store) GetSchedule(name string) (*Schedule, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	schedule, exists := st.Schedules[name]
+	if !exists {
+		return nil, fmt.Errorf("schedule '%s' not found", name)
+	}
+
+	return schedule.clone(), nil
+}
+
+func (st *Store) ListSchedules() []*Schedule {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	schedules := make([]*Schedule, 0, len(st.Schedules))
+	for _, schedule := range st.Schedules {
+		schedules = append(schedules, schedule.clone())
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].Name < schedules[j].Name
+	})
+
+	return schedules
+}
+
+func (st *Store) SetEnabled(name string, enabled bool) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	schedule, exists := st.Schedules[name]
+	if !exists {
+		return fmt.Errorf("schedule '%s' not found", name)
+	}
+
+	schedule.Enabled = enabled
+	return st.save()
+}
+
+// RenameDevice follows a device rename in the schedules that wake it.
+func (st *Store) RenameDevice(oldName, newName string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	changed := false
+	for _, schedule := range st.Schedules {
+		if schedule.Device == oldName {
+			schedule.Device = newName
+			changed = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+	return st.save()
+}
+
+// RemoveDevice removes the schedules that wake a removed device, so they
+// neither fail every run nor wake a later device given the same name. It
+// returns the names of the schedules removed.
+func (st *Store) RemoveDevice(name string) ([]string, error) {
+	return st.removeWhere(func(schedule *Schedule) bool { return schedule.Device == name })
+}
+
+// RemoveGroup removes the schedules that wake a removed group, as
+// RemoveDevice does for a device. It returns the names of the schedules
+// removed.
+func (st *Store) RemoveGroup(name string) ([]string, error) {
+	return st.removeWhere(func(schedule *Schedule) bool { return schedule.Group == name })
+}
+
+func (st *Store) removeWhere(match func(*Schedule) bool) ([]string, error) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	var removed []string
+	for scheduleName, schedule := range st.Schedules {
+		if match(schedule) {
+			delete(st.Schedules, scheduleName)
+			removed = append(removed, scheduleName)
+		}
+	}
+
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	sort.Strings(removed)
+	return removed, st.save()
+}
+
+func (st *Store) recordRun(name string, at time.Time, runErr error) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	schedule, exists := st.Schedules[name]
+	if !exists {
+		// Removed while it ran
+		return nil
+	}
+
+	schedule.LastRun = at
+	schedule.LastError = ""
+	if runErr != nil {
+		schedule.LastError = runErr.Error()
+	}
+	return st.save()
+}
+
+// Reload replaces the schedules in memory with the contents of the file,
+// picking up changes written by another node.
+func (st *Store) Reload() error {
+	fresh := &Store{configPath: st.configPath, shared: st.shared}
+	if err := fresh.load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to reload schedule store: %w", err)
+	}
+	if fresh.Schedules == nil {
+		fresh.Schedules = make(map[string]*Schedule)
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.Schedules = fresh.Schedules
+	return nil
+}
+
+func (st *Store) load() error {
+	var data []byte
+	var err error
+	if st.shared != nil {
+		data, err = st.shared.ReadFile()
+	} else {
+		data, err = os.ReadFile(st.configPath)
+	}
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, st)
+}
+
+func (st *Store) save() error {
+	data, err := json.MarshalIndent(st, "", "	")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedules: %w", err)
+	}
+	if st.shared != nil {
+		return st.shared.WriteFile(data)
+	}
+
+	configDir := filepath.Dir(st.configPath)
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+
+	if err := os.WriteFile(st.configPath, data, 0600); err != nil {
+		return fmt.Errorf("failed to write schedules file: %w", err)
+	}
+
+	return nil
+}
+
+// WakeFunc wakes the target of a schedule.
+type WakeFunc func(schedule *Schedule) error
+
+// Scheduler runs the enabled schedules in a store at the start of each
+// minute they match. Changes to the store take effect from the next
+// minute; runs missed while the server was down are not made up.
+type Scheduler struct {
+	store  *Store
+	wake   WakeFunc
+	leader func() bool
+	logger *wol_log.Logger
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+// NewScheduler returns a scheduler for store. leader, if not nil, is asked
+// before each run, so that only one node of a cluster wakes devices.
+func NewScheduler(store *Store, wake WakeFunc, leader func() bool, logger *wol_log.Logger) *Scheduler {
+	return &Scheduler{
+		store:  store,
+		wake:   wake,
+		leader: leader,
+		logger: logger,
+		stop:   make(chan struct{}),
+	}
+}
+
+func (s *Scheduler) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+
+		for {
+			next := time.Now().Truncate(time.Minute).Add(time.Minute)
+			timer := time.NewTimer(time.Until(next))
+			select {
+			case <-timer.C:
+				s.RunDue(next)
+			case <-s.stop:
+				timer.Stop()
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends the scheduler and waits for wakes in progress.
+func (s *Scheduler) Stop() {
+	close(s.stop)
+	s.wg.Wait()
+}
+
+// RunDue runs, in the background, every enabled schedule that matches
+// minute and returns how many it started.
+func (s *Scheduler) RunDue(minute time.Time) int {
+	if s.leader != nil && !s.leader() {
+		return 0
+	}
+
+	started := 0
+	for _, schedule := range s.store.ListSchedules() {
+		if !schedule.Enabled {
+			continue
+		}
+		c, err := schedule.cron()
+		if err != nil {
+			s.logger.Warn("Schedule: Skipping %s: %v", schedule.Name, err)
+			continue
+		}
+		if !c.Matches(minute) {
+			continue
+		}
+
+		started++
+		s.wg.Add(1)
+		go func(schedule *Schedule) {
+			defer s.wg.Done()
+			s.run(schedule, minute)
+		}(schedule)
+	}
+	return started
+}
+
+func (s *Scheduler) run(schedule *Schedule, at time.Time) {
+	target := schedule.Device
+	if target == "" {
+		target = "group " + schedule.Group
+	}
+	s.logger.Info("Schedule: Running %s (waking %s)", schedule.Name, target)
+
+	err := s.wake(schedule)
+	if err != nil {
+		s.logger.Error("Schedule: %s failed: %v", schedule.Name, err)
+	}
+	if err := s.store.recordRun(schedule.Name, at, err); err != nil {
+		s.logger.Warn("Schedule: Failed to record run of %s: %v", schedule.Name, err)
+	}
+}
@@ -0,0 +1,349 @@
+package wol_schedule
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+	wol_log "wol-server/wol/log"
+)
+
+func TestParseCron(t *testing.T) {
+	tests := []struct {
+		expr    string
+		wantErr bool
+	}{
+		{"* * * * *", false},
+		{"*/15 9-17 * * mon-fri", false},
+		{"30 7 1,15 jan,jul 7", false},
+		{"5/20 * * * *", false},
+		{"@daily", false},
+		{"* * * *", true},
+		{"60 * * * *", true},
+		{"* 24 * * *", true},
+		{"* * 0 * *", true},
+		{"* * * 13 *", true},
+		{"* * * * 8", true},
+		{"*/0 * * * *", true},
+		{"5-1 * * * *", true},
+		{"* * * * someday", true},
+	}
+
+	for _, tt := range tests {
+		if _, err := ParseCron(tt.expr); (err != nil) != tt.wantErr {
+			t.Errorf("ParseCron(%q) error = %v, wantErr %v", tt.expr, err, tt.wantErr)
+		}
+	}
+}
+
+func TestCron_Next(t *testing.T) {
+	// A Friday
+	after := time.Date(2026, 10, 16, 7, 30, 20, 0, time.UTC)
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, 10, 16, 7, 31, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, 10, 16, 7, 45, 0, 0, time.UTC)},
+		{"30 7 * * *", time.Date(2026, 10, 17, 7, 30, 0, 0, time.UTC)},
+		{"0 8 * * mon-fri", time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)},
+		{"0 6 * * 1-5", time.Date(2026, 10, 19, 6, 0, 0, 0, time.UTC)},
+		{"0 9 * * 7", time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, 11, 1, 0, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, 1, 1, 0, 0, 0, 0, time.UTC)},
+		// Either the 1st or a Monday
+		{"0 12 1 * mon", time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 feb *", time.Time{}},
+	}
+
+	for _, tt := range tests {
+		c, err := ParseCron(tt.expr)
+		if err != nil {
+			t.Fatalf("ParseCron(%q) error = %v", tt.expr, err)
+		}
+		if got := c.Next(after); !got.Equal(tt.want) {
+			t.Errorf("Next(%q) = %v, want %v", tt.expr, got, tt.want)
+		}
+		if !tt.want.IsZero() && !c.Matches(tt.want) {
+			t.Errorf("%q does not match its own next time %v", tt.expr, tt.want)
+		}
+	}
+}
+
+func TestSchedule_Validate(t *testing.T) {
+	tests := []struct {
+		schedule Schedule
+		wantExpr string
+		wantErr  bool
+	}{
+		{Schedule{Name: "s", Device: "pc", Cron: "0 7 * * *"}, "0 7 * * *", false},
+		{Schedule{Name: "s", Group: "lab", Time: "07:30"}, "30 7 * * *", false},
+		{Schedule{Name: "s", Device: "pc", Time: "18:05", Days: []string{"mon-fri", "sun"}}, "5 18 * * mon-fri,sun", false},
+		{Schedule{Device: "pc", Time: "07:30"}, "", true},
+		{Schedule{Name: "s", Time: "07:30"}, "", true},
+		{Schedule{Name: "s", Device: "pc", Group: "lab", Time: "07:30"}, "", true},
+		{Schedule{Name: "s", Device: "pc"}, "", true},
+		{Schedule{Name: "s", Device: "pc", Cron: "0 7 * * *", Time: "07:00"}, "", true},
+		{Schedule{Name: "s", Device: "pc", Cron: "0 7 * * *", Days: []string{"mon"}}, "", true},
+		{Schedule{Name: "s", Device: "pc", Time: "25:00"}, "", true},
+		{Schedule{Name: "s", Device: "pc", Time: "07:00", Days: []string{"funday"}}, "", true},
+	}
+
+	for _, tt := range tests {
+		err := tt.schedule.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, wantErr %v", tt.schedule, err, tt.wantErr)
+			continue
+		}
+		if err == nil {
+			if expr, _ := tt.schedule.Expression(); expr != tt.wantExpr {
+				t.Errorf("Expression(%+v) = %q, want %q", tt.schedule, expr, tt.wantExpr)
+			}
+		}
+	}
+}
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	schedule := &Schedule{Name: "morning", Device: "pc", Time: "07:00", Enabled: true}
+	if err := store.AddSchedule(schedule); err != nil {
+		t.Fatalf("AddSchedule() error = %v", err)
+	}
+	if err := store.AddSchedule(schedule); err == nil {
+		t.Error("AddSchedule() of an existing schedule should fail")
+	}
+	if err := store.AddSchedule(&Schedule{Name: "bad", Device: "pc"}); err == nil {
+		t.Error("AddSchedule() of an invalid schedule should fail")
+	}
+
+	ran := time.Date(2026, 10, 16, 7, 0, 0, 0, time.UTC)
+	if err := store.recordRun("morning", ran, fmt.Errorf("no route")); err != nil {
+		t.Fatalf("recordRun() error = %v", err)
+	}
+
+	updated := &Schedule{Name: "morning", Device: "pc", Cron: "0 8 * * *"}
+	if err := store.UpdateSchedule("morning", updated); err != nil {
+		t.Fatalf("UpdateSchedule() error = %v", err)
+	}
+	if err := store.UpdateSchedule("evening", updated); err == nil {
+		t.Error("UpdateSchedule() of a missing schedule should fail")
+	}
+	if err := store.SetEnabled("morning", true); err != nil {
+		t.Fatalf("SetEnabled() error = %v", err)
+	}
+	if err := store.RenameDevice("pc", "desktop"); err != nil {
+		t.Fatalf("RenameDevice() error = %v", err)
+	}
+
+	reopened, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	got, err := reopened.GetSchedule("morning")
+	if err != nil {
+		t.Fatalf("GetSchedule() error = %v", err)
+	}
+	if got.Cron != "0 8 * * *" || got.Time != "" || !got.Enabled || got.Device != "desktop" {
+		t.Errorf("GetSchedule() = %+v, want the updated, enabled schedule for desktop", got)
+	}
+	if !got.LastRun.Equal(ran) || got.LastError != "no route" {
+		t.Errorf("run history = %v, %q, want it kept across updates", got.LastRun, got.LastError)
+	}
+
+	if err := reopened.RemoveSchedule("morning"); err != nil {
+		t.Fatalf("RemoveSchedule() error = %v", err)
+	}
+	if len(reopened.ListSchedules()) != 0 {
+		t.Error("RemoveSchedule() left the schedule")
+	}
+
+	// The first store still has the schedule until it reloads
+	if err := store.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(store.ListSchedules()) != 0 {
+		t.Error("Reload() kept a schedule removed by another store")
+	}
+}
+
+func TestStore_RemoveDevice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	for _, schedule := range []*Schedule{
+		{Name: "morning", Device: "pc", Time: "07:00", Enabled: true},
+		{Name: "evening", Device: "pc", Time: "19:00", Enabled: true},
+		{Name: "nas", Device: "nas", Time: "07:00", Enabled: true},
+		{Name: "lab", Group: "pc", Time: "07:00", Enabled: true},
+	} {
+		if err := store.AddSchedule(schedule); err != nil {
+			t.Fatalf("AddSchedule() error = %v", err)
+		}
+	}
+
+	removed, err := store.RemoveDevice("pc")
+	if err != nil {
+		t.Fatalf("RemoveDevice() error = %v", err)
+	}
+	if want := []string{"evening", "morning"}; !slices.Equal(removed, want) {
+		t.Errorf("RemoveDevice() = %v, want %v", removed, want)
+	}
+
+	reopened, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	var left []string
+	for _, schedule := range reopened.ListSchedules() {
+		left = append(left, schedule.Name)
+	}
+	// A group that happens to share the device's name keeps its schedule
+	if want := []string{"lab", "nas"}; !slices.Equal(left, want) {
+		t.Errorf("schedules left = %v, want %v", left, want)
+	}
+
+	if removed, err := store.RemoveDevice("printer"); err != nil || removed != nil {
+		t.Errorf("RemoveDevice() of an unscheduled device = %v, %v, want nothing", removed, err)
+	}
+}
+
+func TestStore_RemoveGroup(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schedules.json")
+	store, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	for _, schedule := range []*Schedule{
+		{Name: "lab-morning", Group: "lab", Time: "07:00", Enabled: true},
+		{Name: "lab-evening", Group: "lab", Time: "19:00", Enabled: true},
+		{Name: "office", Group: "office", Time: "07:00", Enabled: true},
+		{Name: "pc", Device: "lab", Time: "07:00", Enabled: true},
+	} {
+		if err := store.AddSchedule(schedule); err != nil {
+			t.Fatalf("AddSchedule() error = %v", err)
+		}
+	}
+
+	removed, err := store.RemoveGroup("lab")
+	if err != nil {
+		t.Fatalf("RemoveGroup() error = %v", err)
+	}
+	if want := []string{"lab-evening", "lab-morning"}; !slices.Equal(removed, want) {
+		t.Errorf("RemoveGroup() = %v, want %v", removed, want)
+	}
+
+	reopened, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	var left []string
+	for _, schedule := range reopened.ListSchedules() {
+		left = append(left, schedule.Name)
+	}
+	// A device that happens to share the group's name keeps its schedule
+	if want := []string{"office", "pc"}; !slices.Equal(left, want) {
+		t.Errorf("schedules left = %v, want %v", left, want)
+	}
+
+	if removed, err := store.RemoveGroup("printers"); err != nil || removed != nil {
+		t.Errorf("RemoveGroup() of an unscheduled group = %v, %v, want nothing", removed, err)
+	}
+}
+
+// memoryFile is a SharedFile that two stores can share.
+type memoryFile struct {
+	data []byte
+}
+
+func (m *memoryFile) ReadFile() ([]byte, error) {
+	if m.data == nil {
+		return nil, os.ErrNotExist
+	}
+	return m.data, nil
+}
+
+func (m *memoryFile) WriteFile(data []byte) error {
+	m.data = data
+	return nil
+}
+
+func TestNewSharedStore(t *testing.T) {
+	shared := &memoryFile{}
+	leader, err := NewSharedStore(shared)
+	if err != nil {
+		t.Fatalf("NewSharedStore() error = %v", err)
+	}
+	standby, err := NewSharedStore(shared)
+	if err != nil {
+		t.Fatalf("NewSharedStore() error = %v", err)
+	}
+
+	if err := leader.AddSchedule(&Schedule{Name: "morning", Device: "pc", Time: "07:00", Enabled: true}); err != nil {
+		t.Fatalf("AddSchedule() error = %v", err)
+	}
+	if err := standby.Reload(); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if len(standby.ListSchedules()) != 1 {
+		t.Error("Reload() did not pick up the schedule the other store added")
+	}
+}
+
+func TestScheduler_RunDue(t *testing.T) {
+	store, err := NewStore(filepath.Join(t.TempDir(), "schedules.json"))
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	store.AddSchedule(&Schedule{Name: "weekdays", Device: "pc", Time: "07:30", Days: []string{"mon-fri"}, Enabled: true})
+	store.AddSchedule(&Schedule{Name: "weekends", Group: "lab", Time: "07:30", Days: []string{"sat", "sun"}, Enabled: true})
+	store.AddSchedule(&Schedule{Name: "disabled", Device: "nas", Cron: "* * * * *"})
+
+	var (
+		mu    sync.Mutex
+		woken []string
+	)
+	wake := func(schedule *Schedule) error {
+		mu.Lock()
+		defer mu.Unlock()
+		woken = append(woken, schedule.Name)
+		return nil
+	}
+	leader := true
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+	scheduler := NewScheduler(store, wake, func() bool { return leader }, logger)
+
+	// A Friday
+	friday := time.Date(2026, 10, 16, 7, 30, 0, 0, time.Local)
+	if started := scheduler.RunDue(friday); started != 1 {
+		t.Errorf("RunDue(Friday 07:30) started %d schedules, want 1", started)
+	}
+	if started := scheduler.RunDue(friday.Add(time.Minute)); started != 0 {
+		t.Errorf("RunDue(Friday 07:31) started %d schedules, want 0", started)
+	}
+	leader = false
+	if started := scheduler.RunDue(friday.AddDate(0, 0, 1)); started != 0 {
+		t.Errorf("RunDue() on a standby node started %d schedules, want 0", started)
+	}
+	scheduler.Stop()
+
+	if len(woken) != 1 || woken[0] != "weekdays" {
+		t.Errorf("woke %v, want [weekdays]", woken)
+	}
+	if got, _ := store.GetSchedule("weekdays"); !got.LastRun.Equal(friday) {
+		t.Errorf("LastRun = %v, want %v", got.LastRun, friday)
+	}
+}
@@ -0,0 +1,122 @@
+package wol_server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+	wol_log "wol-server/wol/log"
+)
+
+// Access log formats
+const (
+	// AccessLogText is one "HTTP <method> <path> - <status> - <duration>"
+	// line per request among the other log lines
+	AccessLogText = "text"
+	// AccessLogJSON is one JSON object per request, for Loki or ELK
+	AccessLogJSON = "json"
+)
+
+func ParseAccessLogFormat(format string) (string, error) {
+	switch format {
+	case "", AccessLogText:
+		return AccessLogText, nil
+	case AccessLogJSON:
+		return AccessLogJSON, nil
+	default:
+		return "", fmt.Errorf("invalid access log format %q (expected text or json)", format)
+	}
+}
+
+// AccessLogEntry is a request as logged in the JSON access log format.
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`
+	Level      string    `json:"level"`
+	Method     string    `json:"method"`
+	Path       string    `json:"path"`
+	Status     int       `json:"status"`
+	DurationMs float64   `json:"duration_ms"`
+	// Bytes is the size of the response body
+	Bytes     int    `json:"bytes"`
+	ClientIP  string `json:"client_ip"`
+	RequestID string `json:"request_id,omitempty"`
+	// User is who the request was authenticated as, if anyone
+	User      string `json:"user,omitempty"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+type accessUserKey struct{}
+
+// recordUser notes who r was authenticated as for its access log entry,
+// which is written outside the authentication middleware.
+func recordUser(r *http.Request, username string) {
+	if user, ok := r.Context().Value(accessUserKey{}).(*string); ok {
+		*user = username
+	}
+}
+
+func (s *WoLServer) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		user := new(string)
+
+		next.ServeHTTP(wrapped, r.WithContext(context.WithValue(r.Context(), accessUserKey{}, user)))
+
+		duration := time.Since(start)
+		s.metrics.request(r, wrapped.statusCode, duration)
+
+		level := wol_log.INFO
+		if isProbe(r) && wrapped.statusCode < 400 {
+			level = wol_log.DEBUG
+		}
+
+		if s.config.AccessLogFormat != AccessLogJSON {
+			if level == wol_log.DEBUG {
+				s.log(r).Debug("HTTP %s %s - %d - %v", r.Method, r.URL.Path, wrapped.statusCode, duration)
+			} else {
+				s.log(r).Info("HTTP %s %s - %d - %v", r.Method, r.URL.Path, wrapped.statusCode, duration)
+			}
+			return
+		}
+
+		entry := AccessLogEntry{
+			Time:       start.UTC(),
+			Level:      level.String(),
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Status:     wrapped.statusCode,
+			DurationMs: float64(duration.Microseconds()) / 1000,
+			Bytes:      wrapped.bytes,
+			ClientIP:   clientIP(r),
+			RequestID:  requestID(r.Context()),
+			User:       *user,
+			UserAgent:  r.UserAgent(),
+		}
+		if err := s.config.Logger.JSON(level, entry); err != nil {
+			s.log(r).Warn("HTTP: Failed to write access log entry: %v", err)
+		}
+	})
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	statusCode int
+	bytes      int
+}
+
+func (rw *responseWriter) WriteHeader(code int) {
+	rw.statusCode = code
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *responseWriter) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += n
+	return n, err
+}
+
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
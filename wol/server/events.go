@@ -0,0 +1,131 @@
+package wol_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	wol_events "wol-server/wol/events"
+)
+
+// eventsKeepAlive is how often an idle event stream sends a comment, so
+// proxies do not close it.
+const eventsKeepAlive = 30 * time.Second
+
+// handleEvents streams wake, status and discovery events as server-sent
+// events, or over a WebSocket when the client asks to upgrade. The types
+// query parameter limits the stream to a comma-separated list of types.
+func (s *WoLServer) handleEvents(w http.ResponseWriter, r *http.Request) {
+	var types map[string]bool
+	if raw := r.URL.Query().Get("types"); raw != "" {
+		types = make(map[string]bool)
+		for _, t := range strings.Split(raw, ",") {
+			switch t = strings.TrimSpace(t); t {
+			case wol_events.TypeWake, wol_events.TypeStatus, wol_events.TypeDiscovery:
+				types[t] = true
+			default:
+				s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Unknown event type: %s", t))
+				return
+			}
+		}
+	}
+
+	if isWebSocketRequest(r) {
+		s.streamEventsWebSocket(w, r, types)
+	} else {
+		s.streamEventsSSE(w, r, types)
+	}
+}
+
+func (s *WoLServer) streamEventsSSE(w http.ResponseWriter, r *http.Request, types map[string]bool) {
+	controller := http.NewResponseController(w)
+	// The server's write timeout would otherwise end the stream
+	if err := controller.SetWriteDeadline(time.Time{}); err != nil {
+		s.log(r).Debug("API: Could not clear write deadline: %v", err)
+	}
+
+	events, cancel := s.config.Events.Subscribe()
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := controller.Flush(); err != nil {
+		return
+	}
+
+	keepAlive := time.NewTicker(eventsKeepAlive)
+	defer keepAlive.Stop()
+
+	s.log(r).Debug("API: Event stream opened by %s", r.RemoteAddr)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if types != nil && !types[event.Type] {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				s.log(r).Warn("API: Failed to encode %s event: %v", event.Type, err)
+				continue
+			}
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		case <-r.Context().Done():
+			s.log(r).Debug("API: Event stream closed by %s", r.RemoteAddr)
+			return
+		case <-s.shutdown:
+			return
+		}
+		if err := controller.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func (s *WoLServer) streamEventsWebSocket(w http.ResponseWriter, r *http.Request, types map[string]bool) {
+	conn, rw, err := upgradeWebSocket(w, r)
+	if err != nil {
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	events, cancel := s.config.Events.Subscribe()
+	defer cancel()
+
+	closed := make(chan struct{})
+	go waitWebSocketClose(rw, closed)
+
+	s.log(r).Debug("API: Event stream opened by %s", r.RemoteAddr)
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			if types != nil && !types[event.Type] {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				s.log(r).Warn("API: Failed to encode %s event: %v", event.Type, err)
+				continue
+			}
+			if err := writeWebSocketText(rw, data); err != nil {
+				return
+			}
+		case <-closed:
+			s.log(r).Debug("API: Event stream closed by %s", r.RemoteAddr)
+			return
+		case <-s.shutdown:
+			return
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package wol_server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	wol_device "wol-server/wol/device"
+	wol_i18n "wol-server/wol/i18n"
+	wol_network "wol-server/wol/network"
+
+	"github.com/gorilla/mux"
+)
+
+type CreateGroupRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Members     []string `json:"members,omitempty"`
+}
+
+type GroupMembersRequest struct {
+	Devices []string `json:"devices"`
+}
+
+// GroupWakeResult is the outcome of waking one member of a group.
+type GroupWakeResult struct {
+	Device  string `json:"device"`
+	Success bool   `json:"success"`
+	Message string `json:"message,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Site is set when the wake was forwarded to another site
+	Site   string                  `json:"site,omitempty"`
+	Timing *wol_network.SendTiming `json:"timing,omitempty"`
+}
+
+// unknownDevices returns the names that are not in the device store.
+func (s *WoLServer) unknownDevices(names []string) []string {
+	var unknown []string
+	for _, name := range names {
+		if !s.config.DeviceStore.DeviceExists(name) {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
+
+func (s *WoLServer) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    s.config.Groups.ListGroups(),
+	})
+}
+
+func (s *WoLServer) handleCreateGroup(w http.ResponseWriter, r *http.Request) {
+	var req CreateGroupRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if unknown := s.unknownDevices(req.Members); len(unknown) > 0 {
+		s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Unknown devices: %v", unknown))
+		return
+	}
+
+	if _, err := s.config.Groups.GetGroup(req.Name); err == nil {
+		s.writeJSONError(w, http.StatusConflict, s.tr(w, "Group '%s' already exists", req.Name))
+		return
+	}
+
+	group := &wol_device.Group{Name: req.Name, Description: req.Description, Members: req.Members}
+	if err := s.config.Groups.CreateGroup(group); err != nil {
+		s.log(r).Error("API: Failed to create group %s: %v", req.Name, err)
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var data interface{}
+	if created, err := s.config.Groups.GetGroup(group.Name); err == nil {
+		data = created
+	}
+
+	s.log(r).Info("API: Group %s created", req.Name)
+	s.writeJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Group '%s' created successfully", req.Name),
+		Data:    data,
+	})
+}
+
+func (s *WoLServer) handleGetGroup(w http.ResponseWriter, r *http.Request) {
+	group, err := s.config.Groups.GetGroup(mux.Vars(r)["name"])
+	if err != nil {
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    group,
+	})
+}
+
+func (s *WoLServer) handleRemoveGroup(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	if err := s.config.Groups.RemoveGroup(name); err != nil {
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if s.config.Schedules != nil {
+		removed, err := s.config.Schedules.RemoveGroup(name)
+		if err != nil {
+			s.log(r).Warn("API: Failed to remove the schedules of group %s: %v", name, err)
+		} else if len(removed) > 0 {
+			s.log(r).Info("API: Removed schedules %s with group %s", strings.Join(removed, ", "), name)
+		}
+	}
+
+	s.log(r).Info("API: Group %s removed", name)
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Group '%s' removed successfully", name),
+	})
+}
+
+func (s *WoLServer) handleAddGroupMembers(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	var req GroupMembersRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	if len(req.Devices) == 0 {
+		s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "No devices given"))
+		return
+	}
+	if unknown := s.unknownDevices(req.Devices); len(unknown) > 0 {
+		s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Unknown devices: %v", unknown))
+		return
+	}
+
+	if err := s.config.Groups.AddMembers(name, req.Devices...); err != nil {
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	var data interface{}
+	if group, err := s.config.Groups.GetGroup(name); err == nil {
+		data = group
+	}
+
+	s.log(r).Info("API: Added %v to group %s", req.Devices, name)
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Added %d devices to group '%s'", len(req.Devices), name),
+		Data:    data,
+	})
+}
+
+func (s *WoLServer) handleRemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name, device := vars["name"], vars["device"]
+
+	if err := s.config.Groups.RemoveMember(name, device); err != nil {
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	s.log(r).Info("API: Removed %s from group %s", device, name)
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Device '%s' removed from group '%s'", device, name),
+	})
+}
+
+// handleWakeGroup wakes every member of a group concurrently. It answers
+// 200 when all of them woke, 207 when some did and 502 when none did.
+func (s *WoLServer) handleWakeGroup(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	group, err := s.config.Groups.GetGroup(name)
+	if err != nil {
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if len(group.Members) == 0 {
+		s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Group '%s' has no members", name))
+		return
+	}
+	if !s.checkIntervalQuery(w, r) {
+		return
+	}
+
+	s.log(r).Info("API: Waking group %s (%d devices)", name, len(group.Members))
+
+	// Group wakes are not verified
+	overrides := wakeOverridesFromQuery(r)
+	overrides.Verification = WakeVerification{}
+	results := s.wakeMembers(r.Context(), s.localizer(w), group.Members, s.getPortFromQuery(r), overrides)
+
+	woken := 0
+	for _, result := range results {
+		if result.Success {
+			woken++
+		}
+	}
+
+	status := http.StatusOK
+	switch {
+	case woken == 0:
+		status = http.StatusBadGateway
+	case woken < len(results):
+		status = http.StatusMultiStatus
+	}
+
+	message := s.tr(w, "Woke %d of %d devices in group '%s'", woken, len(results), name)
+	response := APIResponse{
+		Success: woken == len(results),
+		Data:    results,
+	}
+	if response.Success {
+		response.Message = message
+	} else {
+		response.Error = message
+	}
+	s.writeJSONResponse(w, status, response)
+}
+
+// WakeDevices wakes the named devices the way a group wake does, each
+// through its site, power controller or plugin transport as configured,
+// for wakes that do not come from an API request. The error names every
+// device that did not wake.
+func (s *WoLServer) WakeDevices(names []string) error {
+	ctx := withRequestID(context.Background(), newRequestID())
+	s.logger(ctx).Info("Waking %s", strings.Join(names, ", "))
+
+	var errs []error
+	for _, result := range s.wakeMembers(ctx, wol_i18n.New(wol_i18n.DefaultLanguage), names, 0, wakeOverrides{}) {
+		if !result.Success {
+			errs = append(errs, fmt.Errorf("%s: %s", result.Device, result.Error))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// maxGroupWakes is how many devices wakeMembers wakes at once.
+const maxGroupWakes = 8
+
+// wakeMembers wakes the named devices, maxGroupWakes at a time, sending
+// their packets through one Sender's sockets.
+func (s *WoLServer) wakeMembers(ctx context.Context, lang *wol_i18n.Localizer, names []string, port int, overrides wakeOverrides) []GroupWakeResult {
+	sender := wol_network.NewSender()
+	defer sender.Close()
+
+	results := make([]GroupWakeResult, len(names))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(maxGroupWakes, len(names)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				results[i] = s.wakeMember(ctx, lang, sender, names[i], port, overrides)
+			}
+		}()
+	}
+	for i := range names {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return results
+}
+
+func (s *WoLServer) wakeMember(ctx context.Context, lang *wol_i18n.Localizer, sender *wol_network.Sender, name string, port int, overrides wakeOverrides) GroupWakeResult {
+	result := GroupWakeResult{Device: name}
+
+	device, err := s.config.DeviceStore.GetDevice(name)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if device.Archived {
+		result.Error = lang.T("Device '%s' is archived", name)
+		return result
+	}
+	if port == 0 {
+		port = device.Port
+	}
+
+	site, remote, err := s.config.Sites.SiteForDevice(device)
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	if remote {
+		result.Site = site.Name
+		if _, err := s.forwardDeviceWake(ctx, device, site, port); err != nil {
+			result.Error = lang.T("Remote wake failed: %v", err)
+			return result
+		}
+		result.Success = true
+		result.Message = lang.T("Wake packet for '%s' sent via site '%s'", name, site.Name)
+		return result
+	}
+
+	wake, err := s.wakeDevice(ctx, lang, sender, device, port, overrides)
+	if err != nil {
+		result.Error = lang.T("Failed to send wake packet: %v", err)
+		return result
+	}
+	result.Success = true
+	result.Message = wake.message
+	if wake.timing != (wol_network.SendTiming{}) {
+		result.Timing = &wake.timing
+	}
+	return result
+}
@@ -0,0 +1,117 @@
+package wol_server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	wol_network "wol-server/wol/network"
+)
+
+// Readiness component outcomes
+const (
+	ComponentOK      = "ok"
+	ComponentFailing = "failing"
+)
+
+// LivenessData answers GET /healthz, which only shows the process is
+// serving requests.
+type LivenessData struct {
+	Status string `json:"status"`
+	Uptime string `json:"uptime"`
+}
+
+// ComponentStatus is the readiness of one thing the server needs to wake
+// devices.
+type ComponentStatus struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Details string `json:"details,omitempty"`
+	Hint    string `json:"hint,omitempty"`
+}
+
+// ReadinessData answers GET /readyz; Ready is false if any component is
+// failing.
+type ReadinessData struct {
+	Ready      bool              `json:"ready"`
+	Components []ComponentStatus `json:"components"`
+}
+
+// isProbe reports whether r is a liveness or readiness probe, which are
+// frequent enough to only be logged at debug level when they succeed.
+func isProbe(r *http.Request) bool {
+	return r.URL.Path == "/healthz" || r.URL.Path == "/readyz"
+}
+
+func (s *WoLServer) handleLiveness(w http.ResponseWriter, r *http.Request) {
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data: LivenessData{
+			Status: "alive",
+			Uptime: time.Since(s.startTime).Round(time.Second).String(),
+		},
+	})
+}
+
+// handleReadiness checks that the device store can be read and that the
+// interface wake packets leave from is usable, answering 503 if not. With
+// authentication enabled, only authenticated callers see the details.
+func (s *WoLServer) handleReadiness(w http.ResponseWriter, r *http.Request) {
+	readiness := ReadinessData{Ready: true}
+	var failing []string
+	add := func(component ComponentStatus) {
+		if component.Status != ComponentOK {
+			readiness.Ready = false
+			failing = append(failing, component.Name)
+		}
+		readiness.Components = append(readiness.Components, component)
+	}
+
+	store := ComponentStatus{Name: "device_store", Status: ComponentOK}
+	if count, err := s.config.DeviceStore.Check(); err != nil {
+		store.Status, store.Details = ComponentFailing, err.Error()
+	} else {
+		store.Details = fmt.Sprintf("%d devices", count)
+	}
+	add(store)
+
+	check := wol_network.CheckInterface(s.config.Interface, s.config.IPv6)
+	network := ComponentStatus{Name: "network", Status: ComponentOK, Details: check.Details, Hint: check.Hint}
+	if check.Status == wol_network.DiagnosticFail {
+		network.Status = ComponentFailing
+	}
+	add(network)
+
+	if !s.showDetails(r) {
+		for i := range readiness.Components {
+			readiness.Components[i].Details, readiness.Components[i].Hint = "", ""
+		}
+	}
+
+	if !readiness.Ready {
+		s.log(r).Warn("API: Not ready: %s", strings.Join(failing, ", "))
+		s.writeJSONResponse(w, http.StatusServiceUnavailable, APIResponse{
+			Success: false,
+			Error:   s.tr(w, "Not ready: %s", strings.Join(failing, ", ")),
+			Data:    readiness,
+		})
+		return
+	}
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Ready"),
+		Data:    readiness,
+	})
+}
+
+// showDetails reports whether r may see the device count and interface
+// details readiness checks find. Probes need no credentials, so when
+// authentication is enabled anyone else gets only the outcome.
+func (s *WoLServer) showDetails(r *http.Request) bool {
+	if !s.config.Auth.Enabled() {
+		return true
+	}
+	_, err := s.config.Auth.Authenticate(r)
+	return err == nil
+}
@@ -0,0 +1,44 @@
+package wol_server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadinessDetails(t *testing.T) {
+	tests := []struct {
+		name        string
+		auth        bool
+		withKey     bool
+		wantDetails bool
+	}{
+		{"no auth", false, false, true},
+		{"auth without credentials", true, false, false},
+		{"auth with credentials", true, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, ServerConfig{}, tt.auth)
+			r := httptest.NewRequest("GET", "/readyz", nil)
+			if tt.withKey {
+				r.Header.Set("Authorization", "Bearer "+testAPIKey)
+			}
+
+			var body struct {
+				Data ReadinessData `json:"data"`
+			}
+			if err := json.NewDecoder(serve(s, r).Body).Decode(&body); err != nil {
+				t.Fatalf("decoding /readyz: %v", err)
+			}
+			if len(body.Data.Components) == 0 {
+				t.Fatal("/readyz returned no components")
+			}
+			store := body.Data.Components[0]
+			if gotDetails := store.Details != ""; gotDetails != tt.wantDetails {
+				t.Errorf("device_store details = %q, want shown %v", store.Details, tt.wantDetails)
+			}
+		})
+	}
+}
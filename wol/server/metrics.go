@@ -0,0 +1,80 @@
+package wol_server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_metrics "wol-server/wol/metrics"
+
+	"github.com/gorilla/mux"
+)
+
+// serverMetrics are served at /metrics for Prometheus. A nil
+// *serverMetrics records nothing.
+type serverMetrics struct {
+	registry      *wol_metrics.Registry
+	wakes         *wol_metrics.Counter
+	verifications *wol_metrics.Counter
+	requests      *wol_metrics.Counter
+	durations     *wol_metrics.Histogram
+}
+
+func newServerMetrics(s *WoLServer) *serverMetrics {
+	registry := wol_metrics.NewRegistry()
+	m := &serverMetrics{
+		registry:      registry,
+		wakes:         registry.NewCounter("wol_wake_attempts_total", "Wake attempts made through the API, by result.", "result"),
+		verifications: registry.NewCounter("wol_wake_verifications_total", "Checks that a woken device came online, by outcome: online, timeout or error.", "result"),
+		requests:      registry.NewCounter("wol_http_requests_total", "HTTP requests, by method, route and status code.", "method", "route", "code"),
+		durations:     registry.NewHistogram("wol_http_request_duration_seconds", "HTTP request durations, by method and route.", nil, "method", "route"),
+	}
+
+	registry.NewGaugeFunc("wol_devices", "Devices in the store, including archived ones.", func() float64 {
+		return float64(s.config.DeviceStore.GetDeviceCount())
+	})
+	registry.NewGaugeFunc("wol_devices_online", "Active devices last seen online.", func() float64 {
+		return float64(len(s.config.DeviceStore.Search(wol_device.Filter{Status: wol_device.StatusOnline})))
+	})
+	registry.NewGaugeFunc("wol_uptime_seconds", "Seconds since the server started.", func() float64 {
+		return time.Since(s.startTime).Seconds()
+	})
+
+	return m
+}
+
+func (m *serverMetrics) wake(success bool) {
+	if m == nil {
+		return
+	}
+	if success {
+		m.wakes.Inc("success")
+	} else {
+		m.wakes.Inc("failure")
+	}
+}
+
+func (m *serverMetrics) verification(result string) {
+	if m == nil {
+		return
+	}
+	m.verifications.Inc(result)
+}
+
+// request records a finished request under its route template, such as
+// /api/wake/{name}, so device names do not each make a series.
+func (m *serverMetrics) request(r *http.Request, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+
+	route := "other"
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			route = template
+		}
+	}
+
+	m.requests.Inc(r.Method, route, strconv.Itoa(status))
+	m.durations.Observe(duration.Seconds(), r.Method, route)
+}
@@ -0,0 +1,397 @@
+package wol_server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	wol_auth "wol-server/wol/auth"
+	wol_device "wol-server/wol/device"
+	wol_ha "wol-server/wol/ha"
+	wol_monitor "wol-server/wol/monitor"
+	wol_network "wol-server/wol/network"
+
+	"github.com/gorilla/mux"
+)
+
+// apiOperation documents one route for the OpenAPI document. Request and
+// Response are zero values of the request body and of the response's data
+// field; nil means there is none.
+type apiOperation struct {
+	Summary  string
+	Query    []apiParam
+	Request  interface{}
+	Response interface{}
+	// Public operations are served without authentication
+	Public bool
+}
+
+type apiParam struct {
+	Name, Type, Description string
+}
+
+var wakeQuery = []apiParam{
+	{"port", "integer", "UDP port to send to instead of the device's"},
+	{"retries", "integer", "Times to resend a packet that failed to send"},
+	{"retry_interval_ms", "integer", "Pause between resends"},
+	{"copies", "integer", "Copies of the packet to send"},
+	{"copy_interval_ms", "integer", "Pause between copies"},
+	{"verify_capture", "boolean", "Check the packet is seen on the network"},
+	{"verify_ping", "boolean", "Check the device accepts TCP connections (default from the wake policy)"},
+	{"verify_arp", "boolean", "Check the device answers ARP"},
+	{"verify_icmp", "boolean", "Check the device answers ICMP ping"},
+	{"capture_timeout_ms", "integer", "How long to look for the packet"},
+	{"verify_timeout_seconds", "integer", "How long each other check may take"},
+	{"wait_for_online", "boolean", "Answer once the device is online (default true if the wake policy has a wait timeout)"},
+	{"wait_timeout_seconds", "integer", "How long to wait for the device (default the wake policy's, or 90)"},
+}
+
+// apiOperations is keyed by method and mux path template. Routes missing
+// from it are still listed, with only their path parameters.
+var apiOperations = map[string]apiOperation{
+	"GET /api/devices": {Summary: "List devices", Response: []wol_device.Device{}, Query: []apiParam{
+		{"q", "string", "Search query, e.g. \"nas tag:office status:online group:lab\""},
+		{"tag", "string", "Only devices with all of these comma-separated tags"},
+		{"group", "string", "Only members of this device group"},
+		{"status", "string", "Only devices last seen online, offline or unknown"},
+		{"archived", "boolean", "List archived devices instead"},
+		{"sort", "string", "name, added, last-woken or last-seen; ties are ordered by name, so pages are stable"},
+		{"order", "string", "asc or desc"},
+		{"offset", "integer", "Devices to skip"},
+		{"limit", "integer", "Most devices to return; the total is in page.total and X-Total-Count"},
+	}},
+	"POST /api/devices":                  {Summary: "Add a device", Request: AddDeviceRequest{}},
+	"POST /api/devices/bulk":             {Summary: "Add several devices", Request: BulkAddRequest{}, Response: wol_device.BulkResult{}},
+	"GET /api/devices/{name}":            {Summary: "Get a device", Response: wol_device.Device{}},
+	"PUT /api/devices/{name}":            {Summary: "Update a device", Request: UpdateDeviceRequest{}},
+	"DELETE /api/devices/{name}":         {Summary: "Remove a device"},
+	"GET /api/devices/{name}/power":      {Summary: "Get a device's power state from its power controller"},
+	"POST /api/devices/{name}/rename":    {Summary: "Rename a device", Request: RenameDeviceRequest{}},
+	"POST /api/devices/{name}/clone":     {Summary: "Add a copy of a device with a new name and MAC address", Request: CloneDeviceRequest{}, Response: wol_device.Device{}},
+	"POST /api/devices/{name}/archive":   {Summary: "Archive a device"},
+	"POST /api/devices/{name}/unarchive": {Summary: "Restore an archived device"},
+	"POST /api/wake/{name}":              {Summary: "Wake a device", Query: wakeQuery, Response: wol_network.PacketVerificationResult{}},
+	"POST /api/wake":                     {Summary: "Wake a MAC address", Request: WakeRequest{}, Response: wol_network.WaitResult{}},
+	"GET /api/discover": {Summary: "Scan the local subnet for hosts", Response: []DiscoveredDevice{}, Query: []apiParam{
+		{"interface", "string", "Network interface to scan from"},
+	}},
+	"GET /api/network": {Summary: "List network interfaces", Response: NetworkData{}},
+	"GET /api/diagnostics": {Summary: "Check that wake packets can be sent", Response: wol_network.DiagnosticReport{}, Query: []apiParam{
+		{"interface", "string", "Network interface to check"},
+		{"port", "integer", "UDP port to check"},
+	}},
+	"GET /api/health": {Summary: "Report that the server is up", Response: HealthData{}, Public: true},
+	"POST /api/backup": {Summary: "Write a backup archive on the server", Query: []apiParam{
+		{"download", "boolean", "Also send the archive back"},
+	}},
+	"GET /api/sites": {Summary: "List federated sites", Response: []SiteStatus{}, Query: []apiParam{
+		{"health", "boolean", "Check each site's health (default true)"},
+	}},
+	"POST /api/sites":          {Summary: "Add a federated site", Request: AddSiteRequest{}},
+	"DELETE /api/sites/{name}": {Summary: "Remove a federated site"},
+	"GET /api/ha/status": {Summary: "Report high-availability leadership", Response: wol_ha.Status{}, Query: []apiParam{
+		{"local", "boolean", "Report only this node; peers ask with the X-HA-Secret header instead of credentials"},
+	}},
+	"GET /api/monitor/packets": {Summary: "List recently seen magic packets", Response: []wol_monitor.Packet{}, Query: []apiParam{
+		{"limit", "integer", "Most packets to return"},
+	}},
+	"GET /api/monitor/stream": {Summary: "Stream seen magic packets over a WebSocket"},
+	"GET /api/me":             {Summary: "Report who the request is authenticated as", Response: wol_auth.Identity{}},
+	"POST /api/login":         {Summary: "Trade a username and password for a session token", Request: LoginRequest{}, Response: LoginData{}, Public: true},
+	"GET /api/openapi.json":   {Summary: "This document", Public: true},
+	"GET /api/docs":           {Summary: "Swagger UI for this document", Public: true},
+	"GET /":                   {Summary: "Describe the service", Public: true},
+	"GET /metrics":            {Summary: "Prometheus metrics", Public: true},
+	"GET /api/events": {Summary: "Stream wake, status and discovery events as server-sent events, or over a WebSocket", Query: []apiParam{
+		{"types", "string", "Comma-separated event types to stream: wake, status, discovery"},
+	}},
+	"GET /api/devices/{name}/status": {Summary: "Probe a device with ping, ARP and TCP", Response: DeviceStatus{}},
+	"GET /api/status": {Summary: "Probe every device, reusing recent results", Response: []DeviceStatus{}, Query: []apiParam{
+		{"refresh", "boolean", "Probe every device again instead of using cached results; requires operator"},
+	}},
+	"GET /api/groups":                            {Summary: "List device groups", Response: []wol_device.Group{}},
+	"POST /api/groups":                           {Summary: "Create a device group", Request: CreateGroupRequest{}, Response: wol_device.Group{}},
+	"GET /api/groups/{name}":                     {Summary: "Get a device group", Response: wol_device.Group{}},
+	"DELETE /api/groups/{name}":                  {Summary: "Remove a device group"},
+	"POST /api/groups/{name}/members":            {Summary: "Add devices to a group", Request: GroupMembersRequest{}, Response: wol_device.Group{}},
+	"DELETE /api/groups/{name}/members/{device}": {Summary: "Remove a device from a group"},
+	"POST /api/wake/group/{name}": {Summary: "Wake every device in a group concurrently", Response: []GroupWakeResult{}, Query: []apiParam{
+		{"port", "integer", "UDP port to send to instead of each device's own"},
+	}},
+	"GET /api/schedules":                 {Summary: "List wake schedules", Response: []ScheduleStatus{}},
+	"POST /api/schedules":                {Summary: "Add a wake schedule", Request: ScheduleRequest{}, Response: ScheduleStatus{}},
+	"GET /api/schedules/{name}":          {Summary: "Get a wake schedule", Response: ScheduleStatus{}},
+	"PUT /api/schedules/{name}":          {Summary: "Replace a wake schedule", Request: ScheduleRequest{}, Response: ScheduleStatus{}},
+	"DELETE /api/schedules/{name}":       {Summary: "Remove a wake schedule"},
+	"POST /api/schedules/{name}/enable":  {Summary: "Enable a wake schedule"},
+	"POST /api/schedules/{name}/disable": {Summary: "Disable a wake schedule"},
+	"GET /healthz":                       {Summary: "Report that the process is alive, for liveness probes", Response: LivenessData{}, Public: true},
+	"GET /readyz":                        {Summary: "Report whether the device store and network are usable, for readiness probes", Response: ReadinessData{}, Public: true},
+}
+
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <title>wol-server API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+  <script>SwaggerUIBundle({url: "/api/openapi.json", dom_id: "#swagger-ui"});</script>
+</body>
+</html>
+`
+
+var pathParam = regexp.MustCompile(`\{([^}:]+)(:[^}]*)?\}`)
+
+// handleOpenAPI serves an OpenAPI 3 document for the routes registered on
+// this server.
+func (s *WoLServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	doc, err := s.openAPIDocument()
+	if err != nil {
+		s.writeJSONError(w, http.StatusInternalServerError, s.tr(w, "Failed to build API document: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+func (s *WoLServer) handleSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
+
+func (s *WoLServer) openAPIDocument() (map[string]interface{}, error) {
+	schemas := newSchemaSet()
+	paths := make(map[string]map[string]interface{})
+
+	err := s.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+
+		for _, method := range methods {
+			if method == http.MethodOptions {
+				continue
+			}
+			apiPath := pathParam.ReplaceAllString(template, "{$1}")
+			if paths[apiPath] == nil {
+				paths[apiPath] = make(map[string]interface{})
+			}
+			paths[apiPath][strings.ToLower(method)] = s.openAPIOperation(method, template, apiPath, schemas)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "wol-server API",
+			"version": Version,
+		},
+		"paths":      paths,
+		"components": map[string]interface{}{"schemas": schemas.schemas},
+	}
+
+	if s.config.Auth.Enabled() {
+		doc["components"].(map[string]interface{})["securitySchemes"] = map[string]interface{}{
+			"bearerAuth": map[string]interface{}{"type": "http", "scheme": "bearer"},
+			"basicAuth":  map[string]interface{}{"type": "http", "scheme": "basic"},
+			"apiKey":     map[string]interface{}{"type": "apiKey", "in": "header", "name": "X-API-Key"},
+		}
+		doc["security"] = []map[string][]string{{"bearerAuth": {}}, {"basicAuth": {}}, {"apiKey": {}}}
+	}
+
+	return doc, nil
+}
+
+func (s *WoLServer) openAPIOperation(method, template, apiPath string, schemas *schemaSet) map[string]interface{} {
+	op := apiOperations[method+" "+template]
+
+	operation := map[string]interface{}{
+		"operationId": operationID(method, apiPath),
+	}
+	if rest, ok := strings.CutPrefix(apiPath, "/api/"); ok {
+		tag, _, _ := strings.Cut(rest, "/")
+		operation["tags"] = []string{tag}
+	}
+	if op.Summary != "" {
+		operation["summary"] = op.Summary
+	}
+
+	var parameters []map[string]interface{}
+	for _, match := range pathParam.FindAllStringSubmatch(template, -1) {
+		parameters = append(parameters, map[string]interface{}{
+			"name": match[1], "in": "path", "required": true, "schema": map[string]string{"type": "string"},
+		})
+	}
+	for _, param := range op.Query {
+		parameters = append(parameters, map[string]interface{}{
+			"name": param.Name, "in": "query", "description": param.Description, "schema": map[string]string{"type": param.Type},
+		})
+	}
+	if len(parameters) > 0 {
+		operation["parameters"] = parameters
+	}
+
+	if op.Request != nil {
+		operation["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{"schema": schemas.schema(reflect.TypeOf(op.Request))},
+			},
+		}
+	}
+
+	envelope := schemas.schema(reflect.TypeOf(APIResponse{}))
+	success := envelope
+	if op.Response != nil {
+		success = map[string]interface{}{
+			"allOf": []interface{}{envelope, map[string]interface{}{
+				"type":       "object",
+				"properties": map[string]interface{}{"data": schemas.schema(reflect.TypeOf(op.Response))},
+			}},
+		}
+	}
+	operation["responses"] = map[string]interface{}{
+		"200":     map[string]interface{}{"description": "Success", "content": map[string]interface{}{"application/json": map[string]interface{}{"schema": success}}},
+		"default": map[string]interface{}{"description": "Error", "content": map[string]interface{}{"application/json": map[string]interface{}{"schema": envelope}}},
+	}
+
+	if s.config.Auth.Enabled() {
+		if op.Public {
+			operation["security"] = []map[string][]string{}
+		} else {
+			role := requiredRole(&http.Request{Method: method, URL: &url.URL{Path: apiPath}})
+			operation["description"] = fmt.Sprintf("Requires the %s role.", role)
+		}
+	}
+
+	return operation
+}
+
+// operationID turns "POST /api/devices/{name}/clone" into
+// "postDevicesNameClone".
+func operationID(method, apiPath string) string {
+	id := strings.ToLower(method)
+	for _, part := range strings.Split(strings.TrimPrefix(apiPath, "/api"), "/") {
+		part = strings.Trim(part, "{}")
+		for _, word := range strings.FieldsFunc(part, func(r rune) bool { return r == '.' || r == '-' || r == '_' }) {
+			id += strings.ToUpper(word[:1]) + word[1:]
+		}
+	}
+	return id
+}
+
+// schemaSet builds JSON schemas from Go types, putting named structs in
+// components/schemas and referring to them.
+type schemaSet struct {
+	schemas map[string]interface{}
+	names   map[reflect.Type]string
+}
+
+func newSchemaSet() *schemaSet {
+	return &schemaSet{schemas: make(map[string]interface{}), names: make(map[reflect.Type]string)}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (ss *schemaSet) schema(t reflect.Type) map[string]interface{} {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]interface{}{"type": "string", "format": "byte"}
+		}
+		return map[string]interface{}{"type": "array", "items": ss.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": ss.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return ss.structSchema(t)
+		}
+		name, ok := ss.names[t]
+		if !ok {
+			name = t.Name()
+			if _, taken := ss.schemas[name]; taken {
+				name = path.Base(t.PkgPath()) + "." + name
+			}
+			ss.names[t] = name
+			// Placeholder first, in case the type refers to itself
+			ss.schemas[name] = nil
+			ss.schemas[name] = ss.structSchema(t)
+		}
+		return map[string]interface{}{"$ref": "#/components/schemas/" + name}
+	default:
+		// interface{} and anything else JSON can hold
+		return map[string]interface{}{}
+	}
+}
+
+func (ss *schemaSet) structSchema(t reflect.Type) map[string]interface{} {
+	properties := make(map[string]interface{})
+	ss.addFields(t, properties)
+	return map[string]interface{}{"type": "object", "properties": properties}
+}
+
+func (ss *schemaSet) addFields(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+
+		// Embedded structs without a name of their own are flattened, as
+		// encoding/json does
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				ss.addFields(embedded, properties)
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = ss.schema(field.Type)
+	}
+}
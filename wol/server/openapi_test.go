@@ -0,0 +1,160 @@
+package wol_server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	wol_auth "wol-server/wol/auth"
+	wol_backup "wol-server/wol/backup"
+	wol_device "wol-server/wol/device"
+	wol_federation "wol-server/wol/federation"
+	wol_ha "wol-server/wol/ha"
+	wol_log "wol-server/wol/log"
+	wol_monitor "wol-server/wol/monitor"
+	wol_schedule "wol-server/wol/schedule"
+
+	"github.com/gorilla/mux"
+)
+
+// newFullTestServer returns a server with every optional route enabled.
+func newFullTestServer(t *testing.T) *WoLServer {
+	t.Helper()
+
+	dir := t.TempDir()
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+	groups, err := wol_device.NewGroupStore(filepath.Join(dir, "groups.json"))
+	if err != nil {
+		t.Fatalf("NewGroupStore() error = %v", err)
+	}
+	schedules, err := wol_schedule.NewStore(filepath.Join(dir, "schedules.json"))
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	sites, err := wol_federation.NewSiteStore(filepath.Join(dir, "sites.json"))
+	if err != nil {
+		t.Fatalf("NewSiteStore() error = %v", err)
+	}
+	coordinator, err := wol_ha.NewCoordinator(wol_ha.Config{NodeID: "a", Backend: &wol_ha.FileLease{Path: filepath.Join(dir, "leader.json")}}, logger)
+	if err != nil {
+		t.Fatalf("NewCoordinator() error = %v", err)
+	}
+	apiKey, err := wol_auth.NewAPIKeyProvider(testAPIKey)
+	if err != nil {
+		t.Fatalf("NewAPIKeyProvider() error = %v", err)
+	}
+	sessions, err := wol_auth.NewSessionProvider(time.Hour)
+	if err != nil {
+		t.Fatalf("NewSessionProvider() error = %v", err)
+	}
+
+	return newTestServer(t, ServerConfig{
+		Auth:      wol_auth.NewAuthenticator(sessions, apiKey),
+		Sessions:  sessions,
+		Groups:    groups,
+		Schedules: schedules,
+		Sites:     sites,
+		HA:        coordinator,
+		Monitor:   wol_monitor.NewMonitor(wol_monitor.Config{}, nil, logger),
+		Backup:    &wol_backup.Config{Dir: filepath.Join(dir, "backups")},
+		Metrics:   true,
+		SwaggerUI: true,
+	}, false)
+}
+
+func TestAPIOperations_InSyncWithRoutes(t *testing.T) {
+	s := newFullTestServer(t)
+
+	routed := make(map[string]bool)
+	err := s.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			// The CORS preflight route matches any path
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			key := method + " " + template
+			routed[key] = true
+			if _, ok := apiOperations[key]; !ok {
+				t.Errorf("route %s has no apiOperations entry", key)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk() error = %v", err)
+	}
+
+	for key := range apiOperations {
+		if !routed[key] {
+			t.Errorf("apiOperations entry %s has no route", key)
+		}
+	}
+}
+
+func TestOpenAPIDocument(t *testing.T) {
+	s := newFullTestServer(t)
+
+	w := serve(s, httptest.NewRequest("GET", "/api/openapi.json", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /api/openapi.json = %d, want 200", w.Code)
+	}
+
+	var doc struct {
+		OpenAPI string `json:"openapi"`
+		Info    struct {
+			Title   string `json:"title"`
+			Version string `json:"version"`
+		} `json:"info"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	body := w.Body.Bytes()
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("decoding document: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") || doc.Info.Title == "" || doc.Info.Version != Version {
+		t.Errorf("document header = %q %+v, want OpenAPI 3 with a title and version %s", doc.OpenAPI, doc.Info, Version)
+	}
+
+	methods := map[string]bool{"get": true, "post": true, "put": true, "delete": true}
+	for path, operations := range doc.Paths {
+		if !strings.HasPrefix(path, "/") || len(operations) == 0 {
+			t.Errorf("path %q has no operations", path)
+		}
+		for method, raw := range operations {
+			var operation struct {
+				OperationID string                     `json:"operationId"`
+				Responses   map[string]json.RawMessage `json:"responses"`
+			}
+			if err := json.Unmarshal(raw, &operation); err != nil {
+				t.Errorf("%s %s: %v", method, path, err)
+				continue
+			}
+			if !methods[method] || operation.OperationID == "" || operation.Responses["200"] == nil {
+				t.Errorf("%s %s is not a valid operation: %s", method, path, raw)
+			}
+		}
+	}
+	if doc.Paths["/api/devices/{name}"]["put"] == nil {
+		t.Error("document is missing PUT /api/devices/{name}")
+	}
+
+	// Every reference resolves to a schema in the document
+	for _, ref := range strings.Split(string(body), `"$ref":"`)[1:] {
+		ref, _, _ = strings.Cut(ref, `"`)
+		name, ok := strings.CutPrefix(ref, "#/components/schemas/")
+		if _, found := doc.Components.Schemas[name]; !ok || !found {
+			t.Errorf("$ref %q does not resolve", ref)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package wol_server
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit allows each client IP Rate requests per second on average,
+// with bursts of up to Burst requests. A zero Rate disables the limit.
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// RateLimitConfig limits the API as a whole and, more tightly, the wake
+// endpoints, where a runaway script could flood the network with packets.
+type RateLimitConfig struct {
+	API  RateLimit
+	Wake RateLimit
+}
+
+// rateLimiter keeps a token bucket per client IP.
+type rateLimiter struct {
+	limit RateLimit
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(limit RateLimit) *rateLimiter {
+	if limit.Rate <= 0 {
+		return nil
+	}
+	if limit.Burst < 1 {
+		limit.Burst = max(1, int(math.Ceil(limit.Rate)))
+	}
+	return &rateLimiter{limit: limit, buckets: make(map[string]*tokenBucket)}
+}
+
+// allow takes a token from key's bucket, or reports how long until one is
+// available.
+func (l *rateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	burst := float64(l.limit.Burst)
+	if now.Sub(l.lastSweep) > time.Minute {
+		// Buckets that have refilled are the same as new ones
+		for k, b := range l.buckets {
+			if b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate >= burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*l.limit.Rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.limit.Rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (s *WoLServer) rateLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/health" || r.Method == http.MethodOptions {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limiter := s.apiLimiter
+		if r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/api/wake") && s.wakeLimiter != nil {
+			limiter = s.wakeLimiter
+		}
+		if limiter == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+		if ok, wait := limiter.allow(ip, time.Now()); !ok {
+			s.log(r).Warn("API: Rate limit exceeded by %s for %s %s", ip, r.Method, r.URL.Path)
+			seconds := int(math.Ceil(wait.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			s.writeJSONError(w, http.StatusTooManyRequests, s.tr(w, "Too many requests, retry in %d seconds", seconds))
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
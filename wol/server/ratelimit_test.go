@@ -0,0 +1,141 @@
+package wol_server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter_Allow(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		name     string
+		limit    RateLimit
+		at       []time.Duration
+		want     []bool
+		wantWait time.Duration
+	}{
+		{"burst then refused", RateLimit{Rate: 1, Burst: 3}, []time.Duration{0, 0, 0, 0}, []bool{true, true, true, false}, time.Second},
+		{"refills over time", RateLimit{Rate: 2, Burst: 1}, []time.Duration{0, 0, 500 * time.Millisecond}, []bool{true, false, true}, 0},
+		{"partial refill", RateLimit{Rate: 1, Burst: 1}, []time.Duration{0, 250 * time.Millisecond}, []bool{true, false}, 750 * time.Millisecond},
+		{"burst defaults to the rate", RateLimit{Rate: 2}, []time.Duration{0, 0, 0}, []bool{true, true, false}, 500 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := newRateLimiter(tt.limit)
+			var wait time.Duration
+			for i, at := range tt.at {
+				var ok bool
+				ok, wait = l.allow("192.0.2.1", start.Add(at))
+				if ok != tt.want[i] {
+					t.Fatalf("allow() #%d = %v, want %v", i, ok, tt.want[i])
+				}
+			}
+			if wait != tt.wantWait {
+				t.Errorf("allow() wait = %v, want %v", wait, tt.wantWait)
+			}
+		})
+	}
+
+	if newRateLimiter(RateLimit{}) != nil {
+		t.Error("newRateLimiter() with no rate should disable the limit")
+	}
+
+	// Each client has its own bucket
+	l := newRateLimiter(RateLimit{Rate: 1, Burst: 1})
+	l.allow("192.0.2.1", start)
+	if ok, _ := l.allow("192.0.2.2", start); !ok {
+		t.Error("allow() refused a client because of another")
+	}
+}
+
+func TestRateLimiter_Sweep(t *testing.T) {
+	start := time.Now()
+	l := newRateLimiter(RateLimit{Rate: 1, Burst: 5})
+
+	l.allow("192.0.2.1", start)
+	for range 5 {
+		l.allow("192.0.2.2", start.Add(58*time.Second))
+	}
+	if len(l.buckets) != 2 {
+		t.Fatalf("buckets = %d, want 2", len(l.buckets))
+	}
+
+	// A minute on, the first client's bucket has refilled and is dropped,
+	// while the second, drained later, is kept
+	l.allow("192.0.2.3", start.Add(61*time.Second))
+	if _, ok := l.buckets["192.0.2.1"]; ok {
+		t.Error("sweep kept a refilled bucket")
+	}
+	if _, ok := l.buckets["192.0.2.2"]; !ok {
+		t.Error("sweep dropped a bucket that has not refilled")
+	}
+
+	// No second sweep within the minute
+	l.allow("192.0.2.1", start.Add(62*time.Second))
+	l.allow("192.0.2.4", start.Add(100*time.Second))
+	if _, ok := l.buckets["192.0.2.1"]; !ok {
+		t.Error("swept again before a minute had passed")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limits := RateLimitConfig{
+		API:  RateLimit{Rate: 0.001, Burst: 1},
+		Wake: RateLimit{Rate: 0.001, Burst: 2},
+	}
+
+	tests := []struct {
+		name   string
+		config RateLimitConfig
+		method string
+		path   string
+		// want is the status of each of three requests in a row
+		want []int
+	}{
+		{"API limit", limits, "GET", "/api/devices", []int{http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests}},
+		{"wake limit", limits, "POST", "/api/wake/missing", []int{http.StatusNotFound, http.StatusNotFound, http.StatusTooManyRequests}},
+		{"wakes fall back to the API limit", RateLimitConfig{API: limits.API}, "POST", "/api/wake/missing", []int{http.StatusNotFound, http.StatusTooManyRequests, http.StatusTooManyRequests}},
+		{"wake limit only", RateLimitConfig{Wake: limits.Wake}, "GET", "/api/devices", []int{http.StatusOK, http.StatusOK, http.StatusOK}},
+		{"health is exempt", limits, "GET", "/api/health", []int{http.StatusOK, http.StatusOK, http.StatusOK}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServer(t, ServerConfig{RateLimit: tt.config}, false)
+			for i, want := range tt.want {
+				w := serve(s, httptest.NewRequest(tt.method, tt.path, nil))
+				if w.Code != want {
+					t.Fatalf("request #%d = %d, want %d", i, w.Code, want)
+				}
+				if w.Code == http.StatusTooManyRequests && w.Header().Get("Retry-After") == "" {
+					t.Error("429 without Retry-After")
+				}
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddleware_CredentialChecks(t *testing.T) {
+	// /readyz and /metrics check credentials outside /api, so they must not
+	// allow unlimited password guessing
+	limits := RateLimitConfig{API: RateLimit{Rate: 0.001, Burst: 2}}
+
+	for _, path := range []string{"/readyz", "/metrics"} {
+		t.Run(path, func(t *testing.T) {
+			s := newTestServer(t, ServerConfig{RateLimit: limits, Metrics: true}, true)
+			var got []int
+			for range 3 {
+				r := httptest.NewRequest("GET", path, nil)
+				r.Header.Set("X-API-Key", "wrong-key")
+				got = append(got, serve(s, r).Code)
+			}
+			if got[2] != http.StatusTooManyRequests {
+				t.Errorf("GET %s with bad credentials = %v, want the third refused with 429", path, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package wol_server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"regexp"
+	wol_log "wol-server/wol/log"
+)
+
+// RequestIDHeader carries the ID of each request. A client or proxy may
+// send its own; otherwise the server makes one up. Either way it is
+// returned in the response, in the body of error responses and at the
+// start of the request's log lines.
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID limits the IDs taken from clients to ones that are safe
+// to put in logs.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+func newRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+type requestIDKey struct{}
+
+// withRequestID returns ctx carrying the request ID id.
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestID returns the request ID ctx carries, or "".
+func requestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// requestIDMiddleware runs first, so every later middleware and handler
+// finds the ID in the request's context.
+func (s *WoLServer) requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(withRequestID(r.Context(), id)))
+	})
+}
+
+// log returns the server's logger with the ID of r at the start of each
+// line.
+func (s *WoLServer) log(r *http.Request) *wol_log.Logger {
+	return s.logger(r.Context())
+}
+
+// logger returns the server's logger with the request ID ctx carries, if
+// any, at the start of each line.
+func (s *WoLServer) logger(ctx context.Context) *wol_log.Logger {
+	id := requestID(ctx)
+	if id == "" {
+		return s.config.Logger
+	}
+	return s.config.Logger.With("[" + id + "] ")
+}
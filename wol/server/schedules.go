@@ -0,0 +1,207 @@
+package wol_server
+
+import (
+	"net/http"
+	"time"
+	wol_schedule "wol-server/wol/schedule"
+
+	"github.com/gorilla/mux"
+)
+
+// ScheduleRequest creates or replaces a schedule. Enabled defaults to
+// true.
+type ScheduleRequest struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Device      string   `json:"device,omitempty"`
+	Group       string   `json:"group,omitempty"`
+	Cron        string   `json:"cron,omitempty"`
+	Time        string   `json:"time,omitempty"`
+	Days        []string `json:"days,omitempty"`
+	Enabled     *bool    `json:"enabled,omitempty"`
+}
+
+// ScheduleStatus is a schedule with the time it next runs.
+type ScheduleStatus struct {
+	*wol_schedule.Schedule
+	NextRun *time.Time `json:"next_run,omitempty"`
+}
+
+func scheduleStatus(schedule *wol_schedule.Schedule) ScheduleStatus {
+	status := ScheduleStatus{Schedule: schedule}
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		status.NextRun = &next
+	}
+	return status
+}
+
+// schedule turns req into a schedule after checking that its target
+// exists.
+func (s *WoLServer) schedule(w http.ResponseWriter, req ScheduleRequest) (*wol_schedule.Schedule, bool) {
+	schedule := &wol_schedule.Schedule{
+		Name:        req.Name,
+		Description: req.Description,
+		Device:      req.Device,
+		Group:       req.Group,
+		Cron:        req.Cron,
+		Time:        req.Time,
+		Days:        req.Days,
+		Enabled:     req.Enabled == nil || *req.Enabled,
+	}
+	if err := schedule.Validate(); err != nil {
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+
+	switch {
+	case schedule.Device != "" && !s.config.DeviceStore.DeviceExists(schedule.Device):
+		s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "device '%s' not found", schedule.Device))
+		return nil, false
+	case schedule.Group != "" && s.config.Groups == nil:
+		s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Device groups are not enabled"))
+		return nil, false
+	case schedule.Group != "":
+		if _, err := s.config.Groups.GetGroup(schedule.Group); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, err.Error())
+			return nil, false
+		}
+	}
+	return schedule, true
+}
+
+func (s *WoLServer) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules := s.config.Schedules.ListSchedules()
+	statuses := make([]ScheduleStatus, len(schedules))
+	for i, schedule := range schedules {
+		statuses[i] = scheduleStatus(schedule)
+	}
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    statuses,
+	})
+}
+
+func (s *WoLServer) handleCreateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req ScheduleRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	schedule, ok := s.schedule(w, req)
+	if !ok {
+		return
+	}
+	if _, err := s.config.Schedules.GetSchedule(schedule.Name); err == nil {
+		s.writeJSONError(w, http.StatusConflict, s.tr(w, "Schedule '%s' already exists", schedule.Name))
+		return
+	}
+
+	if err := s.config.Schedules.AddSchedule(schedule); err != nil {
+		s.log(r).Error("API: Failed to add schedule %s: %v", schedule.Name, err)
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.log(r).Info("API: Schedule %s added", schedule.Name)
+	s.writeJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Schedule '%s' added successfully", schedule.Name),
+		Data:    scheduleStatus(schedule),
+	})
+}
+
+func (s *WoLServer) handleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := s.config.Schedules.GetSchedule(mux.Vars(r)["name"])
+	if err != nil {
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    scheduleStatus(schedule),
+	})
+}
+
+func (s *WoLServer) handleUpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	var req ScheduleRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+	if req.Name == "" {
+		req.Name = name
+	}
+
+	existing, err := s.config.Schedules.GetSchedule(name)
+	if err != nil {
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if req.Enabled == nil {
+		req.Enabled = &existing.Enabled
+	}
+
+	schedule, ok := s.schedule(w, req)
+	if !ok {
+		return
+	}
+	if err := s.config.Schedules.UpdateSchedule(name, schedule); err != nil {
+		s.log(r).Error("API: Failed to update schedule %s: %v", name, err)
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var data interface{}
+	if updated, err := s.config.Schedules.GetSchedule(name); err == nil {
+		data = scheduleStatus(updated)
+	}
+
+	s.log(r).Info("API: Schedule %s updated", name)
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Schedule '%s' updated successfully", name),
+		Data:    data,
+	})
+}
+
+func (s *WoLServer) handleRemoveSchedule(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	if err := s.config.Schedules.RemoveSchedule(name); err != nil {
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	s.log(r).Info("API: Schedule %s removed", name)
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Schedule '%s' removed successfully", name),
+	})
+}
+
+func (s *WoLServer) handleEnableSchedule(w http.ResponseWriter, r *http.Request) {
+	s.setScheduleEnabled(w, r, true)
+}
+
+func (s *WoLServer) handleDisableSchedule(w http.ResponseWriter, r *http.Request) {
+	s.setScheduleEnabled(w, r, false)
+}
+
+func (s *WoLServer) setScheduleEnabled(w http.ResponseWriter, r *http.Request, enabled bool) {
+	name := mux.Vars(r)["name"]
+
+	if err := s.config.Schedules.SetEnabled(name, enabled); err != nil {
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	message := s.tr(w, "Schedule '%s' disabled", name)
+	if enabled {
+		message = s.tr(w, "Schedule '%s' enabled", name)
+	}
+	s.log(r).Info("API: Schedule %s enabled: %v", name, enabled)
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{Success: true, Message: message})
+}
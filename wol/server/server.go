@@ -3,49 +3,338 @@ package wol_server
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"net/url"
+	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
+	wol_auth "wol-server/wol/auth"
+	wol_backup "wol-server/wol/backup"
 	wol_device "wol-server/wol/device"
+	wol_events "wol-server/wol/events"
+	wol_federation "wol-server/wol/federation"
+	wol_ha "wol-server/wol/ha"
+	wol_i18n "wol-server/wol/i18n"
 	wol_log "wol-server/wol/log"
+	wol_monitor "wol-server/wol/monitor"
 	wol_network "wol-server/wol/network"
+	wol_packet "wol-server/wol/packet"
+	wol_plugin "wol-server/wol/plugin"
+	wol_power "wol-server/wol/power"
+	wol_schedule "wol-server/wol/schedule"
+	wol_status "wol-server/wol/status"
 
 	"github.com/gorilla/mux"
 )
 
+const Version = "1.0.0"
+
+// SecretMask replaces passwords in API responses.
+const SecretMask = "********"
+
+// DefaultMaxBodyBytes is the default limit on JSON request bodies.
+const DefaultMaxBodyBytes = 1 << 20
+
+const DefaultShutdownTimeout = 10 * time.Second
+
+// maxRetries bounds the retries a single API request can ask for.
+const maxRetries = 10
+
+// maxCopies bounds the packet copies a single API request can ask for.
+const maxCopies = 10
+
+// defaultWaitTimeout and maxWaitTimeout bound how long a wake request with
+// wait_for_online holds the connection open.
+const (
+	defaultWaitTimeout = 90 * time.Second
+	maxWaitTimeout     = 5 * time.Minute
+)
+
+// maxIntervalMs bounds the pause between resends or copies a single API
+// request can ask for, so its sends finish within the longest wait.
+const maxIntervalMs = int(maxWaitTimeout / time.Millisecond)
+
 type ServerConfig struct {
 	Port        int
 	Host        string
 	DeviceStore *wol_device.DeviceStore
 	Logger      *wol_log.Logger
 	EnableCORS  bool
+	CORS        CORSConfig
+	Auth        *wol_auth.Authenticator
+	HA          *wol_ha.Coordinator
+	Plugins     *wol_plugin.Manager
+	Sites       *wol_federation.SiteStore
+	Power       *wol_power.Waker
+	Monitor     *wol_monitor.Monitor
+	// Groups enables /api/groups and POST /api/wake/group/{name}
+	Groups *wol_device.GroupStore
+	// Schedules enables /api/schedules; the scheduler that runs them is
+	// started separately
+	Schedules *wol_schedule.Store
+	// Sessions enables POST /api/login, which trades credentials for a
+	// bearer token
+	Sessions *wol_auth.SessionProvider
+	// Backup enables POST /api/backup
+	Backup *wol_backup.Config
+	// TLS serves the API over HTTPS instead of plain HTTP
+	TLS *TLSConfig
+	// RateLimit limits requests per client IP
+	RateLimit RateLimitConfig
+	// MaxBodyBytes limits the size of JSON request bodies (default
+	// DefaultMaxBodyBytes)
+	MaxBodyBytes int64
+	// ShutdownTimeout is how long Stop waits for requests in flight
+	// (default DefaultShutdownTimeout)
+	ShutdownTimeout time.Duration
+	// AccessLogFormat is AccessLogText (the default) or AccessLogJSON
+	AccessLogFormat string
+	// Metrics enables GET /metrics for Prometheus, which needs the same
+	// credentials as the API when authentication is enabled
+	Metrics bool
+	// SwaggerUI serves a Swagger UI page for /api/openapi.json at /api/docs
+	SwaggerUI bool
+	// Events carries wake, status and discovery events to GET /api/events;
+	// share it with the status checker so device status changes show up
+	Events *wol_events.Bus
+	// StatusCacheTTL is how long GET /api/status reuses a device's last
+	// probe (default DefaultStatusCacheTTL)
+	StatusCacheTTL time.Duration
+	// StrictMAC rejects wakes of broadcast and multicast MAC addresses
+	StrictMAC bool
+	// Interface is the default network interface wake packets leave from
+	Interface string
+	// Broadcast is the default broadcast mode; devices may override it
+	Broadcast string
+	// Unicast also sends device wakes to the device's IP address
+	Unicast bool
+	// IPv6 sends to ff02::1 instead of an IPv4 broadcast
+	IPv6 bool
+	// IPv6Address is sent to instead of ff02::1, e.g. ff02::1%eth1 or a
+	// host address
+	IPv6Address string
+	// Raw sends wake packets as raw Ethernet frames (EtherType 0x0842) on
+	// the interface instead of UDP
+	Raw bool
+	// VLAN tags raw frames for devices that do not set a VLAN of their own
+	VLAN int
+	// Packet sets the MAC repetitions and padding of every wake packet;
+	// SecureOn passwords come from the device or request
+	Packet wol_packet.PacketOptions
+	// Retry is the default for resending failed wake packets
+	Retry wol_network.RetryConfig
+	// ExtraPorts are sent to in addition to the wake port
+	ExtraPorts []int
+	// SourceIP and SourcePort bind the socket wake packets are sent from
+	SourceIP   string
+	SourcePort int
+	// Copies and CopyInterval are the default for sending several copies
+	// of each wake packet
+	Copies       int
+	CopyInterval time.Duration
+}
+
+// CORSConfig controls which browser origins may call the API.
+type CORSConfig struct {
+	// AllowedOrigins are origins such as https://home.example.com; "*"
+	// allows any origin, but not together with AllowCredentials
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	AllowCredentials bool
+}
+
+// DefaultCORSConfig allows any origin without credentials.
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedHeaders: []string{"Content-Type", "Authorization", "X-API-Key", RequestIDHeader},
+	}
+}
+
+func (c CORSConfig) Validate() error {
+	if c.AllowCredentials && slices.Contains(c.AllowedOrigins, "*") {
+		return fmt.Errorf("CORS credentials cannot be allowed for every origin; list the allowed origins")
+	}
+	for _, origin := range c.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			return fmt.Errorf("invalid CORS origin %q: expected scheme://host[:port]", origin)
+		}
+	}
+	return nil
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or
+// "" if it is not allowed.
+func (c CORSConfig) allowOrigin(origin string) string {
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" && !c.AllowCredentials {
+			return "*"
+		}
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return origin
+		}
+	}
+	return ""
 }
 
 type WoLServer struct {
 	config     ServerConfig
 	router     *mux.Router
 	httpServer *http.Server
-	startTime  time.Time
+	// redirectServer sends plain HTTP requests to HTTPS
+	redirectServer *http.Server
+	startTime      time.Time
+	// shutdown is closed when Stop is called, to end streams, which
+	// Shutdown does not wait for
+	shutdown chan struct{}
+
+	// apiLimiter and wakeLimiter are nil when their limit is off
+	apiLimiter  *rateLimiter
+	wakeLimiter *rateLimiter
+	metrics     *serverMetrics
+	// checker probes devices for the status endpoints
+	checker  *wol_status.Checker
+	statuses statusCache
+	// diagnosing is held while diagnostics run, since each run listens
+	// on the wake port
+	diagnosing sync.Mutex
 }
 
 type AddDeviceRequest struct {
-	Name        string `json:"name"`
-	MACAddress  string `json:"mac"`
-	Description string `json:"description,omitempty"`
-	IPAddress   string `json:"ip_address,omitempty"`
-	Port        int    `json:"port,omitempty"`
+	Name        string   `json:"name"`
+	MACAddress  string   `json:"mac"`
+	Description string   `json:"description,omitempty"`
+	IPAddress   string   `json:"ip_address,omitempty"`
+	Port        int      `json:"port,omitempty"`
+	Site        string   `json:"site,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// Metadata holds free-form details such as location or owner
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Remote is the URL of a wol-server that wakes the device instead
+	Remote    string `json:"remote,omitempty"`
+	RemoteKey string `json:"remote_key,omitempty"`
+	// WakeAddress is a host[:port] the packet is sent to instead of being
+	// broadcast
+	WakeAddress string `json:"wake_address,omitempty"`
+	// BroadcastAddress and Interface replace the server's for this device
+	BroadcastAddress string `json:"broadcast_address,omitempty"`
+	Interface        string `json:"interface,omitempty"`
+
+	Power  *wol_device.PowerConfig `json:"power,omitempty"`
+	Policy *wol_device.WakePolicy  `json:"policy,omitempty"`
 }
 
 type UpdateDeviceRequest struct {
-	Description string `json:"description,omitempty"`
-	IPAddress   string `json:"ip_address,omitempty"`
-	Port        int    `json:"port,omitempty"`
+	MACAddress string `json:"mac,omitempty"`
+	// Description and IPAddress replace the device's; empty clears them
+	Description *string `json:"description,omitempty"`
+	IPAddress   *string `json:"ip_address,omitempty"`
+	Port        int     `json:"port,omitempty"`
+	Site        *string `json:"site,omitempty"`
+	// Tags replaces the device's tags; an empty list removes them
+	Tags *[]string `json:"tags,omitempty"`
+	// Metadata sets these keys, leaving the others; an empty value removes
+	// a key
+	Metadata map[string]string `json:"metadata,omitempty"`
+	// Remote replaces the remote wol-server URL; empty wakes the device
+	// locally and an empty RemoteKey keeps the current one
+	Remote    *string `json:"remote,omitempty"`
+	RemoteKey string  `json:"remote_key,omitempty"`
+	// WakeAddress replaces the wake address; empty broadcasts again
+	WakeAddress *string `json:"wake_address,omitempty"`
+	// BroadcastAddress and Interface replace the device's; empty uses the
+	// server's again
+	BroadcastAddress *string `json:"broadcast_address,omitempty"`
+	Interface        *string `json:"interface,omitempty"`
+
+	// Power replaces the power control configuration; an empty provider removes it
+	// and an empty password keeps the current one
+	Power *wol_device.PowerConfig `json:"power,omitempty"`
+	// Policy replaces the wake policy; an empty one removes it
+	Policy *wol_device.WakePolicy `json:"policy,omitempty"`
+}
+
+// BulkAddRequest adds several devices at once. Mode is all-or-nothing (the
+// default), best-effort or skip-existing.
+type BulkAddRequest struct {
+	Devices []wol_device.DeviceSpec `json:"devices"`
+	Mode    string                  `json:"mode,omitempty"`
+}
+
+type RenameDeviceRequest struct {
+	Name string `json:"name"`
+}
+
+type CloneDeviceRequest struct {
+	Name      string `json:"name"`
+	MAC       string `json:"mac"`
+	IPAddress string `json:"ip_address,omitempty"`
+}
+
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type LoginData struct {
+	Token     string             `json:"token"`
+	ExpiresAt time.Time          `json:"expires_at"`
+	User      *wol_auth.Identity `json:"user"`
+}
+
+type AddSiteRequest struct {
+	Name    string   `json:"name"`
+	URL     string   `json:"url"`
+	APIKey  string   `json:"api_key,omitempty"`
+	Subnets []string `json:"subnets,omitempty"`
+}
+
+// SiteStatus describes a federation site without exposing its API key.
+type SiteStatus struct {
+	Name      string                       `json:"name"`
+	URL       string                       `json:"url"`
+	Subnets   []string                     `json:"subnets,omitempty"`
+	HasAPIKey bool                         `json:"has_api_key"`
+	Health    *wol_federation.RemoteResult `json:"health,omitempty"`
 }
 
 type WakeRequest struct {
-	MAC  string `json:"mac"`
-	Port int    `json:"port,omitempty"`
+	MAC       string `json:"mac"`
+	Port      int    `json:"port,omitempty"`
+	Interface string `json:"interface,omitempty"`
+	// IP also sends the packet unicast to this address
+	IP       string `json:"ip,omitempty"`
+	IPv6     bool   `json:"ipv6,omitempty"`
+	SecureOn string `json:"secureon,omitempty"`
+	// Retries and RetryIntervalMs override the server's retry defaults
+	Retries         *int `json:"retries,omitempty"`
+	RetryIntervalMs int  `json:"retry_interval_ms,omitempty"`
+	// ExtraPorts are sent to in addition to Port
+	ExtraPorts []int `json:"extra_ports,omitempty"`
+	// WakeAddress sends the packet to this host[:port] instead of
+	// broadcasting it
+	WakeAddress string `json:"wake_address,omitempty"`
+	// Copies and CopyIntervalMs override the server's default number of
+	// packet copies and their spacing
+	Copies         int `json:"copies,omitempty"`
+	CopyIntervalMs int `json:"copy_interval_ms,omitempty"`
+	// WaitForOnline holds the response until the device at IP answers or
+	// WaitTimeoutSeconds (default 90) pass
+	WaitForOnline      bool `json:"wait_for_online,omitempty"`
+	WaitTimeoutSeconds int  `json:"wait_timeout_seconds,omitempty"`
+	WakeVerification
 }
 
 type APIResponse struct {
@@ -53,6 +342,20 @@ type APIResponse struct {
 	Message string      `json:"message,omitempty"`
 	Data    interface{} `json:"data,omitempty"`
 	Error   string      `json:"error,omitempty"`
+	// RequestID is set on errors, to find the request in the server's log
+	RequestID string `json:"request_id,omitempty"`
+	// Page is set on paged lists
+	Page *PageInfo `json:"page,omitempty"`
+}
+
+// PageInfo places a page of a list among all the items that matched.
+type PageInfo struct {
+	Total  int `json:"total"`
+	Offset int `json:"offset"`
+	// Limit is 0 when the page was not limited
+	Limit int `json:"limit"`
+	// NextOffset is the offset of the next page, if there is one
+	NextOffset *int `json:"next_offset,omitempty"`
 }
 
 type HealthData struct {
@@ -62,11 +365,85 @@ type HealthData struct {
 	Version     string `json:"version"`
 }
 
+// DiscoveryTXT describes the API a server with config exposes, as
+// key=value pairs for its mDNS/DNS-SD TXT record.
+func DiscoveryTXT(config ServerConfig) []string {
+	features := []string{"devices", "wake"}
+	if config.Sites != nil {
+		features = append(features, "sites")
+	}
+	if config.Groups != nil {
+		features = append(features, "groups")
+	}
+	if config.Schedules != nil {
+		features = append(features, "schedules")
+	}
+	if config.HA != nil {
+		features = append(features, "ha")
+	}
+	if config.Monitor != nil {
+		features = append(features, "monitor")
+	}
+
+	return []string{
+		"txtvers=1",
+		"version=" + Version,
+		"path=/api",
+		"auth=" + strconv.FormatBool(config.Auth.Enabled()),
+		"tls=" + strconv.FormatBool(config.TLS != nil),
+		"features=" + strings.Join(features, ","),
+	}
+}
+
 func NewWoLServer(config ServerConfig) *WoLServer {
+	if config.Power == nil {
+		config.Power = wol_power.NewWaker(wol_power.Config{}, config.Logger)
+	}
+	if config.MaxBodyBytes <= 0 {
+		config.MaxBodyBytes = DefaultMaxBodyBytes
+	}
+	if config.ShutdownTimeout <= 0 {
+		config.ShutdownTimeout = DefaultShutdownTimeout
+	}
+	if config.Events == nil {
+		config.Events = wol_events.NewBus()
+	}
+	if config.StatusCacheTTL <= 0 {
+		config.StatusCacheTTL = DefaultStatusCacheTTL
+	}
+
 	server := &WoLServer{
-		config:    config,
-		router:    mux.NewRouter(),
-		startTime: time.Now(),
+		config:      config,
+		router:      mux.NewRouter(),
+		startTime:   time.Now(),
+		apiLimiter:  newRateLimiter(config.RateLimit.API),
+		wakeLimiter: newRateLimiter(config.RateLimit.Wake),
+		shutdown:    make(chan struct{}),
+		checker:     wol_status.NewChecker(wol_status.Config{Events: config.Events}, config.DeviceStore, config.Logger),
+	}
+
+	if config.Metrics {
+		server.metrics = newServerMetrics(server)
+	}
+
+	server.httpServer = &http.Server{
+		Addr:         fmt.Sprintf("%s:%d", config.Host, config.Port),
+		Handler:      server.router,
+		ReadTimeout:  15 * time.Second,
+		WriteTimeout: 15 * time.Second,
+		IdleTimeout:  60 * time.Second,
+	}
+	server.httpServer.RegisterOnShutdown(func() {
+		close(server.shutdown)
+	})
+	if config.TLS != nil && config.TLS.RedirectPort > 0 {
+		server.redirectServer = &http.Server{
+			Addr:         fmt.Sprintf("%s:%d", config.Host, config.TLS.RedirectPort),
+			Handler:      redirectToHTTPS(config.Port),
+			ReadTimeout:  15 * time.Second,
+			WriteTimeout: 15 * time.Second,
+			IdleTimeout:  60 * time.Second,
+		}
 	}
 
 	server.setupRoutes()
@@ -78,39 +455,198 @@ func (s *WoLServer) setupRoutes() {
 
 	api.HandleFunc("/devices", s.handleListDevices).Methods("GET")
 	api.HandleFunc("/devices", s.handleAddDevice).Methods("POST")
+	api.HandleFunc("/devices/bulk", s.handleBulkAddDevices).Methods("POST")
 	api.HandleFunc("/devices/{name}", s.handleGetDevice).Methods("GET")
 	api.HandleFunc("/devices/{name}", s.handleUpdateDevice).Methods("PUT")
 	api.HandleFunc("/devices/{name}", s.handleRemoveDevice).Methods("DELETE")
+	api.HandleFunc("/devices/{name}/power", s.handleDevicePower).Methods("GET")
+	api.HandleFunc("/devices/{name}/status", s.handleDeviceStatus).Methods("GET")
+	api.HandleFunc("/devices/{name}/rename", s.handleRenameDevice).Methods("POST")
+	api.HandleFunc("/devices/{name}/clone", s.handleCloneDevice).Methods("POST")
+	api.HandleFunc("/devices/{name}/archive", s.handleArchiveDevice).Methods("POST")
+	api.HandleFunc("/devices/{name}/unarchive", s.handleUnarchiveDevice).Methods("POST")
+
+	if s.config.Groups != nil {
+		api.HandleFunc("/groups", s.handleListGroups).Methods("GET")
+		api.HandleFunc("/groups", s.handleCreateGroup).Methods("POST")
+		api.HandleFunc("/groups/{name}", s.handleGetGroup).Methods("GET")
+		api.HandleFunc("/groups/{name}", s.handleRemoveGroup).Methods("DELETE")
+		api.HandleFunc("/groups/{name}/members", s.handleAddGroupMembers).Methods("POST")
+		api.HandleFunc("/groups/{name}/members/{device}", s.handleRemoveGroupMember).Methods("DELETE")
+		api.HandleFunc("/wake/group/{name}", s.handleWakeGroup).Methods("POST")
+	}
+
+	if s.config.Schedules != nil {
+		api.HandleFunc("/schedules", s.handleListSchedules).Methods("GET")
+		api.HandleFunc("/schedules", s.handleCreateSchedule).Methods("POST")
+		api.HandleFunc("/schedules/{name}", s.handleGetSchedule).Methods("GET")
+		api.HandleFunc("/schedules/{name}", s.handleUpdateSchedule).Methods("PUT")
+		api.HandleFunc("/schedules/{name}", s.handleRemoveSchedule).Methods("DELETE")
+		api.HandleFunc("/schedules/{name}/enable", s.handleEnableSchedule).Methods("POST")
+		api.HandleFunc("/schedules/{name}/disable", s.handleDisableSchedule).Methods("POST")
+	}
 
 	api.HandleFunc("/wake/{name}", s.handleWakeByName).Methods("POST")
 	api.HandleFunc("/wake", s.handleWakeByMAC).Methods("POST")
 
+	api.HandleFunc("/discover", s.handleDiscover).Methods("GET")
+	api.HandleFunc("/network", s.handleNetwork).Methods("GET")
+	api.HandleFunc("/diagnostics", s.handleDiagnostics).Methods("GET")
+
+	api.HandleFunc("/status", s.handleStatus).Methods("GET")
 	api.HandleFunc("/health", s.handleHealth).Methods("GET")
+	api.HandleFunc("/openapi.json", s.handleOpenAPI).Methods("GET")
+	if s.config.SwaggerUI {
+		api.HandleFunc("/docs", s.handleSwaggerUI).Methods("GET")
+	}
+
+	if s.config.Backup != nil {
+		api.HandleFunc("/backup", s.handleBackup).Methods("POST")
+	}
+
+	if s.config.Sites != nil {
+		api.HandleFunc("/sites", s.handleListSites).Methods("GET")
+		api.HandleFunc("/sites", s.handleAddSite).Methods("POST")
+		api.HandleFunc("/sites/{name}", s.handleRemoveSite).Methods("DELETE")
+	}
+
+	if s.config.HA != nil {
+		api.HandleFunc("/ha/status", s.handleHAStatus).Methods("GET")
+	}
+
+	if s.config.Monitor != nil {
+		api.HandleFunc("/monitor/packets", s.handleMonitorPackets).Methods("GET")
+		api.HandleFunc("/monitor/stream", s.handleMonitorStream).Methods("GET")
+	}
+
+	api.HandleFunc("/events", s.handleEvents).Methods("GET")
+
+	// Before authentication, so it also slows down password guessing
+	if s.apiLimiter != nil || s.wakeLimiter != nil {
+		api.Use(s.rateLimitMiddleware)
+	}
+
+	if s.config.Auth.Enabled() {
+		api.HandleFunc("/me", s.handleMe).Methods("GET")
+		if s.config.Sessions != nil {
+			api.HandleFunc("/login", s.handleLogin).Methods("POST")
+		}
+		api.Use(s.authMiddleware)
+	}
+
+	if s.config.HA != nil {
+		api.Use(s.standbyMiddleware)
+	}
+
+	// /readyz and /metrics check credentials too, so they share the API's
+	// limit
+	limited := func(h http.Handler) http.Handler {
+		if s.apiLimiter == nil && s.wakeLimiter == nil {
+			return h
+		}
+		return s.rateLimitMiddleware(h)
+	}
 
 	s.router.HandleFunc("/", s.handleRoot).Methods("GET")
+	s.router.HandleFunc("/healthz", s.handleLiveness).Methods("GET")
+	s.router.Handle("/readyz", limited(http.HandlerFunc(s.handleReadiness))).Methods("GET")
+	if s.metrics != nil {
+		// Device and request counts are for the server's users only
+		metrics := s.metrics.registry.Handler()
+		if s.config.Auth.Enabled() {
+			metrics = s.authMiddleware(metrics)
+		}
+		s.router.Handle("/metrics", limited(metrics)).Methods("GET")
+	}
 
+	s.router.Use(s.requestIDMiddleware)
 	if s.config.EnableCORS {
+		// Middleware only runs for matched routes, so preflight requests
+		// need one of their own
+		s.router.Methods(http.MethodOptions).HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNoContent)
+		})
 		s.router.Use(s.corsMiddleware)
 	}
 	s.router.Use(s.loggingMiddleware)
+	s.router.Use(s.i18nMiddleware)
 }
 
 func (s *WoLServer) handleListDevices(w http.ResponseWriter, r *http.Request) {
-	devices := s.config.DeviceStore.ListDevices()
-	s.config.Logger.Debug("API: Listed %d devices", len(devices))
+	filter, err := wol_device.ParseFilter(r.URL.Query().Get("q"))
+	if err != nil {
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	for _, tag := range r.URL.Query()["tag"] {
+		filter.Tags = append(filter.Tags, strings.Split(tag, ",")...)
+	}
+	filter.Tags = wol_device.NormalizeTags(filter.Tags)
+	if status := r.URL.Query().Get("status"); status != "" {
+		if filter.Status, err = wol_device.ParseStatus(status); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if name := r.URL.Query().Get("group"); name != "" {
+		filter.Group = name
+	}
+	if filter.Group != "" && s.config.Groups == nil {
+		s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Device groups are not enabled"))
+		return
+	}
+	if err := filter.ResolveGroup(s.config.Groups); err != nil {
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if archived, _ := strconv.ParseBool(r.URL.Query().Get("archived")); archived {
+		filter.Archive = wol_device.OnlyArchived
+	}
+
+	opts := wol_device.ListOptions{
+		Filter:     filter,
+		SortBy:     r.URL.Query().Get("sort"),
+		Descending: strings.EqualFold(r.URL.Query().Get("order"), "desc"),
+	}
+	for param, value := range map[string]*int{"offset": &opts.Offset, "limit": &opts.Limit} {
+		if raw := r.URL.Query().Get(param); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 0 {
+				s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Invalid %s: %s", param, raw))
+				return
+			}
+			*value = n
+		}
+	}
+
+	devices, total, err := s.config.DeviceStore.ListDevicesWith(opts)
+	if err != nil {
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+	s.log(r).Debug("API: Listed %d of %d devices", len(devices), total)
+
+	for i, device := range devices {
+		devices[i] = redactDevice(device)
+	}
+
+	page := &PageInfo{Total: total, Offset: opts.Offset, Limit: opts.Limit}
+	if next := opts.Offset + len(devices); opts.Limit > 0 && next < total {
+		page.NextOffset = &next
+	}
 
 	s.writeJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
 		Data:    devices,
-		Message: fmt.Sprintf("Found %d devices", len(devices)),
+		Message: s.tr(w, "Found %d devices", len(devices)),
+		Page:    page,
 	})
 }
 
 func (s *WoLServer) handleAddDevice(w http.ResponseWriter, r *http.Request) {
 	var req AddDeviceRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.config.Logger.Warn("API: Invlaid JSON in add device request: %v", err)
-		s.writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+	if !s.decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -123,17 +659,130 @@ func (s *WoLServer) handleAddDevice(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err := s.config.DeviceStore.AddDevice(req.Name, req.MACAddress, req.Description, req.IPAddress, req.Port)
+	if req.Site != "" {
+		if err := s.validateSite(req.Site); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if req.WakeAddress != "" {
+		if _, _, err := wol_network.ParseWakeAddress(req.WakeAddress); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if req.BroadcastAddress != "" {
+		if _, err := wol_network.ParseBroadcastAddress(req.BroadcastAddress); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	if req.Power != nil {
+		if err := wol_power.ValidateConfig(req.Power); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	// The store checks the rest before it writes, so a bad field adds nothing
+	err := s.config.DeviceStore.CreateDevice(&wol_device.Device{
+		Name:             req.Name,
+		MACAddress:       req.MACAddress,
+		Description:      req.Description,
+		IPAddress:        req.IPAddress,
+		Port:             req.Port,
+		Site:             req.Site,
+		Tags:             req.Tags,
+		Metadata:         req.Metadata,
+		Remote:           req.Remote,
+		RemoteKey:        req.RemoteKey,
+		WakeAddress:      req.WakeAddress,
+		BroadcastAddress: req.BroadcastAddress,
+		Interface:        req.Interface,
+		Power:            req.Power,
+		Policy:           req.Policy,
+	})
+	if err != nil {
+		s.log(r).Error("API: Failed to add device %s: %v", req.Name, err)
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.log(r).Info("API: Device %s added successfully", req.Name)
+	s.writeJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Device '%s' added successfully", req.Name),
+	})
+}
+
+func (s *WoLServer) handleBulkAddDevices(w http.ResponseWriter, r *http.Request) {
+	var req BulkAddRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	mode, err := wol_device.ParseBulkMode(req.Mode)
 	if err != nil {
-		s.config.Logger.Error("API: Failed to add device %s: %v", req.Name, err)
 		s.writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	s.config.Logger.Info("API: Device %s added successfully", req.Name)
+	result, err := s.config.DeviceStore.AddDevices(req.Devices, mode)
+	if result == nil {
+		s.log(r).Error("API: Failed to add devices: %v", err)
+		s.writeJSONError(w, http.StatusInternalServerError, s.tr(w, "Failed to add devices: %v", err))
+		return
+	}
+	if err != nil {
+		// The result still tells the client which entries failed
+		s.log(r).Warn("API: Bulk add failed: %v", err)
+		s.writeJSONResponse(w, http.StatusBadRequest, APIResponse{
+			Success: false,
+			Data:    result,
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	s.log(r).Info("API: Added %d of %d devices", len(result.Added), len(req.Devices))
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Added %d of %d devices", len(result.Added), len(req.Devices)),
+		Data:    result,
+	})
+}
+
+// handleBackup writes a backup archive on the server; with ?download=true
+// the archive is also sent back.
+func (s *WoLServer) handleBackup(w http.ResponseWriter, r *http.Request) {
+	path, manifest, err := wol_backup.Create(*s.config.Backup, s.config.DeviceStore)
+	if err != nil && path == "" {
+		s.log(r).Error("API: Backup failed: %v", err)
+		s.writeJSONError(w, http.StatusInternalServerError, s.tr(w, "Backup failed: %v", err))
+		return
+	}
+	if err != nil {
+		s.log(r).Warn("API: Backup written, but old backups were not removed: %v", err)
+	}
+	s.log(r).Info("API: Backed up %d devices to %s", manifest.Devices, path)
+
+	if download, _ := strconv.ParseBool(r.URL.Query().Get("download")); download {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+		http.ServeFile(w, r, path)
+		return
+	}
+
 	s.writeJSONResponse(w, http.StatusCreated, APIResponse{
 		Success: true,
-		Message: fmt.Sprintf("Device '%s' added successfully", req.Name),
+		Message: s.tr(w, "Backed up %d devices", manifest.Devices),
+		Data: map[string]interface{}{
+			"path":     path,
+			"manifest": manifest,
+		},
 	})
 }
 
@@ -143,15 +792,15 @@ func (s *WoLServer) handleGetDevice(w http.ResponseWriter, r *http.Request) {
 
 	device, err := s.config.DeviceStore.GetDevice(name)
 	if err != nil {
-		s.config.Logger.Debug("API: Device %s not found", name)
+		s.log(r).Debug("API: Device %s not found", name)
 		s.writeJSONError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
-	s.config.Logger.Debug("API: Retrieved device %s", name)
+	s.log(r).Debug("API: Retrieved device %s", name)
 	s.writeJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
-		Data:    device,
+		Data:    redactDevice(device),
 	})
 }
 
@@ -160,146 +809,853 @@ func (s *WoLServer) handleUpdateDevice(w http.ResponseWriter, r *http.Request) {
 	name := vars["name"]
 
 	// Check if device exists
-	device, err := s.config.DeviceStore.GetDevice(name)
-	if err != nil {
-		s.writeJSONError(w, http.StatusNotFound, err.Error())
+	if !s.config.DeviceStore.DeviceExists(name) {
+		s.writeJSONError(w, http.StatusNotFound, s.tr(w, "device '%s' not found", name))
 		return
 	}
 
 	var req UpdateDeviceRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+	if !s.decodeJSON(w, r, &req) {
 		return
 	}
 
-	// Update fields (keep existing MAC and name)
-	description := req.Description
-	if description == "" {
-		description = device.Description
+	if req.Site != nil && *req.Site != "" {
+		if err := s.validateSite(*req.Site); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 	}
 
-	ipAddress := req.IPAddress
-	if ipAddress == "" {
-		ipAddress = device.IPAddress
+	if req.WakeAddress != nil && *req.WakeAddress != "" {
+		if _, _, err := wol_network.ParseWakeAddress(*req.WakeAddress); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 	}
 
-	port := req.Port
-	if port == 0 {
-		port = device.Port
+	if req.BroadcastAddress != nil && *req.BroadcastAddress != "" {
+		if _, err := wol_network.ParseBroadcastAddress(*req.BroadcastAddress); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 	}
 
-	// Remove and re-add device with updated info
-	err = s.config.DeviceStore.RemoveDevice(name)
-	if err != nil {
-		s.writeJSONError(w, http.StatusInternalServerError, "Failed to update device")
-		return
+	if req.Power != nil && req.Power.Provider != "" {
+		if err := wol_power.ValidateConfig(req.Power); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 	}
 
-	err = s.config.DeviceStore.AddDevice(name, device.MACAddress, description, ipAddress, port)
-	if err != nil {
-		s.config.Logger.Error("API: Failed to update device %s: %v", name, err)
-		s.writeJSONError(w, http.StatusInternalServerError, "Failed to update device: "+err.Error())
+	// Empty fields keep their current value
+	fields := wol_device.DeviceUpdate{
+		Description:      req.Description,
+		IPAddress:        req.IPAddress,
+		Site:             req.Site,
+		Tags:             req.Tags,
+		Metadata:         req.Metadata,
+		Remote:           req.Remote,
+		WakeAddress:      req.WakeAddress,
+		BroadcastAddress: req.BroadcastAddress,
+		Interface:        req.Interface,
+		Power:            req.Power,
+		Policy:           req.Policy,
+	}
+	if req.MACAddress != "" {
+		fields.MACAddress = &req.MACAddress
+	}
+	if req.Port != 0 {
+		fields.Port = &req.Port
+	}
+	if req.Remote != nil && req.RemoteKey != "" {
+		fields.RemoteKey = &req.RemoteKey
+	}
+
+	if err := s.config.DeviceStore.UpdateDevice(name, fields); err != nil {
+		// The device may have been removed since it was looked up
+		if !s.config.DeviceStore.DeviceExists(name) {
+			s.writeJSONError(w, http.StatusNotFound, s.tr(w, "device '%s' not found", name))
+			return
+		}
+		s.log(r).Error("API: Failed to update device %s: %v", name, err)
+		s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Failed to update device: %v", err))
 		return
 	}
 
-	s.config.Logger.Info("API: Device %s updated successfully", name)
+	s.log(r).Info("API: Device %s updated successfully", name)
 	s.writeJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
-		Message: fmt.Sprintf("Device '%s' updated successfully", name),
+		Message: s.tr(w, "Device '%s' updated successfully", name),
 	})
 }
 
-func (s *WoLServer) handleRemoveDevice(w http.ResponseWriter, r *http.Request) {
+func (s *WoLServer) handleRenameDevice(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	name := vars["name"]
 
-	err := s.config.DeviceStore.RemoveDevice(name)
-	if err != nil {
-		s.config.Logger.Error("API: Failed to remove device %s: %v", name, err)
-		s.writeJSONError(w, http.StatusNotFound, err.Error())
+	var req RenameDeviceRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if !s.config.DeviceStore.DeviceExists(name) {
+		s.writeJSONError(w, http.StatusNotFound, s.tr(w, "device '%s' not found", name))
+		return
+	}
+
+	if err := s.config.DeviceStore.RenameDevice(name, req.Name); err != nil {
+		s.log(r).Error("API: Failed to rename device %s: %v", name, err)
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	s.config.Logger.Info("API: Device %s removed successfully", name)
+	if s.config.Groups != nil {
+		if err := s.config.Groups.RenameMember(name, req.Name); err != nil {
+			s.log(r).Warn("API: Failed to rename %s in groups: %v", name, err)
+		}
+	}
+	if s.config.Schedules != nil {
+		if err := s.config.Schedules.RenameDevice(name, req.Name); err != nil {
+			s.log(r).Warn("API: Failed to rename %s in schedules: %v", name, err)
+		}
+	}
+
+	s.log(r).Info("API: Device %s renamed to %s", name, req.Name)
 	s.writeJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
-		Message: fmt.Sprintf("Device '%s' removed successfully", name),
+		Message: s.tr(w, "Device '%s' renamed to '%s'", name, req.Name),
 	})
 }
 
-func (s *WoLServer) handleWakeByName(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	name := vars["name"]
-
-	port := s.getPortFromQuery(r)
+func (s *WoLServer) handleCloneDevice(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
 
-	device, err := s.config.DeviceStore.GetDevice(name)
-	if err != nil {
-		s.config.Logger.Debug("API: Wake failed - device %s not found", name)
-		s.writeJSONError(w, http.StatusNotFound, err.Error())
+	var req CloneDeviceRequest
+	if !s.decodeJSON(w, r, &req) {
 		return
 	}
 
-	if port == 0 {
-		port = device.Port
+	if !s.config.DeviceStore.DeviceExists(name) {
+		s.writeJSONError(w, http.StatusNotFound, s.tr(w, "device '%s' not found", name))
+		return
 	}
 
-	s.config.Logger.Info("API: Attempting to wake devise %s (%s) on port %d", name, device.MACAddress, port)
-
-	err = wol_network.SendWakeOnLAN(device.MACAddress, port)
-	if err != nil {
-		s.config.Logger.Error("API: Failed to wake device %s: %v", name, err)
-		s.writeJSONError(w, http.StatusInternalServerError, "Failed to send wake packet: "+err.Error())
+	if err := s.config.DeviceStore.CloneDevice(name, req.Name, req.MAC, req.IPAddress); err != nil {
+		s.log(r).Error("API: Failed to clone device %s: %v", name, err)
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	err = s.config.DeviceStore.UpdateLastWoken(name)
-	if err != nil {
-		s.config.Logger.Warn("API: Failed to update last woken time for %s: %v", name, err)
+	var data interface{}
+	if device, err := s.config.DeviceStore.GetDevice(req.Name); err == nil {
+		data = redactDevice(device)
 	}
 
-	s.config.Logger.Info("API: Device %s woken successfully", name)
-	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+	s.log(r).Info("API: Device %s cloned from %s", req.Name, name)
+	s.writeJSONResponse(w, http.StatusCreated, APIResponse{
 		Success: true,
-		Message: fmt.Sprintf("Wake packet sent to '%s' (%s) on port %d", name, device.MACAddress, port),
+		Message: s.tr(w, "Device '%s' added as a copy of '%s'", req.Name, name),
+		Data:    data,
 	})
 }
 
-func (s *WoLServer) handleWakeByMAC(w http.ResponseWriter, r *http.Request) {
-	var req WakeRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		s.writeJSONError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+func (s *WoLServer) handleArchiveDevice(w http.ResponseWriter, r *http.Request) {
+	s.setArchived(w, r, true)
+}
+
+func (s *WoLServer) handleUnarchiveDevice(w http.ResponseWriter, r *http.Request) {
+	s.setArchived(w, r, false)
+}
+
+func (s *WoLServer) setArchived(w http.ResponseWriter, r *http.Request, archived bool) {
+	name := mux.Vars(r)["name"]
+
+	if !s.config.DeviceStore.DeviceExists(name) {
+		s.writeJSONError(w, http.StatusNotFound, s.tr(w, "device '%s' not found", name))
 		return
 	}
 
-	if req.MAC == "" {
-		s.writeJSONError(w, http.StatusBadRequest, "MAC address is required")
+	if err := s.config.DeviceStore.SetArchived(name, archived); err != nil {
+		s.writeJSONError(w, http.StatusConflict, err.Error())
 		return
 	}
 
-	port := req.Port
-	if port == 0 {
-		port = wol_network.DefaultWoLPort
+	message := s.tr(w, "Device '%s' restored", name)
+	if archived {
+		message = s.tr(w, "Device '%s' archived", name)
 	}
+	s.log(r).Info("API: Device %s archived: %v", name, archived)
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{Success: true, Message: message})
+}
 
-	s.config.Logger.Info("API: Attempting to wake MAC %s on port %d", req.MAC, port)
+func (s *WoLServer) handleRemoveDevice(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
 
-	err := wol_network.SendWakeOnLAN(req.MAC, port)
+	err := s.config.DeviceStore.RemoveDevice(name)
 	if err != nil {
-		s.config.Logger.Error("API: Failed to wake MAC %s: %v", req.MAC, err)
-		s.writeJSONError(w, http.StatusBadRequest, "Failed to send wake packet: "+err.Error())
+		s.log(r).Error("API: Failed to remove device %s: %v", name, err)
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
-	s.config.Logger.Info("API: MAC %s woken successfully", req.MAC)
+	if s.config.Groups != nil {
+		if err := s.config.Groups.RenameMember(name, ""); err != nil {
+			s.log(r).Warn("API: Failed to remove %s from groups: %v", name, err)
+		}
+	}
+	if s.config.Schedules != nil {
+		removed, err := s.config.Schedules.RemoveDevice(name)
+		if err != nil {
+			s.log(r).Warn("API: Failed to remove the schedules of %s: %v", name, err)
+		} else if len(removed) > 0 {
+			s.log(r).Info("API: Removed schedules %s with device %s", strings.Join(removed, ", "), name)
+		}
+	}
+
+	s.log(r).Info("API: Device %s removed successfully", name)
 	s.writeJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
-		Message: fmt.Sprintf("Wake packet sent to %s on port %d", req.MAC, port),
+		Message: s.tr(w, "Device '%s' removed successfully", name),
 	})
 }
 
-func (s *WoLServer) handleHealth(w http.ResponseWriter, r *http.Request) {
-	uptime := time.Since(s.startTime)
+func (s *WoLServer) handleWakeByName(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	name := vars["name"]
+
+	port := s.getPortFromQuery(r)
+	if !s.checkIntervalQuery(w, r) {
+		return
+	}
+
+	device, err := s.config.DeviceStore.GetDevice(name)
+	if err != nil {
+		s.log(r).Debug("API: Wake failed - device %s not found", name)
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if device.Archived {
+		s.writeJSONError(w, http.StatusConflict, s.tr(w, "Device '%s' is archived", name))
+		return
+	}
+
+	if port == 0 {
+		port = device.Port
+	}
+
+	overrides := wakeOverridesFromQuery(r)
+	waitForOnline := r.URL.Query().Get("wait_for_online") == "true"
+	timeoutSeconds, _ := strconv.Atoi(r.URL.Query().Get("wait_timeout_seconds"))
+	policyWait(r, device.Policy, &overrides, &waitForOnline, &timeoutSeconds)
+	if (waitForOnline || overrides.Verification.needsIP()) && device.IPAddress == "" {
+		s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Device '%s' has no IP address to check", name))
+		return
+	}
+
+	site, remote, err := s.config.Sites.SiteForDevice(device)
+	if err != nil {
+		s.writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if remote {
+		s.forwardWake(w, r, device, site, port)
+		return
+	}
+
+	if overrides.Verification.enabled() {
+		s.extendWriteDeadline(w, r, overrides.Verification.timeout())
+	}
+	wake, err := s.wakeDevice(r.Context(), s.localizer(w), nil, device, port, overrides)
+	if err != nil {
+		s.writeJSONError(w, http.StatusInternalServerError, s.tr(w, "Failed to send wake packet: %v", err))
+		return
+	}
+
+	if waitForOnline {
+		s.waitForOnline(w, r, device.MACAddress, device.IPAddress, port, timeoutSeconds, wake.verified)
+		return
+	}
+
+	response := APIResponse{
+		Success: true,
+		Message: wake.message,
+	}
+	switch {
+	case wake.verified != nil:
+		response.Data = wake.verified
+	case wake.timing != (wol_network.SendTiming{}):
+		response.Data = map[string]interface{}{"timing": wake.timing}
+	}
+	s.writeJSONResponse(w, http.StatusOK, response)
+}
+
+// deviceWake is the outcome of waking one local device.
+type deviceWake struct {
+	message  string
+	timing   wol_network.SendTiming
+	verified *wol_network.PacketVerificationResult
+}
+
+// wakeOverrides are a wake request's changes to the server's send
+// settings and the device's wake policy. Wakes the server starts itself,
+// such as scheduled ones, have none.
+type wakeOverrides struct {
+	// Retries is nil to use the policy's or the server's count
+	Retries         *int
+	RetryIntervalMs int
+	// Copies is 0 to use the policy's or the server's count
+	Copies         int
+	CopyIntervalMs int
+	Verification   WakeVerification
+}
+
+// wakeOverridesFromQuery reads the overrides of a wake by name from its
+// query parameters.
+func wakeOverridesFromQuery(r *http.Request) wakeOverrides {
+	query := r.URL.Query()
+	overrides := wakeOverrides{Verification: verificationFromQuery(r)}
+	if n, err := strconv.Atoi(query.Get("retries")); err == nil {
+		overrides.Retries = &n
+	}
+	overrides.RetryIntervalMs, _ = strconv.Atoi(query.Get("retry_interval_ms"))
+	overrides.Copies, _ = strconv.Atoi(query.Get("copies"))
+	overrides.CopyIntervalMs, _ = strconv.Atoi(query.Get("copy_interval_ms"))
+	return overrides
+}
+
+// policyWait uses the device's wake policy for the verify_ping, wait_for_online
+// and wait_timeout_seconds parameters a wake by name did not give, as the
+// CLI does for its flags.
+func policyWait(r *http.Request, policy *wol_device.WakePolicy, overrides *wakeOverrides, waitForOnline *bool, timeoutSeconds *int) {
+	if policy == nil {
+		return
+	}
+	query := r.URL.Query()
+	if policy.VerifyPing != nil && !query.Has("verify_ping") {
+		overrides.Verification.VerifyPing = *policy.VerifyPing
+	}
+	if policy.WaitTimeout <= 0 {
+		return
+	}
+	if !query.Has("wait_for_online") {
+		*waitForOnline = true
+	}
+	if *timeoutSeconds <= 0 {
+		// Round up so a sub-second policy still waits
+		*timeoutSeconds = int((time.Duration(policy.WaitTimeout) + time.Second - 1) / time.Second)
+	}
+}
+
+// wakeDevice wakes a local device on port with overrides, through its
+// power controller if it has one, and records the wake. It logs with the
+// request ID ctx carries and words its message in lang. Packets go out
+// through sender's sockets unless it is nil.
+func (s *WoLServer) wakeDevice(ctx context.Context, lang *wol_i18n.Localizer, sender *wol_network.Sender, device *wol_device.Device, port int, overrides wakeOverrides) (deviceWake, error) {
+	name := device.Name
+	var wake deviceWake
+	logger := s.logger(ctx)
+
+	logger.Info("API: Attempting to wake devise %s (%s) on port %d", name, device.MACAddress, port)
+
+	send := func() error {
+		if device.Transport != "" {
+			return s.config.Plugins.WakeDevice(device, port)
+		}
+		broadcast := device.Broadcast
+		if broadcast == "" {
+			broadcast = s.config.Broadcast
+		}
+		iface := device.Interface
+		if iface == "" {
+			iface = s.config.Interface
+		}
+		vlan := device.VLAN
+		if vlan == 0 {
+			vlan = s.config.VLAN
+		}
+		opts := wol_network.SendOptions{
+			Port:             port,
+			Interface:        iface,
+			Broadcast:        broadcast,
+			BroadcastAddress: device.BroadcastAddress,
+			IPv6:             s.config.IPv6,
+			IPv6Address:      s.config.IPv6Address,
+			Packet:           s.config.Packet,
+			Retry:            s.retryConfig(overrides.Retries, overrides.RetryIntervalMs),
+			ExtraPorts:       s.config.ExtraPorts,
+			SourceIP:         s.config.SourceIP,
+			SourcePort:       s.config.SourcePort,
+			WakeAddress:      device.WakeAddress,
+			Raw:              s.config.Raw,
+			VLAN:             vlan,
+		}
+		opts.Copies, opts.CopyInterval = s.copyConfig(overrides.Copies, overrides.CopyIntervalMs)
+		s.applyPolicy(&opts, device.Policy, overrides)
+		opts.Timing = &wake.timing
+		password, err := device.SecureOnPassword()
+		if err != nil {
+			return err
+		}
+		opts.Packet.Password = password
+		if s.config.Unicast {
+			opts.UnicastIP = device.IPAddress
+		}
+		if overrides.Verification.enabled() {
+			wake.verified, err = s.sendVerified(device.MACAddress, device.IPAddress, opts, overrides.Verification)
+			return err
+		}
+		if sender != nil {
+			return sender.Wake(device.MACAddress, opts)
+		}
+		return wol_network.SendWakeOnLANWith(device.MACAddress, opts)
+	}
+
+	var err error
+	wake.message = lang.T("Wake packet sent to '%s' (%s) on port %d", name, device.MACAddress, port)
+	switch {
+	case device.Power == nil:
+		err = send()
+		s.notifyWake(name, device.MACAddress, err)
+	case device.Power.Mode == wol_power.ModeOnly:
+		err = s.config.Power.PowerOn(device)
+		s.notifyWake(name, device.MACAddress, err, "method", device.Power.Provider)
+		wake.message = lang.T("Powered on '%s' through %s", name, device.Power.Provider)
+	default:
+		if err = send(); err != nil {
+			logger.Warn("API: Wake packet for %s failed (%v), using %s", name, err, device.Power.Provider)
+			err = s.config.Power.PowerOn(device)
+			s.notifyWake(name, device.MACAddress, err, "method", device.Power.Provider)
+			wake.message = lang.T("Powered on '%s' through %s", name, device.Power.Provider)
+		} else {
+			// The fallback waits for the host, so it must not hold up the response
+			go s.powerFallback(device)
+			wake.message += fmt.Sprintf("; %s will power it on if it does not wake", device.Power.Provider)
+		}
+	}
+	if err != nil {
+		logger.Error("API: Failed to wake device %s: %v", name, err)
+		return wake, err
+	}
+
+	if err := s.config.DeviceStore.UpdateLastWoken(name); err != nil {
+		logger.Warn("API: Failed to update last woken time for %s: %v", name, err)
+	}
+
+	logger.Info("API: Device %s woken successfully", name)
+	return wake, nil
+}
+
+func (s *WoLServer) handleDevicePower(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	device, err := s.config.DeviceStore.GetDevice(name)
+	if err != nil {
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if device.Power == nil {
+		s.writeJSONError(w, http.StatusNotFound, s.tr(w, "Device '%s' has no power control configured", name))
+		return
+	}
+
+	on, err := s.config.Power.IsPoweredOn(device)
+	if err != nil {
+		s.log(r).Warn("API: Failed to read power state of %s: %v", name, err)
+		s.writeJSONError(w, http.StatusBadGateway, s.tr(w, "Failed to read power state: %v", err))
+		return
+	}
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data: map[string]interface{}{
+			"device":     name,
+			"provider":   device.Power.Provider,
+			"powered_on": on,
+		},
+	})
+}
+
+func (s *WoLServer) powerFallback(device *wol_device.Device) {
+	result, err := s.config.Power.Fallback(device)
+	if err != nil {
+		s.config.Logger.Error("API: Power fallback for %s failed: %v", device.Name, err)
+		s.notifyWake(device.Name, device.MACAddress, err, "method", device.Power.Provider)
+		return
+	}
+
+	if result.Method != wol_power.MethodWoL {
+		s.notifyWake(device.Name, device.MACAddress, nil, "method", device.Power.Provider)
+	}
+}
+
+// redactDevice returns a copy of device that is safe to return from the
+// API, without its power control password and with its SecureOn password
+// masked.
+func redactDevice(device *wol_device.Device) *wol_device.Device {
+	hasPowerPassword := device.Power != nil && device.Power.Password != ""
+	if !hasPowerPassword && device.SecureOn == "" && device.RemoteKey == "" {
+		return device
+	}
+
+	redacted := *device
+	if hasPowerPassword {
+		power := *device.Power
+		power.Password = ""
+		redacted.Power = &power
+	}
+	if redacted.SecureOn != "" {
+		redacted.SecureOn = SecretMask
+	}
+	if redacted.RemoteKey != "" {
+		redacted.RemoteKey = SecretMask
+	}
+	return &redacted
+}
+
+func (s *WoLServer) handleWakeByMAC(w http.ResponseWriter, r *http.Request) {
+	var req WakeRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if req.MAC == "" {
+		s.writeJSONError(w, http.StatusBadRequest, "MAC address is required")
+		return
+	}
+
+	if s.config.StrictMAC {
+		if err := wol_packet.ValidateMACStrict(req.MAC); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Invalid MAC address: %v", err))
+			return
+		}
+	}
+
+	port := req.Port
+	if port == 0 {
+		port = wol_network.DefaultWoLPort
+	}
+
+	for _, extra := range req.ExtraPorts {
+		if extra < 1 || extra > 65535 {
+			s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Invalid port: %d", extra))
+			return
+		}
+	}
+	for param, ms := range map[string]int{"retry_interval_ms": req.RetryIntervalMs, "copy_interval_ms": req.CopyIntervalMs} {
+		if ms > maxIntervalMs {
+			s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "%s must be at most %d", param, maxIntervalMs))
+			return
+		}
+	}
+
+	var password []byte
+	if req.SecureOn != "" {
+		var err error
+		if password, err = wol_packet.ParsePassword(req.SecureOn); err != nil {
+			s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Invalid SecureOn password: %v", err))
+			return
+		}
+	}
+
+	if req.WaitForOnline && req.IP == "" {
+		s.writeJSONError(w, http.StatusBadRequest, "wait_for_online requires the device's ip")
+		return
+	}
+	if req.needsIP() && req.IP == "" {
+		s.writeJSONError(w, http.StatusBadRequest, "verify_ping, verify_arp and verify_icmp require the device's ip")
+		return
+	}
+
+	iface := req.Interface
+	if iface == "" {
+		iface = s.config.Interface
+	}
+
+	s.log(r).Info("API: Attempting to wake MAC %s on port %d", req.MAC, port)
+
+	copies, copyInterval := s.copyConfig(req.Copies, req.CopyIntervalMs)
+	var timing wol_network.SendTiming
+	opts := wol_network.SendOptions{
+		Port:         port,
+		Interface:    iface,
+		Broadcast:    s.config.Broadcast,
+		UnicastIP:    req.IP,
+		IPv6:         req.IPv6 || s.config.IPv6,
+		IPv6Address:  s.config.IPv6Address,
+		Packet:       s.config.Packet,
+		Retry:        s.retryConfig(req.Retries, req.RetryIntervalMs),
+		ExtraPorts:   append(req.ExtraPorts, s.config.ExtraPorts...),
+		SourceIP:     s.config.SourceIP,
+		SourcePort:   s.config.SourcePort,
+		WakeAddress:  req.WakeAddress,
+		Copies:       copies,
+		CopyInterval: copyInterval,
+		Raw:          s.config.Raw,
+		VLAN:         s.config.VLAN,
+		Timing:       &timing,
+	}
+	opts.Packet.Password = password
+	var verified *wol_network.PacketVerificationResult
+	var err error
+	if req.enabled() {
+		s.extendWriteDeadline(w, r, req.timeout())
+		verified, err = s.sendVerified(req.MAC, req.IP, opts, req.WakeVerification)
+	} else {
+		err = wol_network.SendWakeOnLANWith(req.MAC, opts)
+	}
+	// A configured device with this MAC records the wake like a wake by name
+	name := ""
+	if device, findErr := s.config.DeviceStore.FindByMAC(req.MAC); findErr == nil {
+		name = device.Name
+	}
+	s.notifyWake(name, req.MAC, err)
+	if err != nil {
+		s.log(r).Error("API: Failed to wake MAC %s: %v", req.MAC, err)
+		s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Failed to send wake packet: %v", err))
+		return
+	}
+
+	if name != "" {
+		if err := s.config.DeviceStore.UpdateLastWoken(name); err != nil {
+			s.log(r).Warn("API: Failed to update last woken time for %s: %v", name, err)
+		}
+	}
+
+	s.log(r).Info("API: MAC %s woken successfully", req.MAC)
+
+	if req.WaitForOnline {
+		s.waitForOnline(w, r, req.MAC, req.IP, port, req.WaitTimeoutSeconds, verified)
+		return
+	}
+
+	var data interface{} = map[string]interface{}{"timing": timing}
+	if verified != nil {
+		data = verified
+	}
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Wake packet sent to %s on port %d", req.MAC, port),
+		Data:    data,
+	})
+}
+
+// waitForOnline answers a wake request once the woken device responds or
+// the request's wait timeout passes. A wake that was verified answers with
+// its verification result, with the wait added as the "online" check.
+func (s *WoLServer) waitForOnline(w http.ResponseWriter, r *http.Request, mac, ip string, port, timeoutSeconds int, verified *wol_network.PacketVerificationResult) {
+	timeout := defaultWaitTimeout
+	if timeoutSeconds > 0 {
+		timeout = min(time.Duration(timeoutSeconds)*time.Second, maxWaitTimeout)
+	}
+	s.extendWriteDeadline(w, r, timeout)
+
+	result, err := wol_network.WaitForOnline(mac, ip, timeout, wol_network.WaitOptions{
+		Send: wol_network.SendOptions{Port: port},
+	})
+	if err != nil {
+		s.metrics.verification("error")
+		s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Failed to wait for device: %v", err))
+		return
+	}
+
+	var data interface{} = result
+	if verified != nil {
+		verified.Checks = append(verified.Checks, wol_network.VerifierResult{
+			Name:     "online",
+			Success:  result.Online,
+			Details:  result.Details,
+			Duration: result.Elapsed,
+		})
+		verified.TargetReachable = verified.TargetReachable || result.Online
+		data = verified
+	}
+
+	if !result.Online {
+		s.metrics.verification("timeout")
+		s.log(r).Warn("API: MAC %s did not come online within %v", mac, timeout)
+		s.writeJSONResponse(w, http.StatusGatewayTimeout, APIResponse{
+			Success: false,
+			Error:   s.tr(w, "Wake packet sent, but %s did not come online within %v", ip, timeout),
+			Data:    data,
+		})
+		return
+	}
+
+	s.metrics.verification("online")
+	if device, err := s.config.DeviceStore.FindByMAC(mac); err == nil {
+		if device.Status != wol_device.StatusOnline {
+			s.config.Events.Publish(wol_events.Event{
+				Type:    wol_events.TypeStatus,
+				Device:  device.Name,
+				MAC:     device.MACAddress,
+				Success: true,
+				Status:  wol_device.StatusOnline,
+				Data:    result,
+			})
+		}
+		if err := s.config.DeviceStore.UpdateStatus(device.Name, true, time.Now()); err != nil {
+			s.log(r).Warn("API: Failed to update status for %s: %v", device.Name, err)
+		}
+	}
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "%s is online after %v", ip, result.Elapsed.Round(time.Second)),
+		Data:    data,
+	})
+}
+
+func (s *WoLServer) forwardWake(w http.ResponseWriter, r *http.Request, device *wol_device.Device, site *wol_federation.Site, port int) {
+	result, err := s.forwardDeviceWake(r.Context(), device, site, port)
+	if err != nil {
+		s.writeJSONResponse(w, http.StatusBadGateway, APIResponse{
+			Success: false,
+			Error:   s.tr(w, "Remote wake failed: %v", err),
+			Data:    result,
+		})
+		return
+	}
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Wake packet for '%s' sent via site '%s'", device.Name, site.Name),
+		Data:    result,
+	})
+}
+
+// forwardDeviceWake asks the device's site to wake it, passing on the
+// request ID ctx carries, and records the wake.
+func (s *WoLServer) forwardDeviceWake(ctx context.Context, device *wol_device.Device, site *wol_federation.Site, port int) (*wol_federation.RemoteResult, error) {
+	s.logger(ctx).Info("API: Forwarding wake for %s (%s) to site %s", device.Name, device.MACAddress, site.Name)
+
+	client := wol_federation.NewClient(15 * time.Second)
+	client.RequestID = requestID(ctx)
+	result, err := client.ForwardWake(site, device.MACAddress, port)
+	s.notifyWake(device.Name, device.MACAddress, err)
+	if err != nil {
+		s.logger(ctx).Error("API: Remote wake of %s via site %s failed: %v", device.Name, site.Name, err)
+		return result, err
+	}
+
+	if err := s.config.DeviceStore.UpdateLastWoken(device.Name); err != nil {
+		s.logger(ctx).Warn("API: Failed to update last woken time for %s: %v", device.Name, err)
+	}
+	return result, nil
+}
+
+func (s *WoLServer) validateSite(name string) error {
+	if s.config.Sites == nil {
+		return fmt.Errorf("federation is not enabled")
+	}
+	_, err := s.config.Sites.GetSite(name)
+	return err
+}
+
+func (s *WoLServer) handleListSites(w http.ResponseWriter, r *http.Request) {
+	sites := s.config.Sites.ListSites()
+	statuses := make([]SiteStatus, len(sites))
+
+	checkHealth := r.URL.Query().Get("health") != "false"
+	client := wol_federation.NewClient(5 * time.Second)
+
+	var wg sync.WaitGroup
+	for i, site := range sites {
+		statuses[i] = SiteStatus{
+			Name:      site.Name,
+			URL:       site.URL,
+			Subnets:   site.Subnets,
+			HasAPIKey: site.APIKey != "",
+		}
+
+		if checkHealth {
+			wg.Add(1)
+			go func(i int, site *wol_federation.Site) {
+				defer wg.Done()
+				statuses[i].Health, _ = client.CheckHealth(site)
+			}(i, site)
+		}
+	}
+	wg.Wait()
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    statuses,
+		Message: s.tr(w, "Found %d sites", len(statuses)),
+	})
+}
+
+func (s *WoLServer) handleAddSite(w http.ResponseWriter, r *http.Request) {
+	var req AddSiteRequest
+	if !s.decodeJSON(w, r, &req) {
+		return
+	}
+
+	if err := s.config.Sites.AddSite(req.Name, req.URL, req.APIKey, req.Subnets); err != nil {
+		s.log(r).Error("API: Failed to add site %s: %v", req.Name, err)
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	s.log(r).Info("API: Site %s added successfully", req.Name)
+	s.writeJSONResponse(w, http.StatusCreated, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Site '%s' added successfully", req.Name),
+	})
+}
+
+func (s *WoLServer) handleRemoveSite(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	if err := s.config.Sites.RemoveSite(name); err != nil {
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	s.log(r).Info("API: Site %s removed successfully", name)
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Site '%s' removed successfully", name),
+	})
+}
+
+// notifyWake reports a wake attempt to plugins; details is an optional
+// list of key/value pairs.
+func (s *WoLServer) notifyWake(device, mac string, err error, details ...interface{}) {
+	event := wol_plugin.Event{
+		Type:    wol_plugin.EventWake,
+		Device:  device,
+		MAC:     mac,
+		Success: err == nil,
+	}
+	if err != nil {
+		event.Error = err.Error()
+	}
+
+	if len(details) > 0 {
+		event.Details = make(map[string]interface{})
+		for i := 0; i+1 < len(details); i += 2 {
+			event.Details[fmt.Sprint(details[i])] = details[i+1]
+		}
+	}
+
+	s.metrics.wake(err == nil)
+	s.config.Plugins.Notify(event)
+	published := wol_events.Event{
+		Type:    wol_events.TypeWake,
+		Device:  device,
+		MAC:     mac,
+		Success: event.Success,
+		Error:   event.Error,
+	}
+	if event.Details != nil {
+		published.Data = event.Details
+	}
+	s.config.Events.Publish(published)
+}
+
+func (s *WoLServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	uptime := time.Since(s.startTime)
 
 	s.writeJSONResponse(w, http.StatusOK, APIResponse{
 		Success: true,
@@ -307,21 +1663,276 @@ func (s *WoLServer) handleHealth(w http.ResponseWriter, r *http.Request) {
 			Status:      "healthy",
 			Uptime:      uptime.Round(time.Second).String(),
 			DeviceCount: s.config.DeviceStore.GetDeviceCount(),
-			Version:     "1.0.0",
+			Version:     Version,
 		},
 	})
 }
 
+// handleLogin takes a username and password, as Basic credentials or a
+// LoginRequest, and returns a session token to send as a bearer token
+// instead.
+func (s *WoLServer) handleLogin(w http.ResponseWriter, r *http.Request) {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		var req LoginRequest
+		if !s.decodeJSON(w, r, &req) {
+			return
+		}
+		if req.Username == "" || req.Password == "" {
+			s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Username and password are required"))
+			return
+		}
+		username, password = req.Username, req.Password
+	}
+
+	// Only the password counts: a session token, API key or client
+	// certificate sent along is not traded for a new session
+	login := r.Clone(r.Context())
+	login.Header = http.Header{}
+	login.TLS = nil
+	login.SetBasicAuth(username, password)
+
+	identity, err := s.config.Auth.Authenticate(login)
+	if err != nil {
+		if err != wol_auth.ErrNoCredentials {
+			s.log(r).Warn("API: Sign-in failed: %v", err)
+		}
+		s.writeJSONError(w, http.StatusUnauthorized, s.tr(w, "Invalid username or password"))
+		return
+	}
+
+	token, expires, err := s.config.Sessions.Issue(identity)
+	if err != nil {
+		s.log(r).Error("API: Failed to issue session for %s: %v", identity.Username, err)
+		s.writeJSONError(w, http.StatusInternalServerError, s.tr(w, "Failed to sign in: %v", err))
+		return
+	}
+
+	s.log(r).Info("API: %s signed in as %s", identity.Username, identity.Role)
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Signed in as %s", identity.Username),
+		Data:    LoginData{Token: token, ExpiresAt: expires, User: identity},
+	})
+}
+
+// handleMe returns who the request is authenticated as and their role.
+func (s *WoLServer) handleMe(w http.ResponseWriter, r *http.Request) {
+	identity, _ := wol_auth.IdentityFromContext(r.Context())
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    identity,
+	})
+}
+
+// NetworkData is the default-route interface and every up interface.
+type NetworkData struct {
+	Default    *wol_network.NetworkInfo    `json:"default,omitempty"`
+	Interfaces []wol_network.InterfaceInfo `json:"interfaces"`
+}
+
+func (s *WoLServer) handleNetwork(w http.ResponseWriter, r *http.Request) {
+	interfaces, err := wol_network.ListInterfaces()
+	if err != nil {
+		s.writeJSONError(w, http.StatusInternalServerError, s.tr(w, "Failed to list interfaces: %v", err))
+		return
+	}
+
+	data := NetworkData{Interfaces: interfaces}
+	if info, err := wol_network.VerifyNetworkConnectivity(); err == nil {
+		data.Default = info
+	} else {
+		s.log(r).Debug("API: No default route information: %v", err)
+	}
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    data,
+		Message: s.tr(w, "Found %d interfaces", len(interfaces)),
+	})
+}
+
+func (s *WoLServer) handleDiagnostics(w http.ResponseWriter, r *http.Request) {
+	iface := r.URL.Query().Get("interface")
+	if iface == "" {
+		iface = s.config.Interface
+	}
+	port, _ := strconv.Atoi(r.URL.Query().Get("port"))
+
+	if !s.diagnosing.TryLock() {
+		s.writeJSONError(w, http.StatusConflict, s.tr(w, "Network diagnostics are already running"))
+		return
+	}
+	defer s.diagnosing.Unlock()
+
+	report := wol_network.RunDiagnosticsWith(wol_network.DiagnosticOptions{Interface: iface, Port: port})
+	message := s.tr(w, "All %d checks passed", len(report.Checks))
+	if !report.Healthy {
+		message = s.tr(w, "Network diagnostics found problems")
+	}
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    report,
+		Message: message,
+	})
+}
+
+// DiscoveredDevice is a host found by a subnet scan. Device names the
+// configured device with the same MAC address, if any.
+type DiscoveredDevice struct {
+	wol_network.Candidate
+	Device string `json:"device,omitempty"`
+}
+
+func (s *WoLServer) handleDiscover(w http.ResponseWriter, r *http.Request) {
+	iface := r.URL.Query().Get("interface")
+	if iface == "" {
+		iface = s.config.Interface
+	}
+
+	candidates, err := wol_network.DiscoverDevicesWith(wol_network.DiscoverOptions{Interface: iface})
+	if err != nil {
+		s.log(r).Error("API: Device discovery failed: %v", err)
+		s.writeJSONError(w, http.StatusInternalServerError, s.tr(w, "Discovery failed: %v", err))
+		return
+	}
+
+	known := make(map[string]string)
+	for _, device := range s.config.DeviceStore.Search(wol_device.Filter{Archive: wol_device.WithArchived}) {
+		known[wol_packet.CleanMAC(device.MACAddress)] = device.Name
+	}
+
+	now := time.Now()
+	found := make([]DiscoveredDevice, len(candidates))
+	for i, candidate := range candidates {
+		found[i] = DiscoveredDevice{Candidate: candidate, Device: known[wol_packet.CleanMAC(candidate.MACAddress)]}
+		if found[i].Device == "" {
+			continue
+		}
+		if err := s.config.DeviceStore.MarkSeen(found[i].Device, now); err != nil {
+			s.log(r).Warn("API: Failed to update last seen time for %s: %v", found[i].Device, err)
+		}
+	}
+
+	s.config.Events.Publish(wol_events.Event{
+		Type:    wol_events.TypeDiscovery,
+		Success: true,
+		Data:    found,
+	})
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    found,
+		Message: s.tr(w, "Found %d devices", len(found)),
+	})
+}
+
+func (s *WoLServer) handleHAStatus(w http.ResponseWriter, r *http.Request) {
+	// Peers request local=true so status checks don't fan out recursively
+	var status wol_ha.Status
+	if r.URL.Query().Get("local") == "true" {
+		status = s.config.HA.LocalStatus()
+	} else {
+		status = s.config.HA.Status()
+	}
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Data:    status,
+	})
+}
+
+// standbyMiddleware turns away changes on a standby node, which would be
+// written over the shared state the leader also writes. Reads, logins and
+// wakes are still answered: a wake only sends packets from this node, which
+// may be the only one on the target's subnet, and updates the volatile
+// fields written out when the node syncs.
+func (s *WoLServer) standbyMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet || r.Method == http.MethodHead || r.Method == http.MethodOptions:
+		case r.URL.Path == "/api/login":
+		case r.URL.Path == "/api/wake" || strings.HasPrefix(r.URL.Path, "/api/wake/"):
+		case !s.config.HA.IsLeader():
+			leader := s.config.HA.LocalStatus().Leader
+			s.log(r).Info("API: Refusing %s %s on standby node (leader: %s)", r.Method, r.URL.Path, leader)
+			s.writeJSONError(w, http.StatusServiceUnavailable, s.tr(w, "This node is on standby; send changes to the leader (%s)", leader))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *WoLServer) handleMonitorPackets(w http.ResponseWriter, r *http.Request) {
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	packets := s.config.Monitor.Recent(limit)
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Found %d packets", len(packets)),
+		Data:    packets,
+	})
+}
+
+// handleMonitorStream pushes every magic packet seen to a WebSocket client
+// as a JSON message.
+func (s *WoLServer) handleMonitorStream(w http.ResponseWriter, r *http.Request) {
+	if !isWebSocketRequest(r) {
+		s.writeJSONError(w, http.StatusBadRequest, "WebSocket upgrade required")
+		return
+	}
+
+	conn, rw, err := upgradeWebSocket(w, r)
+	if err != nil {
+		s.writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer conn.Close()
+
+	packets, cancel := s.config.Monitor.Subscribe()
+	defer cancel()
+
+	closed := make(chan struct{})
+	go waitWebSocketClose(rw, closed)
+
+	s.log(r).Debug("API: Monitor stream opened by %s", r.RemoteAddr)
+	for {
+		select {
+		case packet, ok := <-packets:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(packet)
+			if err := writeWebSocketText(rw, data); err != nil {
+				return
+			}
+		case <-closed:
+			s.log(r).Debug("API: Monitor stream closed by %s", r.RemoteAddr)
+			return
+		case <-s.shutdown:
+			return
+		}
+	}
+}
+
 func (s *WoLServer) handleRoot(w http.ResponseWriter, r *http.Request) {
 	response := map[string]interface{}{
 		"service": "Wake-on-LAN Server",
-		"version": "1.0.0",
+		"version": Version,
 		"status":  "running",
 		"endpoints": map[string]string{
 			"health":       "/api/health",
+			"liveness":     "/healthz",
+			"readiness":    "/readyz",
 			"devices":      "/api/devices",
 			"wake_by_name": "/api/wake/{name}",
 			"wake_by_mac":  "/api/wake",
+			"discover":     "/api/discover",
+			"network":      "/api/network",
+			"diagnostics":  "/api/diagnostics",
+			"events":       "/api/events",
+			"openapi":      "/api/openapi.json",
 		},
 	}
 
@@ -332,48 +1943,144 @@ func (s *WoLServer) handleRoot(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *WoLServer) Start() error {
-	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
+	addr := s.httpServer.Addr
 
-	s.httpServer = &http.Server{
-		Addr:         addr,
-		Handler:      s.router,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	if s.config.TLS == nil {
+		s.config.Logger.Info("Starting WoL HTTP server on %s", addr)
+		fmt.Printf("WoL Server starting on http://%s\n", addr)
+		fmt.Printf("API endpoints available at http://%s/api/\n", addr)
+
+		return s.httpServer.ListenAndServe()
 	}
 
-	s.config.Logger.Info("Starting WoL HTTP server on %s", addr)
-	fmt.Printf("WoL Server starting on http://%s\n", addr)
-	fmt.Printf("API endpoints available at http://%s/api/\n", addr)
+	tlsConfig, err := s.config.TLS.serverConfig()
+	if err != nil {
+		return err
+	}
+	s.httpServer.TLSConfig = tlsConfig
+
+	if s.redirectServer != nil {
+		go func() {
+			s.config.Logger.Info("Redirecting HTTP on %s to HTTPS", s.redirectServer.Addr)
+			if err := s.redirectServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				s.config.Logger.Error("HTTP redirect server failed: %v", err)
+			}
+		}()
+	}
 
-	return s.httpServer.ListenAndServe()
+	if s.config.TLS.ClientCAFile != "" {
+		s.config.Logger.Info("Requiring client certificates signed by %s", s.config.TLS.ClientCAFile)
+	}
+	s.config.Logger.Info("Starting WoL HTTPS server on %s", addr)
+	fmt.Printf("WoL Server starting on https://%s\n", addr)
+	fmt.Printf("API endpoints available at https://%s/api/\n", addr)
+
+	return s.httpServer.ListenAndServeTLS("", "")
 }
 
+// Stop stops accepting connections, ends event streams and waits up to the
+// shutdown timeout for requests in flight to finish, then writes out the
+// device store changes they left waiting for the flush delay. It may be
+// called before Start returns, from another goroutine.
 func (s *WoLServer) Stop() error {
-	if s.httpServer != nil {
-		s.config.Logger.Info("Stopping WoL HTTP server")
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		return s.httpServer.Shutdown(ctx)
+	ctx, cancel := context.WithTimeout(context.Background(), s.config.ShutdownTimeout)
+	defer cancel()
+
+	if s.redirectServer != nil {
+		s.redirectServer.Shutdown(ctx)
+	}
+	s.config.Logger.Info("Stopping WoL HTTP server")
+	err := s.httpServer.Shutdown(ctx)
+	if flushErr := s.config.DeviceStore.Flush(); flushErr != nil {
+		s.config.Logger.Warn("Shutdown: %v", flushErr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to finish requests in flight: %w", err)
 	}
 	return nil
 }
 
 func (s *WoLServer) writeJSONResponse(w http.ResponseWriter, status int, response APIResponse) {
+	// The request ID middleware has already set the ID on the response
+	id := w.Header().Get(RequestIDHeader)
+	if !response.Success && response.RequestID == "" {
+		response.RequestID = id
+	}
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(status)
 	if err := json.NewEncoder(w).Encode(response); err != nil {
-		s.config.Logger.Error("Failed to encode JSON response: %v", err)
+		s.config.Logger.Error("[%s] Failed to encode JSON response: %v", id, err)
+	}
+}
+
+// decodeJSON reads a request body holding one JSON value into v. Bodies
+// over the size limit, unknown fields and trailing data are rejected with
+// an error response, and decodeJSON returns false.
+func (s *WoLServer) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.config.MaxBodyBytes))
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(v)
+	if err == nil {
+		if _, extra := decoder.Token(); extra != io.EOF {
+			err = errors.New("unexpected data after the JSON value")
+		}
+	}
+	if err == nil {
+		return true
+	}
+
+	s.log(r).Warn("API: Rejected body of %s %s: %v", r.Method, r.URL.Path, err)
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		s.writeJSONError(w, http.StatusRequestEntityTooLarge, s.tr(w, "Request body is larger than %d bytes", tooLarge.Limit))
+	case errors.Is(err, io.EOF):
+		s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Request body is empty"))
+	default:
+		s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "Invalid JSON: %v", err))
 	}
+	return false
 }
 
 func (s *WoLServer) writeJSONError(w http.ResponseWriter, status int, message string) {
 	s.writeJSONResponse(w, status, APIResponse{
 		Success: false,
-		Error:   message,
+		Error:   s.tr(w, message),
+	})
+}
+
+type localizedWriter struct {
+	http.ResponseWriter
+	localizer *wol_i18n.Localizer
+}
+
+func (lw *localizedWriter) Unwrap() http.ResponseWriter {
+	return lw.ResponseWriter
+}
+
+// i18nMiddleware picks the response language from Accept-Language.
+func (s *WoLServer) i18nMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		localizer := wol_i18n.MatchAcceptLanguage(r.Header.Get("Accept-Language"))
+		w.Header().Set("Content-Language", localizer.Lang())
+		next.ServeHTTP(&localizedWriter{ResponseWriter: w, localizer: localizer}, r)
 	})
 }
 
+// localizer returns the localizer for the language negotiated for w.
+func (s *WoLServer) localizer(w http.ResponseWriter) *wol_i18n.Localizer {
+	if lw, ok := w.(*localizedWriter); ok {
+		return lw.localizer
+	}
+	return wol_i18n.New(wol_i18n.DefaultLanguage)
+}
+
+// tr translates a message into the language negotiated for w.
+func (s *WoLServer) tr(w http.ResponseWriter, format string, args ...interface{}) string {
+	return s.localizer(w).T(format, args...)
+}
+
 func (s *WoLServer) getPortFromQuery(r *http.Request) int {
 	portStr := r.URL.Query().Get("port")
 	if portStr == "" {
@@ -388,40 +2095,157 @@ func (s *WoLServer) getPortFromQuery(r *http.Request) int {
 	return port
 }
 
+// checkIntervalQuery answers 400 and returns false when the
+// retry_interval_ms or copy_interval_ms query parameter is over
+// maxIntervalMs.
+func (s *WoLServer) checkIntervalQuery(w http.ResponseWriter, r *http.Request) bool {
+	for _, param := range []string{"retry_interval_ms", "copy_interval_ms"} {
+		if ms, _ := strconv.Atoi(r.URL.Query().Get(param)); ms > maxIntervalMs {
+			s.writeJSONError(w, http.StatusBadRequest, s.tr(w, "%s must be at most %d", param, maxIntervalMs))
+			return false
+		}
+	}
+	return true
+}
+
+// retryConfig applies per-request overrides to the server's retry default.
+func (s *WoLServer) retryConfig(retries *int, intervalMs int) wol_network.RetryConfig {
+	retry := s.config.Retry
+	if retries != nil && *retries >= 0 {
+		retry.Count = min(*retries, maxRetries)
+	}
+	if intervalMs > 0 {
+		retry.Interval = time.Duration(intervalMs) * time.Millisecond
+	}
+	return retry
+}
+
+// applyPolicy uses the device's wake policy for the settings overrides
+// does not set.
+func (s *WoLServer) applyPolicy(opts *wol_network.SendOptions, policy *wol_device.WakePolicy, overrides wakeOverrides) {
+	if policy == nil {
+		return
+	}
+	if policy.Retries > 0 && overrides.Retries == nil {
+		opts.Retry.Count = min(policy.Retries, maxRetries)
+	}
+	if policy.Copies > 0 && overrides.Copies <= 0 {
+		opts.Copies = min(policy.Copies, maxCopies)
+	}
+	opts.ExtraPorts = append(slices.Clone(policy.ExtraPorts), opts.ExtraPorts...)
+}
+
+// copyConfig applies per-request overrides to the server's packet copies
+// default.
+func (s *WoLServer) copyConfig(copies, intervalMs int) (int, time.Duration) {
+	if copies > 0 {
+		copies = min(copies, maxCopies)
+	} else {
+		copies = s.config.Copies
+	}
+	interval := s.config.CopyInterval
+	if intervalMs > 0 {
+		interval = time.Duration(intervalMs) * time.Millisecond
+	}
+	return copies, interval
+}
+
 func (s *WoLServer) corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
+		cors := s.config.CORS
+		w.Header().Add("Vary", "Origin")
+		allowed := cors.allowOrigin(origin)
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		if allowed == "" {
+			if preflight {
+				s.log(r).Debug("CORS: Rejected preflight from origin %s", origin)
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
 			return
 		}
 
+		w.Header().Set("Access-Control-Allow-Origin", allowed)
+		if cors.AllowCredentials {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if preflight {
+			w.Header().Set("Access-Control-Allow-Methods", strings.Join(cors.AllowedMethods, ", "))
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(cors.AllowedHeaders, ", "))
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, "+RequestIDHeader)
 		next.ServeHTTP(w, r)
 	})
 }
 
-func (s *WoLServer) loggingMiddleware(next http.Handler) http.Handler {
+// requiredRole returns the minimum role needed for a request: viewers may
+// read, operators may additionally wake devices and scan the network, and
+// only admins may modify the device store.
+func requiredRole(r *http.Request) wol_auth.Role {
+	switch {
+	case r.URL.Path == "/api/discover":
+		// A scan sends ARP and ping to every local host and updates when
+		// devices were last seen
+		return wol_auth.RoleOperator
+	case r.URL.Path == "/api/diagnostics":
+		// Diagnostics send broadcast packets and listen on the wake port
+		return wol_auth.RoleOperator
+	case r.URL.Path == "/api/status" && r.URL.Query().Get("refresh") == "true":
+		// Skipping the cache probes the whole inventory on every request
+		return wol_auth.RoleOperator
+	case r.Method == http.MethodGet:
+		return wol_auth.RoleViewer
+	case strings.HasPrefix(r.URL.Path, "/api/wake"):
+		return wol_auth.RoleOperator
+	default:
+		return wol_auth.RoleAdmin
+	}
+}
+
+func (s *WoLServer) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
+		// /api/login checks the credentials it is given itself
+		// Peers read each other's local status with the HA secret instead;
+		// the aggregated status calls every peer, so it needs a viewer
+		if r.URL.Path == "/api/health" || r.URL.Path == "/api/login" ||
+			r.URL.Path == "/api/openapi.json" || r.URL.Path == "/api/docs" || r.Method == http.MethodOptions ||
+			(r.URL.Path == "/api/ha/status" && s.config.HA != nil && s.config.HA.IsPeer(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
 
-		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
+		identity, err := s.config.Auth.Authenticate(r)
+		if err != nil {
+			if err != wol_auth.ErrNoCredentials {
+				s.log(r).Warn("API: Authentication failed for %s %s: %v", r.Method, r.URL.Path, err)
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="wol-server", Basic realm="wol-server"`)
+			s.writeJSONError(w, http.StatusUnauthorized, "Authentication required")
+			return
+		}
 
-		next.ServeHTTP(wrapped, r)
+		required := requiredRole(r)
+		if !identity.Role.Allows(required) {
+			s.log(r).Warn("API: User %s (%s) denied %s %s: requires %s", identity.Username, identity.Role, r.Method, r.URL.Path, required)
+			s.writeJSONError(w, http.StatusForbidden, s.tr(w, "Role '%s' is not permitted to perform this action", identity.Role))
+			return
+		}
 
-		duration := time.Since(start)
-		s.config.Logger.Info("HTTP %s %s - %d - %v", r.Method, r.URL.Path, wrapped.statusCode, duration)
+		s.log(r).Debug("API: Authenticated %s via %s as %s", identity.Username, identity.Provider, identity.Role)
+		recordUser(r, identity.Username)
+		next.ServeHTTP(w, r.WithContext(wol_auth.WithIdentity(r.Context(), identity)))
 	})
 }
-
-type responseWriter struct {
-	http.ResponseWriter
-	statusCode int
-}
-
-func (rw *responseWriter) WriteHeader(code int) {
-	rw.statusCode = code
-	rw.ResponseWriter.WriteHeader(code)
-}
@@ -0,0 +1,148 @@
+package wol_server
+
+import (
+	"net/http"
+	"sync"
+	"time"
+	wol_device "wol-server/wol/device"
+
+	"github.com/gorilla/mux"
+)
+
+// DefaultStatusCacheTTL is how long GET /api/status reuses a device's
+// last probe.
+const DefaultStatusCacheTTL = 30 * time.Second
+
+// maxStatusProbes is how many devices GET /api/status probes at once.
+const maxStatusProbes = 8
+
+// DeviceStatus is the outcome of probing a device with ping, ARP and TCP.
+type DeviceStatus struct {
+	Device string `json:"device"`
+	// Status is online, offline, or unknown for devices without an address
+	Status string `json:"status"`
+	// LatencyMs is how long the device took to answer
+	LatencyMs float64 `json:"latency_ms,omitempty"`
+	// Check names the probe that got an answer
+	Check     string    `json:"check,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+	// Cached is set when the result comes from an earlier probe
+	Cached bool `json:"cached,omitempty"`
+}
+
+// statusCache holds the last probe of each device.
+type statusCache struct {
+	mu      sync.Mutex
+	entries map[string]DeviceStatus
+}
+
+func (c *statusCache) get(name string, ttl time.Duration) (DeviceStatus, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	status, ok := c.entries[name]
+	if !ok || time.Since(status.CheckedAt) > ttl {
+		return DeviceStatus{}, false
+	}
+	status.Cached = true
+	return status, true
+}
+
+func (c *statusCache) put(status DeviceStatus) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]DeviceStatus)
+	}
+	c.entries[status.Device] = status
+}
+
+// probeDevice checks device now, records the result in the store and the
+// cache, and returns it.
+func (s *WoLServer) probeDevice(device *wol_device.Device) DeviceStatus {
+	status := DeviceStatus{
+		Device:    device.Name,
+		Status:    wol_device.StatusUnknown,
+		CheckedAt: time.Now(),
+	}
+	if device.IPAddress == "" {
+		status.Details = "device has no IP address"
+		return status
+	}
+
+	result, err := s.checker.Probe(device)
+	switch {
+	case err != nil:
+		status.Details = err.Error()
+	case result.Online:
+		status.Status = wol_device.StatusOnline
+		status.LatencyMs = float64(result.Elapsed.Microseconds()) / 1000
+		status.Check = result.Check
+		status.Details = result.Details
+	default:
+		status.Status = wol_device.StatusOffline
+		status.Details = result.Details
+	}
+
+	s.statuses.put(status)
+	return status
+}
+
+func (s *WoLServer) handleDeviceStatus(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+
+	device, err := s.config.DeviceStore.GetDevice(name)
+	if err != nil {
+		s.writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	status := s.probeDevice(device)
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "Device '%s' is %s", name, status.Status),
+		Data:    status,
+	})
+}
+
+// handleStatus probes every active device, a few at a time, reusing
+// probes younger than the cache TTL unless refresh=true is given.
+func (s *WoLServer) handleStatus(w http.ResponseWriter, r *http.Request) {
+	refresh := r.URL.Query().Get("refresh") == "true"
+	devices := s.config.DeviceStore.ListDevices()
+	statuses := make([]DeviceStatus, len(devices))
+
+	var wg sync.WaitGroup
+	limit := make(chan struct{}, maxStatusProbes)
+	for i, device := range devices {
+		if !refresh {
+			if cached, ok := s.statuses.get(device.Name, s.config.StatusCacheTTL); ok {
+				statuses[i] = cached
+				continue
+			}
+		}
+
+		wg.Add(1)
+		go func(i int, device *wol_device.Device) {
+			defer wg.Done()
+			limit <- struct{}{}
+			defer func() { <-limit }()
+
+			statuses[i] = s.probeDevice(device)
+		}(i, device)
+	}
+	wg.Wait()
+
+	online := 0
+	for _, status := range statuses {
+		if status.Status == wol_device.StatusOnline {
+			online++
+		}
+	}
+
+	s.writeJSONResponse(w, http.StatusOK, APIResponse{
+		Success: true,
+		Message: s.tr(w, "%d of %d devices online", online, len(statuses)),
+		Data:    statuses,
+	})
+}
@@ -0,0 +1,177 @@
+package wol_server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_network "wol-server/wol/network"
+	wol_status "wol-server/wol/status"
+)
+
+// stubCheck answers every status probe as online says.
+type stubCheck struct {
+	online bool
+}
+
+func (c stubCheck) Name() string { return "stub" }
+
+func (c stubCheck) Verify(ctx context.Context, target wol_network.VerifyTarget) wol_network.VerifierResult {
+	return wol_network.VerifierResult{Name: "stub", Success: c.online, Details: "stubbed"}
+}
+
+// busyCheck records how many probes are running at once.
+type busyCheck struct {
+	running, peak *atomic.Int32
+}
+
+func (c busyCheck) Name() string { return "busy" }
+
+func (c busyCheck) Verify(ctx context.Context, target wol_network.VerifyTarget) wol_network.VerifierResult {
+	n := c.running.Add(1)
+	defer c.running.Add(-1)
+	for {
+		peak := c.peak.Load()
+		if n <= peak || c.peak.CompareAndSwap(peak, n) {
+			break
+		}
+	}
+	time.Sleep(5 * time.Millisecond)
+	return wol_network.VerifierResult{Name: "busy", Success: true}
+}
+
+// newStatusTestServer returns a server whose probes all answer as online says,
+// with devices nas, which has an IP address, and desktop, which does not.
+func newStatusTestServer(t *testing.T, online bool) *WoLServer {
+	t.Helper()
+
+	s := newTestServer(t, ServerConfig{}, false)
+	s.checker = wol_status.NewChecker(wol_status.Config{
+		Timeout: 50 * time.Millisecond,
+		Checks:  []wol_network.Verifier{stubCheck{online: online}},
+		Events:  s.config.Events,
+	}, s.config.DeviceStore, s.config.Logger)
+
+	if err := s.config.DeviceStore.AddDevice("nas", "AA:BB:CC:DD:EE:01", "", "192.0.2.10", 9); err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+	if err := s.config.DeviceStore.AddDevice("desktop", "AA:BB:CC:DD:EE:02", "", "", 9); err != nil {
+		t.Fatalf("AddDevice() error = %v", err)
+	}
+	return s
+}
+
+func TestDeviceStatus(t *testing.T) {
+	tests := []struct {
+		name       string
+		online     bool
+		device     string
+		want       int
+		wantStatus string
+	}{
+		{"reachable", true, "nas", http.StatusOK, wol_device.StatusOnline},
+		{"unreachable", false, "nas", http.StatusOK, wol_device.StatusOffline},
+		{"no address", true, "desktop", http.StatusOK, wol_device.StatusUnknown},
+		{"unknown device", true, "missing", http.StatusNotFound, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newStatusTestServer(t, tt.online)
+			w := serve(s, httptest.NewRequest("GET", "/api/devices/"+tt.device+"/status", nil))
+			if w.Code != tt.want {
+				t.Fatalf("GET /api/devices/%s/status = %d, want %d", tt.device, w.Code, tt.want)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+
+			var body struct {
+				Data DeviceStatus `json:"data"`
+			}
+			if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+				t.Fatalf("decoding response: %v", err)
+			}
+			if body.Data.Status != tt.wantStatus || body.Data.Cached {
+				t.Errorf("status = %+v, want a fresh %s", body.Data, tt.wantStatus)
+			}
+			if tt.wantStatus == wol_device.StatusOnline && body.Data.Check != "stub" {
+				t.Errorf("Check = %q, want stub", body.Data.Check)
+			}
+
+			// The outcome is recorded in the store
+			if device, _ := s.config.DeviceStore.GetDevice(tt.device); tt.wantStatus != wol_device.StatusUnknown && device.Status != tt.wantStatus {
+				t.Errorf("stored status = %q, want %q", device.Status, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestStatus(t *testing.T) {
+	s := newStatusTestServer(t, true)
+
+	get := func(query string) map[string]DeviceStatus {
+		t.Helper()
+		w := serve(s, httptest.NewRequest("GET", "/api/status"+query, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET /api/status%s = %d, want 200", query, w.Code)
+		}
+		var body struct {
+			Data []DeviceStatus `json:"data"`
+		}
+		if err := json.NewDecoder(w.Body).Decode(&body); err != nil {
+			t.Fatalf("decoding response: %v", err)
+		}
+		statuses := make(map[string]DeviceStatus)
+		for _, status := range body.Data {
+			statuses[status.Device] = status
+		}
+		return statuses
+	}
+
+	statuses := get("")
+	if len(statuses) != 2 || statuses["nas"].Status != wol_device.StatusOnline || statuses["desktop"].Status != wol_device.StatusUnknown {
+		t.Fatalf("GET /api/status = %+v, want nas online and desktop unknown", statuses)
+	}
+	if statuses["nas"].Cached {
+		t.Error("first GET /api/status returned a cached probe")
+	}
+
+	// A second request within the TTL reuses the probe, unless refreshed
+	if !get("")["nas"].Cached {
+		t.Error("second GET /api/status probed again, want the cached result")
+	}
+	if get("?refresh=true")["nas"].Cached {
+		t.Error("GET /api/status?refresh=true returned a cached probe")
+	}
+}
+
+func TestStatus_LimitsConcurrentProbes(t *testing.T) {
+	s := newTestServer(t, ServerConfig{}, false)
+	var running, peak atomic.Int32
+	s.checker = wol_status.NewChecker(wol_status.Config{
+		Timeout: time.Second,
+		Checks:  []wol_network.Verifier{busyCheck{running: &running, peak: &peak}},
+		Events:  s.config.Events,
+	}, s.config.DeviceStore, s.config.Logger)
+
+	for i := 0; i < 4*maxStatusProbes; i++ {
+		name := fmt.Sprintf("host%d", i)
+		mac := fmt.Sprintf("AA:BB:CC:DD:%02X:%02X", i/256, i%256)
+		if err := s.config.DeviceStore.AddDevice(name, mac, "", fmt.Sprintf("192.0.2.%d", i+1), 9); err != nil {
+			t.Fatalf("AddDevice() error = %v", err)
+		}
+	}
+
+	if w := serve(s, httptest.NewRequest("GET", "/api/status", nil)); w.Code != http.StatusOK {
+		t.Fatalf("GET /api/status = %d, want 200", w.Code)
+	}
+	if got := peak.Load(); got > maxStatusProbes {
+		t.Errorf("%d probes ran at once, want at most %d", got, maxStatusProbes)
+	}
+}
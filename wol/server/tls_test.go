@@ -0,0 +1,166 @@
+package wol_server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// writeSelfSignedCert writes a certificate for 127.0.0.1 and its key to
+// dir and returns their paths and the certificate.
+func writeSelfSignedCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey() error = %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "wol-server test"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("CreateCertificate() error = %v", err)
+	}
+	if cert, err = x509.ParseCertificate(der); err != nil {
+		t.Fatalf("ParseCertificate() error = %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error = %v", err)
+	}
+
+	certFile, keyFile = filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+	return certFile, keyFile, cert
+}
+
+// freePort returns a local TCP port that was free a moment ago.
+func freePort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func TestStart_TLS(t *testing.T) {
+	certFile, keyFile, cert := writeSelfSignedCert(t, t.TempDir())
+	port, redirectPort := freePort(t), freePort(t)
+
+	s := newTestServer(t, ServerConfig{
+		Host: "127.0.0.1",
+		Port: port,
+		TLS:  &TLSConfig{CertFile: certFile, KeyFile: keyFile, RedirectPort: redirectPort},
+	}, false)
+	errs := make(chan error, 1)
+	go func() { errs <- s.Start() }()
+	defer func() {
+		s.Stop()
+		if err := <-errs; err != http.ErrServerClosed {
+			t.Errorf("Start() error = %v, want http.ErrServerClosed", err)
+		}
+	}()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+	client := &http.Client{
+		Timeout:   2 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	base := "https://127.0.0.1:" + strconv.Itoa(port)
+	var resp *http.Response
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if resp, err = client.Get(base + "/healthz"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("GET %s/healthz error = %v", base, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.TLS == nil {
+		t.Errorf("GET /healthz over HTTPS = %d (TLS %v), want 200 over TLS", resp.StatusCode, resp.TLS != nil)
+	}
+
+	// Plain HTTP on the redirect port is sent to the same path over HTTPS
+	var redirect *http.Response
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		if redirect, err = client.Get("http://127.0.0.1:" + strconv.Itoa(redirectPort) + "/api/devices?limit=2"); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatalf("GET on the redirect port error = %v", err)
+	}
+	redirect.Body.Close()
+	if redirect.StatusCode != http.StatusMovedPermanently && redirect.StatusCode != http.StatusPermanentRedirect {
+		t.Errorf("redirect status = %d, want 301 or 308", redirect.StatusCode)
+	}
+	if location := redirect.Header.Get("Location"); location != base+"/api/devices?limit=2" {
+		t.Errorf("Location = %q, want %q", location, base+"/api/devices?limit=2")
+	}
+}
+
+func TestRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		name      string
+		host      string
+		httpsPort int
+		want      string
+	}{
+		{"other port", "wol.example.com:8080", 8443, "https://wol.example.com:8443/api/devices?tag=office"},
+		{"default port", "wol.example.com:8080", 443, "https://wol.example.com/api/devices?tag=office"},
+		{"host without port", "wol.example.com", 443, "https://wol.example.com/api/devices?tag=office"},
+		{"IPv6 with port", "[fd00::1]:8080", 8443, "https://[fd00::1]:8443/api/devices?tag=office"},
+		{"IPv6 on the default port", "[fd00::1]:8080", 443, "https://[fd00::1]/api/devices?tag=office"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/api/devices?tag=office", nil)
+			r.Host = tt.host
+			w := httptest.NewRecorder()
+			redirectToHTTPS(tt.httpsPort).ServeHTTP(w, r)
+
+			if w.Code != http.StatusPermanentRedirect {
+				t.Errorf("status = %d, want 308", w.Code)
+			}
+			if got := w.Header().Get("Location"); got != tt.want {
+				t.Errorf("Location = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package wol_server
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+	wol_network "wol-server/wol/network"
+)
+
+// WakeVerification asks a wake request to check the packet reached the
+// network and the device woke, like the CLI's -verify flags. The
+// response's data is then the full verification result.
+type WakeVerification struct {
+	VerifyCapture bool `json:"verify_capture,omitempty"`
+	// VerifyPing checks the device accepts TCP connections; VerifyICMP
+	// needs the server to run as root
+	VerifyPing bool `json:"verify_ping,omitempty"`
+	VerifyARP  bool `json:"verify_arp,omitempty"`
+	VerifyICMP bool `json:"verify_icmp,omitempty"`
+	// CaptureTimeoutMs bounds the capture check (default 3s) and
+	// VerifyTimeoutSeconds each of the others (default 30s)
+	CaptureTimeoutMs     int `json:"capture_timeout_ms,omitempty"`
+	VerifyTimeoutSeconds int `json:"verify_timeout_seconds,omitempty"`
+}
+
+func (v WakeVerification) enabled() bool {
+	return v.VerifyCapture || v.VerifyPing || v.VerifyARP || v.VerifyICMP
+}
+
+// needsIP reports whether a check other than capture was asked for.
+func (v WakeVerification) needsIP() bool {
+	return v.VerifyPing || v.VerifyARP || v.VerifyICMP
+}
+
+// timeout is roughly the longest the checks can take.
+func (v WakeVerification) timeout() time.Duration {
+	capture := 3 * time.Second
+	if v.CaptureTimeoutMs > 0 {
+		capture = min(time.Duration(v.CaptureTimeoutMs)*time.Millisecond, maxWaitTimeout)
+	}
+	check := 30 * time.Second
+	if v.VerifyTimeoutSeconds > 0 {
+		check = time.Duration(v.VerifyTimeoutSeconds) * time.Second
+	}
+
+	var checks time.Duration
+	for _, on := range []bool{v.VerifyPing, v.VerifyARP, v.VerifyICMP} {
+		if on {
+			checks += check
+		}
+	}
+	return min(capture+checks, maxWaitTimeout)
+}
+
+// verificationFromQuery reads the verification query parameters of a wake
+// by name.
+func verificationFromQuery(r *http.Request) WakeVerification {
+	query := r.URL.Query()
+	v := WakeVerification{
+		VerifyCapture: query.Get("verify_capture") == "true",
+		VerifyPing:    query.Get("verify_ping") == "true",
+		VerifyARP:     query.Get("verify_arp") == "true",
+		VerifyICMP:    query.Get("verify_icmp") == "true",
+	}
+	v.CaptureTimeoutMs, _ = strconv.Atoi(query.Get("capture_timeout_ms"))
+	v.VerifyTimeoutSeconds, _ = strconv.Atoi(query.Get("verify_timeout_seconds"))
+	return v
+}
+
+// sendVerified sends a wake packet with opts and runs the checks v asks
+// for against the device at ip. A request waiting on it should extend its
+// write deadline by v.timeout() first.
+func (s *WoLServer) sendVerified(mac, ip string, opts wol_network.SendOptions, v WakeVerification) (*wol_network.PacketVerificationResult, error) {
+	result, err := wol_network.SendWakeOnLANWithVerification(mac, v.config(ip, opts))
+	if err == nil && v.needsIP() {
+		if result.TargetReachable {
+			s.metrics.verification("online")
+		} else {
+			s.metrics.verification("timeout")
+		}
+	}
+	return result, err
+}
+
+// config returns the verification settings for v, with its timeouts
+// capped at maxWaitTimeout so no request holds a handler and capture
+// socket for longer.
+func (v WakeVerification) config(ip string, opts wol_network.SendOptions) wol_network.VerificationConfig {
+	return wol_network.VerificationConfig{
+		SendOptions:      opts,
+		EnableCapture:    v.VerifyCapture,
+		CaptureInterface: opts.Interface,
+		CaptureTimeout:   min(time.Duration(v.CaptureTimeoutMs)*time.Millisecond, maxWaitTimeout),
+		EnablePing:       v.VerifyPing,
+		EnableARP:        v.VerifyARP,
+		EnableICMP:       v.VerifyICMP,
+		CheckTimeout:     min(time.Duration(v.VerifyTimeoutSeconds)*time.Second, maxWaitTimeout),
+		TargetIP:         ip,
+	}
+}
+
+// extendWriteDeadline pushes out the write deadline so the server's
+// WriteTimeout does not cut a request that waits on a device short.
+func (s *WoLServer) extendWriteDeadline(w http.ResponseWriter, r *http.Request, wait time.Duration) {
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Now().Add(wait + 15*time.Second)); err != nil {
+		s.log(r).Debug("API: Could not extend write deadline: %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package wol_server
+
+import (
+	"testing"
+	"time"
+	wol_network "wol-server/wol/network"
+)
+
+func TestWakeVerification_Timeouts(t *testing.T) {
+	tests := []struct {
+		name        string
+		v           WakeVerification
+		wantCapture time.Duration
+		wantCheck   time.Duration
+		wantTotal   time.Duration
+	}{
+		{"defaults", WakeVerification{VerifyCapture: true, VerifyPing: true}, 0, 0, 33 * time.Second},
+		{"as asked", WakeVerification{VerifyCapture: true, CaptureTimeoutMs: 5000, VerifyTimeoutSeconds: 10}, 5 * time.Second, 10 * time.Second, 5 * time.Second},
+		{"capture capped", WakeVerification{VerifyCapture: true, CaptureTimeoutMs: 86400000}, maxWaitTimeout, 0, maxWaitTimeout},
+		{"checks capped", WakeVerification{VerifyPing: true, VerifyTimeoutSeconds: 86400}, 0, maxWaitTimeout, maxWaitTimeout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := tt.v.config("192.168.1.5", wol_network.SendOptions{})
+			if config.CaptureTimeout != tt.wantCapture {
+				t.Errorf("CaptureTimeout = %v, want %v", config.CaptureTimeout, tt.wantCapture)
+			}
+			if config.CheckTimeout != tt.wantCheck {
+				t.Errorf("CheckTimeout = %v, want %v", config.CheckTimeout, tt.wantCheck)
+			}
+			if got := tt.v.timeout(); got != tt.wantTotal {
+				t.Errorf("timeout() = %v, want %v", got, tt.wantTotal)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package wol_server
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// A minimal RFC 6455 server: enough to push text messages to a browser or
+// websocat and notice when the client goes away.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+func isWebSocketRequest(r *http.Request) bool {
+	return strings.EqualFold(r.Header.Get("Upgrade"), "websocket") &&
+		strings.Contains(strings.ToLower(r.Header.Get("Connection")), "upgrade")
+}
+
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.ReadWriter, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" || r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, nil, fmt.Errorf("unsupported WebSocket handshake")
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to hijack connection: %w", err)
+	}
+
+	// The server's read and write timeouts would otherwise end the stream
+	conn.SetDeadline(time.Time{})
+
+	hash := sha1.Sum([]byte(key + websocketGUID))
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", base64.StdEncoding.EncodeToString(hash[:]))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("failed to complete WebSocket handshake: %w", err)
+	}
+
+	return conn, rw, nil
+}
+
+// writeWebSocketText sends data as a single unmasked text frame.
+func writeWebSocketText(rw *bufio.ReadWriter, data []byte) error {
+	header := []byte{0x81}
+	switch {
+	case len(data) < 126:
+		header = append(header, byte(len(data)))
+	case len(data) <= 0xFFFF:
+		header = append(header, 126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(len(data)))
+	default:
+		header = append(header, 127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(len(data)))
+	}
+
+	if _, err := rw.Write(append(header, data...)); err != nil {
+		return err
+	}
+	return rw.Flush()
+}
+
+// waitWebSocketClose reads and discards client frames until the client
+// sends a close frame or the connection drops, then closes done.
+func waitWebSocketClose(rw *bufio.ReadWriter, done chan<- struct{}) {
+	defer close(done)
+
+	for {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(rw, header); err != nil {
+			return
+		}
+
+		opcode := header[0] & 0x0F
+		length := uint64(header[1] & 0x7F)
+		switch length {
+		case 126:
+			ext := make([]byte, 2)
+			if _, err := io.ReadFull(rw, ext); err != nil {
+				return
+			}
+			length = uint64(binary.BigEndian.Uint16(ext))
+		case 127:
+			ext := make([]byte, 8)
+			if _, err := io.ReadFull(rw, ext); err != nil {
+				return
+			}
+			length = binary.BigEndian.Uint64(ext)
+		}
+		if header[1]&0x80 != 0 {
+			length += 4 // masking key
+		}
+
+		if _, err := rw.Discard(int(length)); err != nil || opcode == 0x8 {
+			return
+		}
+	}
+}
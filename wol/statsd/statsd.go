@@ -0,0 +1,167 @@
+package wol_statsd
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	wol_plugin "wol-server/wol/plugin"
+)
+
+const DefaultPrefix = "wol"
+
+type Config struct {
+	Address string
+	Prefix  string
+	// DogStatsD enables the "|#tag:value" extension understood by Datadog
+	// and Telegraf. Plain StatsD servers drop tagged lines, so tags are
+	// omitted unless this is set.
+	DogStatsD bool
+	Tags      []string
+}
+
+// Client sends metrics over UDP. Sends are fire-and-forget: a missing or
+// slow collector never blocks or fails a wake.
+type Client struct {
+	config Config
+	mu     sync.Mutex
+	conn   net.Conn
+}
+
+func NewClient(config Config) (*Client, error) {
+	if config.Address == "" {
+		return nil, fmt.Errorf("StatsD address is required")
+	}
+	if config.Prefix == "" {
+		config.Prefix = DefaultPrefix
+	}
+
+	conn, err := net.Dial("udp", config.Address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to StatsD at %s: %w", config.Address, err)
+	}
+
+	return &Client{config: config, conn: conn}, nil
+}
+
+func (c *Client) Count(name string, value int64, tags ...string) {
+	c.send(name, strconv.FormatInt(value, 10), "c", tags)
+}
+
+func (c *Client) Gauge(name string, value float64, tags ...string) {
+	c.send(name, strconv.FormatFloat(value, 'f', -1, 64), "g", tags)
+}
+
+func (c *Client) Timing(name string, duration time.Duration, tags ...string) {
+	c.send(name, strconv.FormatInt(duration.Milliseconds(), 10), "ms", tags)
+}
+
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.conn.Close()
+}
+
+func (c *Client) send(name, value, metricType string, tags []string) {
+	line := c.format(name, value, metricType, tags)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.Write([]byte(line))
+}
+
+func (c *Client) format(name, value, metricType string, tags []string) string {
+	var b strings.Builder
+	b.WriteString(c.config.Prefix)
+	b.WriteByte('.')
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(value)
+	b.WriteByte('|')
+	b.WriteString(metricType)
+
+	if c.config.DogStatsD {
+		allTags := append(append([]string(nil), c.config.Tags...), tags...)
+		if len(allTags) > 0 {
+			b.WriteString("|#")
+			b.WriteString(strings.Join(allTags, ","))
+		}
+	}
+
+	return b.String()
+}
+
+// Notifier turns plugin events into metrics:
+//
+//	<prefix>.wake.attempts          count
+//	<prefix>.wake.success/.failure  count
+//	<prefix>.wake.boot_duration     timing, when the event carries boot_duration_ms
+type Notifier struct {
+	client *Client
+}
+
+func NewNotifier(client *Client) *Notifier {
+	return &Notifier{client: client}
+}
+
+func (n *Notifier) Notify(event wol_plugin.Event) error {
+	if event.Type != wol_plugin.EventWake {
+		return nil
+	}
+
+	var tags []string
+	if event.Device != "" {
+		tags = append(tags, "device:"+event.Device)
+	}
+
+	n.client.Count("wake.attempts", 1, tags...)
+	if event.Success {
+		n.client.Count("wake.success", 1, tags...)
+	} else {
+		n.client.Count("wake.failure", 1, tags...)
+	}
+
+	if ms, ok := event.Details["boot_duration_ms"]; ok {
+		if v, ok := toInt64(ms); ok {
+			n.client.Timing("wake.boot_duration", time.Duration(v)*time.Millisecond, tags...)
+		}
+	}
+
+	return nil
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch n := v.(type) {
+	case int64:
+		return n, true
+	case int:
+		return int64(n), true
+	case float64:
+		return int64(n), true
+	default:
+		return 0, false
+	}
+}
+
+func init() {
+	wol_plugin.Notifiers.Register("statsd", func(options wol_plugin.Options) (wol_plugin.Notifier, error) {
+		config := Config{
+			Address:   options["address"],
+			Prefix:    options["prefix"],
+			DogStatsD: options["dogstatsd"] == "true",
+		}
+		for _, tag := range strings.Split(options["tags"], ",") {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				config.Tags = append(config.Tags, tag)
+			}
+		}
+
+		client, err := NewClient(config)
+		if err != nil {
+			return nil, err
+		}
+		return NewNotifier(client), nil
+	})
+}
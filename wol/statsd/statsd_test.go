@@ -0,0 +1,87 @@
+package wol_statsd
+
+import (
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+	wol_plugin "wol-server/wol/plugin"
+)
+
+func TestClient_Format(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		want   string
+	}{
+		{"plain statsd drops tags", Config{Prefix: "wol", Tags: []string{"env:home"}}, "wol.wake.success:1|c"},
+		{"dogstatsd with tags", Config{Prefix: "wol", DogStatsD: true, Tags: []string{"env:home"}}, "wol.wake.success:1|c|#env:home,device:nas"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := &Client{config: tt.config}
+			got := client.format("wake.success", "1", "c", []string{"device:nas"})
+			if got != tt.want {
+				t.Errorf("format() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewClient_RequiresAddress(t *testing.T) {
+	if _, err := NewClient(Config{}); err == nil {
+		t.Error("NewClient() expected error without address")
+	}
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	client, err := NewClient(Config{Address: listener.LocalAddr().String()})
+	if err != nil {
+		t.Fatalf("NewClient() error = %v", err)
+	}
+	defer client.Close()
+
+	notifier := NewNotifier(client)
+	notifier.Notify(wol_plugin.Event{
+		Type:    wol_plugin.EventWake,
+		Device:  "nas",
+		Success: true,
+		Details: map[string]interface{}{"boot_duration_ms": int64(4200)},
+	})
+
+	var lines []string
+	buffer := make([]byte, 512)
+	listener.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for len(lines) < 3 {
+		n, _, err := listener.ReadFrom(buffer)
+		if err != nil {
+			t.Fatalf("Failed to read metric: %v (got %v)", err, lines)
+		}
+		lines = append(lines, string(buffer[:n]))
+	}
+	sort.Strings(lines)
+
+	want := []string{"wol.wake.attempts:1|c", "wol.wake.boot_duration:4200|ms", "wol.wake.success:1|c"}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("metrics = %v, want %v", lines, want)
+	}
+}
+
+func TestRegisteredNotifier(t *testing.T) {
+	factory, err := wol_plugin.Notifiers.Get("statsd")
+	if err != nil {
+		t.Fatalf("statsd notifier not registered: %v", err)
+	}
+
+	if _, err := factory(wol_plugin.Options{}); err == nil {
+		t.Error("factory expected error without address option")
+	}
+}
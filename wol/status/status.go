@@ -0,0 +1,157 @@
+package wol_status
+
+import (
+	"sync"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_events "wol-server/wol/events"
+	wol_log "wol-server/wol/log"
+	wol_network "wol-server/wol/network"
+)
+
+const (
+	DefaultInterval = time.Minute
+	DefaultTimeout  = 2 * time.Second
+)
+
+type Config struct {
+	Interval time.Duration
+	// Timeout bounds each device's check
+	Timeout time.Duration
+	// Checks decide whether a device is up; ping, ARP and TCP by default
+	Checks []wol_network.Verifier
+	// Events receives a status event whenever a device goes online or
+	// offline
+	Events *wol_events.Bus
+}
+
+// Checker periodically checks which devices are reachable and records
+// their status in the device store. Devices without an IP address or host
+// name are left alone.
+type Checker struct {
+	config Config
+	store  *wol_device.DeviceStore
+	logger *wol_log.Logger
+	stop   chan struct{}
+	wg     sync.WaitGroup
+}
+
+func NewChecker(config Config, store *wol_device.DeviceStore, logger *wol_log.Logger) *Checker {
+	if config.Interval <= 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultTimeout
+	}
+
+	return &Checker{
+		config: config,
+		store:  store,
+		logger: logger,
+		stop:   make(chan struct{}),
+	}
+}
+
+func (c *Checker) Start() {
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+
+		ticker := time.NewTicker(c.config.Interval)
+		defer ticker.Stop()
+
+		c.CheckAll()
+		for {
+			select {
+			case <-ticker.C:
+				c.CheckAll()
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (c *Checker) Stop() {
+	close(c.stop)
+	c.wg.Wait()
+}
+
+// CheckAll checks every device with an address concurrently and returns
+// how many of them are online.
+func (c *Checker) CheckAll() int {
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		online int
+	)
+
+	for _, device := range c.store.ListDevices() {
+		if device.IPAddress == "" {
+			continue
+		}
+
+		wg.Add(1)
+		go func(device *wol_device.Device) {
+			defer wg.Done()
+
+			up := c.Check(device)
+			if up {
+				mu.Lock()
+				online++
+				mu.Unlock()
+			}
+		}(device)
+	}
+	wg.Wait()
+
+	return online
+}
+
+// Check checks a single device, records the result and reports whether the
+// device is online.
+func (c *Checker) Check(device *wol_device.Device) bool {
+	result, err := c.Probe(device)
+	if err != nil {
+		c.logger.Warn("Status: Failed to check %s: %v", device.Name, err)
+		return false
+	}
+	return result.Online
+}
+
+// Probe checks a single device and records the result. The result's
+// Elapsed is how long the device took to answer.
+func (c *Checker) Probe(device *wol_device.Device) (*wol_network.WaitResult, error) {
+	// A single attempt: the poll interval is the whole timeout
+	result, err := wol_network.WaitForOnline(device.MACAddress, device.IPAddress, c.config.Timeout, wol_network.WaitOptions{
+		Send:     wol_network.SendOptions{Port: device.Port},
+		Checks:   c.config.Checks,
+		Interval: c.config.Timeout,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if result.Online != (device.Status == wol_device.StatusOnline) {
+		c.logger.Info("Status: Device %s is now %s", device.Name, statusName(result.Online))
+		c.config.Events.Publish(wol_events.Event{
+			Type:    wol_events.TypeStatus,
+			Device:  device.Name,
+			MAC:     device.MACAddress,
+			Success: true,
+			Status:  statusName(result.Online),
+			Data:    result,
+		})
+	}
+	if err := c.store.UpdateStatus(device.Name, result.Online, time.Now()); err != nil {
+		c.logger.Error("Status: Failed to update %s: %v", device.Name, err)
+	}
+	return result, nil
+}
+
+func statusName(online bool) string {
+	if online {
+		return wol_device.StatusOnline
+	}
+	return wol_device.StatusOffline
+}
@@ -0,0 +1,94 @@
+package wol_status
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_events "wol-server/wol/events"
+	wol_log "wol-server/wol/log"
+	wol_network "wol-server/wol/network"
+)
+
+// fakeVerifier reports the hosts in up as online.
+type fakeVerifier struct {
+	up map[string]bool
+}
+
+func (v fakeVerifier) Name() string { return "fake" }
+
+func (v fakeVerifier) Verify(ctx context.Context, target wol_network.VerifyTarget) wol_network.VerifierResult {
+	return wol_network.VerifierResult{Name: "fake", Success: v.up[target.IP]}
+}
+
+func TestChecker_CheckAll(t *testing.T) {
+	store, err := wol_device.NewDeviceStore(wol_device.DeviceConfig{ConfigPath: filepath.Join(t.TempDir(), "devices.json")})
+	if err != nil {
+		t.Fatalf("Failed to create store: %v", err)
+	}
+	devices := []struct{ name, mac, ip string }{
+		{"desktop", "AA:BB:CC:DD:EE:01", "192.168.1.10"},
+		{"nas", "AA:BB:CC:DD:EE:02", "192.168.1.11"},
+		{"laptop", "AA:BB:CC:DD:EE:03", ""},
+	}
+	for _, d := range devices {
+		if err := store.AddDevice(d.name, d.mac, "", d.ip, 9); err != nil {
+			t.Fatalf("Failed to add device: %v", err)
+		}
+	}
+
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+	verifier := fakeVerifier{up: map[string]bool{"192.168.1.10": true}}
+	bus := wol_events.NewBus()
+	events, cancel := bus.Subscribe()
+	defer cancel()
+	checker := NewChecker(Config{Timeout: 100 * time.Millisecond, Checks: []wol_network.Verifier{verifier}, Events: bus}, store, logger)
+
+	if online := checker.CheckAll(); online != 1 {
+		t.Errorf("CheckAll() = %d online, want 1", online)
+	}
+	// nas going from unknown to offline is not a change worth an event
+	if len(events) != 1 {
+		t.Fatalf("got %d status events, want 1", len(events))
+	}
+	if event := <-events; event.Device != "desktop" || event.Status != wol_device.StatusOnline {
+		t.Errorf("got event %+v, want desktop online", event)
+	}
+
+	tests := []struct {
+		name     string
+		status   string
+		lastSeen bool
+	}{
+		{"desktop", wol_device.StatusOnline, true},
+		{"nas", wol_device.StatusOffline, false},
+		{"laptop", wol_device.StatusUnknown, false},
+	}
+	for _, tt := range tests {
+		device, err := store.GetDevice(tt.name)
+		if err != nil {
+			t.Fatalf("GetDevice(%s) error = %v", tt.name, err)
+		}
+		if device.Status != tt.status {
+			t.Errorf("%s status = %q, want %q", tt.name, device.Status, tt.status)
+		}
+		if device.LastSeen.IsZero() == tt.lastSeen {
+			t.Errorf("%s LastSeen = %v, want set = %v", tt.name, device.LastSeen, tt.lastSeen)
+		}
+	}
+
+	// The device going down is recorded on the next round
+	verifier.up["192.168.1.10"] = false
+	checker.CheckAll()
+	device, _ := store.GetDevice("desktop")
+	if device.Status != wol_device.StatusOffline {
+		t.Errorf("desktop status = %q after going down, want offline", device.Status)
+	}
+	if device.LastSeen.IsZero() {
+		t.Error("desktop LastSeen should be kept after going down")
+	}
+	if event := <-events; event.Device != "desktop" || event.Status != wol_device.StatusOffline {
+		t.Errorf("got event %+v, want desktop offline", event)
+	}
+}
@@ -0,0 +1,256 @@
+package wol_webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_events "wol-server/wol/events"
+	wol_log "wol-server/wol/log"
+)
+
+// Webhook events. Wake events come from every wake attempt; device events
+// from the status checker and from wakes that waited for the device.
+const (
+	EventWakeSuccess   = "wake.success"
+	EventWakeFailure   = "wake.failure"
+	EventDeviceOnline  = "device.online"
+	EventDeviceOffline = "device.offline"
+)
+
+var AllEvents = []string{EventWakeSuccess, EventWakeFailure, EventDeviceOnline, EventDeviceOffline}
+
+const (
+	// SignatureHeader carries "sha256=" and the hex HMAC-SHA256 of the
+	// request body, keyed with the webhook's secret
+	SignatureHeader = "X-WoL-Signature-256"
+	EventHeader     = "X-WoL-Event"
+	DeliveryHeader  = "X-WoL-Delivery"
+
+	DefaultTimeout = 10 * time.Second
+	// DefaultAttempts is how many times a delivery is tried before it is
+	// dropped
+	DefaultAttempts = 3
+)
+
+type Config struct {
+	URL string
+	// Secret signs every delivery; empty means deliveries are unsigned
+	Secret string
+	// Events limits the webhook to these events; empty means all of them
+	Events []string
+}
+
+func (c Config) Validate() error {
+	u, err := url.Parse(c.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook URL %q: must be an http or https URL", c.URL)
+	}
+	for _, event := range c.Events {
+		if !slices.Contains(AllEvents, event) {
+			return fmt.Errorf("unknown webhook event %q (expected one of %v)", event, AllEvents)
+		}
+	}
+	return nil
+}
+
+func (c Config) wants(event string) bool {
+	return len(c.Events) == 0 || slices.Contains(c.Events, event)
+}
+
+// Payload is the JSON body of a delivery.
+type Payload struct {
+	Event     string    `json:"event"`
+	Device    string    `json:"device,omitempty"`
+	MAC       string    `json:"mac,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+	// Data is the wake details or the status check result
+	Data interface{} `json:"data,omitempty"`
+}
+
+// Sign returns the SignatureHeader value for body.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the SignatureHeader value for body,
+// for receivers written in Go.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Dispatcher posts events from an event bus to webhooks. Deliveries that
+// fail with a network error or a 5xx status are retried with backoff.
+type Dispatcher struct {
+	hooks    []Config
+	client   *http.Client
+	logger   *wol_log.Logger
+	attempts int
+	backoff  time.Duration
+
+	cancel func()
+	// stopped is closed by Stop, which ends retries early
+	stopped chan struct{}
+	wg      sync.WaitGroup
+
+	mu         sync.Mutex
+	deliveries int64
+}
+
+func NewDispatcher(hooks []Config, logger *wol_log.Logger) (*Dispatcher, error) {
+	for _, hook := range hooks {
+		if err := hook.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Dispatcher{
+		hooks:    hooks,
+		client:   &http.Client{Timeout: DefaultTimeout},
+		logger:   logger,
+		attempts: DefaultAttempts,
+		backoff:  time.Second,
+		stopped:  make(chan struct{}),
+	}, nil
+}
+
+// Start delivers events published on bus until Stop is called.
+func (d *Dispatcher) Start(bus *wol_events.Bus) {
+	events, cancel := bus.Subscribe()
+	d.cancel = cancel
+
+	d.wg.Add(1)
+	go func() {
+		defer d.wg.Done()
+		for event := range events {
+			d.Dispatch(event)
+		}
+	}()
+}
+
+// Stop ends the subscription and waits for deliveries in flight, without
+// retrying them.
+func (d *Dispatcher) Stop() {
+	if d.cancel != nil {
+		d.cancel()
+	}
+	close(d.stopped)
+	d.wg.Wait()
+}
+
+// Dispatch sends event to every webhook that wants it, in the background.
+func (d *Dispatcher) Dispatch(event wol_events.Event) {
+	payload, ok := payloadFor(event)
+	if !ok {
+		return
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		d.logger.Warn("Webhook: Failed to encode %s event: %v", payload.Event, err)
+		return
+	}
+
+	for _, hook := range d.hooks {
+		if !hook.wants(payload.Event) {
+			continue
+		}
+		d.wg.Add(1)
+		go func(hook Config) {
+			defer d.wg.Done()
+			d.deliver(hook, payload.Event, d.nextDelivery(), body)
+		}(hook)
+	}
+}
+
+func (d *Dispatcher) nextDelivery() string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.deliveries++
+	return strconv.FormatInt(time.Now().Unix(), 10) + "-" + strconv.FormatInt(d.deliveries, 10)
+}
+
+func payloadFor(event wol_events.Event) (Payload, bool) {
+	payload := Payload{
+		Device:    event.Device,
+		MAC:       event.MAC,
+		Error:     event.Error,
+		Timestamp: event.Timestamp,
+		Data:      event.Data,
+	}
+
+	switch {
+	case event.Type == wol_events.TypeWake && event.Success:
+		payload.Event = EventWakeSuccess
+	case event.Type == wol_events.TypeWake:
+		payload.Event = EventWakeFailure
+	case event.Type == wol_events.TypeStatus && event.Status == wol_device.StatusOnline:
+		payload.Event = EventDeviceOnline
+	case event.Type == wol_events.TypeStatus && event.Status == wol_device.StatusOffline:
+		payload.Event = EventDeviceOffline
+	default:
+		return Payload{}, false
+	}
+	return payload, true
+}
+
+func (d *Dispatcher) deliver(hook Config, event, delivery string, body []byte) {
+	backoff := d.backoff
+	for attempt := 1; ; attempt++ {
+		retry, err := d.post(hook, event, delivery, body)
+		if err == nil {
+			d.logger.Debug("Webhook: Delivered %s to %s", event, hook.URL)
+			return
+		}
+		if !retry || attempt >= d.attempts {
+			d.logger.Warn("Webhook: Failed to deliver %s to %s: %v", event, hook.URL, err)
+			return
+		}
+		d.logger.Debug("Webhook: Delivery of %s to %s failed (%v), retrying in %v", event, hook.URL, err, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-d.stopped:
+			d.logger.Warn("Webhook: Gave up on %s to %s at shutdown: %v", event, hook.URL, err)
+			return
+		}
+		backoff *= 2
+	}
+}
+
+// post sends one delivery and reports whether a failure is worth retrying.
+func (d *Dispatcher) post(hook Config, event, delivery string, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "wol-server-webhook")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, delivery)
+	if hook.Secret != "" {
+		req.Header.Set(SignatureHeader, Sign(hook.Secret, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests,
+			fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return false, nil
+}
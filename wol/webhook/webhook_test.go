@@ -0,0 +1,154 @@
+package wol_webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	wol_device "wol-server/wol/device"
+	wol_events "wol-server/wol/events"
+	wol_log "wol-server/wol/log"
+)
+
+type delivery struct {
+	header  http.Header
+	body    []byte
+	payload Payload
+}
+
+// receiver records deliveries, failing the first failures of them with
+// 503.
+type receiver struct {
+	mu         sync.Mutex
+	failures   int
+	deliveries []delivery
+	got        chan struct{}
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if rc.failures > 0 {
+		rc.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	d := delivery{header: r.Header, body: body}
+	json.Unmarshal(body, &d.payload)
+	rc.deliveries = append(rc.deliveries, d)
+	rc.got <- struct{}{}
+}
+
+func newTestDispatcher(t *testing.T, hooks ...Config) *Dispatcher {
+	t.Helper()
+	logger, _ := wol_log.NewLogger(wol_log.LoggerConfig{Level: wol_log.ERROR})
+	d, err := NewDispatcher(hooks, logger)
+	if err != nil {
+		t.Fatalf("NewDispatcher() error = %v", err)
+	}
+	d.backoff = time.Millisecond
+	return d
+}
+
+func TestDispatcher(t *testing.T) {
+	rc := &receiver{failures: 1, got: make(chan struct{}, 10)}
+	server := httptest.NewServer(rc)
+	defer server.Close()
+
+	d := newTestDispatcher(t,
+		Config{URL: server.URL + "/all", Secret: "s3cret"},
+		Config{URL: server.URL + "/online", Events: []string{EventDeviceOnline}},
+	)
+	bus := wol_events.NewBus()
+	d.Start(bus)
+
+	bus.Publish(wol_events.Event{Type: wol_events.TypeWake, Device: "nas", MAC: "AA:BB:CC:DD:EE:FF", Success: true})
+	bus.Publish(wol_events.Event{Type: wol_events.TypeDiscovery, Success: true})
+	bus.Publish(wol_events.Event{Type: wol_events.TypeStatus, Device: "nas", Status: wol_device.StatusOnline, Success: true})
+
+	for i := 0; i < 3; i++ {
+		select {
+		case <-rc.got:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d deliveries, want 3", i)
+		}
+	}
+	d.Stop()
+
+	counts := make(map[string]int)
+	for _, d := range rc.deliveries {
+		event := d.header.Get(EventHeader)
+		if event != d.payload.Event {
+			t.Errorf("%s header = %q, payload event = %q", EventHeader, event, d.payload.Event)
+		}
+		counts[event]++
+
+		signature := d.header.Get(SignatureHeader)
+		if signature != "" && !Verify("s3cret", d.body, signature) {
+			t.Errorf("delivery of %s has a bad signature %q", event, signature)
+		}
+	}
+	if counts[EventWakeSuccess] != 1 || counts[EventDeviceOnline] != 2 {
+		t.Errorf("deliveries = %v, want one wake.success and two device.online", counts)
+	}
+}
+
+func TestPayloadFor(t *testing.T) {
+	tests := []struct {
+		event wol_events.Event
+		want  string
+	}{
+		{wol_events.Event{Type: wol_events.TypeWake, Success: true}, EventWakeSuccess},
+		{wol_events.Event{Type: wol_events.TypeWake, Error: "no route"}, EventWakeFailure},
+		{wol_events.Event{Type: wol_events.TypeStatus, Status: wol_device.StatusOnline}, EventDeviceOnline},
+		{wol_events.Event{Type: wol_events.TypeStatus, Status: wol_device.StatusOffline}, EventDeviceOffline},
+		{wol_events.Event{Type: wol_events.TypeDiscovery}, ""},
+	}
+
+	for _, tt := range tests {
+		payload, ok := payloadFor(tt.event)
+		if ok != (tt.want != "") || payload.Event != tt.want {
+			t.Errorf("payloadFor(%+v) = %q, %v, want %q", tt.event, payload.Event, ok, tt.want)
+		}
+	}
+}
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		config  Config
+		wantErr bool
+	}{
+		{Config{URL: "https://hooks.example.com/wol"}, false},
+		{Config{URL: "http://n8n.local:5678/webhook/abc", Events: []string{EventWakeFailure}}, false},
+		{Config{URL: "ftp://example.com"}, true},
+		{Config{URL: "example.com/hook"}, true},
+		{Config{URL: "https://example.com", Events: []string{"wake"}}, true},
+	}
+
+	for _, tt := range tests {
+		if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+			t.Errorf("Validate(%+v) error = %v, wantErr %v", tt.config, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	// echo -n '{"event":"wake.success"}' | openssl dgst -sha256 -hmac key
+	body := []byte(`{"event":"wake.success"}`)
+	signature := Sign("key", body)
+	if want := "sha256=302e8dec0884c19b553a6e156a5151d8b60b59f61d7b9e350bd01c72ddb51883"; signature != want {
+		t.Errorf("Sign() = %s, want %s", signature, want)
+	}
+	if !Verify("key", body, signature) {
+		t.Error("Verify() rejected its own signature")
+	}
+	if Verify("other", body, signature) {
+		t.Error("Verify() accepted a signature made with another secret")
+	}
+}